@@ -10,4 +10,27 @@ func AppendGlobalCmdFlagsToConfig(cmdFlags *pflag.FlagSet, config *lepton.Config
 	config.RunConfig.ShowWarnings, _ = cmdFlags.GetBool("show-warnings")
 	config.RunConfig.ShowErrors, _ = cmdFlags.GetBool("show-errors")
 	config.RunConfig.ShowDebug, _ = cmdFlags.GetBool("show-debug")
+	config.RunConfig.DryRun, _ = cmdFlags.GetBool("dry-run")
+	config.RunConfig.Quiet, _ = cmdFlags.GetBool("quiet")
+
+	if verbose, _ := cmdFlags.GetBool("verbose"); verbose {
+		config.RunConfig.Verbose = true
+	}
+
+	logFormat, _ := cmdFlags.GetString("log-format")
+	if logFormat != "" && logFormat != lepton.LogFormatText && logFormat != lepton.LogFormatJSON {
+		exitWithError("unknown log format " + logFormat + ", use text or json")
+	}
+	config.RunConfig.LogFormat = logFormat
+
+	if timeFormat, _ := cmdFlags.GetString("time-format"); timeFormat != "" {
+		if err := lepton.ValidTimeFormat(timeFormat); err != nil {
+			exitWithError(err.Error())
+		}
+		config.RunConfig.TimeFormat = timeFormat
+	}
+
+	if deployID, _ := cmdFlags.GetString("deploy-id"); deployID != "" {
+		config.RunConfig.DeployID = deployID
+	}
 }
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+// recoverCommands wraps the handlers of cmd and its subcommands so a panic
+// of a provider operation exits with a crash report instead of a stack trace
+func recoverCommands(cmd *cobra.Command) {
+	for _, sub := range cmd.Commands() {
+		recoverCommands(sub)
+	}
+
+	if cmd.Run == nil {
+		return
+	}
+
+	run := cmd.Run
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		err := runRecovered(run, cmd, args)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+	}
+}
+
+// runRecovered runs the command handler and returns the crash error of a
+// panic
+func runRecovered(run func(*cobra.Command, []string), cmd *cobra.Command, args []string) (err error) {
+	defer api.RecoverPanic(cmd.CommandPath(), &err)
+
+	run(cmd, args)
+	return nil
+}
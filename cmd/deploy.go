@@ -0,0 +1,378 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func deployResourcesCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	c.CloudConfig.Zone = zone
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " deploy lookup not yet implemented")
+	}
+
+	err = aws.PrintDeployResources(ctx, args[0])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func deployResourcesCommand() *cobra.Command {
+	var cmdDeployResources = &cobra.Command{
+		Use:   "resources <deploy_id>",
+		Short: "list the resources created by a deploy",
+		Long:  "list the resources tagged with the deploy id printed by image create and instance create, or passed with --deploy-id",
+		Run:   deployResourcesCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+	return cmdDeployResources
+}
+
+func deployStatusCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	c.CloudConfig.Zone = zone
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " operation status not yet implemented")
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Operation", "State", "Progress", "Done", "Message"})
+	table.SetRowLine(true)
+
+	for _, id := range args {
+		status, err := aws.OperationStatus(ctx, id)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+
+		progress := ""
+		if status.Progress != "" {
+			progress = status.Progress + "%"
+		}
+
+		table.Append([]string{status.ID, status.State, progress, strconv.FormatBool(status.Done), status.Message})
+	}
+
+	table.Render()
+}
+
+func deployStatusCommand() *cobra.Command {
+	var cmdDeployStatus = &cobra.Command{
+		Use:   "status <operation>...",
+		Short: "show the status of async operations",
+		Long:  "show the status of the snapshot imports and instance launches whose ids are printed by image create and instance create with --async",
+		Run:   deployStatusCommandHandler,
+		Args:  cobra.MinimumNArgs(1),
+	}
+	return cmdDeployStatus
+}
+
+func deployWaitCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	c.CloudConfig.Zone = zone
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " operation wait not yet implemented")
+	}
+
+	for _, id := range args {
+		err = aws.WaitOperation(ctx, id)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+	}
+}
+
+func deployWaitCommand() *cobra.Command {
+	var cmdDeployWait = &cobra.Command{
+		Use:   "wait <operation>...",
+		Short: "wait for async operations",
+		Long:  "wait for the snapshot imports and instance launches started by image create and instance create with --async. The image of an async image create is registered once its snapshot is imported",
+		Run:   deployWaitCommandHandler,
+		Args:  cobra.MinimumNArgs(1),
+	}
+	return cmdDeployWait
+}
+
+func deployCommandHandler(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		cmd.Help()
+		return
+	}
+
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	if len(c.CloudConfig.BucketName) == 0 {
+		exitWithError("Please specify a cloud bucket in config")
+	}
+
+	retireFlags, _ := cmd.Flags().GetStringArray("retire")
+	retire, err := api.ParseListFilters(retireFlags)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	flavor, _ := cmd.Flags().GetString("flavor")
+	if flavor != "" {
+		c.CloudConfig.Flavor = flavor
+	}
+
+	count, _ := cmd.Flags().GetInt("count")
+	if count > 1 {
+		c.RunConfig.InstanceCount = count
+	}
+
+	domainname, _ := cmd.Flags().GetString("domainname")
+	if domainname != "" {
+		c.RunConfig.DomainName = domainname
+	}
+
+	domainAliases, _ := cmd.Flags().GetStringArray("domain-alias")
+	if len(domainAliases) > 0 {
+		c.RunConfig.DomainNames = domainAliases
+	}
+
+	waitTimeout, _ := cmd.Flags().GetInt("wait-timeout")
+	if waitTimeout != 0 {
+		c.RunConfig.WaitTimeout = waitTimeout
+	}
+
+	waitPort, _ := cmd.Flags().GetInt("wait-port")
+	if waitPort != 0 {
+		c.RunConfig.WaitPort = waitPort
+	}
+
+	force, _ := cmd.Flags().GetBool("force")
+	if force {
+		c.RunConfig.ExceedProjectCaps = true
+	}
+
+	c.Program = args[0]
+	c.CloudConfig.Platform = provider
+
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " rollouts not yet implemented")
+	}
+
+	prepareImages(c)
+	setDefaultImageName(cmd, c)
+	initDefaultRunConfigs(c, nil)
+
+	// the latest alias stays on the running image until the rollout succeeds
+	c.RunConfig.HoldLatestAlias = true
+
+	ctx := api.NewContext(c, &p)
+
+	keypath, err := p.BuildImage(ctx)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if !c.RunConfig.DryRun {
+		api.VerifyRole(ctx, c.CloudConfig.BucketName)
+	}
+
+	// the image is deployed and rolled out holding the lock, a concurrent
+	// deploy of the image would retire the instances of this one
+	err = withDeployLock(ctx, c, p, provider, c.CloudConfig.ImageName, func() error {
+		err := aws.DeployImage(ctx, keypath)
+		if err != nil {
+			return err
+		}
+
+		_, err = aws.RolloutInstances(ctx, retire)
+		if err != nil || c.RunConfig.DryRun {
+			return err
+		}
+
+		return aws.SetImageAlias(ctx, c.CloudConfig.ImageName, api.LatestImageAlias)
+	})
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func deployRollbackCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " rollbacks not yet implemented")
+	}
+
+	// a rollback replaces the instances of the image like a deploy does
+	err = withDeployLock(ctx, c, p, provider, args[0], func() error {
+		_, err := aws.RollbackDeploy(ctx, args[0])
+		return err
+	})
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func deployRollbackCommand() *cobra.Command {
+	var config string
+
+	var cmdDeployRollback = &cobra.Command{
+		Use:   "rollback <image_name>",
+		Short: "roll an image back to its previous deploy",
+		Long: "launch instances of the image deployed before the latest deploy with the config it was deployed with, point its domain " +
+			"names back to them and delete the instances of the latest deploy. The deploy history is kept in the ops home, or in the " +
+			"deployhistorybucket of the config",
+		Run:  deployRollbackCommandHandler,
+		Args: cobra.ExactArgs(1),
+	}
+	supportsDryRun(cmdDeployRollback)
+
+	cmdDeployRollback.Flags().StringVarP(&config, "config", "c", "", "ops config file setting the deploy history bucket and lock table")
+
+	return cmdDeployRollback
+}
+
+// DeployCommands provides deploy related commands
+func DeployCommands() *cobra.Command {
+	var targetCloud, zone, config, imageName, flavor, domainname string
+	var retire, domainAliases []string
+	var count, waitTimeout, waitPort int
+	var force bool
+
+	var cmdDeploy = &cobra.Command{
+		Use:   "deploy [elf]",
+		Short: "roll out a program to new instances, and inspect deploys and async operations",
+		Long: "build an image of the program and replace the instances matching --retire with instances of it: the new instances " +
+			"must run, respond on --wait-port if set and pass the load balancer health checks and the SmokeTests of the config " +
+			"before the domain names are pointed to them and the old instances are deleted. The new instances are deleted if they " +
+			"don't get ready",
+		ValidArgs: []string{"daemon", "edge", "rebuild", "resources", "rollback", "status", "wait"},
+		Args:      cobra.MaximumNArgs(1),
+		Run:       deployCommandHandler,
+	}
+	supportsDryRun(cmdDeploy)
+
+	cmdDeploy.PersistentFlags().StringVarP(&targetCloud, "target-cloud", "t", "aws", "cloud platform [aws]")
+	cmdDeploy.PersistentFlags().StringVarP(&zone, "zone", "z", os.Getenv("AWS_REGION"), "zone name for target cloud platform, defaults to env AWS_REGION")
+
+	cmdDeploy.Flags().StringVarP(&config, "config", "c", "", "ops config file")
+	cmdDeploy.Flags().StringVarP(&imageName, "imagename", "i", "", "image name")
+	cmdDeploy.Flags().StringVarP(&flavor, "flavor", "f", "", "instance type of the new instances")
+	cmdDeploy.Flags().IntVarP(&count, "count", "", 1, "number of new instances")
+	cmdDeploy.Flags().StringArrayVarP(&retire, "retire", "", nil, "delete the instances matching the filter once the new instances are ready, e.g. Name=web-*")
+	cmdDeploy.Flags().StringVarP(&domainname, "domainname", "d", "", "domain name pointed to the new instances")
+	cmdDeploy.Flags().StringArrayVarP(&domainAliases, "domain-alias", "", nil, "more domain names pointed to the new instances (repeatable)")
+	cmdDeploy.Flags().IntVarP(&waitTimeout, "wait-timeout", "", 0, "seconds to wait for the new instances, defaults to 300")
+	cmdDeploy.Flags().IntVarP(&waitPort, "wait-port", "", 0, "tcp port the new instances must accept connections on to be ready")
+	cmdDeploy.Flags().BoolVarP(&force, "force", "", false, "create the image and instances beyond the caps of the config project")
+
+	cmdDeploy.AddCommand(deployDaemonCommand())
+	cmdDeploy.AddCommand(deployEdgeCommand())
+	cmdDeploy.AddCommand(deployRebuildCommand())
+	cmdDeploy.AddCommand(deployResourcesCommand())
+	cmdDeploy.AddCommand(deployRollbackCommand())
+	cmdDeploy.AddCommand(deployStatusCommand())
+	cmdDeploy.AddCommand(deployWaitCommand())
+	return cmdDeploy
+}
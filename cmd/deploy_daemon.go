@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+func deployDaemonCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " deploy daemon not yet implemented")
+	}
+
+	initDefaultRunConfigs(c, nil)
+
+	ctx := api.NewContext(c, &p)
+
+	queueName, _ := cmd.Flags().GetString("queue")
+	if queueName == "" {
+		exitForCmd(cmd, "queue argument missing")
+	}
+
+	queue, err := api.NewDeployQueue(ctx, queueName)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	// the command running when interrupted completes before the daemon exits
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	aws.ConsumeDeployCommands(ctx, queue, stop)
+}
+
+func deployDaemonCommand() *cobra.Command {
+	var config, queue string
+
+	var cmdDeployDaemon = &cobra.Command{
+		Use:   "daemon",
+		Short: "run the scale, rollout and rollback commands received from a queue",
+		Long: "consume the deploy commands of an sqs queue url or pub/sub subscription (projects/<project>/subscriptions/<name>) " +
+			"until interrupted. Commands are json messages, e.g. {\"action\": \"scale\", \"group\": \"api\", \"desired\": 5}, " +
+			"{\"action\": \"rollout\", \"image\": \"api:v2\", \"count\": 2, \"retire\": [\"Image=api\"]} or " +
+			"{\"action\": \"rollback\", \"image\": \"api\"}, run with the config of the daemon. Messages are acknowledged once " +
+			"their command succeeds, failed commands are received again",
+		Run:  deployDaemonCommandHandler,
+		Args: cobra.NoArgs,
+	}
+	supportsDryRun(cmdDeployDaemon)
+
+	cmdDeployDaemon.Flags().StringVarP(&config, "config", "c", "", "ops config file the commands run with")
+	cmdDeployDaemon.Flags().StringVarP(&queue, "queue", "", "", "sqs queue url or pub/sub subscription the commands are received from [required]")
+
+	return cmdDeployDaemon
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+func deployEdgeCommandHandler(cmd *cobra.Command, args []string) {
+	platform, _ := cmd.Flags().GetString("platform")
+	if platform != "fastly" {
+		exitWithError(platform + " edge deploys not yet implemented, the supported platform is fastly")
+	}
+
+	token := os.Getenv("FASTLY_API_TOKEN")
+	if token == "" {
+		exitWithError("set FASTLY_API_TOKEN to deploy to fastly")
+	}
+
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	c.Program = args[0]
+
+	imageName, _ := cmd.Flags().GetString("imagename")
+	if imageName != "" {
+		c.CloudConfig.ImageName = imageName
+	}
+	if c.CloudConfig.ImageName == "" {
+		c.CloudConfig.ImageName = strings.TrimSuffix(filepath.Base(filepath.Clean(c.Program)), ".wasm")
+	}
+
+	domainname, _ := cmd.Flags().GetString("domainname")
+	if domainname != "" {
+		c.RunConfig.DomainName = domainname
+	}
+
+	ctx := api.NewContext(c, nil)
+
+	module, err := api.BuildWasmModule(c)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	err = api.NewFastlyEdge(token).DeployModule(ctx, module)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func deployEdgeCommand() *cobra.Command {
+	var config, platform, imageName, domainname string
+
+	var cmdDeployEdge = &cobra.Command{
+		Use:   "edge <module.wasm|source_dir>",
+		Short: "deploy a wasm module to an edge platform",
+		Long: "deploy a wasi module, or the module compiled from the source directory of a Go program with tinygo or of a Rust " +
+			"program with cargo, to the edge service named after the image name of the config, created if missing. The service " +
+			"serves the domain names of the config. The api token is read from FASTLY_API_TOKEN",
+		Run:  deployEdgeCommandHandler,
+		Args: cobra.ExactArgs(1),
+	}
+
+	cmdDeployEdge.Flags().StringVarP(&config, "config", "c", "", "ops config file")
+	cmdDeployEdge.Flags().StringVarP(&platform, "platform", "", "fastly", "edge platform [fastly]")
+	cmdDeployEdge.Flags().StringVarP(&imageName, "imagename", "i", "", "edge service name, defaults to the program name")
+	cmdDeployEdge.Flags().StringVarP(&domainname, "domainname", "d", "", "domain name served by the edge service")
+
+	return cmdDeployEdge
+}
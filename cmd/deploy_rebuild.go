@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func deployRebuildCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " rebuilds not yet implemented")
+	}
+
+	configs, _ := cmd.Flags().GetStringArray("config")
+	if len(configs) == 0 {
+		exitForCmd(cmd, "config argument missing")
+	}
+
+	retireFlags, _ := cmd.Flags().GetStringArray("retire")
+	retire, err := api.ParseListFilters(retireFlags)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	every, _ := cmd.Flags().GetDuration("every")
+	force, _ := cmd.Flags().GetBool("force")
+	report, _ := cmd.Flags().GetString("report")
+
+	rebuild := func() bool {
+		results, err := rebuildProjects(cmd, p, aws, configs, retire, force)
+		if err != nil {
+			fmt.Printf(api.ErrorColor+"\n", "rebuild failed: "+err.Error())
+			return false
+		}
+
+		return reportRebuild(results, report)
+	}
+
+	if every == 0 {
+		if !rebuild() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// the rebuild running when interrupted completes before the daemon exits
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	for {
+		rebuild()
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(every):
+		}
+
+		// forced rebuilds are only forced once
+		force = false
+	}
+}
+
+// rebuildProjects rebuilds the projects whose config is passed by argument
+// against the latest nanos release if they weren't rebuilt against it yet, or
+// all of them if force is set. Projects that fail are rebuilt again by the
+// next run
+func rebuildProjects(cmd *cobra.Command, p api.Provider, aws *api.AWS, configs []string, retire []api.ListFilter, force bool) ([]api.RebuildResult, error) {
+	version, err := api.FetchLatestReleaseVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := api.LoadRebuildState()
+	if err != nil {
+		return nil, err
+	}
+
+	stale := configs
+	if !force {
+		stale = state.Stale(configs, version)
+	}
+
+	if len(stale) == 0 {
+		fmt.Printf("Projects are built against nanos %s, nothing to rebuild\n", version)
+		return nil, nil
+	}
+
+	if api.LocalReleaseVersion != version {
+		fmt.Printf("Downloading nanos %s\n", version)
+		err = api.DownloadReleaseImages(version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	var results []api.RebuildResult
+	for _, config := range stale {
+		fmt.Printf("Rebuilding %s against nanos %s\n", config, version)
+
+		result := rebuildProject(cmd, p, aws, config, retire)
+		result.Version = version
+		results = append(results, result)
+
+		if !result.Failed() && !dryRun {
+			state.Versions[config] = version
+		}
+	}
+
+	if !dryRun {
+		err = state.Save()
+		if err != nil {
+			return results, err
+		}
+	}
+
+	return results, nil
+}
+
+// rebuildProject builds the image of the project config with the local nanos
+// release, deploys it to a canary that must pass the smoke tests of the
+// config and, if retire filters are set, rolls it out to the instances
+// matching them. An image failing its canary is deregistered and the latest
+// alias pointed back to the image holding it before
+func rebuildProject(cmd *cobra.Command, p api.Provider, aws *api.AWS, config string, retire []api.ListFilter) (result api.RebuildResult) {
+	result = api.RebuildResult{Project: config, Started: time.Now()}
+	defer func() {
+		result.Finished = time.Now()
+	}()
+
+	fail := func(err error) api.RebuildResult {
+		result.Error = err.Error()
+		return result
+	}
+
+	c := unWarpConfig(config)
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	switch {
+	case c.Program == "":
+		return fail(fmt.Errorf("%s has no Program to rebuild", config))
+	case c.CloudConfig.Zone == "":
+		return fail(fmt.Errorf("%s has no zone to deploy to", config))
+	case c.CloudConfig.BucketName == "":
+		return fail(fmt.Errorf("%s has no cloud bucket", config))
+	}
+
+	c.CloudConfig.Platform = "aws"
+	if c.CloudConfig.ImageName == "" {
+		c.CloudConfig.ImageName = fmt.Sprintf("%v-image", filepath.Base(c.Program))
+	}
+	c.RunConfig.Imagename = path.Join(api.GetOpsHome(), "images", filepath.Base(c.CloudConfig.ImageName))
+	result.Image = c.CloudConfig.ImageName
+
+	prepareImages(c)
+	initDefaultRunConfigs(c, nil)
+
+	// the latest alias stays on the running image until the rollout succeeds
+	c.RunConfig.HoldLatestAlias = true
+
+	ctx := api.NewContext(c, &p)
+
+	keypath, err := p.BuildImage(ctx)
+	if err != nil {
+		return fail(err)
+	}
+
+	if !c.RunConfig.DryRun {
+		api.VerifyRole(ctx, c.CloudConfig.BucketName)
+	}
+
+	err = aws.DeployImage(ctx, keypath)
+	if err != nil {
+		return fail(err)
+	}
+
+	result.Canary, err = aws.CanaryDeploy(ctx)
+	if err != nil {
+		// the image failing its canary mustn't be launched by name
+		if !c.RunConfig.DryRun {
+			discardErr := aws.DiscardDeployedImages(ctx)
+			if discardErr != nil {
+				err = fmt.Errorf("%v, unable to discard the image: %v", err, discardErr)
+			}
+		}
+		return fail(err)
+	}
+
+	if len(retire) > 0 {
+		result.RolledOut, err = aws.RolloutInstances(ctx, retire)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	if !c.RunConfig.DryRun {
+		err = aws.SetImageAlias(ctx, c.CloudConfig.ImageName, api.LatestImageAlias)
+		if err != nil {
+			return fail(err)
+		}
+	}
+
+	return result
+}
+
+// reportRebuild prints the results of a rebuild and writes them as json to
+// the report file if there is one. It returns false if a project failed
+func reportRebuild(results []api.RebuildResult, report string) bool {
+	passed := true
+
+	if len(results) > 0 {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Project", "Nanos", "Image", "Canary", "Rolled Out", "Result"})
+		table.SetRowLine(true)
+
+		for _, result := range results {
+			outcome := "ok"
+			if result.Failed() {
+				outcome = "failed: " + result.Error
+				passed = false
+			}
+			table.Append([]string{result.Project, result.Version, result.Image, result.Canary, strings.Join(result.RolledOut, ", "), outcome})
+		}
+
+		table.Render()
+	}
+
+	if report == "" {
+		return passed
+	}
+
+	f, err := os.Create(report)
+	if err != nil {
+		fmt.Printf(api.ErrorColor+"\n", "unable to write the rebuild report: "+err.Error())
+		return false
+	}
+	defer f.Close()
+
+	err = api.WriteRebuildReport(f, results)
+	if err != nil {
+		fmt.Printf(api.ErrorColor+"\n", "unable to write the rebuild report: "+err.Error())
+		return false
+	}
+
+	return passed
+}
+
+func deployRebuildCommand() *cobra.Command {
+	var configs, retire []string
+	var report string
+	var every time.Duration
+	var force bool
+
+	var cmdDeployRebuild = &cobra.Command{
+		Use:   "rebuild",
+		Short: "rebuild and redeploy projects when a new nanos release is out",
+		Long: "look up the latest nanos release and rebuild the image of each project config not built against it yet: the image is " +
+			"deployed to a canary instance that must pass the SmokeTests of the config, then rolled out to the instances matching " +
+			"--retire if set. The releases projects were rebuilt against are kept in the ops home, failed projects are rebuilt by " +
+			"the next run. Runs once, e.g. from cron, or every --every until interrupted",
+		Run:  deployRebuildCommandHandler,
+		Args: cobra.NoArgs,
+	}
+	supportsDryRun(cmdDeployRebuild)
+
+	cmdDeployRebuild.Flags().StringArrayVarP(&configs, "config", "c", nil, "ops config of a project rebuilt, its Program is built (repeatable) [required]")
+	cmdDeployRebuild.Flags().StringArrayVarP(&retire, "retire", "", nil, "roll the canary image out to the instances matching the filter, e.g. Image=api")
+	cmdDeployRebuild.Flags().DurationVarP(&every, "every", "", 0, "check for a new release at this interval until interrupted, e.g. 24h")
+	cmdDeployRebuild.Flags().BoolVarP(&force, "force", "", false, "rebuild the projects even if they're built against the latest release")
+	cmdDeployRebuild.Flags().StringVarP(&report, "report", "", "", "file the results are written to as json")
+
+	return cmdDeployRebuild
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+// dryRunAnnotation marks the commands supporting the global --dry-run flag
+const dryRunAnnotation = "dryrun"
+
+// dryRunAnyProvider is the dryRunAnnotation of the commands implementing the
+// dry run themselves, for every provider they support
+const dryRunAnyProvider = "any"
+
+// supportsDryRun marks cmd as supporting the global --dry-run flag with the
+// providers implementing api.DryRunner
+func supportsDryRun(cmd *cobra.Command) *cobra.Command {
+	return annotateDryRun(cmd, "true")
+}
+
+// supportsDryRunOnAnyProvider marks cmd as supporting the global --dry-run
+// flag with every provider it supports
+func supportsDryRunOnAnyProvider(cmd *cobra.Command) *cobra.Command {
+	return annotateDryRun(cmd, dryRunAnyProvider)
+}
+
+func annotateDryRun(cmd *cobra.Command, value string) *cobra.Command {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[dryRunAnnotation] = value
+	return cmd
+}
+
+// checkDryRun exits if --dry-run is passed to a command or a provider that
+// doesn't support it, as they would change resources anyway
+func checkDryRun(cmd *cobra.Command, args []string) {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	if !dryRun {
+		return
+	}
+
+	switch cmd.Annotations[dryRunAnnotation] {
+	case "":
+		exitWithError(cmd.CommandPath() + " doesn't support --dry-run")
+	case dryRunAnyProvider:
+		return
+	}
+
+	// unknown providers are reported by the command
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		return
+	}
+
+	if dryRunner, ok := p.(api.DryRunner); !ok || !dryRunner.SupportsDryRun() {
+		exitWithError(provider + " --dry-run not yet implemented")
+	}
+}
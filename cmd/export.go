@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+// exportFormat returns the format the listing of the command is exported in,
+// empty if it's printed as a table
+func exportFormat(cmd *cobra.Command) string {
+	format, _ := cmd.Flags().GetString("export")
+	if format == "" {
+		return ""
+	}
+
+	err := api.ValidExportFormat(format)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	return format
+}
+
+// exportListing writes the listing in the format to the output file of the
+// command, stdout if it has none
+func exportListing(cmd *cobra.Command, format string, header []string, rows [][]string) {
+	w, closeOutput := exportOutput(cmd)
+	defer closeOutput()
+
+	err := api.ExportTable(w, format, header, rows)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+// exportOutput returns the output file of the command, stdout if it has
+// none, and the function closing it
+func exportOutput(cmd *cobra.Command) (io.Writer, func()) {
+	output, _ := cmd.Flags().GetString("output")
+	if output == "" {
+		return os.Stdout, func() {}
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	return f, func() { f.Close() }
+}
+
+// streamInstances writes the instances of the provider to the output of the
+// command in the format a page at a time as they are listed, unsorted,
+// fleets too large to buffer rendering incrementally
+func streamInstances(cmd *cobra.Command, ctx *api.Context, p api.Provider, format string) {
+	w, closeOutput := exportOutput(cmd)
+	defer closeOutput()
+
+	stream, err := api.NewExportStream(w, format, api.InstancesHeader)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	err = api.EachInstancePage(ctx, p, func(page []api.CloudInstance) error {
+		return stream.Write(api.InstanceRows(page))
+	})
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	err = stream.Close()
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
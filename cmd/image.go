@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	api "github.com/nanovms/ops/lepton"
 	"github.com/spf13/cobra"
@@ -37,6 +40,62 @@ func imageCreateCommandHandler(cmd *cobra.Command, args []string) {
 		c.NightlyBuild = nightly
 	}
 
+	description, _ := cmd.Flags().GetString("description")
+	if description != "" {
+		c.CloudConfig.ImageDescription = description
+	}
+
+	async, _ := cmd.Flags().GetBool("async")
+	if async {
+		c.RunConfig.Async = true
+	}
+
+	enaSupport, _ := cmd.Flags().GetBool("ena-support")
+	if enaSupport {
+		c.CloudConfig.EnaSupport = true
+	}
+
+	force, _ := cmd.Flags().GetBool("force")
+	if force {
+		c.RunConfig.ExceedProjectCaps = true
+	}
+
+	guestOSFeatures, _ := cmd.Flags().GetStringArray("guest-os-feature")
+	if len(guestOSFeatures) > 0 {
+		c.CloudConfig.GuestOSFeatures = guestOSFeatures
+	}
+
+	imageGallery, _ := cmd.Flags().GetString("image-gallery")
+	if imageGallery != "" {
+		c.CloudConfig.ImageGallery = imageGallery
+	}
+
+	replicationRegions, _ := cmd.Flags().GetStringArray("replication-region")
+	if len(replicationRegions) > 0 {
+		c.CloudConfig.ReplicationRegions = replicationRegions
+	}
+
+	kernelArgs, _ := cmd.Flags().GetStringArray("kernel-arg")
+	c.RunConfig.KernelArgs = append(c.RunConfig.KernelArgs, kernelArgs...)
+	if err := api.CheckKernelArgs(c); err != nil {
+		exitWithError(err.Error())
+	}
+
+	metadata, _ := cmd.Flags().GetStringArray("metadata")
+	if len(metadata) > 0 {
+		if c.CloudConfig.ImageMetadata == nil {
+			c.CloudConfig.ImageMetadata = make(map[string]string)
+		}
+
+		for _, m := range metadata {
+			kv := strings.SplitN(m, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				exitWithError("invalid metadata argument " + m + ", expected KEY=VALUE")
+			}
+			c.CloudConfig.ImageMetadata[kv[0]] = kv[1]
+		}
+	}
+
 	if len(c.CloudConfig.Platform) == 0 {
 		exitWithError("Please select on of the cloud platform in config. [onprem, aws, gcp, do, vsphere, vultr]")
 	}
@@ -87,9 +146,10 @@ func imageCreateCommandHandler(cmd *cobra.Command, args []string) {
 			exitWithError(err.Error())
 		}
 
-		pkgConfig := unWarpConfig(manifest)
+		pkgConfig := unWarpPackageConfig(manifest)
 		c = mergeConfigs(pkgConfig, c)
 		setDefaultImageName(cmd, c)
+		setKernelArgsImageName(c)
 
 		// Config merged with package config, need to update context
 		ctx = api.NewContext(c, &p)
@@ -98,6 +158,7 @@ func imageCreateCommandHandler(cmd *cobra.Command, args []string) {
 
 	} else {
 		setDefaultImageName(cmd, c)
+		setKernelArgsImageName(c)
 		keypath, err = p.BuildImage(ctx)
 	}
 
@@ -105,6 +166,23 @@ func imageCreateCommandHandler(cmd *cobra.Command, args []string) {
 		exitWithError(err.Error())
 	}
 
+	if zones := commandZones(cmd, c); len(zones) > 0 {
+		if _, ok := p.(*api.AWS); !ok {
+			exitWithError(provider + " image create in several zones not yet implemented")
+		}
+
+		// the role is global, verified once for every region
+		if !c.RunConfig.DryRun {
+			api.VerifyRole(ctx, c.CloudConfig.BucketName)
+		}
+
+		failed := inZones(provider, c, zones, func(ctx *api.Context, p api.Provider, zone string) error {
+			return p.(*api.AWS).DeployImage(ctx, keypath)
+		})
+		printZoneResults(zones, failed)
+		return
+	}
+
 	if c.CloudConfig.Platform == "vultr" {
 		do := p.(*api.Vultr)
 		err = do.Storage.CopyToBucket(c, keypath)
@@ -153,18 +231,16 @@ func imageCreateCommandHandler(cmd *cobra.Command, args []string) {
 	if c.CloudConfig.Platform == "aws" {
 		aws := p.(*api.AWS)
 
-		// verify we can even use the vm importer
-		api.VerifyRole(ctx, c.CloudConfig.BucketName)
-
-		err = aws.Storage.CopyToBucket(c, keypath)
-		if err != nil {
-			exitWithError(err.Error())
+		// verify we can even use the vm importer, the role is updated if not
+		if !c.RunConfig.DryRun {
+			api.VerifyRole(ctx, c.CloudConfig.BucketName)
 		}
 
-		err = aws.CreateImage(ctx)
+		// the upload is skipped when resuming an interrupted deploy
+		err = aws.DeployImage(ctx, keypath)
 		if err != nil {
 			exitWithError(err.Error())
-		} else {
+		} else if !c.RunConfig.Async && !c.RunConfig.DryRun {
 			fmt.Printf("aws image '%s' created...\n", c.CloudConfig.ImageName)
 		}
 	}
@@ -215,9 +291,10 @@ func imageCreateCommandHandler(cmd *cobra.Command, args []string) {
 
 func imageCreateCommand() *cobra.Command {
 	var (
-		config, pkg, imageName string
-		args, mounts           []string
-		nightly                bool
+		config, pkg, imageName, description, imageGallery string
+		args, mounts, metadata, zones, replicationRegions []string
+		guestOSFeatures, kernelArgs                       []string
+		nightly, async, enaSupport, force                 bool
 	)
 
 	var cmdImageCreate = &cobra.Command{
@@ -225,6 +302,7 @@ func imageCreateCommand() *cobra.Command {
 		Short: "create nanos image from ELF",
 		Run:   imageCreateCommandHandler,
 	}
+	supportsDryRun(cmdImageCreate)
 
 	cmdImageCreate.PersistentFlags().StringVarP(&config, "config", "c", "", "ops config file")
 	cmdImageCreate.PersistentFlags().StringVarP(&pkg, "package", "p", "", "ops package name")
@@ -233,6 +311,16 @@ func imageCreateCommand() *cobra.Command {
 	cmdImageCreate.PersistentFlags().BoolVarP(&nightly, "nightly", "n", false, "nightly build")
 
 	cmdImageCreate.PersistentFlags().StringVarP(&imageName, "imagename", "i", "", "image name")
+	cmdImageCreate.PersistentFlags().StringVarP(&description, "description", "", "", "description of the cloud image, defaults to nanos image <imagename>")
+	cmdImageCreate.PersistentFlags().BoolVarP(&async, "async", "", false, "return once the snapshot import started, see deploy wait (aws)")
+	cmdImageCreate.PersistentFlags().BoolVarP(&enaSupport, "ena-support", "", false, "register the image with ENA, required by gpu and most recent instance types (aws)")
+	cmdImageCreate.PersistentFlags().BoolVarP(&force, "force", "", false, "create the image beyond the maximages cap of the config project (aws)")
+	cmdImageCreate.PersistentFlags().StringArrayVarP(&guestOSFeatures, "guest-os-feature", "", nil, "guest os feature of the image, e.g. uefi or gvnic (repeatable, gcp)")
+	cmdImageCreate.PersistentFlags().StringArrayVarP(&metadata, "metadata", "", nil, "key=value metadata of the cloud image, tags on aws and azure, labels on gcp")
+	cmdImageCreate.PersistentFlags().StringArrayVarP(&zones, "zones", "", nil, "regions the image is created in concurrently, defaults to the zones of the config (aws)")
+	cmdImageCreate.PersistentFlags().StringVarP(&imageGallery, "image-gallery", "", "", "shared image gallery the image is published to as a new version (azure)")
+	cmdImageCreate.PersistentFlags().StringArrayVarP(&replicationRegions, "replication-region", "", nil, "region the gallery image version is replicated to besides the zone (azure, repeatable)")
+	cmdImageCreate.PersistentFlags().StringArrayVarP(&kernelArgs, "kernel-arg", "", nil, "kernel argument override baked in the manifest, name or name=value, e.g. trace. The image is named after the overrides, e.g. api-trace (repeatable)")
 	return cmdImageCreate
 }
 
@@ -275,6 +363,11 @@ func imageResizeCommand() *cobra.Command {
 func imageListCommandHandler(cmd *cobra.Command, args []string) {
 	provider, _ := cmd.Flags().GetString("target-cloud")
 
+	local, _ := cmd.Flags().GetBool("local")
+	if local {
+		provider = "onprem"
+	}
+
 	var c *api.Config
 	c = api.NewConfig()
 	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
@@ -289,8 +382,38 @@ func imageListCommandHandler(cmd *cobra.Command, args []string) {
 		exitWithError(err.Error())
 	}
 
+	filters, _ := cmd.Flags().GetStringArray("filter")
+	c.RunConfig.Filters, err = api.ParseListFilters(filters)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if zones := commandZones(cmd, c); len(zones) > 0 && !local {
+		listInZones(cmd, provider, c, zones, func(ctx *api.Context, p api.Provider) ([]string, [][]string, error) {
+			images, err := p.GetImages(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			header, rows := api.ImagesTable(images)
+			return header, rows, nil
+		})
+		return
+	}
+
 	ctx := api.NewContext(c, &p)
 
+	if format := exportFormat(cmd); format != "" {
+		images, err := p.GetImages(ctx)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+
+		header, rows := api.ImagesTable(images)
+		exportListing(cmd, format, header, rows)
+		return
+	}
+
 	err = p.ListImages(ctx)
 	if err != nil {
 		exitWithError(err.Error())
@@ -298,11 +421,20 @@ func imageListCommandHandler(cmd *cobra.Command, args []string) {
 }
 
 func imageListCommand() *cobra.Command {
+	var local bool
+	var filters, zones []string
+	var export, output string
 	var cmdImageList = &cobra.Command{
-		Use:   "list",
-		Short: "list images from provider",
-		Run:   imageListCommandHandler,
-	}
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "list images from provider",
+		Run:     imageListCommandHandler,
+	}
+	cmdImageList.PersistentFlags().BoolVarP(&local, "local", "l", false, "list images built locally")
+	cmdImageList.PersistentFlags().StringArrayVarP(&filters, "filter", "", nil, "filter images by tag or status, e.g. Name=api-* or status=available")
+	cmdImageList.PersistentFlags().StringVarP(&export, "export", "", "", "export the images as csv, markdown or json instead of printing a table")
+	cmdImageList.PersistentFlags().StringVarP(&output, "output", "o", "", "file the export is written to, defaults to stdout")
+	cmdImageList.PersistentFlags().StringArrayVarP(&zones, "zones", "", nil, "zones listed concurrently in one table with a region column, e.g. us-east-1,eu-west-1")
 	return cmdImageList
 }
 
@@ -348,7 +480,7 @@ func imageDeleteCommand() *cobra.Command {
 		Run:   imageDeleteCommandHandler,
 		Args:  cobra.MinimumNArgs(1),
 	}
-	return cmdImageDelete
+	return supportsDryRun(cmdImageDelete)
 }
 
 func imageSyncCommandHandler(cmd *cobra.Command, args []string) {
@@ -396,13 +528,423 @@ func imageSyncCommand() *cobra.Command {
 	return cmdImageSync
 }
 
+func imageVerifyCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	localImage := path.Join(api.GetOpsHome(), "images", args[0])
+	if len(args) > 1 {
+		localImage = args[1]
+	}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " verify not yet implemented")
+	}
+
+	ctx := api.NewContext(c, &p)
+
+	match, err := aws.VerifyImage(ctx, args[0], localImage)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if !match {
+		exitWithError(fmt.Sprintf("image %s doesn't match %s", args[0], localImage))
+	}
+
+	fmt.Printf("image %s matches %s\n", args[0], localImage)
+}
+
+func imageVerifyCommand() *cobra.Command {
+	var cmdImageVerify = &cobra.Command{
+		Use:   "verify <image_name> [local_image_path]",
+		Short: "verify image on provider matches local image",
+		Run:   imageVerifyCommandHandler,
+		Args:  cobra.RangeArgs(1, 2),
+	}
+	return cmdImageVerify
+}
+
+func imagePruneCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	keepLast, _ := cmd.Flags().GetInt("keep-last")
+	olderThan, _ := cmd.Flags().GetInt("older-than")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	var maxSize int64
+	if size, _ := cmd.Flags().GetString("max-size"); size != "" {
+		maxSize, err = api.ParseBytes(size)
+		if err != nil {
+			exitWithError("invalid max size " + size + ": " + err.Error())
+		}
+	}
+
+	pruner, ok := p.(api.ImagePruner)
+	if !ok {
+		exitWithError("image prune is not supported on " + provider + ", only on aws and onprem")
+	}
+
+	ctx := api.NewContext(c, &p)
+
+	pruned, err := pruner.PruneImages(ctx, api.PruneOptions{
+		KeepLast:  keepLast,
+		OlderThan: time.Duration(olderThan) * 24 * time.Hour,
+		MaxSize:   maxSize,
+		DryRun:    dryRun,
+	})
+
+	action := "deleted"
+	if dryRun {
+		action = "would delete"
+	}
+	for _, image := range pruned {
+		fmt.Printf("%s %s (%s, created %s)\n", action, image.ID, image.Name, image.Created)
+	}
+
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	fmt.Printf("%d images pruned\n", len(pruned))
+
+	if provider == "onprem" {
+		usage, err := api.NewLocalImageStore().Usage()
+		if err != nil {
+			exitWithError(err.Error())
+		}
+		fmt.Printf("local images use %s\n", api.Bytes2Human(usage))
+	}
+}
+
+func imagePruneCommand() *cobra.Command {
+	var keepLast, olderThan int
+	var maxSize string
+
+	var cmdImagePrune = &cobra.Command{
+		Use:   "prune",
+		Short: "delete old images according to retention rules (aws and onprem)",
+		Run:   imagePruneCommandHandler,
+	}
+	supportsDryRunOnAnyProvider(cmdImagePrune)
+
+	cmdImagePrune.PersistentFlags().IntVarP(&keepLast, "keep-last", "k", 0, "number of newest images kept per name")
+	cmdImagePrune.PersistentFlags().IntVarP(&olderThan, "older-than", "d", 0, "only delete images older than the number of days")
+	cmdImagePrune.PersistentFlags().StringVarP(&maxSize, "max-size", "", "", "delete the oldest local images until they use at most the size, e.g. 10GB (onprem)")
+	return cmdImagePrune
+}
+
+func imageReplicateCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	interval, _ := cmd.Flags().GetDuration("interval")
+	maxCopies, _ := cmd.Flags().GetInt("max-copies")
+	maxRate, _ := cmd.Flags().GetInt64("max-rate")
+	limits := api.ReplicationLimits{MaxCopies: maxCopies, MaxGiBPerHour: maxRate}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " replicate not yet implemented")
+	}
+
+	ctx := api.NewContext(c, &p)
+
+	for {
+		result, err := aws.ReplicateImages(ctx, args[0], limits)
+		if err != nil {
+			if interval == 0 {
+				exitWithError(err.Error())
+			}
+			fmt.Printf("replication failed: %v\n", err)
+		} else {
+			fmt.Printf("%d images copied, %d replicas deleted, %d copies in progress\n", len(result.Copied), len(result.Pruned), result.Pending)
+		}
+
+		if interval == 0 {
+			return
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func imageReplicateCommand() *cobra.Command {
+	var interval time.Duration
+	var maxCopies int
+	var maxRate int64
+
+	var cmdImageReplicate = &cobra.Command{
+		Use:   "replicate <target_region>",
+		Short: "replicate images to another aws region",
+		Long:  "copy the images of the zone missing in the target region and delete the copies of images confirmed deleted. The state of the replication is kept in the ops home so an interrupted replication resumes where it stopped. Images are only replicated between aws regions",
+		Run:   imageReplicateCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cmdImageReplicate.PersistentFlags().DurationVarP(&interval, "interval", "i", 0, "keep replicating images every interval (e.g. 1h), runs once if not set")
+	cmdImageReplicate.PersistentFlags().IntVarP(&maxCopies, "max-copies", "m", 2, "maximum copies in progress at the same time, 0 for no limit")
+	cmdImageReplicate.PersistentFlags().Int64VarP(&maxRate, "max-rate", "", 0, "maximum GiB of images copied per hour, 0 for no limit")
+	return cmdImageReplicate
+}
+
+func imageAliasCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " image aliases not yet implemented")
+	}
+
+	err = aws.SetImageAlias(ctx, args[0], args[1])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func imageAliasCommand() *cobra.Command {
+	var cmdImageAlias = &cobra.Command{
+		Use:   "alias <image_name[:ref]> <alias>",
+		Short: "point an alias to an image",
+		Long:  "point an alias to the image referenced by name:ref, ref being an alias or build version, or the newest image of the name. Instances are created from an alias with --imagename name:alias. The latest alias is moved to every new image",
+		Run:   imageAliasCommandHandler,
+		Args:  cobra.ExactArgs(2),
+	}
+	return cmdImageAlias
+}
+
+func imageMarketplaceCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	if product, _ := cmd.Flags().GetString("product"); product != "" {
+		c.CloudConfig.MarketplaceProduct = product
+	}
+
+	if role, _ := cmd.Flags().GetString("access-role"); role != "" {
+		c.CloudConfig.MarketplaceRole = role
+	}
+
+	var version api.MarketplaceVersion
+	version.Title, _ = cmd.Flags().GetString("title")
+	version.ReleaseNotes, _ = cmd.Flags().GetString("release-notes")
+	version.UsageInstructions, _ = cmd.Flags().GetString("usage")
+	version.InstanceType, _ = cmd.Flags().GetString("instance-type")
+	version.OSVersion = api.LocalReleaseVersion
+
+	output, _ := cmd.Flags().GetString("output")
+
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " marketplace submissions not yet implemented")
+	}
+
+	changeSet, err := aws.PrepareMarketplaceVersion(ctx, args[0], version)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	data, err := json.MarshalIndent(changeSet, "", "  ")
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	err = ioutil.WriteFile(output, data, 0644)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	fmt.Printf("Marketplace change set saved to %s, submit it with:\n", output)
+	fmt.Printf("aws marketplace-catalog start-change-set --region us-east-1 --cli-input-json file://%s\n", output)
+}
+
+func imageMarketplaceCommand() *cobra.Command {
+	var product, role, title, releaseNotes, usage, instanceType, output string
+
+	var cmdImageMarketplace = &cobra.Command{
+		Use:   "marketplace <image_name[:ref]>",
+		Short: "prepare an image for submission to the aws marketplace",
+		Long:  "check the image can be ingested by the aws marketplace, tag it with the product and version and save the change set adding it as a new version of the marketplace product. The recommended security group opens the ports of the config",
+		Run:   imageMarketplaceCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cmdImageMarketplace.PersistentFlags().StringVarP(&product, "product", "", "", "marketplace product id, overrides marketplaceproduct of the cloud config")
+	cmdImageMarketplace.PersistentFlags().StringVarP(&role, "access-role", "", "", "iam role arn the marketplace assumes to ingest the image, overrides marketplacerole of the cloud config")
+	cmdImageMarketplace.PersistentFlags().StringVarP(&title, "title", "", "", "version title shown to buyers [required]")
+	cmdImageMarketplace.PersistentFlags().StringVarP(&releaseNotes, "release-notes", "", "", "release notes of the version")
+	cmdImageMarketplace.PersistentFlags().StringVarP(&usage, "usage", "", "", "usage instructions shown to buyers")
+	cmdImageMarketplace.PersistentFlags().StringVarP(&instanceType, "instance-type", "", "", "recommended instance type, defaults to t2.micro")
+	cmdImageMarketplace.PersistentFlags().StringVarP(&output, "output", "o", "marketplace-changeset.json", "file the change set is saved to")
+
+	cmdImageMarketplace.MarkPersistentFlagRequired("title")
+	return cmdImageMarketplace
+}
+
+func imageRegisterCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	c.CloudConfig.ImageName = args[1]
+
+	description, _ := cmd.Flags().GetString("description")
+	if description != "" {
+		c.CloudConfig.ImageDescription = description
+	}
+
+	enaSupport, _ := cmd.Flags().GetBool("ena-support")
+	if enaSupport {
+		c.CloudConfig.EnaSupport = true
+	}
+
+	force, _ := cmd.Flags().GetBool("force")
+	if force {
+		c.RunConfig.ExceedProjectCaps = true
+	}
+
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " image register not yet implemented")
+	}
+
+	_, err = aws.CreateImageFromSnapshot(ctx, args[0])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func imageRegisterCommand() *cobra.Command {
+	var description string
+	var enaSupport, force bool
+
+	var cmdImageRegister = &cobra.Command{
+		Use:   "register <snapshot_id> <image_name>",
+		Short: "create an image from an existing snapshot (aws)",
+		Long:  "register an image from a completed ebs snapshot, e.g. one built by another pipeline, without uploading a local image. The image is tagged like a deployed image and the latest alias is moved to it",
+		Run:   imageRegisterCommandHandler,
+		Args:  cobra.ExactArgs(2),
+	}
+
+	cmdImageRegister.PersistentFlags().StringVarP(&description, "description", "", "", "description of the cloud image, defaults to nanos image <image_name>")
+	cmdImageRegister.PersistentFlags().BoolVarP(&enaSupport, "ena-support", "", false, "register the image with ENA, required by gpu and most recent instance types")
+	cmdImageRegister.PersistentFlags().BoolVarP(&force, "force", "", false, "register the image beyond the maximages cap of the config project")
+	return supportsDryRun(cmdImageRegister)
+}
+
 // ImageCommands provides image related command on GCP
 func ImageCommands() *cobra.Command {
 	var config, targetCloud, zone string
 	var cmdImage = &cobra.Command{
 		Use:       "image",
 		Short:     "manage nanos images",
-		ValidArgs: []string{"create", "list", "delete", "resize", "sync"},
+		ValidArgs: []string{"create", "list", "ls", "delete", "resize", "sync", "verify", "replicate", "prune", "alias", "marketplace", "register"},
 		Args:      cobra.OnlyValidArgs,
 	}
 	cmdImage.PersistentFlags().StringVarP(&config, "config", "c", "", "ops config file")
@@ -413,5 +955,11 @@ func ImageCommands() *cobra.Command {
 	cmdImage.AddCommand(imageDeleteCommand())
 	cmdImage.AddCommand(imageResizeCommand())
 	cmdImage.AddCommand(imageSyncCommand())
+	cmdImage.AddCommand(imageVerifyCommand())
+	cmdImage.AddCommand(imageReplicateCommand())
+	cmdImage.AddCommand(imagePruneCommand())
+	cmdImage.AddCommand(imageAliasCommand())
+	cmdImage.AddCommand(imageMarketplaceCommand())
+	cmdImage.AddCommand(imageRegisterCommand())
 	return cmdImage
 }
@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	api "github.com/nanovms/ops/lepton"
 	"github.com/spf13/cobra"
@@ -12,12 +15,14 @@ import (
 
 func exitWithError(errs string) {
 	fmt.Println(fmt.Sprintf(api.ErrorColor, errs))
+	finishRun(api.ProgressFailed)
 	os.Exit(1)
 }
 
 func exitForCmd(cmd *cobra.Command, errs string) {
 	fmt.Println(fmt.Sprintf(api.ErrorColor, errs))
 	cmd.Help()
+	finishRun(api.ProgressFailed)
 	os.Exit(1)
 }
 
@@ -52,13 +57,149 @@ func instanceCreateCommandHandler(cmd *cobra.Command, args []string) {
 	imagename, _ := cmd.Flags().GetString("imagename")
 	c.CloudConfig.ImageName = imagename
 
-	portsFlag, err := cmd.Flags().GetStringArray("port")
-	if err != nil {
-		panic(err)
+	amiID, _ := cmd.Flags().GetString("ami-id")
+	if amiID != "" {
+		c.RunConfig.ImageID = amiID
 	}
-	ports, err := api.SliceAtoi(portsFlag)
-	if err != nil {
-		panic(err)
+
+	imageVersion, _ := cmd.Flags().GetString("image-version")
+	if imageVersion != "" {
+		c.RunConfig.ImageVersion = imageVersion
+	}
+
+	launchTemplate, _ := cmd.Flags().GetString("launch-template")
+	if launchTemplate != "" {
+		c.RunConfig.LaunchTemplate = launchTemplate
+	}
+
+	terminationProtection, _ := cmd.Flags().GetBool("termination-protection")
+	if terminationProtection {
+		c.RunConfig.TerminationProtection = true
+	}
+
+	shutdownBehavior, _ := cmd.Flags().GetString("shutdown-behavior")
+	if shutdownBehavior != "" {
+		c.RunConfig.ShutdownBehavior = shutdownBehavior
+	}
+
+	targetGroup, _ := cmd.Flags().GetString("target-group")
+	if targetGroup != "" {
+		c.CloudConfig.TargetGroupARN = targetGroup
+	}
+
+	loadBalancer, _ := cmd.Flags().GetString("load-balancer")
+	if loadBalancer != "" {
+		c.CloudConfig.LoadBalancer = loadBalancer
+	}
+
+	healthCheckPath, _ := cmd.Flags().GetString("health-check-path")
+	if healthCheckPath != "" {
+		c.CloudConfig.HealthCheckPath = healthCheckPath
+	}
+
+	healthCheckPort, _ := cmd.Flags().GetInt("health-check-port")
+	if healthCheckPort != 0 {
+		c.CloudConfig.HealthCheckPort = healthCheckPort
+	}
+
+	registration, _ := cmd.Flags().GetString("register-service")
+	if registration != "" {
+		if provider != "aws" {
+			exitWithError(provider + " service discovery not yet implemented")
+		}
+
+		registry, service, err := api.ParseServiceRegistration(registration)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+		c.RunConfig.ServiceDiscovery.Registry = registry
+		c.RunConfig.ServiceDiscovery.Service = service
+	}
+
+	servicePort, _ := cmd.Flags().GetInt("service-port")
+	if servicePort != 0 {
+		c.RunConfig.ServiceDiscovery.Port = servicePort
+	}
+
+	vpc, _ := cmd.Flags().GetString("vpc")
+	if vpc != "" {
+		c.RunConfig.VPC = vpc
+	}
+
+	subnet, _ := cmd.Flags().GetString("subnet")
+	if subnet != "" {
+		c.RunConfig.Subnet = subnet
+	}
+
+	serviceAccount, _ := cmd.Flags().GetString("service-account")
+	if serviceAccount != "" {
+		if provider != "gcp" {
+			exitWithError(provider + " service accounts not yet implemented")
+		}
+		c.CloudConfig.ServiceAccount = serviceAccount
+	}
+
+	scopes, _ := cmd.Flags().GetStringArray("scope")
+	if len(scopes) > 0 {
+		if provider != "gcp" {
+			exitWithError(provider + " service account scopes not yet implemented")
+		}
+		c.CloudConfig.Scopes = scopes
+	}
+
+	role, _ := cmd.Flags().GetString("role")
+	if role != "" {
+		c.RunConfig.Role = role
+	}
+
+	roleRules, _ := cmd.Flags().GetStringArray("allow-role")
+	if len(roleRules) > 0 {
+		if provider != "aws" {
+			exitWithError(provider + " role rules not yet implemented")
+		}
+		c.RunConfig.RoleRules = append(c.RunConfig.RoleRules, roleRules...)
+	}
+
+	networkTags, _ := cmd.Flags().GetStringArray("network-tag")
+	if len(networkTags) > 0 {
+		if provider != "gcp" {
+			exitWithError(provider + " network tags not yet implemented")
+		}
+		c.RunConfig.NetworkTags = append(c.RunConfig.NetworkTags, networkTags...)
+	}
+
+	vpcEndpoints, _ := cmd.Flags().GetStringArray("vpc-endpoint")
+	if len(vpcEndpoints) > 0 {
+		c.CloudConfig.VPCEndpoints = vpcEndpoints
+	}
+
+	count, _ := cmd.Flags().GetInt("count")
+	if count > 1 {
+		if provider != "aws" {
+			exitWithError(provider + " multiple instance launch not yet implemented")
+		}
+		c.RunConfig.InstanceCount = count
+	}
+
+	instanceName, _ := cmd.Flags().GetString("name")
+	if instanceName != "" {
+		tags := []api.Tag{{Key: "Name", Value: instanceName}}
+		for _, tag := range c.RunConfig.Tags {
+			if tag.Key != "Name" {
+				tags = append(tags, tag)
+			}
+		}
+		c.RunConfig.Tags = tags
+	}
+
+	ports := portFlagsToConfig(cmd, c)
+
+	allowedIPs, _ := cmd.Flags().GetStringArray("allowed-ip")
+	c.RunConfig.AllowedIPs = append(c.RunConfig.AllowedIPs, allowedIPs...)
+
+	enableIPv6, _ := cmd.Flags().GetBool("ipv6")
+	if enableIPv6 {
+		c.RunConfig.EnableIPv6 = true
 	}
 
 	udpPortsFlag, err := cmd.Flags().GetStringArray("udp")
@@ -75,30 +216,351 @@ func instanceCreateCommandHandler(cmd *cobra.Command, args []string) {
 	domainname, _ := cmd.Flags().GetString("domainname")
 	c.RunConfig.DomainName = domainname
 
+	domainAliases, _ := cmd.Flags().GetStringArray("domain-alias")
+	if len(domainAliases) > 0 {
+		c.RunConfig.DomainNames = domainAliases
+	}
+
+	dnsTTL, _ := cmd.Flags().GetInt("dns-ttl")
+	if dnsTTL != 0 {
+		c.RunConfig.DNSTTL = dnsTTL
+	}
+
+	dnsRecordType, _ := cmd.Flags().GetString("dns-record-type")
+	if dnsRecordType != "" {
+		c.RunConfig.DNSRecordType = dnsRecordType
+	}
+
+	dnsProvider, _ := cmd.Flags().GetString("dns-provider")
+	if dnsProvider != "" {
+		c.RunConfig.DNSProvider = dnsProvider
+	}
+
+	privateDNS, _ := cmd.Flags().GetBool("private-dns")
+	if privateDNS {
+		c.RunConfig.PrivateDNS = true
+	}
+
+	autoSuffix, _ := cmd.Flags().GetBool("auto-suffix")
+	if autoSuffix {
+		c.RunConfig.AutoSuffixName = true
+	}
+
+	async, _ := cmd.Flags().GetBool("async")
+	if async {
+		c.RunConfig.Async = true
+	}
+
+	availabilityZone, _ := cmd.Flags().GetString("availability-zone")
+	if availabilityZone != "" {
+		c.CloudConfig.AvailabilityZone = availabilityZone
+	}
+
+	placementGroup, _ := cmd.Flags().GetString("placement-group")
+	if placementGroup != "" {
+		c.RunConfig.PlacementGroup = placementGroup
+	}
+
+	tenancy, _ := cmd.Flags().GetString("tenancy")
+	if tenancy != "" {
+		c.RunConfig.Tenancy = tenancy
+	}
+
+	spot, _ := cmd.Flags().GetBool("spot")
+	if spot {
+		c.RunConfig.Spot = true
+	}
+
+	evictionPolicy, _ := cmd.Flags().GetString("eviction-policy")
+	if evictionPolicy != "" {
+		c.RunConfig.EvictionPolicy = evictionPolicy
+	}
+
+	maxPrice, _ := cmd.Flags().GetFloat64("max-price")
+	if maxPrice != 0 {
+		c.RunConfig.MaxPrice = maxPrice
+	}
+
+	createNetwork, _ := cmd.Flags().GetBool("create-network")
+	if createNetwork {
+		c.RunConfig.CreateNetwork = true
+	}
+
+	readyMarker, _ := cmd.Flags().GetString("ready-marker")
+	if readyMarker != "" {
+		c.RunConfig.ReadyMarker = readyMarker
+	}
+
+	readyTimeout, _ := cmd.Flags().GetInt("ready-timeout")
+	if readyTimeout != 0 {
+		c.RunConfig.ReadyTimeout = readyTimeout
+	}
+
+	wait, _ := cmd.Flags().GetBool("wait")
+	if wait {
+		if provider != "aws" && provider != "gcp" && provider != "openstack" && provider != "azure" {
+			exitWithError(provider + " wait not yet implemented")
+		}
+		c.RunConfig.Wait = true
+	}
+
+	waitTimeout, _ := cmd.Flags().GetInt("wait-timeout")
+	if waitTimeout != 0 {
+		c.RunConfig.WaitTimeout = waitTimeout
+	}
+
+	waitPort, _ := cmd.Flags().GetInt("wait-port")
+	if waitPort != 0 {
+		c.RunConfig.WaitPort = waitPort
+	}
+
+	waitReachable, _ := cmd.Flags().GetBool("wait-reachable")
+	if waitReachable {
+		c.RunConfig.WaitReachable = true
+	}
+
+	reachableTimeout, _ := cmd.Flags().GetInt("reachable-timeout")
+	if reachableTimeout != 0 {
+		c.RunConfig.ReachableTimeout = reachableTimeout
+	}
+
+	force, _ := cmd.Flags().GetBool("force")
+	if force {
+		c.RunConfig.ExceedProjectCaps = true
+	}
+
+	checkQuotas, _ := cmd.Flags().GetBool("check-quotas")
+	if checkQuotas {
+		c.RunConfig.CheckQuotas = true
+	}
+
+	userData, _ := cmd.Flags().GetString("user-data")
+	if userData != "" {
+		c.RunConfig.UserData = userData
+	}
+
+	cmdenvs, err := cmd.Flags().GetStringArray("envs")
+	if err != nil {
+		panic(err)
+	}
+
+	if len(cmdenvs) > 0 {
+		if len(c.RunConfig.InstanceEnv) == 0 {
+			c.RunConfig.InstanceEnv = make(map[string]string)
+		}
+
+		for i := 0; i < len(cmdenvs); i++ {
+			ez := strings.SplitN(cmdenvs[i], "=", 2)
+			if len(ez) != 2 {
+				exitWithError("invalid env argument " + cmdenvs[i] + ", expected KEY=VALUE")
+			}
+			c.RunConfig.InstanceEnv[ez[0]] = ez[1]
+		}
+	}
+
+	kernelArgs, _ := cmd.Flags().GetStringArray("kernel-arg")
+	c.RunConfig.KernelArgs = append(c.RunConfig.KernelArgs, kernelArgs...)
+	setKernelArgsImageName(c)
+
+	portWarnings, err := api.CheckPorts(c)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	for _, warning := range portWarnings {
+		fmt.Printf(api.WarningColor+"\n", "warning: "+warning)
+	}
+
+	warmPool, _ := cmd.Flags().GetString("warm-pool")
+	if warmPool != "" && c.RunConfig.DryRun {
+		exitWithError("warm pools don't support --dry-run")
+	}
+
+	if zones := commandZones(cmd, c); len(zones) > 0 {
+		if warmPool != "" {
+			exitWithError("warm pools can't be created in several zones")
+		}
+
+		failed := inZones(provider, c, zones, func(ctx *api.Context, p api.Provider, zone string) error {
+			return withDeployLock(ctx, c, p, provider, c.CloudConfig.ImageName, func() error {
+				return p.CreateInstance(ctx)
+			})
+		})
+		printZoneResults(zones, failed)
+		return
+	}
+
 	p, err := getCloudProvider(provider)
 	if err != nil {
 		exitWithError(err.Error())
 	}
 	ctx := api.NewContext(c, &p)
-	err = p.CreateInstance(ctx)
+
+	if warmPool != "" {
+		if _, ok := p.(*api.AWS); !ok {
+			exitWithError(provider + " warm pools not yet implemented")
+		}
+	}
+
+	// deploys of the same image are serialized when a lock table is configured
+	err = withDeployLock(ctx, c, p, provider, c.CloudConfig.ImageName, func() error {
+		if warmPool != "" {
+			_, err := p.(*api.AWS).PrewarmInstances(ctx, warmPool)
+			return err
+		}
+		return p.CreateInstance(ctx)
+	})
 	if err != nil {
 		exitWithError(err.Error())
 	}
 }
 
+// acquireDeployLock serializes the deploys of the image, in the form name or
+// name:ref, when a lock table is configured, returning nil otherwise
+func acquireDeployLock(ctx *api.Context, c *api.Config, p api.Provider, provider string, image string) (*api.DeployLock, error) {
+	if c.CloudConfig.LockTable == "" || c.RunConfig.DryRun {
+		return nil, nil
+	}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		return nil, errors.New(provider + " deploy lock not yet implemented")
+	}
+
+	name, _ := api.ParseImageRef(image)
+	return aws.AcquireDeployLock(ctx, name)
+}
+
+// withDeployLock runs fn holding the deploy lock of the image, released once
+// fn returns
+func withDeployLock(ctx *api.Context, c *api.Config, p api.Provider, provider string, image string, fn func() error) error {
+	lock, err := acquireDeployLock(ctx, c, p, provider, image)
+	if err != nil {
+		return err
+	}
+	if lock != nil {
+		defer releaseDeployLock(lock)
+	}
+
+	return fn()
+}
+
+// releaseDeployLock releases the lock, warning if it can't
+func releaseDeployLock(lock *api.DeployLock) {
+	err := lock.Release()
+	if err != nil {
+		fmt.Printf("warning: %v\n", err)
+	}
+}
+
+// portFlagsToConfig adds the port ranges of the port flag to the config and
+// returns the single ports
+func portFlagsToConfig(cmd *cobra.Command, c *api.Config) []int {
+	portsFlag, err := cmd.Flags().GetStringArray("port")
+	if err != nil {
+		panic(err)
+	}
+
+	var singlePorts []string
+	for _, port := range portsFlag {
+		if strings.Contains(port, "-") {
+			if _, _, err := api.ParsePortRange(port); err != nil {
+				exitWithError(err.Error())
+			}
+			c.RunConfig.PortRanges = append(c.RunConfig.PortRanges, port)
+		} else {
+			singlePorts = append(singlePorts, port)
+		}
+	}
+
+	ports, err := api.SliceAtoi(singlePorts)
+	if err != nil {
+		panic(err)
+	}
+
+	return ports
+}
+
 func instanceCreateCommand() *cobra.Command {
-	var imageName, config, flavor, domainname string
+	var imageName, config, flavor, domainname, userData, amiID, imageVersion, launchTemplate string
+	var envs, kernelArgs, allowedIPs, domainAliases, vpcEndpoints, networkTags, roleRules []string
+	var role, registration, serviceAccount, vpc, subnet string
+	var scopes []string
+	var servicePort int
+	var enableIPv6, terminationProtection bool
+	var count int
+	var name, warmPool, shutdownBehavior string
+	var targetGroup, loadBalancer, healthCheckPath string
+	var healthCheckPort int
+	var dnsTTL, readyTimeout, waitTimeout, waitPort, reachableTimeout int
+	var dnsRecordType, dnsProvider string
+	var availabilityZone, placementGroup, tenancy, readyMarker, evictionPolicy string
+	var privateDNS, autoSuffix, async, createNetwork, checkQuotas, wait, waitReachable, force, spot bool
+	var maxPrice float64
+	var zones []string
 
 	var cmdInstanceCreate = &cobra.Command{
 		Use:   "create",
 		Short: "create nanos instance",
 		Run:   instanceCreateCommandHandler,
 	}
+	supportsDryRun(cmdInstanceCreate)
 
 	cmdInstanceCreate.PersistentFlags().StringVarP(&config, "config", "c", "", "config for nanos")
-	cmdInstanceCreate.PersistentFlags().StringVarP(&imageName, "imagename", "i", "", "image name [required]")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&imageName, "imagename", "i", "", "image name, name:alias or name:version of an aws image [required]")
 	cmdInstanceCreate.PersistentFlags().StringVarP(&flavor, "flavor", "f", "", "flavor name for cloud provider")
 	cmdInstanceCreate.PersistentFlags().StringVarP(&domainname, "domainname", "d", "", "domain name for instance")
+	cmdInstanceCreate.PersistentFlags().StringArrayVarP(&domainAliases, "domain-alias", "", nil, "more domain names pointed to the instance, e.g. www.example.com (repeatable)")
+	cmdInstanceCreate.PersistentFlags().IntVarP(&dnsTTL, "dns-ttl", "", 0, "ttl of the domain name records in seconds, defaults to 300")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&dnsRecordType, "dns-record-type", "", "", "A, AAAA or CNAME record pointing the domain name to the instance, defaults to A (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&dnsProvider, "dns-provider", "", "", "aws, gcp or cloudflare serving the domain name, defaults to the cloud provider")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&privateDNS, "private-dns", "", false, "create the domain name in a private zone of the instance vpc (aws) or network (gcp)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&userData, "user-data", "", "", "file passed to the instance as user data")
+	cmdInstanceCreate.PersistentFlags().StringArrayVarP(&envs, "envs", "e", nil, "env arguments passed to the instance as user data")
+	cmdInstanceCreate.PersistentFlags().StringArrayVarP(&kernelArgs, "kernel-arg", "", nil, "kernel argument override, name or name=value, e.g. trace. Launches the image variant built by image create with the same overrides (repeatable)")
+	cmdInstanceCreate.PersistentFlags().StringArrayVarP(&allowedIPs, "allowed-ip", "", nil, "source CIDR allowed to reach the instance ports, defaults to 0.0.0.0/0")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&enableIPv6, "ipv6", "", false, "assign an ipv6 address to the instance (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&amiID, "ami-id", "", "", "ami launched instead of the newest image with the image name (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&imageVersion, "image-version", "", "", "build of the image launched, the timestamp suffix of its ami name (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&launchTemplate, "launch-template", "", "", "launch template applied to the instance as name:version, ops settings take precedence (aws)")
+	cmdInstanceCreate.PersistentFlags().IntVarP(&count, "count", "", 1, "number of instances launched (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&name, "name", "n", "", "instance name, {{index}} is replaced by the position of each instance, e.g. api-{{index}} (aws)")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&autoSuffix, "auto-suffix", "", false, "suffix the instance name with a number if it's taken instead of failing (aws)")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&async, "async", "", false, "return once the instances are launched without waiting for them, see deploy wait (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&availabilityZone, "availability-zone", "", "", "availability zone the instance is launched in, overrides availabilityzone of the cloud config (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&placementGroup, "placement-group", "", "", "placement group the instance is launched in, created if missing: cluster placement group (aws) or proximity placement group (azure)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&tenancy, "tenancy", "", "", "default, dedicated or host tenancy of the instance (aws)")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&spot, "spot", "", false, "launch the instance as a spot virtual machine, evicted when azure needs the capacity back (azure)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&evictionPolicy, "eviction-policy", "", "", "deallocate (default) or delete the spot instance when it is evicted (azure)")
+	cmdInstanceCreate.PersistentFlags().Float64VarP(&maxPrice, "max-price", "", 0, "maximum hourly price in US dollars of the spot instance, -1 pays up to the on-demand price (azure)")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&createNetwork, "create-network", "", false, "create a vpc managed by ops if the region has none, see instance network delete (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&readyMarker, "ready-marker", "", "", "wait for the application to print this line on the console, e.g. ops:ready (aws)")
+	cmdInstanceCreate.PersistentFlags().IntVarP(&readyTimeout, "ready-timeout", "", 0, "seconds to wait for the ready marker, defaults to 600 (aws)")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&wait, "wait", "", false, "wait for the instance to run, and respond on --wait-port if set (aws, gcp, openstack, azure)")
+	cmdInstanceCreate.PersistentFlags().IntVarP(&waitTimeout, "wait-timeout", "", 0, "seconds to wait for the instance with --wait, defaults to 300")
+	cmdInstanceCreate.PersistentFlags().IntVarP(&waitPort, "wait-port", "", 0, "tcp port the instance must accept connections on to be ready with --wait")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&waitReachable, "wait-reachable", "", false, "wait for --domainname to resolve to the instance and its first port to accept connections")
+	cmdInstanceCreate.PersistentFlags().IntVarP(&reachableTimeout, "reachable-timeout", "", 0, "seconds to wait with --wait-reachable, defaults to 300")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&checkQuotas, "check-quotas", "", false, "check vCPU and security group quotas before creating instances (aws)")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&force, "force", "", false, "create the instances beyond the maxinstances cap of the config project (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&warmPool, "warm-pool", "", "", "launch the instances stopped in a warm pool started by instance cutover (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&shutdownBehavior, "shutdown-behavior", "", "", "stop or terminate the instance when the unikernel shuts down, defaults to stop (aws)")
+	cmdInstanceCreate.PersistentFlags().BoolVarP(&terminationProtection, "termination-protection", "", false, "prevent deleting the instance until protection is disabled (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&targetGroup, "target-group", "", "", "arn of a target group the instances are registered with (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&loadBalancer, "load-balancer", "", "", "network load balancer forwarding the first port to the instances, created if missing (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&healthCheckPath, "health-check-path", "", "", "http health check path of a created load balancer, tcp checks if empty (aws)")
+	cmdInstanceCreate.PersistentFlags().IntVarP(&healthCheckPort, "health-check-port", "", 0, "health check port of a created load balancer, defaults to the traffic port (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&registration, "register-service", "", "", "register the instances with a cloud map service or consul catalog, e.g. cloudmap:api or consul:api (aws)")
+	cmdInstanceCreate.PersistentFlags().IntVarP(&servicePort, "service-port", "", 0, "port the instances are registered with, defaults to the first port (aws)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&vpc, "vpc", "", "", "vpc or network of the instance, <host_project>/<network> for a gcp shared vpc")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&subnet, "subnet", "", "", "subnet of the instance, <host_project>/<subnetwork> for a gcp shared vpc")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&serviceAccount, "service-account", "", "", "email of the service account the instance runs as (gcp)")
+	cmdInstanceCreate.PersistentFlags().StringArrayVarP(&scopes, "scope", "", nil, "oauth scope of the service account, e.g. devstorage.read_only, defaults to cloud-platform (gcp, repeatable)")
+	cmdInstanceCreate.PersistentFlags().StringVarP(&role, "role", "", "", "deployment role of the instances, matched by the role rules of instances in the same vpc and project (aws)")
+	cmdInstanceCreate.PersistentFlags().StringArrayVarP(&roleRules, "allow-role", "", nil, "role allowed to reach ports of another role in the same vpc and project, e.g. api->worker:9000 or api->dns:53/udp (aws, repeatable)")
+	cmdInstanceCreate.PersistentFlags().StringArrayVarP(&networkTags, "network-tag", "", nil, "network tag of the instance, firewall rules targeting it apply to the instance (gcp, repeatable)")
+	cmdInstanceCreate.PersistentFlags().StringArrayVarP(&vpcEndpoints, "vpc-endpoint", "", nil, "s3 or dynamodb reached through a gateway endpoint of the instance vpc instead of a nat gateway (aws, repeatable)")
+
+	cmdInstanceCreate.PersistentFlags().StringArrayVarP(&zones, "zones", "", nil, "zones the instances are created in concurrently, defaults to the zones of the config (aws, gcp)")
 
 	cmdInstanceCreate.MarkPersistentFlagRequired("imagename")
 	return cmdInstanceCreate
@@ -119,14 +581,55 @@ func instanceListCommandHandler(cmd *cobra.Command, args []string) {
 		exitForCmd(cmd, "projectid argument missing")
 	}
 
+	filters, _ := cmd.Flags().GetStringArray("filter")
+	c.RunConfig.Filters, err = api.ParseListFilters(filters)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	c.CloudConfig.ProjectID = projectID
+
+	if zones := commandZones(cmd, c); len(zones) > 0 {
+		listInZones(cmd, provider, c, zones, func(ctx *api.Context, p api.Provider) ([]string, [][]string, error) {
+			instances, err := p.GetInstances(ctx)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			header, rows := api.InstancesTable(instances)
+			return header, rows, nil
+		})
+		return
+	}
+
 	zone, _ := cmd.Flags().GetString("zone")
 	if zone == "" && (provider == "gcp" || provider == "aws") {
 		exitForCmd(cmd, "zone argument missing")
 	}
 
-	c.CloudConfig.ProjectID = projectID
 	c.CloudConfig.Zone = zone
 	ctx := api.NewContext(c, &p)
+
+	if stream, _ := cmd.Flags().GetBool("stream"); stream {
+		format := exportFormat(cmd)
+		if format == "" {
+			format = api.ExportFormatCSV
+		}
+		streamInstances(cmd, ctx, p, format)
+		return
+	}
+
+	if format := exportFormat(cmd); format != "" {
+		instances, err := p.GetInstances(ctx)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+
+		header, rows := api.InstancesTable(instances)
+		exportListing(cmd, format, header, rows)
+		return
+	}
+
 	err = p.ListInstances(ctx)
 	if err != nil {
 		exitWithError(err.Error())
@@ -134,11 +637,19 @@ func instanceListCommandHandler(cmd *cobra.Command, args []string) {
 }
 
 func instanceListCommand() *cobra.Command {
+	var filters, zones []string
+	var export, output string
+	var stream bool
 	var cmdInstanceList = &cobra.Command{
 		Use:   "list",
 		Short: "list instance on provider",
 		Run:   instanceListCommandHandler,
 	}
+	cmdInstanceList.PersistentFlags().StringArrayVarP(&filters, "filter", "", nil, "filter instances by tag or status, e.g. Name=api-* or status=running")
+	cmdInstanceList.PersistentFlags().StringVarP(&export, "export", "", "", "export the instances as csv, markdown or json instead of printing a table")
+	cmdInstanceList.PersistentFlags().StringVarP(&output, "output", "o", "", "file the export is written to, defaults to stdout")
+	cmdInstanceList.PersistentFlags().StringArrayVarP(&zones, "zones", "", nil, "zones listed concurrently in one table with a region column, e.g. us-east-1,eu-west-1")
+	cmdInstanceList.PersistentFlags().BoolVarP(&stream, "stream", "", false, "write the instances a page at a time as they are listed, unsorted, in the export format or csv")
 	return cmdInstanceList
 }
 
@@ -162,12 +673,50 @@ func instanceDeleteCommandHandler(cmd *cobra.Command, args []string) {
 		exitForCmd(cmd, "zone argument missing")
 	}
 
+	keepSG, _ := cmd.Flags().GetBool("keep-sg")
+	force, _ := cmd.Flags().GetBool("force")
+	assumeYes, _ := cmd.Flags().GetBool("assume-yes")
+
 	c.CloudConfig.ProjectID = projectID
 	c.CloudConfig.Zone = zone
+	c.RunConfig.KeepSG = keepSG
 	ctx := api.NewContext(c, &p)
-	err = p.DeleteInstance(ctx, args[0])
-	if err != nil {
-		exitWithError(err.Error())
+
+	instances := instanceTargets(cmd, ctx, p, args)
+
+	if len(instances) > 1 && !force && !assumeYes && !c.RunConfig.DryRun {
+		question := fmt.Sprintf("Delete the %d instances %s?", len(instances), strings.Join(instances, ", "))
+		if !confirm(question) {
+			return
+		}
+	}
+
+	if aws, ok := p.(*api.AWS); ok {
+		protected, err := aws.ProtectedInstances(ctx, instances)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+
+		if len(protected) > 0 && force {
+			question := fmt.Sprintf("Instances %s have termination protection, disable it and delete them?", strings.Join(protected, ", "))
+			if !c.RunConfig.DryRun && !assumeYes && !confirm(question) {
+				return
+			}
+			c.Force = true
+		}
+
+		err = aws.DeleteCheckedInstances(ctx, instances, protected)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+		return
+	}
+
+	for _, instance := range instances {
+		err = p.DeleteInstance(ctx, instance)
+		if err != nil {
+			exitWithError(err.Error())
+		}
 	}
 }
 
@@ -194,7 +743,13 @@ func instanceStartCommandHandler(cmd *cobra.Command, args []string) {
 	c.CloudConfig.ProjectID = projectID
 	c.CloudConfig.Zone = zone
 	ctx := api.NewContext(c, &p)
-	err = p.StartInstance(ctx, args[0])
+
+	instances := instanceTargets(cmd, ctx, p, args)
+
+	results := api.StartInstances(ctx, p, instances)
+	api.WriteInstanceBatchSummary(os.Stdout, results)
+
+	err = api.InstanceBatchError("start", results)
 	if err != nil {
 		exitWithError(err.Error())
 	}
@@ -223,42 +778,505 @@ func instanceStopCommandHandler(cmd *cobra.Command, args []string) {
 	c.CloudConfig.ProjectID = projectID
 	c.CloudConfig.Zone = zone
 	ctx := api.NewContext(c, &p)
-	err = p.StopInstance(ctx, args[0])
+
+	instances := instanceTargets(cmd, ctx, p, args)
+
+	results := api.StopInstances(ctx, p, instances)
+	api.WriteInstanceBatchSummary(os.Stdout, results)
+
+	err = api.InstanceBatchError("stop", results)
 	if err != nil {
 		exitWithError(err.Error())
 	}
 }
 
+// instanceTargets returns the instances passed by argument and the instances
+// selected with the filter flag
+func instanceTargets(cmd *cobra.Command, ctx *api.Context, p api.Provider, args []string) []string {
+	filterFlags, _ := cmd.Flags().GetStringArray("filter")
+	if len(args) == 0 && len(filterFlags) == 0 {
+		exitForCmd(cmd, "instance name or filter missing")
+	}
+
+	instances := append([]string{}, args...)
+	if len(filterFlags) == 0 {
+		return instances
+	}
+
+	filters, err := api.ParseListFilters(filterFlags)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	if aws, ok := p.(*api.AWS); ok {
+		ids, err := aws.FindInstanceIDs(ctx, filters)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+		instances = append(instances, ids...)
+	} else {
+		all, err := p.GetInstances(ctx)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+
+		matched, err := api.FilterInstances(all, filters)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+
+		for _, instance := range matched {
+			instances = append(instances, instance.Name)
+		}
+	}
+
+	if len(instances) == 0 {
+		exitWithError("no instances match the filter")
+	}
+
+	return instances
+}
+
 func instanceDeleteCommand() *cobra.Command {
+	var keepSG, force, assumeYes bool
+	var filters []string
 	var cmdInstanceDelete = &cobra.Command{
-		Use:   "delete <instance_name>",
-		Short: "delete instance on provider",
+		Use:   "delete [instance_name...]",
+		Short: "delete instances on provider",
 		Run:   instanceDeleteCommandHandler,
-		Args:  cobra.MinimumNArgs(1),
 	}
+	supportsDryRun(cmdInstanceDelete)
+	cmdInstanceDelete.PersistentFlags().BoolVarP(&keepSG, "keep-sg", "", false, "keep the security group created for the instance")
+	cmdInstanceDelete.PersistentFlags().BoolVarP(&force, "force", "", false, "delete several instances without confirmation and disable termination protection of the instances after confirmation (aws)")
+	cmdInstanceDelete.PersistentFlags().BoolVarP(&assumeYes, "assume-yes", "y", false, "answer yes to the confirmations, deleting several instances or protected ones")
+	cmdInstanceDelete.PersistentFlags().StringArrayVarP(&filters, "filter", "", nil, "select instances by tag, e.g. Name=api-*")
 	return cmdInstanceDelete
 }
 
 func instanceStopCommand() *cobra.Command {
+	var filters []string
 	var cmdInstanceStop = &cobra.Command{
-		Use:   "stop <instance_name>",
-		Short: "stop instance on provider",
+		Use:   "stop [instance_name...]",
+		Short: "stop instances on provider",
 		Run:   instanceStopCommandHandler,
-		Args:  cobra.MinimumNArgs(1),
 	}
+	supportsDryRun(cmdInstanceStop)
+	cmdInstanceStop.PersistentFlags().StringArrayVarP(&filters, "filter", "", nil, "select instances by tag, e.g. Name=api-*")
 	return cmdInstanceStop
 }
 
 func instanceStartCommand() *cobra.Command {
+	var filters []string
 	var cmdInstanceStart = &cobra.Command{
-		Use:   "start <instance_name>",
-		Short: "start instance on provider",
+		Use:   "start [instance_name...]",
+		Short: "start instances on provider",
 		Run:   instanceStartCommandHandler,
-		Args:  cobra.MinimumNArgs(1),
 	}
+	supportsDryRun(cmdInstanceStart)
+	cmdInstanceStart.PersistentFlags().StringArrayVarP(&filters, "filter", "", nil, "select instances by tag, e.g. Name=api-*")
 	return cmdInstanceStart
 }
 
+func instanceRebootCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	projectID, _ := cmd.Flags().GetString("projectid")
+
+	if projectID == "" && provider == "gcp" {
+		exitForCmd(cmd, "projectid argument missing")
+	}
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" && (provider == "gcp" || provider == "aws") {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	c.CloudConfig.ProjectID = projectID
+	c.CloudConfig.Zone = zone
+	ctx := api.NewContext(c, &p)
+
+	for _, instance := range args {
+		err = p.RebootInstance(ctx, instance)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+	}
+}
+
+func instanceRebootCommand() *cobra.Command {
+	var cmdInstanceReboot = &cobra.Command{
+		Use:   "reboot <instance_name>",
+		Short: "reboot instance on provider",
+		Run:   instanceRebootCommandHandler,
+		Args:  cobra.MinimumNArgs(1),
+	}
+	return supportsDryRun(cmdInstanceReboot)
+}
+
+func instanceCloneCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	name, _ := cmd.Flags().GetString("name")
+	flavor, _ := cmd.Flags().GetString("flavor")
+
+	c.CloudConfig.Zone = zone
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " clone not yet implemented")
+	}
+
+	_, err = aws.CloneInstance(ctx, args[0], name, flavor)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceCloneCommand() *cobra.Command {
+	var name, flavor string
+	var cmdInstanceClone = &cobra.Command{
+		Use:   "clone <instance_name>",
+		Short: "launch a twin of an instance",
+		Long:  "launch an instance with the same image, flavor, security groups, subnet, tags and user data as an existing instance",
+		Run:   instanceCloneCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+	cmdInstanceClone.PersistentFlags().StringVarP(&name, "name", "n", "", "name of the clone, defaults to the instance name with a -clone suffix, numbered if taken with AutoSuffixName")
+	cmdInstanceClone.PersistentFlags().StringVarP(&flavor, "flavor", "f", "", "flavor of the clone, defaults to the instance flavor")
+	return cmdInstanceClone
+}
+
+func instanceRenameCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	c.CloudConfig.Zone = zone
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " rename not yet implemented")
+	}
+
+	err = aws.RenameInstance(ctx, args[0], args[1])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceRenameCommand() *cobra.Command {
+	var cmdInstanceRename = &cobra.Command{
+		Use:   "rename <instance_name> <new_name>",
+		Short: "rename an instance",
+		Long:  "rename an instance, a domain name pointed to it whose first label is the instance name is moved to the new name",
+		Run:   instanceRenameCommandHandler,
+		Args:  cobra.ExactArgs(2),
+	}
+	return cmdInstanceRename
+}
+
+func instanceCutoverCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	retireFlags, _ := cmd.Flags().GetStringArray("retire")
+	retire, err := api.ParseListFilters(retireFlags)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	domainname, _ := cmd.Flags().GetString("domainname")
+	domainAliases, _ := cmd.Flags().GetStringArray("domain-alias")
+
+	c.CloudConfig.Zone = zone
+	c.RunConfig.DomainName = domainname
+	c.RunConfig.DomainNames = domainAliases
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " warm pools not yet implemented")
+	}
+
+	_, err = aws.CutoverWarmPool(ctx, args[0], retire)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceCutoverCommand() *cobra.Command {
+	var domainname string
+	var retire, domainAliases []string
+	var cmdInstanceCutover = &cobra.Command{
+		Use:   "cutover <warm_pool>",
+		Short: "start a warm pool of instances and cut over to it",
+		Long:  "start the stopped instances of a warm pool launched with instance create --warm-pool, point the domain name to them and delete the fleet they replace",
+		Run:   instanceCutoverCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+	cmdInstanceCutover.PersistentFlags().StringVarP(&domainname, "domainname", "d", "", "domain name pointed to the started instances")
+	cmdInstanceCutover.PersistentFlags().StringArrayVarP(&domainAliases, "domain-alias", "", nil, "more domain names pointed to the started instances (repeatable)")
+	cmdInstanceCutover.PersistentFlags().StringArrayVarP(&retire, "retire", "", nil, "delete the instances matching the filter after cutover, e.g. Name=blue-*")
+	return cmdInstanceCutover
+}
+
+func instanceCheckCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	projectID, _ := cmd.Flags().GetString("projectid")
+	if projectID == "" && provider == "gcp" {
+		exitForCmd(cmd, "projectid argument missing")
+	}
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" && (provider == "gcp" || provider == "aws") {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		exitForCmd(cmd, "name argument missing")
+	}
+
+	count, _ := cmd.Flags().GetInt("count")
+
+	c.CloudConfig.ProjectID = projectID
+	c.CloudConfig.Zone = zone
+	ctx := api.NewContext(c, &p)
+
+	result, err := api.CheckInstances(ctx, p, api.InstanceSpec{Name: name, Count: count})
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	fmt.Println(result)
+	os.Exit(result.ExitCode())
+}
+
+func instanceCheckCommand() *cobra.Command {
+	var name string
+	var count int
+	var cmdInstanceCheck = &cobra.Command{
+		Use:   "check",
+		Short: "check the running instances match the expected count",
+		Long:  "check the instances with a name match the expected count and are running. Exits with 0 if they match, 2 if the count of running instances differs and 3 if some instances are not running",
+		Run:   instanceCheckCommandHandler,
+	}
+	cmdInstanceCheck.PersistentFlags().StringVarP(&name, "name", "n", "", "instance name, may contain wildcards like api-*")
+	cmdInstanceCheck.PersistentFlags().IntVarP(&count, "count", "", 1, "expected running instances")
+	return cmdInstanceCheck
+}
+
+func instanceAdoptCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	name, _ := cmd.Flags().GetString("name")
+
+	c.CloudConfig.Zone = zone
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " adopt not yet implemented")
+	}
+
+	err = aws.AdoptInstance(ctx, args[0], name)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceAdoptCommand() *cobra.Command {
+	var name string
+	var cmdInstanceAdopt = &cobra.Command{
+		Use:   "adopt <instance_id>",
+		Short: "manage an instance created outside of ops",
+		Run:   instanceAdoptCommandHandler,
+		Args:  cobra.MinimumNArgs(1),
+	}
+	cmdInstanceAdopt.PersistentFlags().StringVarP(&name, "name", "n", "", "name to assign to the instance")
+	return cmdInstanceAdopt
+}
+
+func instanceAuditCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	c.CloudConfig.Zone = zone
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " audit not yet implemented")
+	}
+
+	err = aws.PrintAuditInstances(ctx)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceAuditCommand() *cobra.Command {
+	var cmdInstanceAudit = &cobra.Command{
+		Use:   "audit",
+		Short: "report security exposure of instances",
+		Run:   instanceAuditCommandHandler,
+	}
+	return cmdInstanceAudit
+}
+
+func instanceVerifyCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	c := api.NewConfig()
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	var files [2][]byte
+	for i, flag := range []string{"document", "signature"} {
+		filename, _ := cmd.Flags().GetString(flag)
+		if filename == "" {
+			exitForCmd(cmd, flag+" argument missing")
+		}
+
+		files[i], err = ioutil.ReadFile(filename)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+	}
+
+	c.CloudConfig.Zone = zone
+	ctx := api.NewContext(c, &p)
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " identity verification not yet implemented")
+	}
+
+	attestation, err := aws.VerifyInstanceIdentity(ctx, args[0], files[0], files[1])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	fmt.Printf("Verified instance %s (%s) runs image %s in account %s\n", attestation.Name,
+		attestation.Document.InstanceID, attestation.Document.ImageID, attestation.Document.AccountID)
+}
+
+func instanceVerifyCommand() *cobra.Command {
+	var document, signature string
+	var cmdInstanceVerify = &cobra.Command{
+		Use:   "verify <instance_name>",
+		Short: "verify the identity document reported by an instance",
+		Long:  "verify the identity document reported by an instance with the AWS public certificate pinned for its region, see instance trust-certificate",
+		Run:   instanceVerifyCommandHandler,
+		Args:  cobra.MinimumNArgs(1),
+	}
+	cmdInstanceVerify.PersistentFlags().StringVarP(&document, "document", "d", "", "instance identity document file")
+	cmdInstanceVerify.PersistentFlags().StringVarP(&signature, "signature", "s", "", "base64 signature file of the identity document")
+	return cmdInstanceVerify
+}
+
+func instanceTrustCertificateCommandHandler(cmd *cobra.Command, args []string) {
+	certificate, err := ioutil.ReadFile(args[1])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	force, _ := cmd.Flags().GetBool("force")
+
+	err = api.PinIdentityCertificate(args[0], certificate, force)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	fmt.Printf("Pinned the identity document certificate of %s\n", args[0])
+}
+
+func instanceTrustCertificateCommand() *cobra.Command {
+	var force bool
+	var cmdInstanceTrustCertificate = &cobra.Command{
+		Use:   "trust-certificate <region> <certificate_file>",
+		Short: "pin the AWS public certificate identity documents of a region are verified with",
+		Long:  "pin the pem encoded AWS public certificate of a region, as published in the EC2 documentation, that instance verify checks the identity documents of the region with",
+		Run:   instanceTrustCertificateCommandHandler,
+		Args:  cobra.ExactArgs(2),
+	}
+	cmdInstanceTrustCertificate.PersistentFlags().BoolVarP(&force, "force", "", false, "replace a different certificate pinned for the region")
+	return cmdInstanceTrustCertificate
+}
+
 func instanceLogsCommandHandler(cmd *cobra.Command, args []string) {
 	provider, _ := cmd.Flags().GetString("target-cloud")
 
@@ -266,7 +1284,12 @@ func instanceLogsCommandHandler(cmd *cobra.Command, args []string) {
 	if err != nil {
 		exitWithError(err.Error())
 	}
+
+	config, _ := cmd.Flags().GetString("config")
 	c := api.NewConfig()
+	if config != "" {
+		c = unWarpConfig(config)
+	}
 	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
 
 	projectID, _ := cmd.Flags().GetString("projectid")
@@ -286,15 +1309,59 @@ func instanceLogsCommandHandler(cmd *cobra.Command, args []string) {
 
 	c.CloudConfig.ProjectID = projectID
 	c.CloudConfig.Zone = zone
+
+	bucket, _ := cmd.Flags().GetString("bucket")
+	if bucket != "" {
+		c.CloudConfig.BucketName = bucket
+	}
+
 	ctx := api.NewContext(c, &p)
+
+	archive, _ := cmd.Flags().GetBool("archive")
+	if archive {
+		archiveInstanceLogs(cmd, ctx, p, provider, args[0])
+		return
+	}
+
 	err = p.PrintInstanceLogs(ctx, args[0], watch)
 	if err != nil {
 		exitWithError(err.Error())
 	}
 }
 
+// archiveInstanceLogs uploads the new console output of the instance to the
+// bucket of the config, every interval if one is set
+func archiveInstanceLogs(cmd *cobra.Command, ctx *api.Context, p api.Provider, provider string, instance string) {
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " instance logs archive not yet implemented")
+	}
+
+	interval, _ := cmd.Flags().GetDuration("interval")
+
+	var previous string
+	for {
+		current, err := aws.ArchiveConsole(ctx, instance, previous)
+		if err != nil {
+			if interval == 0 {
+				exitWithError(err.Error())
+			}
+			fmt.Printf("archive failed: %v\n", err)
+		}
+		previous = current
+
+		if interval == 0 {
+			return
+		}
+
+		time.Sleep(interval)
+	}
+}
+
 func instanceLogsCommand() *cobra.Command {
-	var watch bool
+	var watch, archive bool
+	var config, bucket string
+	var interval time.Duration
 	var cmdLogsCommand = &cobra.Command{
 		Use:   "logs <instance_name>",
 		Short: "Show logs from console for an instance",
@@ -302,6 +1369,10 @@ func instanceLogsCommand() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 	}
 	cmdLogsCommand.PersistentFlags().BoolVarP(&watch, "watch", "w", false, "watch logs")
+	cmdLogsCommand.PersistentFlags().StringVarP(&config, "config", "c", "", "ops config file")
+	cmdLogsCommand.PersistentFlags().BoolVarP(&archive, "archive", "", false, "upload the new console output to the bucket as gzip chunks instead of printing it (aws)")
+	cmdLogsCommand.PersistentFlags().StringVarP(&bucket, "bucket", "", "", "bucket of the archived console output, overrides bucketname of the cloud config")
+	cmdLogsCommand.PersistentFlags().DurationVarP(&interval, "interval", "i", 0, "keep archiving the console output every interval (e.g. 5m), runs once if not set")
 	return cmdLogsCommand
 }
 
@@ -314,11 +1385,11 @@ func InstanceCommands() *cobra.Command {
 	var cmdInstance = &cobra.Command{
 		Use:       "instance",
 		Short:     "manage nanos instances",
-		ValidArgs: []string{"create", "list", "delete", "stop", "start", "logs"},
+		ValidArgs: []string{"create", "list", "delete", "stop", "start", "reboot", "logs", "adopt", "audit", "check", "verify", "clone", "cutover", "group", "rename", "network", "events", "migrate", "diff", "volume-usage"},
 		Args:      cobra.OnlyValidArgs,
 	}
 
-	cmdInstance.PersistentFlags().StringArrayVarP(&ports, "port", "p", nil, "port to open")
+	cmdInstance.PersistentFlags().StringArrayVarP(&ports, "port", "p", nil, "port or port range (8000-8100) to open")
 	cmdInstance.PersistentFlags().StringArrayVarP(&udpPorts, "udp", "", nil, "udp ports to forward")
 	cmdInstance.PersistentFlags().StringVarP(&targetCloud, "target-cloud", "t", "onprem", "cloud platform [gcp, aws, onprem, vultr, vsphere, azure]")
 	cmdInstance.PersistentFlags().StringVarP(&projectID, "projectid", "g", os.Getenv("GOOGLE_CLOUD_PROJECT"), "project-id for GCP or set env GOOGLE_CLOUD_PROJECT")
@@ -328,7 +1399,22 @@ func InstanceCommands() *cobra.Command {
 	cmdInstance.AddCommand(instanceDeleteCommand())
 	cmdInstance.AddCommand(instanceStopCommand())
 	cmdInstance.AddCommand(instanceStartCommand())
+	cmdInstance.AddCommand(instanceRebootCommand())
 	cmdInstance.AddCommand(instanceLogsCommand())
+	cmdInstance.AddCommand(instanceAdoptCommand())
+	cmdInstance.AddCommand(instanceAuditCommand())
+	cmdInstance.AddCommand(instanceCheckCommand())
+	cmdInstance.AddCommand(instanceVerifyCommand())
+	cmdInstance.AddCommand(instanceTrustCertificateCommand())
+	cmdInstance.AddCommand(instanceCloneCommand())
+	cmdInstance.AddCommand(instanceCutoverCommand())
+	cmdInstance.AddCommand(instanceGroupCommand())
+	cmdInstance.AddCommand(instanceRenameCommand())
+	cmdInstance.AddCommand(instanceNetworkCommand())
+	cmdInstance.AddCommand(instanceEventsCommand())
+	cmdInstance.AddCommand(instanceMigrateCommand())
+	cmdInstance.AddCommand(instanceDiffCommand())
+	cmdInstance.AddCommand(instanceVolumeUsageCommand())
 
 	return cmdInstance
 }
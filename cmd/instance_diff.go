@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"strings"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+func instanceDiffCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	flavor, _ := cmd.Flags().GetString("flavor")
+	if flavor != "" {
+		c.CloudConfig.Flavor = flavor
+	}
+
+	imagename, _ := cmd.Flags().GetString("imagename")
+	if imagename != "" {
+		c.CloudConfig.ImageName = imagename
+	}
+
+	initDefaultRunConfigs(c, nil)
+
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	differ, ok := p.(api.InstanceConfigDiffer)
+	if !ok {
+		exitWithError(provider + " config drift detection not yet implemented")
+	}
+
+	ctx := api.NewContext(c, &p)
+
+	err = differ.PrintInstanceConfigDiff(ctx, args[0])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceDiffCommand() *cobra.Command {
+	var config, flavor, imagename string
+
+	var cmdInstanceDiff = &cobra.Command{
+		Use:   "diff <instance_name>",
+		Short: "compare the config an instance was created with to the local config (aws and gcp)",
+		Long: "list the settings of the local config, like the flavor, ports or environment, that changed since the instance " +
+			"was created, so a redeploy holds no surprise. Environment values and user data are compared by " +
+			"checksum, keyed by the project key in the keys directory of the ops home, copy it to compare from another machine",
+		Run:  instanceDiffCommandHandler,
+		Args: cobra.ExactArgs(1),
+	}
+
+	cmdInstanceDiff.PersistentFlags().StringVarP(&config, "config", "c", "", "ops config file")
+	cmdInstanceDiff.PersistentFlags().StringVarP(&flavor, "flavor", "f", "", "instance type the instance would be created with")
+	cmdInstanceDiff.PersistentFlags().StringVarP(&imagename, "imagename", "i", "", "image the instance would be created from")
+	return cmdInstanceDiff
+}
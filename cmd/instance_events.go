@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"strings"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+// instanceEventsContext returns the aws provider and context of the instance
+// events commands
+func instanceEventsContext(cmd *cobra.Command) (*api.AWS, *api.Context) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " scheduled events not yet implemented")
+	}
+
+	return aws, api.NewContext(c, &p)
+}
+
+func instanceEventsCommandHandler(cmd *cobra.Command, args []string) {
+	aws, ctx := instanceEventsContext(cmd)
+
+	err := aws.ListInstanceEvents(ctx)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceEventsCommand() *cobra.Command {
+	var config string
+
+	var cmdInstanceEvents = &cobra.Command{
+		Use:   "events",
+		Short: "list the maintenance and retirement events scheduled on instances (aws)",
+		Run:   instanceEventsCommandHandler,
+	}
+
+	cmdInstanceEvents.PersistentFlags().StringVarP(&config, "config", "c", "", "ops config file")
+	return cmdInstanceEvents
+}
+
+func instanceMigrateCommandHandler(cmd *cobra.Command, args []string) {
+	aws, ctx := instanceEventsContext(cmd)
+
+	if len(args) == 0 {
+		err := aws.MigrateScheduledInstances(ctx)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+		return
+	}
+
+	for _, instance := range args {
+		err := aws.MigrateInstance(ctx, instance)
+		if err != nil {
+			exitWithError(err.Error())
+		}
+	}
+}
+
+func instanceMigrateCommand() *cobra.Command {
+	var config string
+
+	var cmdInstanceMigrate = &cobra.Command{
+		Use:   "migrate [instance_name...]",
+		Short: "move instances off hardware scheduled for maintenance or retirement (aws)",
+		Long: "stop and start the instances so they run on new hardware ahead of their scheduled events, or reboot them " +
+			"if they are only scheduled for a reboot. Migrates every instance with scheduled events if none is given. " +
+			"A domain name pointed to an instance is updated with its new address",
+		Run: instanceMigrateCommandHandler,
+	}
+
+	cmdInstanceMigrate.PersistentFlags().StringVarP(&config, "config", "c", "", "ops config file")
+	return supportsDryRun(cmdInstanceMigrate)
+}
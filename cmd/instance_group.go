@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"strings"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+// instanceGroupContext returns the provider and context of the instance
+// group commands
+func instanceGroupContext(cmd *cobra.Command) (api.InstanceGroupService, *api.Context) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	if projectID, _ := cmd.Flags().GetString("projectid"); projectID != "" {
+		c.CloudConfig.ProjectID = projectID
+	}
+
+	if provider == "gcp" && c.CloudConfig.ProjectID == "" {
+		exitForCmd(cmd, "projectid argument missing")
+	}
+
+	if imagename, _ := cmd.Flags().GetString("imagename"); imagename != "" {
+		c.CloudConfig.ImageName = imagename
+	}
+
+	if flavor, _ := cmd.Flags().GetString("flavor"); flavor != "" {
+		c.CloudConfig.Flavor = flavor
+	}
+
+	initDefaultRunConfigs(c, portFlagsToConfig(cmd, c))
+
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	groups, ok := p.(api.InstanceGroupService)
+	if !ok {
+		exitWithError(provider + " instance groups not yet implemented")
+	}
+
+	return groups, api.NewContext(c, &p)
+}
+
+// instanceGroupFromFlags returns the group named name with the settings of
+// the command flags
+func instanceGroupFromFlags(cmd *cobra.Command, name string) api.InstanceGroup {
+	group := api.InstanceGroup{Name: name}
+	group.MinSize, _ = cmd.Flags().GetInt64("min")
+	group.MaxSize, _ = cmd.Flags().GetInt64("max")
+	group.DesiredCapacity, _ = cmd.Flags().GetInt64("desired")
+	group.HealthCheckGracePeriod, _ = cmd.Flags().GetInt64("grace-period")
+	group.TargetCPU, _ = cmd.Flags().GetFloat64("target-cpu")
+	return group
+}
+
+func instanceGroupCreateCommandHandler(cmd *cobra.Command, args []string) {
+	groups, ctx := instanceGroupContext(cmd)
+
+	err := groups.CreateInstanceGroup(ctx, instanceGroupFromFlags(cmd, args[0]))
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceGroupCreateCommand() *cobra.Command {
+	var config, imageName, flavor string
+	var min, max, desired, gracePeriod int64
+	var targetCPU float64
+
+	var cmdGroupCreate = &cobra.Command{
+		Use:   "create <group_name>",
+		Short: "create an auto scaling group (aws) or managed instance group (gcp) of instances",
+		Run:   instanceGroupCreateCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cmdGroupCreate.PersistentFlags().StringVarP(&config, "config", "c", "", "config for nanos")
+	cmdGroupCreate.PersistentFlags().StringVarP(&imageName, "imagename", "i", "", "image name, name:alias or name:version [required]")
+	cmdGroupCreate.PersistentFlags().StringVarP(&flavor, "flavor", "f", "", "flavor of the instances")
+	cmdGroupCreate.PersistentFlags().Int64VarP(&min, "min", "", 1, "minimum number of instances")
+	cmdGroupCreate.PersistentFlags().Int64VarP(&max, "max", "", 1, "maximum number of instances")
+	cmdGroupCreate.PersistentFlags().Int64VarP(&desired, "desired", "", -1, "instances launched initially, defaults to min")
+	cmdGroupCreate.PersistentFlags().Int64VarP(&gracePeriod, "grace-period", "", 0, "seconds before health checks of new instances count")
+	cmdGroupCreate.PersistentFlags().Float64VarP(&targetCPU, "target-cpu", "", 0, "average cpu utilization percent kept by scaling, 0 disables scaling")
+
+	cmdGroupCreate.MarkPersistentFlagRequired("imagename")
+	return cmdGroupCreate
+}
+
+func instanceGroupUpdateCommandHandler(cmd *cobra.Command, args []string) {
+	groups, ctx := instanceGroupContext(cmd)
+
+	refresh, _ := cmd.Flags().GetBool("refresh")
+
+	err := groups.UpdateInstanceGroup(ctx, instanceGroupFromFlags(cmd, args[0]), refresh)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceGroupUpdateCommand() *cobra.Command {
+	var config, imageName string
+	var min, max, desired, gracePeriod int64
+	var targetCPU float64
+	var refresh bool
+
+	var cmdGroupUpdate = &cobra.Command{
+		Use:   "update <group_name>",
+		Short: "update the image, size or scaling of an instance group",
+		Run:   instanceGroupUpdateCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cmdGroupUpdate.PersistentFlags().StringVarP(&config, "config", "c", "", "config for nanos")
+	cmdGroupUpdate.PersistentFlags().StringVarP(&imageName, "imagename", "i", "", "image launched by new instances, name:alias or name:version")
+	cmdGroupUpdate.PersistentFlags().Int64VarP(&min, "min", "", -1, "minimum number of instances")
+	cmdGroupUpdate.PersistentFlags().Int64VarP(&max, "max", "", -1, "maximum number of instances")
+	cmdGroupUpdate.PersistentFlags().Int64VarP(&desired, "desired", "", -1, "number of instances running")
+	cmdGroupUpdate.PersistentFlags().Int64VarP(&gracePeriod, "grace-period", "", -1, "seconds before health checks of new instances count")
+	cmdGroupUpdate.PersistentFlags().Float64VarP(&targetCPU, "target-cpu", "", -1, "average cpu utilization percent kept by scaling, 0 disables scaling")
+	cmdGroupUpdate.PersistentFlags().BoolVarP(&refresh, "refresh", "", false, "replace the running instances with instances of the new image in a rolling update")
+	return cmdGroupUpdate
+}
+
+func instanceGroupDeleteCommandHandler(cmd *cobra.Command, args []string) {
+	groups, ctx := instanceGroupContext(cmd)
+
+	err := groups.DeleteInstanceGroup(ctx, args[0])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceGroupDeleteCommand() *cobra.Command {
+	var cmdGroupDelete = &cobra.Command{
+		Use:   "delete <group_name>",
+		Short: "delete an instance group and its instances",
+		Run:   instanceGroupDeleteCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+	return cmdGroupDelete
+}
+
+func instanceGroupCommand() *cobra.Command {
+	var cmdGroup = &cobra.Command{
+		Use:       "group",
+		Short:     "manage auto scaling groups of instances (aws, gcp)",
+		ValidArgs: []string{"create", "update", "delete"},
+		Args:      cobra.OnlyValidArgs,
+	}
+
+	cmdGroup.AddCommand(instanceGroupCreateCommand())
+	cmdGroup.AddCommand(instanceGroupUpdateCommand())
+	cmdGroup.AddCommand(instanceGroupDeleteCommand())
+	return cmdGroup
+}
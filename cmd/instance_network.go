@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"strings"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+// instanceNetworkContext returns the aws provider and context of the
+// instance network commands
+func instanceNetworkContext(cmd *cobra.Command) (*api.AWS, *api.Context) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " instance networks not yet implemented")
+	}
+
+	return aws, api.NewContext(c, &p)
+}
+
+func instanceNetworkCreateCommandHandler(cmd *cobra.Command, args []string) {
+	aws, ctx := instanceNetworkContext(cmd)
+
+	_, err := aws.CreateNetwork(ctx)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceNetworkDeleteCommandHandler(cmd *cobra.Command, args []string) {
+	aws, ctx := instanceNetworkContext(cmd)
+
+	err := aws.DeleteNetwork(ctx)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceNetworkCommand() *cobra.Command {
+	var config string
+
+	var cmdNetworkCreate = &cobra.Command{
+		Use:   "create",
+		Short: "create a vpc, public subnet, internet gateway and route table managed by ops",
+		Run:   instanceNetworkCreateCommandHandler,
+	}
+
+	var cmdNetworkDelete = &cobra.Command{
+		Use:   "delete",
+		Short: "delete the network managed by ops once its instances are deleted",
+		Run:   instanceNetworkDeleteCommandHandler,
+	}
+
+	var cmdNetwork = &cobra.Command{
+		Use:       "network",
+		Short:     "manage the network of regions without a vpc (aws)",
+		ValidArgs: []string{"create", "delete"},
+		Args:      cobra.OnlyValidArgs,
+	}
+
+	cmdNetwork.PersistentFlags().StringVarP(&config, "config", "c", "", "ops config file")
+	cmdNetwork.AddCommand(cmdNetworkCreate)
+	cmdNetwork.AddCommand(cmdNetworkDelete)
+	return cmdNetwork
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"strings"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+func instanceVolumeUsageCommandHandler(cmd *cobra.Command, args []string) {
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	config, _ := cmd.Flags().GetString("config")
+	config = strings.TrimSpace(config)
+
+	var c *api.Config
+	if config != "" {
+		c = unWarpConfig(config)
+	} else {
+		c = api.NewConfig()
+	}
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), c)
+
+	zone, _ := cmd.Flags().GetString("zone")
+	if zone != "" {
+		c.CloudConfig.Zone = zone
+	}
+
+	if c.CloudConfig.Zone == "" {
+		exitForCmd(cmd, "zone argument missing")
+	}
+
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " volume usage not yet implemented")
+	}
+
+	threshold, _ := cmd.Flags().GetFloat64("threshold")
+
+	ctx := api.NewContext(c, &p)
+	err = aws.PrintVolumeUsage(ctx, args[0], threshold)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+}
+
+func instanceVolumeUsageCommand() *cobra.Command {
+	var config string
+	var threshold float64
+
+	var cmdInstanceVolumeUsage = &cobra.Command{
+		Use:   "volume-usage <instance_name>",
+		Short: "show the filesystem usage of the root and data volumes of a running instance (aws)",
+		Long: "show the used and total space of the volumes mounted by the instance, as reported to cloudwatch by the " +
+			"cloudwatch klib of its image. With --threshold, exits with an error if a volume is more used, " +
+			"to catch disks filling up from a cron job or a monitoring check",
+		Run:  instanceVolumeUsageCommandHandler,
+		Args: cobra.ExactArgs(1),
+	}
+
+	cmdInstanceVolumeUsage.PersistentFlags().StringVarP(&config, "config", "c", "", "ops config file")
+	cmdInstanceVolumeUsage.PersistentFlags().Float64VarP(&threshold, "threshold", "", 0, "fail if a volume is more used than this percent")
+	return cmdInstanceVolumeUsage
+}
@@ -81,6 +81,7 @@ func mergeConfigs(pkgConfig *api.Config, usrConfig *api.Config) *api.Config {
 	}
 
 	pkgConfig.BaseVolumeSz = usrConfig.BaseVolumeSz
+	pkgConfig.TempDir = usrConfig.TempDir
 	pkgConfig.RunConfig = usrConfig.RunConfig
 	pkgConfig.CloudConfig = usrConfig.CloudConfig
 	pkgConfig.Kernel = usrConfig.Kernel
@@ -133,7 +134,7 @@ func loadCommandHandler(cmd *cobra.Command, args []string) {
 		panic(err)
 	}
 
-	pkgConfig := unWarpConfig(manifest)
+	pkgConfig := unWarpPackageConfig(manifest)
 
 	debugflags, err := strconv.ParseBool(cmd.Flag("debug").Value.String())
 	if err != nil {
@@ -12,6 +12,16 @@ func GetRootCommand() *cobra.Command {
 	rootCmd.PersistentFlags().Bool("show-warnings", false, "display warning messages")
 	rootCmd.PersistentFlags().Bool("show-errors", false, "display error messages")
 	rootCmd.PersistentFlags().Bool("show-debug", false, "display debug messages")
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "display info messages")
+	rootCmd.PersistentFlags().Bool("quiet", false, "only display errors and results")
+	rootCmd.PersistentFlags().String("log-format", "text", "format of the messages, text or json (written to stderr)")
+	rootCmd.PersistentFlags().String("time-format", "", "timestamps of the listings in utc (default), local or relative time, e.g. 3 days ago")
+	rootCmd.PersistentFlags().String("deploy-id", "", "correlation id tagged on the created resources, generated if empty")
+	rootCmd.PersistentFlags().Bool("dry-run", false, "show the resources image and instance commands would create, change or delete without touching them (aws)")
+	rootCmd.PersistentFlags().String("summary-file", "", "write the summary of the resources created and deleted, phase durations, bytes uploaded and cost change in json to the file")
+	rootCmd.PersistentFlags().Bool("strict-config", false, "fail on config keys matching no config field, e.g. typos, and warn about deprecated fields instead of ignoring them")
+	rootCmd.PersistentPreRun = preRun
+	rootCmd.PersistentPostRun = postRun
 
 	rootCmd.AddCommand(RunCommand())
 	rootCmd.AddCommand(NetCommands())
@@ -25,6 +35,9 @@ func GetRootCommand() *cobra.Command {
 	rootCmd.AddCommand(InstanceCommands())
 	rootCmd.AddCommand(ImageCommands())
 	rootCmd.AddCommand(VolumeCommands())
+	rootCmd.AddCommand(DeployCommands())
+
+	recoverCommands(rootCmd)
 
 	return rootCmd
 }
@@ -177,3 +177,18 @@ func TestStartHypervisor(t *testing.T) {
 	api.DownloadReleaseImages(api.LatestReleaseVersion)
 	runHyperVisor("../data/webs", "Server started", "unibooty!", t)
 }
+
+func TestInitDefaultRunConfigsPorts(t *testing.T) {
+	c := api.NewConfig()
+	c.RunConfig.Ports = []int{80, 443}
+
+	initDefaultRunConfigs(c, []int{443, 8080, 8080})
+
+	if fmt.Sprint(c.RunConfig.Ports) != "[80 443 8080]" {
+		t.Errorf("expected the ports passed again to be opened once, got %v", c.RunConfig.Ports)
+	}
+
+	if _, err := api.CheckPorts(c); err != nil {
+		t.Error(err)
+	}
+}
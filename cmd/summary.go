@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/spf13/cobra"
+)
+
+// summaryFile is where the summary of the run is written, set by the global
+// --summary-file flag
+var summaryFile string
+
+// preRun checks the global flags before running a command
+func preRun(cmd *cobra.Command, args []string) {
+	summaryFile, _ = cmd.Flags().GetString("summary-file")
+	strictConfig, _ = cmd.Flags().GetBool("strict-config")
+	checkDryRun(cmd, args)
+}
+
+// postRun completes the summary of a successful run
+func postRun(cmd *cobra.Command, args []string) {
+	finishRun(api.ProgressDone)
+}
+
+// finishRun logs the summary of the resources created and deleted by the run
+// and writes it to the summary file in json
+func finishRun(status string) {
+	summary := api.RunSummary(status)
+	if summaryFile == "" {
+		return
+	}
+
+	b, err := json.MarshalIndent(summary, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(summaryFile, append(b, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Println(fmt.Sprintf(api.ErrorColor, "unable to write summary: "+err.Error()))
+	}
+}
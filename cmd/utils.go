@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -8,70 +9,82 @@ import (
 	"os/user"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/go-errors/errors"
 	api "github.com/nanovms/ops/lepton"
 	"github.com/spf13/cobra"
 )
 
+// strictConfig rejects unknown keys of config files and warns about
+// deprecated ones, set by the global --strict-config flag
+var strictConfig bool
+
 // unWarpConfig parses lepton config file from file
 func unWarpConfig(file string) *api.Config {
-	var c api.Config
 	if file != "" {
-		c = *api.NewConfig()
-		data, err := ioutil.ReadFile(file)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error reading config: %v\n", err)
-			os.Exit(1)
-		}
-		err = json.Unmarshal(data, &c)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error config: %v\n", err)
-			os.Exit(1)
-		}
-		return &c
+		c := api.NewConfig()
+		readConfigFile(file, c, strictConfig)
+		return c
 	}
-	c = *unWarpDefaultConfig()
-	return &c
+	return unWarpDefaultConfig()
+}
+
+// unWarpPackageConfig parses the config of a package manifest, which also
+// holds the details of the package so it's never checked strictly
+func unWarpPackageConfig(manifest string) *api.Config {
+	c := api.NewConfig()
+	readConfigFile(manifest, c, false)
+	return c
 }
 
 // unWarpDefaultConfig gets default config file from env
 func unWarpDefaultConfig() *api.Config {
-	c := *api.NewConfig()
+	c := api.NewConfig()
 	conf := os.Getenv("OPS_DEFAULT_CONFIG")
 	if conf != "" {
-		data, err := ioutil.ReadFile(conf)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error reading config: %v\n", err)
-			os.Exit(1)
-		}
-		err = json.Unmarshal(data, &c)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error config: %v\n", err)
-			os.Exit(1)
-		}
-		return &c
+		readConfigFile(conf, c, strictConfig)
+		return c
 	}
 	usr, err := user.Current()
 	if err != nil {
-		return &c
+		return c
 	}
 	conf = usr.HomeDir + "/.opsrc"
 	_, err = os.Stat(conf)
 	if err != nil {
-		return &c
+		return c
 	}
-	data, err := ioutil.ReadFile(conf)
+	readConfigFile(conf, c, strictConfig)
+	return c
+}
+
+// readConfigFile parses the config file into c, exiting on errors. Strict
+// checks fail on keys matching no config field, e.g. typos, instead of
+// ignoring them and warn about deprecated fields
+func readConfigFile(file string, c *api.Config, strict bool) {
+	data, err := ioutil.ReadFile(file)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error reading config: %v\n", err)
 		os.Exit(1)
 	}
-	err = json.Unmarshal(data, &c)
+
+	if strict {
+		warnings, err := api.CheckConfig(data)
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, api.WarningColor, fmt.Sprintf("warning config %s: %s\n", file, warning))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error config %s: %v\n", file, err)
+			os.Exit(1)
+		}
+	}
+
+	err = json.Unmarshal(data, c)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error config: %v\n", err)
 		os.Exit(1)
 	}
-	return &c
 }
 
 // setDefaultImageName set default name for an image
@@ -90,6 +103,27 @@ func setDefaultImageName(cmd *cobra.Command, c *api.Config) {
 	c.RunConfig.Imagename = imageName
 }
 
+// setKernelArgsImageName names the image of the config after its variant
+// with the kernel argument overrides of the run config, built by image create
+// and launched by instance create
+func setKernelArgsImageName(c *api.Config) {
+	if len(c.RunConfig.KernelArgs) == 0 {
+		return
+	}
+
+	name, ref := api.ParseImageRef(c.CloudConfig.ImageName)
+	variant, err := api.KernelArgsImageName(name, c.RunConfig.KernelArgs)
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	api.NewConfigLogger(c).Log("using image %s with kernel arguments %s", variant, strings.Join(c.RunConfig.KernelArgs, " "))
+
+	if ref != "" {
+		variant += ":" + ref
+	}
+	c.CloudConfig.ImageName = variant
+}
+
 // TODO : use factory or DI
 func getCloudProvider(providerName string) (api.Provider, error) {
 	var provider api.Provider
@@ -111,6 +145,10 @@ func getCloudProvider(providerName string) (api.Provider, error) {
 		provider = &api.OpenStack{}
 	case "azure":
 		provider = &api.Azure{}
+	case "cloudflare", "fastly", "wasm":
+		// nanos images run ELF binaries on a virtual machine, edge platforms
+		// run wasm modules deployed with ops deploy edge
+		return provider, fmt.Errorf("error:%s is not a cloud platform, deploy wasm modules to edge platforms with ops deploy edge", providerName)
 	default:
 		return provider, fmt.Errorf("error:Unknown provider %s", providerName)
 	}
@@ -123,7 +161,22 @@ func initDefaultRunConfigs(c *api.Config, ports []int) {
 	if c.RunConfig.Memory == "" {
 		c.RunConfig.Memory = "2G"
 	}
-	c.RunConfig.Ports = append(c.RunConfig.Ports, ports...)
+
+	// ports of the config passed again with -p are opened once
+	for _, port := range ports {
+		if !containsPort(c.RunConfig.Ports, port) {
+			c.RunConfig.Ports = append(c.RunConfig.Ports, port)
+		}
+	}
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
 }
 
 func fixupConfigImages(c *api.Config, version string) {
@@ -214,3 +267,13 @@ func downloadAndExtractPackage(pkg string) string {
 	api.ExtractPackage(localpackage, localstaging)
 	return expackage
 }
+
+// confirm asks question on the terminal and returns true if the user answers yes
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
 	"path"
 	"strconv"
+	"strings"
+	"time"
 
 	api "github.com/nanovms/ops/lepton"
 	"github.com/spf13/cobra"
@@ -21,6 +24,31 @@ func volumeCreateCommandHandler(cmd *cobra.Command, args []string) {
 	AppendGlobalCmdFlagsToConfig(cmd.Flags(), conf)
 
 	conf.NightlyBuild = nightly
+
+	volumeType, _ := cmd.Flags().GetString("type")
+	if volumeType != "" {
+		conf.CloudConfig.DataVolumeType = volumeType
+	}
+
+	iops, _ := cmd.Flags().GetInt64("iops")
+	if iops != 0 {
+		conf.CloudConfig.DataVolumeIops = iops
+	}
+
+	throughput, _ := cmd.Flags().GetInt64("throughput")
+	if throughput != 0 {
+		conf.CloudConfig.DataVolumeThroughput = throughput
+	}
+
+	tags, _ := cmd.Flags().GetStringArray("tag")
+	for _, tag := range tags {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			exitWithError("invalid tag argument " + tag + ", expected KEY=VALUE")
+		}
+		conf.RunConfig.Tags = append(conf.RunConfig.Tags, api.Tag{Key: kv[0], Value: kv[1]})
+	}
+
 	var err error
 	var version string
 	if conf.NightlyBuild {
@@ -53,7 +81,9 @@ func volumeCreateCommandHandler(cmd *cobra.Command, args []string) {
 }
 
 func volumeCreateCommand() *cobra.Command {
-	var data, size string
+	var data, size, volumeType string
+	var iops, throughput int64
+	var tags []string
 	cmdVolumeCreate := &cobra.Command{
 		Use:   "create <volume_name>",
 		Short: "create volume",
@@ -62,6 +92,10 @@ func volumeCreateCommand() *cobra.Command {
 	}
 	cmdVolumeCreate.PersistentFlags().StringVarP(&data, "data", "d", "", "volume data source")
 	cmdVolumeCreate.PersistentFlags().StringVarP(&size, "size", "s", strconv.Itoa(api.MinimumVolumeSize), "volume initial size")
+	cmdVolumeCreate.PersistentFlags().StringVarP(&volumeType, "type", "", "", "ebs volume type, e.g. gp3, defaults to gp2 (aws)")
+	cmdVolumeCreate.PersistentFlags().Int64VarP(&iops, "iops", "", 0, "provisioned iops of gp3, io1 and io2 volumes (aws)")
+	cmdVolumeCreate.PersistentFlags().Int64VarP(&throughput, "throughput", "", 0, "throughput of gp3 volumes in MiB/s (aws)")
+	cmdVolumeCreate.PersistentFlags().StringArrayVarP(&tags, "tag", "", nil, "key=value tag of the cloud volume")
 	return cmdVolumeCreate
 }
 
@@ -89,17 +123,26 @@ func volumeListCommandHandler(cmd *cobra.Command, args []string) {
 		log.Fatal(err)
 	}
 
-	api.PrintVolumesList(volumes)
+	if format := exportFormat(cmd); format != "" {
+		header, rows := api.VolumesTable(*volumes)
+		exportListing(cmd, format, header, rows)
+		return
+	}
+
+	api.PrintVolumesList(volumes, conf.RunConfig.TimeFormat)
 }
 
 // TODO might be nice to be able to filter by name/label
 // api.GetVolumes can be implemented to achieve this
 func volumeListCommand() *cobra.Command {
+	var export, output string
 	cmdVolumeList := &cobra.Command{
 		Use:   "list",
 		Short: "list volume",
 		Run:   volumeListCommandHandler,
 	}
+	cmdVolumeList.PersistentFlags().StringVarP(&export, "export", "", "", "export the volumes as csv, markdown or json instead of printing a table")
+	cmdVolumeList.PersistentFlags().StringVarP(&output, "output", "o", "", "file the export is written to, defaults to stdout")
 	return cmdVolumeList
 }
 
@@ -108,6 +151,7 @@ func volumeDeleteCommandHandler(cmd *cobra.Command, args []string) {
 	config, _ := cmd.Flags().GetString("config")
 	provider, _ := cmd.Flags().GetString("target-cloud")
 	conf := unWarpConfig(config)
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), conf)
 
 	var vol api.VolumeService
 	var err error
@@ -189,7 +233,7 @@ func volumeDetachCommandHandler(cmd *cobra.Command, args []string) {
 
 func volumeAttachCommand() *cobra.Command {
 	cmdVolumeAttach := &cobra.Command{
-		Use:   "attach <image_name> <volume_name> <mount_path>",
+		Use:   "attach <image_name|instance_name> <volume_name> <mount_path>",
 		Short: "attach volume",
 		Run:   volumeAttachCommandHandler,
 		Args:  cobra.MinimumNArgs(3),
@@ -199,7 +243,7 @@ func volumeAttachCommand() *cobra.Command {
 
 func volumeDetachCommand() *cobra.Command {
 	cmdVolumeDetach := &cobra.Command{
-		Use:   "detach <image_name> <volume_name>",
+		Use:   "detach <image_name|instance_name> <volume_name>",
 		Short: "detach volume",
 		Run:   volumeDetachCommandHandler,
 		Args:  cobra.MinimumNArgs(2),
@@ -207,6 +251,101 @@ func volumeDetachCommand() *cobra.Command {
 	return cmdVolumeDetach
 }
 
+func volumeSnapshotCommandHandler(cmd *cobra.Command, args []string) {
+	config, _ := cmd.Flags().GetString("config")
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	conf := unWarpConfig(config)
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), conf)
+
+	keepLast, _ := cmd.Flags().GetInt("keep-last")
+	if keepLast != 0 {
+		conf.CloudConfig.SnapshotKeepLast = keepLast
+	}
+
+	maxAge, _ := cmd.Flags().GetInt("max-age")
+	if maxAge != 0 {
+		conf.CloudConfig.SnapshotMaxAge = maxAge
+	}
+
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " volume snapshot not yet implemented")
+	}
+
+	for {
+		_, err = aws.SnapshotVolume(conf, args[0])
+		if err != nil {
+			if interval == 0 {
+				exitWithError(err.Error())
+			}
+			fmt.Printf("snapshot failed: %v\n", err)
+		}
+
+		if interval == 0 {
+			return
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func volumeSnapshotCommand() *cobra.Command {
+	var interval time.Duration
+	var keepLast, maxAge int
+
+	cmdVolumeSnapshot := &cobra.Command{
+		Use:   "snapshot <volume_name|volume_id>",
+		Short: "snapshot volume",
+		Long:  "create a point-in-time snapshot of a cloud volume and delete its snapshots expired by the snapshotkeeplast and snapshotmaxage retention rules of the cloud config",
+		Run:   volumeSnapshotCommandHandler,
+		Args:  cobra.ExactArgs(1),
+	}
+	cmdVolumeSnapshot.PersistentFlags().DurationVarP(&interval, "interval", "i", 0, "keep snapshotting the volume every interval (e.g. 24h), runs once if not set")
+	cmdVolumeSnapshot.PersistentFlags().IntVarP(&keepLast, "keep-last", "k", 0, "newest snapshots kept, overrides snapshotkeeplast of the cloud config")
+	cmdVolumeSnapshot.PersistentFlags().IntVarP(&maxAge, "max-age", "", 0, "days after which older snapshots are deleted, overrides snapshotmaxage of the cloud config")
+	return cmdVolumeSnapshot
+}
+
+func volumeRestoreCommandHandler(cmd *cobra.Command, args []string) {
+	config, _ := cmd.Flags().GetString("config")
+	provider, _ := cmd.Flags().GetString("target-cloud")
+	conf := unWarpConfig(config)
+	AppendGlobalCmdFlagsToConfig(cmd.Flags(), conf)
+
+	p, err := getCloudProvider(provider)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aws, ok := p.(*api.AWS)
+	if !ok {
+		exitWithError(provider + " volume restore not yet implemented")
+	}
+
+	res, err := aws.RestoreVolume(conf, args[0], args[1])
+	if err != nil {
+		exitWithError(err.Error())
+	}
+	log.Printf("volume: %s created with id %s\n", res.Name, res.ID)
+}
+
+func volumeRestoreCommand() *cobra.Command {
+	cmdVolumeRestore := &cobra.Command{
+		Use:   "restore <snapshot_id|volume_name> <new_volume_name>",
+		Short: "create volume from snapshot",
+		Long:  "create a cloud volume from a snapshot, given by id or by the name of the volume whose newest snapshot is restored",
+		Run:   volumeRestoreCommandHandler,
+		Args:  cobra.ExactArgs(2),
+	}
+	return cmdVolumeRestore
+}
+
 // VolumeCommands handles volumes related operations
 func VolumeCommands() *cobra.Command {
 	var config, provider string
@@ -214,7 +353,7 @@ func VolumeCommands() *cobra.Command {
 	cmdVolume := &cobra.Command{
 		Use:       "volume",
 		Short:     "manage nanos volumes",
-		ValidArgs: []string{"create, list, delete, attach"},
+		ValidArgs: []string{"create", "list", "delete", "attach", "detach", "snapshot", "restore"},
 		Args:      cobra.OnlyValidArgs,
 	}
 	cmdVolume.PersistentFlags().StringVarP(&config, "config", "c", "", "ops config file")
@@ -225,5 +364,7 @@ func VolumeCommands() *cobra.Command {
 	cmdVolume.AddCommand(volumeDeleteCommand())
 	cmdVolume.AddCommand(volumeAttachCommand())
 	cmdVolume.AddCommand(volumeDetachCommand())
+	cmdVolume.AddCommand(volumeSnapshotCommand())
+	cmdVolume.AddCommand(volumeRestoreCommand())
 	return cmdVolume
 }
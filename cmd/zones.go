@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	api "github.com/nanovms/ops/lepton"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+// commandZones returns the zones the command fans out to, its --zones or the
+// zones of the config, empty if it runs in a single zone
+func commandZones(cmd *cobra.Command, c *api.Config) []string {
+	zones, _ := cmd.Flags().GetStringArray("zones")
+
+	var result []string
+	for _, zone := range zones {
+		for _, z := range strings.Split(zone, ",") {
+			if z = strings.TrimSpace(z); z != "" {
+				result = append(result, z)
+			}
+		}
+	}
+
+	if len(result) == 0 {
+		return c.CloudConfig.Zones
+	}
+	return result
+}
+
+// inZones runs op concurrently in each zone with a provider and a copy of the
+// config of its own and returns the zones it failed in. The resources of
+// every zone share the deploy id of the config
+func inZones(providerName string, c *api.Config, zones []string, op func(ctx *api.Context, p api.Provider, zone string) error) []*api.ZoneError {
+	if c.RunConfig.DeployID == "" {
+		c.RunConfig.DeployID = api.NewContext(c, nil).DeployID()
+	}
+
+	return api.FanOutZones(zones, func(zone string) error {
+		zc, err := api.ConfigForZone(c, zone)
+		if err != nil {
+			return err
+		}
+
+		p, err := getCloudProvider(providerName)
+		if err != nil {
+			return err
+		}
+
+		return op(api.NewContext(zc, &p), p, zone)
+	})
+}
+
+// exitForZones exits listing the zones an operation failed in, if any
+func exitForZones(zones []string, failed []*api.ZoneError) {
+	if len(failed) == 0 {
+		return
+	}
+
+	messages := make([]string, len(failed))
+	for i, err := range failed {
+		messages[i] = err.Error()
+	}
+	exitWithError(fmt.Sprintf("failed in %d of %d zones:\n%s", len(failed), len(zones), strings.Join(messages, "\n")))
+}
+
+// printZoneResults prints the result of an operation in each zone, exiting
+// if it failed in any
+func printZoneResults(zones []string, failed []*api.ZoneError) {
+	errs := map[string]error{}
+	for _, zerr := range failed {
+		errs[zerr.Zone] = zerr.Err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Region", "Result"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
+	table.SetRowLine(true)
+
+	for _, zone := range zones {
+		result := "done"
+		if err, ok := errs[zone]; ok {
+			result = err.Error()
+		}
+		table.Append([]string{zone, result})
+	}
+
+	table.Render()
+
+	if len(failed) > 0 {
+		exitWithError(fmt.Sprintf("failed in %d of %d zones", len(failed), len(zones)))
+	}
+}
+
+// listInZones lists the resources returned by list in each zone in a single
+// table, or export, with a region column
+func listInZones(cmd *cobra.Command, providerName string, c *api.Config, zones []string, list func(ctx *api.Context, p api.Provider) ([]string, [][]string, error)) {
+	var mu sync.Mutex
+	var header []string
+	zoneRows := map[string][][]string{}
+
+	failed := inZones(providerName, c, zones, func(ctx *api.Context, p api.Provider, zone string) error {
+		zoneHeader, rows, err := list(ctx, p)
+		if err != nil {
+			return err
+		}
+
+		zoneHeader, rows = api.WithRegionColumn(zone, zoneHeader, rows)
+
+		mu.Lock()
+		defer mu.Unlock()
+		header = zoneHeader
+		zoneRows[zone] = rows
+		return nil
+	})
+
+	// the zones listed are printed even if others failed
+	if header != nil {
+		var rows [][]string
+		for _, zone := range zones {
+			rows = append(rows, zoneRows[zone]...)
+		}
+
+		if format := exportFormat(cmd); format != "" {
+			exportListing(cmd, format, header, rows)
+		} else {
+			for i, column := range header {
+				if column != "Created" {
+					continue
+				}
+				for _, row := range rows {
+					row[i] = api.FormatTimestamp(row[i], c.RunConfig.TimeFormat)
+				}
+			}
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader(header)
+			headerColors := make([]tablewriter.Colors, len(header))
+			for i := range headerColors {
+				headerColors[i] = tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor}
+			}
+			table.SetHeaderColor(headerColors...)
+			table.SetRowLine(true)
+			table.AppendBulk(rows)
+			table.Render()
+		}
+	}
+
+	exitForZones(zones, failed)
+}
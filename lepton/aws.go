@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ebs"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/route53"
@@ -21,6 +22,9 @@ import (
 	"github.com/olekukonko/tablewriter"
 )
 
+// awsContentHashTag is the ami tag holding the checksum of the image it was created from
+const awsContentHashTag = "ContentHash"
+
 // AWS contains all operations for AWS
 type AWS struct {
 	Storage       *S3
@@ -71,120 +75,271 @@ func (p *AWS) getDNSService(config *Config) (*route53.Route53, error) {
 	return p.dnsService, nil
 }
 
-// CreateImage - Creates image on AWS using nanos images
-// TODO : re-use and cache DefaultClient and instances.
+// CreateImage creates an ami from the image uploaded to the bucket. The
+// import of the snapshot and the registration of the ami are resumed after
+// an interruption, see DeployImage
 func (p *AWS) CreateImage(ctx *Context) error {
-	// this is a really convulted setup
-	// 1) upload the image
-	// 2) create a snapshot
-	// 3) create an image
+	return p.DeployImage(ctx, "")
+}
 
-	compute, err := p.getEc2Service(ctx.config)
+// enableFastSnapshotRestore enables fast snapshot restore of the snapshot in
+// the configured zones so instances launched from it are fully initialized
+func (p *AWS) enableFastSnapshotRestore(ctx *Context, compute *ec2.EC2, snapshotID *string) error {
+	zones := ctx.config.CloudConfig.FastRestoreZones
+
+	result, err := compute.EnableFastSnapshotRestores(&ec2.EnableFastSnapshotRestoresInput{
+		AvailabilityZones: aws.StringSlice(zones),
+		SourceSnapshotIds: []*string{snapshotID},
+	})
 	if err != nil {
-		return err
+		return fmt.Errorf("enable fast snapshot restore: %v", err)
 	}
 
-	c := ctx.config
+	for _, item := range result.Unsuccessful {
+		for _, e := range item.FastSnapshotRestoreStateErrors {
+			msg := ""
+			if e.Error != nil {
+				msg = aws.StringValue(e.Error.Message)
+			}
+			ctx.logger.Warn("fast snapshot restore not enabled in %s: %s", aws.StringValue(e.AvailabilityZone), msg)
+		}
+	}
 
-	bucket := c.CloudConfig.BucketName
-	key := c.CloudConfig.ImageName
-
-	input := &ec2.ImportSnapshotInput{
-		Description: aws.String("NanoVMs test"),
-		DiskContainer: &ec2.SnapshotDiskContainer{
-			Description: aws.String("NanoVMs test"),
-			Format:      aws.String("raw"),
-			UserBucket: &ec2.UserBucket{
-				S3Bucket: aws.String(bucket),
-				S3Key:    aws.String(key),
-			},
-		},
+	for _, item := range result.Successful {
+		ctx.logger.Info("fast snapshot restore %s in %s", aws.StringValue(item.State), aws.StringValue(item.AvailabilityZone))
+	}
+
+	return nil
+}
+
+// selectAWSImage returns the newest image with the Name tag passed by
+// argument. If version is set the image whose ami name is the name followed
+// by version is returned instead
+func selectAWSImage(images []*ec2.Image, name string, version string) (*ec2.Image, error) {
+	var selected *ec2.Image
+	var last time.Time
+
+	for _, image := range images {
+		if awsImageTag(image, "Name") != name {
+			continue
+		}
+
+		if version != "" {
+			if aws.StringValue(image.Name) == name+version {
+				return image, nil
+			}
+			continue
+		}
+
+		created, err := time.Parse(time.RFC3339, aws.StringValue(image.CreationDate))
+		if err != nil {
+			return nil, err
+		}
+
+		if selected == nil || created.After(last) {
+			selected = image
+			last = created
+		}
+	}
+
+	if selected == nil && version != "" {
+		return nil, fmt.Errorf("can't find ami %s version %s", name, version)
+	} else if selected == nil {
+		return nil, fmt.Errorf("can't find ami %s", name)
 	}
 
-	res, err := compute.ImportSnapshot(input)
+	return selected, nil
+}
+
+// findImageByName returns the newest ami with the Name tag passed by argument
+func (p *AWS) findImageByName(ctx *Context, name string) (*ec2.Image, error) {
+	result, err := getAWSImages(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	snapshotID, err := p.waitSnapshotToBeReady(c, res.ImportTaskId)
+	return selectAWSImage(result.Images, name, "")
+}
+
+// VerifyImage checks the checksum recorded on the newest ami named imagename
+// matches the checksum of the local image at localPath
+func (p *AWS) VerifyImage(ctx *Context, imagename string, localPath string) (bool, error) {
+	image, err := p.findImageByName(ctx, imagename)
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	var remote string
+	for _, tag := range image.Tags {
+		if aws.StringValue(tag.Key) == awsContentHashTag {
+			remote = aws.StringValue(tag.Value)
+		}
+	}
+
+	if remote == "" {
+		return false, fmt.Errorf("image %s (%s) has no checksum recorded", imagename, aws.StringValue(image.ImageId))
 	}
 
-	// delete the tmp s3 image
-	err = p.Storage.DeleteFromBucket(c, key)
+	local, err := fileSHA256(localPath)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	// tag the volume
-	_, err = compute.CreateTags(&ec2.CreateTagsInput{
-		Resources: []*string{snapshotID},
-		Tags: []*ec2.Tag{
-			{
-				Key:   aws.String("Name"),
-				Value: aws.String(key),
-			},
-		},
-	})
+	ctx.logger.Info("remote checksum: %s", remote)
+	ctx.logger.Info("local checksum:  %s", local)
+
+	return remote == local, nil
+}
+
+// validateVolumeConfig checks the root volume settings are consistent with
+// the volume type
+func (p *AWS) validateVolumeConfig(c *Config) error {
+	volumeType := c.CloudConfig.VolumeType
+
+	err := validateEBSSettings(volumeType, c.CloudConfig.VolumeIops, c.CloudConfig.VolumeThroughput)
 	if err != nil {
 		return err
 	}
 
-	t := time.Now().UnixNano()
-	s := strconv.FormatInt(t, 10)
+	if c.CloudConfig.OutpostARN != "" && volumeType != "" && volumeType != "gp2" {
+		return fmt.Errorf("volume type %s not supported on outposts, use gp2", volumeType)
+	}
 
-	amiName := key + s
+	return nil
+}
 
-	// register ami
-	rinput := &ec2.RegisterImageInput{
-		Name:         aws.String(amiName),
-		Architecture: aws.String("x86_64"),
-		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
-			{
-				DeviceName: aws.String("/dev/sda1"),
-				Ebs: &ec2.EbsBlockDevice{
-					DeleteOnTermination: aws.Bool(false),
-					SnapshotId:          snapshotID,
-					VolumeType:          aws.String("gp2"),
-				},
-			},
-		},
-		Description:        aws.String(fmt.Sprintf("nanos image %s", key)),
-		RootDeviceName:     aws.String("/dev/sda1"),
-		VirtualizationType: aws.String("hvm"),
-		EnaSupport:         aws.Bool(false),
+// validateEBSSettings checks the iops and throughput of an ebs volume are
+// supported by its type. Without a type volumes are gp2, which has neither
+func validateEBSSettings(volumeType string, iops int64, throughput int64) error {
+	switch volumeType {
+	case "io1", "io2":
+		if iops == 0 {
+			return fmt.Errorf("volume type %s requires provisioned iops", volumeType)
+		}
+	case "gp3":
+	case "":
+		if iops != 0 {
+			return errors.New("provisioned iops require a volume type of gp3, io1 or io2")
+		}
+	default:
+		if iops != 0 {
+			return fmt.Errorf("provisioned iops not supported by volume type %s", volumeType)
+		}
 	}
 
-	resreg, err := compute.RegisterImage(rinput)
-	if err != nil {
-		return err
+	if throughput != 0 && volumeType != "gp3" {
+		return errors.New("volume throughput is only supported by gp3 volumes")
 	}
 
-	// Add name tag to the created ami
-	_, err = compute.CreateTags(&ec2.CreateTagsInput{
-		Resources: []*string{resreg.ImageId},
-		Tags: []*ec2.Tag{
-			{
-				Key:   aws.String("Name"),
-				Value: aws.String(key),
-			},
+	return nil
+}
+
+// rootDevice applies the configured root volume settings to device
+func (p *AWS) rootDevice(c *Config, device *ec2.EbsBlockDevice) {
+	if c.CloudConfig.VolumeType != "" {
+		device.VolumeType = aws.String(c.CloudConfig.VolumeType)
+	}
+
+	if c.CloudConfig.VolumeIops != 0 {
+		device.Iops = aws.Int64(c.CloudConfig.VolumeIops)
+	}
+
+	if c.CloudConfig.VolumeThroughput != 0 {
+		device.Throughput = aws.Int64(c.CloudConfig.VolumeThroughput)
+	}
+
+	if c.RunConfig.VolumeSizeInGb != 0 {
+		device.VolumeSize = aws.Int64(int64(c.RunConfig.VolumeSizeInGb))
+	}
+}
+
+// imageRootDevice returns the root device registered with the image
+func (p *AWS) imageRootDevice(c *Config, snapshotID *string) *ec2.EbsBlockDevice {
+	device := &ec2.EbsBlockDevice{
+		DeleteOnTermination: aws.Bool(false),
+		SnapshotId:          snapshotID,
+		VolumeType:          aws.String("gp2"),
+	}
+
+	p.rootDevice(c, device)
+
+	// the key is inherited from the snapshot, only the flag is accepted
+	if c.CloudConfig.KMSKeyID != "" {
+		device.Encrypted = aws.Bool(true)
+	}
+
+	return device
+}
+
+// instanceRootDevice returns the root device overrides applied on instance
+// launch, nil if there are none
+func (p *AWS) instanceRootDevice(c *Config) []*ec2.BlockDeviceMapping {
+	device := &ec2.EbsBlockDevice{}
+
+	p.rootDevice(c, device)
+
+	if c.CloudConfig.KMSKeyID != "" {
+		device.Encrypted = aws.Bool(true)
+		device.KmsKeyId = aws.String(c.CloudConfig.KMSKeyID)
+	}
+
+	if *device == (ec2.EbsBlockDevice{}) {
+		return nil
+	}
+
+	return []*ec2.BlockDeviceMapping{
+		{
+			DeviceName: aws.String("/dev/sda1"),
+			Ebs:        device,
 		},
-	})
+	}
+}
 
-	return nil
+// instanceMetadataOptions returns the instance metadata service settings of
+// the cloud config, nil if none is set so the account defaults apply
+func (p *AWS) instanceMetadataOptions(c *Config) (*ec2.InstanceMetadataOptionsRequest, error) {
+	cloud := c.CloudConfig
+
+	if cloud.MetadataTokens == "" && cloud.MetadataHopLimit == 0 && cloud.MetadataEndpoint == "" {
+		return nil, nil
+	}
+
+	options := &ec2.InstanceMetadataOptionsRequest{}
+
+	switch cloud.MetadataTokens {
+	case "":
+	case ec2.HttpTokensStateRequired, ec2.HttpTokensStateOptional:
+		options.HttpTokens = aws.String(cloud.MetadataTokens)
+	default:
+		return nil, fmt.Errorf("invalid metadata tokens %q, expected required or optional", cloud.MetadataTokens)
+	}
+
+	if cloud.MetadataHopLimit < 0 || cloud.MetadataHopLimit > 64 {
+		return nil, fmt.Errorf("invalid metadata hop limit %d, expected 1 to 64", cloud.MetadataHopLimit)
+	} else if cloud.MetadataHopLimit != 0 {
+		options.HttpPutResponseHopLimit = aws.Int64(cloud.MetadataHopLimit)
+	}
+
+	switch cloud.MetadataEndpoint {
+	case "":
+	case ec2.InstanceMetadataEndpointStateEnabled, ec2.InstanceMetadataEndpointStateDisabled:
+		options.HttpEndpoint = aws.String(cloud.MetadataEndpoint)
+	default:
+		return nil, fmt.Errorf("invalid metadata endpoint %q, expected enabled or disabled", cloud.MetadataEndpoint)
+	}
+
+	return options, nil
 }
 
-func getAWSImages(region string) (*ec2.DescribeImagesOutput, error) {
-	svc, err := session.NewSession(&aws.Config{
-		Region: aws.String(region)},
-	)
+func getAWSImages(cloud *ProviderConfig, region string, filters []*ec2.Filter) (*ec2.DescribeImagesOutput, error) {
+	svc, err := newAWSSession(cloud, region)
 	compute := ec2.New(svc)
 
 	input := &ec2.DescribeImagesInput{
 		Owners: []*string{
 			aws.String("self"),
 		},
+		Filters: filters,
 	}
 
 	result, err := compute.DescribeImages(input)
@@ -210,70 +365,97 @@ func formalizeAWSInstance(instance *ec2.Instance) *CloudInstance {
 		}
 	}
 
-	var privateIps, publicIps []string
+	var privateIps, publicIps, ipv6Addresses []string
 	for _, ninterface := range instance.NetworkInterfaces {
 		privateIps = append(privateIps, aws.StringValue(ninterface.PrivateIpAddress))
 
 		if ninterface.Association != nil && ninterface.Association.PublicIp != nil {
 			publicIps = append(publicIps, aws.StringValue(ninterface.Association.PublicIp))
 		}
+
+		for _, address := range ninterface.Ipv6Addresses {
+			ipv6Addresses = append(ipv6Addresses, aws.StringValue(address.Ipv6Address))
+		}
 	}
 
 	return &CloudInstance{
-		ID:         aws.StringValue(instance.InstanceId),
-		Name:       instanceName,
-		Status:     aws.StringValue(instance.State.Name),
-		Created:    aws.TimeValue(instance.LaunchTime).String(),
-		PublicIps:  publicIps,
-		PrivateIps: privateIps,
+		ID:            aws.StringValue(instance.InstanceId),
+		Name:          instanceName,
+		Status:        aws.StringValue(instance.State.Name),
+		Created:       aws.TimeValue(instance.LaunchTime).String(),
+		Flavor:        aws.StringValue(instance.InstanceType),
+		PublicIps:     publicIps,
+		PrivateIps:    privateIps,
+		Ipv6Addresses: ipv6Addresses,
 	}
 }
 
-func getAWSInstances(region string, filter []*ec2.Filter) []CloudInstance {
-	svc, err := session.NewSession(&aws.Config{
-		Region: aws.String(region)},
-	)
-	compute := ec2.New(svc)
-
-	request := ec2.DescribeInstancesInput{
-		Filters: filter,
+func getAWSInstances(cloud *ProviderConfig, region string, filter []*ec2.Filter) ([]CloudInstance, error) {
+	svc, err := newAWSSession(cloud, region)
+	if err != nil {
+		return nil, err
 	}
-	result, err := compute.DescribeInstances(&request)
+	compute := ec2.New(svc)
 
+	var cinstances []CloudInstance
+	err = eachAWSInstancePage(compute, filter, func(page []CloudInstance) error {
+		cinstances = append(cinstances, page...)
+		return nil
+	})
 	if err != nil {
-		exitWithError("invalid region")
+		return nil, fmt.Errorf("describe instances in %s: %v", region, err)
 	}
 
-	var cinstances []CloudInstance
+	return cinstances, nil
+}
 
-	for _, reservation := range result.Reservations {
+// eachAWSInstancePage calls fn with the pages of the instances matching the
+// filters, errors of fn stop the listing and are returned
+func eachAWSInstancePage(compute *ec2.EC2, filter []*ec2.Filter, fn InstancePageFunc) error {
+	request := &ec2.DescribeInstancesInput{
+		Filters:    filter,
+		MaxResults: aws.Int64(instancePageSize),
+	}
 
-		for i := 0; i < len(reservation.Instances); i++ {
-			instance := reservation.Instances[i]
+	var fnErr error
+	err := compute.DescribeInstancesPages(request, func(result *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		var page []CloudInstance
+		for _, reservation := range result.Reservations {
+			for _, instance := range reservation.Instances {
+				page = append(page, *formalizeAWSInstance(instance))
+			}
+		}
 
-			cinstances = append(cinstances, *formalizeAWSInstance(instance))
+		// filtered pages can be empty while more follow
+		if len(page) == 0 {
+			return true
 		}
 
+		fnErr = fn(page)
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return cinstances
+	return fnErr
 }
 
 // GetImages return all images on AWS
 func (p *AWS) GetImages(ctx *Context) ([]CloudImage, error) {
 	var cimages []CloudImage
 
-	result, err := getAWSImages(ctx.config.CloudConfig.Zone)
+	filters := toAWSFilters(ctx.config.RunConfig.Filters, "state")
+
+	result, err := getAWSImages(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone, filters)
 	if err != nil {
 		return nil, err
 	}
 
 	images := result.Images
 	for _, image := range images {
-		var name string
-		if image.Tags != nil {
-			name = aws.StringValue(image.Tags[0].Value)
-		} else {
+		name := awsImageTag(image, "Name")
+		if name == "" {
 			name = "n/a"
 		}
 
@@ -296,6 +478,7 @@ func (p *AWS) ListImages(ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	sortImagesByCreated(cimages)
 
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Name", "Id", "Status", "Created"})
@@ -312,7 +495,7 @@ func (p *AWS) ListImages(ctx *Context) error {
 		row = append(row, image.Name)
 		row = append(row, image.ID)
 		row = append(row, image.Status)
-		row = append(row, image.Created)
+		row = append(row, FormatTimestamp(image.Created, ctx.config.RunConfig.TimeFormat))
 
 		table.Append(row)
 	}
@@ -322,91 +505,94 @@ func (p *AWS) ListImages(ctx *Context) error {
 	return nil
 }
 
-// StartInstance stops instance from AWS by ami name
+// StartInstance starts instance from AWS by instance id
 func (p *AWS) StartInstance(ctx *Context, instanceID string) error {
+	return p.StartInstances(ctx, []string{instanceID})
+}
 
-	if instanceID == "" {
-		exitWithError("Enter Instance ID")
+// StartInstances starts the instances with the ids passed by argument in a single request
+func (p *AWS) StartInstances(ctx *Context, instanceIDs []string) error {
+	if len(instanceIDs) == 0 {
+		return errors.New("Enter Instance ID")
 	}
 
-	svc, err := session.NewSession(&aws.Config{
-		Region: aws.String(ctx.config.CloudConfig.Zone)},
-	)
-
-	compute := ec2.New(svc)
-
+	compute, err := p.getEc2Service(ctx.config)
 	if err != nil {
-		exitWithError("Invalid region")
+		return err
 	}
 
-	input := &ec2.StartInstancesInput{
-		InstanceIds: []*string{
-			aws.String(instanceID),
-		},
+	result, err := compute.StartInstances(&ec2.StartInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+		DryRun:      aws.Bool(ctx.config.RunConfig.DryRun),
+	})
+	if ctx.config.RunConfig.DryRun {
+		return dryRunRequest(err, "would start instances %s", strings.Join(instanceIDs, ", "))
 	}
-
-	result, err := compute.StartInstances(input)
-
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				exitWithError(aerr.Message())
-			}
-		} else {
-			exitWithError(aerr.Message())
-		}
-
+		return err
 	}
 
-	if result.StartingInstances[0].InstanceId != nil {
-		fmt.Printf("Started instance : %s\n", *result.StartingInstances[0].InstanceId)
+	for _, instance := range result.StartingInstances {
+		ctx.logger.Log("Started instance : %s", aws.StringValue(instance.InstanceId))
 	}
 
 	return nil
 }
 
-// StopInstance stops instance from AWS by ami name
+// StopInstance stops instance from AWS by instance id
 func (p *AWS) StopInstance(ctx *Context, instanceID string) error {
+	return p.StopInstances(ctx, []string{instanceID})
+}
 
-	if instanceID == "" {
-		exitWithError("Enter InstanceID")
+// StopInstances stops the instances with the ids passed by argument in a single request
+func (p *AWS) StopInstances(ctx *Context, instanceIDs []string) error {
+	if len(instanceIDs) == 0 {
+		return errors.New("Enter Instance ID")
 	}
 
-	svc, err := session.NewSession(&aws.Config{
-		Region: aws.String(ctx.config.CloudConfig.Zone)},
-	)
-
-	compute := ec2.New(svc)
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
 
+	result, err := compute.StopInstances(&ec2.StopInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+		DryRun:      aws.Bool(ctx.config.RunConfig.DryRun),
+	})
+	if ctx.config.RunConfig.DryRun {
+		return dryRunRequest(err, "would stop instances %s", strings.Join(instanceIDs, ", "))
+	}
 	if err != nil {
-		exitWithError("Invalid region")
+		return err
 	}
 
-	input := &ec2.StopInstancesInput{
-		InstanceIds: []*string{
-			aws.String(instanceID),
-		},
+	for _, instance := range result.StoppingInstances {
+		ctx.logger.Log("Stopped instance %s", aws.StringValue(instance.InstanceId))
 	}
 
-	result, err := compute.StopInstances(input)
+	return nil
+}
 
+// RebootInstance reboots instance from AWS by instance id keeping its public ip
+func (p *AWS) RebootInstance(ctx *Context, instanceID string) error {
+	compute, err := p.getEc2Service(ctx.config)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			default:
-				exitWithError(aerr.Message())
-			}
-		} else {
-			exitWithError(aerr.Message())
-		}
-
+		return err
 	}
 
-	if result.StoppingInstances[0].InstanceId != nil {
-		fmt.Printf("Stopped instance %s", *result.StoppingInstances[0].InstanceId)
+	_, err = compute.RebootInstances(&ec2.RebootInstancesInput{
+		InstanceIds: aws.StringSlice([]string{instanceID}),
+		DryRun:      aws.Bool(ctx.config.RunConfig.DryRun),
+	})
+	if ctx.config.RunConfig.DryRun {
+		return dryRunRequest(err, "would reboot instance %s", instanceID)
+	}
+	if err != nil {
+		return err
 	}
 
+	ctx.logger.Log("Rebooted instance %s", instanceID)
+
 	return nil
 }
 
@@ -418,9 +604,7 @@ func (p *AWS) ResizeImage(ctx *Context, imagename string, hbytes string) error {
 // DeleteImage deletes image from AWS by ami name
 func (p *AWS) DeleteImage(ctx *Context, imagename string) error {
 	// delete ami by ami name
-	svc, err := session.NewSession(&aws.Config{
-		Region: aws.String(ctx.config.CloudConfig.Zone)},
-	)
+	svc, err := newAWSSession(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone)
 	compute := ec2.New(svc)
 
 	ec2Filters := []*ec2.Filter{}
@@ -436,10 +620,10 @@ func (p *AWS) DeleteImage(ctx *Context, imagename string) error {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			default:
-				fmt.Println(aerr.Error())
+				ctx.logger.Error("%v", aerr)
 			}
 		} else {
-			fmt.Println(err.Error())
+			ctx.logger.Error("%v", err)
 		}
 		return err
 	}
@@ -448,18 +632,36 @@ func (p *AWS) DeleteImage(ctx *Context, imagename string) error {
 	}
 
 	amiID := aws.StringValue(result.Images[0].ImageId)
-	snapID := aws.StringValue(result.Images[0].BlockDeviceMappings[0].Ebs.SnapshotId)
+
+	var snapID string
+	for _, device := range result.Images[0].BlockDeviceMappings {
+		if device.Ebs != nil && device.Ebs.SnapshotId != nil {
+			snapID = aws.StringValue(device.Ebs.SnapshotId)
+			break
+		}
+	}
 
 	// grab snapshotid && grab image id
 
 	params := &ec2.DeregisterImageInput{
 		ImageId: aws.String(amiID),
-		DryRun:  aws.Bool(false),
+		DryRun:  aws.Bool(ctx.config.RunConfig.DryRun),
 	}
 	_, err = compute.DeregisterImage(params)
+	if ctx.config.RunConfig.DryRun {
+		return dryRunRequest(err, "would deregister image %s (%s) and delete its snapshot %s", imagename, amiID, snapID)
+	}
+
+	invalidateAWSImageCache(ctx, ctx.config.CloudConfig.Zone, awsImageTag(result.Images[0], "Name"))
+
 	if err != nil {
 		return fmt.Errorf("Error running deregister image operation: %s", err)
 	}
+	ctx.recordDeleted("image", amiID)
+
+	if snapID == "" {
+		return nil
+	}
 
 	// DeleteSnapshot
 	params2 := &ec2.DeleteSnapshotInput{
@@ -470,168 +672,725 @@ func (p *AWS) DeleteImage(ctx *Context, imagename string) error {
 	if err != nil {
 		return fmt.Errorf("Error running snapshot delete: %s", err)
 	}
+	ctx.recordDeleted("snapshot", snapID)
 
 	return nil
 }
 
-// SyncImage syncs image from provider to another provider
-func (p *AWS) SyncImage(config *Config, target Provider, image string) error {
-	fmt.Println("not yet implemented")
-	return nil
-}
-
-// parseToAWSTags converts configuration tags to AWS tags and returns the resource name. The defaultName is overriden if there is a tag with key name
-func parseToAWSTags(configTags []Tag, defaultName string) ([]*ec2.Tag, string) {
-	tags := []*ec2.Tag{}
-	var nameSpecified bool
-	name := defaultName
+// PruneImages deregisters the amis and deletes their snapshots according to
+// the retention rules. Amis are grouped by their Name tag
+func (p *AWS) PruneImages(ctx *Context, opts PruneOptions) ([]CloudImage, error) {
+	err := opts.validate()
+	if err != nil {
+		return nil, err
+	}
 
-	for _, tag := range configTags {
-		tags = append(tags, &ec2.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
-		if tag.Key == "Name" {
-			nameSpecified = true
-			name = tag.Value
-		}
+	if opts.MaxSize > 0 {
+		return nil, errors.New("a maximum size only applies to local images")
 	}
 
-	if !nameSpecified {
-		tags = append(tags, &ec2.Tag{
-			Key:   aws.String("Name"),
-			Value: aws.String(name),
-		})
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
 	}
 
-	return tags, name
-}
+	result, err := getAWSImages(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone, []*ec2.Filter{
+		{Name: aws.String("tag:CreatedBy"), Values: aws.StringSlice([]string{"ops"})},
+	})
+	if err != nil {
+		return nil, err
+	}
 
-// CreateInstance - Creates instance on AWS Platform
-func (p *AWS) CreateInstance(ctx *Context) error {
-	result, err := getAWSImages(ctx.config.CloudConfig.Zone)
+	inUse, err := p.imagesInUse(ctx, compute)
 	if err != nil {
-		exitWithError("Invalid zone")
+		return nil, err
 	}
 
-	imgName := ctx.config.CloudConfig.ImageName
+	images := map[string]*ec2.Image{}
+	var candidates []pruneCandidate
+	for _, image := range result.Images {
+		name := awsImageTag(image, "Name")
+		if name == "" {
+			continue
+		}
 
-	ami := ""
-	var last time.Time
-	layout := "2006-01-02T15:04:05.000Z"
+		if inUse[aws.StringValue(image.ImageId)] {
+			ctx.logger.Log("keeping image %s (%s), it is in use", name, aws.StringValue(image.ImageId))
+			continue
+		}
 
-	for i := 0; i < len(result.Images); i++ {
-		n := ""
-		if result.Images[i].Tags != nil {
-			n = aws.StringValue(result.Images[i].Tags[0].Value)
+		created, err := time.Parse(time.RFC3339, aws.StringValue(image.CreationDate))
+		if err != nil {
+			return nil, err
 		}
 
-		if n != "" && n == imgName {
-			ami = aws.StringValue(result.Images[i].ImageId)
+		id := aws.StringValue(image.ImageId)
+		images[id] = image
+		candidates = append(candidates, pruneCandidate{ID: id, Name: name, Created: created})
+	}
 
-			ntime := aws.StringValue(result.Images[i].CreationDate)
-			t, err := time.Parse(layout, ntime)
-			if err != nil {
-				return err
-			}
+	var pruned []CloudImage
+	for _, candidate := range opts.selectPruned(candidates, time.Now()) {
+		image := images[candidate.ID]
 
-			if last.Before(t) {
-				last = t
+		if !opts.DryRun {
+			err = p.deregisterImage(compute, image)
+			if err != nil {
+				return pruned, err
 			}
+			invalidateAWSImageCache(ctx, ctx.config.CloudConfig.Zone, candidate.Name)
 		}
-	}
 
-	if ami == "" {
-		return errors.New("can't find ami")
+		pruned = append(pruned, CloudImage{
+			ID:      aws.StringValue(image.ImageId),
+			Name:    candidate.Name,
+			Status:  aws.StringValue(image.State),
+			Created: aws.StringValue(image.CreationDate),
+		})
 	}
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(ctx.config.CloudConfig.Zone)},
-	)
+	return pruned, nil
+}
 
-	// Create EC2 service client
-	svc := ec2.New(sess)
+// imagesInUse returns the ids of the images used by instances, by the default
+// and latest versions of launch templates and by auto scaling groups
+func (p *AWS) imagesInUse(ctx *Context, compute *ec2.EC2) (map[string]bool, error) {
+	inUse := map[string]bool{}
 
-	// create security group - could take a potential 'RemotePort' from
-	// config.json in future
-	vpc, err := p.GetVPC(ctx, svc)
+	err := compute.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+		},
+	}, func(result *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range result.Reservations {
+			for _, instance := range reservation.Instances {
+				inUse[aws.StringValue(instance.ImageId)] = true
+			}
+		}
+		return true
+	})
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("describe instances: %v", err)
 	}
 
-	var sg string
-
-	if ctx.config.RunConfig.SecurityGroup != "" && ctx.config.RunConfig.VPC != "" {
-		err = p.CheckValidSecurityGroup(ctx, svc)
-		if err != nil {
-			return err
-		}
+	var templates []*ec2.LaunchTemplate
+	err = compute.DescribeLaunchTemplatesPages(&ec2.DescribeLaunchTemplatesInput{}, func(result *ec2.DescribeLaunchTemplatesOutput, lastPage bool) bool {
+		templates = append(templates, result.LaunchTemplates...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe launch templates: %v", err)
+	}
 
-		sg = ctx.config.RunConfig.SecurityGroup
-	} else {
-		sg, err = p.CreateSG(ctx, svc, imgName, *vpc.VpcId)
+	for _, template := range templates {
+		versions, err := compute.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+			LaunchTemplateId: template.LaunchTemplateId,
+			Versions:         aws.StringSlice([]string{"$Latest", "$Default"}),
+		})
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("describe launch template %s versions: %v", aws.StringValue(template.LaunchTemplateName), err)
 		}
+		addLaunchTemplateImages(inUse, versions.LaunchTemplateVersions)
 	}
 
-	subnet, err := p.GetSubnet(ctx, svc, *vpc.VpcId)
+	scaling, err := p.getAutoScalingService(ctx.config)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if ctx.config.CloudConfig.Flavor == "" {
-		ctx.config.CloudConfig.Flavor = "t2.micro"
-	}
+	var configurations []*string
+	err = scaling.DescribeAutoScalingGroupsPages(&autoscaling.DescribeAutoScalingGroupsInput{}, func(result *autoscaling.DescribeAutoScalingGroupsOutput, lastPage bool) bool {
+		for _, group := range result.AutoScalingGroups {
+			if group.LaunchConfigurationName != nil {
+				configurations = append(configurations, group.LaunchConfigurationName)
+			}
+
+			template := group.LaunchTemplate
+			if template == nil && group.MixedInstancesPolicy != nil && group.MixedInstancesPolicy.LaunchTemplate != nil && group.MixedInstancesPolicy.LaunchTemplate.LaunchTemplateSpecification != nil {
+				spec := group.MixedInstancesPolicy.LaunchTemplate.LaunchTemplateSpecification
+				template = &autoscaling.LaunchTemplateSpecification{LaunchTemplateId: spec.LaunchTemplateId, LaunchTemplateName: spec.LaunchTemplateName, Version: spec.Version}
+			}
+			if template == nil || template.Version == nil {
+				continue
+			}
+
+			versions, err := compute.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+				LaunchTemplateId:   template.LaunchTemplateId,
+				LaunchTemplateName: template.LaunchTemplateName,
+				Versions:           []*string{template.Version},
+			})
+			if err != nil {
+				ctx.logger.Warn("describe launch template of auto scaling group %s: %v", aws.StringValue(group.AutoScalingGroupName), err)
+				continue
+			}
+			addLaunchTemplateImages(inUse, versions.LaunchTemplateVersions)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe auto scaling groups: %v", err)
+	}
+
+	if len(configurations) > 0 {
+		err = scaling.DescribeLaunchConfigurationsPages(&autoscaling.DescribeLaunchConfigurationsInput{
+			LaunchConfigurationNames: configurations,
+		}, func(result *autoscaling.DescribeLaunchConfigurationsOutput, lastPage bool) bool {
+			for _, configuration := range result.LaunchConfigurations {
+				inUse[aws.StringValue(configuration.ImageId)] = true
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe launch configurations: %v", err)
+		}
+	}
+
+	return inUse, nil
+}
+
+// addLaunchTemplateImages marks the images of the launch template versions as used
+func addLaunchTemplateImages(inUse map[string]bool, versions []*ec2.LaunchTemplateVersion) {
+	for _, version := range versions {
+		if version.LaunchTemplateData != nil && version.LaunchTemplateData.ImageId != nil {
+			inUse[aws.StringValue(version.LaunchTemplateData.ImageId)] = true
+		}
+	}
+}
+
+// SyncImage syncs image from provider to another provider
+func (p *AWS) SyncImage(config *Config, target Provider, image string) error {
+	return errors.New("image sync is not yet implemented")
+}
+
+// getAWSDefaultTags returns the tags identifying resources managed by ops
+func getAWSDefaultTags() []*ec2.Tag {
+	return []*ec2.Tag{
+		{Key: aws.String("CreatedBy"), Value: aws.String("ops")},
+	}
+}
+
+// awsDeployIDTag is the tag holding the deploy id of the operation that
+// created a resource
+const awsDeployIDTag = "DeployID"
+
+// withDeployIDTag returns the tags with the deploy id of the context
+func withDeployIDTag(ctx *Context, tags []*ec2.Tag) []*ec2.Tag {
+	result := append([]*ec2.Tag{}, tags...)
+	if ctx.DeployID() != "" {
+		result = append(result, &ec2.Tag{Key: aws.String(awsDeployIDTag), Value: aws.String(ctx.DeployID())})
+	}
+	return result
+}
+
+// withImageMetadataTags returns the tags with the image metadata of the
+// config. Metadata keys already tagged or reserved by ops are skipped
+func withImageMetadataTags(c *Config, tags []*ec2.Tag) []*ec2.Tag {
+	result := append([]*ec2.Tag{}, tags...)
+
+	used := map[string]bool{awsDeployIDTag: true}
+	for _, tag := range tags {
+		used[aws.StringValue(tag.Key)] = true
+	}
+
+	for _, tag := range imageMetadata(c) {
+		if used[tag.Key] || strings.HasPrefix(tag.Key, "aws:") {
+			continue
+		}
+		result = append(result, &ec2.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
+	}
+
+	return result
+}
+
+// awsImageTag returns the value of the image tag with key
+func awsImageTag(image *ec2.Image, key string) string {
+	for _, tag := range image.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
+
+// parseToAWSTags converts configuration tags to AWS tags and returns the resource name. The defaultName is overriden if there is a tag with key name
+func parseToAWSTags(configTags []Tag, defaultName string) ([]*ec2.Tag, string) {
+	tags := getAWSDefaultTags()
+	var nameSpecified bool
+	name := defaultName
+
+	for _, tag := range configTags {
+		tags = append(tags, &ec2.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
+		if tag.Key == "Name" {
+			nameSpecified = true
+			name = tag.Value
+		}
+	}
+
+	if !nameSpecified {
+		tags = append(tags, &ec2.Tag{
+			Key:   aws.String("Name"),
+			Value: aws.String(name),
+		})
+	}
+
+	return tags, name
+}
+
+// resolveAMI returns the id of the ami launched for the image imgName, ref
+// being an alias or build version of the image
+func (p *AWS) resolveAMI(ctx *Context, imgName string, ref string) (string, error) {
+	switch {
+	case ctx.config.RunConfig.ImageID != "":
+		return ctx.config.RunConfig.ImageID, nil
+	case strings.HasPrefix(imgName, "ami-"):
+		// the image name may be an explicit ami id
+		return imgName, nil
+	}
+
+	images, err := getAWSImagesByName(ctx, imgName)
+	if err != nil {
+		return "", err
+	}
+
+	image, err := selectAWSImageRef(images, imgName, ref)
+	if err != nil {
+		return "", err
+	}
+
+	ami := aws.StringValue(image.ImageId)
+	ctx.logger.Log("Using image %s (%s) created at %s", aws.StringValue(image.Name), ami, aws.StringValue(image.CreationDate))
+
+	return ami, nil
+}
+
+// instanceNetwork returns the security group and subnet instances of the
+// image imgName are launched in, creating the security group if the config
+// doesn't set one
+func (p *AWS) instanceNetwork(ctx *Context, svc *ec2.EC2, imgName string) (string, *ec2.Subnet, error) {
+	// create security group - could take a potential 'RemotePort' from
+	// config.json in future
+	vpc, err := p.GetVPC(ctx, svc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// a dry run without network has no subnet to launch in
+	if vpc == nil {
+		return "", nil, nil
+	}
+
+	var sg string
+
+	if ctx.config.RunConfig.SecurityGroup != "" && ctx.config.RunConfig.VPC != "" {
+		err = p.CheckValidSecurityGroup(ctx, svc)
+		if err != nil {
+			return "", nil, err
+		}
+
+		sg = ctx.config.RunConfig.SecurityGroup
+	} else {
+		if ctx.config.RunConfig.CheckQuotas {
+			err = p.checkSecurityGroupQuota(ctx, svc, *vpc.VpcId)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+
+		if ctx.config.RunConfig.DryRun {
+			err = p.dryRunSecurityGroup(ctx, *vpc.VpcId)
+		} else {
+			sg, err = p.CreateSG(ctx, svc, imgName, *vpc.VpcId)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	subnet, err := p.GetSubnet(ctx, svc, *vpc.VpcId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sg, subnet, nil
+}
+
+// instanceUserData returns the base64 encoded user data of the run config,
+// nil if there is none
+func (p *AWS) instanceUserData(ctx *Context) (*string, error) {
+	userData, err := buildUserData(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(userData) > awsUserDataMaxSize {
+		return nil, fmt.Errorf("user data size %d exceeds the %d bytes allowed by AWS", len(userData), awsUserDataMaxSize)
+	}
+
+	if userData == "" {
+		return nil, nil
+	}
+
+	ctx.logger.Info("passing user data to instance, image requires the cloud_init klib to read it")
+
+	return aws.String(base64.StdEncoding.EncodeToString([]byte(userData))), nil
+}
+
+// RecordsResources returns true, the instances, images, snapshots and
+// security groups created and deleted are recorded in the operation summary
+func (p *AWS) RecordsResources() bool {
+	return true
+}
+
+// instanceIndexPlaceholder is replaced by the position of each instance in
+// the names of instances launched together
+const instanceIndexPlaceholder = "{{index}}"
+
+// instanceName returns the name of the instance at index from the name template
+func instanceName(template string, index int) string {
+	return strings.Replace(template, instanceIndexPlaceholder, strconv.Itoa(index), -1)
+}
+
+// withAWSNameTag returns a copy of tags with the Name tag set to name
+func withAWSNameTag(tags []*ec2.Tag, name string) []*ec2.Tag {
+	named := []*ec2.Tag{}
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) != "Name" {
+			named = append(named, tag)
+		}
+	}
+
+	return append(named, &ec2.Tag{Key: aws.String("Name"), Value: aws.String(name)})
+}
+
+// CreateInstance - Creates instance on AWS Platform
+func (p *AWS) CreateInstance(ctx *Context) error {
+	_, err := p.CreateInstances(ctx)
+	return err
+}
+
+// CreateInstances launches the number of instances of the run config in a
+// single request and returns their ids. {{index}} in the instance name is
+// replaced by the position of each instance starting at 1. Errors after the
+// launch are returned with the ids of the instances, which keep running
+func (p *AWS) CreateInstances(ctx *Context) ([]string, error) {
+	imgName, ref := ParseImageRef(ctx.config.CloudConfig.ImageName)
+	if ctx.config.RunConfig.ImageVersion != "" {
+		ref = ctx.config.RunConfig.ImageVersion
+	}
+
+	err := p.validateVolumeConfig(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateFlowLogConfig(&ctx.config.CloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateVPCEndpoints(&ctx.config.CloudConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = roleRules(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateServiceDiscovery(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.config.RunConfig.Async && serviceDiscoveryEnabled(ctx.config) {
+		return nil, errors.New("instances are registered with their service once running, service discovery can't be used in async mode")
+	}
+
+	metadataOptions, err := p.instanceMetadataOptions(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	switch ctx.config.RunConfig.ShutdownBehavior {
+	case "", ec2.ShutdownBehaviorStop, ec2.ShutdownBehaviorTerminate:
+	default:
+		return nil, fmt.Errorf("invalid shutdown behavior %q, expected stop or terminate", ctx.config.RunConfig.ShutdownBehavior)
+	}
+
+	count := ctx.config.RunConfig.InstanceCount
+	if count < 1 {
+		count = 1
+	}
+
+	if count > 1 && hasDomainNames(ctx.config) {
+		return nil, errors.New("a domain name can't be assigned to multiple instances")
+	}
+
+	if ctx.config.RunConfig.Async && (hasDomainNames(ctx.config) || loadBalancingEnabled(&ctx.config.CloudConfig)) {
+		return nil, errors.New("domain names and load balancers wait for the instances, they can't be used in async mode")
+	}
+
+	if ctx.config.RunConfig.Async && ctx.config.RunConfig.Wait {
+		return nil, errors.New("instances can't be waited for in async mode")
+	}
+
+	if _, err := DNSRecordType(ctx.config); err != nil {
+		return nil, err
+	}
+
+	ami, err := p.resolveAMI(ctx, imgName, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := newAWSSession(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone)
+
+	// Create EC2 service client
+	svc := ec2.New(sess)
+
+	flavorSet := ctx.config.CloudConfig.Flavor != ""
+	if !flavorSet {
+		ctx.config.CloudConfig.Flavor = "t2.micro"
+	}
+
+	if ctx.config.RunConfig.CheckQuotas {
+		err = p.checkVCPUQuota(ctx, svc, ctx.config.CloudConfig.Flavor, count)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = p.checkProjectInstances(ctx, svc, count)
+	if err != nil {
+		return nil, err
+	}
+
+	sg, subnet, err := p.instanceNetwork(ctx, svc, imgName)
+	if err != nil {
+		return nil, err
+	}
+
+	// dry run in a network that doesn't exist yet
+	if subnet == nil {
+		dryRunf("would create %d instances of %s from %s in the new network", count, ctx.config.CloudConfig.Flavor, ami)
+		return nil, nil
+	}
+
+	if len(ctx.config.CloudConfig.VPCEndpoints) > 0 {
+		err = p.ensureVPCEndpoints(ctx, svc, subnet)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var targetGroupARN string
+	if loadBalancingEnabled(&ctx.config.CloudConfig) && ctx.config.RunConfig.DryRun {
+		p.dryRunTargetGroup(ctx)
+	} else if loadBalancingEnabled(&ctx.config.CloudConfig) {
+		targetGroupARN, err = p.ensureTargetGroup(ctx, subnet)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Create tags to assign to the instance
-	tags, tagInstanceName := parseToAWSTags(ctx.config.RunConfig.Tags, imgName+"-"+strconv.Itoa(int(time.Now().Unix())))
+	tags, nameTemplate := parseToAWSTags(ctx.config.RunConfig.Tags, imgName+"-"+strconv.Itoa(int(time.Now().Unix())))
+	tags = withDefaultTags(ctx.config, withProjectTag(ctx.config, withRoleTag(ctx.config, withDeployIDTag(ctx, tags))))
+
+	ctx.logger.Log("Deploy id %s", ctx.DeployID())
+
+	if count > 1 && !strings.Contains(nameTemplate, instanceIndexPlaceholder) {
+		nameTemplate += "-" + instanceIndexPlaceholder
+	}
+
+	nameTemplate, err = p.uniqueInstanceNameTemplate(ctx, svc, nameTemplate, count)
+	if err != nil {
+		return nil, err
+	}
+
+	tagInstanceName := instanceName(nameTemplate, 1)
+	tags = withAWSNameTag(tags, tagInstanceName)
+
+	encodedUserData, err := p.instanceUserData(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	// Specify the details of the instance that you want to create.
-	runResult, err := svc.RunInstances(&ec2.RunInstancesInput{
+	runInput := &ec2.RunInstancesInput{
 		ImageId:      aws.String(ami),
 		InstanceType: aws.String(ctx.config.CloudConfig.Flavor),
-		MinCount:     aws.Int64(1),
-		MaxCount:     aws.Int64(1),
+		MinCount:     aws.Int64(int64(count)),
+		MaxCount:     aws.Int64(int64(count)),
 		SubnetId:     aws.String(*subnet.SubnetId),
-		SecurityGroupIds: []*string{
-			aws.String(sg),
-		},
 		TagSpecifications: []*ec2.TagSpecification{
-			{ResourceType: aws.String("instance"), Tags: tags},
+			{ResourceType: aws.String("instance"), Tags: append(append([]*ec2.Tag{}, tags...), p.runConfigTags(ctx)...)},
 			{ResourceType: aws.String("volume"), Tags: tags},
 		},
-	})
+		BlockDeviceMappings: p.instanceRootDevice(ctx.config),
+		UserData:            encodedUserData,
+		MetadataOptions:     metadataOptions,
+	}
+
+	// the security group of a dry run doesn't exist, the default one is checked
+	if sg != "" {
+		runInput.SecurityGroupIds = aws.StringSlice([]string{sg})
+	}
+
+	if ctx.config.RunConfig.TerminationProtection {
+		runInput.DisableApiTermination = aws.Bool(true)
+	}
+
+	if ctx.config.RunConfig.ShutdownBehavior != "" {
+		runInput.InstanceInitiatedShutdownBehavior = aws.String(ctx.config.RunConfig.ShutdownBehavior)
+	}
+
+	if ctx.config.RunConfig.EnableIPv6 {
+		runInput.Ipv6AddressCount = aws.Int64(1)
+	}
 
+	runInput.Placement, err = p.instancePlacement(ctx, svc)
 	if err != nil {
-		fmt.Println("Could not create instance", err)
-		return err
+		return nil, err
 	}
 
-	fmt.Println("Created instance", *runResult.Instances[0].InstanceId)
+	if ctx.config.RunConfig.LaunchTemplate != "" {
+		err = p.applyLaunchTemplate(ctx, svc, runInput, flavorSet)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// create dns zones/records to associate DNS record to instance IP
-	if ctx.config.RunConfig.DomainName != "" {
-		pollCount := 60
-		for pollCount > 0 {
-			fmt.Printf(".")
-			time.Sleep(2 * time.Second)
+	if runInput.InstanceType != nil {
+		err = p.validateFlavor(ctx, svc, aws.StringValue(runInput.InstanceType), ami)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ctx.config.RunConfig.DryRun {
+		runInput.DryRun = aws.Bool(true)
+		_, err = svc.RunInstances(runInput)
+		return nil, dryRunRequest(err, "would create %d instances of %s from %s in subnet %s named %s with tags %s",
+			count, aws.StringValue(runInput.InstanceType), ami, aws.StringValue(subnet.SubnetId),
+			strings.Join(instanceNames(nameTemplate, count), ", "), awsTagsString(tags))
+	}
 
-			instance, err := p.GetInstanceByID(ctx, tagInstanceName)
+	// launches failing for lack of capacity in the zone of the subnet are
+	// retried in the other zones of the vpc unless the config pins the zone
+	subnets := map[string]*ec2.Subnet{aws.StringValue(subnet.AvailabilityZone): subnet}
+	var otherZones func() ([]string, error)
+	if zoneMovable(ctx.config) {
+		otherZones = func() ([]string, error) {
+			return p.otherZoneSubnets(svc, subnet, subnets, ctx.config.RunConfig.EnableIPv6)
+		}
+	}
+
+	var runResult *ec2.Reservation
+	_, err = retryInZones(ctx, aws.StringValue(subnet.AvailabilityZone), otherZones, awsCapacityExhausted, func(zone string) error {
+		var launchErr error
+		runInput.SubnetId = subnets[zone].SubnetId
+		runResult, launchErr = svc.RunInstances(runInput)
+		return launchErr
+	})
+	if err != nil {
+		ctx.logger.Error("could not create instance: %v", err)
+		return nil, err
+	}
+
+	var ids []string
+	for i, instance := range runResult.Instances {
+		name := instanceName(nameTemplate, i+1)
+		instanceTags := withAWSNameTag(tags, name)
+
+		// every instance is launched with the first name, the volumes keep it
+		if name != tagInstanceName {
+			_, err = svc.CreateTags(&ec2.CreateTagsInput{
+				Resources: []*string{instance.InstanceId},
+				Tags:      []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(name)}},
+			})
 			if err != nil {
-				pollCount--
-				continue
+				return ids, fmt.Errorf("name instance %s: %v", aws.StringValue(instance.InstanceId), err)
 			}
+		}
 
-			if len(instance.PublicIps) != 0 {
-				err := CreateDNSRecord(ctx.config, instance.PublicIps[0], p)
-				if err != nil {
-					return err
-				}
+		ctx.logger.Log("Created instance %s (%s)", aws.StringValue(instance.InstanceId), name)
+		ids = append(ids, aws.StringValue(instance.InstanceId))
+		ctx.recordCreated("instance", aws.StringValue(instance.InstanceId))
+		ctx.recordInstanceCost(aws.StringValue(instance.InstanceType), 1)
+
+		if ctx.config.CloudConfig.FlowLogDestination != "" {
+			err = p.createFlowLogs(ctx, svc, instance, instanceTags)
+			if err != nil {
+				return ids, err
 			}
-			return nil
 		}
-		return fmt.Errorf("\nOperation timed out. No of tries %d", pollCount)
 	}
 
-	return nil
+	if ctx.config.RunConfig.Async {
+		ctx.logger.Log("Run ops deploy wait %s to wait for the instances", strings.Join(ids, " "))
+		return ids, nil
+	}
+
+	if ctx.config.RunConfig.Wait {
+		err = WaitInstancesReady(ctx, p, ids)
+		if err != nil {
+			return ids, err
+		}
+	}
+
+	if ctx.config.RunConfig.ReadyMarker != "" {
+		err = p.waitInstancesReady(ctx, svc, ids)
+		if err != nil {
+			return ids, err
+		}
+	}
+
+	if targetGroupARN != "" {
+		err = p.registerTargets(ctx, svc, targetGroupARN, ids)
+		if err != nil {
+			return ids, err
+		}
+	}
+
+	if serviceDiscoveryEnabled(ctx.config) {
+		err = p.registerServices(ctx, svc, ids)
+		if err != nil {
+			return ids, err
+		}
+	}
+
+	// create dns zones/records to associate DNS record to instance IP
+	if hasDomainNames(ctx.config) {
+		domain := strings.Join(domainNames(ctx.config), ",")
+		ctx.progress(ProgressDNS, domain, ProgressStarted, ProgressUnknown, "waiting for the address of instance %s", ids[0])
+
+		var values []string
+		err = waitUntil(dnsAddressTimeout, waitPollInterval, func() (bool, error) {
+			instance, err := p.describeInstance(svc, ids[0])
+			if err != nil {
+				return false, nil
+			}
+
+			values, err = awsDNSRecordValues(ctx.config, instance)
+			return len(values) != 0, err
+		})
+		if err != nil {
+			ctx.progress(ProgressDNS, domain, ProgressFailed, ProgressUnknown, "no address assigned to instance %s", ids[0])
+			return ids, fmt.Errorf("address of instance %s: %v", ids[0], err)
+		}
+
+		err = CreateDNSRecords(ctx.config, values, p)
+		if err != nil {
+			ctx.progress(ProgressDNS, domain, ProgressFailed, ProgressUnknown, "%v", err)
+			return ids, err
+		}
+		ctx.progress(ProgressDNS, domain, ProgressDone, 100, "pointed to %s", strings.Join(values, ", "))
+		return ids, p.tagDomainName(svc, ids, domainNames(ctx.config))
+	}
+
+	return ids, nil
 }
 
 // CheckValidSecurityGroup checks whether the configuration security group exists and has the configuration VPC assigned
@@ -670,17 +1429,31 @@ func (p *AWS) GetSubnet(ctx *Context, svc *ec2.EC2, vpcID string) (*ec2.Subnet,
 		filters = append(filters, &ec2.Filter{Name: aws.String("subnet-id"), Values: aws.StringSlice([]string{ctx.config.RunConfig.Subnet})})
 	}
 
+	outpostARN := ctx.config.CloudConfig.OutpostARN
+	if outpostARN != "" {
+		filters = append(filters, &ec2.Filter{Name: aws.String("outpost-arn"), Values: aws.StringSlice([]string{outpostARN})})
+	}
+
+	availabilityZone := ctx.config.CloudConfig.AvailabilityZone
+	if availabilityZone != "" {
+		filters = append(filters, &ec2.Filter{Name: aws.String("availability-zone"), Values: aws.StringSlice([]string{availabilityZone})})
+	}
+
 	input := &ec2.DescribeSubnetsInput{
 		Filters: filters,
 	}
 
 	result, err := svc.DescribeSubnets(input)
 	if err != nil {
-		fmt.Printf("Unable to describe subnets, %v\n", err)
+		ctx.logger.Error("unable to describe subnets: %v", err)
 		return nil, err
 	}
 
-	if len(result.Subnets) == 0 && subnetName != "" {
+	if len(result.Subnets) == 0 && outpostARN != "" {
+		return nil, fmt.Errorf("No Subnets found in outpost '%v'", outpostARN)
+	} else if len(result.Subnets) == 0 && availabilityZone != "" {
+		return nil, fmt.Errorf("No Subnets found in zone '%v'", availabilityZone)
+	} else if len(result.Subnets) == 0 && subnetName != "" {
 		return nil, fmt.Errorf("No Subnets with name '%v' found to associate security group with", subnetName)
 	} else if len(result.Subnets) == 0 {
 		return nil, errors.New("No Subnets found to associate security group with")
@@ -717,8 +1490,14 @@ func (p *AWS) GetVPC(ctx *Context, svc *ec2.EC2) (*ec2.Vpc, error) {
 	}
 	if len(result.Vpcs) == 0 && vpcName != "" {
 		return nil, fmt.Errorf("No VPCs with name '%v' found to associate security group with", vpcName)
+	} else if len(result.Vpcs) == 0 && ctx.config.RunConfig.CreateNetwork {
+		if ctx.config.RunConfig.DryRun {
+			dryRunf("would create network %s with vpc %s and subnet %s", awsNetworkName, awsNetworkCIDR, awsNetworkSubnetCIDR)
+			return nil, nil
+		}
+		return p.createNetwork(ctx, svc)
 	} else if len(result.Vpcs) == 0 {
-		return nil, errors.New("No VPCs found to associate security group with")
+		return nil, errors.New("No VPCs found to associate security group with, enable CreateNetwork to create one")
 	}
 
 	if vpcName != "" {
@@ -741,16 +1520,64 @@ func (p *AWS) GetVPC(ctx *Context, svc *ec2.EC2) (*ec2.Vpc, error) {
 	return vpc, nil
 }
 
-func (p AWS) buildFirewallRule(protocol string, port int) *ec2.IpPermission {
-	var ec2Permission = new(ec2.IpPermission)
-	ec2Permission.SetIpProtocol(protocol)
-	ec2Permission.SetFromPort(int64(port))
-	ec2Permission.SetToPort(int64(port))
-	ec2Permission.SetIpRanges([]*ec2.IpRange{
-		{CidrIp: aws.String("0.0.0.0/0")},
-	})
+func (p AWS) buildFirewallRule(protocol string, fromPort int, toPort int, sources []string) *ec2.IpPermission {
+	var ec2Permission = new(ec2.IpPermission)
+	ec2Permission.SetIpProtocol(protocol)
+	ec2Permission.SetFromPort(int64(fromPort))
+	ec2Permission.SetToPort(int64(toPort))
+
+	ipv4, ipv6 := sourcesByFamily(sources)
+
+	var ipRanges []*ec2.IpRange
+	for _, source := range ipv4 {
+		ipRanges = append(ipRanges, &ec2.IpRange{CidrIp: aws.String(source)})
+	}
+
+	var ipv6Ranges []*ec2.Ipv6Range
+	for _, source := range ipv6 {
+		ipv6Ranges = append(ipv6Ranges, &ec2.Ipv6Range{CidrIpv6: aws.String(source)})
+	}
+
+	if len(ipRanges) != 0 {
+		ec2Permission.SetIpRanges(ipRanges)
+	}
+	if len(ipv6Ranges) != 0 {
+		ec2Permission.SetIpv6Ranges(ipv6Ranges)
+	}
+
+	return ec2Permission
+}
+
+// securityGroupRules returns the ingress rules of the security group created
+// for instances, opening the ports of the run config
+func (p *AWS) securityGroupRules(ctx *Context) ([]*ec2.IpPermission, error) {
+	var ec2Permissions []*ec2.IpPermission
+
+	sources := allowedSources(ctx.config)
+	if ctx.config.RunConfig.EnableIPv6 && len(ctx.config.RunConfig.AllowedIPs) == 0 {
+		sources = append(sources, "::/0")
+	}
+
+	for _, port := range ctx.config.RunConfig.Ports {
+		rule := p.buildFirewallRule("tcp", port, port, sources)
+		ec2Permissions = append(ec2Permissions, rule)
+	}
+
+	for _, portRange := range ctx.config.RunConfig.PortRanges {
+		from, to, err := ParsePortRange(portRange)
+		if err != nil {
+			return nil, err
+		}
+		rule := p.buildFirewallRule("tcp", from, to, sources)
+		ec2Permissions = append(ec2Permissions, rule)
+	}
+
+	for _, port := range ctx.config.RunConfig.UDPPorts {
+		rule := p.buildFirewallRule("udp", port, port, sources)
+		ec2Permissions = append(ec2Permissions, rule)
+	}
 
-	return ec2Permission
+	return ec2Permissions, nil
 }
 
 // CreateSG - Create security group
@@ -764,6 +1591,9 @@ func (p *AWS) CreateSG(ctx *Context, svc *ec2.EC2, imgName string, vpcID string)
 		GroupName:   aws.String(sgName),
 		Description: aws.String("security group for " + imgName),
 		VpcId:       aws.String(vpcID),
+		TagSpecifications: []*ec2.TagSpecification{
+			{ResourceType: aws.String("security-group"), Tags: withDefaultTags(ctx.config, withProjectTag(ctx.config, withRoleTag(ctx.config, withDeployIDTag(ctx, getAWSDefaultTags()))))},
+		},
 	})
 	if err != nil {
 		if aerr, ok := err.(awserr.Error); ok {
@@ -780,19 +1610,13 @@ func (p *AWS) CreateSG(ctx *Context, svc *ec2.EC2, imgName string, vpcID string)
 		return "", errors.New(errstr)
 
 	}
-	fmt.Printf("Created security group %s with VPC %s.\n",
+	ctx.logger.Log("Created security group %s with VPC %s.",
 		aws.StringValue(createRes.GroupId), vpcID)
+	ctx.recordCreated("security group", aws.StringValue(createRes.GroupId))
 
-	var ec2Permissions []*ec2.IpPermission
-
-	for _, port := range ctx.config.RunConfig.Ports {
-		rule := p.buildFirewallRule("tcp", port)
-		ec2Permissions = append(ec2Permissions, rule)
-	}
-
-	for _, port := range ctx.config.RunConfig.UDPPorts {
-		rule := p.buildFirewallRule("udp", port)
-		ec2Permissions = append(ec2Permissions, rule)
+	ec2Permissions, err := p.securityGroupRules(ctx)
+	if err != nil {
+		return "", err
 	}
 
 	// maybe have these ports specified from config.json in near future
@@ -807,29 +1631,173 @@ func (p *AWS) CreateSG(ctx *Context, svc *ec2.EC2, imgName string, vpcID string)
 		}
 	}
 
+	if len(ctx.config.RunConfig.RoleRules) > 0 {
+		err = p.authorizeRoleRules(ctx, svc, aws.StringValue(createRes.GroupId), vpcID)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	return aws.StringValue(createRes.GroupId), nil
 }
 
-// GetInstanceByID returns the instance with the id passed by argument if it exists
+// GetInstanceByID returns the instance with the id passed by argument if it
+// exists. Ids that aren't instance ids, or match no instance, are looked up
+// as instance names
 func (p *AWS) GetInstanceByID(ctx *Context, id string) (*CloudInstance, error) {
-	var filters []*ec2.Filter
+	if isAWSInstanceID(id) {
+		filters := []*ec2.Filter{
+			{Name: aws.String("instance-id"), Values: aws.StringSlice([]string{id})},
+		}
+
+		instances, err := getAWSInstances(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone, filters)
+		if err != nil {
+			return nil, err
+		}
+		if len(instances) != 0 {
+			return &instances[0], nil
+		}
+	}
+
+	return p.GetInstanceByName(ctx, id)
+}
 
-	filters = append(filters, &ec2.Filter{Name: aws.String("tag:Name"), Values: aws.StringSlice([]string{id})})
+// GetInstanceByName returns the instance with the Name tag passed by argument
+// if it exists
+func (p *AWS) GetInstanceByName(ctx *Context, name string) (*CloudInstance, error) {
+	filters := []*ec2.Filter{
+		{Name: aws.String("tag:Name"), Values: aws.StringSlice([]string{name})},
+	}
 
-	instances := getAWSInstances(ctx.config.CloudConfig.Zone, filters)
+	instances, err := getAWSInstances(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone, filters)
+	if err != nil {
+		return nil, err
+	}
 
 	if len(instances) == 0 {
-		return nil, ErrInstanceNotFound(id)
+		return nil, ErrInstanceNotFound(name)
 	}
 
 	return &instances[0], nil
 }
 
+// isAWSInstanceID returns true if id has the format of an ec2 instance id,
+// i- followed by 8 or 17 hexadecimal digits
+func isAWSInstanceID(id string) bool {
+	if !strings.HasPrefix(id, "i-") {
+		return false
+	}
+
+	digits := id[len("i-"):]
+	if len(digits) != 8 && len(digits) != 17 {
+		return false
+	}
+
+	for _, r := range digits {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+
+	return true
+}
+
 // GetInstances return all instances on AWS
 func (p *AWS) GetInstances(ctx *Context) ([]CloudInstance, error) {
-	cinstances := getAWSInstances(ctx.config.CloudConfig.Zone, nil)
+	return getAWSInstances(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone, awsInstanceFilters(ctx))
+}
 
-	return cinstances, nil
+// EachInstancePage calls fn with the pages of the instances
+func (p *AWS) EachInstancePage(ctx *Context, fn InstancePageFunc) error {
+	svc, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	return eachAWSInstancePage(svc, awsInstanceFilters(ctx), fn)
+}
+
+// awsInstanceFilters returns the ec2 filters of the instances matching the
+// list filters of the config. Instances aren't filtered by the CreatedBy tag,
+// those created by ops before it was tagged have none
+func awsInstanceFilters(ctx *Context) []*ec2.Filter {
+	return toAWSFilters(ctx.config.RunConfig.Filters, "instance-state-name")
+}
+
+// toAWSFilters converts list filters to ec2 filters, the status key is
+// converted to the statusFilter of the resource and other keys to tags
+func toAWSFilters(filters []ListFilter, statusFilter string) []*ec2.Filter {
+	var ec2Filters []*ec2.Filter
+
+	for _, filter := range filters {
+		name := "tag:" + filter.Key
+		if filter.Key == "status" {
+			name = statusFilter
+		}
+
+		ec2Filters = append(ec2Filters, &ec2.Filter{
+			Name:   aws.String(name),
+			Values: aws.StringSlice([]string{filter.Value}),
+		})
+	}
+
+	return ec2Filters
+}
+
+// AdoptInstance tags an instance created outside of ops so it is managed by
+// ops. The instance Name tag is replaced if name is not empty
+func (p *AWS) AdoptInstance(ctx *Context, instanceID string, name string) error {
+	svc, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	return adoptInstance(ctx, svc, instanceID, name)
+}
+
+func adoptInstance(ctx *Context, svc *ec2.EC2, instanceID string, name string) error {
+	result, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice([]string{instanceID}),
+	})
+	if err != nil {
+		return fmt.Errorf("describe instance %s: %v", instanceID, err)
+	}
+
+	if len(result.Reservations) == 0 || len(result.Reservations[0].Instances) == 0 {
+		return ErrInstanceNotFound(instanceID)
+	}
+
+	instance := result.Reservations[0].Instances[0]
+
+	for _, tag := range instance.Tags {
+		if aws.StringValue(tag.Key) == "CreatedBy" && aws.StringValue(tag.Value) == "ops" {
+			return fmt.Errorf("instance %s is already managed by ops", instanceID)
+		}
+	}
+
+	resources := []*string{instance.InstanceId}
+	for _, mapping := range instance.BlockDeviceMappings {
+		if mapping.Ebs != nil {
+			resources = append(resources, mapping.Ebs.VolumeId)
+		}
+	}
+
+	tags := getAWSDefaultTags()
+	if name != "" {
+		tags = append(tags, &ec2.Tag{Key: aws.String("Name"), Value: aws.String(name)})
+	}
+
+	_, err = svc.CreateTags(&ec2.CreateTagsInput{
+		Resources: resources,
+		Tags:      withDefaultTags(ctx.config, tags),
+	})
+	if err != nil {
+		return fmt.Errorf("tag instance %s: %v", instanceID, err)
+	}
+
+	ctx.logger.Log("Adopted instance %s", instanceID)
+
+	return nil
 }
 
 // ListInstances lists instances on AWS
@@ -838,15 +1806,42 @@ func (p *AWS) ListInstances(ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	sortInstancesByCreated(instances)
+
+	// accelerators are only looked up for gpu and other accelerated families
+	var flavors []string
+	for _, instance := range instances {
+		flavors = append(flavors, instance.Flavor)
+	}
+
+	// the accelerators and events are extra details, listing the instances
+	// doesn't require the permissions to describe them
+	accelerators := map[string]string{}
+	events := map[string][]InstanceEvent{}
+	if svc, err := p.getEc2Service(ctx.config); err == nil {
+		if described, err := instanceTypeAccelerators(svc, flavors); err == nil {
+			accelerators = described
+		} else {
+			ctx.logger.Warn("unable to describe the accelerators of the instances: %v", err)
+		}
+
+		if scheduled, err := scheduledEvents(svc, cloudInstanceIDs(instances)); err == nil {
+			events = scheduled
+		} else {
+			ctx.logger.Warn("unable to describe the scheduled events of the instances: %v", err)
+		}
+	}
 
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Name", "Id", "Status", "Created", "Private Ips", "Public Ips"})
+	table.SetHeader([]string{"Name", "Id", "Status", "Created", "Type", "Private Ips", "Public Ips", "IPv6"})
 	table.SetHeaderColor(
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
 	table.SetRowLine(true)
 
@@ -857,31 +1852,131 @@ func (p *AWS) ListInstances(ctx *Context) error {
 		rows = append(rows, instance.Name)
 		rows = append(rows, instance.ID)
 
-		rows = append(rows, instance.Status)
-		rows = append(rows, instance.Created)
+		status := instance.Status
+		if len(events[instance.ID]) > 0 {
+			status += " (scheduled " + events[instance.ID][0].Code + ")"
+		}
+		rows = append(rows, status)
+		rows = append(rows, FormatTimestamp(instance.Created, ctx.config.RunConfig.TimeFormat))
+
+		flavor := instance.Flavor
+		if accelerators[flavor] != "" {
+			flavor += " (" + accelerators[flavor] + ")"
+		}
+		rows = append(rows, flavor)
 
 		rows = append(rows, strings.Join(instance.PrivateIps, ","))
 		rows = append(rows, strings.Join(instance.PublicIps, ","))
+		rows = append(rows, strings.Join(instance.Ipv6Addresses, ","))
 
 		table.Append(rows)
 	}
 
 	table.Render()
 
+	printEventWarnings(ctx.logger, events, cloudInstanceIDs(instances))
+
 	return nil
 }
 
 // DeleteInstance deletes instance from AWS
 func (p *AWS) DeleteInstance(ctx *Context, instancename string) error {
-	svc, err := session.NewSession(&aws.Config{
-		Region: aws.String(ctx.config.CloudConfig.Zone)},
-	)
-	compute := ec2.New(svc)
+	return p.DeleteInstances(ctx, []string{instancename})
+}
+
+// DeleteInstances terminates the instances with the ids passed by argument in
+// a single request and deletes the security groups ops created for them
+func (p *AWS) DeleteInstances(ctx *Context, instanceIDs []string) error {
+	if len(instanceIDs) == 0 {
+		return errors.New("Enter Instance ID")
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	protected, err := p.protectedInstances(compute, instanceIDs)
+	if err != nil {
+		return err
+	}
+
+	return p.deleteInstances(ctx, compute, instanceIDs, protected)
+}
+
+// DeleteCheckedInstances deletes the instances like DeleteInstances without
+// describing their termination protection again, protected being the ones
+// returned by ProtectedInstances
+func (p *AWS) DeleteCheckedInstances(ctx *Context, instanceIDs []string, protected []string) error {
+	if len(instanceIDs) == 0 {
+		return errors.New("Enter Instance ID")
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	return p.deleteInstances(ctx, compute, instanceIDs, protected)
+}
+
+func (p *AWS) deleteInstances(ctx *Context, compute *ec2.EC2, instanceIDs []string, protected []string) error {
+	var err error
+	if len(protected) > 0 && !ctx.config.Force {
+		return fmt.Errorf("instances %s have termination protection, use --force to disable it", strings.Join(protected, ", "))
+	}
+
+	if ctx.config.RunConfig.DryRun {
+		return p.dryRunDeleteInstances(ctx, compute, instanceIDs, protected)
+	}
+
+	for _, id := range protected {
+		err = p.setTerminationProtection(compute, id, false)
+		if err != nil {
+			return err
+		}
+		ctx.logger.Log("Disabled termination protection of instance %s", id)
+	}
+
+	var securityGroups []*string
+	seen := map[string]bool{}
+	for _, id := range instanceIDs {
+		groups, err := p.getInstanceSecurityGroups(compute, id)
+		if err != nil {
+			return err
+		}
+
+		for _, sg := range groups {
+			if !seen[aws.StringValue(sg)] {
+				seen[aws.StringValue(sg)] = true
+				securityGroups = append(securityGroups, sg)
+			}
+		}
+	}
+
+	err = p.deleteFlowLogs(ctx, compute, instanceIDs)
+	if err != nil {
+		ctx.logger.Warn("failed deleting flow logs: %v", err)
+	}
+
+	err = p.deregisterTargets(ctx, compute, instanceIDs)
+	if err != nil {
+		ctx.logger.Warn("failed deregistering instances from load balancer: %v", err)
+	}
+
+	err = p.deregisterServices(ctx, compute, instanceIDs)
+	if err != nil {
+		ctx.logger.Warn("failed deregistering instances from service discovery: %v", err)
+	}
+
+	// the types of the instances price the operation
+	types, err := p.instanceTypes(compute, instanceIDs)
+	if err != nil {
+		ctx.logger.Warn("%v", err)
+	}
 
 	input := &ec2.TerminateInstancesInput{
-		InstanceIds: []*string{
-			aws.String(instancename),
-		},
+		InstanceIds: aws.StringSlice(instanceIDs),
 	}
 
 	_, err = compute.TerminateInstances(input)
@@ -889,19 +1984,184 @@ func (p *AWS) DeleteInstance(ctx *Context, instancename string) error {
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			default:
-				fmt.Println(aerr.Error())
+				ctx.logger.Error("%v", aerr)
 			}
 		} else {
-			fmt.Println(err.Error())
+			ctx.logger.Error("%v", err)
 		}
 		return err
 	}
 
+	for _, id := range instanceIDs {
+		ctx.recordDeleted("instance", id)
+		ctx.recordInstanceCost(types[id], -1)
+	}
+
 	// kill off any old security group as well
+	if len(securityGroups) == 0 || ctx.config.RunConfig.KeepSG {
+		return nil
+	}
+
+	ctx.logger.Log("waiting for instance termination to delete its security group")
+
+	err = compute.WaitUntilInstanceTerminated(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+	})
+	if err != nil {
+		return fmt.Errorf("wait for instances %s termination: %v", strings.Join(instanceIDs, ", "), err)
+	}
+
+	for _, sg := range securityGroups {
+		err = p.revokeRoleReferences(compute, aws.StringValue(sg))
+		if err != nil {
+			ctx.logger.Warn("%v", err)
+		}
+
+		_, err = compute.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{
+			GroupId: sg,
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "DependencyViolation" {
+				ctx.logger.Warn("security group %s still in use, not deleted", aws.StringValue(sg))
+				continue
+			}
+			return fmt.Errorf("delete security group %s: %v", aws.StringValue(sg), err)
+		}
+
+		ctx.logger.Log("Deleted security group %s", aws.StringValue(sg))
+		ctx.recordDeleted("security group", aws.StringValue(sg))
+	}
+
+	return nil
+}
+
+// ProtectedInstances returns the instances among instanceIDs with termination
+// protection enabled
+func (p *AWS) ProtectedInstances(ctx *Context, instanceIDs []string) ([]string, error) {
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.protectedInstances(compute, instanceIDs)
+}
+
+func (p *AWS) protectedInstances(compute *ec2.EC2, instanceIDs []string) ([]string, error) {
+	var protected []string
+
+	for _, id := range instanceIDs {
+		result, err := compute.DescribeInstanceAttribute(&ec2.DescribeInstanceAttributeInput{
+			InstanceId: aws.String(id),
+			Attribute:  aws.String(ec2.InstanceAttributeNameDisableApiTermination),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe instance %s termination protection: %v", id, err)
+		}
+
+		if result.DisableApiTermination != nil && aws.BoolValue(result.DisableApiTermination.Value) {
+			protected = append(protected, id)
+		}
+	}
+
+	return protected, nil
+}
+
+// setTerminationProtection enables or disables the termination protection of
+// the instance
+func (p *AWS) setTerminationProtection(compute *ec2.EC2, instanceID string, enabled bool) error {
+	_, err := compute.ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+		InstanceId:            aws.String(instanceID),
+		DisableApiTermination: &ec2.AttributeBooleanValue{Value: aws.Bool(enabled)},
+	})
+	if err != nil {
+		return fmt.Errorf("set instance %s termination protection: %v", instanceID, err)
+	}
 
 	return nil
 }
 
+// FindInstanceIDs returns the ids of the instances managed by ops with tags
+// matching all filters. Filter values may contain * wildcards
+func (p *AWS) FindInstanceIDs(ctx *Context, filters []ListFilter) ([]string, error) {
+	ec2Filters := []*ec2.Filter{
+		{Name: aws.String("tag:CreatedBy"), Values: aws.StringSlice([]string{"ops"})},
+		{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+	}
+
+	ec2Filters = append(ec2Filters, toAWSFilters(filters, "instance-state-name")...)
+
+	instances, err := getAWSInstances(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone, ec2Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, instance := range instances {
+		ids = append(ids, instance.ID)
+	}
+
+	return ids, nil
+}
+
+// instanceTypes returns the types of the instances by id
+func (p *AWS) instanceTypes(compute *ec2.EC2, instanceIDs []string) (map[string]string, error) {
+	result, err := compute.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe types of instances %s: %v", strings.Join(instanceIDs, ", "), err)
+	}
+
+	types := map[string]string{}
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			types[aws.StringValue(instance.InstanceId)] = aws.StringValue(instance.InstanceType)
+		}
+	}
+	return types, nil
+}
+
+// getInstanceSecurityGroups returns the ids of the security groups created
+// by ops attached to the instance
+func (p *AWS) getInstanceSecurityGroups(compute *ec2.EC2, instanceID string) ([]*string, error) {
+	result, err := compute.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice([]string{instanceID}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groupIDs []*string
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			for _, group := range instance.SecurityGroups {
+				groupIDs = append(groupIDs, group.GroupId)
+			}
+		}
+	}
+
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+
+	sgs, err := compute.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		GroupIds: groupIDs,
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:CreatedBy"), Values: aws.StringSlice([]string{"ops"})},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var opsGroupIDs []*string
+	for _, sg := range sgs.SecurityGroups {
+		opsGroupIDs = append(opsGroupIDs, sg.GroupId)
+	}
+
+	return opsGroupIDs, nil
+}
+
 // PrintInstanceLogs writes instance logs to console
 func (p *AWS) PrintInstanceLogs(ctx *Context, instancename string, watch bool) error {
 	l, err := p.GetInstanceLogs(ctx, instancename)
@@ -914,9 +2174,7 @@ func (p *AWS) PrintInstanceLogs(ctx *Context, instancename string, watch bool) e
 
 // GetInstanceLogs gets instance related logs
 func (p *AWS) GetInstanceLogs(ctx *Context, instancename string) (string, error) {
-	svc, err := session.NewSession(&aws.Config{
-		Region: aws.String(ctx.config.CloudConfig.Zone)},
-	)
+	svc, err := newAWSSession(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone)
 	compute := ec2.New(svc)
 
 	// latest set to true is only avail on nitro (c5) instances
@@ -930,10 +2188,10 @@ func (p *AWS) GetInstanceLogs(ctx *Context, instancename string) (string, error)
 		if aerr, ok := err.(awserr.Error); ok {
 			switch aerr.Code() {
 			default:
-				fmt.Println(aerr.Error())
+				ctx.logger.Error("%v", aerr)
 			}
 		} else {
-			fmt.Println(err.Error())
+			ctx.logger.Error("%v", err)
 		}
 		return "", err
 	}
@@ -965,16 +2223,11 @@ func (p *AWS) GetStorage() Storage {
 }
 
 func (p *AWS) getAWSSession(config *Config) (*session.Session, error) {
-	return session.NewSession(
-		&aws.Config{
-			Region: aws.String(config.CloudConfig.Zone)},
-	)
+	return newAWSSession(&config.CloudConfig, config.CloudConfig.Zone)
 }
 
 func (p *AWS) getEc2Service(config *Config) (*ec2.EC2, error) {
-	svc, err := session.NewSession(&aws.Config{
-		Region: aws.String(config.CloudConfig.Zone)},
-	)
+	svc, err := newAWSSession(&config.CloudConfig, config.CloudConfig.Zone)
 	if err != nil {
 		return nil, err
 	}
@@ -982,8 +2235,10 @@ func (p *AWS) getEc2Service(config *Config) (*ec2.EC2, error) {
 	return ec2.New(svc), nil
 }
 
-func (p *AWS) waitSnapshotToBeReady(config *Config, importTaskID *string) (*string, error) {
-	compute, err := p.getEc2Service(config)
+// waitSnapshotToBeReady waits for the snapshot import task and returns the
+// id of the imported snapshot, reporting the progress of the import
+func (p *AWS) waitSnapshotToBeReady(ctx *Context, importTaskID *string) (*string, error) {
+	compute, err := p.getEc2Service(ctx.config)
 	if err != nil {
 		return nil, err
 	}
@@ -997,7 +2252,10 @@ func (p *AWS) waitSnapshotToBeReady(config *Config, importTaskID *string) (*stri
 		return nil, err
 	}
 
-	fmt.Println("waiting for snapshot - can take like 5min.... ")
+	ctx.logger.Log("waiting for snapshot - can take like 5min.... ")
+
+	id := aws.StringValue(importTaskID)
+	ctx.progress(ProgressSnapshotImport, id, ProgressStarted, ProgressUnknown, "")
 
 	waitStartTime := time.Now()
 
@@ -1030,12 +2288,28 @@ func (p *AWS) waitSnapshotToBeReady(config *Config, importTaskID *string) (*stri
 			req, _ := compute.DescribeImportSnapshotTasksRequest(taskFilter)
 			req.SetContext(ct)
 			req.ApplyOptions(opts...)
+			req.Handlers.Complete.PushBack(func(r *request.Request) {
+				output, ok := r.Data.(*ec2.DescribeImportSnapshotTasksOutput)
+				if !ok || r.Error != nil {
+					return
+				}
+				for _, task := range output.ImportSnapshotTasks {
+					if detail := task.SnapshotTaskDetail; detail != nil && aws.StringValue(detail.Status) == "active" {
+						ctx.progress(ProgressSnapshotImport, id, ProgressRunning, importProgress(detail), "%s", aws.StringValue(detail.StatusMessage))
+					}
+				}
+			})
 			return req, nil
 		},
 	}
-	w.WaitWithContext(ct)
+	err = w.WaitWithContext(ct)
+	if err != nil {
+		ctx.progress(ProgressSnapshotImport, id, ProgressFailed, ProgressUnknown, "%v", err)
+		return nil, fmt.Errorf("wait for snapshot import %s: %v", id, err)
+	}
 
-	fmt.Printf("import done - took %f minutes\n", time.Since(waitStartTime).Minutes())
+	ctx.progress(ProgressSnapshotImport, id, ProgressDone, 100, "")
+	ctx.logger.Log("import done - took %f minutes", time.Since(waitStartTime).Minutes())
 
 	describeOutput, err := compute.DescribeImportSnapshotTasks(taskFilter)
 	if err != nil {
@@ -1046,3 +2320,13 @@ func (p *AWS) waitSnapshotToBeReady(config *Config, importTaskID *string) (*stri
 
 	return snapshotID, nil
 }
+
+// importProgress returns the percent done of a snapshot import, -1 if aws
+// doesn't report it
+func importProgress(detail *ec2.SnapshotTaskDetail) int {
+	percent, err := strconv.Atoi(aws.StringValue(detail.Progress))
+	if err != nil {
+		return ProgressUnknown
+	}
+	return percent
+}
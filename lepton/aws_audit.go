@@ -0,0 +1,190 @@
+package lepton
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/olekukonko/tablewriter"
+)
+
+// InstanceSecurityReport describes how exposed an instance is
+type InstanceSecurityReport struct {
+	InstanceID       string
+	Name             string
+	PublicIP         string
+	IMDSVersion      string
+	EncryptedVolumes bool
+	Rules            []string
+	Risks            []string
+}
+
+// isWebPort returns true for ports expected to be open to the world
+func isWebPort(from int64, to int64) bool {
+	return from == to && (from == 80 || from == 443)
+}
+
+// AuditInstances reports the exposure of every instance managed by ops
+func (p *AWS) AuditInstances(ctx *Context) ([]InstanceSecurityReport, error) {
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := compute.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:CreatedBy"), Values: aws.StringSlice([]string{"ops"})},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var reports []InstanceSecurityReport
+
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			report, err := p.auditInstance(compute, instance)
+			if err != nil {
+				return nil, err
+			}
+			reports = append(reports, *report)
+		}
+	}
+
+	return reports, nil
+}
+
+func (p *AWS) auditInstance(compute *ec2.EC2, instance *ec2.Instance) (*InstanceSecurityReport, error) {
+	cinstance := formalizeAWSInstance(instance)
+
+	report := &InstanceSecurityReport{
+		InstanceID:       cinstance.ID,
+		Name:             cinstance.Name,
+		IMDSVersion:      "v1",
+		EncryptedVolumes: true,
+	}
+
+	if len(cinstance.PublicIps) != 0 {
+		report.PublicIP = cinstance.PublicIps[0]
+	}
+
+	if instance.MetadataOptions != nil && aws.StringValue(instance.MetadataOptions.HttpTokens) == "required" {
+		report.IMDSVersion = "v2"
+	} else {
+		report.Risks = append(report.Risks, "IMDSv1 enabled")
+	}
+
+	var groupIDs []*string
+	for _, group := range instance.SecurityGroups {
+		groupIDs = append(groupIDs, group.GroupId)
+	}
+
+	if len(groupIDs) != 0 {
+		sgs, err := compute.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{GroupIds: groupIDs})
+		if err != nil {
+			return nil, fmt.Errorf("describe security groups of %s: %v", report.InstanceID, err)
+		}
+
+		for _, sg := range sgs.SecurityGroups {
+			for _, permission := range sg.IpPermissions {
+				from := aws.Int64Value(permission.FromPort)
+				to := aws.Int64Value(permission.ToPort)
+				protocol := aws.StringValue(permission.IpProtocol)
+
+				ports := fmt.Sprintf("%d", from)
+				if from != to {
+					ports = fmt.Sprintf("%d-%d", from, to)
+				}
+				if protocol == "-1" {
+					protocol = "all"
+					ports = "all"
+				}
+
+				var sources []string
+				for _, r := range permission.IpRanges {
+					sources = append(sources, aws.StringValue(r.CidrIp))
+				}
+				for _, r := range permission.Ipv6Ranges {
+					sources = append(sources, aws.StringValue(r.CidrIpv6))
+				}
+
+				for _, source := range sources {
+					report.Rules = append(report.Rules, fmt.Sprintf("%s/%s from %s", protocol, ports, source))
+
+					if (source == "0.0.0.0/0" || source == "::/0") && (protocol == "all" || !isWebPort(from, to)) {
+						report.Risks = append(report.Risks, fmt.Sprintf("%s/%s open to the world", protocol, ports))
+					}
+				}
+			}
+		}
+	}
+
+	var volumeIDs []*string
+	for _, mapping := range instance.BlockDeviceMappings {
+		if mapping.Ebs != nil {
+			volumeIDs = append(volumeIDs, mapping.Ebs.VolumeId)
+		}
+	}
+
+	if len(volumeIDs) != 0 {
+		volumes, err := compute.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: volumeIDs})
+		if err != nil {
+			return nil, fmt.Errorf("describe volumes of %s: %v", report.InstanceID, err)
+		}
+
+		for _, volume := range volumes.Volumes {
+			if !aws.BoolValue(volume.Encrypted) {
+				report.EncryptedVolumes = false
+				report.Risks = append(report.Risks, fmt.Sprintf("volume %s not encrypted", aws.StringValue(volume.VolumeId)))
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// PrintAuditInstances prints the security report of the instances managed by ops
+func (p *AWS) PrintAuditInstances(ctx *Context) error {
+	reports, err := p.AuditInstances(ctx)
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Name", "Id", "Public Ip", "IMDS", "Encrypted", "Rules", "Risks"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
+	table.SetRowLine(true)
+
+	for _, report := range reports {
+		var rows []string
+
+		rows = append(rows, report.Name)
+		rows = append(rows, report.InstanceID)
+		rows = append(rows, report.PublicIP)
+		rows = append(rows, report.IMDSVersion)
+		if report.EncryptedVolumes {
+			rows = append(rows, "yes")
+		} else {
+			rows = append(rows, "no")
+		}
+		rows = append(rows, strings.Join(report.Rules, "\n"))
+		rows = append(rows, strings.Join(report.Risks, "\n"))
+
+		table.Append(rows)
+	}
+
+	table.Render()
+
+	return nil
+}
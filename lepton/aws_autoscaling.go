@@ -0,0 +1,418 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsGroupScalingPolicy is the name of the target tracking policy of a group
+const awsGroupScalingPolicy = "ops-target-cpu"
+
+func (p *AWS) getAutoScalingService(config *Config) (*autoscaling.AutoScaling, error) {
+	sess, err := p.getAWSSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return autoscaling.New(sess), nil
+}
+
+// groupLaunchTemplateData returns the launch settings of the instances of the
+// group named name and the subnet they are launched in
+func (p *AWS) groupLaunchTemplateData(ctx *Context, svc *ec2.EC2, name string) (*ec2.RequestLaunchTemplateData, *ec2.Subnet, error) {
+	imgName, ref := ParseImageRef(ctx.config.CloudConfig.ImageName)
+	if ctx.config.RunConfig.ImageVersion != "" {
+		ref = ctx.config.RunConfig.ImageVersion
+	}
+
+	ami, err := p.resolveAMI(ctx, imgName, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sg, subnet, err := p.instanceNetwork(ctx, svc, imgName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userData, err := p.instanceUserData(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ctx.config.CloudConfig.Flavor == "" {
+		ctx.config.CloudConfig.Flavor = "t2.micro"
+	}
+
+	tags, _ := parseToAWSTags(ctx.config.RunConfig.Tags, name)
+	tags = withDefaultTags(ctx.config, withDeployIDTag(ctx, tags))
+
+	data := &ec2.RequestLaunchTemplateData{
+		ImageId:          aws.String(ami),
+		InstanceType:     aws.String(ctx.config.CloudConfig.Flavor),
+		SecurityGroupIds: []*string{aws.String(sg)},
+		UserData:         userData,
+		TagSpecifications: []*ec2.LaunchTemplateTagSpecificationRequest{
+			{ResourceType: aws.String("instance"), Tags: tags},
+			{ResourceType: aws.String("volume"), Tags: tags},
+		},
+	}
+
+	for _, mapping := range p.instanceRootDevice(ctx.config) {
+		data.BlockDeviceMappings = append(data.BlockDeviceMappings, &ec2.LaunchTemplateBlockDeviceMappingRequest{
+			DeviceName: mapping.DeviceName,
+			Ebs: &ec2.LaunchTemplateEbsBlockDeviceRequest{
+				Encrypted:  mapping.Ebs.Encrypted,
+				Iops:       mapping.Ebs.Iops,
+				KmsKeyId:   mapping.Ebs.KmsKeyId,
+				Throughput: mapping.Ebs.Throughput,
+				VolumeSize: mapping.Ebs.VolumeSize,
+				VolumeType: mapping.Ebs.VolumeType,
+			},
+		})
+	}
+
+	err = validateTenancy(&ctx.config.RunConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ctx.config.RunConfig.PlacementGroup != "" {
+		err = p.ensurePlacementGroup(ctx, svc, ctx.config.RunConfig.PlacementGroup)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if ctx.config.RunConfig.PlacementGroup != "" || ctx.config.RunConfig.Tenancy != "" {
+		data.Placement = &ec2.LaunchTemplatePlacementRequest{}
+		if ctx.config.RunConfig.PlacementGroup != "" {
+			data.Placement.GroupName = aws.String(ctx.config.RunConfig.PlacementGroup)
+		}
+		if ctx.config.RunConfig.Tenancy != "" {
+			data.Placement.Tenancy = aws.String(ctx.config.RunConfig.Tenancy)
+		}
+	}
+
+	metadataOptions, err := p.instanceMetadataOptions(ctx.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if metadataOptions != nil {
+		data.MetadataOptions = &ec2.LaunchTemplateInstanceMetadataOptionsRequest{
+			HttpEndpoint:            metadataOptions.HttpEndpoint,
+			HttpPutResponseHopLimit: metadataOptions.HttpPutResponseHopLimit,
+			HttpTokens:              metadataOptions.HttpTokens,
+		}
+	}
+
+	return data, subnet, nil
+}
+
+// putGroupScalingPolicy keeps the average cpu utilization of the group
+// instances at target, a target of zero removes the policy
+func (p *AWS) putGroupScalingPolicy(scaling *autoscaling.AutoScaling, name string, target float64) error {
+	if target == 0 {
+		_, err := scaling.DeletePolicy(&autoscaling.DeletePolicyInput{
+			AutoScalingGroupName: aws.String(name),
+			PolicyName:           aws.String(awsGroupScalingPolicy),
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "ValidationError" {
+			// the group has no policy
+			return nil
+		}
+		return err
+	}
+
+	_, err := scaling.PutScalingPolicy(&autoscaling.PutScalingPolicyInput{
+		AutoScalingGroupName: aws.String(name),
+		PolicyName:           aws.String(awsGroupScalingPolicy),
+		PolicyType:           aws.String("TargetTrackingScaling"),
+		TargetTrackingConfiguration: &autoscaling.TargetTrackingConfiguration{
+			PredefinedMetricSpecification: &autoscaling.PredefinedMetricSpecification{
+				PredefinedMetricType: aws.String(autoscaling.MetricTypeAsgaverageCpuutilization),
+			},
+			TargetValue: aws.Float64(target),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("put scaling policy of group %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// CreateInstanceGroup creates a launch template with the instance settings of
+// the config and an auto scaling group of instances launched from it
+func (p *AWS) CreateInstanceGroup(ctx *Context, group InstanceGroup) error {
+	err := group.validate()
+	if err != nil {
+		return err
+	}
+
+	err = p.validateVolumeConfig(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	scaling, err := p.getAutoScalingService(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	data, subnet, err := p.groupLaunchTemplateData(ctx, compute, group.Name)
+	if err != nil {
+		return err
+	}
+
+	_, err = compute.CreateLaunchTemplate(&ec2.CreateLaunchTemplateInput{
+		LaunchTemplateName: aws.String(group.Name),
+		LaunchTemplateData: data,
+		TagSpecifications: []*ec2.TagSpecification{
+			{ResourceType: aws.String("launch-template"), Tags: withDefaultTags(ctx.config, withDeployIDTag(ctx, getAWSDefaultTags()))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("create launch template %s: %v", group.Name, err)
+	}
+
+	// the template is deleted if the group isn't created, it would hold the
+	// name of the next attempt
+	deleteTemplate := func(err error) error {
+		_, deleteErr := compute.DeleteLaunchTemplate(&ec2.DeleteLaunchTemplateInput{
+			LaunchTemplateName: aws.String(group.Name),
+		})
+		if deleteErr != nil {
+			ctx.logger.Warn("delete launch template %s: %v", group.Name, deleteErr)
+		}
+		return err
+	}
+
+	desired := group.DesiredCapacity
+	if desired < 0 {
+		desired = group.MinSize
+	}
+
+	input := &autoscaling.CreateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(group.Name),
+		LaunchTemplate: &autoscaling.LaunchTemplateSpecification{
+			LaunchTemplateName: aws.String(group.Name),
+			Version:            aws.String("$Latest"),
+		},
+		MinSize:           aws.Int64(group.MinSize),
+		MaxSize:           aws.Int64(group.MaxSize),
+		DesiredCapacity:   aws.Int64(desired),
+		VPCZoneIdentifier: subnet.SubnetId,
+		Tags: []*autoscaling.Tag{
+			{Key: aws.String("CreatedBy"), Value: aws.String("ops")},
+			{Key: aws.String(awsDeployIDTag), Value: aws.String(ctx.DeployID())},
+		},
+	}
+
+	if group.HealthCheckGracePeriod > 0 {
+		input.HealthCheckGracePeriod = aws.Int64(group.HealthCheckGracePeriod)
+	}
+
+	// the group registers its instances and replaces the unhealthy targets
+	if loadBalancingEnabled(&ctx.config.CloudConfig) {
+		targetGroupARN, err := p.ensureTargetGroup(ctx, subnet)
+		if err != nil {
+			return deleteTemplate(err)
+		}
+		input.TargetGroupARNs = aws.StringSlice([]string{targetGroupARN})
+		input.HealthCheckType = aws.String("ELB")
+	}
+
+	_, err = scaling.CreateAutoScalingGroup(input)
+	if err != nil {
+		return deleteTemplate(fmt.Errorf("create auto scaling group %s: %v", group.Name, err))
+	}
+
+	if group.TargetCPU > 0 {
+		err = p.putGroupScalingPolicy(scaling, group.Name, group.TargetCPU)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx.logger.Log("Created instance group %s with %d instances", group.Name, desired)
+
+	return nil
+}
+
+// UpdateInstanceGroup changes the sizes and scaling of the group. If an image
+// is configured a new launch template version launching it is created, and
+// refresh replaces the running instances with instances of the new version
+func (p *AWS) UpdateInstanceGroup(ctx *Context, group InstanceGroup, refresh bool) error {
+	scaling, err := p.getAutoScalingService(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	if ctx.config.CloudConfig.ImageName != "" || ctx.config.RunConfig.ImageID != "" {
+		compute, err := p.getEc2Service(ctx.config)
+		if err != nil {
+			return err
+		}
+
+		imgName, ref := ParseImageRef(ctx.config.CloudConfig.ImageName)
+		if ctx.config.RunConfig.ImageVersion != "" {
+			ref = ctx.config.RunConfig.ImageVersion
+		}
+
+		ami, err := p.resolveAMI(ctx, imgName, ref)
+		if err != nil {
+			return err
+		}
+
+		// the other settings, including the security group, are kept
+		version, err := compute.CreateLaunchTemplateVersion(&ec2.CreateLaunchTemplateVersionInput{
+			LaunchTemplateName: aws.String(group.Name),
+			SourceVersion:      aws.String("$Latest"),
+			LaunchTemplateData: &ec2.RequestLaunchTemplateData{
+				ImageId: aws.String(ami),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("create launch template %s version: %v", group.Name, err)
+		}
+
+		ctx.logger.Log("Created launch template %s version %d", group.Name, aws.Int64Value(version.LaunchTemplateVersion.VersionNumber))
+	} else if refresh {
+		return errors.New("instance refresh requires an image to launch")
+	}
+
+	input := &autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(group.Name),
+	}
+
+	if group.MinSize >= 0 {
+		input.MinSize = aws.Int64(group.MinSize)
+	}
+
+	if group.MaxSize >= 0 {
+		input.MaxSize = aws.Int64(group.MaxSize)
+	}
+
+	if group.DesiredCapacity >= 0 {
+		input.DesiredCapacity = aws.Int64(group.DesiredCapacity)
+	}
+
+	if group.HealthCheckGracePeriod >= 0 {
+		input.HealthCheckGracePeriod = aws.Int64(group.HealthCheckGracePeriod)
+	}
+
+	_, err = scaling.UpdateAutoScalingGroup(input)
+	if err != nil {
+		return fmt.Errorf("update auto scaling group %s: %v", group.Name, err)
+	}
+
+	if group.TargetCPU >= 0 {
+		err = p.putGroupScalingPolicy(scaling, group.Name, group.TargetCPU)
+		if err != nil {
+			return err
+		}
+	}
+
+	if refresh {
+		result, err := scaling.StartInstanceRefresh(&autoscaling.StartInstanceRefreshInput{
+			AutoScalingGroupName: aws.String(group.Name),
+			Strategy:             aws.String(autoscaling.RefreshStrategyRolling),
+		})
+		if err != nil {
+			return fmt.Errorf("start instance refresh of group %s: %v", group.Name, err)
+		}
+
+		ctx.logger.Log("Started instance refresh %s", aws.StringValue(result.InstanceRefreshId))
+	}
+
+	ctx.logger.Log("Updated instance group %s", group.Name)
+
+	return nil
+}
+
+// DeleteInstanceGroup deletes the group with its instances, its launch
+// template and the security group ops created for it
+func (p *AWS) DeleteInstanceGroup(ctx *Context, name string) error {
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	scaling, err := p.getAutoScalingService(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	var securityGroups []*string
+	versions, err := compute.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateName: aws.String(name),
+		Versions:           aws.StringSlice([]string{"$Latest"}),
+	})
+	if err == nil && len(versions.LaunchTemplateVersions) > 0 && versions.LaunchTemplateVersions[0].LaunchTemplateData != nil {
+		securityGroups = versions.LaunchTemplateVersions[0].LaunchTemplateData.SecurityGroupIds
+	}
+
+	_, err = scaling.DeleteAutoScalingGroup(&autoscaling.DeleteAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(name),
+		ForceDelete:          aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("delete auto scaling group %s: %v", name, err)
+	}
+
+	ctx.logger.Log("waiting for the group instances to terminate")
+
+	err = scaling.WaitUntilGroupNotExists(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: aws.StringSlice([]string{name}),
+	})
+	if err != nil {
+		return fmt.Errorf("wait for auto scaling group %s deletion: %v", name, err)
+	}
+
+	_, err = compute.DeleteLaunchTemplate(&ec2.DeleteLaunchTemplateInput{
+		LaunchTemplateName: aws.String(name),
+	})
+	if err != nil {
+		return fmt.Errorf("delete launch template %s: %v", name, err)
+	}
+
+	if len(securityGroups) > 0 {
+		groups, err := compute.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+			GroupIds: securityGroups,
+			Filters: []*ec2.Filter{
+				{Name: aws.String("tag:CreatedBy"), Values: aws.StringSlice([]string{"ops"})},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, sg := range groups.SecurityGroups {
+			_, err = compute.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{
+				GroupId: sg.GroupId,
+			})
+			if err != nil {
+				ctx.logger.Warn("security group %s not deleted: %v", aws.StringValue(sg.GroupId), err)
+				continue
+			}
+
+			ctx.logger.Log("Deleted security group %s", aws.StringValue(sg.GroupId))
+		}
+	}
+
+	ctx.logger.Log("Deleted instance group %s", name)
+
+	return nil
+}
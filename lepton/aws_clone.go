@@ -0,0 +1,154 @@
+package lepton
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// describeInstance returns the instance with the id or Name tag passed by argument
+func (p *AWS) describeInstance(compute *ec2.EC2, instance string) (*ec2.Instance, error) {
+	input := &ec2.DescribeInstancesInput{}
+	if strings.HasPrefix(instance, "i-") {
+		input.InstanceIds = aws.StringSlice([]string{instance})
+	} else {
+		input.Filters = []*ec2.Filter{
+			{Name: aws.String("tag:Name"), Values: aws.StringSlice([]string{instance})},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+		}
+	}
+
+	result, err := compute.DescribeInstances(input)
+	if err != nil {
+		return nil, fmt.Errorf("describe instance %s: %v", instance, err)
+	}
+
+	var instances []*ec2.Instance
+	for _, reservation := range result.Reservations {
+		instances = append(instances, reservation.Instances...)
+	}
+
+	switch len(instances) {
+	case 0:
+		return nil, ErrInstanceNotFound(instance)
+	case 1:
+		return instances[0], nil
+	}
+
+	return nil, fmt.Errorf("%d instances named %s, use the instance id", len(instances), instance)
+}
+
+// cloneName returns the default name of a clone of the instance, its Name
+// tag, or its id if it has none, with a -clone suffix
+func cloneName(instance *ec2.Instance) string {
+	name := aws.StringValue(instance.InstanceId)
+	for _, tag := range instance.Tags {
+		if aws.StringValue(tag.Key) == "Name" && aws.StringValue(tag.Value) != "" {
+			name = aws.StringValue(tag.Value)
+		}
+	}
+	return name + "-clone"
+}
+
+// CloneInstance launches a twin of instance, given by id or name, with the
+// same image, flavor, security groups, subnet, tags and user data. name and
+// flavor override the ones of the instance when set
+func (p *AWS) CloneInstance(ctx *Context, instance string, name string, flavor string) (string, error) {
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return "", err
+	}
+
+	source, err := p.describeInstance(compute, instance)
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		name = cloneName(source)
+	}
+
+	name, err = p.uniqueInstanceNameTemplate(ctx, compute, name, 1)
+	if err != nil {
+		return "", err
+	}
+
+	if flavor == "" {
+		flavor = aws.StringValue(source.InstanceType)
+	}
+
+	tags := []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(name)}}
+	for _, tag := range source.Tags {
+		key := aws.StringValue(tag.Key)
+		// tags with the aws: prefix are reserved
+		if key == "Name" || strings.HasPrefix(key, "aws:") {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	tags = withDefaultTags(ctx.config, tags)
+
+	var securityGroups []*string
+	for _, group := range source.SecurityGroups {
+		securityGroups = append(securityGroups, group.GroupId)
+	}
+
+	runInput := &ec2.RunInstancesInput{
+		ImageId:          source.ImageId,
+		InstanceType:     aws.String(flavor),
+		MinCount:         aws.Int64(1),
+		MaxCount:         aws.Int64(1),
+		SubnetId:         source.SubnetId,
+		SecurityGroupIds: securityGroups,
+		TagSpecifications: []*ec2.TagSpecification{
+			{ResourceType: aws.String("instance"), Tags: tags},
+			{ResourceType: aws.String("volume"), Tags: tags},
+		},
+	}
+
+	if source.Placement != nil {
+		runInput.Placement = &ec2.Placement{
+			AvailabilityZone: source.Placement.AvailabilityZone,
+			GroupName:        source.Placement.GroupName,
+			Tenancy:          source.Placement.Tenancy,
+		}
+	}
+
+	if source.IamInstanceProfile != nil {
+		runInput.IamInstanceProfile = &ec2.IamInstanceProfileSpecification{
+			Arn: source.IamInstanceProfile.Arn,
+		}
+	}
+
+	if source.MetadataOptions != nil {
+		runInput.MetadataOptions = &ec2.InstanceMetadataOptionsRequest{
+			HttpEndpoint:            source.MetadataOptions.HttpEndpoint,
+			HttpPutResponseHopLimit: source.MetadataOptions.HttpPutResponseHopLimit,
+			HttpTokens:              source.MetadataOptions.HttpTokens,
+		}
+	}
+
+	userData, err := compute.DescribeInstanceAttribute(&ec2.DescribeInstanceAttributeInput{
+		InstanceId: source.InstanceId,
+		Attribute:  aws.String(ec2.InstanceAttributeNameUserData),
+	})
+	if err != nil {
+		return "", fmt.Errorf("describe instance %s user data: %v", aws.StringValue(source.InstanceId), err)
+	}
+
+	if userData.UserData != nil && userData.UserData.Value != nil {
+		runInput.UserData = userData.UserData.Value
+	}
+
+	result, err := compute.RunInstances(runInput)
+	if err != nil {
+		return "", fmt.Errorf("clone instance %s: %v", instance, err)
+	}
+
+	id := aws.StringValue(result.Instances[0].InstanceId)
+	ctx.logger.Log("Cloned instance %s as %s (%s)", aws.StringValue(source.InstanceId), name, id)
+
+	return id, nil
+}
@@ -0,0 +1,138 @@
+package lepton
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// consoleArchivePrefix is the bucket prefix of archived console output
+const consoleArchivePrefix = "console"
+
+// consoleAnchorSize is the maximum size of the first line of the current
+// console output looked up in the previous one to find where they overlap
+const consoleAnchorSize = 1024
+
+// consoleArchiveKey returns the bucket key of the console output of the
+// instance archived at t, sorted by time under the instance prefix
+func consoleArchiveKey(instanceID string, t time.Time) string {
+	return fmt.Sprintf("%s/%s/%s.log.gz", consoleArchivePrefix, instanceID, t.UTC().Format("20060102T150405Z"))
+}
+
+// newConsoleOutput returns the part of the current console output that
+// wasn't in the previous one. AWS only keeps the last 64KB of the console, so
+// the current output starts with the end of the previous one once it filled
+// up, and is entirely new if it doesn't overlap the previous one
+func newConsoleOutput(previous string, current string) string {
+	if strings.HasPrefix(current, previous) {
+		return current[len(previous):]
+	}
+
+	anchor := current
+	if i := strings.Index(anchor, "\n"); i != -1 {
+		anchor = anchor[:i+1]
+	}
+	if len(anchor) > consoleAnchorSize {
+		anchor = anchor[:consoleAnchorSize]
+	}
+
+	// the earliest match is the longest overlap
+	for offset := 0; offset < len(previous); {
+		i := strings.Index(previous[offset:], anchor)
+		if i == -1 {
+			break
+		}
+
+		overlap := previous[offset+i:]
+		if strings.HasPrefix(current, overlap) {
+			return current[len(overlap):]
+		}
+
+		offset += i + 1
+	}
+
+	return current
+}
+
+// gzipData compresses data with gzip
+func gzipData(data string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+
+	_, err := w.Write([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ArchiveConsole uploads the console output of the instance, given by id or
+// name, written since the previous output passed by argument to the bucket
+// of the cloud config as a gzip chunk. Returns the current output, to pass
+// as previous on the next call
+func (p *AWS) ArchiveConsole(ctx *Context, instance string, previous string) (string, error) {
+	bucket := ctx.config.CloudConfig.BucketName
+	if bucket == "" {
+		return previous, errors.New("a bucket is required to archive console output")
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return previous, err
+	}
+
+	source, err := p.describeInstance(compute, instance)
+	if err != nil {
+		return previous, err
+	}
+	id := aws.StringValue(source.InstanceId)
+
+	current, err := instanceConsole(compute, id)
+	if err != nil {
+		return previous, fmt.Errorf("get console output of %s: %v", id, err)
+	}
+
+	chunk := newConsoleOutput(previous, current)
+	if chunk == "" {
+		ctx.logger.Log("No new console output of %s", id)
+		return current, nil
+	}
+
+	data, err := gzipData(chunk)
+	if err != nil {
+		return previous, err
+	}
+
+	sess, err := p.getAWSSession(ctx.config)
+	if err != nil {
+		return previous, err
+	}
+
+	key := consoleArchiveKey(id, time.Now())
+	_, err = s3.New(sess).PutObject(&s3.PutObjectInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		Body:            bytes.NewReader(data),
+		ContentType:     aws.String("text/plain"),
+		ContentEncoding: aws.String("gzip"),
+	})
+	if err != nil {
+		return previous, fmt.Errorf("upload console output of %s: %v", id, err)
+	}
+
+	ctx.logger.Log("Archived %d bytes of console output of %s to s3://%s/%s", len(chunk), id, bucket, key)
+
+	return current, nil
+}
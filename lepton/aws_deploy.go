@@ -0,0 +1,713 @@
+package lepton
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// DeployStep is a step of an aws image deploy
+type DeployStep string
+
+// steps of an aws image deploy in the order they run
+const (
+	DeployStepUpload   DeployStep = "upload"   // local image copied to the bucket
+	DeployStepImport   DeployStep = "import"   // snapshot import task started
+	DeployStepSnapshot DeployStep = "snapshot" // snapshot imported
+	DeployStepCleanup  DeployStep = "cleanup"  // bucket object deleted and snapshot tagged
+	DeployStepRegister DeployStep = "register" // ami registered
+	DeployStepTag      DeployStep = "tag"      // ami tagged and aliased
+)
+
+var deploySteps = []DeployStep{
+	DeployStepUpload,
+	DeployStepImport,
+	DeployStepSnapshot,
+	DeployStepCleanup,
+	DeployStepRegister,
+	DeployStepTag,
+}
+
+// DeployState is the checkpoint of an image deploy, persisted after each
+// completed step so an interrupted deploy resumes after it
+type DeployState struct {
+	Image        string     `json:"image"`
+	Region       string     `json:"region"`
+	Checksum     string     `json:"checksum"` // sha256 of the local image deployed
+	Step         DeployStep `json:"step"`     // last completed step
+	ImportTaskID string     `json:"importTaskId,omitempty"`
+	SnapshotID   string     `json:"snapshotId,omitempty"`
+	ImageID      string     `json:"imageId,omitempty"`
+	DeployID     string     `json:"deployId,omitempty"`
+	Config       *Config    `json:"config,omitempty"` // settings an async deploy is completed with, see deployStateConfig
+	Updated      time.Time  `json:"updated"`
+}
+
+// completed returns true if step ran in the deploy
+func (s *DeployState) completed(step DeployStep) bool {
+	if s.Step == "" {
+		return false
+	}
+
+	for _, done := range deploySteps {
+		if done == step {
+			return true
+		}
+		if done == s.Step {
+			return false
+		}
+	}
+	return false
+}
+
+// deployStatePath returns the file holding the state of the deploy of the
+// image name in region
+func deployStatePath(region string, name string) string {
+	return path.Join(GetOpsHome(), "deploys", fmt.Sprintf("aws-%s-%s.json", region, name))
+}
+
+// loadDeployState returns the state of an interrupted deploy of the image
+// with the checksum passed by argument, nil if there's none or it deployed
+// another build of the image
+func loadDeployState(region string, name string, checksum string) *DeployState {
+	data, err := ioutil.ReadFile(deployStatePath(region, name))
+	if err != nil {
+		return nil
+	}
+
+	state := &DeployState{}
+	if json.Unmarshal(data, state) != nil || checksum == "" || state.Checksum != checksum {
+		return nil
+	}
+
+	return state
+}
+
+// findImportDeployState returns the state of the deploy waiting for the
+// import task passed by argument, nil if there's none
+func findImportDeployState(importTaskID string) *DeployState {
+	paths, err := filepath.Glob(path.Join(GetOpsHome(), "deploys", "aws-*.json"))
+	if err != nil {
+		return nil
+	}
+
+	for _, statePath := range paths {
+		data, err := ioutil.ReadFile(statePath)
+		if err != nil {
+			continue
+		}
+
+		state := &DeployState{}
+		if json.Unmarshal(data, state) == nil && state.ImportTaskID == importTaskID {
+			return state
+		}
+	}
+
+	return nil
+}
+
+// deployStateConfig returns the settings of the config the steps of an
+// image deploy run with, the rest of the config isn't saved with the state.
+// Environment values are replaced by their checksum
+func deployStateConfig(c *Config) (*Config, error) {
+	key, err := checksumKey(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Config{
+		CloudConfig: c.CloudConfig,
+		DefaultTags: c.DefaultTags,
+		Env:         checksumValues(key, c.Env),
+		RunConfig: RunConfig{
+			DryRun:       c.RunConfig.DryRun,
+			Verbose:      c.RunConfig.Verbose,
+			ShowDebug:    c.RunConfig.ShowDebug,
+			ShowWarnings: c.RunConfig.ShowWarnings,
+			ShowErrors:   c.RunConfig.ShowErrors,
+			Quiet:        c.RunConfig.Quiet,
+			LogFormat:    c.RunConfig.LogFormat,
+			TimeFormat:   c.RunConfig.TimeFormat,
+		},
+	}, nil
+}
+
+func (s *DeployState) save() error {
+	statePath := deployStatePath(s.Region, s.Image)
+
+	err := os.MkdirAll(path.Dir(statePath), 0700)
+	if err != nil {
+		return err
+	}
+
+	s.Updated = time.Now()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(statePath, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	// states saved by older versions were readable by anyone
+	return os.Chmod(statePath, 0600)
+}
+
+func (s *DeployState) remove() error {
+	err := os.Remove(deployStatePath(s.Region, s.Image))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// awsDeploy runs the steps of an image deploy
+type awsDeploy struct {
+	p         *AWS
+	ctx       *Context
+	compute   *ec2.EC2
+	state     *DeployState
+	imagePath string // local image uploaded, empty if it's already in the bucket
+	async     bool   // stop once the snapshot import started
+
+	// snapshot of the newest ami deployed from the same files as the local
+	// image and its blocks, only the changed blocks being written to a new
+	// snapshot instead of uploading and importing the image
+	parentSnapshot string
+	parentBlocks   *snapshotBlocks
+
+	restarted bool // the import was started again after its task failed
+}
+
+func (d *awsDeploy) runStep(step DeployStep) error {
+	switch step {
+	case DeployStepUpload:
+		return d.upload()
+	case DeployStepImport:
+		return d.importSnapshot()
+	case DeployStepSnapshot:
+		return d.waitSnapshot()
+	case DeployStepCleanup:
+		return d.cleanup()
+	case DeployStepRegister:
+		return d.register()
+	case DeployStepTag:
+		return d.tag()
+	}
+	return fmt.Errorf("unknown deploy step %s", step)
+}
+
+// run runs the steps not completed yet, saving the state after each one.
+// The state is removed once the image is deployed
+func (d *awsDeploy) run() error {
+	if d.parentBlocks != nil && d.state.Step == "" {
+		err := d.patchSnapshot(d.parentSnapshot, d.parentBlocks)
+		if err == nil {
+			d.state.Step = DeployStepSnapshot
+			err = d.state.save()
+			if err != nil {
+				d.ctx.logger.Warn("unable to save deploy state: %v", err)
+			}
+		} else {
+			d.ctx.logger.Warn("unable to patch snapshot %s, uploading the image: %v", d.parentSnapshot, err)
+		}
+	}
+
+	for _, step := range deploySteps {
+		if d.state.completed(step) {
+			continue
+		}
+
+		err := d.runStep(step)
+		if err != nil && step == DeployStepSnapshot && !d.restarted && d.importTaskGone() {
+			// waiting again on a failed or deleted task would never end
+			d.ctx.logger.Warn("snapshot import %s failed, importing the image again", d.state.ImportTaskID)
+			d.restarted = true
+			d.state.ImportTaskID = ""
+			d.state.Step = DeployStepUpload
+			err = d.state.save()
+			if err != nil {
+				d.ctx.logger.Warn("unable to save deploy state: %v", err)
+			}
+			return d.run()
+		}
+		if err != nil {
+			return fmt.Errorf("deploy step %s: %v, run the command again to resume", step, err)
+		}
+
+		d.state.Step = step
+		err = d.state.save()
+		if err != nil {
+			d.ctx.logger.Warn("unable to save deploy state: %v", err)
+		}
+
+		if d.async && step == DeployStepImport {
+			d.ctx.logger.Log("Snapshot import %s started, run ops deploy wait %s to complete the image", d.state.ImportTaskID, d.state.ImportTaskID)
+			return nil
+		}
+	}
+
+	return d.state.remove()
+}
+
+func (d *awsDeploy) upload() error {
+	if d.imagePath == "" {
+		return nil
+	}
+
+	key := d.ctx.config.CloudConfig.ImageName
+	d.ctx.progress(ProgressUpload, key, ProgressStarted, 0, "uploading %s", d.imagePath)
+
+	var mu sync.Mutex
+	last := 0
+	var uploaded int64
+	err := d.p.Storage.copyToBucket(d.ctx.config, d.imagePath, func(read int64, size int64) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		uploaded = read
+		percent := percentOf(read, size)
+		if percent <= last || percent == 100 {
+			return
+		}
+		last = percent
+		d.ctx.progress(ProgressUpload, key, ProgressRunning, percent, "")
+	})
+	if err != nil {
+		d.ctx.progress(ProgressUpload, key, ProgressFailed, last, "%v", err)
+		return err
+	}
+
+	d.ctx.recordUpload(uploaded)
+	d.ctx.progress(ProgressUpload, key, ProgressDone, 100, "")
+	return nil
+}
+
+func (d *awsDeploy) importSnapshot() error {
+	c := d.ctx.config
+
+	input := &ec2.ImportSnapshotInput{
+		Description: aws.String(imageDescription(c)),
+		DiskContainer: &ec2.SnapshotDiskContainer{
+			Description: aws.String(imageDescription(c)),
+			Format:      aws.String("raw"),
+			UserBucket: &ec2.UserBucket{
+				S3Bucket: aws.String(c.CloudConfig.BucketName),
+				S3Key:    aws.String(c.CloudConfig.ImageName),
+			},
+		},
+	}
+
+	if c.CloudConfig.KMSKeyID != "" {
+		input.Encrypted = aws.Bool(true)
+		input.KmsKeyId = aws.String(c.CloudConfig.KMSKeyID)
+	}
+
+	res, err := d.compute.ImportSnapshot(input)
+	if err != nil {
+		return err
+	}
+
+	d.state.ImportTaskID = aws.StringValue(res.ImportTaskId)
+
+	return nil
+}
+
+func (d *awsDeploy) waitSnapshot() error {
+	snapshotID, err := d.p.waitSnapshotToBeReady(d.ctx, aws.String(d.state.ImportTaskID))
+	if err != nil {
+		return err
+	}
+
+	d.state.SnapshotID = aws.StringValue(snapshotID)
+	d.ctx.recordCreated("snapshot", d.state.SnapshotID)
+
+	if d.imagePath != "" {
+		d.recordSnapshotBlocks()
+	}
+
+	return nil
+}
+
+// importTaskFailed returns true if the snapshot import task of the detail
+// failed or was deleted
+func importTaskFailed(detail *ec2.SnapshotTaskDetail) bool {
+	if detail == nil {
+		return true
+	}
+
+	switch aws.StringValue(detail.Status) {
+	case "deleted", "deleting":
+		return true
+	}
+	return false
+}
+
+// importTaskGone returns true if the snapshot import task of the deploy
+// failed, was deleted or doesn't exist anymore, false if it may still
+// complete or its status is unknown
+func (d *awsDeploy) importTaskGone() bool {
+	res, err := d.compute.DescribeImportSnapshotTasks(&ec2.DescribeImportSnapshotTasksInput{
+		ImportTaskIds: aws.StringSlice([]string{d.state.ImportTaskID}),
+	})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		return ok && strings.HasPrefix(aerr.Code(), "InvalidConversionTaskId")
+	}
+
+	return len(res.ImportSnapshotTasks) == 0 || importTaskFailed(res.ImportSnapshotTasks[0].SnapshotTaskDetail)
+}
+
+func (d *awsDeploy) cleanup() error {
+	c := d.ctx.config
+	key := c.CloudConfig.ImageName
+
+	// delete the tmp s3 image
+	err := d.p.Storage.DeleteFromBucket(c, key)
+	if err != nil {
+		return err
+	}
+
+	// tag the volume
+	_, err = d.compute.CreateTags(&ec2.CreateTagsInput{
+		Resources: aws.StringSlice([]string{d.state.SnapshotID}),
+		Tags: withDefaultTags(c, withDeployIDTag(d.ctx, []*ec2.Tag{
+			{
+				Key:   aws.String("Name"),
+				Value: aws.String(key),
+			},
+		})),
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(c.CloudConfig.FastRestoreZones) > 0 {
+		return d.p.enableFastSnapshotRestore(d.ctx, d.compute, aws.String(d.state.SnapshotID))
+	}
+
+	return nil
+}
+
+func (d *awsDeploy) register() error {
+	c := d.ctx.config
+	key := c.CloudConfig.ImageName
+
+	t := time.Now().UnixNano()
+	s := strconv.FormatInt(t, 10)
+
+	amiName := key + s
+
+	// register ami
+	rinput := &ec2.RegisterImageInput{
+		Name:         aws.String(amiName),
+		Architecture: aws.String("x86_64"),
+		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+			{
+				DeviceName: aws.String("/dev/sda1"),
+				Ebs:        d.p.imageRootDevice(c, aws.String(d.state.SnapshotID)),
+			},
+		},
+		Description:        aws.String(imageDescription(c)),
+		RootDeviceName:     aws.String("/dev/sda1"),
+		VirtualizationType: aws.String("hvm"),
+		EnaSupport:         aws.Bool(c.CloudConfig.EnaSupport),
+		DryRun:             aws.Bool(c.RunConfig.DryRun),
+	}
+
+	resreg, err := d.compute.RegisterImage(rinput)
+	if err != nil {
+		return err
+	}
+
+	d.state.ImageID = aws.StringValue(resreg.ImageId)
+	d.ctx.recordCreated("image", d.state.ImageID)
+
+	return nil
+}
+
+func (d *awsDeploy) tag() error {
+	c := d.ctx.config
+	key := c.CloudConfig.ImageName
+
+	imageTags := []*ec2.Tag{
+		{
+			Key:   aws.String("Name"),
+			Value: aws.String(key),
+		},
+	}
+
+	// record the checksum of the local image to verify it later
+	if d.state.Checksum != "" {
+		imageTags = append(imageTags, &ec2.Tag{
+			Key:   aws.String(awsContentHashTag),
+			Value: aws.String(d.state.Checksum),
+		})
+	}
+
+	if c.CloudConfig.MarketplaceProduct != "" {
+		imageTags = append(imageTags, &ec2.Tag{
+			Key:   aws.String(awsMarketplaceProductTag),
+			Value: aws.String(c.CloudConfig.MarketplaceProduct),
+		})
+	}
+
+	// Add name tag to the created ami
+	_, err := d.compute.CreateTags(&ec2.CreateTagsInput{
+		Resources: aws.StringSlice([]string{d.state.ImageID}),
+		Tags:      withDefaultTags(c, withProjectTag(c, withDeployIDTag(d.ctx, withImageMetadataTags(c, imageTags)))),
+	})
+	if err != nil {
+		return err
+	}
+
+	if !c.RunConfig.HoldLatestAlias {
+		err = d.p.moveImageAlias(d.ctx, d.compute, key, LatestImageAlias, d.state.ImageID)
+		if err != nil {
+			d.ctx.logger.Warn("unable to update %s:%s: %v", key, LatestImageAlias, err)
+		}
+	}
+
+	invalidateAWSImageCache(d.ctx, c.CloudConfig.Zone, key)
+
+	return nil
+}
+
+// reusableImage returns true if the ami was deployed from a local image with
+// the checksum passed by argument and the image settings of the config
+func reusableImage(image *ec2.Image, c *Config, checksum string) bool {
+	if awsImageTag(image, awsContentHashTag) != checksum {
+		return false
+	}
+
+	if aws.BoolValue(image.EnaSupport) != c.CloudConfig.EnaSupport {
+		return false
+	}
+
+	// the encryption of the snapshot can't change
+	for _, device := range image.BlockDeviceMappings {
+		if device.Ebs != nil && aws.BoolValue(device.Ebs.Encrypted) != (c.CloudConfig.KMSKeyID != "") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DeployImage uploads the local image at imagePath to the bucket and creates
+// an ami from it. Each completed step is checkpointed in the ops home, running
+// it again after an interruption resumes the deploy of the same image build
+// after the last completed step. An image unchanged since its newest ami is
+// only tagged and aliased again, one whose files are unchanged and only its
+// configuration changed, e.g. arguments or environment, is written to a
+// snapshot of that ami block by block instead of being uploaded
+func (p *AWS) DeployImage(ctx *Context, imagePath string) error {
+	c := ctx.config
+
+	compute, err := p.getEc2Service(c)
+	if err != nil {
+		return err
+	}
+
+	err = p.validateVolumeConfig(c)
+	if err != nil {
+		return err
+	}
+
+	if c.RunConfig.DryRun {
+		err = p.checkProjectImages(ctx, compute)
+		if err != nil {
+			return err
+		}
+
+		p.dryRunDeployImage(ctx, imagePath)
+		return nil
+	}
+
+	checksum, err := fileSHA256(c.RunConfig.Imagename)
+	if err != nil {
+		ctx.logger.Warn("unable to compute image checksum: %v", err)
+	}
+
+	state := loadDeployState(c.CloudConfig.Zone, c.CloudConfig.ImageName, checksum)
+	resumed := state != nil
+
+	// an unchanged image is tagged and aliased again instead of uploaded
+	var parentSnapshot string
+	var parentBlocks *snapshotBlocks
+	if state == nil && checksum != "" {
+		image, err := p.findImageByName(ctx, c.CloudConfig.ImageName)
+		if err == nil && !reusableImage(image, c, checksum) && imagePath != "" {
+			parentBlocks = configOnlyChange(image, c, imagePath)
+			if parentBlocks != nil {
+				parentSnapshot = rootSnapshot(image)
+				ctx.logger.Log("Only the configuration of %s changed since ami %s, patching snapshot %s", c.CloudConfig.ImageName, aws.StringValue(image.ImageId), parentSnapshot)
+			}
+		} else if err == nil && reusableImage(image, c, checksum) {
+			ctx.logger.Log("Image %s unchanged since ami %s, skipping upload", c.CloudConfig.ImageName, aws.StringValue(image.ImageId))
+			state = &DeployState{
+				Image:    c.CloudConfig.ImageName,
+				Region:   c.CloudConfig.Zone,
+				Checksum: checksum,
+				Step:     DeployStepRegister,
+				ImageID:  aws.StringValue(image.ImageId),
+			}
+		}
+	}
+
+	// a resumed deploy may have registered its image already
+	if state == nil || !state.completed(DeployStepRegister) {
+		err = p.checkProjectImages(ctx, compute)
+		if err != nil {
+			return err
+		}
+	}
+
+	if resumed {
+		ctx.logger.Log("Resuming deploy of %s after step %s", c.CloudConfig.ImageName, state.Step)
+	} else if state == nil {
+		state = &DeployState{
+			Image:    c.CloudConfig.ImageName,
+			Region:   c.CloudConfig.Zone,
+			Checksum: checksum,
+		}
+	}
+	state.DeployID = ctx.DeployID()
+	state.Config, err = deployStateConfig(c)
+	if err != nil {
+		return err
+	}
+
+	ctx.logger.Log("Deploy id %s", ctx.DeployID())
+
+	d := &awsDeploy{
+		p:         p,
+		ctx:       ctx,
+		compute:   compute,
+		state:     state,
+		imagePath: imagePath,
+		async:     c.RunConfig.Async,
+
+		parentSnapshot: parentSnapshot,
+		parentBlocks:   parentBlocks,
+	}
+
+	return d.run()
+}
+
+// CreateImageFromSnapshot registers an ami from an existing ebs snapshot,
+// e.g. one produced by another pipeline, skipping the upload and import of a
+// local image. The ami is tagged and aliased like a deployed image
+func (p *AWS) CreateImageFromSnapshot(ctx *Context, snapshotID string) (string, error) {
+	c := ctx.config
+
+	compute, err := p.getEc2Service(c)
+	if err != nil {
+		return "", err
+	}
+
+	err = p.validateVolumeConfig(c)
+	if err != nil {
+		return "", err
+	}
+
+	snapshot, err := p.describeVolumeSnapshot(compute, snapshotID)
+	if err != nil {
+		return "", err
+	}
+	snapshotID = aws.StringValue(snapshot.SnapshotId)
+
+	if state := aws.StringValue(snapshot.State); state != ec2.SnapshotStateCompleted {
+		return "", fmt.Errorf("snapshot %s is %s, it must be completed to register an image", snapshotID, state)
+	}
+
+	err = p.checkProjectImages(ctx, compute)
+	if err != nil {
+		return "", err
+	}
+
+	d := &awsDeploy{
+		p:       p,
+		ctx:     ctx,
+		compute: compute,
+		state: &DeployState{
+			Image:      c.CloudConfig.ImageName,
+			Region:     c.CloudConfig.Zone,
+			SnapshotID: snapshotID,
+			DeployID:   ctx.DeployID(),
+		},
+	}
+
+	err = d.register()
+	if c.RunConfig.DryRun {
+		return "", dryRunRequest(err, "would register image %s from snapshot %s", c.CloudConfig.ImageName, snapshotID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = d.tag()
+	if err != nil {
+		return "", err
+	}
+
+	ctx.logger.Log("Image %s registered as %s from snapshot %s", c.CloudConfig.ImageName, d.state.ImageID, snapshotID)
+
+	return d.state.ImageID, nil
+}
+
+// completeImportDeploy runs the steps of the async deploy waiting for the
+// import task passed by argument with the config it was started with. The
+// progress events are sent to the subscribers of ctx
+func (p *AWS) completeImportDeploy(ctx *Context, importTaskID string) error {
+	state := findImportDeployState(importTaskID)
+	if state == nil {
+		return fmt.Errorf("no deploy waiting for snapshot import %s", importTaskID)
+	}
+
+	if state.Config == nil {
+		return fmt.Errorf("deploy of %s waiting for snapshot import %s has no config", state.Image, importTaskID)
+	}
+
+	c := state.Config
+	c.RunConfig.DeployID = state.DeployID
+
+	var provider Provider = p
+	deployCtx := NewContext(c, &provider)
+	deployCtx.progressFuncs = ctx.progressFuncs
+
+	compute, err := p.getEc2Service(c)
+	if err != nil {
+		return err
+	}
+
+	d := &awsDeploy{
+		p:       p,
+		ctx:     deployCtx,
+		compute: compute,
+		state:   state,
+	}
+
+	err = d.run()
+	if err != nil {
+		return err
+	}
+
+	deployCtx.logger.Log("Image %s deployed as %s", state.Image, state.ImageID)
+
+	return nil
+}
@@ -0,0 +1,333 @@
+package lepton
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxDeployRecords is the number of rollouts of an image kept in its deploy
+// history
+const maxDeployRecords = 10
+
+// DeployRecord is a rollout of an image, what a rollback restores
+type DeployRecord struct {
+	Image       string    `json:"image"`
+	ImageID     string    `json:"imageId"`
+	InstanceIDs []string  `json:"instanceIds"`
+	DomainNames []string  `json:"domainNames,omitempty"` // pointed to the instances
+	Retired     []string  `json:"retired,omitempty"`     // instances the rollout replaced
+	Config      *Config   `json:"config"`                // config the instances were launched with, environment values replaced by their checksum
+	Time        time.Time `json:"time"`
+}
+
+// DeployHistory is the rollouts of an image in a region, oldest first
+type DeployHistory struct {
+	Image   string         `json:"image"`
+	Region  string         `json:"region"`
+	Records []DeployRecord `json:"records"`
+}
+
+// add appends the record to the history, dropping the oldest records over
+// maxDeployRecords
+func (h *DeployHistory) add(record DeployRecord) {
+	h.Records = append(h.Records, record)
+	if len(h.Records) > maxDeployRecords {
+		h.Records = h.Records[len(h.Records)-maxDeployRecords:]
+	}
+}
+
+// previous returns the latest record and the one before it, the rollout a
+// rollback restores
+func (h *DeployHistory) previous() (*DeployRecord, *DeployRecord, error) {
+	if len(h.Records) < 2 {
+		return nil, nil, fmt.Errorf("no previous deploy of %s in %s to roll back to", h.Image, h.Region)
+	}
+
+	return &h.Records[len(h.Records)-1], &h.Records[len(h.Records)-2], nil
+}
+
+// deployHistoryName returns the file name of the deploy history of the image
+// name in region, the history being shared by every version of the image
+func deployHistoryName(region string, name string) string {
+	name, _ = ParseImageRef(name)
+	return fmt.Sprintf("aws-%s-%s-history.json", region, name)
+}
+
+// loadDeployHistory returns the deploy history of the image name, an empty
+// history if there's none. The history is read from the deploy history
+// bucket of the config if it sets one, from the ops home otherwise
+func (p *AWS) loadDeployHistory(ctx *Context, name string) (*DeployHistory, error) {
+	c := ctx.config
+	image, _ := ParseImageRef(name)
+	history := &DeployHistory{Image: image, Region: c.CloudConfig.Zone}
+	file := deployHistoryName(c.CloudConfig.Zone, name)
+
+	var data []byte
+	if bucket := c.CloudConfig.DeployHistoryBucket; bucket != "" {
+		sess, err := p.getAWSSession(c)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := s3.New(sess).GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(path.Join("deploys", file)),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+				return history, nil
+			}
+			return nil, fmt.Errorf("read deploy history of %s from s3://%s: %v", image, bucket, err)
+		}
+		defer result.Body.Close()
+
+		data, err = ioutil.ReadAll(result.Body)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		data, err = ioutil.ReadFile(path.Join(GetOpsHome(), "deploys", file))
+		if os.IsNotExist(err) {
+			return history, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := json.Unmarshal(data, history)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deploy history of %s: %v", image, err)
+	}
+
+	return history, nil
+}
+
+// saveDeployHistory writes the deploy history where loadDeployHistory reads
+// it from
+func (p *AWS) saveDeployHistory(ctx *Context, history *DeployHistory) error {
+	c := ctx.config
+	file := deployHistoryName(history.Region, history.Image)
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if bucket := c.CloudConfig.DeployHistoryBucket; bucket != "" {
+		sess, err := p.getAWSSession(c)
+		if err != nil {
+			return err
+		}
+
+		_, err = s3.New(sess).PutObject(&s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(path.Join("deploys", file)),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return fmt.Errorf("write deploy history of %s to s3://%s: %v", history.Image, bucket, err)
+		}
+		return nil
+	}
+
+	historyPath := path.Join(GetOpsHome(), "deploys", file)
+
+	err = os.MkdirAll(path.Dir(historyPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(historyPath, data, 0644)
+}
+
+// recordDeploy adds the rollout of the config to the instances with the ids
+// passed by argument to the deploy history of its image
+func (p *AWS) recordDeploy(ctx *Context, ids []string, retired []string) error {
+	c := ctx.config
+
+	compute, err := p.getEc2Service(c)
+	if err != nil {
+		return err
+	}
+
+	result, err := compute.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(ids[:1]),
+	})
+	if err != nil {
+		return err
+	}
+	if len(result.Reservations) == 0 || len(result.Reservations[0].Instances) == 0 {
+		return fmt.Errorf("instance %s not found", ids[0])
+	}
+
+	history, err := p.loadDeployHistory(ctx, c.CloudConfig.ImageName)
+	if err != nil {
+		return err
+	}
+
+	// the history is stored in a bucket or the ops home, it doesn't hold
+	// the environment values, only what a rollback checks them against
+	key, err := checksumKey(c)
+	if err != nil {
+		return err
+	}
+
+	config := *c
+	config.RunConfig.DryRun = false
+	config.RunConfig.InstanceEnv = checksumValues(key, c.RunConfig.InstanceEnv)
+	config.Env = checksumValues(key, c.Env)
+
+	var names []string
+	if hasDomainNames(c) {
+		names = domainNames(c)
+	}
+
+	history.add(DeployRecord{
+		Image:       history.Image,
+		ImageID:     aws.StringValue(result.Reservations[0].Instances[0].ImageId),
+		InstanceIDs: ids,
+		DomainNames: names,
+		Retired:     retired,
+		Config:      &config,
+		Time:        time.Now(),
+	})
+
+	return p.saveDeployHistory(ctx, history)
+}
+
+// recordedValues returns the values of the current environment of the
+// settings recorded by their checksum. A value that changed since it was
+// recorded is used with a warning, a missing one is an error
+func recordedValues(ctx *Context, setting string, recorded map[string]string, current map[string]string) (map[string]string, error) {
+	if len(recorded) == 0 {
+		return nil, nil
+	}
+
+	key, err := checksumKey(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for k, checksum := range recorded {
+		v, ok := current[k]
+		if !ok {
+			return nil, fmt.Errorf("the value of %s.%s isn't recorded, set it in the config", setting, k)
+		}
+		if valueChecksum(key, []byte(v)) != checksum {
+			ctx.logger.Warn("%s.%s changed since the deploy, using its current value", setting, k)
+		}
+		values[k] = v
+	}
+
+	return values, nil
+}
+
+// liveInstanceIDs returns the ids passed by argument of the instances not
+// terminated
+func liveInstanceIDs(compute *ec2.EC2, ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var live []string
+	err := compute.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("instance-id"), Values: aws.StringSlice(ids)},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				live = append(live, aws.StringValue(instance.InstanceId))
+			}
+		}
+		return true
+	})
+
+	return live, err
+}
+
+// RollbackDeploy rolls the image name back to its previous deploy: instances
+// of the previous image are launched with the previous config, its domain
+// names pointed back to them and the instances of the latest deploy deleted,
+// as a rollout does
+func (p *AWS) RollbackDeploy(ctx *Context, name string) ([]string, error) {
+	history, err := p.loadDeployHistory(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, previous, err := history.previous()
+	if err != nil {
+		return nil, err
+	}
+
+	if previous.Config == nil || previous.ImageID == "" {
+		return nil, errors.New("the previous deploy doesn't record its image and config")
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	retired, err := liveInstanceIDs(compute, latest.InstanceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	c := *previous.Config
+	c.CloudConfig.Zone = ctx.config.CloudConfig.Zone
+
+	c.RunConfig.InstanceEnv, err = recordedValues(ctx, "InstanceEnv", previous.Config.RunConfig.InstanceEnv, ctx.config.RunConfig.InstanceEnv)
+	if err != nil {
+		return nil, err
+	}
+	c.Env, err = recordedValues(ctx, "Env", previous.Config.Env, ctx.config.Env)
+	if err != nil {
+		return nil, err
+	}
+	c.RunConfig.ImageID = previous.ImageID
+	c.RunConfig.DryRun = ctx.config.RunConfig.DryRun
+	c.RunConfig.Async = false
+
+	rollbackCtx := *ctx
+	rollbackCtx.config = &c
+
+	ctx.logger.Log("Rolling %s back from %s to %s deployed at %s", history.Image, latest.ImageID, previous.ImageID, previous.Time.Format(time.RFC3339))
+
+	ids, err := p.rollout(&rollbackCtx, retired)
+	if len(ids) == 0 {
+		return nil, err
+	}
+
+	previous.InstanceIDs = ids
+	history.Records = history.Records[:len(history.Records)-1]
+
+	saveErr := p.saveDeployHistory(ctx, history)
+	if saveErr != nil {
+		ctx.logger.Warn("unable to record the rollback of %s: %v", history.Image, saveErr)
+	}
+
+	if err == nil {
+		ctx.logger.Log("Rolled %s back to %s on instances %s", history.Image, previous.ImageID, strings.Join(ids, ", "))
+	}
+
+	return ids, err
+}
@@ -0,0 +1,95 @@
+package lepton
+
+import (
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/resourcegroupstaggingapi"
+	"github.com/olekukonko/tablewriter"
+)
+
+// DeployResource is a resource created by a deploy
+type DeployResource struct {
+	ARN  string
+	Type string // service and resource type, e.g. ec2:instance
+	Name string
+}
+
+// arnResourceType returns the service and resource type of an arn, e.g.
+// ec2:instance for arn:aws:ec2:us-west-2:123456789012:instance/i-0123
+func arnResourceType(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 {
+		return ""
+	}
+
+	resource := parts[5]
+	if i := strings.IndexAny(resource, "/:"); i != -1 {
+		resource = resource[:i]
+	}
+
+	return parts[2] + ":" + resource
+}
+
+// FindDeployResources returns the resources of the zone tagged with the
+// deploy id passed by argument
+func (p *AWS) FindDeployResources(ctx *Context, deployID string) ([]DeployResource, error) {
+	sess, err := p.getAWSSession(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+	svc := resourcegroupstaggingapi.New(sess)
+
+	var resources []DeployResource
+	err = svc.GetResourcesPages(&resourcegroupstaggingapi.GetResourcesInput{
+		TagFilters: []*resourcegroupstaggingapi.TagFilter{
+			{Key: aws.String(awsDeployIDTag), Values: aws.StringSlice([]string{deployID})},
+		},
+	}, func(page *resourcegroupstaggingapi.GetResourcesOutput, lastPage bool) bool {
+		for _, mapping := range page.ResourceTagMappingList {
+			resource := DeployResource{
+				ARN:  aws.StringValue(mapping.ResourceARN),
+				Type: arnResourceType(aws.StringValue(mapping.ResourceARN)),
+			}
+
+			for _, tag := range mapping.Tags {
+				if aws.StringValue(tag.Key) == "Name" {
+					resource.Name = aws.StringValue(tag.Value)
+				}
+			}
+
+			resources = append(resources, resource)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resources, nil
+}
+
+// PrintDeployResources prints the resources tagged with the deploy id
+func (p *AWS) PrintDeployResources(ctx *Context, deployID string) error {
+	resources, err := p.FindDeployResources(ctx, deployID)
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Type", "Name", "Arn"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
+	table.SetRowLine(true)
+
+	for _, resource := range resources {
+		table.Append([]string{resource.Type, resource.Name, resource.ARN})
+	}
+
+	table.Render()
+
+	return nil
+}
@@ -1,43 +1,186 @@
 package lepton
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/route53"
 )
 
-// FindOrCreateZoneIDByName searches for a DNS zone with the name passed by argument and if it doesn't exist it creates one
+// FindOrCreateZoneIDByName searches for a DNS zone with the name passed by argument and if it doesn't exist it creates one.
+// With RunConfig.PrivateDNS the zone is a private zone associated with the vpc of the instances
 func (p *AWS) FindOrCreateZoneIDByName(config *Config, dnsName string) (string, error) {
+	zoneID, err := p.FindZoneIDByName(config, dnsName)
+	if err != nil || zoneID != "" {
+		return zoneID, err
+	}
+
 	dnsService, err := p.getDNSService(config)
 	if err != nil {
 		return "", err
 	}
 
-	var zoneID string
-	hostedZones, err := dnsService.ListHostedZonesByName(&route53.ListHostedZonesByNameInput{DNSName: &dnsName})
-	if err == nil && hostedZones.HostedZones == nil {
-		reference := strconv.Itoa(int(time.Now().Unix()))
+	private := config.RunConfig.PrivateDNS
 
-		createHostedZoneInput := &route53.CreateHostedZoneInput{
-			CallerReference: &reference,
-			Name:            &dnsName,
+	reference := strconv.Itoa(int(time.Now().Unix()))
+
+	createHostedZoneInput := &route53.CreateHostedZoneInput{
+		CallerReference: &reference,
+		Name:            &dnsName,
+	}
+
+	if private {
+		compute, err := p.getEc2Service(config)
+		if err != nil {
+			return "", err
 		}
 
-		hostedZone, err := dnsService.CreateHostedZone(createHostedZoneInput)
+		vpc, err := p.GetVPC(NewContext(config, nil), compute)
 		if err != nil {
 			return "", err
 		}
 
-		zoneID = *hostedZone.HostedZone.Id
-	} else if err != nil {
+		createHostedZoneInput.HostedZoneConfig = &route53.HostedZoneConfig{
+			PrivateZone: aws.Bool(true),
+			Comment:     aws.String("created by ops"),
+		}
+		createHostedZoneInput.VPC = &route53.VPC{
+			VPCId:     vpc.VpcId,
+			VPCRegion: aws.String(config.CloudConfig.Zone),
+		}
+	}
+
+	hostedZone, err := dnsService.CreateHostedZone(createHostedZoneInput)
+	if err != nil {
+		return "", err
+	}
+
+	return *hostedZone.HostedZone.Id, nil
+}
+
+// FindZoneIDByName returns the id of the hosted zone with the name passed by
+// argument, private with RunConfig.PrivateDNS, empty if there is none
+func (p *AWS) FindZoneIDByName(config *Config, dnsName string) (string, error) {
+	dnsService, err := p.getDNSService(config)
+	if err != nil {
+		return "", err
+	}
+
+	private := config.RunConfig.PrivateDNS
+
+	hostedZones, err := dnsService.ListHostedZonesByName(&route53.ListHostedZonesByNameInput{DNSName: &dnsName})
+	if err != nil {
 		return "", err
-	} else {
-		zoneID = *hostedZones.HostedZones[0].Id
 	}
 
-	return zoneID, nil
+	// zones are listed from the name on, the following ones have other names
+	for _, zone := range hostedZones.HostedZones {
+		if strings.TrimSuffix(aws.StringValue(zone.Name), ".") != dnsName {
+			break
+		}
+
+		if zone.Config != nil && aws.BoolValue(zone.Config.PrivateZone) == private {
+			return aws.StringValue(zone.Id), nil
+		}
+	}
+
+	return "", nil
+}
+
+// domainZoneNames returns the names of the zones the domain name can be in,
+// from the domain name itself down to its last two labels
+func domainZoneNames(domainName string) []string {
+	labels := strings.Split(strings.TrimSuffix(domainName, "."), ".")
+
+	var names []string
+	for i := 0; i < len(labels)-1; i++ {
+		names = append(names, strings.Join(labels[i:], "."))
+	}
+	return names
+}
+
+// FindZoneIDByDomain returns the id of the hosted zone with the longest name
+// among the zones the domain name is in, empty if there is none
+func (p *AWS) FindZoneIDByDomain(config *Config, domainName string) (string, error) {
+	for _, name := range domainZoneNames(domainName) {
+		zoneID, err := p.FindZoneIDByName(config, name)
+		if err != nil || zoneID != "" {
+			return zoneID, err
+		}
+	}
+
+	return "", nil
+}
+
+// awsDNSRecordValues returns the values of the records of the configured
+// type pointing to the instance, its private addresses with RunConfig.PrivateDNS.
+// No values are returned until the instance has the addresses
+func awsDNSRecordValues(config *Config, instance *ec2.Instance) ([]string, error) {
+	recordType, err := DNSRecordType(config)
+	if err != nil {
+		return nil, err
+	}
+
+	private := config.RunConfig.PrivateDNS
+
+	var value string
+	switch {
+	case recordType == "CNAME" && private:
+		value = aws.StringValue(instance.PrivateDnsName)
+	case recordType == "CNAME":
+		value = aws.StringValue(instance.PublicDnsName)
+	case recordType == "AAAA":
+		var values []string
+		for _, eni := range instance.NetworkInterfaces {
+			for _, address := range eni.Ipv6Addresses {
+				values = append(values, aws.StringValue(address.Ipv6Address))
+			}
+		}
+		return values, nil
+	case private:
+		value = aws.StringValue(instance.PrivateIpAddress)
+	default:
+		value = aws.StringValue(instance.PublicIpAddress)
+	}
+
+	if value == "" {
+		return nil, nil
+	}
+
+	return []string{value}, nil
+}
+
+// pointDomainNames points the domain names of the run config to the running
+// instances with the ids passed by argument and tags them with the names
+func (p *AWS) pointDomainNames(ctx *Context, compute *ec2.EC2, ids []string) error {
+	running, err := compute.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(ids),
+	})
+	if err != nil {
+		return err
+	}
+
+	var ips []string
+	for _, reservation := range running.Reservations {
+		for _, instance := range reservation.Instances {
+			values, err := awsDNSRecordValues(ctx.config, instance)
+			if err != nil {
+				return err
+			}
+			ips = append(ips, values...)
+		}
+	}
+
+	err = CreateDNSRecords(ctx.config, ips, p)
+	if err != nil {
+		return err
+	}
+
+	return p.tagDomainName(compute, ids, domainNames(ctx.config))
 }
 
 // DeleteZoneRecordIfExists deletes a record from a DNS zone if it exists
@@ -53,7 +196,12 @@ func (p *AWS) DeleteZoneRecordIfExists(config *Config, zoneID string, recordName
 	}
 
 	for _, record := range records.ResourceRecordSets {
-		if *record.Name == recordName && *record.Type == "A" {
+		if *record.Name != recordName {
+			continue
+		}
+
+		switch *record.Type {
+		case "A", "AAAA", "CNAME":
 			input := &route53.ChangeResourceRecordSetsInput{
 				ChangeBatch: &route53.ChangeBatch{
 					Changes: []*route53.Change{
@@ -76,6 +224,52 @@ func (p *AWS) DeleteZoneRecordIfExists(config *Config, zoneID string, recordName
 	return nil
 }
 
+// ZoneRecords returns the A, AAAA and CNAME records of the name in the zone.
+// Alias records can't be read as records pointing to values
+func (p *AWS) ZoneRecords(config *Config, zoneID string, recordName string) ([]*DNSRecord, error) {
+	dnsService, err := p.getDNSService(config)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := dnsService.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(zoneID),
+		StartRecordName: aws.String(recordName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, recordSet := range existing.ResourceRecordSets {
+		if aws.StringValue(recordSet.Name) != recordName {
+			break
+		}
+
+		recordType := aws.StringValue(recordSet.Type)
+		switch recordType {
+		case "A", "AAAA", "CNAME":
+		default:
+			continue
+		}
+
+		if recordSet.AliasTarget != nil {
+			return nil, fmt.Errorf("%s is an alias of %s", recordName, aws.StringValue(recordSet.AliasTarget.DNSName))
+		}
+
+		for _, value := range recordSet.ResourceRecords {
+			records = append(records, &DNSRecord{
+				Name: recordName,
+				IP:   aws.StringValue(value.Value),
+				Type: recordType,
+				TTL:  int(aws.Int64Value(recordSet.TTL)),
+			})
+		}
+	}
+
+	return records, nil
+}
+
 // CreateZoneRecord creates a record in a DNS zone
 func (p *AWS) CreateZoneRecord(config *Config, zoneID string, record *DNSRecord) error {
 	dnsService, err := p.getDNSService(config)
@@ -111,3 +305,110 @@ func (p *AWS) CreateZoneRecord(config *Config, zoneID string, record *DNSRecord)
 
 	return nil
 }
+
+// recordTypesConflict returns true if a record of type existing must be
+// deleted to create one of recordType with the same name, as a CNAME can't
+// coexist with other records
+func recordTypesConflict(recordType string, existing string) bool {
+	if recordType == existing {
+		return false
+	}
+
+	switch existing {
+	case "A", "AAAA", "CNAME":
+		return recordType == "CNAME" || existing == "CNAME"
+	}
+
+	return false
+}
+
+// recordTypesByName returns the distinct types of the records of each name,
+// e.g. A and AAAA records of a dual stack name
+func recordTypesByName(records []*DNSRecord) map[string][]string {
+	types := map[string][]string{}
+	for _, record := range records {
+		known := false
+		for _, recordType := range types[record.Name] {
+			known = known || recordType == record.Type
+		}
+		if !known {
+			types[record.Name] = append(types[record.Name], record.Type)
+		}
+	}
+	return types
+}
+
+// UpsertZoneRecords creates or replaces the records in a single change. Records
+// sharing name and type are grouped in one record set
+func (p *AWS) UpsertZoneRecords(config *Config, zoneID string, records []*DNSRecord) error {
+	dnsService, err := p.getDNSService(config)
+	if err != nil {
+		return err
+	}
+
+	var changes []*route53.Change
+	recordSets := map[string]*route53.ResourceRecordSet{}
+
+	for name, recordTypes := range recordTypesByName(records) {
+		existing, err := dnsService.ListResourceRecordSets(&route53.ListResourceRecordSetsInput{
+			HostedZoneId:    aws.String(zoneID),
+			StartRecordName: aws.String(name),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, recordSet := range existing.ResourceRecordSets {
+			if aws.StringValue(recordSet.Name) != name {
+				break
+			}
+
+			for _, recordType := range recordTypes {
+				if recordTypesConflict(recordType, aws.StringValue(recordSet.Type)) {
+					changes = append(changes, &route53.Change{
+						Action:            aws.String("DELETE"),
+						ResourceRecordSet: recordSet,
+					})
+					break
+				}
+			}
+		}
+	}
+
+	for _, record := range records {
+		key := record.Name + "/" + record.Type
+
+		recordSet, ok := recordSets[key]
+		if !ok {
+			recordSet = &route53.ResourceRecordSet{
+				Name: aws.String(record.Name),
+				TTL:  aws.Int64(int64(record.TTL)),
+				Type: aws.String(record.Type),
+			}
+			recordSets[key] = recordSet
+
+			changes = append(changes, &route53.Change{
+				Action:            aws.String("UPSERT"),
+				ResourceRecordSet: recordSet,
+			})
+		}
+
+		recordSet.ResourceRecords = append(recordSet.ResourceRecords, &route53.ResourceRecord{
+			Value: aws.String(record.IP),
+		})
+	}
+
+	input := &route53.ChangeResourceRecordSetsInput{
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: changes,
+		},
+		HostedZoneId: aws.String(zoneID),
+	}
+
+	_, err = dnsService.ChangeResourceRecordSets(input)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
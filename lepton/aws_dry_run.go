@@ -0,0 +1,179 @@
+package lepton
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// SupportsDryRun returns true, aws requests are sent with DryRun set to check
+// the changes they would make
+func (p *AWS) SupportsDryRun() bool {
+	return true
+}
+
+// dryRunf prints a change a dry run would make
+func dryRunf(format string, a ...interface{}) {
+	fmt.Printf("Dry run: "+format+"\n", a...)
+}
+
+// dryRunRequest prints the change of an ec2 request sent with DryRun if aws
+// answered it would have succeeded, and returns the error of the request
+// otherwise, e.g. missing permissions
+func dryRunRequest(err error, format string, a ...interface{}) error {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "DryRunOperation" {
+		dryRunf(format, a...)
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("dry run request unexpectedly succeeded")
+	}
+	return err
+}
+
+// awsTagsString formats tags as comma separated key=value pairs
+func awsTagsString(tags []*ec2.Tag) string {
+	var pairs []string
+	for _, tag := range tags {
+		pairs = append(pairs, aws.StringValue(tag.Key)+"="+aws.StringValue(tag.Value))
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// firewallRuleString describes an ingress rule, e.g. tcp 80 from 0.0.0.0/0
+func firewallRuleString(rule *ec2.IpPermission) string {
+	from := aws.Int64Value(rule.FromPort)
+	to := aws.Int64Value(rule.ToPort)
+
+	ports := strconv.FormatInt(from, 10)
+	if to != from {
+		ports += "-" + strconv.FormatInt(to, 10)
+	}
+
+	var sources []string
+	for _, r := range rule.IpRanges {
+		sources = append(sources, aws.StringValue(r.CidrIp))
+	}
+	for _, r := range rule.Ipv6Ranges {
+		sources = append(sources, aws.StringValue(r.CidrIpv6))
+	}
+
+	return fmt.Sprintf("%s %s from %s", aws.StringValue(rule.IpProtocol), ports, strings.Join(sources, ", "))
+}
+
+// dryRunDeployImage prints the resources an image deploy would create
+func (p *AWS) dryRunDeployImage(ctx *Context, imagePath string) {
+	c := ctx.config
+	bucket := c.CloudConfig.BucketName
+	key := c.CloudConfig.ImageName
+
+	if imagePath != "" {
+		dryRunf("would upload %s to s3://%s/%s", imagePath, bucket, key)
+	}
+
+	dryRunf("would import a snapshot of s3://%s/%s and delete the object", bucket, key)
+
+	tags := []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(key)}}
+	dryRunf("would register ami %s<timestamp> %q with tags %s", key, imageDescription(c), awsTagsString(withDefaultTags(c, withDeployIDTag(ctx, withImageMetadataTags(c, tags)))))
+
+	if c.CloudConfig.EnaSupport {
+		dryRunf("would enable ENA on the ami")
+	}
+}
+
+// dryRunSecurityGroup prints the security group instance create would create
+// in the vpc
+func (p *AWS) dryRunSecurityGroup(ctx *Context, vpcID string) error {
+	rules, err := p.securityGroupRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	var allowed []string
+	for _, rule := range rules {
+		allowed = append(allowed, firewallRuleString(rule))
+	}
+
+	if len(allowed) == 0 {
+		dryRunf("would create a security group in %s without ingress rules", vpcID)
+	} else {
+		dryRunf("would create a security group in %s allowing %s", vpcID, strings.Join(allowed, "; "))
+	}
+
+	roles, err := roleRules(ctx.config)
+	if err != nil {
+		return err
+	}
+	for _, rule := range roles {
+		dryRunf("would allow role %s", rule)
+	}
+
+	return nil
+}
+
+// dryRunTargetGroup prints the target group instance create would register
+// the instances with
+func (p *AWS) dryRunTargetGroup(ctx *Context) {
+	c := &ctx.config.CloudConfig
+	if c.TargetGroupARN != "" {
+		dryRunf("would register the instances with target group %s", c.TargetGroupARN)
+		return
+	}
+
+	dryRunf("would register the instances with target group %s of load balancer %s, both created if missing", c.LoadBalancer, c.LoadBalancer)
+}
+
+// dryRunDeleteInstances checks the instances can be terminated and prints
+// what their deletion would change
+func (p *AWS) dryRunDeleteInstances(ctx *Context, compute *ec2.EC2, instanceIDs []string, protected []string) error {
+	for _, id := range protected {
+		dryRunf("would disable termination protection of instance %s", id)
+	}
+
+	// protected instances fail the dry run as they do the termination
+	var terminated []string
+	skip := map[string]bool{}
+	for _, id := range protected {
+		skip[id] = true
+	}
+	for _, id := range instanceIDs {
+		if !skip[id] {
+			terminated = append(terminated, id)
+		}
+	}
+
+	if len(terminated) > 0 {
+		_, err := compute.TerminateInstances(&ec2.TerminateInstancesInput{
+			InstanceIds: aws.StringSlice(terminated),
+			DryRun:      aws.Bool(true),
+		})
+		err = dryRunRequest(err, "would terminate instances %s", strings.Join(terminated, ", "))
+		if err != nil {
+			return err
+		}
+	}
+	if len(protected) > 0 {
+		dryRunf("would terminate instances %s", strings.Join(protected, ", "))
+	}
+
+	if ctx.config.RunConfig.KeepSG {
+		return nil
+	}
+
+	for _, id := range instanceIDs {
+		groups, err := p.getInstanceSecurityGroups(compute, id)
+		if err != nil {
+			return err
+		}
+
+		for _, sg := range groups {
+			dryRunf("would delete security group %s of instance %s", aws.StringValue(sg), id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package lepton
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// flowLogDestinationType returns the flow log destination type of the
+// cloudwatch log group or s3 bucket arn passed by argument
+func flowLogDestinationType(arn string) (string, error) {
+	parts := strings.SplitN(arn, ":", 4)
+	if len(parts) < 4 || parts[0] != "arn" {
+		return "", fmt.Errorf("invalid flow log destination %q, expected a log group or bucket arn", arn)
+	}
+
+	switch parts[2] {
+	case "logs":
+		return ec2.LogDestinationTypeCloudWatchLogs, nil
+	case "s3":
+		return ec2.LogDestinationTypeS3, nil
+	}
+
+	return "", fmt.Errorf("unsupported flow log destination %q, expected a log group or bucket arn", arn)
+}
+
+// validateFlowLogConfig checks the flow log settings of the cloud config
+func validateFlowLogConfig(c *ProviderConfig) error {
+	if c.FlowLogDestination == "" {
+		return nil
+	}
+
+	destinationType, err := flowLogDestinationType(c.FlowLogDestination)
+	if err != nil {
+		return err
+	}
+
+	if destinationType == ec2.LogDestinationTypeCloudWatchLogs && c.FlowLogRole == "" {
+		return fmt.Errorf("flow logs to cloudwatch require a flowlogrole allowed to publish to the log group")
+	}
+
+	switch strings.ToUpper(c.FlowLogTraffic) {
+	case "", ec2.TrafficTypeAll, ec2.TrafficTypeAccept, ec2.TrafficTypeReject:
+	default:
+		return fmt.Errorf("invalid flow log traffic %q, expected ALL, ACCEPT or REJECT", c.FlowLogTraffic)
+	}
+
+	return nil
+}
+
+// createFlowLogs publishes the traffic of the network interfaces of instance
+// to the flow log destination of the cloud config
+func (p *AWS) createFlowLogs(ctx *Context, compute *ec2.EC2, instance *ec2.Instance, tags []*ec2.Tag) error {
+	c := &ctx.config.CloudConfig
+
+	var enis []*string
+	for _, eni := range instance.NetworkInterfaces {
+		enis = append(enis, eni.NetworkInterfaceId)
+	}
+
+	if len(enis) == 0 {
+		return nil
+	}
+
+	destinationType, err := flowLogDestinationType(c.FlowLogDestination)
+	if err != nil {
+		return err
+	}
+
+	traffic := strings.ToUpper(c.FlowLogTraffic)
+	if traffic == "" {
+		traffic = ec2.TrafficTypeAll
+	}
+
+	input := &ec2.CreateFlowLogsInput{
+		ResourceIds:        enis,
+		ResourceType:       aws.String(ec2.FlowLogsResourceTypeNetworkInterface),
+		TrafficType:        aws.String(traffic),
+		LogDestination:     aws.String(c.FlowLogDestination),
+		LogDestinationType: aws.String(destinationType),
+		TagSpecifications: []*ec2.TagSpecification{
+			{ResourceType: aws.String(ec2.ResourceTypeVpcFlowLog), Tags: tags},
+		},
+	}
+
+	if c.FlowLogRole != "" {
+		input.DeliverLogsPermissionArn = aws.String(c.FlowLogRole)
+	}
+
+	result, err := compute.CreateFlowLogs(input)
+	if err != nil {
+		return fmt.Errorf("create flow logs: %v", err)
+	}
+
+	if len(result.Unsuccessful) > 0 {
+		item := result.Unsuccessful[0]
+		return fmt.Errorf("create flow log of %s: %s", aws.StringValue(item.ResourceId), aws.StringValue(item.Error.Message))
+	}
+
+	ctx.logger.Log("Created flow logs %s", strings.Join(aws.StringValueSlice(result.FlowLogIds), ", "))
+
+	return nil
+}
+
+// deleteFlowLogs deletes the flow logs ops created for the network interfaces
+// of the instances. Must be called before the instances are terminated as
+// their interfaces are deleted with them
+func (p *AWS) deleteFlowLogs(ctx *Context, compute *ec2.EC2, instanceIDs []string) error {
+	interfaces, err := compute.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("attachment.instance-id"), Values: aws.StringSlice(instanceIDs)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var enis []*string
+	for _, eni := range interfaces.NetworkInterfaces {
+		enis = append(enis, eni.NetworkInterfaceId)
+	}
+
+	if len(enis) == 0 {
+		return nil
+	}
+
+	flowLogs, err := compute.DescribeFlowLogs(&ec2.DescribeFlowLogsInput{
+		Filter: []*ec2.Filter{
+			{Name: aws.String("resource-id"), Values: enis},
+			{Name: aws.String("tag:CreatedBy"), Values: aws.StringSlice([]string{"ops"})},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var ids []*string
+	for _, flowLog := range flowLogs.FlowLogs {
+		ids = append(ids, flowLog.FlowLogId)
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err = compute.DeleteFlowLogs(&ec2.DeleteFlowLogsInput{
+		FlowLogIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx.logger.Log("Deleted flow logs %s", strings.Join(aws.StringValueSlice(ids), ", "))
+
+	return nil
+}
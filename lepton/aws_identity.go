@@ -0,0 +1,234 @@
+package lepton
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// IdentityDocument is the instance identity document served by the instance
+// metadata service at /latest/dynamic/instance-identity/document
+type IdentityDocument struct {
+	AccountID        string    `json:"accountId"`
+	Architecture     string    `json:"architecture"`
+	AvailabilityZone string    `json:"availabilityZone"`
+	ImageID          string    `json:"imageId"`
+	InstanceID       string    `json:"instanceId"`
+	InstanceType     string    `json:"instanceType"`
+	PendingTime      time.Time `json:"pendingTime"`
+	PrivateIP        string    `json:"privateIp"`
+	Region           string    `json:"region"`
+}
+
+// Attestation binds a verified identity document to the instance ops deployed
+type Attestation struct {
+	Name       string           `json:"name"`
+	Document   IdentityDocument `json:"document"`
+	Signature  string           `json:"signature"`
+	VerifiedAt time.Time        `json:"verifiedAt"`
+}
+
+// ParseIdentityDocument verifies the base64 signature of document, served at
+// /latest/dynamic/instance-identity/signature, with the pem encoded AWS public
+// certificate of the instance region and returns the parsed document
+func ParseIdentityDocument(document []byte, signature []byte, certificate []byte) (*IdentityDocument, error) {
+	block, _ := pem.Decode(certificate)
+	if block == nil {
+		return nil, fmt.Errorf("invalid certificate, expected pem encoded data")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid certificate, expected a rsa public key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(signature)), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %v", err)
+	}
+
+	digest := sha256.Sum256(document)
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig)
+	if err != nil {
+		return nil, fmt.Errorf("identity document signature verification failed")
+	}
+
+	doc := &IdentityDocument{}
+	err = json.Unmarshal(document, doc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity document: %v", err)
+	}
+
+	return doc, nil
+}
+
+// awsRegionPattern matches aws region names, e.g. us-west-2 or us-gov-east-1
+var awsRegionPattern = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+// identityCertificatePath returns the file holding the AWS public certificate
+// pinned for the identity documents of the region
+func identityCertificatePath(region string) string {
+	return path.Join(GetOpsHome(), "certificates", "aws", region+".pem")
+}
+
+// PinIdentityCertificate pins the pem encoded AWS public certificate the
+// identity documents of the region are verified with, as published in the
+// EC2 documentation. A different certificate already pinned for the region
+// is only replaced with force
+func PinIdentityCertificate(region string, certificate []byte, force bool) error {
+	if !awsRegionPattern.MatchString(region) {
+		return fmt.Errorf("invalid region %q", region)
+	}
+
+	block, _ := pem.Decode(certificate)
+	if block == nil {
+		return fmt.Errorf("invalid certificate, expected pem encoded data")
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid certificate: %v", err)
+	}
+	if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+		return fmt.Errorf("invalid certificate, expected a rsa public key")
+	}
+
+	certPath := identityCertificatePath(region)
+	pinned, err := ioutil.ReadFile(certPath)
+	if err == nil && !bytes.Equal(pinned, certificate) && !force {
+		return fmt.Errorf("a different certificate is pinned for %s, replace it with --force", region)
+	}
+
+	err = os.MkdirAll(path.Dir(certPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(certPath, certificate, 0644)
+}
+
+// identityCertificate returns the certificate pinned for the region
+func identityCertificate(region string) ([]byte, error) {
+	if !awsRegionPattern.MatchString(region) {
+		return nil, fmt.Errorf("invalid identity document region %q", region)
+	}
+
+	certificate, err := ioutil.ReadFile(identityCertificatePath(region))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no certificate pinned for %s, pin the AWS public certificate of the region with ops instance trust-certificate", region)
+	}
+	return certificate, err
+}
+
+// VerifyInstanceIdentity verifies the identity document and signature reported
+// by the instance named instancename match the instance ops deployed in the
+// configured account, region and image. The signature is verified with the
+// certificate pinned for the region of the document, documents of regions
+// without one are rejected. The verified document is recorded in the ops home
+// as the attestation of the instance
+func (p *AWS) VerifyInstanceIdentity(ctx *Context, instancename string, document []byte, signature []byte) (*Attestation, error) {
+	unverified := &IdentityDocument{}
+	err := json.Unmarshal(document, unverified)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity document: %v", err)
+	}
+
+	certificate, err := identityCertificate(unverified.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := ParseIdentityDocument(document, signature, certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	if doc.Region != ctx.config.CloudConfig.Zone {
+		return nil, fmt.Errorf("identity document region %s doesn't match %s", doc.Region, ctx.config.CloudConfig.Zone)
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := compute.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice([]string{doc.InstanceID}),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe instance %s: %v", doc.InstanceID, err)
+	}
+
+	if len(result.Reservations) == 0 || len(result.Reservations[0].Instances) == 0 {
+		return nil, fmt.Errorf("instance %s not found", doc.InstanceID)
+	}
+
+	reservation := result.Reservations[0]
+	instance := reservation.Instances[0]
+
+	var name string
+	for _, tag := range instance.Tags {
+		if aws.StringValue(tag.Key) == "Name" {
+			name = aws.StringValue(tag.Value)
+		}
+	}
+
+	switch {
+	case name != instancename:
+		return nil, fmt.Errorf("identity document belongs to instance %s (%s), not %s", doc.InstanceID, name, instancename)
+	case aws.StringValue(reservation.OwnerId) != doc.AccountID:
+		return nil, fmt.Errorf("identity document account %s doesn't match instance account %s", doc.AccountID, aws.StringValue(reservation.OwnerId))
+	case aws.StringValue(instance.ImageId) != doc.ImageID:
+		return nil, fmt.Errorf("identity document image %s doesn't match instance image %s", doc.ImageID, aws.StringValue(instance.ImageId))
+	}
+
+	attestation := &Attestation{
+		Name:       instancename,
+		Document:   *doc,
+		Signature:  strings.TrimSpace(string(signature)),
+		VerifiedAt: time.Now().UTC(),
+	}
+
+	err = saveAttestation(attestation)
+	if err != nil {
+		return nil, err
+	}
+
+	return attestation, nil
+}
+
+// saveAttestation records the attestation of an instance in the ops home
+func saveAttestation(attestation *Attestation) error {
+	dir := path.Join(GetOpsHome(), "attestations")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(attestation, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path.Join(dir, attestation.Document.InstanceID+".json"), data, 0644)
+}
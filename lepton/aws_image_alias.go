@@ -0,0 +1,171 @@
+package lepton
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// LatestImageAlias is the alias moved to every new image of a name, deploys
+// move it once the image is rolled out
+const LatestImageAlias = "latest"
+
+// awsAliasTagPrefix prefixes the ami tags holding the aliases of an image
+const awsAliasTagPrefix = "Alias:"
+
+// ParseImageRef splits an image reference in the form name:ref, where ref is
+// an alias or the build version of an image
+func ParseImageRef(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+	if i == -1 {
+		return image, ""
+	}
+
+	return image[:i], image[i+1:]
+}
+
+// selectAWSImageRef returns the image with the Name tag name referenced by
+// ref. ref is looked up as an alias first and as a build version otherwise,
+// the newest image is returned if ref is empty
+func selectAWSImageRef(images []*ec2.Image, name string, ref string) (*ec2.Image, error) {
+	if ref != "" {
+		for _, image := range images {
+			if awsImageTag(image, "Name") == name && awsImageTag(image, awsAliasTagPrefix+ref) != "" {
+				return image, nil
+			}
+		}
+	}
+
+	return selectAWSImage(images, name, ref)
+}
+
+// moveImageAlias points the alias of the images with the Name tag name to the
+// ami imageID, removing it from the image holding it before
+func (p *AWS) moveImageAlias(ctx *Context, compute *ec2.EC2, name string, alias string, imageID string) error {
+	key := awsAliasTagPrefix + alias
+
+	result, err := compute.DescribeImages(&ec2.DescribeImagesInput{
+		Owners: aws.StringSlice([]string{"self"}),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:Name"), Values: aws.StringSlice([]string{name})},
+			{Name: aws.String("tag-key"), Values: aws.StringSlice([]string{key})},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var previous []*string
+	for _, image := range result.Images {
+		if aws.StringValue(image.ImageId) != imageID {
+			previous = append(previous, image.ImageId)
+		}
+	}
+
+	if len(previous) > 0 {
+		_, err = compute.DeleteTags(&ec2.DeleteTagsInput{
+			Resources: previous,
+			Tags:      []*ec2.Tag{{Key: aws.String(key)}},
+		})
+		if err != nil {
+			return fmt.Errorf("remove alias %s: %v", alias, err)
+		}
+	}
+
+	_, err = compute.CreateTags(&ec2.CreateTagsInput{
+		Resources: aws.StringSlice([]string{imageID}),
+		Tags:      []*ec2.Tag{{Key: aws.String(key), Value: aws.String("true")}},
+	})
+	if err != nil {
+		return fmt.Errorf("add alias %s: %v", alias, err)
+	}
+
+	invalidateAWSImageCache(ctx, aws.StringValue(compute.Config.Region), name)
+
+	return nil
+}
+
+// SetImageAlias points alias to the image referenced by image in the form
+// name:ref, ref being an alias or build version. The newest image of the name
+// is used if there's no ref
+func (p *AWS) SetImageAlias(ctx *Context, image string, alias string) error {
+	if alias == "" || strings.Contains(alias, ":") {
+		return fmt.Errorf("invalid alias %q", alias)
+	}
+
+	name, ref := ParseImageRef(image)
+
+	images, err := getAWSImagesByName(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	selected, err := selectAWSImageRef(images, name, ref)
+	if err != nil {
+		return err
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	err = p.moveImageAlias(ctx, compute, name, alias, aws.StringValue(selected.ImageId))
+	if err != nil {
+		return err
+	}
+
+	ctx.logger.Log("%s:%s -> %s (%s)", name, alias, aws.StringValue(selected.ImageId), aws.StringValue(selected.Name))
+
+	return nil
+}
+
+// createdImageIDs returns the ids of the images created by the operation of
+// the summary
+func createdImageIDs(summary OperationSummary) []string {
+	var ids []string
+	for _, resource := range summary.Created {
+		if resource.Kind == "image" {
+			ids = append(ids, resource.ID)
+		}
+	}
+	return ids
+}
+
+// DiscardDeployedImages deregisters the images deployed with the context,
+// e.g. one whose canary failed, so they aren't launched by name. Reused
+// images that weren't created by the deploy are kept
+func (p *AWS) DiscardDeployedImages(ctx *Context) error {
+	c := ctx.config
+
+	compute, err := p.getEc2Service(c)
+	if err != nil {
+		return err
+	}
+
+	ids := createdImageIDs(ctx.Summary())
+	if len(ids) == 0 {
+		return nil
+	}
+
+	result, err := compute.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: aws.StringSlice(ids),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, image := range result.Images {
+		err = p.deregisterImage(compute, image)
+		if err != nil {
+			return err
+		}
+		ctx.recordDeleted("image", aws.StringValue(image.ImageId))
+		ctx.logger.Log("Deregistered image %s", aws.StringValue(image.ImageId))
+	}
+	invalidateAWSImageCache(ctx, c.CloudConfig.Zone, c.CloudConfig.ImageName)
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package lepton
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// AWSImageCacheTTL is how long an image lookup by name is reused before
+// querying AWS again
+var AWSImageCacheTTL = 5 * time.Minute
+
+type awsImageCacheEntry struct {
+	Images  []*ec2.Image `json:"images"`
+	Fetched time.Time    `json:"fetched"`
+}
+
+// awsImageCachePath returns the file caching the image lookups of region
+func awsImageCachePath(region string) string {
+	return path.Join(GetOpsHome(), "cache", fmt.Sprintf("aws-images-%s.json", region))
+}
+
+func readAWSImageCache(region string) map[string]awsImageCacheEntry {
+	entries := map[string]awsImageCacheEntry{}
+
+	data, err := ioutil.ReadFile(awsImageCachePath(region))
+	if err != nil {
+		return entries
+	}
+
+	// a corrupted cache is discarded
+	if json.Unmarshal(data, &entries) != nil {
+		return map[string]awsImageCacheEntry{}
+	}
+
+	return entries
+}
+
+func writeAWSImageCache(region string, entries map[string]awsImageCacheEntry) error {
+	cachePath := awsImageCachePath(region)
+
+	err := os.MkdirAll(path.Dir(cachePath), 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(cachePath, data, 0644)
+}
+
+// getAWSImagesByName returns the images of the configured region with the
+// Name tag passed by argument. Lookups are cached locally for AWSImageCacheTTL
+func getAWSImagesByName(ctx *Context, name string) ([]*ec2.Image, error) {
+	region := ctx.config.CloudConfig.Zone
+	entries := readAWSImageCache(region)
+
+	if entry, ok := entries[name]; ok && time.Since(entry.Fetched) < AWSImageCacheTTL {
+		return entry.Images, nil
+	}
+
+	svc, err := newAWSSession(&ctx.config.CloudConfig, region)
+	if err != nil {
+		return nil, err
+	}
+	compute := ec2.New(svc)
+
+	result, err := compute.DescribeImages(&ec2.DescribeImagesInput{
+		Owners: aws.StringSlice([]string{"self"}),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:Name"), Values: aws.StringSlice([]string{name})},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// don't cache missing images so they are found as soon as they are created
+	if len(result.Images) == 0 {
+		return nil, nil
+	}
+
+	entries[name] = awsImageCacheEntry{
+		Images:  result.Images,
+		Fetched: time.Now(),
+	}
+
+	err = writeAWSImageCache(region, entries)
+	if err != nil {
+		ctx.logger.Warn("unable to write image cache: %v", err)
+	}
+
+	return result.Images, nil
+}
+
+// invalidateAWSImageCache removes the cached lookup of the image name in region
+func invalidateAWSImageCache(ctx *Context, region string, name string) {
+	entries := readAWSImageCache(region)
+	if _, ok := entries[name]; !ok {
+		return
+	}
+
+	delete(entries, name)
+
+	err := writeAWSImageCache(region, entries)
+	if err != nil {
+		ctx.logger.Warn("unable to write image cache: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsRunConfigTag prefixes the instance tags holding the config the instance
+// was created with, RunConfig1, RunConfig2...
+const awsRunConfigTag = "RunConfig"
+
+// maxRunConfigTags is the most tags the recorded config is split into, out of
+// the 50 tags of an instance
+const maxRunConfigTags = 8
+
+// awsTagValueSize is the longest value of an aws tag
+const awsTagValueSize = 256
+
+// runConfigTags returns the tags recording the config instances are created
+// with. The config isn't recorded if it can't be encoded in maxRunConfigTags
+func (p *AWS) runConfigTags(ctx *Context) []*ec2.Tag {
+	settings, err := instanceConfig(ctx.config)
+	if err != nil {
+		ctx.logger.Warn("unable to record instance config: %v", err)
+		return nil
+	}
+
+	chunks, err := encodeInstanceConfig(settings, awsTagValueSize)
+	if err != nil {
+		ctx.logger.Warn("unable to record instance config: %v", err)
+		return nil
+	}
+
+	if len(chunks) > maxRunConfigTags {
+		ctx.logger.Warn("instance config too large to be recorded, its drift won't be detected")
+		return nil
+	}
+
+	var tags []*ec2.Tag
+	for i, chunk := range chunks {
+		tags = append(tags, &ec2.Tag{
+			Key:   aws.String(awsRunConfigTag + strconv.Itoa(i+1)),
+			Value: aws.String(chunk),
+		})
+	}
+
+	return tags
+}
+
+// recordedRunConfig returns the config recorded in the instance tags, nil if
+// the instance has none
+func recordedRunConfig(instance *ec2.Instance) (map[string]string, error) {
+	chunks := map[int]string{}
+	for _, tag := range instance.Tags {
+		key := aws.StringValue(tag.Key)
+		if !strings.HasPrefix(key, awsRunConfigTag) {
+			continue
+		}
+
+		i, err := strconv.Atoi(strings.TrimPrefix(key, awsRunConfigTag))
+		if err != nil {
+			continue
+		}
+		chunks[i] = aws.StringValue(tag.Value)
+	}
+
+	if len(chunks) == 0 {
+		return nil, nil
+	}
+
+	var indexes []int
+	for i := range chunks {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	var ordered []string
+	for _, i := range indexes {
+		ordered = append(ordered, chunks[i])
+	}
+
+	settings, err := decodeInstanceConfig(ordered)
+	if err != nil {
+		return nil, fmt.Errorf("decode config of instance %s: %v", aws.StringValue(instance.InstanceId), err)
+	}
+
+	return settings, nil
+}
+
+// DiffInstanceConfig compares the config the instance was created with to the
+// local config and returns the settings that drifted
+func (p *AWS) DiffInstanceConfig(ctx *Context, instanceName string) ([]ConfigDrift, error) {
+	svc, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:Name"), Values: aws.StringSlice([]string{instanceName})},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Reservations) == 0 || len(result.Reservations[0].Instances) == 0 {
+		return nil, ErrInstanceNotFound(instanceName)
+	}
+
+	recorded, err := recordedRunConfig(result.Reservations[0].Instances[0])
+	if err != nil {
+		return nil, err
+	}
+	if recorded == nil {
+		return nil, errors.New("instance " + instanceName + " has no recorded config, it was created by an older version of ops")
+	}
+
+	// instances are created with the default flavor
+	c := *ctx.config
+	if c.CloudConfig.Flavor == "" {
+		c.CloudConfig.Flavor = "t2.micro"
+	}
+
+	current, err := instanceConfig(&c)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffInstanceConfig(recorded, current), nil
+}
+
+// PrintInstanceConfigDiff prints the settings of the local config that drifted
+// from the config the instance was created with
+func (p *AWS) PrintInstanceConfigDiff(ctx *Context, instanceName string) error {
+	drift, err := p.DiffInstanceConfig(ctx, instanceName)
+	if err != nil {
+		return err
+	}
+
+	printConfigDrift(ctx, instanceName, drift)
+
+	return nil
+}
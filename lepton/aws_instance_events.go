@@ -0,0 +1,319 @@
+package lepton
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/olekukonko/tablewriter"
+)
+
+// InstanceEvent is a maintenance event aws scheduled on an instance
+type InstanceEvent struct {
+	InstanceID  string
+	Code        string // instance-reboot, system-reboot, system-maintenance, instance-retirement or instance-stop
+	Description string
+	NotBefore   time.Time
+	NotAfter    time.Time
+}
+
+// String describes the event for warnings
+func (e InstanceEvent) String() string {
+	s := fmt.Sprintf("%s scheduled on instance %s from %s", e.Code, e.InstanceID, e.NotBefore.UTC().Format(time.RFC3339))
+	if !e.NotAfter.IsZero() {
+		s += " to " + e.NotAfter.UTC().Format(time.RFC3339)
+	}
+	if e.Description != "" {
+		s += ": " + e.Description
+	}
+	return s
+}
+
+// pendingEvents returns the events of the instance status that haven't
+// completed or been canceled, earliest first. AWS keeps those for a while
+// with their description prefixed by their state
+func pendingEvents(status *ec2.InstanceStatus) []InstanceEvent {
+	var events []InstanceEvent
+	for _, event := range status.Events {
+		description := aws.StringValue(event.Description)
+		if strings.HasPrefix(description, "[Completed]") || strings.HasPrefix(description, "[Canceled]") {
+			continue
+		}
+
+		events = append(events, InstanceEvent{
+			InstanceID:  aws.StringValue(status.InstanceId),
+			Code:        aws.StringValue(event.Code),
+			Description: description,
+			NotBefore:   aws.TimeValue(event.NotBefore),
+			NotAfter:    aws.TimeValue(event.NotAfter),
+		})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].NotBefore.Before(events[j].NotBefore)
+	})
+
+	return events
+}
+
+// rebootResolves returns true if rebooting the instance completes all its
+// events, stopping and starting it is required otherwise
+func rebootResolves(events []InstanceEvent) bool {
+	for _, event := range events {
+		if event.Code != ec2.EventCodeInstanceReboot {
+			return false
+		}
+	}
+	return true
+}
+
+// scheduledEvents returns the pending events of the instances with the ids
+// passed by argument, stopped ones included
+func scheduledEvents(svc *ec2.EC2, instanceIDs []string) (map[string][]InstanceEvent, error) {
+	events := map[string][]InstanceEvent{}
+	if len(instanceIDs) == 0 {
+		return events, nil
+	}
+
+	err := svc.DescribeInstanceStatusPages(&ec2.DescribeInstanceStatusInput{
+		InstanceIds:         aws.StringSlice(instanceIDs),
+		IncludeAllInstances: aws.Bool(true),
+	}, func(page *ec2.DescribeInstanceStatusOutput, lastPage bool) bool {
+		for _, status := range page.InstanceStatuses {
+			if pending := pendingEvents(status); len(pending) > 0 {
+				events[aws.StringValue(status.InstanceId)] = pending
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe instance status: %v", err)
+	}
+
+	return events, nil
+}
+
+// cloudInstanceIDs returns the ids of the instances
+func cloudInstanceIDs(instances []CloudInstance) []string {
+	var ids []string
+	for _, instance := range instances {
+		ids = append(ids, instance.ID)
+	}
+	return ids
+}
+
+// printEventWarnings warns about the scheduled events of the instances
+func printEventWarnings(logger *Logger, events map[string][]InstanceEvent, ids []string) {
+	var warned bool
+	for _, id := range ids {
+		for _, event := range events[id] {
+			logger.Warn("%s", event.String())
+			warned = true
+		}
+	}
+
+	if warned {
+		logger.Warn("run 'ops instance migrate' to move the affected instances to healthy hardware ahead of the events")
+	}
+}
+
+// InstanceEvents returns the pending scheduled events of the ops instances
+func (p *AWS) InstanceEvents(ctx *Context) ([]InstanceEvent, error) {
+	instances, err := p.GetInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.instanceEvents(ctx, instances)
+}
+
+// instanceEvents returns the pending scheduled events of the instances
+func (p *AWS) instanceEvents(ctx *Context, instances []CloudInstance) ([]InstanceEvent, error) {
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := cloudInstanceIDs(instances)
+	byInstance, err := scheduledEvents(compute, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []InstanceEvent
+	for _, id := range ids {
+		events = append(events, byInstance[id]...)
+	}
+
+	return events, nil
+}
+
+// ListInstanceEvents prints the pending scheduled events of the ops instances
+func (p *AWS) ListInstanceEvents(ctx *Context) error {
+	events, err := p.InstanceEvents(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(events) == 0 {
+		fmt.Println("No scheduled events")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Instance", "Event", "Not Before", "Not After", "Description"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
+	table.SetRowLine(true)
+
+	for _, event := range events {
+		var notAfter string
+		if !event.NotAfter.IsZero() {
+			notAfter = event.NotAfter.UTC().Format(time.RFC3339)
+		}
+
+		table.Append([]string{
+			event.InstanceID,
+			event.Code,
+			event.NotBefore.UTC().Format(time.RFC3339),
+			notAfter,
+			event.Description,
+		})
+	}
+
+	table.Render()
+
+	return nil
+}
+
+// MigrateInstance moves the instance, given by id or name, off the hardware
+// its scheduled events are about. Instances only scheduled for a reboot are
+// rebooted, others are stopped and started again, which places them on new
+// hardware and changes their public ip, so the domain name pointed to the
+// instance is updated
+func (p *AWS) MigrateInstance(ctx *Context, instance string) error {
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	source, err := p.describeInstance(compute, instance)
+	if err != nil {
+		return err
+	}
+	id := aws.StringValue(source.InstanceId)
+
+	// stopping and starting a stopped instance would start it
+	if state := aws.StringValue(source.State.Name); state != ec2.InstanceStateNameRunning {
+		return fmt.Errorf("instance %s is %s, only running instances are migrated", id, state)
+	}
+
+	events, err := scheduledEvents(compute, []string{id})
+	if err != nil {
+		return err
+	}
+
+	if len(events[id]) > 0 && rebootResolves(events[id]) {
+		return p.RebootInstance(ctx, id)
+	}
+
+	if source.InstanceLifecycle != nil {
+		return fmt.Errorf("instance %s is a spot instance and can't be stopped, delete and recreate it instead", id)
+	}
+	if aws.StringValue(source.RootDeviceType) != ec2.DeviceTypeEbs {
+		return fmt.Errorf("instance %s boots from instance store and can't be stopped, delete and recreate it instead", id)
+	}
+
+	err = p.StopInstances(ctx, []string{id})
+	if err != nil || ctx.config.RunConfig.DryRun {
+		return err
+	}
+
+	input := &ec2.DescribeInstancesInput{InstanceIds: aws.StringSlice([]string{id})}
+
+	err = compute.WaitUntilInstanceStopped(input)
+	if err != nil {
+		return fmt.Errorf("wait for instance %s to stop: %v", id, err)
+	}
+
+	err = p.StartInstances(ctx, []string{id})
+	if err != nil {
+		return err
+	}
+
+	err = compute.WaitUntilInstanceRunning(input)
+	if err != nil {
+		return fmt.Errorf("wait for instance %s to start: %v", id, err)
+	}
+
+	ctx.logger.Log("Migrated instance %s", id)
+
+	domains := taggedDomainNames(source)
+	if len(domains) == 0 {
+		return nil
+	}
+
+	migrated, err := p.describeInstance(compute, id)
+	if err != nil {
+		return err
+	}
+
+	config := *ctx.config
+	config.RunConfig.DomainName = ""
+	config.RunConfig.DomainNames = domains
+
+	values, err := awsDNSRecordValues(&config, migrated)
+	if err != nil {
+		return err
+	}
+
+	return CreateDNSRecords(&config, values, p)
+}
+
+// MigrateScheduledInstances migrates the running ops instances with pending
+// scheduled events, stopped instances are left stopped
+func (p *AWS) MigrateScheduledInstances(ctx *Context) error {
+	instances, err := p.GetInstances(ctx)
+	if err != nil {
+		return err
+	}
+
+	var running []CloudInstance
+	for _, instance := range instances {
+		if instance.Status == ec2.InstanceStateNameRunning {
+			running = append(running, instance)
+		}
+	}
+
+	events, err := p.instanceEvents(ctx, running)
+	if err != nil {
+		return err
+	}
+
+	migrated := map[string]bool{}
+	for _, event := range events {
+		if migrated[event.InstanceID] {
+			continue
+		}
+		migrated[event.InstanceID] = true
+
+		err = p.MigrateInstance(ctx, event.InstanceID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(migrated) == 0 {
+		ctx.logger.Log("No instances with scheduled events")
+	}
+
+	return nil
+}
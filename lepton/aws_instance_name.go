@@ -0,0 +1,233 @@
+package lepton
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsDomainNameTag is the instance tag holding the domain name pointed to it
+const awsDomainNameTag = "DomainName"
+
+// maxNameSuffix is the highest suffix tried to make an instance name unique
+const maxNameSuffix = 100
+
+// instanceNamesInUse returns the names among names held by instances that
+// are not terminated
+func (p *AWS) instanceNamesInUse(compute *ec2.EC2, names []string) ([]string, error) {
+	result, err := compute.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:Name"), Values: aws.StringSlice(names)},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe instances named %s: %v", strings.Join(names, ", "), err)
+	}
+
+	var used []string
+	seen := map[string]bool{}
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			for _, tag := range instance.Tags {
+				name := aws.StringValue(tag.Value)
+				if aws.StringValue(tag.Key) == "Name" && !seen[name] {
+					seen[name] = true
+					used = append(used, name)
+				}
+			}
+		}
+	}
+
+	return used, nil
+}
+
+// instanceNames returns the names of count instances named after template
+func instanceNames(template string, count int) []string {
+	var names []string
+	for i := 1; i <= count; i++ {
+		names = append(names, instanceName(template, i))
+	}
+	return names
+}
+
+// uniqueInstanceNameTemplate returns the template of count instance names
+// none of which is held by another instance. With RunConfig.AutoSuffixName
+// taken names are suffixed with the lowest free number, otherwise an error
+// is returned
+func (p *AWS) uniqueInstanceNameTemplate(ctx *Context, compute *ec2.EC2, template string, count int) (string, error) {
+	candidate := template
+
+	for suffix := 2; suffix <= maxNameSuffix; suffix++ {
+		used, err := p.instanceNamesInUse(compute, instanceNames(candidate, count))
+		if err != nil {
+			return "", err
+		}
+
+		if len(used) == 0 {
+			return candidate, nil
+		}
+
+		if !ctx.config.RunConfig.AutoSuffixName {
+			return "", fmt.Errorf("instance names %s are taken, choose another name or enable AutoSuffixName", strings.Join(used, ", "))
+		}
+
+		candidate = template + "-" + strconv.Itoa(suffix)
+	}
+
+	return "", fmt.Errorf("no free instance name for %s", template)
+}
+
+// renamedDomain returns the domain name of an instance renamed from name to
+// newName, when the first label of the domain is the instance name. Returns
+// an empty string if the domain isn't derived from the name
+func renamedDomain(domain string, name string, newName string) string {
+	i := strings.Index(domain, ".")
+	if i == -1 || domain[:i] != name {
+		return ""
+	}
+
+	return newName + domain[i:]
+}
+
+// RenameInstance sets the Name tag of the instance, given by id or name, to
+// newName. The domain names pointed to the instance whose first label is the
+// instance name are moved to the new name, with the type and ttl of their
+// records
+func (p *AWS) RenameInstance(ctx *Context, instance string, newName string) error {
+	if newName == "" {
+		return fmt.Errorf("new name of instance %s missing", instance)
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	source, err := p.describeInstance(compute, instance)
+	if err != nil {
+		return err
+	}
+
+	used, err := p.instanceNamesInUse(compute, []string{newName})
+	if err != nil {
+		return err
+	}
+
+	if len(used) > 0 {
+		return fmt.Errorf("instance name %s is taken", newName)
+	}
+
+	id := aws.StringValue(source.InstanceId)
+	name := awsInstanceTag(source, "Name")
+
+	_, err = compute.CreateTags(&ec2.CreateTagsInput{
+		Resources: aws.StringSlice([]string{id}),
+		Tags:      []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String(newName)}},
+	})
+	if err != nil {
+		return fmt.Errorf("rename instance %s: %v", id, err)
+	}
+
+	ctx.logger.Log("Renamed instance %s from %s to %s", id, name, newName)
+
+	domains := taggedDomainNames(source)
+
+	var moved, added, kept []string
+	for _, domain := range domains {
+		if newDomain := renamedDomain(domain, name, newName); newDomain != "" {
+			moved = append(moved, domain)
+			added = append(added, newDomain)
+			kept = append(kept, newDomain)
+		} else {
+			kept = append(kept, domain)
+		}
+	}
+
+	if len(moved) == 0 {
+		return nil
+	}
+
+	config := *ctx.config
+	config.RunConfig.DomainName = ""
+
+	// the new records keep the type and ttl of the moved ones
+	for i, domain := range moved {
+		config.RunConfig.DomainNames = []string{added[i]}
+		config.RunConfig.DNSRecordType = ctx.config.RunConfig.DNSRecordType
+		config.RunConfig.DNSTTL = ctx.config.RunConfig.DNSTTL
+
+		record, err := domainRecord(&config, p, domain)
+		if err != nil {
+			return fmt.Errorf("read DNS records of %s: %v", domain, err)
+		}
+		if record != nil {
+			config.RunConfig.DNSRecordType = record.Type
+			config.RunConfig.DNSTTL = record.TTL
+		}
+
+		values, err := awsDNSRecordValues(&config, source)
+		if err != nil {
+			return err
+		}
+
+		err = CreateDNSRecords(&config, values, p)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.tagDomainName(compute, []string{id}, kept)
+	if err != nil {
+		return err
+	}
+
+	// the old records are removed once the new ones exist
+	config.RunConfig.DomainNames = moved
+	err = DeleteDNSRecords(&config, p)
+	if err != nil {
+		return err
+	}
+
+	for i, domain := range moved {
+		ctx.logger.Log("Moved domain %s to %s", domain, added[i])
+	}
+
+	return nil
+}
+
+// tagDomainName records the domain names pointed to the instances, comma
+// separated
+func (p *AWS) tagDomainName(compute *ec2.EC2, instanceIDs []string, domains []string) error {
+	domain := strings.Join(domains, ",")
+	_, err := compute.CreateTags(&ec2.CreateTagsInput{
+		Resources: aws.StringSlice(instanceIDs),
+		Tags:      []*ec2.Tag{{Key: aws.String(awsDomainNameTag), Value: aws.String(domain)}},
+	})
+	if err != nil {
+		return fmt.Errorf("tag instances with domain %s: %v", domain, err)
+	}
+	return nil
+}
+
+// taggedDomainNames returns the domain names pointed to the instance
+func taggedDomainNames(instance *ec2.Instance) []string {
+	tag := awsInstanceTag(instance, awsDomainNameTag)
+	if tag == "" {
+		return nil
+	}
+	return strings.Split(tag, ",")
+}
+
+// awsInstanceTag returns the value of the instance tag with key
+func awsInstanceTag(instance *ec2.Instance, key string) string {
+	for _, tag := range instance.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package lepton
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// instanceFamily returns the letters naming the family of an instance type,
+// e.g. g for g4dn.xlarge and inf for inf1.2xlarge
+func instanceFamily(flavor string) string {
+	i := strings.IndexFunc(flavor, func(r rune) bool { return !unicode.IsLetter(r) })
+	if i == -1 {
+		return flavor
+	}
+	return flavor[:i]
+}
+
+// isAcceleratedFlavor returns true if the instance type belongs to a family
+// with gpus, inference or training accelerators, or fpgas
+func isAcceleratedFlavor(flavor string) bool {
+	switch instanceFamily(flavor) {
+	case "p", "g", "dl", "inf", "trn", "f", "vt":
+		return true
+	}
+	return false
+}
+
+// acceleratorSummary describes the accelerators of an instance type, e.g.
+// "4 x NVIDIA V100". Returns an empty string if it has none
+func acceleratorSummary(info *ec2.InstanceTypeInfo) string {
+	var devices []string
+
+	add := func(count *int64, manufacturer *string, name *string) {
+		devices = append(devices, fmt.Sprintf("%d x %s %s", aws.Int64Value(count), aws.StringValue(manufacturer), aws.StringValue(name)))
+	}
+
+	if info.GpuInfo != nil {
+		for _, gpu := range info.GpuInfo.Gpus {
+			add(gpu.Count, gpu.Manufacturer, gpu.Name)
+		}
+	}
+
+	if info.InferenceAcceleratorInfo != nil {
+		for _, accelerator := range info.InferenceAcceleratorInfo.Accelerators {
+			add(accelerator.Count, accelerator.Manufacturer, accelerator.Name)
+		}
+	}
+
+	if info.FpgaInfo != nil {
+		for _, fpga := range info.FpgaInfo.Fpgas {
+			add(fpga.Count, fpga.Manufacturer, fpga.Name)
+		}
+	}
+
+	return strings.Join(devices, ", ")
+}
+
+// describeInstanceTypes returns the description of the instance types by name
+func describeInstanceTypes(svc *ec2.EC2, flavors []string) (map[string]*ec2.InstanceTypeInfo, error) {
+	types := map[string]*ec2.InstanceTypeInfo{}
+
+	err := svc.DescribeInstanceTypesPages(&ec2.DescribeInstanceTypesInput{
+		InstanceTypes: aws.StringSlice(flavors),
+	}, func(page *ec2.DescribeInstanceTypesOutput, lastPage bool) bool {
+		for _, info := range page.InstanceTypes {
+			types[aws.StringValue(info.InstanceType)] = info
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe instance types %s: %v", strings.Join(flavors, ", "), err)
+	}
+
+	return types, nil
+}
+
+// instanceTypeAccelerators returns the accelerator summary of the accelerated
+// instance types among flavors
+func instanceTypeAccelerators(svc *ec2.EC2, flavors []string) (map[string]string, error) {
+	var accelerated []string
+	seen := map[string]bool{}
+	for _, flavor := range flavors {
+		if isAcceleratedFlavor(flavor) && !seen[flavor] {
+			seen[flavor] = true
+			accelerated = append(accelerated, flavor)
+		}
+	}
+
+	accelerators := map[string]string{}
+	if len(accelerated) == 0 {
+		return accelerators, nil
+	}
+
+	types, err := describeInstanceTypes(svc, accelerated)
+	if err != nil {
+		return nil, err
+	}
+
+	for flavor, info := range types {
+		accelerators[flavor] = acceleratorSummary(info)
+	}
+
+	return accelerators, nil
+}
+
+// validateFlavor checks the instance type is offered in the availability
+// zone, or the region without one, and that the image meets its requirements.
+// Most gpu and recent instance types only boot images registered with ENA
+func (p *AWS) validateFlavor(ctx *Context, svc *ec2.EC2, flavor string, ami string) error {
+	location := ctx.config.CloudConfig.Zone
+	input := &ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: aws.String(ec2.LocationTypeRegion),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("instance-type"), Values: aws.StringSlice([]string{flavor})},
+		},
+	}
+
+	if zone := ctx.config.CloudConfig.AvailabilityZone; zone != "" {
+		location = zone
+		input.LocationType = aws.String(ec2.LocationTypeAvailabilityZone)
+		input.Filters = append(input.Filters, &ec2.Filter{Name: aws.String("location"), Values: aws.StringSlice([]string{zone})})
+	}
+
+	offerings, err := svc.DescribeInstanceTypeOfferings(input)
+	if err != nil {
+		return fmt.Errorf("describe instance type offerings of %s: %v", flavor, err)
+	}
+
+	if len(offerings.InstanceTypeOfferings) == 0 {
+		return fmt.Errorf("instance type %s is not offered in %s", flavor, location)
+	}
+
+	types, err := describeInstanceTypes(svc, []string{flavor})
+	if err != nil {
+		return err
+	}
+
+	info, ok := types[flavor]
+	if !ok {
+		return fmt.Errorf("instance type %s not found", flavor)
+	}
+
+	if info.NetworkInfo != nil && aws.StringValue(info.NetworkInfo.EnaSupport) == ec2.EnaSupportRequired {
+		images, err := svc.DescribeImages(&ec2.DescribeImagesInput{
+			ImageIds: aws.StringSlice([]string{ami}),
+		})
+		if err != nil {
+			return fmt.Errorf("describe image %s: %v", ami, err)
+		}
+
+		if len(images.Images) > 0 && !aws.BoolValue(images.Images[0].EnaSupport) {
+			return fmt.Errorf("instance type %s requires ENA, recreate the image with EnaSupport in the cloud config", flavor)
+		}
+	}
+
+	if accelerators := acceleratorSummary(info); accelerators != "" {
+		ctx.logger.Log("Instance type %s has %s", flavor, accelerators)
+	}
+
+	return nil
+}
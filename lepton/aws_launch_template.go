@@ -0,0 +1,128 @@
+package lepton
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// parseLaunchTemplate parses a launch template in the form name:version. The
+// name may be a template id and the version a number, $Latest or $Default,
+// defaulting to $Default
+func parseLaunchTemplate(template string) (*ec2.LaunchTemplateSpecification, error) {
+	parts := strings.SplitN(template, ":", 2)
+	if parts[0] == "" {
+		return nil, fmt.Errorf("invalid launch template %q, expected name:version", template)
+	}
+
+	spec := &ec2.LaunchTemplateSpecification{
+		Version: aws.String("$Default"),
+	}
+
+	if len(parts) == 2 {
+		if parts[1] == "" {
+			return nil, fmt.Errorf("invalid launch template %q, expected name:version", template)
+		}
+		spec.Version = aws.String(parts[1])
+	}
+
+	if strings.HasPrefix(parts[0], "lt-") {
+		spec.LaunchTemplateId = aws.String(parts[0])
+	} else {
+		spec.LaunchTemplateName = aws.String(parts[0])
+	}
+
+	return spec, nil
+}
+
+// getLaunchTemplateData returns the settings of the launch template version
+func (p *AWS) getLaunchTemplateData(svc *ec2.EC2, spec *ec2.LaunchTemplateSpecification) (*ec2.ResponseLaunchTemplateData, error) {
+	result, err := svc.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateId:   spec.LaunchTemplateId,
+		LaunchTemplateName: spec.LaunchTemplateName,
+		Versions:           []*string{spec.Version},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe launch template: %v", err)
+	}
+
+	if len(result.LaunchTemplateVersions) == 0 || result.LaunchTemplateVersions[0].LaunchTemplateData == nil {
+		return nil, fmt.Errorf("launch template version %s not found", aws.StringValue(spec.Version))
+	}
+
+	return result.LaunchTemplateVersions[0].LaunchTemplateData, nil
+}
+
+// applyLaunchTemplate launches the instance of runInput from the launch
+// template configured in the run config. Settings configured in ops take
+// precedence, the template tags, security groups and root volume encryption
+// are kept along with them since run instances parameters replace the
+// template ones. flavorSet is false if the instance type is the ops default
+func (p *AWS) applyLaunchTemplate(ctx *Context, svc *ec2.EC2, runInput *ec2.RunInstancesInput, flavorSet bool) error {
+	spec, err := parseLaunchTemplate(ctx.config.RunConfig.LaunchTemplate)
+	if err != nil {
+		return err
+	}
+
+	data, err := p.getLaunchTemplateData(svc, spec)
+	if err != nil {
+		return err
+	}
+
+	if len(data.NetworkInterfaces) > 0 {
+		return fmt.Errorf("launch templates with network interfaces are not supported, ops configures the instance subnet and security groups")
+	}
+
+	runInput.LaunchTemplate = spec
+
+	if !flavorSet && data.InstanceType != nil {
+		runInput.InstanceType = nil
+	}
+
+	runInput.SecurityGroupIds = append(data.SecurityGroupIds, runInput.SecurityGroupIds...)
+
+	for _, templateSpec := range data.TagSpecifications {
+		for _, tagSpec := range runInput.TagSpecifications {
+			if aws.StringValue(tagSpec.ResourceType) == aws.StringValue(templateSpec.ResourceType) {
+				tagSpec.Tags = mergeAWSTags(templateSpec.Tags, tagSpec.Tags)
+			}
+		}
+	}
+
+	for _, device := range runInput.BlockDeviceMappings {
+		for _, templateDevice := range data.BlockDeviceMappings {
+			if aws.StringValue(templateDevice.DeviceName) != aws.StringValue(device.DeviceName) || templateDevice.Ebs == nil {
+				continue
+			}
+
+			if device.Ebs.KmsKeyId == nil && templateDevice.Ebs.KmsKeyId != nil {
+				device.Ebs.Encrypted = aws.Bool(true)
+				device.Ebs.KmsKeyId = templateDevice.Ebs.KmsKeyId
+			} else if device.Ebs.Encrypted == nil {
+				device.Ebs.Encrypted = templateDevice.Ebs.Encrypted
+			}
+		}
+	}
+
+	return nil
+}
+
+// mergeAWSTags returns base with the tags of overrides, replacing the base
+// tags with the same key
+func mergeAWSTags(base []*ec2.Tag, overrides []*ec2.Tag) []*ec2.Tag {
+	overridden := map[string]bool{}
+	for _, tag := range overrides {
+		overridden[aws.StringValue(tag.Key)] = true
+	}
+
+	var tags []*ec2.Tag
+	for _, tag := range base {
+		if !overridden[aws.StringValue(tag.Key)] {
+			tags = append(tags, tag)
+		}
+	}
+
+	return append(tags, overrides...)
+}
@@ -0,0 +1,345 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+// awsTargetGroupTag is the instance tag holding the arn of the target group
+// ops registered the instance with
+const awsTargetGroupTag = "TargetGroup"
+
+func (p *AWS) getLoadBalancerService(config *Config) (*elbv2.ELBV2, error) {
+	sess, err := p.getAWSSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return elbv2.New(sess), nil
+}
+
+// loadBalancingEnabled returns true if created instances are registered with
+// a target group
+func loadBalancingEnabled(c *ProviderConfig) bool {
+	return c.TargetGroupARN != "" || c.LoadBalancer != ""
+}
+
+// getELBV2Tags returns the default and deploy id tags in the load balancing
+// api format
+func getELBV2Tags(ctx *Context) []*elbv2.Tag {
+	var tags []*elbv2.Tag
+	for _, tag := range withDefaultTags(ctx.config, withDeployIDTag(ctx, getAWSDefaultTags())) {
+		tags = append(tags, &elbv2.Tag{Key: tag.Key, Value: tag.Value})
+	}
+	return tags
+}
+
+// targetGroupHealthCheck sets the health check of the cloud config on the
+// target group input, http if a path is configured and tcp otherwise
+func targetGroupHealthCheck(c *ProviderConfig, input *elbv2.CreateTargetGroupInput) {
+	input.HealthCheckEnabled = aws.Bool(true)
+	input.HealthCheckProtocol = aws.String(elbv2.ProtocolEnumTcp)
+
+	if c.HealthCheckPath != "" {
+		input.HealthCheckProtocol = aws.String(elbv2.ProtocolEnumHttp)
+		input.HealthCheckPath = aws.String(c.HealthCheckPath)
+	}
+
+	input.HealthCheckPort = aws.String("traffic-port")
+	if c.HealthCheckPort != 0 {
+		input.HealthCheckPort = aws.String(strconv.Itoa(c.HealthCheckPort))
+	}
+}
+
+// ensureTargetGroup returns the arn of the target group instances are
+// registered with. Without a configured target group a network load balancer
+// named after the loadbalancer setting is used, forwarding the first port of
+// the run config to a target group of the same name. The target group, load
+// balancer and listener are each created if missing
+func (p *AWS) ensureTargetGroup(ctx *Context, subnet *ec2.Subnet) (string, error) {
+	c := &ctx.config.CloudConfig
+	if c.TargetGroupARN != "" {
+		return c.TargetGroupARN, nil
+	}
+
+	if len(ctx.config.RunConfig.Ports) == 0 {
+		return "", errors.New("a load balancer requires an instance port")
+	}
+	port := int64(ctx.config.RunConfig.Ports[0])
+
+	svc, err := p.getLoadBalancerService(ctx.config)
+	if err != nil {
+		return "", err
+	}
+
+	groupARN, err := p.ensureLoadBalancerTargetGroup(ctx, svc, subnet, port)
+	if err != nil {
+		return "", err
+	}
+
+	balancerARN, err := p.ensureLoadBalancer(ctx, svc, subnet)
+	if err != nil {
+		return "", err
+	}
+
+	err = ensureListener(svc, c.LoadBalancer, balancerARN, groupARN, port)
+	if err != nil {
+		return "", err
+	}
+
+	return groupARN, nil
+}
+
+// ensureLoadBalancerTargetGroup returns the arn of the target group named
+// after the load balancer, created in the vpc of subnet if missing
+func (p *AWS) ensureLoadBalancerTargetGroup(ctx *Context, svc *elbv2.ELBV2, subnet *ec2.Subnet, port int64) (string, error) {
+	c := &ctx.config.CloudConfig
+
+	existing, err := svc.DescribeTargetGroups(&elbv2.DescribeTargetGroupsInput{
+		Names: aws.StringSlice([]string{c.LoadBalancer}),
+	})
+	if err == nil && len(existing.TargetGroups) > 0 {
+		return aws.StringValue(existing.TargetGroups[0].TargetGroupArn), nil
+	}
+	if aerr, ok := err.(awserr.Error); err != nil && (!ok || aerr.Code() != elbv2.ErrCodeTargetGroupNotFoundException) {
+		return "", fmt.Errorf("describe target group %s: %v", c.LoadBalancer, err)
+	}
+
+	groupInput := &elbv2.CreateTargetGroupInput{
+		Name:       aws.String(c.LoadBalancer),
+		Protocol:   aws.String(elbv2.ProtocolEnumTcp),
+		Port:       aws.Int64(port),
+		VpcId:      subnet.VpcId,
+		TargetType: aws.String(elbv2.TargetTypeEnumInstance),
+		Tags:       getELBV2Tags(ctx),
+	}
+	targetGroupHealthCheck(c, groupInput)
+
+	group, err := svc.CreateTargetGroup(groupInput)
+	if err != nil {
+		return "", fmt.Errorf("create target group %s: %v", c.LoadBalancer, err)
+	}
+
+	return aws.StringValue(group.TargetGroups[0].TargetGroupArn), nil
+}
+
+// loadBalancerSubnets returns the subnets of a load balancer, subnet and the
+// subnets of the other availability zones in the order of zones
+func loadBalancerSubnets(subnet *ec2.Subnet, subnets map[string]*ec2.Subnet, zones []string) []*string {
+	ids := []*string{subnet.SubnetId}
+	for _, zone := range zones {
+		ids = append(ids, subnets[zone].SubnetId)
+	}
+	return ids
+}
+
+// ensureLoadBalancer returns the arn of the network load balancer of the
+// config, created if missing in a subnet of every availability zone of the
+// vpc of subnet so instances of any zone can be reached
+func (p *AWS) ensureLoadBalancer(ctx *Context, svc *elbv2.ELBV2, subnet *ec2.Subnet) (string, error) {
+	c := &ctx.config.CloudConfig
+
+	existing, err := svc.DescribeLoadBalancers(&elbv2.DescribeLoadBalancersInput{
+		Names: aws.StringSlice([]string{c.LoadBalancer}),
+	})
+	if err == nil && len(existing.LoadBalancers) > 0 {
+		return aws.StringValue(existing.LoadBalancers[0].LoadBalancerArn), nil
+	}
+	if aerr, ok := err.(awserr.Error); err != nil && (!ok || aerr.Code() != elbv2.ErrCodeLoadBalancerNotFoundException) {
+		return "", fmt.Errorf("describe load balancer %s: %v", c.LoadBalancer, err)
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return "", err
+	}
+
+	subnets := map[string]*ec2.Subnet{}
+	zones, err := p.otherZoneSubnets(compute, subnet, subnets, false)
+	if err != nil {
+		return "", err
+	}
+
+	lb, err := svc.CreateLoadBalancer(&elbv2.CreateLoadBalancerInput{
+		Name:    aws.String(c.LoadBalancer),
+		Type:    aws.String(elbv2.LoadBalancerTypeEnumNetwork),
+		Scheme:  aws.String(elbv2.LoadBalancerSchemeEnumInternetFacing),
+		Subnets: loadBalancerSubnets(subnet, subnets, zones),
+		Tags:    getELBV2Tags(ctx),
+	})
+	if err != nil {
+		return "", fmt.Errorf("create load balancer %s: %v", c.LoadBalancer, err)
+	}
+	balancer := lb.LoadBalancers[0]
+
+	ctx.logger.Log("Created load balancer %s (%s)", c.LoadBalancer, aws.StringValue(balancer.DNSName))
+
+	return aws.StringValue(balancer.LoadBalancerArn), nil
+}
+
+// ensureListener creates the listener of the load balancer forwarding port
+// to the target group if the load balancer doesn't listen on it yet
+func ensureListener(svc *elbv2.ELBV2, name string, balancerARN string, groupARN string, port int64) error {
+	listeners, err := svc.DescribeListeners(&elbv2.DescribeListenersInput{
+		LoadBalancerArn: aws.String(balancerARN),
+	})
+	if err != nil {
+		return fmt.Errorf("describe load balancer %s listeners: %v", name, err)
+	}
+
+	for _, listener := range listeners.Listeners {
+		if aws.Int64Value(listener.Port) == port {
+			return nil
+		}
+	}
+
+	_, err = svc.CreateListener(&elbv2.CreateListenerInput{
+		LoadBalancerArn: aws.String(balancerARN),
+		Protocol:        aws.String(elbv2.ProtocolEnumTcp),
+		Port:            aws.Int64(port),
+		DefaultActions: []*elbv2.Action{
+			{Type: aws.String(elbv2.ActionTypeEnumForward), TargetGroupArn: aws.String(groupARN)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("create load balancer %s listener: %v", name, err)
+	}
+
+	return nil
+}
+
+// registerTargets registers the instances with the target group once they
+// run and tags them with it so they are deregistered on delete
+func (p *AWS) registerTargets(ctx *Context, compute *ec2.EC2, targetGroupARN string, instanceIDs []string) error {
+	svc, err := p.getLoadBalancerService(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	err = compute.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+	})
+	if err != nil {
+		return fmt.Errorf("wait for instances to register them: %v", err)
+	}
+
+	var targets []*elbv2.TargetDescription
+	for _, id := range instanceIDs {
+		targets = append(targets, &elbv2.TargetDescription{Id: aws.String(id)})
+	}
+
+	_, err = svc.RegisterTargets(&elbv2.RegisterTargetsInput{
+		TargetGroupArn: aws.String(targetGroupARN),
+		Targets:        targets,
+	})
+	if err != nil {
+		return fmt.Errorf("register targets: %v", err)
+	}
+
+	_, err = compute.CreateTags(&ec2.CreateTagsInput{
+		Resources: aws.StringSlice(instanceIDs),
+		Tags:      []*ec2.Tag{{Key: aws.String(awsTargetGroupTag), Value: aws.String(targetGroupARN)}},
+	})
+	if err != nil {
+		return fmt.Errorf("tag targets: %v", err)
+	}
+
+	ctx.logger.Log("Registered %d instances with target group %s", len(instanceIDs), targetGroupARN)
+
+	return nil
+}
+
+// instanceTargetGroups returns the instances grouped by the target group ops
+// registered them with
+func instanceTargetGroups(compute *ec2.EC2, instanceIDs []string) (map[string][]*elbv2.TargetDescription, error) {
+	result, err := compute.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]*elbv2.TargetDescription{}
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			for _, tag := range instance.Tags {
+				if aws.StringValue(tag.Key) == awsTargetGroupTag {
+					arn := aws.StringValue(tag.Value)
+					groups[arn] = append(groups[arn], &elbv2.TargetDescription{Id: instance.InstanceId})
+				}
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// waitTargetsHealthy waits until the instances pass the health checks of the
+// target groups ops registered them with
+func (p *AWS) waitTargetsHealthy(ctx *Context, compute *ec2.EC2, instanceIDs []string) error {
+	groups, err := instanceTargetGroups(compute, instanceIDs)
+	if err != nil {
+		return err
+	}
+
+	if len(groups) == 0 {
+		return nil
+	}
+
+	svc, err := p.getLoadBalancerService(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	for arn, targets := range groups {
+		ctx.logger.Log("Waiting for %d instances to pass the health checks of %s", len(targets), arn)
+
+		err = svc.WaitUntilTargetInService(&elbv2.DescribeTargetHealthInput{
+			TargetGroupArn: aws.String(arn),
+			Targets:        targets,
+		})
+		if err != nil {
+			return fmt.Errorf("wait for targets of %s to be healthy: %v", arn, err)
+		}
+	}
+
+	return nil
+}
+
+// deregisterTargets deregisters the instances from the target groups ops
+// registered them with
+func (p *AWS) deregisterTargets(ctx *Context, compute *ec2.EC2, instanceIDs []string) error {
+	groups, err := instanceTargetGroups(compute, instanceIDs)
+	if err != nil {
+		return err
+	}
+
+	if len(groups) == 0 {
+		return nil
+	}
+
+	svc, err := p.getLoadBalancerService(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	for arn, targets := range groups {
+		_, err = svc.DeregisterTargets(&elbv2.DeregisterTargetsInput{
+			TargetGroupArn: aws.String(arn),
+			Targets:        targets,
+		})
+		if err != nil {
+			return fmt.Errorf("deregister targets from %s: %v", arn, err)
+		}
+
+		ctx.logger.Log("Deregistered %d instances from target group %s", len(targets), arn)
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package lepton
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// DeployLockTTL is how long a deploy lock is held after its last heartbeat
+// before other deploys may take it over, in case the process holding it died
+var DeployLockTTL = 30 * time.Minute
+
+// DeployLock prevents concurrent deploys of the same project. The lock is
+// extended every DeployLockTTL/3 until it's released, so deploys running
+// longer than DeployLockTTL keep it
+type DeployLock struct {
+	table   string
+	name    string
+	owner   string
+	service *dynamodb.DynamoDB
+	logger  *Logger
+	done    chan struct{}
+}
+
+// deployLockOwner identifies the user and process holding a lock
+func deployLockOwner() string {
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+
+	hostname, _ := os.Hostname()
+
+	return fmt.Sprintf("%s@%s:%d", username, hostname, os.Getpid())
+}
+
+// AcquireDeployLock takes the lock of the project name in the dynamodb table
+// configured in the cloud config. The table must have a string hash key
+// named LockID. Returns an error with the current owner if the lock is held
+func (p *AWS) AcquireDeployLock(ctx *Context, name string) (*DeployLock, error) {
+	table := ctx.config.CloudConfig.LockTable
+	if table == "" {
+		return nil, fmt.Errorf("lock table not configured")
+	}
+
+	sess, err := p.getAWSSession(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := &DeployLock{
+		table:   table,
+		name:    name,
+		owner:   deployLockOwner(),
+		service: dynamodb.New(sess),
+		logger:  ctx.logger,
+		done:    make(chan struct{}),
+	}
+
+	now := time.Now()
+	expires := now.Add(DeployLockTTL)
+
+	_, err = lock.service.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item: map[string]*dynamodb.AttributeValue{
+			"LockID":  {S: aws.String(name)},
+			"Owner":   {S: aws.String(lock.owner)},
+			"Expires": {N: aws.String(strconv.FormatInt(expires.Unix(), 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(LockID) OR #expires < :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#expires": aws.String("Expires"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return nil, lock.heldError()
+		}
+		return nil, err
+	}
+
+	ctx.logger.Debug("acquired deploy lock %s as %s", name, lock.owner)
+
+	go lock.heartbeat(DeployLockTTL / 3)
+
+	return lock, nil
+}
+
+// heartbeat extends the lock every interval until it's released
+func (l *DeployLock) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			err := l.extend()
+			if err != nil {
+				l.logger.Warn("unable to extend deploy lock %s: %v", l.name, err)
+			}
+		}
+	}
+}
+
+// extend pushes the expiry of the lock DeployLockTTL from now if it is still
+// held by this process
+func (l *DeployLock) extend() error {
+	expires := time.Now().Add(DeployLockTTL)
+
+	_, err := l.service.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String(l.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"LockID": {S: aws.String(l.name)},
+		},
+		UpdateExpression:    aws.String("SET #expires = :expires"),
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#expires": aws.String("Expires"),
+			"#owner":   aws.String("Owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":expires": {N: aws.String(strconv.FormatInt(expires.Unix(), 10))},
+			":owner":   {S: aws.String(l.owner)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return fmt.Errorf("taken over by another deploy")
+		}
+		return err
+	}
+
+	l.logger.Debug("extended deploy lock %s until %s", l.name, expires.Format(time.RFC3339))
+
+	return nil
+}
+
+// heldError returns the error reporting who holds the lock
+func (l *DeployLock) heldError() error {
+	item, err := l.service.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String(l.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"LockID": {S: aws.String(l.name)},
+		},
+	})
+	if err != nil || item.Item == nil {
+		return fmt.Errorf("deploy of %s is locked", l.name)
+	}
+
+	var owner string
+	if attr, ok := item.Item["Owner"]; ok {
+		owner = aws.StringValue(attr.S)
+	}
+
+	var until string
+	if attr, ok := item.Item["Expires"]; ok {
+		expires, _ := strconv.ParseInt(aws.StringValue(attr.N), 10, 64)
+		until = time.Unix(expires, 0).Format(time.RFC3339)
+	}
+
+	return fmt.Errorf("deploy of %s is locked by %s until %s", l.name, owner, until)
+}
+
+// Release stops extending the lock and frees it if it is still held by this
+// process
+func (l *DeployLock) Release() error {
+	close(l.done)
+
+	_, err := l.service.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(l.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"LockID": {S: aws.String(l.name)},
+		},
+		// owner is a reserved word in dynamodb expressions
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("Owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(l.owner)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return fmt.Errorf("deploy lock %s was taken over by another deploy", l.name)
+		}
+		return err
+	}
+
+	return nil
+}
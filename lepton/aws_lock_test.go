@@ -0,0 +1,77 @@
+package lepton
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestDeployLockHeartbeat(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.Header.Get("X-Amz-Target")
+		mu.Lock()
+		calls[target[strings.Index(target, ".")+1:]]++
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+
+	lock := &DeployLock{
+		table:   "locks",
+		name:    "api",
+		owner:   deployLockOwner(),
+		service: dynamodb.New(sess),
+		logger:  NewLogger(ioutil.Discard),
+		done:    make(chan struct{}),
+	}
+
+	go lock.heartbeat(10 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	err := lock.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	extended := calls["UpdateItem"]
+	deleted := calls["DeleteItem"]
+	mu.Unlock()
+
+	if extended == 0 {
+		t.Error("expected the lock to be extended while held")
+	}
+
+	if deleted != 1 {
+		t.Errorf("expected the lock to be deleted once, got %d", deleted)
+	}
+
+	// the heartbeat stops with the release
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls["UpdateItem"] > extended+1 {
+		t.Errorf("expected the lock not to be extended after its release, got %d extensions", calls["UpdateItem"]-extended)
+	}
+}
@@ -0,0 +1,234 @@
+package lepton
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// ami tags recording the marketplace product and version of an image
+const (
+	awsMarketplaceProductTag = "MarketplaceProduct"
+	awsMarketplaceVersionTag = "MarketplaceVersion"
+)
+
+// MarketplaceVersion describes a version of a marketplace ami product
+type MarketplaceVersion struct {
+	Title             string // version title shown to buyers
+	ReleaseNotes      string
+	UsageInstructions string
+	InstanceType      string // recommended instance type, defaults to t2.micro
+	OSVersion         string // nanos version reported as operating system version
+}
+
+// MarketplaceChangeSet is the request of the marketplace catalog api adding
+// a version to an ami product, e.g.
+// aws marketplace-catalog start-change-set --cli-input-json file://changeset.json
+type MarketplaceChangeSet struct {
+	Catalog   string              `json:"Catalog"`
+	ChangeSet []MarketplaceChange `json:"ChangeSet"`
+}
+
+// MarketplaceChange is a change of a marketplace change set
+type MarketplaceChange struct {
+	ChangeType string            `json:"ChangeType"`
+	Entity     MarketplaceEntity `json:"Entity"`
+	Details    string            `json:"Details"` // json encoded change details
+}
+
+// MarketplaceEntity is the product a marketplace change applies to
+type MarketplaceEntity struct {
+	Type       string `json:"Type"`
+	Identifier string `json:"Identifier"`
+}
+
+type marketplaceDetails struct {
+	Version struct {
+		VersionTitle string `json:"VersionTitle"`
+		ReleaseNotes string `json:"ReleaseNotes"`
+	} `json:"Version"`
+	DeliveryOptions []marketplaceDeliveryOption `json:"DeliveryOptions"`
+}
+
+type marketplaceDeliveryOption struct {
+	Details struct {
+		AmiDeliveryOptionDetails marketplaceAmiDetails `json:"AmiDeliveryOptionDetails"`
+	} `json:"Details"`
+}
+
+type marketplaceAmiDetails struct {
+	AmiSource struct {
+		AmiID                  string `json:"AmiId"`
+		AccessRoleArn          string `json:"AccessRoleArn"`
+		UserName               string `json:"UserName"`
+		OperatingSystemName    string `json:"OperatingSystemName"`
+		OperatingSystemVersion string `json:"OperatingSystemVersion"`
+	} `json:"AmiSource"`
+	UsageInstructions       string                     `json:"UsageInstructions"`
+	RecommendedInstanceType string                     `json:"RecommendedInstanceType"`
+	SecurityGroups          []marketplaceSecurityGroup `json:"SecurityGroups"`
+}
+
+type marketplaceSecurityGroup struct {
+	IPProtocol string   `json:"IpProtocol"`
+	FromPort   int      `json:"FromPort"`
+	ToPort     int      `json:"ToPort"`
+	IPRanges   []string `json:"IpRanges"`
+}
+
+// marketplaceSecurityGroups returns the ingress rules recommended to buyers,
+// the ports opened by the run config
+func marketplaceSecurityGroups(c *Config) ([]marketplaceSecurityGroup, error) {
+	sources := allowedSources(c)
+
+	var groups []marketplaceSecurityGroup
+	for _, port := range c.RunConfig.Ports {
+		groups = append(groups, marketplaceSecurityGroup{"tcp", port, port, sources})
+	}
+
+	for _, portRange := range c.RunConfig.PortRanges {
+		from, to, err := ParsePortRange(portRange)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, marketplaceSecurityGroup{"tcp", from, to, sources})
+	}
+
+	for _, port := range c.RunConfig.UDPPorts {
+		groups = append(groups, marketplaceSecurityGroup{"udp", port, port, sources})
+	}
+
+	return groups, nil
+}
+
+// validateMarketplaceImage returns an error if the marketplace can't ingest
+// the image
+func validateMarketplaceImage(image *ec2.Image) error {
+	if aws.StringValue(image.Architecture) != ec2.ArchitectureValuesX8664 {
+		return fmt.Errorf("image %s architecture %s not supported", aws.StringValue(image.ImageId), aws.StringValue(image.Architecture))
+	}
+
+	for _, mapping := range image.BlockDeviceMappings {
+		if mapping.Ebs != nil && aws.BoolValue(mapping.Ebs.Encrypted) {
+			return fmt.Errorf("image %s has encrypted volumes, the marketplace only ingests unencrypted images, build it without kmskeyid", aws.StringValue(image.ImageId))
+		}
+	}
+
+	return nil
+}
+
+// buildMarketplaceChangeSet returns the change set adding the ami as a new
+// version of the product
+func buildMarketplaceChangeSet(c *Config, amiID string, version MarketplaceVersion) (*MarketplaceChangeSet, error) {
+	if c.CloudConfig.MarketplaceProduct == "" {
+		return nil, errors.New("marketplace product id missing, set marketplaceproduct in the cloud config")
+	}
+
+	if c.CloudConfig.MarketplaceRole == "" {
+		return nil, errors.New("marketplace access role missing, set marketplacerole in the cloud config")
+	}
+
+	if version.Title == "" {
+		return nil, errors.New("marketplace version title missing")
+	}
+
+	var ami marketplaceAmiDetails
+	ami.AmiSource.AmiID = amiID
+	ami.AmiSource.AccessRoleArn = c.CloudConfig.MarketplaceRole
+	// nanos has no login, the user name is only shown to buyers
+	ami.AmiSource.UserName = "nanos"
+	ami.AmiSource.OperatingSystemName = "OTHERLINUX"
+	ami.AmiSource.OperatingSystemVersion = version.OSVersion
+	ami.UsageInstructions = version.UsageInstructions
+
+	ami.RecommendedInstanceType = version.InstanceType
+	if ami.RecommendedInstanceType == "" {
+		ami.RecommendedInstanceType = "t2.micro"
+	}
+
+	groups, err := marketplaceSecurityGroups(c)
+	if err != nil {
+		return nil, err
+	}
+	ami.SecurityGroups = groups
+
+	var option marketplaceDeliveryOption
+	option.Details.AmiDeliveryOptionDetails = ami
+
+	var details marketplaceDetails
+	details.Version.VersionTitle = version.Title
+	details.Version.ReleaseNotes = version.ReleaseNotes
+	details.DeliveryOptions = []marketplaceDeliveryOption{option}
+
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MarketplaceChangeSet{
+		Catalog: "AWSMarketplace",
+		ChangeSet: []MarketplaceChange{
+			{
+				ChangeType: "AddDeliveryOptions",
+				Entity: MarketplaceEntity{
+					Type:       "AmiProduct@1.0",
+					Identifier: c.CloudConfig.MarketplaceProduct,
+				},
+				Details: string(encoded),
+			},
+		},
+	}, nil
+}
+
+// PrepareMarketplaceVersion checks the image referenced by name:ref can be
+// ingested by the marketplace, tags it with the product and version and
+// returns the change set submitting it as a new version of the configured
+// marketplace product
+func (p *AWS) PrepareMarketplaceVersion(ctx *Context, image string, version MarketplaceVersion) (*MarketplaceChangeSet, error) {
+	name, ref := ParseImageRef(image)
+
+	images, err := getAWSImagesByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	selected, err := selectAWSImageRef(images, name, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateMarketplaceImage(selected)
+	if err != nil {
+		return nil, err
+	}
+
+	amiID := aws.StringValue(selected.ImageId)
+
+	changeSet, err := buildMarketplaceChangeSet(ctx.config, amiID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = compute.CreateTags(&ec2.CreateTagsInput{
+		Resources: aws.StringSlice([]string{amiID}),
+		Tags: []*ec2.Tag{
+			{Key: aws.String(awsMarketplaceProductTag), Value: aws.String(ctx.config.CloudConfig.MarketplaceProduct)},
+			{Key: aws.String(awsMarketplaceVersionTag), Value: aws.String(version.Title)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tag image %s: %v", amiID, err)
+	}
+
+	invalidateAWSImageCache(ctx, ctx.config.CloudConfig.Zone, name)
+
+	return changeSet, nil
+}
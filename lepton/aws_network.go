@@ -0,0 +1,371 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsNetworkTag marks the vpc, subnet, internet gateway and route table
+// created by ops in regions without a vpc
+const awsNetworkTag = "OpsNetwork"
+
+// awsNetworkPending is the awsNetworkTag of a vpc until its network is
+// complete, so a network left incomplete by an interrupted creation isn't used
+const awsNetworkPending = "pending"
+
+const (
+	awsNetworkName       = "ops-network"
+	awsNetworkCIDR       = "10.0.0.0/16"
+	awsNetworkSubnetCIDR = "10.0.0.0/20"
+)
+
+// awsNetworkTags returns the tags of the ops managed network resources
+func awsNetworkTags(ctx *Context, resourceType string) []*ec2.TagSpecification {
+	return awsNetworkTagsWith(ctx, resourceType, "true")
+}
+
+// awsNetworkTagsWith returns the tags of the ops managed network resources
+// with value as awsNetworkTag
+func awsNetworkTagsWith(ctx *Context, resourceType string, value string) []*ec2.TagSpecification {
+	tags, _ := parseToAWSTags([]Tag{{Key: awsNetworkTag, Value: value}}, awsNetworkName)
+
+	return []*ec2.TagSpecification{
+		{ResourceType: aws.String(resourceType), Tags: withDefaultTags(ctx.config, withDeployIDTag(ctx, tags))},
+	}
+}
+
+// awsNetworkFilter filters the ops managed network resources
+func awsNetworkFilter() *ec2.Filter {
+	return &ec2.Filter{Name: aws.String("tag:" + awsNetworkTag), Values: aws.StringSlice([]string{"true"})}
+}
+
+// findNetwork returns the ops managed vpc of the region, nil if there's none
+func (p *AWS) findNetwork(svc *ec2.EC2) (*ec2.Vpc, error) {
+	result, err := svc.DescribeVpcs(&ec2.DescribeVpcsInput{
+		Filters: []*ec2.Filter{awsNetworkFilter()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe ops network: %v", err)
+	}
+
+	if len(result.Vpcs) == 0 {
+		return nil, nil
+	}
+
+	return result.Vpcs[0], nil
+}
+
+// CreateNetwork creates a vpc with a public subnet routed to an internet
+// gateway, all tagged as managed by ops, and returns the vpc. The existing
+// ops managed vpc is returned if there's one
+func (p *AWS) CreateNetwork(ctx *Context) (*ec2.Vpc, error) {
+	svc, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.createNetwork(ctx, svc)
+}
+
+// createNetwork creates the ops managed network of the region if there's
+// none. The resources created are deleted if one of the steps fails, and the
+// vpc is only tagged as an ops network once all of them are created
+func (p *AWS) createNetwork(ctx *Context, svc *ec2.EC2) (*ec2.Vpc, error) {
+	vpc, err := p.findNetwork(svc)
+	if err != nil || vpc != nil {
+		return vpc, err
+	}
+
+	err = p.deleteIncompleteNetworks(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+
+	vpcResult, err := svc.CreateVpc(&ec2.CreateVpcInput{
+		CidrBlock:         aws.String(awsNetworkCIDR),
+		TagSpecifications: awsNetworkTagsWith(ctx, "vpc", awsNetworkPending),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create vpc: %v", err)
+	}
+	vpc = vpcResult.Vpc
+
+	// the gateway isn't found from the vpc until it's attached
+	var detachedGateway *string
+	fail := func(err error) (*ec2.Vpc, error) {
+		cleanupErr := p.deleteNetworkResources(svc, vpc, detachedGateway)
+		if cleanupErr != nil {
+			ctx.logger.Warn("unable to delete incomplete network %s: %v", aws.StringValue(vpc.VpcId), cleanupErr)
+		}
+		return nil, err
+	}
+
+	err = svc.WaitUntilVpcAvailable(&ec2.DescribeVpcsInput{VpcIds: []*string{vpc.VpcId}})
+	if err != nil {
+		return fail(fmt.Errorf("wait for vpc %s: %v", aws.StringValue(vpc.VpcId), err))
+	}
+
+	_, err = svc.ModifyVpcAttribute(&ec2.ModifyVpcAttributeInput{
+		VpcId:              vpc.VpcId,
+		EnableDnsHostnames: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+	})
+	if err != nil {
+		return fail(fmt.Errorf("enable vpc dns hostnames: %v", err))
+	}
+
+	subnetInput := &ec2.CreateSubnetInput{
+		VpcId:             vpc.VpcId,
+		CidrBlock:         aws.String(awsNetworkSubnetCIDR),
+		TagSpecifications: awsNetworkTags(ctx, "subnet"),
+	}
+	if ctx.config.CloudConfig.AvailabilityZone != "" {
+		subnetInput.AvailabilityZone = aws.String(ctx.config.CloudConfig.AvailabilityZone)
+	}
+
+	subnet, err := svc.CreateSubnet(subnetInput)
+	if err != nil {
+		return fail(fmt.Errorf("create subnet: %v", err))
+	}
+
+	_, err = svc.ModifySubnetAttribute(&ec2.ModifySubnetAttributeInput{
+		SubnetId:            subnet.Subnet.SubnetId,
+		MapPublicIpOnLaunch: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+	})
+	if err != nil {
+		return fail(fmt.Errorf("enable subnet public ips: %v", err))
+	}
+
+	gateway, err := svc.CreateInternetGateway(&ec2.CreateInternetGatewayInput{
+		TagSpecifications: awsNetworkTags(ctx, "internet-gateway"),
+	})
+	if err != nil {
+		return fail(fmt.Errorf("create internet gateway: %v", err))
+	}
+	detachedGateway = gateway.InternetGateway.InternetGatewayId
+
+	_, err = svc.AttachInternetGateway(&ec2.AttachInternetGatewayInput{
+		InternetGatewayId: gateway.InternetGateway.InternetGatewayId,
+		VpcId:             vpc.VpcId,
+	})
+	if err != nil {
+		return fail(fmt.Errorf("attach internet gateway: %v", err))
+	}
+	detachedGateway = nil
+
+	routeTable, err := svc.CreateRouteTable(&ec2.CreateRouteTableInput{
+		VpcId:             vpc.VpcId,
+		TagSpecifications: awsNetworkTags(ctx, "route-table"),
+	})
+	if err != nil {
+		return fail(fmt.Errorf("create route table: %v", err))
+	}
+
+	_, err = svc.CreateRoute(&ec2.CreateRouteInput{
+		RouteTableId:         routeTable.RouteTable.RouteTableId,
+		DestinationCidrBlock: aws.String("0.0.0.0/0"),
+		GatewayId:            gateway.InternetGateway.InternetGatewayId,
+	})
+	if err != nil {
+		return fail(fmt.Errorf("create internet route: %v", err))
+	}
+
+	_, err = svc.AssociateRouteTable(&ec2.AssociateRouteTableInput{
+		RouteTableId: routeTable.RouteTable.RouteTableId,
+		SubnetId:     subnet.Subnet.SubnetId,
+	})
+	if err != nil {
+		return fail(fmt.Errorf("associate route table: %v", err))
+	}
+
+	_, err = svc.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{vpc.VpcId},
+		Tags:      []*ec2.Tag{{Key: aws.String(awsNetworkTag), Value: aws.String("true")}},
+	})
+	if err != nil {
+		return fail(fmt.Errorf("tag vpc %s: %v", aws.StringValue(vpc.VpcId), err))
+	}
+
+	ctx.logger.Log("Created network %s with subnet %s", aws.StringValue(vpc.VpcId), aws.StringValue(subnet.Subnet.SubnetId))
+
+	return vpc, nil
+}
+
+// deleteIncompleteNetworks deletes the networks whose creation was
+// interrupted before they were complete
+func (p *AWS) deleteIncompleteNetworks(ctx *Context, svc *ec2.EC2) error {
+	result, err := svc.DescribeVpcs(&ec2.DescribeVpcsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:" + awsNetworkTag), Values: aws.StringSlice([]string{awsNetworkPending})},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("describe incomplete ops networks: %v", err)
+	}
+
+	for _, vpc := range result.Vpcs {
+		ctx.logger.Log("Deleting incomplete network %s", aws.StringValue(vpc.VpcId))
+		err = p.deleteNetworkResources(svc, vpc, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteNetwork deletes the ops managed vpc of the region along with its
+// endpoints, route tables, internet gateways, subnets and the security groups
+// ops created in it. Instances in the network must be deleted first
+func (p *AWS) DeleteNetwork(ctx *Context) error {
+	svc, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	vpc, err := p.findNetwork(svc)
+	if err != nil {
+		return err
+	}
+	if vpc == nil {
+		return errors.New("no ops network in the region")
+	}
+
+	vpcFilter := &ec2.Filter{Name: aws.String("vpc-id"), Values: []*string{vpc.VpcId}}
+
+	instances, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			vpcFilter,
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped", "shutting-down"})},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("describe network instances: %v", err)
+	}
+	for _, reservation := range instances.Reservations {
+		if len(reservation.Instances) > 0 {
+			return fmt.Errorf("network %s has instances, delete them first", aws.StringValue(vpc.VpcId))
+		}
+	}
+
+	err = p.deleteNetworkResources(svc, vpc, nil)
+	if err != nil {
+		return err
+	}
+
+	ctx.logger.Log("Deleted network %s", aws.StringValue(vpc.VpcId))
+
+	return nil
+}
+
+// deleteNetworkResources deletes the vpc along with its endpoints, route
+// tables, internet gateways, subnets and security groups, and the internet
+// gateway detachedGateway not attached to it yet if set
+func (p *AWS) deleteNetworkResources(svc *ec2.EC2, vpc *ec2.Vpc, detachedGateway *string) error {
+	vpcFilter := &ec2.Filter{Name: aws.String("vpc-id"), Values: []*string{vpc.VpcId}}
+
+	// the gateway endpoints created by ops are deleted along with their
+	// routes, those of the user are left for them to delete
+	endpoints, err := svc.DescribeVpcEndpoints(&ec2.DescribeVpcEndpointsInput{Filters: []*ec2.Filter{vpcFilter, awsVPCEndpointFilter()}})
+	if err != nil {
+		return fmt.Errorf("describe vpc endpoints: %v", err)
+	}
+	if len(endpoints.VpcEndpoints) > 0 {
+		var ids []*string
+		for _, endpoint := range endpoints.VpcEndpoints {
+			ids = append(ids, endpoint.VpcEndpointId)
+		}
+
+		_, err = svc.DeleteVpcEndpoints(&ec2.DeleteVpcEndpointsInput{VpcEndpointIds: ids})
+		if err != nil {
+			return fmt.Errorf("delete vpc endpoints: %v", err)
+		}
+	}
+
+	routeTables, err := svc.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: []*ec2.Filter{vpcFilter, awsNetworkFilter()},
+	})
+	if err != nil {
+		return fmt.Errorf("describe route tables: %v", err)
+	}
+	for _, table := range routeTables.RouteTables {
+		for _, association := range table.Associations {
+			_, err = svc.DisassociateRouteTable(&ec2.DisassociateRouteTableInput{
+				AssociationId: association.RouteTableAssociationId,
+			})
+			if err != nil {
+				return fmt.Errorf("disassociate route table %s: %v", aws.StringValue(table.RouteTableId), err)
+			}
+		}
+
+		_, err = svc.DeleteRouteTable(&ec2.DeleteRouteTableInput{RouteTableId: table.RouteTableId})
+		if err != nil {
+			return fmt.Errorf("delete route table %s: %v", aws.StringValue(table.RouteTableId), err)
+		}
+	}
+
+	gateways, err := svc.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("attachment.vpc-id"), Values: []*string{vpc.VpcId}},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("describe internet gateways: %v", err)
+	}
+	for _, gateway := range gateways.InternetGateways {
+		_, err = svc.DetachInternetGateway(&ec2.DetachInternetGatewayInput{
+			InternetGatewayId: gateway.InternetGatewayId,
+			VpcId:             vpc.VpcId,
+		})
+		if err != nil {
+			return fmt.Errorf("detach internet gateway %s: %v", aws.StringValue(gateway.InternetGatewayId), err)
+		}
+
+		_, err = svc.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{InternetGatewayId: gateway.InternetGatewayId})
+		if err != nil {
+			return fmt.Errorf("delete internet gateway %s: %v", aws.StringValue(gateway.InternetGatewayId), err)
+		}
+	}
+
+	if detachedGateway != nil {
+		_, err = svc.DeleteInternetGateway(&ec2.DeleteInternetGatewayInput{InternetGatewayId: detachedGateway})
+		if err != nil {
+			return fmt.Errorf("delete internet gateway %s: %v", aws.StringValue(detachedGateway), err)
+		}
+	}
+
+	subnets, err := svc.DescribeSubnets(&ec2.DescribeSubnetsInput{Filters: []*ec2.Filter{vpcFilter}})
+	if err != nil {
+		return fmt.Errorf("describe subnets: %v", err)
+	}
+	for _, subnet := range subnets.Subnets {
+		_, err = svc.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: subnet.SubnetId})
+		if err != nil {
+			return fmt.Errorf("delete subnet %s: %v", aws.StringValue(subnet.SubnetId), err)
+		}
+	}
+
+	groups, err := svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{Filters: []*ec2.Filter{vpcFilter}})
+	if err != nil {
+		return fmt.Errorf("describe security groups: %v", err)
+	}
+	for _, group := range groups.SecurityGroups {
+		if aws.StringValue(group.GroupName) == "default" {
+			continue
+		}
+
+		_, err = svc.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: group.GroupId})
+		if err != nil {
+			return fmt.Errorf("delete security group %s: %v", aws.StringValue(group.GroupId), err)
+		}
+	}
+
+	_, err = svc.DeleteVpc(&ec2.DeleteVpcInput{VpcId: vpc.VpcId})
+	if err != nil {
+		return fmt.Errorf("delete vpc %s: %v", aws.StringValue(vpc.VpcId), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package lepton
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// OperationStatus is the status of a long running operation started in
+// async mode, given by the handle printed when it started: the id of an
+// image snapshot import task or of a launched instance
+type OperationStatus struct {
+	ID       string
+	State    string // state reported by the cloud provider
+	Progress string // completion percentage, empty if not reported
+	Message  string // details of the state, e.g. the error of a failed operation
+	Done     bool
+	Failed   bool
+}
+
+// OperationStatus returns the status of the operation with the handle id
+func (p *AWS) OperationStatus(ctx *Context, id string) (*OperationStatus, error) {
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasPrefix(id, "import-snap-"):
+		result, err := compute.DescribeImportSnapshotTasks(&ec2.DescribeImportSnapshotTasksInput{
+			ImportTaskIds: aws.StringSlice([]string{id}),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe snapshot import %s: %v", id, err)
+		}
+		if len(result.ImportSnapshotTasks) == 0 {
+			return nil, fmt.Errorf("snapshot import %s not found", id)
+		}
+		return importTaskStatus(id, result.ImportSnapshotTasks[0].SnapshotTaskDetail), nil
+	case strings.HasPrefix(id, "i-"):
+		instance, err := p.describeInstance(compute, id)
+		if err != nil {
+			return nil, err
+		}
+		return instanceStatus(id, instance), nil
+	}
+
+	return nil, fmt.Errorf("unknown operation %s, expected a snapshot import or instance id", id)
+}
+
+// importTaskStatus returns the status of a snapshot import
+func importTaskStatus(id string, detail *ec2.SnapshotTaskDetail) *OperationStatus {
+	status := &OperationStatus{ID: id}
+	if detail == nil {
+		return status
+	}
+
+	status.State = aws.StringValue(detail.Status)
+	status.Progress = aws.StringValue(detail.Progress)
+	status.Message = aws.StringValue(detail.StatusMessage)
+
+	switch status.State {
+	case "completed":
+		status.Done = true
+		status.Progress = "100"
+	case "deleting", "deleted":
+		status.Done = true
+		status.Failed = true
+	}
+
+	return status
+}
+
+// instanceStatus returns the status of an instance launch, done once the
+// instance runs
+func instanceStatus(id string, instance *ec2.Instance) *OperationStatus {
+	status := &OperationStatus{ID: id}
+	if instance.State != nil {
+		status.State = aws.StringValue(instance.State.Name)
+	}
+	if instance.StateReason != nil {
+		status.Message = aws.StringValue(instance.StateReason.Message)
+	}
+
+	switch status.State {
+	case ec2.InstanceStateNameRunning:
+		status.Done = true
+	case ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameTerminated, ec2.InstanceStateNameStopping, ec2.InstanceStateNameStopped:
+		status.Done = true
+		status.Failed = true
+	}
+
+	return status
+}
+
+// WaitOperation waits until the operation with the handle id is done. The
+// deploy of an image started in async mode is completed once its snapshot
+// is imported
+func (p *AWS) WaitOperation(ctx *Context, id string) error {
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case strings.HasPrefix(id, "import-snap-"):
+		if findImportDeployState(id) != nil {
+			return p.completeImportDeploy(ctx, id)
+		}
+
+		_, err = p.waitSnapshotToBeReady(ctx, aws.String(id))
+		return err
+	case strings.HasPrefix(id, "i-"):
+		ctx.progress(ProgressInstanceWait, id, ProgressStarted, ProgressUnknown, "waiting for the instance to run")
+
+		err = compute.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
+			InstanceIds: aws.StringSlice([]string{id}),
+		})
+		if err != nil {
+			ctx.progress(ProgressInstanceWait, id, ProgressFailed, ProgressUnknown, "%v", err)
+			return fmt.Errorf("wait for instance %s: %v", id, err)
+		}
+
+		ctx.progress(ProgressInstanceWait, id, ProgressDone, 100, "")
+		ctx.logger.Log("Instance %s running", id)
+		return nil
+	}
+
+	return fmt.Errorf("unknown operation %s, expected a snapshot import or instance id", id)
+}
@@ -0,0 +1,165 @@
+package lepton
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// validateTenancy checks the tenancy of the run config is supported
+func validateTenancy(c *RunConfig) error {
+	switch c.Tenancy {
+	case "", ec2.TenancyDefault, ec2.TenancyDedicated, ec2.TenancyHost:
+		return nil
+	}
+	return fmt.Errorf("invalid tenancy %q, expected default, dedicated or host", c.Tenancy)
+}
+
+// placementGroupExists returns true if the placement group name exists
+func placementGroupExists(svc *ec2.EC2, name string) (bool, error) {
+	result, err := svc.DescribePlacementGroups(&ec2.DescribePlacementGroupsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("group-name"), Values: aws.StringSlice([]string{name})},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("describe placement group %s: %v", name, err)
+	}
+
+	return len(result.PlacementGroups) > 0, nil
+}
+
+// ensurePlacementGroup creates the placement group name with the cluster
+// strategy if it doesn't exist
+func (p *AWS) ensurePlacementGroup(ctx *Context, svc *ec2.EC2, name string) error {
+	exists, err := placementGroupExists(svc, name)
+	if err != nil || exists {
+		return err
+	}
+
+	tags, _ := parseToAWSTags(nil, name)
+
+	_, err = svc.CreatePlacementGroup(&ec2.CreatePlacementGroupInput{
+		GroupName: aws.String(name),
+		Strategy:  aws.String(ec2.PlacementStrategyCluster),
+		TagSpecifications: []*ec2.TagSpecification{
+			{ResourceType: aws.String("placement-group"), Tags: withDefaultTags(ctx.config, withDeployIDTag(ctx, tags))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("create placement group %s: %v", name, err)
+	}
+
+	ctx.logger.Log("Created cluster placement group %s", name)
+
+	return nil
+}
+
+// instancePlacement returns the placement of launched instances, nil if
+// none is configured. A missing placement group is created
+func (p *AWS) instancePlacement(ctx *Context, svc *ec2.EC2) (*ec2.Placement, error) {
+	rc := &ctx.config.RunConfig
+
+	err := validateTenancy(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	placement := &ec2.Placement{}
+
+	if ctx.config.CloudConfig.AvailabilityZone != "" {
+		placement.AvailabilityZone = aws.String(ctx.config.CloudConfig.AvailabilityZone)
+	}
+
+	if rc.PlacementGroup != "" && rc.DryRun {
+		exists, err := placementGroupExists(svc, rc.PlacementGroup)
+		if err != nil {
+			return nil, err
+		}
+
+		// a dry run launch in a missing group fails
+		if exists {
+			placement.GroupName = aws.String(rc.PlacementGroup)
+		} else {
+			dryRunf("would create cluster placement group %s", rc.PlacementGroup)
+		}
+	} else if rc.PlacementGroup != "" {
+		err = p.ensurePlacementGroup(ctx, svc, rc.PlacementGroup)
+		if err != nil {
+			return nil, err
+		}
+		placement.GroupName = aws.String(rc.PlacementGroup)
+	}
+
+	if rc.Tenancy != "" {
+		placement.Tenancy = aws.String(rc.Tenancy)
+	}
+
+	if *placement == (ec2.Placement{}) {
+		return nil, nil
+	}
+
+	return placement, nil
+}
+
+// zoneMovable returns true if instances can be launched in another
+// availability zone than the one of their subnet when it has no capacity,
+// the config pinning neither the subnet, zone, outpost, a cluster placement
+// group, which lives in a single zone, nor dedicated hosts, allocated in the
+// zone of the subnet
+func zoneMovable(config *Config) bool {
+	return config.RunConfig.Subnet == "" && config.RunConfig.PlacementGroup == "" &&
+		config.RunConfig.Tenancy != ec2.TenancyHost &&
+		config.CloudConfig.AvailabilityZone == "" && config.CloudConfig.OutpostARN == ""
+}
+
+// subnetHasIPv6 returns true if an ipv6 cidr block is associated with the
+// subnet, its instances getting ipv6 addresses
+func subnetHasIPv6(subnet *ec2.Subnet) bool {
+	for _, association := range subnet.Ipv6CidrBlockAssociationSet {
+		if association.Ipv6CidrBlockState != nil && aws.StringValue(association.Ipv6CidrBlockState.State) == ec2.SubnetCidrBlockStateCodeAssociated {
+			return true
+		}
+	}
+	return false
+}
+
+// otherZoneSubnets adds the subnets of the vpc of subnet in the other
+// availability zones to subnets, by zone, the default subnet of a zone
+// preferred, and returns their zones. Only subnets with an ipv6 cidr block
+// are considered if ipv6 is set
+func (p *AWS) otherZoneSubnets(svc *ec2.EC2, subnet *ec2.Subnet, subnets map[string]*ec2.Subnet, ipv6 bool) ([]string, error) {
+	result, err := svc.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []*string{subnet.VpcId}},
+			{Name: aws.String("state"), Values: aws.StringSlice([]string{ec2.SubnetStateAvailable})},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe subnets of %s: %v", aws.StringValue(subnet.VpcId), err)
+	}
+
+	var zones []string
+	for _, other := range result.Subnets {
+		zone := aws.StringValue(other.AvailabilityZone)
+		if zone == aws.StringValue(subnet.AvailabilityZone) || other.OutpostArn != nil {
+			continue
+		}
+		if ipv6 && !subnetHasIPv6(other) {
+			continue
+		}
+
+		current, ok := subnets[zone]
+		if !ok {
+			zones = append(zones, zone)
+		}
+		if !ok || (aws.BoolValue(other.DefaultForAz) && !aws.BoolValue(current.DefaultForAz)) {
+			subnets[zone] = other
+		}
+	}
+
+	sort.Strings(zones)
+	return zones, nil
+}
@@ -0,0 +1,80 @@
+package lepton
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsProjectTag is the instance, image and security group tag holding the project of the
+// config they were created with
+const awsProjectTag = "Project"
+
+// withProjectTag returns the tags with the project of the config, if any
+func withProjectTag(c *Config, tags []*ec2.Tag) []*ec2.Tag {
+	result := append([]*ec2.Tag{}, tags...)
+	if c.CloudConfig.Project != "" {
+		result = append(result, &ec2.Tag{Key: aws.String(awsProjectTag), Value: aws.String(c.CloudConfig.Project)})
+	}
+	return result
+}
+
+// projectCapError returns an error if adding resources to the existing ones
+// of the project exceeds its cap. A cap of 0 is no cap
+func projectCapError(project string, resource string, limit int, existing int, adding int) error {
+	if limit <= 0 || existing+adding <= limit {
+		return nil
+	}
+
+	return fmt.Errorf("project %s cap of %d %s exceeded: %d exist, %d requested. Delete some, raise the cap or pass --force to create them anyway",
+		project, limit, resource, existing, adding)
+}
+
+// checkProjectInstances refuses to create count instances if the project of
+// the config would exceed its max instances
+func (p *AWS) checkProjectInstances(ctx *Context, svc *ec2.EC2, count int) error {
+	c := ctx.config
+	if c.CloudConfig.Project == "" || c.CloudConfig.MaxInstances <= 0 || c.RunConfig.ExceedProjectCaps {
+		return nil
+	}
+
+	existing := 0
+	err := svc.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:" + awsProjectTag), Values: aws.StringSlice([]string{c.CloudConfig.Project})},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running", "stopping", "stopped"})},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range page.Reservations {
+			existing += len(reservation.Instances)
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("count instances of project %s: %v", c.CloudConfig.Project, err)
+	}
+
+	return projectCapError(c.CloudConfig.Project, "instances", c.CloudConfig.MaxInstances, existing, count)
+}
+
+// checkProjectImages refuses to create an image if the project of the config
+// would exceed its max images
+func (p *AWS) checkProjectImages(ctx *Context, svc *ec2.EC2) error {
+	c := ctx.config
+	if c.CloudConfig.Project == "" || c.CloudConfig.MaxImages <= 0 || c.RunConfig.ExceedProjectCaps {
+		return nil
+	}
+
+	result, err := svc.DescribeImages(&ec2.DescribeImagesInput{
+		Owners: aws.StringSlice([]string{"self"}),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:" + awsProjectTag), Values: aws.StringSlice([]string{c.CloudConfig.Project})},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("count images of project %s: %v", c.CloudConfig.Project, err)
+	}
+
+	return projectCapError(c.CloudConfig.Project, "images", c.CloudConfig.MaxImages, len(result.Images), 1)
+}
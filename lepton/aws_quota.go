@@ -0,0 +1,162 @@
+package lepton
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+)
+
+// serviceQuota identifies an aws service quota
+type serviceQuota struct {
+	ServiceCode string
+	QuotaCode   string
+	Name        string
+}
+
+// securityGroupsPerVPC is the quota of security groups in a vpc
+var securityGroupsPerVPC = serviceQuota{"vpc", "L-E79EC296", "security groups per VPC"}
+
+// vCPU quotas shared by several instance families
+var (
+	standardVCPUs = serviceQuota{"ec2", "L-1216C47A", "running on-demand standard instance vCPUs"}
+	gpuVCPUs      = serviceQuota{"ec2", "L-DB2E81BA", "running on-demand G and VT instance vCPUs"}
+)
+
+// vcpuQuotas are the quotas of running on-demand vCPUs by instance family
+var vcpuQuotas = map[string]serviceQuota{
+	"a":   standardVCPUs,
+	"c":   standardVCPUs,
+	"d":   standardVCPUs,
+	"h":   standardVCPUs,
+	"i":   standardVCPUs,
+	"m":   standardVCPUs,
+	"r":   standardVCPUs,
+	"t":   standardVCPUs,
+	"z":   standardVCPUs,
+	"g":   gpuVCPUs,
+	"vt":  gpuVCPUs,
+	"p":   {"ec2", "L-417A185B", "running on-demand P instance vCPUs"},
+	"f":   {"ec2", "L-74FC7D96", "running on-demand F instance vCPUs"},
+	"inf": {"ec2", "L-1945791B", "running on-demand Inf instance vCPUs"},
+	"x":   {"ec2", "L-7295265B", "running on-demand X instance vCPUs"},
+	"dl":  {"ec2", "L-6E869C2A", "running on-demand DL instance vCPUs"},
+}
+
+// quotaError returns an error explaining how to proceed if requested more
+// units of the quota exceed its limit on top of the used ones
+func quotaError(quota serviceQuota, limit float64, used float64, requested float64) error {
+	if used+requested <= limit {
+		return nil
+	}
+
+	return fmt.Errorf("%s quota exceeded: %v in use, %v requested, limit %v. Free some or request an increase of quota %s of service %s in the Service Quotas console",
+		quota.Name, used, requested, limit, quota.QuotaCode, quota.ServiceCode)
+}
+
+// quotaLimit returns the value of the quota applied to the account, or its
+// default value if the account has none
+func (p *AWS) quotaLimit(ctx *Context, quota serviceQuota) (float64, error) {
+	sess, err := p.getAWSSession(ctx.config)
+	if err != nil {
+		return 0, err
+	}
+	svc := servicequotas.New(sess)
+
+	result, err := svc.GetServiceQuota(&servicequotas.GetServiceQuotaInput{
+		ServiceCode: aws.String(quota.ServiceCode),
+		QuotaCode:   aws.String(quota.QuotaCode),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == servicequotas.ErrCodeNoSuchResourceException {
+		defaults, err := svc.GetAWSDefaultServiceQuota(&servicequotas.GetAWSDefaultServiceQuotaInput{
+			ServiceCode: aws.String(quota.ServiceCode),
+			QuotaCode:   aws.String(quota.QuotaCode),
+		})
+		if err != nil {
+			return 0, fmt.Errorf("get default quota %s: %v", quota.QuotaCode, err)
+		}
+		return aws.Float64Value(defaults.Quota.Value), nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get quota %s: %v", quota.QuotaCode, err)
+	}
+
+	return aws.Float64Value(result.Quota.Value), nil
+}
+
+// checkVCPUQuota checks count instances of the flavor fit in the running
+// on-demand vCPUs quota of its family. Families without a known quota aren't
+// checked
+func (p *AWS) checkVCPUQuota(ctx *Context, svc *ec2.EC2, flavor string, count int) error {
+	quota, ok := vcpuQuotas[instanceFamily(flavor)]
+	if !ok {
+		return nil
+	}
+
+	types, err := describeInstanceTypes(svc, []string{flavor})
+	if err != nil {
+		return err
+	}
+
+	info, ok := types[flavor]
+	if !ok || info.VCpuInfo == nil {
+		return fmt.Errorf("instance type %s not found", flavor)
+	}
+	requested := float64(aws.Int64Value(info.VCpuInfo.DefaultVCpus) * int64(count))
+
+	var used float64
+	err = svc.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{"pending", "running"})},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.InstanceLifecycle != nil || instance.CpuOptions == nil {
+					continue
+				}
+				if vcpuQuotas[instanceFamily(aws.StringValue(instance.InstanceType))] != quota {
+					continue
+				}
+				used += float64(aws.Int64Value(instance.CpuOptions.CoreCount) * aws.Int64Value(instance.CpuOptions.ThreadsPerCore))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("describe running instances: %v", err)
+	}
+
+	limit, err := p.quotaLimit(ctx, quota)
+	if err != nil {
+		return err
+	}
+
+	return quotaError(quota, limit, used, requested)
+}
+
+// checkSecurityGroupQuota checks another security group can be created in
+// the vpc
+func (p *AWS) checkSecurityGroupQuota(ctx *Context, svc *ec2.EC2, vpcID string) error {
+	var used float64
+	err := svc.DescribeSecurityGroupsPages(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{vpcID})},
+		},
+	}, func(page *ec2.DescribeSecurityGroupsOutput, lastPage bool) bool {
+		used += float64(len(page.SecurityGroups))
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("describe security groups of vpc %s: %v", vpcID, err)
+	}
+
+	limit, err := p.quotaLimit(ctx, securityGroupsPerVPC)
+	if err != nil {
+		return err
+	}
+
+	return quotaError(securityGroupsPerVPC, limit, used, 1)
+}
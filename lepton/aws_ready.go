@@ -0,0 +1,108 @@
+package lepton
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// defaultReadyTimeout is the time in seconds instance create waits for the
+// ready marker if the run config doesn't set one
+const defaultReadyTimeout = 600
+
+// readyPollInterval is the delay between console output reads
+const readyPollInterval = 10 * time.Second
+
+// consoleTail returns the last lines of a console output
+func consoleTail(output string, lines int) string {
+	all := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	return strings.Join(all, "\n")
+}
+
+// instanceConsole returns the console output of the instance, empty until
+// aws collects it
+func instanceConsole(svc *ec2.EC2, id string) (string, error) {
+	result, err := svc.GetConsoleOutput(&ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(id),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(aws.StringValue(result.Output))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// waitInstancesReady waits until the console of every instance shows the
+// ready marker of the run config, the convention for the application to
+// report it initialized. Fails if an instance stops or the timeout expires
+func (p *AWS) waitInstancesReady(ctx *Context, svc *ec2.EC2, ids []string) error {
+	marker := ctx.config.RunConfig.ReadyMarker
+
+	timeout := ctx.config.RunConfig.ReadyTimeout
+	if timeout <= 0 {
+		timeout = defaultReadyTimeout
+	}
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	ctx.logger.Log("Waiting for %q on the console of %d instances", marker, len(ids))
+	for _, id := range ids {
+		ctx.progress(ProgressInstanceWait, id, ProgressStarted, ProgressUnknown, "waiting for %q on the console", marker)
+	}
+
+	pending := append([]string{}, ids...)
+	outputs := map[string]string{}
+
+	for {
+		var waiting []string
+		for _, id := range pending {
+			output, err := instanceConsole(svc, id)
+			if err != nil {
+				ctx.logger.Debug("read console of %s: %v", id, err)
+			} else if output != "" {
+				outputs[id] = output
+			}
+
+			if strings.Contains(outputs[id], marker) {
+				ctx.progress(ProgressInstanceWait, id, ProgressDone, 100, "")
+				ctx.logger.Log("Instance %s ready", id)
+				continue
+			}
+
+			instance, err := p.describeInstance(svc, id)
+			if err == nil {
+				if status := instanceStatus(id, instance); status.Failed {
+					ctx.progress(ProgressInstanceWait, id, ProgressFailed, ProgressUnknown, "instance %s", status.State)
+					return fmt.Errorf("instance %s %s before it was ready:\n%s", id, status.State, consoleTail(outputs[id], 20))
+				}
+			}
+
+			waiting = append(waiting, id)
+		}
+
+		pending = waiting
+		if len(pending) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			for _, id := range pending {
+				ctx.progress(ProgressInstanceWait, id, ProgressFailed, ProgressUnknown, "not ready after %d seconds", timeout)
+			}
+			return fmt.Errorf("instances %s not ready after %d seconds, console of %s:\n%s", strings.Join(pending, ", "), timeout, pending[0], consoleTail(outputs[pending[0]], 20))
+		}
+
+		time.Sleep(readyPollInterval)
+	}
+}
@@ -0,0 +1,385 @@
+package lepton
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsReplicatedFromTag is the ami tag holding the id of the image a replica was copied from
+const awsReplicatedFromTag = "ReplicatedFrom"
+
+// ReplicationState records the images already copied between two regions so
+// an interrupted replication resumes without copying them again, and the
+// copies started in the last hour the rate limit applies to
+type ReplicationState struct {
+	path   string
+	Source string            `json:"source"`
+	Target string            `json:"target"`
+	Images map[string]string `json:"images"`
+	Copies []ReplicatedCopy  `json:"copies,omitempty"`
+}
+
+// ReplicatedCopy is a copy of an image started by a replication
+type ReplicatedCopy struct {
+	Image   string    `json:"image"`
+	Size    int64     `json:"size"` // GiB of the volumes of the image
+	Started time.Time `json:"started"`
+}
+
+// ReplicationLimits throttle the copies of a replication. Zero values don't
+// limit them
+type ReplicationLimits struct {
+	MaxCopies     int   // copies in progress on the target region at the same time
+	MaxGiBPerHour int64 // GiB of images whose copy started in the last hour
+}
+
+// copiedSince returns the GiB of the copies started after since
+func (s *ReplicationState) copiedSince(since time.Time) int64 {
+	var size int64
+	for _, copy := range s.Copies {
+		if copy.Started.After(since) {
+			size += copy.Size
+		}
+	}
+	return size
+}
+
+// allowsCopy returns true if copying size GiB at now keeps the copies of the
+// last hour within the rate limit. An image larger than the limit is copied
+// once no other copy started in the last hour
+func (l ReplicationLimits) allowsCopy(state *ReplicationState, size int64, now time.Time) bool {
+	if l.MaxGiBPerHour <= 0 {
+		return true
+	}
+
+	copied := state.copiedSince(now.Add(-time.Hour))
+	return copied == 0 || copied+size <= l.MaxGiBPerHour
+}
+
+// recordCopy adds the copy to the state, forgetting the copies older than an
+// hour the rate limit doesn't apply to anymore
+func (s *ReplicationState) recordCopy(image string, size int64, now time.Time) {
+	var copies []ReplicatedCopy
+	for _, copy := range s.Copies {
+		if copy.Started.After(now.Add(-time.Hour)) {
+			copies = append(copies, copy)
+		}
+	}
+
+	s.Copies = append(copies, ReplicatedCopy{Image: image, Size: size, Started: now})
+}
+
+// imageSize returns the GiB of the ebs volumes of the image
+func imageSize(image *ec2.Image) int64 {
+	var size int64
+	for _, mapping := range image.BlockDeviceMappings {
+		if mapping.Ebs != nil {
+			size += aws.Int64Value(mapping.Ebs.VolumeSize)
+		}
+	}
+	return size
+}
+
+// validateReplicationTarget returns an error if target isn't an aws region,
+// images are only replicated between regions of aws
+func validateReplicationTarget(target string) error {
+	if awsRegionPattern.MatchString(target) {
+		return nil
+	}
+
+	provider := strings.SplitN(target, ":", 2)[0]
+	for _, other := range []string{"gcp", "azure", "do", "vultr", "openstack", "vsphere", "onprem"} {
+		if provider == other {
+			return fmt.Errorf("replicating images to %s isn't supported, images are only replicated between aws regions", provider)
+		}
+	}
+
+	return fmt.Errorf("invalid target region %q, expected an aws region, e.g. us-west-2", target)
+}
+
+// imageDeleted returns true if the describe images result of a single image
+// confirms it was deleted, false if it exists or the result is an error other
+// than the image not being found
+func imageDeleted(result *ec2.DescribeImagesOutput, err error) (bool, error) {
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == "InvalidAMIID.NotFound" || aerr.Code() == "InvalidAMIID.Unavailable") {
+			return true, nil
+		}
+		return false, err
+	}
+
+	for _, image := range result.Images {
+		if aws.StringValue(image.State) != ec2.ImageStateDeregistered {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// ReplicationResult summarizes the changes of a replication run
+type ReplicationResult struct {
+	Copied  []string
+	Pruned  []string
+	Pending int
+}
+
+// loadReplicationState reads the replication state of the source and target
+// regions from the ops home, returning an empty state if there is none
+func loadReplicationState(source string, target string) (*ReplicationState, error) {
+	dir := path.Join(GetOpsHome(), "replication")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ReplicationState{
+		path:   path.Join(dir, fmt.Sprintf("aws-%s-%s.json", source, target)),
+		Source: source,
+		Target: target,
+		Images: map[string]string{},
+	}
+
+	data, err := ioutil.ReadFile(state.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("invalid replication state %s: %v", state.path, err)
+	}
+
+	if state.Images == nil {
+		state.Images = map[string]string{}
+	}
+
+	return state, nil
+}
+
+// save writes the state, replacing the previous file atomically
+func (s *ReplicationState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// ReplicateImages copies the ops images of the configured zone missing in
+// targetRegion, within the limits, and deletes the replicas whose source
+// image is confirmed deleted. Images are only replicated between aws regions
+func (p *AWS) ReplicateImages(ctx *Context, targetRegion string, limits ReplicationLimits) (*ReplicationResult, error) {
+	sourceRegion := ctx.config.CloudConfig.Zone
+	if sourceRegion == targetRegion {
+		return nil, fmt.Errorf("source and target regions must be different")
+	}
+
+	err := validateReplicationTarget(targetRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := loadReplicationState(sourceRegion, targetRegion)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceImages, err := getAWSImages(&ctx.config.CloudConfig, sourceRegion, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	targetImages, err := getAWSImages(&ctx.config.CloudConfig, targetRegion, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	tcfg := *ctx.config
+	tcfg.CloudConfig.Zone = targetRegion
+	target, err := p.getEc2Service(&tcfg)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := map[string]*ec2.Image{}
+	for _, image := range targetImages.Images {
+		replicas[aws.StringValue(image.ImageId)] = image
+	}
+
+	result := &ReplicationResult{}
+	for _, id := range state.Images {
+		if image, ok := replicas[id]; ok && aws.StringValue(image.State) == ec2.ImageStatePending {
+			result.Pending++
+		}
+	}
+
+	sources := map[string]bool{}
+	for _, image := range sourceImages.Images {
+		name := awsImageTag(image, "Name")
+		if name == "" || awsImageTag(image, awsReplicatedFromTag) != "" {
+			continue
+		}
+
+		sourceID := aws.StringValue(image.ImageId)
+		sources[sourceID] = true
+
+		if aws.StringValue(image.State) != ec2.ImageStateAvailable {
+			continue
+		}
+
+		if replicaID, ok := state.Images[sourceID]; ok {
+			replica, exists := replicas[replicaID]
+			if exists && aws.StringValue(replica.State) != ec2.ImageStateFailed {
+				continue
+			}
+			ctx.logger.Warn("replica %s of image %s is missing, copying it again", replicaID, sourceID)
+		}
+
+		if limits.MaxCopies > 0 && result.Pending >= limits.MaxCopies {
+			ctx.logger.Debug("%d copies in progress, deferring image %s", result.Pending, sourceID)
+			continue
+		}
+
+		size := imageSize(image)
+		if !limits.allowsCopy(state, size, time.Now()) {
+			ctx.logger.Debug("%d GiB copied in the last hour, deferring image %s of %d GiB", state.copiedSince(time.Now().Add(-time.Hour)), sourceID, size)
+			continue
+		}
+
+		ctx.logger.Info("copying image %s (%s) to %s", name, sourceID, targetRegion)
+		replicaID, err := p.copyImage(target, image, sourceRegion)
+		if err != nil {
+			return result, err
+		}
+
+		state.Images[sourceID] = replicaID
+		state.recordCopy(sourceID, size, time.Now())
+		err = state.save()
+		if err != nil {
+			return result, err
+		}
+
+		result.Copied = append(result.Copied, sourceID)
+		result.Pending++
+	}
+
+	for sourceID, replicaID := range state.Images {
+		if sources[sourceID] {
+			continue
+		}
+
+		// an image missing from the listing may only have lost its tags
+		deleted, err := imageDeleted(source.DescribeImages(&ec2.DescribeImagesInput{
+			ImageIds: aws.StringSlice([]string{sourceID}),
+		}))
+		if err != nil {
+			return result, fmt.Errorf("check source image %s of replica %s: %v", sourceID, replicaID, err)
+		}
+		if !deleted {
+			continue
+		}
+
+		if replica, ok := replicas[replicaID]; ok {
+			ctx.logger.Info("deleting replica %s of removed image %s", replicaID, sourceID)
+			err = p.deregisterImage(target, replica)
+			if err != nil {
+				return result, err
+			}
+			result.Pruned = append(result.Pruned, replicaID)
+		}
+
+		delete(state.Images, sourceID)
+		err = state.save()
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// copyImage starts copying image from sourceRegion to the region of the
+// target service and tags the replica with the source image tags
+func (p *AWS) copyImage(target *ec2.EC2, image *ec2.Image, sourceRegion string) (string, error) {
+	out, err := target.CopyImage(&ec2.CopyImageInput{
+		Name:          image.Name,
+		Description:   image.Description,
+		SourceImageId: image.ImageId,
+		SourceRegion:  aws.String(sourceRegion),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	tags := getAWSDefaultTags()
+	for _, tag := range image.Tags {
+		if aws.StringValue(tag.Key) == "CreatedBy" {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	tags = append(tags, &ec2.Tag{
+		Key:   aws.String(awsReplicatedFromTag),
+		Value: image.ImageId,
+	})
+
+	_, err = target.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{out.ImageId},
+		Tags:      tags,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(out.ImageId), nil
+}
+
+// deregisterImage deregisters image and deletes its snapshots
+func (p *AWS) deregisterImage(compute *ec2.EC2, image *ec2.Image) error {
+	_, err := compute.DeregisterImage(&ec2.DeregisterImageInput{
+		ImageId: image.ImageId,
+	})
+	if err != nil {
+		return fmt.Errorf("Error running deregister image operation: %s", err)
+	}
+
+	for _, mapping := range image.BlockDeviceMappings {
+		if mapping.Ebs == nil || mapping.Ebs.SnapshotId == nil {
+			continue
+		}
+
+		_, err = compute.DeleteSnapshot(&ec2.DeleteSnapshotInput{
+			SnapshotId: mapping.Ebs.SnapshotId,
+		})
+		if err != nil {
+			return fmt.Errorf("Error running snapshot delete: %s", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,284 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsRoleTag holds the deployment role of instances and of the security
+// groups created for them
+const awsRoleTag = "OpsRole"
+
+// RoleRule allows the instances of a deployment role to reach ports of the
+// instances of another role in the same vpc and project, e.g. api->worker:9000
+type RoleRule struct {
+	From     string
+	To       string
+	Protocol string // tcp or udp
+	FromPort int64
+	ToPort   int64
+}
+
+// ParseRoleRule parses a rule formatted as <from>-><to>:<port>[/udp], the
+// port being a single port or a range, e.g. api->worker:9000 or
+// api->db-proxy:5432-5433
+func ParseRoleRule(s string) (RoleRule, error) {
+	invalid := fmt.Errorf("invalid role rule %q, expected <from>-><to>:<port>[/udp], e.g. api->worker:9000", s)
+
+	roles := strings.SplitN(s, "->", 2)
+	if len(roles) != 2 {
+		return RoleRule{}, invalid
+	}
+
+	target := strings.SplitN(roles[1], ":", 2)
+	if len(target) != 2 {
+		return RoleRule{}, invalid
+	}
+
+	rule := RoleRule{
+		From:     strings.TrimSpace(roles[0]),
+		To:       strings.TrimSpace(target[0]),
+		Protocol: "tcp",
+	}
+	if rule.From == "" || rule.To == "" {
+		return RoleRule{}, invalid
+	}
+
+	ports := strings.TrimSpace(target[1])
+	if i := strings.Index(ports, "/"); i >= 0 {
+		rule.Protocol = strings.ToLower(ports[i+1:])
+		ports = ports[:i]
+	}
+	if rule.Protocol != "tcp" && rule.Protocol != "udp" {
+		return RoleRule{}, fmt.Errorf("invalid protocol %q of role rule %q, expected tcp or udp", rule.Protocol, s)
+	}
+
+	if strings.Contains(ports, "-") {
+		from, to, err := ParsePortRange(ports)
+		if err != nil {
+			return RoleRule{}, err
+		}
+		rule.FromPort, rule.ToPort = int64(from), int64(to)
+	} else {
+		port, err := strconv.Atoi(ports)
+		if err != nil || port < 1 || port > 65535 {
+			return RoleRule{}, invalid
+		}
+		rule.FromPort, rule.ToPort = int64(port), int64(port)
+	}
+
+	return rule, nil
+}
+
+func (r RoleRule) String() string {
+	ports := strconv.FormatInt(r.FromPort, 10)
+	if r.ToPort != r.FromPort {
+		ports += "-" + strconv.FormatInt(r.ToPort, 10)
+	}
+	return fmt.Sprintf("%s to %s %s %s", r.From, r.To, r.Protocol, ports)
+}
+
+// roleRules returns the rules of the run config, refusing rules without a
+// role to apply them to
+func roleRules(c *Config) ([]RoleRule, error) {
+	if len(c.RunConfig.RoleRules) == 0 {
+		return nil, nil
+	}
+
+	if c.RunConfig.Role == "" {
+		return nil, errors.New("role rules require the role of the instances")
+	}
+
+	if c.RunConfig.SecurityGroup != "" {
+		return nil, errors.New("role rules apply to the security groups created by ops, not to an existing security group")
+	}
+
+	var rules []RoleRule
+	for _, s := range c.RunConfig.RoleRules {
+		rule, err := ParseRoleRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// withRoleTag returns the tags with the deployment role of the config
+func withRoleTag(c *Config, tags []*ec2.Tag) []*ec2.Tag {
+	result := append([]*ec2.Tag{}, tags...)
+	if c.RunConfig.Role != "" {
+		result = append(result, &ec2.Tag{Key: aws.String(awsRoleTag), Value: aws.String(c.RunConfig.Role)})
+	}
+	return result
+}
+
+// roleRulePermission returns the ingress permission of the rule from the
+// security group source
+func roleRulePermission(rule RoleRule, source string) *ec2.IpPermission {
+	return &ec2.IpPermission{
+		IpProtocol: aws.String(rule.Protocol),
+		FromPort:   aws.Int64(rule.FromPort),
+		ToPort:     aws.Int64(rule.ToPort),
+		UserIdGroupPairs: []*ec2.UserIdGroupPair{
+			{GroupId: aws.String(source), Description: aws.String("ops role " + rule.From)},
+		},
+	}
+}
+
+// roleGroupFilters returns the filters of the security groups of the role in
+// the vpc, narrowed to the project of the config if any
+func roleGroupFilters(c *Config, vpcID string, role string) []*ec2.Filter {
+	filters := []*ec2.Filter{
+		{Name: aws.String("vpc-id"), Values: aws.StringSlice([]string{vpcID})},
+		{Name: aws.String("tag:" + awsRoleTag), Values: aws.StringSlice([]string{role})},
+	}
+	if c.CloudConfig.Project != "" {
+		filters = append(filters, &ec2.Filter{Name: aws.String("tag:" + awsProjectTag), Values: aws.StringSlice([]string{c.CloudConfig.Project})})
+	}
+	return filters
+}
+
+// roleSecurityGroups returns the security groups of the role in the vpc, of
+// the project of the config if any. Roles are deployed separately, each
+// deploy with its own deploy id, so groups aren't matched on it
+func (p *AWS) roleSecurityGroups(ctx *Context, svc *ec2.EC2, vpcID string, role string) ([]string, error) {
+	result, err := svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: roleGroupFilters(ctx.config, vpcID, role),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe security groups of role %s: %v", role, err)
+	}
+
+	var groups []string
+	for _, group := range result.SecurityGroups {
+		groups = append(groups, aws.StringValue(group.GroupId))
+	}
+	return groups, nil
+}
+
+// authorizeRoleRules applies the role rules of the config to the security
+// group created for the role: it's opened to the groups of the roles allowed
+// to reach it, and the groups of the roles it's allowed to reach are opened
+// to it, whatever order the roles are deployed in. Rules of roles not
+// deployed yet are applied when they are
+func (p *AWS) authorizeRoleRules(ctx *Context, svc *ec2.EC2, groupID string, vpcID string) error {
+	rules, err := roleRules(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	role := ctx.config.RunConfig.Role
+
+	for _, rule := range rules {
+		if rule.To == role {
+			sources, err := p.roleSecurityGroups(ctx, svc, vpcID, rule.From)
+			if err != nil {
+				return err
+			}
+			if len(sources) == 0 {
+				ctx.logger.Warn("no security group of role %s in vpc %s yet, %s is allowed once it's deployed", rule.From, vpcID, rule)
+			}
+
+			for _, source := range sources {
+				err = authorizeRoleIngress(svc, groupID, roleRulePermission(rule, source))
+				if err != nil {
+					return fmt.Errorf("allow %s: %v", rule, err)
+				}
+			}
+		}
+
+		if rule.From == role {
+			targets, err := p.roleSecurityGroups(ctx, svc, vpcID, rule.To)
+			if err != nil {
+				return err
+			}
+			if len(targets) == 0 {
+				ctx.logger.Warn("no security group of role %s in vpc %s yet, %s is allowed once it's deployed", rule.To, vpcID, rule)
+			}
+
+			for _, target := range targets {
+				// rules of a role to itself are opened above
+				if target == groupID {
+					continue
+				}
+
+				err = authorizeRoleIngress(svc, target, roleRulePermission(rule, groupID))
+				if err != nil {
+					return fmt.Errorf("allow %s: %v", rule, err)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// authorizeRoleIngress adds the permission to the ingress of the security
+// group unless it's already allowed
+func authorizeRoleIngress(svc *ec2.EC2, groupID string, permission *ec2.IpPermission) error {
+	_, err := svc.AuthorizeSecurityGroupIngress(&ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       aws.String(groupID),
+		IpPermissions: []*ec2.IpPermission{permission},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidPermission.Duplicate" {
+		return nil
+	}
+	return err
+}
+
+// revokeRoleReferences revokes the ingress rules of other security groups
+// allowing the security group, which can't be deleted while they reference it
+func (p *AWS) revokeRoleReferences(svc *ec2.EC2, groupID string) error {
+	result, err := svc.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("ip-permission.group-id"), Values: aws.StringSlice([]string{groupID})},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("describe security groups referencing %s: %v", groupID, err)
+	}
+
+	for _, group := range result.SecurityGroups {
+		if aws.StringValue(group.GroupId) == groupID {
+			continue
+		}
+
+		var permissions []*ec2.IpPermission
+		for _, permission := range group.IpPermissions {
+			for _, pair := range permission.UserIdGroupPairs {
+				if aws.StringValue(pair.GroupId) != groupID {
+					continue
+				}
+
+				permissions = append(permissions, &ec2.IpPermission{
+					IpProtocol:       permission.IpProtocol,
+					FromPort:         permission.FromPort,
+					ToPort:           permission.ToPort,
+					UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: pair.GroupId}},
+				})
+			}
+		}
+
+		if len(permissions) == 0 {
+			continue
+		}
+
+		_, err = svc.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       group.GroupId,
+			IpPermissions: permissions,
+		})
+		if err != nil {
+			return fmt.Errorf("revoke rules of %s allowing %s: %v", aws.StringValue(group.GroupId), groupID, err)
+		}
+	}
+
+	return nil
+}
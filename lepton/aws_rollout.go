@@ -0,0 +1,210 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RolloutInstances replaces the instances matching retire with instances of
+// the image of the config, blue/green: the new instances are launched, waited
+// for and must pass the load balancer health checks and the smoke tests of
+// the config before the domain names are pointed to them and the old
+// instances are deleted. The new instances are deleted if they don't get
+// ready, leaving the old ones serving
+func (p *AWS) RolloutInstances(ctx *Context, retire []ListFilter) ([]string, error) {
+	if ctx.config.RunConfig.Async {
+		return nil, errors.New("rollouts wait for the new instances, they can't be used in async mode")
+	}
+
+	err := validateSmokeTests(ctx.config.RunConfig.SmokeTests)
+	if err != nil {
+		return nil, err
+	}
+
+	// find the retired fleet before the new instances match the filters too
+	var retired []string
+	if len(retire) > 0 {
+		retired, err = p.FindInstanceIDs(ctx, retire)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(retired) == 0 {
+		ctx.logger.Warn("no instances match the retire filters, the new instances don't replace any")
+	}
+
+	// the instances serve even if some of the old ones couldn't be deleted
+	ids, err := p.rollout(ctx, retired)
+	if len(ids) > 0 {
+		recordErr := p.recordDeploy(ctx, ids, retired)
+		if recordErr != nil {
+			ctx.logger.Warn("unable to record the deploy, it can't be rolled back: %v", recordErr)
+		}
+	}
+
+	return ids, err
+}
+
+// rolloutSteps are the steps of a blue/green rollout, each given the ids of
+// the new instances but launch, which returns them
+type rolloutSteps struct {
+	launch    func() ([]string, error)
+	healthy   func(ids []string) error
+	smokeTest func(ids []string) error
+	point     func(ids []string) error
+	delete    func(ids []string) error
+}
+
+// run launches the new instances and replaces the retired instances with
+// them once they are ready. The new instances are deleted if a step fails
+// before the domain names are pointed to them
+func (s *rolloutSteps) run(ctx *Context, retired []string) ([]string, error) {
+	ids, err := s.launch()
+	if err != nil {
+		return nil, s.rollback(ctx, ids, err)
+	}
+
+	for _, step := range []func([]string) error{s.healthy, s.smokeTest, s.point} {
+		err = step(ids)
+		if err != nil {
+			return nil, s.rollback(ctx, ids, err)
+		}
+	}
+
+	if len(retired) > 0 {
+		err = s.delete(retired)
+		if err != nil {
+			return ids, fmt.Errorf("rolled out to instances %s but failed deleting the old instances: %v", strings.Join(ids, ", "), err)
+		}
+	}
+
+	ctx.logger.Log("Rolled out to instances %s, replacing %d instances", strings.Join(ids, ", "), len(retired))
+
+	return ids, nil
+}
+
+// rollback deletes the instances of a failed rollout and returns the error
+// that failed it
+func (s *rolloutSteps) rollback(ctx *Context, ids []string, cause error) error {
+	if len(ids) == 0 {
+		return cause
+	}
+
+	ctx.logger.Warn("rollout failed, deleting the new instances %s", strings.Join(ids, ", "))
+
+	err := s.delete(ids)
+	if err != nil {
+		return fmt.Errorf("%v, the new instances %s couldn't be deleted: %v", cause, strings.Join(ids, ", "), err)
+	}
+
+	return fmt.Errorf("rollout failed, the old instances keep serving: %v", cause)
+}
+
+// rollout launches the instances of the config and replaces the retired
+// instances with them once they are ready
+func (p *AWS) rollout(ctx *Context, retired []string) ([]string, error) {
+	c := ctx.config
+
+	compute, err := p.getEc2Service(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// the domain names are pointed to every new instance once they are healthy
+	launch := *c
+	launch.RunConfig.DomainName = ""
+	launch.RunConfig.DomainNames = nil
+	launch.RunConfig.Wait = true
+
+	launchCtx := *ctx
+	launchCtx.config = &launch
+
+	steps := &rolloutSteps{
+		launch: func() ([]string, error) {
+			return p.CreateInstances(&launchCtx)
+		},
+		healthy: func(ids []string) error {
+			if !loadBalancingEnabled(&c.CloudConfig) {
+				return nil
+			}
+			return p.waitTargetsHealthy(ctx, compute, ids)
+		},
+		smokeTest: func(ids []string) error {
+			return RunSmokeTests(ctx, p, ids)
+		},
+		point: func(ids []string) error {
+			if !hasDomainNames(c) {
+				return nil
+			}
+			return p.pointDomainNames(ctx, compute, ids)
+		},
+		delete: func(ids []string) error {
+			return p.DeleteInstances(ctx, ids)
+		},
+	}
+
+	if c.RunConfig.DryRun {
+		_, err := steps.launch()
+		if err != nil {
+			return nil, err
+		}
+		if hasDomainNames(c) {
+			dryRunf("would point %s to the new instances", strings.Join(domainNames(c), ", "))
+		}
+		if len(retired) > 0 {
+			dryRunf("would delete instances %s", strings.Join(retired, ", "))
+		}
+		return nil, nil
+	}
+
+	return steps.run(ctx, retired)
+}
+
+// CanaryDeploy launches a single instance of the image of the config, out of
+// its load balancer and domain names, and runs the smoke tests of the config
+// against it. The canary is deleted once they ran, its id is returned
+func (p *AWS) CanaryDeploy(ctx *Context) (string, error) {
+	if ctx.config.RunConfig.Async {
+		return "", errors.New("canaries are waited for, they can't be used in async mode")
+	}
+
+	err := validateSmokeTests(ctx.config.RunConfig.SmokeTests)
+	if err != nil {
+		return "", err
+	}
+
+	canary := *ctx.config
+	canary.RunConfig.InstanceCount = 1
+	canary.RunConfig.DomainName = ""
+	canary.RunConfig.DomainNames = nil
+	canary.RunConfig.Wait = true
+	canary.CloudConfig.TargetGroupARN = ""
+	canary.CloudConfig.LoadBalancer = ""
+
+	canaryCtx := *ctx
+	canaryCtx.config = &canary
+
+	ids, err := p.CreateInstances(&canaryCtx)
+	if len(ids) > 0 {
+		defer func() {
+			ctx.logger.Log("Deleting canary %s", ids[0])
+			deleteErr := p.DeleteInstances(ctx, ids)
+			if deleteErr != nil {
+				ctx.logger.Warn("unable to delete canary %s: %v", ids[0], deleteErr)
+			}
+		}()
+	}
+	if err != nil || ctx.config.RunConfig.DryRun {
+		return "", err
+	}
+
+	err = RunSmokeTests(ctx, p, ids)
+	if err != nil {
+		return ids[0], fmt.Errorf("canary %s failed: %v", ids[0], err)
+	}
+
+	ctx.logger.Log("Canary %s passed %d smoke tests", ids[0], len(ctx.config.RunConfig.SmokeTests))
+	return ids[0], nil
+}
@@ -0,0 +1,107 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeRollout returns rollout steps recording their calls, failing the step
+// named by fail
+func fakeRollout(calls *[]string, fail string) *rolloutSteps {
+	step := func(name string) func([]string) error {
+		return func(ids []string) error {
+			*calls = append(*calls, name+" "+strings.Join(ids, ","))
+			if name == fail {
+				return errors.New(name + " failed")
+			}
+			return nil
+		}
+	}
+
+	return &rolloutSteps{
+		launch: func() ([]string, error) {
+			*calls = append(*calls, "launch")
+			return []string{"i-new1", "i-new2"}, nil
+		},
+		healthy:   step("healthy"),
+		smokeTest: step("smoke"),
+		point:     step("point"),
+		delete: func(ids []string) error {
+			*calls = append(*calls, "delete "+strings.Join(ids, ","))
+			if fail == "delete "+strings.Join(ids, ",") {
+				return errors.New("delete failed")
+			}
+			return nil
+		},
+	}
+}
+
+func TestRolloutReplacesRetiredInstances(t *testing.T) {
+	ctx := NewContext(NewConfig(), nil)
+
+	var calls []string
+	ids, err := fakeRollout(&calls, "").run(ctx, []string{"i-old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(ids, ",") != "i-new1,i-new2" {
+		t.Errorf("expected the new instances, got %v", ids)
+	}
+
+	expected := "[launch healthy i-new1,i-new2 smoke i-new1,i-new2 point i-new1,i-new2 delete i-old]"
+	if fmt.Sprint(calls) != expected {
+		t.Errorf("expected %s, got %v", expected, calls)
+	}
+}
+
+func TestRolloutFailureKeepsRetiredInstances(t *testing.T) {
+	ctx := NewContext(NewConfig(), nil)
+
+	var calls []string
+	ids, err := fakeRollout(&calls, "smoke").run(ctx, []string{"i-old"})
+	if err == nil || !strings.Contains(err.Error(), "old instances keep serving") {
+		t.Errorf("expected the rollout to fail, got %v", err)
+	}
+	if ids != nil {
+		t.Errorf("expected no instances, got %v", ids)
+	}
+
+	// the new instances are deleted, the domain names aren't pointed to them
+	expected := "[launch healthy i-new1,i-new2 smoke i-new1,i-new2 delete i-new1,i-new2]"
+	if fmt.Sprint(calls) != expected {
+		t.Errorf("expected %s, got %v", expected, calls)
+	}
+
+	calls = nil
+	steps := fakeRollout(&calls, "delete i-new1,i-new2")
+	steps.healthy = func([]string) error { return errors.New("unhealthy") }
+	_, err = steps.run(ctx, []string{"i-old"})
+	if err == nil || !strings.Contains(err.Error(), "couldn't be deleted") {
+		t.Errorf("expected the new instances not to be deleted, got %v", err)
+	}
+}
+
+func TestRolloutReturnsInstancesWhenRetiringFails(t *testing.T) {
+	ctx := NewContext(NewConfig(), nil)
+
+	var calls []string
+	ids, err := fakeRollout(&calls, "delete i-old").run(ctx, []string{"i-old"})
+	if err == nil {
+		t.Error("expected an error deleting the old instances")
+	}
+	if strings.Join(ids, ",") != "i-new1,i-new2" {
+		t.Errorf("expected the new instances serving, got %v", ids)
+	}
+}
+
+func TestRolloutInstancesAsync(t *testing.T) {
+	config := NewConfig()
+	config.RunConfig.Async = true
+
+	if _, err := (&AWS{}).RolloutInstances(NewContext(config, nil), nil); err == nil {
+		t.Error("expected async rollouts to be rejected")
+	}
+}
@@ -0,0 +1,281 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/servicediscovery"
+)
+
+// awsServiceDiscoveryTag holds the registry and service an instance was
+// registered with, and the address of the consul api, e.g.
+// cloudmap:srv-abcdefgh or consul:api@http://10.0.0.5:8500
+const awsServiceDiscoveryTag = "OpsServiceDiscovery"
+
+// service registries instances are registered with
+const (
+	registryCloudMap = "cloudmap"
+	registryConsul   = "consul"
+)
+
+// serviceDiscoveryEnabled returns true if created instances are registered
+// with a service registry
+func serviceDiscoveryEnabled(c *Config) bool {
+	return c.RunConfig.ServiceDiscovery.Registry != ""
+}
+
+// validateServiceDiscovery checks the service discovery settings of the run
+// config
+func validateServiceDiscovery(c *Config) error {
+	sd := c.RunConfig.ServiceDiscovery
+	if sd.Registry == "" {
+		return nil
+	}
+
+	if sd.Registry != registryCloudMap && sd.Registry != registryConsul {
+		return fmt.Errorf("invalid service registry %q, expected %s or %s", sd.Registry, registryCloudMap, registryConsul)
+	}
+
+	if sd.Service == "" {
+		return fmt.Errorf("the %s service instances are registered with is missing", sd.Registry)
+	}
+
+	if sd.Port < 0 || sd.Port > 65535 {
+		return fmt.Errorf("invalid service port %d", sd.Port)
+	}
+
+	return nil
+}
+
+// serviceDiscoveryPort returns the port instances are registered with, the
+// first port of the run config if none is set
+func serviceDiscoveryPort(c *Config) int {
+	if port := c.RunConfig.ServiceDiscovery.Port; port != 0 {
+		return port
+	}
+	if len(c.RunConfig.Ports) > 0 {
+		return c.RunConfig.Ports[0]
+	}
+	return 0
+}
+
+// ParseServiceRegistration returns the registry and service of a service
+// registration formatted as <registry>:<service>, e.g. cloudmap:api or
+// consul:api, the format of the service discovery tag of instances
+func ParseServiceRegistration(value string) (string, string, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[1] == "" || (parts[0] != registryCloudMap && parts[0] != registryConsul) {
+		return "", "", fmt.Errorf("invalid service registration %q, expected cloudmap:<service> or consul:<service>", value)
+	}
+	return parts[0], parts[1], nil
+}
+
+// serviceRegistrationTag returns the service discovery tag value of the
+// instances registered with the service of the registry, at the consul api
+// address for consul
+func serviceRegistrationTag(registry string, service string, consulAddr string) string {
+	if registry == registryConsul {
+		return registry + ":" + service + "@" + consulAddr
+	}
+	return registry + ":" + service
+}
+
+// parseServiceRegistrationTag returns the registry, service and consul api
+// address of a service discovery tag value. The address is empty for cloud
+// map and for tags of instances registered before it was recorded
+func parseServiceRegistrationTag(value string) (string, string, string, error) {
+	registry, service, err := ParseServiceRegistration(value)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	var addr string
+	if registry == registryConsul {
+		if i := strings.Index(service, "@"); i != -1 {
+			service, addr = service[:i], service[i+1:]
+		}
+	}
+	return registry, service, addr, nil
+}
+
+func (p *AWS) getServiceDiscoveryService(config *Config) (*servicediscovery.ServiceDiscovery, error) {
+	sess, err := p.getAWSSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return servicediscovery.New(sess), nil
+}
+
+// cloudMapServiceID returns the id of the cloud map service with the id or
+// name passed by argument
+func cloudMapServiceID(svc *servicediscovery.ServiceDiscovery, service string) (string, error) {
+	if strings.HasPrefix(service, "srv-") {
+		return service, nil
+	}
+
+	var ids []string
+	err := svc.ListServicesPages(&servicediscovery.ListServicesInput{}, func(page *servicediscovery.ListServicesOutput, lastPage bool) bool {
+		for _, s := range page.Services {
+			if aws.StringValue(s.Name) == service {
+				ids = append(ids, aws.StringValue(s.Id))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", fmt.Errorf("list cloud map services: %v", err)
+	}
+
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("cloud map service %s not found", service)
+	case 1:
+		return ids[0], nil
+	}
+
+	return "", fmt.Errorf("cloud map services %s are named %s, use the service id", strings.Join(ids, ", "), service)
+}
+
+// registerServices registers the private address and port of the instances
+// with the cloud map service or consul catalog of the run config, and tags
+// them with the registration for deregisterServices. Cloud map health checks
+// are the ones of the service
+func (p *AWS) registerServices(ctx *Context, compute *ec2.EC2, instanceIDs []string) error {
+	c := ctx.config
+	sd := c.RunConfig.ServiceDiscovery
+	port := serviceDiscoveryPort(c)
+
+	err := compute.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+	})
+	if err != nil {
+		return fmt.Errorf("wait for instances to register them: %v", err)
+	}
+
+	service := sd.Service
+	var cloudMap *servicediscovery.ServiceDiscovery
+	var consul *ConsulCatalog
+	var consulAddr string
+	if sd.Registry == registryCloudMap {
+		cloudMap, err = p.getServiceDiscoveryService(c)
+		if err != nil {
+			return err
+		}
+
+		service, err = cloudMapServiceID(cloudMap, sd.Service)
+		if err != nil {
+			return err
+		}
+	} else {
+		consul = NewConsulCatalog(sd.ConsulAddr)
+		consulAddr = consul.addr
+	}
+
+	for _, id := range instanceIDs {
+		instance, err := p.describeInstance(compute, id)
+		if err != nil {
+			return err
+		}
+		address := aws.StringValue(instance.PrivateIpAddress)
+
+		if cloudMap != nil {
+			attributes := map[string]*string{"AWS_INSTANCE_IPV4": aws.String(address)}
+			if port != 0 {
+				attributes["AWS_INSTANCE_PORT"] = aws.String(strconv.Itoa(port))
+			}
+
+			_, err = cloudMap.RegisterInstance(&servicediscovery.RegisterInstanceInput{
+				ServiceId:  aws.String(service),
+				InstanceId: aws.String(id),
+				Attributes: attributes,
+			})
+		} else {
+			err = consul.Register(id, id, service, address, port, sd.HealthCheck)
+		}
+		if err != nil {
+			return fmt.Errorf("register instance %s with %s service %s: %v", id, sd.Registry, service, err)
+		}
+
+		ctx.logger.Log("Registered instance %s at %s with %s service %s", id, address, sd.Registry, service)
+	}
+
+	_, err = compute.CreateTags(&ec2.CreateTagsInput{
+		Resources: aws.StringSlice(instanceIDs),
+		Tags:      []*ec2.Tag{{Key: aws.String(awsServiceDiscoveryTag), Value: aws.String(serviceRegistrationTag(sd.Registry, service, consulAddr))}},
+	})
+	if err != nil {
+		return fmt.Errorf("tag service registration of instances: %v", err)
+	}
+
+	return nil
+}
+
+// deregisterServices removes the instances from the services they were
+// registered with, consul instances at the address they were registered at.
+// Every instance is deregistered, the failures are returned together
+func (p *AWS) deregisterServices(ctx *Context, compute *ec2.EC2, instanceIDs []string) error {
+	result, err := compute.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+	})
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			id := aws.StringValue(instance.InstanceId)
+
+			for _, tag := range instance.Tags {
+				if aws.StringValue(tag.Key) != awsServiceDiscoveryTag {
+					continue
+				}
+
+				registry, service, consulAddr, err := parseServiceRegistrationTag(aws.StringValue(tag.Value))
+				if err != nil {
+					failed = append(failed, fmt.Sprintf("instance %s: %v", id, err))
+					continue
+				}
+
+				if registry == registryCloudMap {
+					err = p.deregisterCloudMapInstance(ctx.config, service, id)
+				} else {
+					if consulAddr == "" {
+						consulAddr = ctx.config.RunConfig.ServiceDiscovery.ConsulAddr
+					}
+					err = NewConsulCatalog(consulAddr).Deregister(id)
+				}
+				if err != nil {
+					failed = append(failed, fmt.Sprintf("deregister instance %s from %s service %s: %v", id, registry, service, err))
+					continue
+				}
+
+				ctx.logger.Log("Deregistered instance %s from %s service %s", id, registry, service)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// deregisterCloudMapInstance removes the instance from the cloud map service
+func (p *AWS) deregisterCloudMapInstance(config *Config, service string, id string) error {
+	svc, err := p.getServiceDiscoveryService(config)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.DeregisterInstance(&servicediscovery.DeregisterInstanceInput{
+		ServiceId:  aws.String(service),
+		InstanceId: aws.String(id),
+	})
+	return err
+}
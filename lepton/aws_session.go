@@ -0,0 +1,73 @@
+package lepton
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsclient "github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// awsSessionConfig returns the sdk config of region with the retry, backoff
+// and api timeout settings of the cloud config. Unset settings keep the sdk
+// defaults
+func awsSessionConfig(cloud *ProviderConfig, region string) *aws.Config {
+	cfg := &aws.Config{
+		Region: aws.String(region),
+	}
+
+	if cloud.MaxRetries != 0 || cloud.RetryMinDelay != 0 || cloud.RetryMaxDelay != 0 {
+		retries := cloud.MaxRetries
+		if retries == 0 {
+			retries = awsclient.DefaultRetryerMaxNumRetries
+		} else if retries < 0 {
+			retries = 0
+		}
+
+		minDelay := time.Duration(cloud.RetryMinDelay) * time.Millisecond
+		maxDelay := time.Duration(cloud.RetryMaxDelay) * time.Millisecond
+
+		// throttled requests back off with the same bounds, the sdk default
+		// of up to 5 minutes per retry looks like a hang on throttled accounts
+		cfg = request.WithRetryer(cfg, awsclient.DefaultRetryer{
+			NumMaxRetries:    retries,
+			MinRetryDelay:    minDelay,
+			MaxRetryDelay:    maxDelay,
+			MinThrottleDelay: minDelay,
+			MaxThrottleDelay: maxDelay,
+		})
+	}
+
+	// the timeout bounds connecting and waiting for the response headers, not
+	// reading the body, so uploads and downloads of images aren't cut off
+	if cloud.APITimeout > 0 {
+		timeout := time.Duration(cloud.APITimeout) * time.Second
+		cfg.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				DialContext: (&net.Dialer{
+					Timeout:   timeout,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				MaxIdleConns:          100,
+				IdleConnTimeout:       90 * time.Second,
+				TLSHandshakeTimeout:   timeout,
+				ResponseHeaderTimeout: timeout,
+				ExpectContinueTimeout: 1 * time.Second,
+			},
+		}
+	}
+
+	return cfg
+}
+
+// newAWSSession returns a session of region configured by the cloud config.
+// The provider is on aws-sdk-go v1, moving it to aws-sdk-go-v2 is deferred:
+// v2 needs a newer go than the go 1.12 of the module, and every service
+// client of the provider is created from this session when it's done
+func newAWSSession(cloud *ProviderConfig, region string) (*session.Session, error) {
+	return session.NewSession(awsSessionConfig(cloud, region))
+}
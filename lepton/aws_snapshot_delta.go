@@ -0,0 +1,311 @@
+package lepton
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ebs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// ebsBlockSize is the size of the blocks of snapshots written with the ebs
+// direct apis
+const ebsBlockSize = 512 * 1024
+
+// snapshotBlocks records the image a snapshot was deployed from: the content
+// fingerprint of its build and the sha256 of each of its blocks
+type snapshotBlocks struct {
+	Content string   `json:"content"`
+	Blocks  []string `json:"blocks"`
+}
+
+// snapshotBlocksPath returns the file holding the blocks of the image the
+// snapshot was deployed from
+func snapshotBlocksPath(region string, snapshotID string) string {
+	return path.Join(GetOpsHome(), "deploys", "blocks", fmt.Sprintf("aws-%s-%s.json", region, snapshotID))
+}
+
+func loadSnapshotBlocks(region string, snapshotID string) *snapshotBlocks {
+	data, err := ioutil.ReadFile(snapshotBlocksPath(region, snapshotID))
+	if err != nil {
+		return nil
+	}
+
+	blocks := &snapshotBlocks{}
+	if json.Unmarshal(data, blocks) != nil {
+		return nil
+	}
+	return blocks
+}
+
+func (b *snapshotBlocks) save(region string, snapshotID string) error {
+	blocksPath := snapshotBlocksPath(region, snapshotID)
+
+	err := os.MkdirAll(path.Dir(blocksPath), 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(blocksPath, data, 0644)
+}
+
+// imageBlocks returns the sha256 of each ebsBlockSize block of the image at
+// imagePath, the last block padded with zeros
+func imageBlocks(imagePath string) ([]string, error) {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var blocks []string
+	buf := make([]byte, ebsBlockSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+
+		for i := n; i < len(buf); i++ {
+			buf[i] = 0
+		}
+		sum := sha256.Sum256(buf)
+		blocks = append(blocks, hex.EncodeToString(sum[:]))
+
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+
+	return blocks, nil
+}
+
+// changedBlocks returns the indexes of the blocks of current differing from
+// previous. Blocks of previous past the end of current are changed too, they
+// are zeroed
+func changedBlocks(previous []string, current []string) []int64 {
+	var changed []int64
+	for i := 0; i < len(previous) || i < len(current); i++ {
+		if i >= len(previous) || i >= len(current) || previous[i] != current[i] {
+			changed = append(changed, int64(i))
+		}
+	}
+	return changed
+}
+
+// readBlock returns the block index of the image, zero padded
+func readBlock(f *os.File, index int64) ([]byte, error) {
+	buf := make([]byte, ebsBlockSize)
+	n, err := f.ReadAt(buf, index*ebsBlockSize)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	for i := n; i < len(buf); i++ {
+		buf[i] = 0
+	}
+	return buf, nil
+}
+
+// rootSnapshot returns the snapshot of the root device of the ami
+func rootSnapshot(image *ec2.Image) string {
+	for _, device := range image.BlockDeviceMappings {
+		if aws.StringValue(device.DeviceName) == aws.StringValue(image.RootDeviceName) && device.Ebs != nil {
+			return aws.StringValue(device.Ebs.SnapshotId)
+		}
+	}
+	return ""
+}
+
+// configOnlyChange returns the blocks of the snapshot of the ami if the local
+// image at imagePath only differs from the image the ami was deployed from by
+// its program configuration, e.g. arguments or environment, nil otherwise
+func configOnlyChange(image *ec2.Image, c *Config, imagePath string) *snapshotBlocks {
+	if aws.BoolValue(image.EnaSupport) != c.CloudConfig.EnaSupport {
+		return nil
+	}
+	for _, device := range image.BlockDeviceMappings {
+		if device.Ebs != nil && aws.BoolValue(device.Ebs.Encrypted) != (c.CloudConfig.KMSKeyID != "") {
+			return nil
+		}
+	}
+
+	snapshotID := rootSnapshot(image)
+	if snapshotID == "" {
+		return nil
+	}
+
+	fingerprint := loadImageFingerprint(imagePath)
+	if fingerprint == nil || !imageUpToDate(imagePath, *fingerprint) {
+		return nil
+	}
+
+	blocks := loadSnapshotBlocks(c.CloudConfig.Zone, snapshotID)
+	if blocks == nil || blocks.Content != fingerprint.Content {
+		return nil
+	}
+	return blocks
+}
+
+// recordSnapshotBlocks records the blocks of the local image the snapshot of
+// the deploy was created from, for a later deploy changing only its config
+func (d *awsDeploy) recordSnapshotBlocks() {
+	fingerprint := loadImageFingerprint(d.imagePath)
+	if fingerprint == nil || !imageUpToDate(d.imagePath, *fingerprint) {
+		return
+	}
+
+	blocks, err := imageBlocks(d.imagePath)
+	if err == nil {
+		err = (&snapshotBlocks{Content: fingerprint.Content, Blocks: blocks}).save(d.state.Region, d.state.SnapshotID)
+	}
+	if err != nil {
+		d.ctx.logger.Warn("unable to record the blocks of snapshot %s: %v", d.state.SnapshotID, err)
+	}
+}
+
+// patchSnapshot creates a snapshot of the local image from the snapshot
+// parent deployed with the same files, writing only the blocks that changed
+// with the ebs direct apis instead of uploading and importing the image. The
+// snapshot is deleted if it can't be completed
+func (d *awsDeploy) patchSnapshot(parent string, previous *snapshotBlocks) (err error) {
+	c := d.ctx.config
+	key := c.CloudConfig.ImageName
+
+	current, err := imageBlocks(d.imagePath)
+	if err != nil {
+		return err
+	}
+	changed := changedBlocks(previous.Blocks, current)
+
+	snapshots, err := d.compute.DescribeSnapshots(&ec2.DescribeSnapshotsInput{
+		SnapshotIds: aws.StringSlice([]string{parent}),
+	})
+	if err != nil {
+		return fmt.Errorf("describe snapshot %s: %v", parent, err)
+	}
+	if len(snapshots.Snapshots) == 0 {
+		return fmt.Errorf("snapshot %s not found", parent)
+	}
+
+	volumeSize := aws.Int64Value(snapshots.Snapshots[0].VolumeSize)
+	if size := (int64(len(current))*ebsBlockSize + 1<<30 - 1) >> 30; size > volumeSize {
+		volumeSize = size
+	}
+
+	svc, err := d.p.getVolumeService(c)
+	if err != nil {
+		return err
+	}
+
+	input := &ebs.StartSnapshotInput{
+		ParentSnapshotId: aws.String(parent),
+		VolumeSize:       aws.Int64(volumeSize),
+		Description:      aws.String(imageDescription(c)),
+		Tags:             []*ebs.Tag{{Key: aws.String("Name"), Value: aws.String(key)}},
+	}
+	if c.CloudConfig.KMSKeyID != "" {
+		input.Encrypted = aws.Bool(true)
+		input.KmsKeyArn = aws.String(c.CloudConfig.KMSKeyID)
+	}
+
+	started, err := svc.StartSnapshot(input)
+	if err != nil {
+		return fmt.Errorf("start snapshot from %s: %v", parent, err)
+	}
+	snapshotID := aws.StringValue(started.SnapshotId)
+	defer func() {
+		if err != nil {
+			d.deleteSnapshot(snapshotID)
+		}
+	}()
+
+	d.ctx.progress(ProgressUpload, key, ProgressStarted, 0, "writing %d changed blocks of %s to snapshot %s", len(changed), d.imagePath, snapshotID)
+
+	f, err := os.Open(d.imagePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	last := 0
+	for i, index := range changed {
+		block, err := readBlock(f, index)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(block)
+		_, err = svc.PutSnapshotBlock(&ebs.PutSnapshotBlockInput{
+			SnapshotId:        aws.String(snapshotID),
+			BlockIndex:        aws.Int64(index),
+			BlockData:         bytes.NewReader(block),
+			DataLength:        aws.Int64(ebsBlockSize),
+			Checksum:          aws.String(base64.StdEncoding.EncodeToString(sum[:])),
+			ChecksumAlgorithm: aws.String(ebs.ChecksumAlgorithmSha256),
+		})
+		if err != nil {
+			d.ctx.progress(ProgressUpload, key, ProgressFailed, last, "%v", err)
+			return fmt.Errorf("write block %d of snapshot %s: %v", index, snapshotID, err)
+		}
+
+		if percent := percentOf(int64(i+1), int64(len(changed))); percent > last && percent < 100 {
+			last = percent
+			d.ctx.progress(ProgressUpload, key, ProgressRunning, percent, "")
+		}
+	}
+
+	_, err = svc.CompleteSnapshot(&ebs.CompleteSnapshotInput{
+		SnapshotId:         aws.String(snapshotID),
+		ChangedBlocksCount: aws.Int64(int64(len(changed))),
+	})
+	if err != nil {
+		return fmt.Errorf("complete snapshot %s: %v", snapshotID, err)
+	}
+
+	d.ctx.recordUpload(int64(len(changed)) * ebsBlockSize)
+	d.ctx.progress(ProgressUpload, key, ProgressDone, 100, "")
+
+	err = d.compute.WaitUntilSnapshotCompleted(&ec2.DescribeSnapshotsInput{
+		SnapshotIds: aws.StringSlice([]string{snapshotID}),
+	})
+	if err != nil {
+		return fmt.Errorf("wait for snapshot %s: %v", snapshotID, err)
+	}
+
+	d.state.SnapshotID = snapshotID
+	d.ctx.recordCreated("snapshot", snapshotID)
+
+	err = (&snapshotBlocks{Content: previous.Content, Blocks: current}).save(d.state.Region, snapshotID)
+	if err != nil {
+		d.ctx.logger.Warn("unable to record the blocks of snapshot %s: %v", snapshotID, err)
+	}
+
+	return nil
+}
+
+// deleteSnapshot deletes the snapshot patchSnapshot failed to complete, it
+// would be left pending or in error otherwise
+func (d *awsDeploy) deleteSnapshot(snapshotID string) {
+	_, err := d.compute.DeleteSnapshot(&ec2.DeleteSnapshotInput{
+		SnapshotId: aws.String(snapshotID),
+	})
+	if err != nil {
+		d.ctx.logger.Warn("unable to delete snapshot %s: %v", snapshotID, err)
+	}
+}
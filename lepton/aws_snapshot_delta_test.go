@@ -0,0 +1,141 @@
+package lepton
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ebs"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestImageBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot-blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// two and a half blocks, the config written to the second one
+	image := bytes.Repeat([]byte{1}, ebsBlockSize*5/2)
+	imagePath := filepath.Join(dir, "test.img")
+	if err := ioutil.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, err := imageBlocks(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(previous) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(previous))
+	}
+
+	image[ebsBlockSize+10] = 2
+	if err := ioutil.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := imageBlocks(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed := changedBlocks(previous, current); !reflect.DeepEqual(changed, []int64{1}) {
+		t.Errorf("got changed blocks %v, want [1]", changed)
+	}
+
+	// blocks past the end of a shorter image are zeroed
+	if changed := changedBlocks(previous, current[:2]); !reflect.DeepEqual(changed, []int64{1, 2}) {
+		t.Errorf("got changed blocks %v, want [1 2]", changed)
+	}
+
+	f, err := os.Open(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	last, err := readBlock(f, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != ebsBlockSize || last[ebsBlockSize/2-1] != 1 || last[ebsBlockSize/2] != 0 {
+		t.Error("expected the last block to be zero padded")
+	}
+}
+
+func TestPatchSnapshotFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot-blocks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	imagePath := filepath.Join(dir, "image")
+	err = ioutil.WriteFile(imagePath, bytes.Repeat([]byte{1}, ebsBlockSize), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/snapshots":
+			w.Write([]byte(`{"SnapshotId":"snap-new"}`))
+		case strings.HasPrefix(r.URL.Path, "/snapshots/"):
+			w.Header().Set("X-Amzn-Errortype", "InternalServerException")
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"message":"unavailable"}`))
+		default:
+			r.ParseForm()
+			switch r.Form.Get("Action") {
+			case "DescribeSnapshots":
+				w.Write([]byte(`<DescribeSnapshotsResponse><snapshotSet><item><snapshotId>snap-parent</snapshotId><volumeSize>1</volumeSize></item></snapshotSet></DescribeSnapshotsResponse>`))
+			case "DeleteSnapshot":
+				deleted = append(deleted, r.Form.Get("SnapshotId"))
+				w.Write([]byte(`<DeleteSnapshotResponse><return>true</return></DeleteSnapshotResponse>`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+
+	c := NewConfig()
+	c.CloudConfig.ImageName = "api"
+	d := &awsDeploy{
+		p:         &AWS{volumeService: ebs.New(sess)},
+		ctx:       NewContext(c, nil),
+		compute:   ec2.New(sess),
+		state:     &DeployState{},
+		imagePath: imagePath,
+	}
+
+	err = d.patchSnapshot("snap-parent", &snapshotBlocks{Blocks: []string{"changed"}})
+	if err == nil {
+		t.Fatal("expected the patch to fail")
+	}
+
+	if !reflect.DeepEqual(deleted, []string{"snap-new"}) {
+		t.Errorf("expected the started snapshot to be deleted, got %v", deleted)
+	}
+	if d.state.SnapshotID != "" {
+		t.Errorf("expected no snapshot in the deploy state, got %s", d.state.SnapshotID)
+	}
+}
@@ -0,0 +1,1383 @@
+package lepton
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	awsclient "github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+)
+
+func TestSelectAWSImage(t *testing.T) {
+	image := func(id, name, amiName, created string) *ec2.Image {
+		return &ec2.Image{
+			ImageId:      aws.String(id),
+			Name:         aws.String(amiName),
+			CreationDate: aws.String(created),
+			Tags: []*ec2.Tag{
+				{Key: aws.String("CreatedBy"), Value: aws.String("ops")},
+				{Key: aws.String("Name"), Value: aws.String(name)},
+			},
+		}
+	}
+
+	images := []*ec2.Image{
+		image("ami-2", "web", "web2", "2020-11-02T10:00:00.000Z"),
+		image("ami-3", "web", "web3", "2020-11-03T10:00:00.000Z"),
+		image("ami-1", "web", "web1", "2020-11-01T10:00:00.000Z"),
+		image("ami-4", "api", "api4", "2020-11-04T10:00:00.000Z"),
+	}
+
+	selected, err := selectAWSImage(images, "web", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(selected.ImageId) != "ami-3" {
+		t.Errorf("got %s, want newest image ami-3", aws.StringValue(selected.ImageId))
+	}
+
+	selected, err = selectAWSImage(images, "web", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(selected.ImageId) != "ami-1" {
+		t.Errorf("got %s, want pinned image ami-1", aws.StringValue(selected.ImageId))
+	}
+
+	_, err = selectAWSImage(images, "db", "")
+	if err == nil {
+		t.Error("expected error selecting missing image")
+	}
+}
+
+func TestAWSSessionConfigRetries(t *testing.T) {
+	cfg := awsSessionConfig(&ProviderConfig{}, "us-west-2")
+	if cfg.Retryer != nil || cfg.HTTPClient != nil {
+		t.Error("expected sdk defaults without retry settings")
+	}
+
+	cfg = awsSessionConfig(&ProviderConfig{RetryMaxDelay: 2000, APITimeout: 30}, "us-west-2")
+	retryer, ok := cfg.Retryer.(awsclient.DefaultRetryer)
+	if !ok {
+		t.Fatalf("unexpected retryer %T", cfg.Retryer)
+	}
+	if retryer.NumMaxRetries != awsclient.DefaultRetryerMaxNumRetries {
+		t.Errorf("got %d retries, want sdk default", retryer.NumMaxRetries)
+	}
+	if retryer.MaxThrottleDelay != 2*time.Second {
+		t.Errorf("got max throttle delay %s, want 2s", retryer.MaxThrottleDelay)
+	}
+	// long uploads aren't cut off by a timeout of the whole request
+	if cfg.HTTPClient.Timeout != 0 {
+		t.Errorf("got request timeout %s, want none", cfg.HTTPClient.Timeout)
+	}
+	if transport := cfg.HTTPClient.Transport.(*http.Transport); transport.ResponseHeaderTimeout != 30*time.Second {
+		t.Errorf("got response header timeout %s, want 30s", transport.ResponseHeaderTimeout)
+	}
+
+	cfg = awsSessionConfig(&ProviderConfig{MaxRetries: -1}, "us-west-2")
+	if cfg.Retryer.(awsclient.DefaultRetryer).NumMaxRetries != 0 {
+		t.Error("expected retries disabled")
+	}
+}
+
+func TestValidateFlowLogConfig(t *testing.T) {
+	tests := []struct {
+		config ProviderConfig
+		valid  bool
+	}{
+		{ProviderConfig{}, true},
+		{ProviderConfig{FlowLogDestination: "arn:aws:s3:::audit-logs"}, true},
+		{ProviderConfig{FlowLogDestination: "arn:aws:logs:us-west-2:123456789012:log-group:ops", FlowLogRole: "arn:aws:iam::123456789012:role/flow-logs"}, true},
+		{ProviderConfig{FlowLogDestination: "arn:aws:logs:us-west-2:123456789012:log-group:ops"}, false},
+		{ProviderConfig{FlowLogDestination: "audit-logs"}, false},
+		{ProviderConfig{FlowLogDestination: "arn:aws:s3:::audit-logs", FlowLogTraffic: "dropped"}, false},
+	}
+
+	for _, test := range tests {
+		err := validateFlowLogConfig(&test.config)
+		if test.valid && err != nil {
+			t.Errorf("%s: unexpected error %v", test.config.FlowLogDestination, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: expected error", test.config.FlowLogDestination)
+		}
+	}
+}
+
+func TestParseIdentityDocument(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	document := []byte(`{"accountId":"123456789012","imageId":"ami-1","instanceId":"i-1","region":"us-west-2"}`)
+	digest := sha256.Sum256(document)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+
+	doc, err := ParseIdentityDocument(document, signature, certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.InstanceID != "i-1" || doc.ImageID != "ami-1" || doc.AccountID != "123456789012" {
+		t.Errorf("unexpected document %+v", doc)
+	}
+
+	tampered := []byte(`{"accountId":"123456789012","imageId":"ami-2","instanceId":"i-1","region":"us-west-2"}`)
+	_, err = ParseIdentityDocument(tampered, signature, certificate)
+	if err == nil {
+		t.Error("expected tampered document to fail verification")
+	}
+}
+
+func testCertificate(t *testing.T) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestPinIdentityCertificate(t *testing.T) {
+	region := "zz-test-9"
+	defer os.Remove(identityCertificatePath(region))
+
+	if _, err := identityCertificate(region); err == nil {
+		t.Fatal("expected a region without a pinned certificate to be rejected")
+	}
+
+	certificate := testCertificate(t)
+	if err := PinIdentityCertificate("../us-west-2", certificate, false); err == nil {
+		t.Error("expected an invalid region to be rejected")
+	}
+	if err := PinIdentityCertificate(region, []byte("not a certificate"), false); err == nil {
+		t.Error("expected an invalid certificate to be rejected")
+	}
+
+	if err := PinIdentityCertificate(region, certificate, false); err != nil {
+		t.Fatal(err)
+	}
+	pinned, err := identityCertificate(region)
+	if err != nil || string(pinned) != string(certificate) {
+		t.Fatalf("unexpected pinned certificate: %v", err)
+	}
+
+	other := testCertificate(t)
+	if err := PinIdentityCertificate(region, other, false); err == nil {
+		t.Error("expected a different certificate to need force")
+	}
+	if err := PinIdentityCertificate(region, other, true); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseLaunchTemplate(t *testing.T) {
+	spec, err := parseLaunchTemplate("hardened:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(spec.LaunchTemplateName) != "hardened" || aws.StringValue(spec.Version) != "3" {
+		t.Errorf("unexpected launch template %v", spec)
+	}
+
+	spec, err = parseLaunchTemplate("lt-0abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(spec.LaunchTemplateId) != "lt-0abc" || aws.StringValue(spec.Version) != "$Default" {
+		t.Errorf("unexpected launch template %v", spec)
+	}
+
+	for _, template := range []string{"", ":1", "hardened:"} {
+		if _, err := parseLaunchTemplate(template); err == nil {
+			t.Errorf("expected error parsing %q", template)
+		}
+	}
+}
+
+func TestMergeAWSTags(t *testing.T) {
+	tags := mergeAWSTags(
+		[]*ec2.Tag{
+			{Key: aws.String("CostCenter"), Value: aws.String("platform")},
+			{Key: aws.String("Name"), Value: aws.String("template")},
+		},
+		[]*ec2.Tag{
+			{Key: aws.String("Name"), Value: aws.String("web")},
+		},
+	)
+
+	values := map[string]string{}
+	for _, tag := range tags {
+		values[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	if len(tags) != 2 || values["CostCenter"] != "platform" || values["Name"] != "web" {
+		t.Errorf("unexpected tags %v", values)
+	}
+}
+
+func TestSelectAWSImageRef(t *testing.T) {
+	images := []*ec2.Image{
+		{ImageId: aws.String("ami-1"), Name: aws.String("web1"), CreationDate: aws.String("2020-11-01T10:00:00.000Z"),
+			Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web")}, {Key: aws.String("Alias:stable"), Value: aws.String("true")}}},
+		{ImageId: aws.String("ami-2"), Name: aws.String("web2"), CreationDate: aws.String("2020-11-02T10:00:00.000Z"),
+			Tags: []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web")}, {Key: aws.String("Alias:latest"), Value: aws.String("true")}}},
+	}
+
+	for ref, want := range map[string]string{"": "ami-2", "stable": "ami-1", "latest": "ami-2", "1": "ami-1"} {
+		image, err := selectAWSImageRef(images, "web", ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if aws.StringValue(image.ImageId) != want {
+			t.Errorf("ref %q: got %s, want %s", ref, aws.StringValue(image.ImageId), want)
+		}
+	}
+
+	name, ref := ParseImageRef("web:stable")
+	if name != "web" || ref != "stable" {
+		t.Errorf("got %s %s, want web stable", name, ref)
+	}
+}
+
+func TestCreatedImageIDs(t *testing.T) {
+	summary := OperationSummary{Created: []SummaryResource{
+		{Kind: "snapshot", ID: "snap-1"},
+		{Kind: "image", ID: "ami-1"},
+		{Kind: "instance", ID: "i-1"},
+	}}
+
+	if ids := createdImageIDs(summary); !reflect.DeepEqual(ids, []string{"ami-1"}) {
+		t.Errorf("unexpected image ids %v", ids)
+	}
+
+	if ids := createdImageIDs(OperationSummary{}); len(ids) != 0 {
+		t.Errorf("expected no image ids, got %v", ids)
+	}
+}
+
+func TestInstanceMetadataOptions(t *testing.T) {
+	p := &AWS{}
+
+	options, err := p.instanceMetadataOptions(&Config{})
+	if err != nil || options != nil {
+		t.Errorf("expected no metadata options, got %v %v", options, err)
+	}
+
+	options, err = p.instanceMetadataOptions(&Config{CloudConfig: ProviderConfig{MetadataTokens: "required", MetadataHopLimit: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(options.HttpTokens) != "required" || aws.Int64Value(options.HttpPutResponseHopLimit) != 1 || options.HttpEndpoint != nil {
+		t.Errorf("unexpected metadata options %v", options)
+	}
+
+	for _, cloud := range []ProviderConfig{{MetadataTokens: "v2"}, {MetadataHopLimit: 65}, {MetadataEndpoint: "off"}} {
+		if _, err := p.instanceMetadataOptions(&Config{CloudConfig: cloud}); err == nil {
+			t.Errorf("expected error for %+v", cloud)
+		}
+	}
+}
+
+func TestInstanceName(t *testing.T) {
+	if name := instanceName("api-{{index}}", 3); name != "api-3" {
+		t.Errorf("got %s, want api-3", name)
+	}
+
+	tags := withAWSNameTag([]*ec2.Tag{
+		{Key: aws.String("CreatedBy"), Value: aws.String("ops")},
+		{Key: aws.String("Name"), Value: aws.String("api-{{index}}")},
+	}, "api-1")
+
+	if len(tags) != 2 || aws.StringValue(tags[1].Value) != "api-1" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+}
+
+func TestInstanceGroupValidate(t *testing.T) {
+	tests := []struct {
+		group InstanceGroup
+		valid bool
+	}{
+		{InstanceGroup{Name: "web", MinSize: 1, MaxSize: 3, DesiredCapacity: -1}, true},
+		{InstanceGroup{Name: "web", MinSize: 0, MaxSize: 3, DesiredCapacity: 2, TargetCPU: 60}, true},
+		{InstanceGroup{MinSize: 1, MaxSize: 3, DesiredCapacity: -1}, false},
+		{InstanceGroup{Name: "web", MinSize: 3, MaxSize: 1, DesiredCapacity: -1}, false},
+		{InstanceGroup{Name: "web", MinSize: 1, MaxSize: 3, DesiredCapacity: 4}, false},
+		{InstanceGroup{Name: "web", MinSize: 1, MaxSize: 3, DesiredCapacity: -1, TargetCPU: 120}, false},
+	}
+
+	for _, test := range tests {
+		err := test.group.validate()
+		if test.valid && err != nil {
+			t.Errorf("%+v: unexpected error %v", test.group, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%+v: expected error", test.group)
+		}
+	}
+}
+
+func TestBuildMarketplaceChangeSet(t *testing.T) {
+	c := NewConfig()
+	c.RunConfig.Ports = []int{80}
+	c.RunConfig.UDPPorts = []int{53}
+
+	version := MarketplaceVersion{Title: "1.0.0"}
+
+	if _, err := buildMarketplaceChangeSet(c, "ami-123", version); err == nil {
+		t.Error("expected error without a product")
+	}
+
+	c.CloudConfig.MarketplaceProduct = "prod-abc"
+	c.CloudConfig.MarketplaceRole = "arn:aws:iam::123456789012:role/ingest"
+
+	changeSet, err := buildMarketplaceChangeSet(c, "ami-123", version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := changeSet.ChangeSet[0]
+	if change.Entity.Identifier != "prod-abc" || change.ChangeType != "AddDeliveryOptions" {
+		t.Errorf("unexpected change %+v", change)
+	}
+
+	var details marketplaceDetails
+	if err := json.Unmarshal([]byte(change.Details), &details); err != nil {
+		t.Fatal(err)
+	}
+
+	ami := details.DeliveryOptions[0].Details.AmiDeliveryOptionDetails
+	if ami.AmiSource.AmiID != "ami-123" || ami.RecommendedInstanceType != "t2.micro" {
+		t.Errorf("unexpected ami details %+v", ami)
+	}
+
+	if len(ami.SecurityGroups) != 2 || ami.SecurityGroups[1].IPProtocol != "udp" {
+		t.Errorf("unexpected security groups %+v", ami.SecurityGroups)
+	}
+}
+
+func TestTargetGroupHealthCheck(t *testing.T) {
+	input := &elbv2.CreateTargetGroupInput{}
+	targetGroupHealthCheck(&ProviderConfig{}, input)
+
+	if aws.StringValue(input.HealthCheckProtocol) != "TCP" || aws.StringValue(input.HealthCheckPort) != "traffic-port" {
+		t.Errorf("unexpected tcp health check %v", input)
+	}
+
+	input = &elbv2.CreateTargetGroupInput{}
+	targetGroupHealthCheck(&ProviderConfig{HealthCheckPath: "/health", HealthCheckPort: 8081}, input)
+
+	if aws.StringValue(input.HealthCheckProtocol) != "HTTP" || aws.StringValue(input.HealthCheckPath) != "/health" || aws.StringValue(input.HealthCheckPort) != "8081" {
+		t.Errorf("unexpected http health check %v", input)
+	}
+}
+
+func TestLoadBalancerSubnets(t *testing.T) {
+	subnet := &ec2.Subnet{SubnetId: aws.String("subnet-a"), AvailabilityZone: aws.String("us-west-2a")}
+	subnets := map[string]*ec2.Subnet{
+		"us-west-2b": {SubnetId: aws.String("subnet-b")},
+		"us-west-2c": {SubnetId: aws.String("subnet-c")},
+	}
+
+	ids := aws.StringValueSlice(loadBalancerSubnets(subnet, subnets, []string{"us-west-2b", "us-west-2c"}))
+	if !reflect.DeepEqual(ids, []string{"subnet-a", "subnet-b", "subnet-c"}) {
+		t.Errorf("expected a subnet per zone, got %v", ids)
+	}
+}
+
+func TestDeployStateCompleted(t *testing.T) {
+	state := &DeployState{}
+	if state.completed(DeployStepUpload) {
+		t.Error("new deploy has no completed steps")
+	}
+
+	state.Step = DeployStepSnapshot
+	for _, step := range []DeployStep{DeployStepUpload, DeployStepImport, DeployStepSnapshot} {
+		if !state.completed(step) {
+			t.Errorf("step %s should be completed", step)
+		}
+	}
+
+	for _, step := range []DeployStep{DeployStepCleanup, DeployStepRegister, DeployStepTag} {
+		if state.completed(step) {
+			t.Errorf("step %s should not be completed", step)
+		}
+	}
+}
+
+func TestDeployStateConfig(t *testing.T) {
+	c := NewConfig()
+	c.CloudConfig.Project = "deploy-state-test"
+	c.CloudConfig.BucketName = "images"
+	c.Env = map[string]string{"TOKEN": "secret"}
+	c.RunConfig.InstanceEnv = map[string]string{"PASSWORD": "secret"}
+	c.RunConfig.ShowDebug = true
+	defer os.Remove(checksumKeyPath(c.CloudConfig.Project))
+
+	saved, err := deployStateConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.CloudConfig.BucketName != "images" || !saved.RunConfig.ShowDebug {
+		t.Errorf("expected the deploy settings to be kept, got %+v", saved)
+	}
+
+	if saved.RunConfig.InstanceEnv != nil {
+		t.Errorf("expected the instance environment to be left out, got %v", saved.RunConfig.InstanceEnv)
+	}
+
+	if v := saved.Env["TOKEN"]; v == "secret" || !strings.HasPrefix(v, "hmac:") {
+		t.Errorf("expected the environment value to be replaced by its checksum, got %q", v)
+	}
+}
+
+func TestImportTaskFailed(t *testing.T) {
+	for status, failed := range map[string]bool{"active": false, "completed": false, "deleting": true, "deleted": true} {
+		if importTaskFailed(&ec2.SnapshotTaskDetail{Status: aws.String(status)}) != failed {
+			t.Errorf("expected a %s import task failed to be %v", status, failed)
+		}
+	}
+
+	if !importTaskFailed(nil) {
+		t.Error("expected a task without detail to be failed")
+	}
+}
+
+func TestAddLaunchTemplateImages(t *testing.T) {
+	inUse := map[string]bool{"ami-1": true}
+	addLaunchTemplateImages(inUse, []*ec2.LaunchTemplateVersion{
+		{LaunchTemplateData: &ec2.ResponseLaunchTemplateData{ImageId: aws.String("ami-2")}},
+		{LaunchTemplateData: &ec2.ResponseLaunchTemplateData{}},
+		{},
+	})
+
+	if len(inUse) != 2 || !inUse["ami-1"] || !inUse["ami-2"] {
+		t.Errorf("unexpected images in use %v", inUse)
+	}
+}
+
+func TestArnResourceType(t *testing.T) {
+	tests := map[string]string{
+		"arn:aws:ec2:us-west-2:123456789012:instance/i-0123":                                   "ec2:instance",
+		"arn:aws:ec2:us-west-2::image/ami-0123":                                                "ec2:image",
+		"arn:aws:elasticloadbalancing:us-west-2:123456789012:targetgroup/web/73e2d6bc24d8a067": "elasticloadbalancing:targetgroup",
+		"arn:aws:logs:us-west-2:123456789012:log-group:flows":                                  "logs:log-group",
+		"invalid": "",
+	}
+
+	for arn, want := range tests {
+		if got := arnResourceType(arn); got != want {
+			t.Errorf("%s: got %q, want %q", arn, got, want)
+		}
+	}
+}
+
+func TestWithDeployIDTag(t *testing.T) {
+	ctx := &Context{deployID: "abc123"}
+	defaults := getAWSDefaultTags()
+
+	tags := withDeployIDTag(ctx, defaults)
+	if len(tags) != 2 || aws.StringValue(tags[1].Value) != "abc123" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	if len(defaults) != 1 {
+		t.Error("default tags modified")
+	}
+}
+
+func TestAWSDNSRecordValues(t *testing.T) {
+	instance := &ec2.Instance{
+		PublicIpAddress:  aws.String("54.1.2.3"),
+		PrivateIpAddress: aws.String("10.0.0.5"),
+		PublicDnsName:    aws.String("ec2-54-1-2-3.compute.amazonaws.com"),
+		NetworkInterfaces: []*ec2.InstanceNetworkInterface{
+			{Ipv6Addresses: []*ec2.InstanceIpv6Address{{Ipv6Address: aws.String("2600::1")}}},
+		},
+	}
+
+	tests := []struct {
+		recordType string
+		private    bool
+		want       string
+	}{
+		{"", false, "54.1.2.3"},
+		{"a", true, "10.0.0.5"},
+		{"AAAA", false, "2600::1"},
+		{"CNAME", false, "ec2-54-1-2-3.compute.amazonaws.com"},
+	}
+
+	for _, test := range tests {
+		c := NewConfig()
+		c.RunConfig.DNSRecordType = test.recordType
+		c.RunConfig.PrivateDNS = test.private
+
+		values, err := awsDNSRecordValues(c, instance)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(values) != 1 || values[0] != test.want {
+			t.Errorf("%s private %v: got %v, want %s", test.recordType, test.private, values, test.want)
+		}
+	}
+
+	c := NewConfig()
+	c.RunConfig.DNSRecordType = "MX"
+	if _, err := awsDNSRecordValues(c, instance); err == nil {
+		t.Error("expected error for unsupported record type")
+	}
+}
+
+func TestRecordTypesConflict(t *testing.T) {
+	if !recordTypesConflict("CNAME", "A") || !recordTypesConflict("A", "CNAME") {
+		t.Error("CNAME records should conflict with A records")
+	}
+
+	if recordTypesConflict("A", "AAAA") || recordTypesConflict("A", "A") || recordTypesConflict("CNAME", "TXT") {
+		t.Error("unexpected conflict")
+	}
+}
+
+func TestRecordTypesByName(t *testing.T) {
+	types := recordTypesByName([]*DNSRecord{
+		{Name: "api.example.com.", Type: "A", IP: "192.0.2.1"},
+		{Name: "api.example.com.", Type: "AAAA", IP: "2001:db8::1"},
+		{Name: "api.example.com.", Type: "A", IP: "192.0.2.2"},
+		{Name: "www.example.com.", Type: "CNAME", IP: "api.example.com"},
+	})
+
+	// the A records of a dual stack name aren't lost to its AAAA records
+	if !reflect.DeepEqual(types["api.example.com."], []string{"A", "AAAA"}) || !reflect.DeepEqual(types["www.example.com."], []string{"CNAME"}) {
+		t.Errorf("unexpected types %v", types)
+	}
+}
+
+func TestRenamedDomain(t *testing.T) {
+	tests := []struct {
+		domain, name, newName, want string
+	}{
+		{"api-1.example.com", "api-1", "api-2", "api-2.example.com"},
+		{"www.example.com", "api-1", "api-2", ""},
+		{"", "api-1", "api-2", ""},
+	}
+
+	for _, test := range tests {
+		if got := renamedDomain(test.domain, test.name, test.newName); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.domain, got, test.want)
+		}
+	}
+}
+
+func TestWithImageMetadataTags(t *testing.T) {
+	c := NewConfig()
+	c.CloudConfig.ImageMetadata = map[string]string{
+		"team":     "payments",
+		"Name":     "ignored",
+		"aws:tag":  "reserved",
+		"DeployID": "reserved",
+		"commit":   "abc123",
+	}
+
+	tags := withImageMetadataTags(c, []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("api")}})
+
+	var got []string
+	for _, tag := range tags {
+		got = append(got, aws.StringValue(tag.Key)+"="+aws.StringValue(tag.Value))
+	}
+
+	expected := []string{"Name=api", "commit=abc123", "team=payments"}
+	if len(got) != len(expected) {
+		t.Fatalf("got tags %v, expected %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("got tags %v, expected %v", got, expected)
+		}
+	}
+}
+
+func TestNextVolumeDevice(t *testing.T) {
+	instance := &ec2.Instance{
+		InstanceId: aws.String("i-0123"),
+		BlockDeviceMappings: []*ec2.InstanceBlockDeviceMapping{
+			{DeviceName: aws.String("/dev/sda1")},
+			{DeviceName: aws.String("/dev/sdf")},
+			{DeviceName: aws.String("/dev/xvdg")},
+		},
+	}
+
+	device, err := nextVolumeDevice(instance)
+	if err != nil || device != "/dev/sdh" {
+		t.Errorf("got device %q, %v, expected /dev/sdh", device, err)
+	}
+
+	instance.BlockDeviceMappings = nil
+	for _, letter := range awsVolumeDevices {
+		instance.BlockDeviceMappings = append(instance.BlockDeviceMappings, &ec2.InstanceBlockDeviceMapping{DeviceName: aws.String("/dev/sd" + letter)})
+	}
+
+	_, err = nextVolumeDevice(instance)
+	if err == nil {
+		t.Error("expected an error when every device is used")
+	}
+}
+
+func TestDataVolumeInput(t *testing.T) {
+	c := NewConfig()
+	input := &ec2.CreateVolumeInput{}
+
+	dataVolumeInput(c, input)
+	if aws.StringValue(input.VolumeType) != "gp2" || input.Iops != nil || input.Encrypted != nil {
+		t.Errorf("unexpected default volume input %v", input)
+	}
+
+	c.CloudConfig.DataVolumeType = "gp3"
+	c.CloudConfig.DataVolumeIops = 4000
+	c.CloudConfig.DataVolumeThroughput = 250
+	c.CloudConfig.KMSKeyID = "key"
+
+	dataVolumeInput(c, input)
+	if aws.StringValue(input.VolumeType) != "gp3" || aws.Int64Value(input.Iops) != 4000 ||
+		aws.Int64Value(input.Throughput) != 250 || !aws.BoolValue(input.Encrypted) {
+		t.Errorf("unexpected volume input %v", input)
+	}
+
+	if validateEBSSettings("gp2", 0, 250) == nil {
+		t.Error("expected throughput error for gp2 volumes")
+	}
+
+	if validateEBSSettings("", 4000, 0) == nil {
+		t.Error("expected iops error without a volume type")
+	}
+
+	if err := validateEBSSettings("gp3", 4000, 250); err != nil {
+		t.Errorf("expected iops and throughput of gp3 volumes, got %v", err)
+	}
+}
+
+func TestSnapshotRetention(t *testing.T) {
+	c := &ProviderConfig{}
+
+	if _, ok := snapshotRetention(c); ok {
+		t.Error("expected no retention without rules")
+	}
+
+	c.SnapshotKeepLast = 7
+	c.SnapshotMaxAge = 30
+
+	opts, ok := snapshotRetention(c)
+	if !ok || opts.KeepLast != 7 || opts.OlderThan != 30*24*time.Hour {
+		t.Errorf("unexpected retention %+v", opts)
+	}
+}
+
+func TestOperationStatus(t *testing.T) {
+	status := importTaskStatus("import-snap-1", &ec2.SnapshotTaskDetail{
+		Status:        aws.String("active"),
+		Progress:      aws.String("42"),
+		StatusMessage: aws.String("converting"),
+	})
+	if status.Done || status.Progress != "42" || status.Message != "converting" {
+		t.Errorf("unexpected active import status %+v", status)
+	}
+
+	status = importTaskStatus("import-snap-1", &ec2.SnapshotTaskDetail{Status: aws.String("completed")})
+	if !status.Done || status.Failed || status.Progress != "100" {
+		t.Errorf("unexpected completed import status %+v", status)
+	}
+
+	status = importTaskStatus("import-snap-1", &ec2.SnapshotTaskDetail{Status: aws.String("deleted")})
+	if !status.Done || !status.Failed {
+		t.Errorf("unexpected deleted import status %+v", status)
+	}
+
+	instance := &ec2.Instance{State: &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNamePending)}}
+	if status = instanceStatus("i-1", instance); status.Done {
+		t.Errorf("unexpected pending instance status %+v", status)
+	}
+
+	instance.State.Name = aws.String(ec2.InstanceStateNameRunning)
+	if status = instanceStatus("i-1", instance); !status.Done || status.Failed {
+		t.Errorf("unexpected running instance status %+v", status)
+	}
+
+	instance.State.Name = aws.String(ec2.InstanceStateNameTerminated)
+	if status = instanceStatus("i-1", instance); !status.Failed {
+		t.Errorf("unexpected terminated instance status %+v", status)
+	}
+}
+
+func TestValidateTenancy(t *testing.T) {
+	for _, tenancy := range []string{"", "default", "dedicated", "host"} {
+		if err := validateTenancy(&RunConfig{Tenancy: tenancy}); err != nil {
+			t.Errorf("tenancy %q: %v", tenancy, err)
+		}
+	}
+
+	if validateTenancy(&RunConfig{Tenancy: "shared"}) == nil {
+		t.Error("expected invalid tenancy error")
+	}
+}
+
+func TestAWSNetworkTags(t *testing.T) {
+	testCtx := NewContext(NewConfig(), nil)
+
+	specs := awsNetworkTags(testCtx, "vpc")
+	if len(specs) != 1 || aws.StringValue(specs[0].ResourceType) != "vpc" {
+		t.Fatalf("unexpected tag specifications %v", specs)
+	}
+
+	tags := map[string]string{}
+	for _, tag := range specs[0].Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+
+	if tags[awsNetworkTag] != "true" || tags["Name"] != awsNetworkName || tags["CreatedBy"] != "ops" || tags[awsDeployIDTag] != testCtx.DeployID() {
+		t.Errorf("unexpected network tags %v", tags)
+	}
+
+	// incomplete networks aren't matched by the filter of the ops network
+	specs = awsNetworkTagsWith(testCtx, "vpc", awsNetworkPending)
+	for _, tag := range specs[0].Tags {
+		if aws.StringValue(tag.Key) == awsNetworkTag && aws.StringValue(tag.Value) != awsNetworkPending {
+			t.Errorf("expected a pending network tag, got %s", aws.StringValue(tag.Value))
+		}
+	}
+	if values := aws.StringValueSlice(awsNetworkFilter().Values); len(values) != 1 || values[0] != "true" {
+		t.Errorf("unexpected network filter values %v", values)
+	}
+}
+
+func TestConsoleTail(t *testing.T) {
+	output := "boot\nen1: assigned 10.0.0.2\nlistening\nops:ready\n"
+
+	if tail := consoleTail(output, 2); tail != "listening\nops:ready" {
+		t.Errorf("unexpected tail %q", tail)
+	}
+
+	if tail := consoleTail("boot", 20); tail != "boot" {
+		t.Errorf("unexpected tail %q", tail)
+	}
+}
+
+func TestAcceleratedFlavors(t *testing.T) {
+	accelerated := map[string]bool{
+		"g4dn.xlarge":  true,
+		"p3.8xlarge":   true,
+		"inf1.2xlarge": true,
+		"dl1.24xlarge": true,
+		"t2.micro":     false,
+		"m6g.large":    false,
+	}
+
+	for flavor, want := range accelerated {
+		if got := isAcceleratedFlavor(flavor); got != want {
+			t.Errorf("isAcceleratedFlavor(%q) = %v, want %v", flavor, got, want)
+		}
+	}
+
+	info := &ec2.InstanceTypeInfo{
+		GpuInfo: &ec2.GpuInfo{
+			Gpus: []*ec2.GpuDeviceInfo{
+				{Count: aws.Int64(4), Manufacturer: aws.String("NVIDIA"), Name: aws.String("V100")},
+			},
+		},
+	}
+
+	if summary := acceleratorSummary(info); summary != "4 x NVIDIA V100" {
+		t.Errorf("unexpected accelerators %q", summary)
+	}
+
+	if summary := acceleratorSummary(&ec2.InstanceTypeInfo{}); summary != "" {
+		t.Errorf("unexpected accelerators %q", summary)
+	}
+}
+
+func TestQuotaError(t *testing.T) {
+	if err := quotaError(standardVCPUs, 32, 30, 2); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	err := quotaError(standardVCPUs, 32, 30, 4)
+	if err == nil || !strings.Contains(err.Error(), "L-1216C47A") {
+		t.Errorf("expected quota error naming the quota code, got %v", err)
+	}
+
+	if vcpuQuotas[instanceFamily("g4dn.xlarge")] != gpuVCPUs || vcpuQuotas[instanceFamily("t3.micro")] != standardVCPUs {
+		t.Error("unexpected vCPU quotas")
+	}
+}
+
+func TestNewConsoleOutput(t *testing.T) {
+	if chunk := newConsoleOutput("", "boot\n"); chunk != "boot\n" {
+		t.Errorf("unexpected chunk %q", chunk)
+	}
+
+	if chunk := newConsoleOutput("boot\n", "boot\nlistening\n"); chunk != "listening\n" {
+		t.Errorf("unexpected chunk %q", chunk)
+	}
+
+	// the start of the console scrolled out of the 64KB window
+	if chunk := newConsoleOutput("boot\nlistening\n", "listening\nrequest\n"); chunk != "request\n" {
+		t.Errorf("unexpected chunk %q", chunk)
+	}
+
+	if chunk := newConsoleOutput("boot\n", "request\n"); chunk != "request\n" {
+		t.Errorf("unexpected chunk %q", chunk)
+	}
+
+	key := consoleArchiveKey("i-0123", time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC))
+	if key != "console/i-0123/20210304T050607Z.log.gz" {
+		t.Errorf("unexpected key %s", key)
+	}
+}
+
+func TestDryRunRequest(t *testing.T) {
+	if err := dryRunRequest(awserr.New("DryRunOperation", "Request would have succeeded", nil), "would start instance %s", "i-0123"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	if err := dryRunRequest(awserr.New("UnauthorizedOperation", "denied", nil), "would start instance %s", "i-0123"); err == nil {
+		t.Error("expected the error of a request that would fail")
+	}
+
+	rule := (&AWS{}).buildFirewallRule("tcp", 8000, 8100, []string{"0.0.0.0/0", "::/0"})
+	if s := firewallRuleString(rule); s != "tcp 8000-8100 from 0.0.0.0/0, ::/0" {
+		t.Errorf("unexpected rule %q", s)
+	}
+}
+
+func TestPendingEvents(t *testing.T) {
+	early := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	late := early.Add(48 * time.Hour)
+
+	events := pendingEvents(&ec2.InstanceStatus{
+		InstanceId: aws.String("i-0123"),
+		Events: []*ec2.InstanceStatusEvent{
+			{Code: aws.String("system-reboot"), Description: aws.String("[Completed] scheduled reboot"), NotBefore: aws.Time(early)},
+			{Code: aws.String("instance-retirement"), Description: aws.String("The instance is running on degraded hardware"), NotBefore: aws.Time(late)},
+			{Code: aws.String("instance-reboot"), Description: aws.String("scheduled reboot"), NotBefore: aws.Time(early)},
+		},
+	})
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 pending events, got %v", events)
+	}
+
+	if events[0].Code != "instance-reboot" || events[1].Code != "instance-retirement" || events[1].InstanceID != "i-0123" {
+		t.Errorf("unexpected events %v", events)
+	}
+
+	if rebootResolves(events) {
+		t.Error("a retirement can't be resolved by a reboot")
+	}
+
+	if !rebootResolves(events[:1]) {
+		t.Error("an instance reboot is resolved by a reboot")
+	}
+}
+
+func TestIsAWSInstanceID(t *testing.T) {
+	for _, id := range []string{"i-0123abcd", "i-0123456789abcdef0"} {
+		if !isAWSInstanceID(id) {
+			t.Errorf("expected %s to be an instance id", id)
+		}
+	}
+
+	for _, id := range []string{"web", "i-web", "i-0123", "i-0123ABCD", "vol-0123abcd"} {
+		if isAWSInstanceID(id) {
+			t.Errorf("expected %s not to be an instance id", id)
+		}
+	}
+}
+
+func TestProjectCapError(t *testing.T) {
+	if err := projectCapError("ci", "instances", 0, 40, 1); err != nil {
+		t.Errorf("unexpected error without cap %v", err)
+	}
+
+	if err := projectCapError("ci", "instances", 5, 3, 2); err != nil {
+		t.Errorf("unexpected error reaching the cap %v", err)
+	}
+
+	err := projectCapError("ci", "images", 20, 20, 1)
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("expected cap error mentioning --force, got %v", err)
+	}
+
+	c := NewConfig()
+	if tags := withProjectTag(c, nil); len(tags) != 0 {
+		t.Errorf("unexpected tags without project %v", tags)
+	}
+
+	c.CloudConfig.Project = "ci"
+	if tags := withProjectTag(c, nil); len(tags) != 1 || aws.StringValue(tags[0].Value) != "ci" {
+		t.Errorf("expected project tag, got %v", tags)
+	}
+}
+
+func TestDeployHistory(t *testing.T) {
+	if name := deployHistoryName("us-west-2", "web:v3"); name != "aws-us-west-2-web-history.json" {
+		t.Errorf("expected the history shared by the versions of the image, got %s", name)
+	}
+
+	history := &DeployHistory{Image: "web", Region: "us-west-2"}
+	history.add(DeployRecord{ImageID: "ami-1"})
+	if _, _, err := history.previous(); err == nil {
+		t.Error("expected no previous deploy after the first one")
+	}
+
+	for i := 2; i <= maxDeployRecords+2; i++ {
+		history.add(DeployRecord{ImageID: "ami-" + strconv.Itoa(i)})
+	}
+
+	if len(history.Records) != maxDeployRecords {
+		t.Errorf("expected %d records kept, got %d", maxDeployRecords, len(history.Records))
+	}
+
+	latest, previous, err := history.previous()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.ImageID != "ami-12" || previous.ImageID != "ami-11" {
+		t.Errorf("expected rollback from ami-12 to ami-11, got %s to %s", latest.ImageID, previous.ImageID)
+	}
+}
+
+func TestRecordedValues(t *testing.T) {
+	ctx := NewContext(NewConfig(), nil)
+	key, err := checksumKey(ctx.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := checksumValues(key, map[string]string{"TOKEN": "secret", "PORT": "8080"})
+	if recorded["TOKEN"] == "secret" {
+		t.Fatal("expected the checksum of the value to be recorded")
+	}
+
+	values, err := recordedValues(ctx, "InstanceEnv", recorded, map[string]string{"TOKEN": "rotated", "PORT": "8080", "DEBUG": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, map[string]string{"TOKEN": "rotated", "PORT": "8080"}) {
+		t.Errorf("unexpected values %v", values)
+	}
+
+	if _, err := recordedValues(ctx, "InstanceEnv", recorded, map[string]string{"PORT": "8080"}); err == nil {
+		t.Error("expected an error for a value missing from the config")
+	}
+}
+
+func TestVolumeUsageMetrics(t *testing.T) {
+	now := time.Now()
+	result := &cloudwatch.MetricDataResult{
+		Timestamps: aws.TimeSlice([]time.Time{now.Add(-2 * time.Minute), now, now.Add(-time.Minute)}),
+		Values:     aws.Float64Slice([]float64{40, 42.5, 41}),
+	}
+
+	value, latest, ok := latestValue(result)
+	if !ok || value != 42.5 || !latest.Equal(now) {
+		t.Errorf("expected the latest value 42.5, got %v at %s", value, latest)
+	}
+
+	if _, _, ok := latestValue(&cloudwatch.MetricDataResult{}); ok {
+		t.Error("expected no value without datapoints")
+	}
+
+	if _, _, ok := latestValue(nil); ok {
+		t.Error("expected no value without result")
+	}
+
+	dimensions := []*cloudwatch.Dimension{
+		{Name: aws.String("InstanceId"), Value: aws.String("i-0123")},
+		{Name: aws.String("path"), Value: aws.String("/data")},
+	}
+	if path := metricDimension(dimensions, "path"); path != "/data" {
+		t.Errorf("expected the path dimension, got %q", path)
+	}
+
+	above := volumesAbove([]VolumeUsage{{Path: "/", UsedPercent: 35}, {Path: "/data", UsedPercent: 91}}, 90)
+	if len(above) != 1 || above[0].Path != "/data" {
+		t.Errorf("expected /data over the threshold, got %v", above)
+	}
+}
+
+func TestVPCEndpoints(t *testing.T) {
+	err := validateVPCEndpoints(&ProviderConfig{VPCEndpoints: []string{"s3", "DynamoDB"}})
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	err = validateVPCEndpoints(&ProviderConfig{VPCEndpoints: []string{"sqs"}})
+	if err == nil {
+		t.Error("expected sqs to be refused, it has no gateway endpoint")
+	}
+
+	if name := gatewayEndpointServiceName("us-west-2", "DynamoDB"); name != "com.amazonaws.us-west-2.dynamodb" {
+		t.Errorf("unexpected service name %s", name)
+	}
+
+	user := &ec2.VpcEndpoint{RouteTableIds: aws.StringSlice([]string{"rtb-1"})}
+	ops := &ec2.VpcEndpoint{
+		RouteTableIds: aws.StringSlice([]string{"rtb-2"}),
+		Tags:          []*ec2.Tag{{Key: aws.String(awsVPCEndpointTag), Value: aws.String("true")}},
+	}
+	missing := missingRouteTables([]*ec2.VpcEndpoint{user, ops}, []string{"rtb-1", "rtb-2", "rtb-3"})
+	if len(missing) != 1 || missing[0] != "rtb-3" {
+		t.Errorf("expected rtb-3 to be missing, got %v", missing)
+	}
+
+	if isOpsVPCEndpoint(user) || !isOpsVPCEndpoint(ops) {
+		t.Error("expected only the tagged endpoint to be an ops endpoint")
+	}
+}
+
+func TestParseRoleRule(t *testing.T) {
+	tests := []struct {
+		rule     string
+		expected RoleRule
+	}{
+		{"api->worker:9000", RoleRule{From: "api", To: "worker", Protocol: "tcp", FromPort: 9000, ToPort: 9000}},
+		{"api->db-proxy:5432-5433", RoleRule{From: "api", To: "db-proxy", Protocol: "tcp", FromPort: 5432, ToPort: 5433}},
+		{"web->dns:53/UDP", RoleRule{From: "web", To: "dns", Protocol: "udp", FromPort: 53, ToPort: 53}},
+	}
+
+	for _, tt := range tests {
+		rule, err := ParseRoleRule(tt.rule)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.rule, err)
+			continue
+		}
+		if rule != tt.expected {
+			t.Errorf("%s: expected %+v, got %+v", tt.rule, tt.expected, rule)
+		}
+	}
+
+	for _, invalid := range []string{"api:9000", "api->worker", "->worker:80", "api->worker:http", "api->worker:80/icmp", "api->worker:70000"} {
+		if _, err := ParseRoleRule(invalid); err == nil {
+			t.Errorf("expected %q to be refused", invalid)
+		}
+	}
+
+	c := NewConfig()
+	c.RunConfig.RoleRules = []string{"api->worker:9000"}
+	if _, err := roleRules(c); err == nil {
+		t.Error("expected rules without a role to be refused")
+	}
+
+	c.RunConfig.Role = "worker"
+	rules, err := roleRules(c)
+	if err != nil || len(rules) != 1 || rules[0].String() != "api to worker tcp 9000" {
+		t.Errorf("unexpected rules %v, %v", rules, err)
+	}
+}
+
+func TestRoleGroupFilters(t *testing.T) {
+	c := NewConfig()
+
+	names := func(filters []*ec2.Filter) []string {
+		var result []string
+		for _, filter := range filters {
+			result = append(result, aws.StringValue(filter.Name)+"="+strings.Join(aws.StringValueSlice(filter.Values), ","))
+		}
+		return result
+	}
+
+	// groups of other deploy ids match, roles are deployed separately
+	filters := names(roleGroupFilters(c, "vpc-1", "worker"))
+	if strings.Join(filters, " ") != "vpc-id=vpc-1 tag:OpsRole=worker" {
+		t.Errorf("unexpected filters %v", filters)
+	}
+
+	c.CloudConfig.Project = "ci"
+	filters = names(roleGroupFilters(c, "vpc-1", "worker"))
+	if strings.Join(filters, " ") != "vpc-id=vpc-1 tag:OpsRole=worker tag:Project=ci" {
+		t.Errorf("unexpected filters %v", filters)
+	}
+}
+
+func TestParseServiceRegistration(t *testing.T) {
+	registry, service, err := ParseServiceRegistration("cloudmap:srv-abcdefgh")
+	if err != nil || registry != registryCloudMap || service != "srv-abcdefgh" {
+		t.Errorf("unexpected registration %s %s %v", registry, service, err)
+	}
+
+	for _, invalid := range []string{"api", "consul:", "eureka:api"} {
+		if _, _, err := ParseServiceRegistration(invalid); err == nil {
+			t.Errorf("expected %q to be refused", invalid)
+		}
+	}
+}
+
+func TestServiceRegistrationTag(t *testing.T) {
+	tag := serviceRegistrationTag(registryConsul, "api", "http://10.0.0.5:8500")
+	registry, service, addr, err := parseServiceRegistrationTag(tag)
+	if err != nil || registry != registryConsul || service != "api" || addr != "http://10.0.0.5:8500" {
+		t.Errorf("unexpected registration %s %s %s %v of %s", registry, service, addr, err, tag)
+	}
+
+	// tags without the address fall back to the one of the config
+	_, service, addr, err = parseServiceRegistrationTag("consul:api")
+	if err != nil || service != "api" || addr != "" {
+		t.Errorf("unexpected registration %s %s %v", service, addr, err)
+	}
+
+	tag = serviceRegistrationTag(registryCloudMap, "srv-abcdefgh", "")
+	if tag != "cloudmap:srv-abcdefgh" {
+		t.Errorf("unexpected tag %s", tag)
+	}
+}
+
+func TestReusableImage(t *testing.T) {
+	image := &ec2.Image{
+		Tags: []*ec2.Tag{{Key: aws.String(awsContentHashTag), Value: aws.String("abc")}},
+		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+			{Ebs: &ec2.EbsBlockDevice{Encrypted: aws.Bool(false)}},
+		},
+	}
+
+	c := NewConfig()
+	if !reusableImage(image, c, "abc") {
+		t.Error("expected the ami of the same image to be reused")
+	}
+	if reusableImage(image, c, "def") {
+		t.Error("expected the ami of another image not to be reused")
+	}
+
+	c.CloudConfig.EnaSupport = true
+	if reusableImage(image, c, "abc") {
+		t.Error("expected an ena support change not to reuse the ami")
+	}
+
+	c.CloudConfig.EnaSupport = false
+	c.CloudConfig.KMSKeyID = "key"
+	if reusableImage(image, c, "abc") {
+		t.Error("expected an encryption change not to reuse the ami")
+	}
+}
+
+func TestCloneName(t *testing.T) {
+	named := &ec2.Instance{
+		InstanceId: aws.String("i-0123"),
+		Tags:       []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("api")}},
+	}
+	if name := cloneName(named); name != "api-clone" {
+		t.Errorf("expected api-clone, got %s", name)
+	}
+
+	if name := cloneName(&ec2.Instance{InstanceId: aws.String("i-0123")}); name != "i-0123-clone" {
+		t.Errorf("expected i-0123-clone, got %s", name)
+	}
+}
+
+func TestDomainZoneNames(t *testing.T) {
+	names := domainZoneNames("api.eu.example.com")
+	if !reflect.DeepEqual(names, []string{"api.eu.example.com", "eu.example.com", "example.com"}) {
+		t.Errorf("unexpected zone names %v", names)
+	}
+
+	if names := domainZoneNames("example.com."); !reflect.DeepEqual(names, []string{"example.com"}) {
+		t.Errorf("unexpected zone names %v", names)
+	}
+}
+
+func TestAWSNanosVolumeZone(t *testing.T) {
+	vol := awsNanosVolume(&ec2.Volume{
+		VolumeId:         aws.String("vol-0123"),
+		AvailabilityZone: aws.String("us-west-2a"),
+		Tags:             []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("data")}},
+	})
+	if vol.Zone != "us-west-2a" || vol.Path != "" {
+		t.Errorf("expected the zone in Zone, got zone %q and path %q", vol.Zone, vol.Path)
+	}
+}
+
+func TestReplicationRateLimit(t *testing.T) {
+	now := time.Now()
+	state := &ReplicationState{}
+	state.recordCopy("ami-old", 100, now.Add(-2*time.Hour))
+	state.recordCopy("ami-1", 8, now.Add(-30*time.Minute))
+
+	if len(state.Copies) != 1 || state.copiedSince(now.Add(-time.Hour)) != 8 {
+		t.Fatalf("expected the copies older than an hour to be forgotten, got %+v", state.Copies)
+	}
+
+	limits := ReplicationLimits{MaxGiBPerHour: 10}
+	if !limits.allowsCopy(state, 2, now) {
+		t.Error("expected a copy within the hourly limit to be allowed")
+	}
+	if limits.allowsCopy(state, 4, now) {
+		t.Error("expected a copy beyond the hourly limit to be deferred")
+	}
+	if !limits.allowsCopy(&ReplicationState{}, 40, now) {
+		t.Error("expected an image larger than the limit to be copied alone")
+	}
+	if !(ReplicationLimits{}).allowsCopy(state, 400, now) {
+		t.Error("expected no limit without a rate")
+	}
+}
+
+func TestValidateReplicationTarget(t *testing.T) {
+	for _, target := range []string{"us-west-2", "eu-central-1", "us-gov-east-1"} {
+		if err := validateReplicationTarget(target); err != nil {
+			t.Errorf("%s: %v", target, err)
+		}
+	}
+
+	for _, target := range []string{"gcp", "azure:westus", "us-west", "US-WEST-2", ""} {
+		if err := validateReplicationTarget(target); err == nil {
+			t.Errorf("expected %q to be rejected", target)
+		}
+	}
+}
+
+func TestImageDeleted(t *testing.T) {
+	tests := []struct {
+		result  *ec2.DescribeImagesOutput
+		err     error
+		deleted bool
+		fails   bool
+	}{
+		{result: &ec2.DescribeImagesOutput{}, deleted: true},
+		{result: &ec2.DescribeImagesOutput{Images: []*ec2.Image{{State: aws.String(ec2.ImageStateDeregistered)}}}, deleted: true},
+		{result: &ec2.DescribeImagesOutput{Images: []*ec2.Image{{State: aws.String(ec2.ImageStateAvailable)}}}},
+		{err: awserr.New("InvalidAMIID.NotFound", "not found", nil), deleted: true},
+		{err: awserr.New("RequestLimitExceeded", "throttled", nil), fails: true},
+	}
+
+	for i, test := range tests {
+		deleted, err := imageDeleted(test.result, test.err)
+		if deleted != test.deleted || (err != nil) != test.fails {
+			t.Errorf("%d: got %v, %v", i, deleted, err)
+		}
+	}
+}
+
+func TestAdoptInstance(t *testing.T) {
+	instances := map[string]string{
+		"i-external": `<item><instanceId>i-external</instanceId><blockDeviceMapping><item><deviceName>/dev/sda1</deviceName><ebs><volumeId>vol-root</volumeId></ebs></item></blockDeviceMapping><tagSet><item><key>Name</key><value>web</value></item></tagSet></item>`,
+		"i-managed":  `<item><instanceId>i-managed</instanceId><tagSet><item><key>CreatedBy</key><value>ops</value></item></tagSet></item>`,
+	}
+
+	var tagged url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.Form.Get("Action") {
+		case "DescribeInstances":
+			w.Write([]byte(`<DescribeInstancesResponse><reservationSet>`))
+			if instance, ok := instances[r.Form.Get("InstanceId.1")]; ok {
+				w.Write([]byte(`<item><instancesSet>` + instance + `</instancesSet></item>`))
+			}
+			w.Write([]byte(`</reservationSet></DescribeInstancesResponse>`))
+		case "CreateTags":
+			tagged = r.Form
+			w.Write([]byte(`<CreateTagsResponse><return>true</return></CreateTagsResponse>`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	svc := ec2.New(session.Must(session.NewSession(&aws.Config{
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})))
+
+	c := NewConfig()
+	c.DefaultTags = []Tag{{Key: "team", Value: "infra"}}
+	ctx := NewContext(c, nil)
+
+	tests := []struct {
+		id   string
+		name string
+		err  string
+		tags map[string]string
+	}{
+		{"i-external", "api", "", map[string]string{"CreatedBy": "ops", "Name": "api", "team": "infra"}},
+		{"i-external", "", "", map[string]string{"CreatedBy": "ops", "team": "infra"}},
+		{"i-managed", "", "already managed by ops", nil},
+		{"i-missing", "", "not found", nil},
+	}
+
+	for _, tt := range tests {
+		tagged = nil
+
+		err := adoptInstance(ctx, svc, tt.id, tt.name)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("adopt %s: got error %v, want %q", tt.id, err, tt.err)
+			}
+			if tagged != nil {
+				t.Errorf("adopt %s: expected no tags to be created", tt.id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("adopt %s: %v", tt.id, err)
+			continue
+		}
+
+		if tagged.Get("ResourceId.1") != tt.id || tagged.Get("ResourceId.2") != "vol-root" {
+			t.Errorf("adopt %s: expected the instance and its volume to be tagged, got %v", tt.id, tagged)
+		}
+
+		tags := map[string]string{}
+		for i := 1; tagged.Get("Tag."+strconv.Itoa(i)+".Key") != ""; i++ {
+			tags[tagged.Get("Tag."+strconv.Itoa(i)+".Key")] = tagged.Get("Tag." + strconv.Itoa(i) + ".Value")
+		}
+		if !reflect.DeepEqual(tags, tt.tags) {
+			t.Errorf("adopt %s: got tags %v, want %v", tt.id, tags, tt.tags)
+		}
+	}
+}
@@ -14,10 +14,48 @@ var (
 	errGettingAWSVolumeService = func(err error) error { return fmt.Errorf("get volume service: %v", err) }
 )
 
+// awsVolumeDevices are the device names data volumes are attached at
+var awsVolumeDevices = []string{"f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p"}
+
+// volumeAvailabilityZone returns the availability zone data volumes are
+// created in, instances must run in the same zone to attach them
+func volumeAvailabilityZone(config *Config) string {
+	if config.CloudConfig.AvailabilityZone != "" {
+		return config.CloudConfig.AvailabilityZone
+	}
+	return config.CloudConfig.Zone + "c"
+}
+
+// dataVolumeInput applies the configured data volume settings to input
+func dataVolumeInput(config *Config, input *ec2.CreateVolumeInput) {
+	input.VolumeType = aws.String("gp2")
+	if config.CloudConfig.DataVolumeType != "" {
+		input.VolumeType = aws.String(config.CloudConfig.DataVolumeType)
+	}
+
+	if config.CloudConfig.DataVolumeIops != 0 {
+		input.Iops = aws.Int64(config.CloudConfig.DataVolumeIops)
+	}
+
+	if config.CloudConfig.DataVolumeThroughput != 0 {
+		input.Throughput = aws.Int64(config.CloudConfig.DataVolumeThroughput)
+	}
+
+	if config.CloudConfig.KMSKeyID != "" {
+		input.Encrypted = aws.Bool(true)
+		input.KmsKeyId = aws.String(config.CloudConfig.KMSKeyID)
+	}
+}
+
 // CreateVolume creates a snapshot and use it to create a volume
 func (a *AWS) CreateVolume(config *Config, name, data, size, provider string) (NanosVolume, error) {
 	var vol NanosVolume
 
+	err := validateEBSSettings(config.CloudConfig.DataVolumeType, config.CloudConfig.DataVolumeIops, config.CloudConfig.DataVolumeThroughput)
+	if err != nil {
+		return vol, err
+	}
+
 	compute, err := a.getEc2Service(config)
 	if err != nil {
 		return vol, err
@@ -40,7 +78,7 @@ func (a *AWS) CreateVolume(config *Config, name, data, size, provider string) (N
 	key := localVolume.Name
 
 	input := &ec2.ImportSnapshotInput{
-		Description: aws.String("name"),
+		Description: aws.String(fmt.Sprintf("nanos volume %s", name)),
 		DiskContainer: &ec2.SnapshotDiskContainer{
 			Description: aws.String("snapshot imported"),
 			Format:      aws.String("raw"),
@@ -51,12 +89,17 @@ func (a *AWS) CreateVolume(config *Config, name, data, size, provider string) (N
 		},
 	}
 
+	if config.CloudConfig.KMSKeyID != "" {
+		input.Encrypted = aws.Bool(true)
+		input.KmsKeyId = aws.String(config.CloudConfig.KMSKeyID)
+	}
+
 	res, err := compute.ImportSnapshot(input)
 	if err != nil {
 		return vol, fmt.Errorf("import snapshot: %v", err)
 	}
 
-	snapshotID, err := a.waitSnapshotToBeReady(config, res.ImportTaskId)
+	snapshotID, err := a.waitSnapshotToBeReady(NewContext(config, nil), res.ImportTaskId)
 	if err != nil {
 		return vol, err
 	}
@@ -69,10 +112,11 @@ func (a *AWS) CreateVolume(config *Config, name, data, size, provider string) (N
 
 	// Create tags to assign to the volume
 	tags, _ := parseToAWSTags(config.RunConfig.Tags, name)
+	tags = withDefaultTags(config, tags)
 
 	// Create volume from snapshot
 	createVolumeInput := &ec2.CreateVolumeInput{
-		AvailabilityZone: aws.String(config.CloudConfig.Zone + "c"),
+		AvailabilityZone: aws.String(volumeAvailabilityZone(config)),
 		SnapshotId:       snapshotID,
 		TagSpecifications: []*ec2.TagSpecification{
 			{
@@ -81,11 +125,30 @@ func (a *AWS) CreateVolume(config *Config, name, data, size, provider string) (N
 			},
 		},
 	}
-	_, err = compute.CreateVolume(createVolumeInput)
+	dataVolumeInput(config, createVolumeInput)
+
+	created, err := compute.CreateVolume(createVolumeInput)
 	if err != nil {
 		return vol, fmt.Errorf("create aws volume: %v", err)
 	}
 
+	err = compute.WaitUntilVolumeAvailable(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{created.VolumeId},
+	})
+	if err != nil {
+		return vol, fmt.Errorf("wait for volume %s: %v", aws.StringValue(created.VolumeId), err)
+	}
+
+	vol = NanosVolume{
+		ID:        aws.StringValue(created.VolumeId),
+		Name:      name,
+		Label:     localVolume.Label,
+		Data:      data,
+		Size:      strconv.Itoa(int(aws.Int64Value(created.Size))),
+		Status:    ec2.VolumeStateAvailable,
+		CreatedAt: aws.TimeValue(created.CreateTime).String(),
+	}
+
 	return vol, nil
 }
 
@@ -98,97 +161,204 @@ func (a *AWS) GetAllVolumes(config *Config) (*[]NanosVolume, error) {
 		return nil, err
 	}
 
-	input := &ec2.DescribeVolumesInput{}
-	output, err := compute.DescribeVolumes(input)
+	err = compute.DescribeVolumesPages(&ec2.DescribeVolumesInput{}, func(page *ec2.DescribeVolumesOutput, lastPage bool) bool {
+		for _, volume := range page.Volumes {
+			*vols = append(*vols, awsNanosVolume(volume))
+		}
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, volume := range output.Volumes {
-		var name string
-		var attachments []string
+	return vols, nil
+}
 
-		for _, tag := range volume.Tags {
-			if *tag.Key == "Name" {
-				name = *tag.Value
-			}
-		}
+// awsNanosVolume converts an ebs volume to a nanos volume
+func awsNanosVolume(volume *ec2.Volume) NanosVolume {
+	var name string
+	var attachments []string
 
-		for _, att := range volume.Attachments {
-			attachments = append(attachments, *att.InstanceId)
+	for _, tag := range volume.Tags {
+		if aws.StringValue(tag.Key) == "Name" {
+			name = aws.StringValue(tag.Value)
 		}
+	}
 
-		vol := NanosVolume{
-			ID:         *volume.VolumeId,
-			Name:       name,
-			Status:     *volume.State,
-			Size:       strconv.Itoa(int(*volume.Size)),
-			Path:       "",
-			CreatedAt:  volume.CreateTime.String(),
-			AttachedTo: strings.Join(attachments, ";"),
+	for _, att := range volume.Attachments {
+		attachments = append(attachments, aws.StringValue(att.InstanceId)+":"+aws.StringValue(att.Device))
+	}
+
+	return NanosVolume{
+		ID:         aws.StringValue(volume.VolumeId),
+		Name:       name,
+		Label:      name,
+		Status:     aws.StringValue(volume.State),
+		Size:       strconv.Itoa(int(aws.Int64Value(volume.Size))),
+		Zone:       aws.StringValue(volume.AvailabilityZone),
+		CreatedAt:  aws.TimeValue(volume.CreateTime).String(),
+		AttachedTo: strings.Join(attachments, ";"),
+	}
+}
+
+// describeVolume returns the volume with the id or Name tag passed by
+// argument
+func (a *AWS) describeVolume(compute *ec2.EC2, volume string) (*ec2.Volume, error) {
+	input := &ec2.DescribeVolumesInput{}
+	if strings.HasPrefix(volume, "vol-") {
+		input.VolumeIds = aws.StringSlice([]string{volume})
+	} else {
+		input.Filters = []*ec2.Filter{
+			{Name: aws.String("tag:Name"), Values: aws.StringSlice([]string{volume})},
 		}
+	}
+
+	result, err := compute.DescribeVolumes(input)
+	if err != nil {
+		return nil, fmt.Errorf("describe volume %s: %v", volume, err)
+	}
 
-		*vols = append(*vols, vol)
+	switch len(result.Volumes) {
+	case 0:
+		return nil, fmt.Errorf("volume %s not found", volume)
+	case 1:
+		return result.Volumes[0], nil
 	}
 
-	return vols, nil
+	return nil, fmt.Errorf("%d volumes named %s, use the volume id", len(result.Volumes), volume)
 }
 
-// DeleteVolume deletes a volume
+// DeleteVolume deletes a volume, given by id or name
 func (a *AWS) DeleteVolume(config *Config, name string) error {
 	compute, err := a.getEc2Service(config)
 	if err != nil {
 		return err
 	}
 
+	volume, err := a.describeVolume(compute, name)
+	if err != nil {
+		return err
+	}
+
+	if len(volume.Attachments) > 0 {
+		return fmt.Errorf("volume %s is attached to %s, detach it first", name, aws.StringValue(volume.Attachments[0].InstanceId))
+	}
+
 	input := &ec2.DeleteVolumeInput{
-		VolumeId: aws.String(name),
+		VolumeId: volume.VolumeId,
 	}
 	_, err = compute.DeleteVolume(input)
 	if err != nil {
 		return err
 	}
 
+	NewConfigLogger(config).Log("Deleted volume %s", aws.StringValue(volume.VolumeId))
+
 	return nil
 }
 
-// AttachVolume attaches a volume to an instance
+// nextVolumeDevice returns the first device name from /dev/sdf to /dev/sdp
+// not mapped on the instance
+func nextVolumeDevice(instance *ec2.Instance) (string, error) {
+	used := map[string]bool{}
+	for _, mapping := range instance.BlockDeviceMappings {
+		used[strings.TrimPrefix(strings.TrimPrefix(aws.StringValue(mapping.DeviceName), "/dev/sd"), "/dev/xvd")] = true
+	}
+
+	for _, letter := range awsVolumeDevices {
+		if !used[letter] {
+			return "/dev/sd" + letter, nil
+		}
+	}
+
+	return "", fmt.Errorf("no free device on instance %s", aws.StringValue(instance.InstanceId))
+}
+
+// AttachVolume attaches a volume, given by id or name, to an instance at the
+// first free device from /dev/sdf. The instance image mounts the volume by
+// its label
 func (a *AWS) AttachVolume(config *Config, image, name, mount string) error {
 	compute, err := a.getEc2Service(config)
 	if err != nil {
 		return err
 	}
 
+	instance, err := a.describeInstance(compute, image)
+	if err != nil {
+		return err
+	}
+
+	volume, err := a.describeVolume(compute, name)
+	if err != nil {
+		return err
+	}
+
+	if aws.StringValue(volume.AvailabilityZone) != aws.StringValue(instance.Placement.AvailabilityZone) {
+		return fmt.Errorf("volume %s is in %s and instance %s in %s", name, aws.StringValue(volume.AvailabilityZone), image, aws.StringValue(instance.Placement.AvailabilityZone))
+	}
+
+	device, err := nextVolumeDevice(instance)
+	if err != nil {
+		return err
+	}
+
 	input := &ec2.AttachVolumeInput{
-		Device:     aws.String("/dev/sdf"),
-		InstanceId: aws.String(image),
-		VolumeId:   aws.String(name),
+		Device:     aws.String(device),
+		InstanceId: instance.InstanceId,
+		VolumeId:   volume.VolumeId,
 	}
 	_, err = compute.AttachVolume(input)
 	if err != nil {
 		return err
 	}
 
+	err = compute.WaitUntilVolumeInUse(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{volume.VolumeId},
+	})
+	if err != nil {
+		return fmt.Errorf("wait for volume %s to attach: %v", name, err)
+	}
+
+	NewConfigLogger(config).Log("Attached volume %s to instance %s at %s", aws.StringValue(volume.VolumeId), aws.StringValue(instance.InstanceId), device)
+
 	return nil
 }
 
-// DetachVolume detachs a volume from an instance
+// DetachVolume detachs a volume, given by id or name, from an instance
 func (a *AWS) DetachVolume(config *Config, image, name string) error {
 	compute, err := a.getEc2Service(config)
 	if err != nil {
 		return err
 	}
 
+	instance, err := a.describeInstance(compute, image)
+	if err != nil {
+		return err
+	}
+
+	volume, err := a.describeVolume(compute, name)
+	if err != nil {
+		return err
+	}
+
 	input := &ec2.DetachVolumeInput{
-		Device:     aws.String("/dev/sdf"),
-		InstanceId: aws.String(image),
-		VolumeId:   aws.String(name),
+		InstanceId: instance.InstanceId,
+		VolumeId:   volume.VolumeId,
 	}
 	_, err = compute.DetachVolume(input)
 	if err != nil {
 		return err
 	}
 
+	err = compute.WaitUntilVolumeAvailable(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{volume.VolumeId},
+	})
+	if err != nil {
+		return fmt.Errorf("wait for volume %s to detach: %v", name, err)
+	}
+
+	NewConfigLogger(config).Log("Detached volume %s from instance %s", aws.StringValue(volume.VolumeId), aws.StringValue(instance.InstanceId))
+
 	return nil
 }
 
@@ -0,0 +1,230 @@
+package lepton
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsSnapshotVolumeTag is the snapshot tag holding the name of the volume it
+// was taken from
+const awsSnapshotVolumeTag = "Volume"
+
+// snapshotRetention returns the retention rules of volume snapshots, ok is
+// false if none is configured
+func snapshotRetention(c *ProviderConfig) (opts PruneOptions, ok bool) {
+	opts = PruneOptions{
+		KeepLast:  c.SnapshotKeepLast,
+		OlderThan: time.Duration(c.SnapshotMaxAge) * 24 * time.Hour,
+	}
+	return opts, opts.validate() == nil
+}
+
+// SnapshotVolume creates a point-in-time snapshot of the volume, given by id
+// or name, and deletes the snapshots of the volume expired by the retention
+// rules of the config. Returns the id of the snapshot
+func (a *AWS) SnapshotVolume(config *Config, volume string) (string, error) {
+	compute, err := a.getEc2Service(config)
+	if err != nil {
+		return "", err
+	}
+
+	source, err := a.describeVolume(compute, volume)
+	if err != nil {
+		return "", err
+	}
+
+	volumeName := awsNanosVolume(source).Name
+	if volumeName == "" {
+		volumeName = aws.StringValue(source.VolumeId)
+	}
+
+	tags := getAWSDefaultTags()
+	tags = append(tags,
+		&ec2.Tag{Key: aws.String("Name"), Value: aws.String(volumeName + "-" + time.Now().UTC().Format("20060102150405"))},
+		&ec2.Tag{Key: aws.String(awsSnapshotVolumeTag), Value: aws.String(volumeName)},
+	)
+
+	snapshot, err := compute.CreateSnapshot(&ec2.CreateSnapshotInput{
+		VolumeId:    source.VolumeId,
+		Description: aws.String(fmt.Sprintf("nanos volume %s snapshot", volumeName)),
+		TagSpecifications: []*ec2.TagSpecification{
+			{ResourceType: aws.String("snapshot"), Tags: withDefaultTags(config, tags)},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("snapshot volume %s: %v", volume, err)
+	}
+
+	snapshotID := aws.StringValue(snapshot.SnapshotId)
+
+	err = compute.WaitUntilSnapshotCompleted(&ec2.DescribeSnapshotsInput{
+		SnapshotIds: []*string{snapshot.SnapshotId},
+	})
+	if err != nil {
+		return snapshotID, fmt.Errorf("wait for snapshot %s: %v", snapshotID, err)
+	}
+
+	logger := NewConfigLogger(config)
+	logger.Log("Created snapshot %s of volume %s", snapshotID, volumeName)
+
+	if opts, ok := snapshotRetention(&config.CloudConfig); ok {
+		err = a.pruneVolumeSnapshots(logger, compute, volumeName, opts)
+		if err != nil {
+			return snapshotID, err
+		}
+	}
+
+	return snapshotID, nil
+}
+
+// volumeSnapshots returns the snapshots taken by ops of the volume name
+func (a *AWS) volumeSnapshots(compute *ec2.EC2, volumeName string) ([]*ec2.Snapshot, error) {
+	var snapshots []*ec2.Snapshot
+
+	err := compute.DescribeSnapshotsPages(&ec2.DescribeSnapshotsInput{
+		OwnerIds: aws.StringSlice([]string{"self"}),
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:" + awsSnapshotVolumeTag), Values: aws.StringSlice([]string{volumeName})},
+		},
+	}, func(page *ec2.DescribeSnapshotsOutput, lastPage bool) bool {
+		snapshots = append(snapshots, page.Snapshots...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe snapshots of volume %s: %v", volumeName, err)
+	}
+
+	return snapshots, nil
+}
+
+// pruneVolumeSnapshots deletes the completed snapshots of the volume name
+// expired by the retention rules
+func (a *AWS) pruneVolumeSnapshots(logger *Logger, compute *ec2.EC2, volumeName string, opts PruneOptions) error {
+	snapshots, err := a.volumeSnapshots(compute, volumeName)
+	if err != nil {
+		return err
+	}
+
+	var candidates []pruneCandidate
+	for _, snapshot := range snapshots {
+		if aws.StringValue(snapshot.State) != ec2.SnapshotStateCompleted {
+			continue
+		}
+
+		candidates = append(candidates, pruneCandidate{
+			ID:      aws.StringValue(snapshot.SnapshotId),
+			Name:    volumeName,
+			Created: aws.TimeValue(snapshot.StartTime),
+		})
+	}
+
+	for _, snapshot := range opts.selectPruned(candidates, time.Now()) {
+		_, err = compute.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(snapshot.ID)})
+		if err != nil {
+			return fmt.Errorf("delete snapshot %s: %v", snapshot.ID, err)
+		}
+
+		logger.Log("Deleted expired snapshot %s of volume %s", snapshot.ID, volumeName)
+	}
+
+	return nil
+}
+
+// describeVolumeSnapshot returns the snapshot with the id passed by argument
+// or the newest snapshot of the volume name
+func (a *AWS) describeVolumeSnapshot(compute *ec2.EC2, snapshot string) (*ec2.Snapshot, error) {
+	if strings.HasPrefix(snapshot, "snap-") {
+		result, err := compute.DescribeSnapshots(&ec2.DescribeSnapshotsInput{
+			SnapshotIds: aws.StringSlice([]string{snapshot}),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describe snapshot %s: %v", snapshot, err)
+		}
+		if len(result.Snapshots) == 0 {
+			return nil, fmt.Errorf("snapshot %s not found", snapshot)
+		}
+		return result.Snapshots[0], nil
+	}
+
+	snapshots, err := a.volumeSnapshots(compute, snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	var newest *ec2.Snapshot
+	for _, s := range snapshots {
+		if aws.StringValue(s.State) != ec2.SnapshotStateCompleted {
+			continue
+		}
+		if newest == nil || aws.TimeValue(s.StartTime).After(aws.TimeValue(newest.StartTime)) {
+			newest = s
+		}
+	}
+
+	if newest == nil {
+		return nil, fmt.Errorf("no snapshot of volume %s", snapshot)
+	}
+
+	return newest, nil
+}
+
+// RestoreVolume creates the volume name from a snapshot, given by id or by
+// the name of the volume whose newest snapshot is restored. The filesystem
+// of the new volume keeps the label of the snapshotted volume
+func (a *AWS) RestoreVolume(config *Config, snapshot string, name string) (NanosVolume, error) {
+	var vol NanosVolume
+
+	err := validateEBSSettings(config.CloudConfig.DataVolumeType, config.CloudConfig.DataVolumeIops, config.CloudConfig.DataVolumeThroughput)
+	if err != nil {
+		return vol, err
+	}
+
+	compute, err := a.getEc2Service(config)
+	if err != nil {
+		return vol, err
+	}
+
+	source, err := a.describeVolumeSnapshot(compute, snapshot)
+	if err != nil {
+		return vol, err
+	}
+
+	tags, _ := parseToAWSTags(config.RunConfig.Tags, name)
+	tags = withDefaultTags(config, tags)
+
+	input := &ec2.CreateVolumeInput{
+		AvailabilityZone: aws.String(volumeAvailabilityZone(config)),
+		SnapshotId:       source.SnapshotId,
+		TagSpecifications: []*ec2.TagSpecification{
+			{ResourceType: aws.String("volume"), Tags: tags},
+		},
+	}
+	dataVolumeInput(config, input)
+
+	created, err := compute.CreateVolume(input)
+	if err != nil {
+		return vol, fmt.Errorf("restore snapshot %s: %v", aws.StringValue(source.SnapshotId), err)
+	}
+
+	err = compute.WaitUntilVolumeAvailable(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{created.VolumeId},
+	})
+	if err != nil {
+		return vol, fmt.Errorf("wait for volume %s: %v", aws.StringValue(created.VolumeId), err)
+	}
+
+	NewConfigLogger(config).Log("Restored snapshot %s to volume %s", aws.StringValue(source.SnapshotId), aws.StringValue(created.VolumeId))
+
+	return awsNanosVolume(&ec2.Volume{
+		VolumeId:         created.VolumeId,
+		Tags:             tags,
+		State:            aws.String(ec2.VolumeStateAvailable),
+		Size:             created.Size,
+		AvailabilityZone: created.AvailabilityZone,
+		CreateTime:       created.CreateTime,
+	}), nil
+}
@@ -0,0 +1,255 @@
+package lepton
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Filesystem metrics the cloudwatch klib publishes for each mounted volume
+// of an instance, along the names of the cloudwatch agent
+const (
+	volumeUsageNamespace  = "CWAgent"
+	diskUsedPercentMetric = "disk_used_percent"
+	diskUsedMetric        = "disk_used"
+	diskTotalMetric       = "disk_total"
+)
+
+// volumeUsageWindow is how far back the latest filesystem metrics of an
+// instance are looked up
+const volumeUsageWindow = 15 * time.Minute
+
+// VolumeUsage is the filesystem utilization of a volume of a running instance
+type VolumeUsage struct {
+	InstanceID  string
+	Path        string // mount point, / for the root volume
+	Device      string
+	Used        int64 // bytes
+	Total       int64 // bytes
+	UsedPercent float64
+	Time        time.Time // of the latest metrics
+}
+
+// metricDimension returns the value of the dimension name of a metric
+func metricDimension(dimensions []*cloudwatch.Dimension, name string) string {
+	for _, dimension := range dimensions {
+		if aws.StringValue(dimension.Name) == name {
+			return aws.StringValue(dimension.Value)
+		}
+	}
+	return ""
+}
+
+// latestValue returns the most recent value of a metric query result, false
+// if the metric has no datapoint in the window
+func latestValue(result *cloudwatch.MetricDataResult) (float64, time.Time, bool) {
+	var latest time.Time
+	var value float64
+	found := false
+	if result == nil {
+		return value, latest, found
+	}
+
+	for i, timestamp := range result.Timestamps {
+		if i >= len(result.Values) {
+			break
+		}
+		if t := aws.TimeValue(timestamp); !found || t.After(latest) {
+			latest = t
+			value = aws.Float64Value(result.Values[i])
+			found = true
+		}
+	}
+	return value, latest, found
+}
+
+// volumesAbove returns the volumes more used than percent
+func volumesAbove(usages []VolumeUsage, percent float64) []VolumeUsage {
+	var above []VolumeUsage
+	for _, usage := range usages {
+		if usage.UsedPercent > percent {
+			above = append(above, usage)
+		}
+	}
+	return above
+}
+
+// GetVolumeUsage returns the filesystem utilization of the root and data
+// volumes of the running instance, given by id or name, as reported by the
+// cloudwatch klib of its image
+func (p *AWS) GetVolumeUsage(ctx *Context, instance string) ([]VolumeUsage, error) {
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := p.describeInstance(compute, instance)
+	if err != nil {
+		return nil, err
+	}
+	id := aws.StringValue(source.InstanceId)
+
+	if state := aws.StringValue(source.State.Name); state != ec2.InstanceStateNameRunning {
+		return nil, fmt.Errorf("instance %s is %s, volume usage is reported by running instances", id, state)
+	}
+
+	sess, err := p.getAWSSession(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+	svc := cloudwatch.New(sess)
+
+	var metrics []*cloudwatch.Metric
+	err = svc.ListMetricsPages(&cloudwatch.ListMetricsInput{
+		Namespace:  aws.String(volumeUsageNamespace),
+		MetricName: aws.String(diskUsedPercentMetric),
+		Dimensions: []*cloudwatch.DimensionFilter{
+			{Name: aws.String("InstanceId"), Value: aws.String(id)},
+		},
+	}, func(page *cloudwatch.ListMetricsOutput, lastPage bool) bool {
+		metrics = append(metrics, page.Metrics...)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list filesystem metrics of %s: %v", id, err)
+	}
+
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("instance %s reports no volume usage, its image needs the cloudwatch klib with disk metrics", id)
+	}
+
+	// the used and total bytes of a volume share the dimensions of its
+	// used percent
+	names := []string{diskUsedPercentMetric, diskUsedMetric, diskTotalMetric}
+	var queries []*cloudwatch.MetricDataQuery
+	for i, metric := range metrics {
+		for j, name := range names {
+			queries = append(queries, &cloudwatch.MetricDataQuery{
+				Id: aws.String("m" + strconv.Itoa(i) + "_" + strconv.Itoa(j)),
+				MetricStat: &cloudwatch.MetricStat{
+					Metric: &cloudwatch.Metric{
+						Namespace:  aws.String(volumeUsageNamespace),
+						MetricName: aws.String(name),
+						Dimensions: metric.Dimensions,
+					},
+					Period: aws.Int64(60),
+					Stat:   aws.String(cloudwatch.StatisticMaximum),
+				},
+			})
+		}
+	}
+
+	now := time.Now()
+	results := map[string]*cloudwatch.MetricDataResult{}
+	err = svc.GetMetricDataPages(&cloudwatch.GetMetricDataInput{
+		MetricDataQueries: queries,
+		StartTime:         aws.Time(now.Add(-volumeUsageWindow)),
+		EndTime:           aws.Time(now),
+	}, func(page *cloudwatch.GetMetricDataOutput, lastPage bool) bool {
+		for _, result := range page.MetricDataResults {
+			if existing, ok := results[aws.StringValue(result.Id)]; ok {
+				existing.Timestamps = append(existing.Timestamps, result.Timestamps...)
+				existing.Values = append(existing.Values, result.Values...)
+				continue
+			}
+			results[aws.StringValue(result.Id)] = result
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get filesystem metrics of %s: %v", id, err)
+	}
+
+	var usages []VolumeUsage
+	for i, metric := range metrics {
+		percent, latest, ok := latestValue(results["m"+strconv.Itoa(i)+"_0"])
+		if !ok {
+			// the volume was unmounted or the instance replaced
+			continue
+		}
+
+		usage := VolumeUsage{
+			InstanceID:  id,
+			Path:        metricDimension(metric.Dimensions, "path"),
+			Device:      metricDimension(metric.Dimensions, "device"),
+			UsedPercent: percent,
+			Time:        latest,
+		}
+		if used, _, ok := latestValue(results["m"+strconv.Itoa(i)+"_1"]); ok {
+			usage.Used = int64(used)
+		}
+		if total, _, ok := latestValue(results["m"+strconv.Itoa(i)+"_2"]); ok {
+			usage.Total = int64(total)
+		}
+
+		usages = append(usages, usage)
+	}
+
+	if len(usages) == 0 {
+		return nil, fmt.Errorf("instance %s reported no volume usage in the last %s", id, volumeUsageWindow)
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].Path < usages[j].Path
+	})
+
+	return usages, nil
+}
+
+// PrintVolumeUsage prints the filesystem utilization of the volumes of the
+// instance. Fails if a volume is more used than threshold percent, unless
+// threshold is 0
+func (p *AWS) PrintVolumeUsage(ctx *Context, instance string, threshold float64) error {
+	usages, err := p.GetVolumeUsage(ctx, instance)
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Path", "Device", "Used", "Total", "Used %", "Reported"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
+	table.SetRowLine(true)
+
+	for _, usage := range usages {
+		table.Append([]string{
+			usage.Path,
+			usage.Device,
+			Bytes2Human(usage.Used),
+			Bytes2Human(usage.Total),
+			strconv.FormatFloat(usage.UsedPercent, 'f', 1, 64),
+			formatTime(usage.Time, ctx.config.RunConfig.TimeFormat),
+		})
+	}
+
+	table.Render()
+
+	if threshold <= 0 {
+		return nil
+	}
+
+	above := volumesAbove(usages, threshold)
+	if len(above) == 0 {
+		return nil
+	}
+
+	var paths []string
+	for _, usage := range above {
+		paths = append(paths, fmt.Sprintf("%s (%.1f%%)", usage.Path, usage.UsedPercent))
+	}
+
+	return fmt.Errorf("volumes of %s over %.0f%% used: %s", usages[0].InstanceID, threshold, strings.Join(paths, ", "))
+}
@@ -0,0 +1,193 @@
+package lepton
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsVPCEndpointTag marks the gateway endpoints created by ops
+const awsVPCEndpointTag = "OpsVpcEndpoint"
+
+// gatewayEndpointServices are the services reachable through gateway
+// endpoints, free of the data processing charges of nat gateways
+var gatewayEndpointServices = []string{"s3", "dynamodb"}
+
+// validateVPCEndpoints checks the gateway endpoint services of the cloud
+// config
+func validateVPCEndpoints(c *ProviderConfig) error {
+	for _, service := range c.VPCEndpoints {
+		valid := false
+		for _, s := range gatewayEndpointServices {
+			if strings.ToLower(service) == s {
+				valid = true
+				break
+			}
+		}
+
+		if !valid {
+			return fmt.Errorf("invalid vpc endpoint service %q, expected %s", service, strings.Join(gatewayEndpointServices, " or "))
+		}
+	}
+
+	return nil
+}
+
+// gatewayEndpointServiceName returns the name of the gateway endpoint service
+// in region, e.g. com.amazonaws.us-west-2.s3
+func gatewayEndpointServiceName(region string, service string) string {
+	return "com.amazonaws." + region + "." + strings.ToLower(service)
+}
+
+// awsVPCEndpointFilter filters the gateway endpoints created by ops
+func awsVPCEndpointFilter() *ec2.Filter {
+	return &ec2.Filter{Name: aws.String("tag:" + awsVPCEndpointTag), Values: aws.StringSlice([]string{"true"})}
+}
+
+// isOpsVPCEndpoint returns true if the endpoint was created by ops
+func isOpsVPCEndpoint(endpoint *ec2.VpcEndpoint) bool {
+	for _, tag := range endpoint.Tags {
+		if aws.StringValue(tag.Key) == awsVPCEndpointTag && aws.StringValue(tag.Value) == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// missingRouteTables returns the route tables passed by argument none of the
+// endpoints is associated with
+func missingRouteTables(endpoints []*ec2.VpcEndpoint, routeTables []string) []string {
+	associated := map[string]bool{}
+	for _, endpoint := range endpoints {
+		for _, id := range endpoint.RouteTableIds {
+			associated[aws.StringValue(id)] = true
+		}
+	}
+
+	var missing []string
+	for _, id := range routeTables {
+		if !associated[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// subnetRouteTables returns the route tables of the subnet, the main route
+// table of its vpc if it has no explicit association
+func subnetRouteTables(svc *ec2.EC2, subnet *ec2.Subnet) ([]string, error) {
+	filters := [][]*ec2.Filter{
+		{
+			{Name: aws.String("association.subnet-id"), Values: []*string{subnet.SubnetId}},
+		},
+		{
+			{Name: aws.String("vpc-id"), Values: []*string{subnet.VpcId}},
+			{Name: aws.String("association.main"), Values: aws.StringSlice([]string{"true"})},
+		},
+	}
+
+	for _, filter := range filters {
+		result, err := svc.DescribeRouteTables(&ec2.DescribeRouteTablesInput{Filters: filter})
+		if err != nil {
+			return nil, fmt.Errorf("describe route tables of subnet %s: %v", aws.StringValue(subnet.SubnetId), err)
+		}
+
+		var ids []string
+		for _, table := range result.RouteTables {
+			ids = append(ids, aws.StringValue(table.RouteTableId))
+		}
+		if len(ids) > 0 {
+			return ids, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no route table found for subnet %s", aws.StringValue(subnet.SubnetId))
+}
+
+// ensureVPCEndpoints routes the traffic of the subnet to the services of the
+// cloud config through gateway endpoints of its vpc, instances without
+// public ips reaching s3 and dynamodb without a nat gateway. Route tables
+// already routed through an endpoint are left as is, others are associated
+// with the endpoint created by ops, created if missing. Endpoints created by
+// the user are never modified
+func (p *AWS) ensureVPCEndpoints(ctx *Context, svc *ec2.EC2, subnet *ec2.Subnet) error {
+	routeTables, err := subnetRouteTables(svc, subnet)
+	if err != nil {
+		return err
+	}
+
+	for _, service := range ctx.config.CloudConfig.VPCEndpoints {
+		serviceName := gatewayEndpointServiceName(ctx.config.CloudConfig.Zone, service)
+
+		result, err := svc.DescribeVpcEndpoints(&ec2.DescribeVpcEndpointsInput{
+			Filters: []*ec2.Filter{
+				{Name: aws.String("vpc-id"), Values: []*string{subnet.VpcId}},
+				{Name: aws.String("service-name"), Values: aws.StringSlice([]string{serviceName})},
+				{Name: aws.String("vpc-endpoint-type"), Values: aws.StringSlice([]string{ec2.VpcEndpointTypeGateway})},
+				{Name: aws.String("vpc-endpoint-state"), Values: aws.StringSlice([]string{"pending", "available"})},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("describe %s endpoints: %v", service, err)
+		}
+
+		// route tables already routed through endpoints of the user are left
+		// alone, only the endpoints created by ops are modified
+		missing := missingRouteTables(result.VpcEndpoints, routeTables)
+		if len(missing) == 0 {
+			continue
+		}
+
+		var endpoint *ec2.VpcEndpoint
+		for _, e := range result.VpcEndpoints {
+			if isOpsVPCEndpoint(e) {
+				endpoint = e
+				break
+			}
+		}
+
+		if endpoint != nil {
+			if ctx.config.RunConfig.DryRun {
+				dryRunf("would route %s of route tables %s through endpoint %s", service, strings.Join(missing, ", "), aws.StringValue(endpoint.VpcEndpointId))
+				continue
+			}
+
+			_, err = svc.ModifyVpcEndpoint(&ec2.ModifyVpcEndpointInput{
+				VpcEndpointId:    endpoint.VpcEndpointId,
+				AddRouteTableIds: aws.StringSlice(missing),
+			})
+			if err != nil {
+				return fmt.Errorf("route %s through endpoint %s: %v", service, aws.StringValue(endpoint.VpcEndpointId), err)
+			}
+
+			ctx.logger.Log("Routed %s of route tables %s through endpoint %s", service, strings.Join(missing, ", "), aws.StringValue(endpoint.VpcEndpointId))
+			continue
+		}
+
+		if ctx.config.RunConfig.DryRun {
+			dryRunf("would create %s gateway endpoint in vpc %s for route tables %s", service, aws.StringValue(subnet.VpcId), strings.Join(missing, ", "))
+			continue
+		}
+
+		tags, _ := parseToAWSTags([]Tag{{Key: awsVPCEndpointTag, Value: "true"}}, "ops-"+strings.ToLower(service)+"-endpoint")
+
+		created, err := svc.CreateVpcEndpoint(&ec2.CreateVpcEndpointInput{
+			VpcId:           subnet.VpcId,
+			ServiceName:     aws.String(serviceName),
+			VpcEndpointType: aws.String(ec2.VpcEndpointTypeGateway),
+			RouteTableIds:   aws.StringSlice(missing),
+			TagSpecifications: []*ec2.TagSpecification{
+				{ResourceType: aws.String("vpc-endpoint"), Tags: withDefaultTags(ctx.config, withDeployIDTag(ctx, tags))},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("create %s endpoint: %v", service, err)
+		}
+
+		ctx.logger.Log("Created %s gateway endpoint %s in vpc %s", service, aws.StringValue(created.VpcEndpoint.VpcEndpointId), aws.StringValue(subnet.VpcId))
+	}
+
+	return nil
+}
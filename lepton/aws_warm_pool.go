@@ -0,0 +1,155 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// awsWarmPoolTag is the instance tag holding the warm pool of a stopped
+// instance waiting to be started by a cutover
+const awsWarmPoolTag = "WarmPool"
+
+// PrewarmInstances launches the instances of the run config in the warm pool
+// pool and stops them once they are running, so a later cutover only has to
+// start them. Returns the ids of the stopped instances
+func (p *AWS) PrewarmInstances(ctx *Context, pool string) ([]string, error) {
+	if pool == "" {
+		return nil, errors.New("warm pool name missing")
+	}
+
+	if hasDomainNames(ctx.config) {
+		return nil, errors.New("the domain name of a warm pool is assigned on cutover")
+	}
+
+	ctx.config.RunConfig.Tags = append(ctx.config.RunConfig.Tags, Tag{Key: awsWarmPoolTag, Value: pool})
+
+	ids, err := p.CreateInstances(ctx)
+	if err != nil {
+		return ids, err
+	}
+
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return ids, err
+	}
+
+	ctx.logger.Log("waiting for instances to run to stop them")
+
+	err = compute.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(ids),
+	})
+	if err != nil {
+		return ids, fmt.Errorf("wait for warm pool %s instances: %v", pool, err)
+	}
+
+	err = p.StopInstances(ctx, ids)
+	if err != nil {
+		return ids, err
+	}
+
+	err = compute.WaitUntilInstanceStopped(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(ids),
+	})
+	if err != nil {
+		return ids, fmt.Errorf("wait for warm pool %s instances to stop: %v", pool, err)
+	}
+
+	ctx.logger.Log("Warm pool %s ready with %d instances", pool, len(ids))
+
+	return ids, nil
+}
+
+// CutoverWarmPool starts the stopped instances of the warm pool and, once
+// they run, points the configured domain name to them and deletes the
+// instances matching retire, the fleet being replaced. Started instances
+// leave the pool
+func (p *AWS) CutoverWarmPool(ctx *Context, pool string, retire []ListFilter) ([]string, error) {
+	compute, err := p.getEc2Service(ctx.config)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := compute.DescribeInstances(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag:CreatedBy"), Values: aws.StringSlice([]string{"ops"})},
+			{Name: aws.String("tag:" + awsWarmPoolTag), Values: aws.StringSlice([]string{pool})},
+			{Name: aws.String("instance-state-name"), Values: aws.StringSlice([]string{ec2.InstanceStateNameStopped})},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			ids = append(ids, aws.StringValue(instance.InstanceId))
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no stopped instances in warm pool %s", pool)
+	}
+
+	// find the retired fleet before starting the pool in case the filters
+	// match the pool instances too
+	var retired []string
+	if len(retire) > 0 {
+		matched, err := p.FindInstanceIDs(ctx, retire)
+		if err != nil {
+			return nil, err
+		}
+
+		pooled := map[string]bool{}
+		for _, id := range ids {
+			pooled[id] = true
+		}
+
+		for _, id := range matched {
+			if !pooled[id] {
+				retired = append(retired, id)
+			}
+		}
+	}
+
+	err = p.StartInstances(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	err = compute.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
+		InstanceIds: aws.StringSlice(ids),
+	})
+	if err != nil {
+		return ids, fmt.Errorf("wait for warm pool %s instances: %v", pool, err)
+	}
+
+	_, err = compute.DeleteTags(&ec2.DeleteTagsInput{
+		Resources: aws.StringSlice(ids),
+		Tags:      []*ec2.Tag{{Key: aws.String(awsWarmPoolTag)}},
+	})
+	if err != nil {
+		return ids, fmt.Errorf("remove instances from warm pool %s: %v", pool, err)
+	}
+
+	if hasDomainNames(ctx.config) {
+		err = p.pointDomainNames(ctx, compute, ids)
+		if err != nil {
+			return ids, err
+		}
+	}
+
+	if len(retired) > 0 {
+		err = p.DeleteInstances(ctx, retired)
+		if err != nil {
+			return ids, err
+		}
+	}
+
+	ctx.logger.Log("Cut over to warm pool %s", pool)
+
+	return ids, nil
+}
@@ -5,9 +5,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,7 +19,6 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2020-06-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-05-01/network"
-	"github.com/Azure/azure-storage-blob-go/azblob"
 
 	"github.com/olekukonko/tablewriter"
 )
@@ -128,6 +127,75 @@ func (a *Azure) getVMClient() (*compute.VirtualMachinesClient, error) {
 	return &vmClient, nil
 }
 
+func (a *Azure) getResourceSkusClient() (*compute.ResourceSkusClient, error) {
+	skusClient := compute.NewResourceSkusClient(a.subID)
+	authr, err := a.GetResourceManagementAuthorizer()
+	if err != nil {
+		return nil, err
+	}
+	skusClient.Authorizer = authr
+	skusClient.AddToUserAgent(userAgent)
+	return &skusClient, nil
+}
+
+// azureSkuZones returns the availability zones of the location the virtual
+// machine size sku is offered in, sorted, none if the location has no zones
+func azureSkuZones(sku compute.ResourceSku, location string) []string {
+	if sku.LocationInfo == nil {
+		return nil
+	}
+
+	var zones []string
+	for _, info := range *sku.LocationInfo {
+		if !strings.EqualFold(to.String(info.Location), location) || info.Zones == nil {
+			continue
+		}
+		zones = append(zones, *info.Zones...)
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// vmSizeZones returns the availability zones of the location the virtual
+// machine size is offered in, read from the resource skus of the location
+func (a *Azure) vmSizeZones(location string, size compute.VirtualMachineSizeTypes) ([]string, error) {
+	skusClient, err := a.getResourceSkusClient()
+	if err != nil {
+		return nil, err
+	}
+
+	skus, err := skusClient.ListComplete(context.TODO(), "location eq '"+location+"'")
+	if err != nil {
+		return nil, fmt.Errorf("list resource skus of %s: %v", location, err)
+	}
+
+	for skus.NotDone() {
+		sku := skus.Value()
+		if to.String(sku.ResourceType) == "virtualMachines" && strings.EqualFold(to.String(sku.Name), string(size)) {
+			return azureSkuZones(sku, location), nil
+		}
+
+		err = skus.NextWithContext(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("list resource skus of %s: %v", location, err)
+		}
+	}
+
+	return nil, nil
+}
+
+// deleteFailedVM deletes a virtual machine that failed to be allocated, its
+// name being reused by the next attempt
+func (a *Azure) deleteFailedVM(ctx *Context, vmClient *compute.VirtualMachinesClient, vmName string) {
+	future, err := vmClient.Delete(context.TODO(), a.groupName, vmName)
+	if err == nil {
+		err = future.WaitForCompletionRef(context.TODO(), vmClient.Client)
+	}
+	if err != nil {
+		ctx.logger.Warn("unable to delete the failed vm %s: %v", vmName, err)
+	}
+}
+
 func (a *Azure) getVMExtensionsClient() compute.VirtualMachineExtensionsClient {
 	extClient := compute.NewVirtualMachineExtensionsClient(a.subID)
 	authr, _ := a.GetResourceManagementAuthorizer()
@@ -136,17 +204,16 @@ func (a *Azure) getVMExtensionsClient() compute.VirtualMachineExtensionsClient {
 	return extClient
 }
 
-func (a *Azure) getLocation(config *Config) string {
+func (a *Azure) getLocation(config *Config) (string, error) {
 	c := config
 	location := c.CloudConfig.Zone
 	if location == "" {
 		location = a.locationDefault
 	}
 	if location == "" {
-		fmt.Println("Error: a location must be set via either the Zone attribute in CloudConfig or the AZURE_LOCATION_DEFAULT environment variable.")
-		os.Exit(1)
+		return "", errors.New("a location must be set via either the Zone attribute in CloudConfig or the AZURE_LOCATION_DEFAULT environment variable")
 	}
-	return location
+	return location, nil
 }
 
 // GetVM gets the specified VM info
@@ -283,14 +350,23 @@ func (a *Azure) CreateImage(ctx *Context) error {
 
 	bucket := c.CloudConfig.BucketName
 
-	region := a.getLocation(ctx.config)
+	region, err := a.getLocation(ctx.config)
+	if err != nil {
+		return err
+	}
 	container := "quickstart-nanos"
 	disk := c.CloudConfig.ImageName + ".vhd"
 
 	uri := "https://" + bucket + ".blob.core.windows.net/" + container + "/" + disk
 
+	tags := map[string]*string{}
+	for _, tag := range imageMetadata(c) {
+		tags[tag.Key] = to.StringPtr(tag.Value)
+	}
+
 	imageParams := compute.Image{
 		Location: to.StringPtr(region),
+		Tags:     azureDefaultTags(c, tags),
 		ImageProperties: &compute.ImageProperties{
 			StorageProfile: &compute.ImageStorageProfile{
 				OsDisk: &compute.ImageOSDisk{
@@ -305,10 +381,26 @@ func (a *Azure) CreateImage(ctx *Context) error {
 
 	res, err := imagesClient.CreateOrUpdate(context.TODO(), a.groupName, imgName, imageParams)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
-	fmt.Printf("%+v", res)
+	ctx.logger.Log("Image creation started %s.", imgName)
+	ctx.logger.Debug("%+v", res)
+
+	// gallery versions are published from the managed image once created
+	if c.CloudConfig.ImageGallery != "" {
+		err = res.WaitForCompletionRef(context.TODO(), imagesClient.Client)
+		if err != nil {
+			return err
+		}
+
+		image, err := res.Result(*imagesClient)
+		if err != nil {
+			return err
+		}
+
+		return a.publishGalleryImage(ctx, region, to.String(image.ID))
+	}
 
 	return nil
 }
@@ -338,7 +430,7 @@ func (a *Azure) GetImages(ctx *Context) ([]CloudImage, error) {
 		cimages = append(cimages, cImage)
 	}
 
-	return cimages, nil
+	return FilterImages(cimages, ctx.listFilters())
 }
 
 // ListImages lists images on azure
@@ -377,20 +469,27 @@ func (a *Azure) DeleteImage(ctx *Context, imagename string) error {
 		return err
 	}
 
+	if ctx.config.CloudConfig.ImageGallery != "" {
+		err = a.deleteGalleryImage(ctx, imagename)
+		if err != nil {
+			return err
+		}
+	}
+
 	fut, err := imagesClient.Delete(context.TODO(), a.groupName, imagename)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
-	fmt.Printf("%+v", fut)
+	ctx.logger.Log("Image deletion started %s.", imagename)
+	ctx.logger.Debug("%+v", fut)
 
 	return nil
 }
 
 // SyncImage syncs image from provider to another provider
 func (a *Azure) SyncImage(config *Config, target Provider, image string) error {
-	fmt.Println("not yet implemented")
-	return nil
+	return errors.New("image sync is not yet implemented")
 }
 
 // CreateInstance - Creates instance on azure Platform
@@ -410,28 +509,36 @@ func (a *Azure) CreateInstance(ctx *Context) error {
 	if bucket == "" {
 		bucket = a.storageAccount
 	}
-	if bucket == "" {
-		fmt.Println("AZURE_STORAGE_ACCOUNT should be set otherwise logs can not be retrieved.")
-		os.Exit(1)
+	location, err := a.getLocation(ctx.config)
+	if err != nil {
+		return err
+	}
+
+	// spot settings are checked before any resource is created
+	var spot compute.VirtualMachineProperties
+	if err := azureSpotProperties(&c.RunConfig, &spot); err != nil {
+		return err
 	}
-	location := a.getLocation(ctx.config)
 
 	vmName := ctx.config.CloudConfig.ImageName + strconv.FormatInt(time.Now().Unix(), 10)
 	ctx.logger.Log("spinning up:\t%s\n", vmName)
 
-	// create virtual network
+	// use the existing network of the config or create one
 	var vnet *network.VirtualNetwork
-	var err error
-	configVPC := ctx.config.RunConfig.VPC
-	if configVPC != "" {
-		vnet, err = a.GetVPC(configVPC)
+	var subnet *network.Subnet
+	target, err := azureNetworkTarget(c)
+	if err != nil {
+		return err
+	}
+	if target != nil {
+		vnet, subnet, err = a.getExistingNetwork(context.TODO(), target, location)
 		if err != nil {
-			ctx.logger.Error(err.Error())
-			return fmt.Errorf("error getting virtual network with id %s", configVPC)
+			return err
 		}
+		ctx.logger.Info("using subnet %s of virtual network %s\n", *subnet.Name, *vnet.Name)
 	} else {
 		ctx.logger.Info("creating virtual network with id %s\n", vmName)
-		vnet, err = a.CreateVirtualNetwork(context.TODO(), location, vmName)
+		vnet, err = a.CreateVirtualNetwork(context.TODO(), location, vmName, c)
 		if err != nil {
 			ctx.logger.Error(err.Error())
 			return errors.New("error creating virtual network")
@@ -457,15 +564,7 @@ func (a *Azure) CreateInstance(ctx *Context) error {
 	}
 
 	// create subnet
-	var subnet *network.Subnet
-	configSubnet := ctx.config.RunConfig.Subnet
-	if configSubnet != "" {
-		subnet, err = a.GetVirtualNetworkSubnet(context.TODO(), *vnet.Name, configSubnet)
-		if err != nil {
-			ctx.logger.Error(err.Error())
-			return errors.New("error getting subnet")
-		}
-	} else {
+	if subnet == nil {
 		ctx.logger.Info("creating subnet with id %s\n", vmName)
 		subnet, err = a.CreateSubnetWithNetworkSecurityGroup(context.TODO(), *vnet.Name, vmName, "10.0.0.0/24", *nsg.Name)
 		if err != nil {
@@ -476,16 +575,16 @@ func (a *Azure) CreateInstance(ctx *Context) error {
 
 	// create ip
 	ctx.logger.Info("creating public ip with id %s\n", vmName)
-	ip, err := a.CreatePublicIP(context.TODO(), location, vmName)
+	ip, err := a.CreatePublicIP(context.TODO(), location, vmName, c)
 	if err != nil {
 		ctx.logger.Error(err.Error())
 		return errors.New("error creating public ip")
 	}
 
 	// create nic
-	// pass vnet, subnet, ip, nicname
+	// pass subnet, ip, nicname
 	ctx.logger.Info("creating network interface controller with id %s\n", vmName)
-	nic, err := a.CreateNIC(context.TODO(), location, *vnet.Name, *subnet.Name, *nsg.Name, *ip.Name, vmName)
+	nic, err := a.CreateNIC(context.TODO(), location, subnet, *nsg.Name, *ip.Name, vmName, c)
 	if err != nil {
 		ctx.logger.Error(err.Error())
 		return errors.New("error creating network interface controller")
@@ -509,76 +608,125 @@ func (a *Azure) CreateInstance(ctx *Context) error {
 		flavor = compute.VirtualMachineSizeTypesStandardA1V2
 	}
 
-	future, err := vmClient.CreateOrUpdate(
-		nctx,
-		a.groupName,
-		vmName,
-		compute.VirtualMachine{
-			Location: to.StringPtr(location),
-			VirtualMachineProperties: &compute.VirtualMachineProperties{
-				HardwareProfile: &compute.HardwareProfile{
-					VMSize: flavor,
-				},
-				StorageProfile: &compute.StorageProfile{
-					ImageReference: &compute.ImageReference{
-						ID: to.StringPtr("/subscriptions/" + a.subID + "/resourceGroups/" + a.groupName + "/providers/Microsoft.Compute/images/" + ctx.config.CloudConfig.ImageName),
-					},
-				},
-				DiagnosticsProfile: &compute.DiagnosticsProfile{
-					BootDiagnostics: &compute.BootDiagnostics{
-						Enabled:    to.BoolPtr(true),
-						StorageURI: to.StringPtr("https://" + bucket + ".blob.core.windows.net/"),
-					},
+	imageID := "/subscriptions/" + a.subID + "/resourceGroups/" + a.groupName + "/providers/Microsoft.Compute/images/" + ctx.config.CloudConfig.ImageName
+	if ctx.config.CloudConfig.ImageGallery != "" {
+		imageID = a.galleryImageID(ctx.config, ctx.config.CloudConfig.ImageName)
+	}
+
+	var placementGroup *compute.SubResource
+	if c.RunConfig.PlacementGroup != "" {
+		groupID, err := a.ensureProximityPlacementGroup(ctx, location, c.RunConfig.PlacementGroup)
+		if err != nil {
+			return err
+		}
+		placementGroup = &compute.SubResource{ID: to.StringPtr(groupID)}
+	}
+
+	vmParams := compute.VirtualMachine{
+		Location: to.StringPtr(location),
+		Tags:     azureDefaultTags(ctx.config, nil),
+		VirtualMachineProperties: &compute.VirtualMachineProperties{
+			Priority:                spot.Priority,
+			EvictionPolicy:          spot.EvictionPolicy,
+			BillingProfile:          spot.BillingProfile,
+			ProximityPlacementGroup: placementGroup,
+			HardwareProfile: &compute.HardwareProfile{
+				VMSize: flavor,
+			},
+			StorageProfile: &compute.StorageProfile{
+				ImageReference: &compute.ImageReference{
+					ID: to.StringPtr(imageID),
 				},
-				OsProfile: &compute.OSProfile{
-					ComputerName:  to.StringPtr(vmName),
-					AdminUsername: to.StringPtr(username),
-					AdminPassword: to.StringPtr(password),
-					LinuxConfiguration: &compute.LinuxConfiguration{
-						SSH: &compute.SSHConfiguration{
-							PublicKeys: &[]compute.SSHPublicKey{
-								{
-									Path: to.StringPtr(
-										fmt.Sprintf("/home/%s/.ssh/authorized_keys",
-											username)),
-									KeyData: to.StringPtr(sshKeyData),
-								},
+			},
+			DiagnosticsProfile: azureBootDiagnostics(bucket),
+			OsProfile: &compute.OSProfile{
+				ComputerName:  to.StringPtr(vmName),
+				AdminUsername: to.StringPtr(username),
+				AdminPassword: to.StringPtr(password),
+				LinuxConfiguration: &compute.LinuxConfiguration{
+					SSH: &compute.SSHConfiguration{
+						PublicKeys: &[]compute.SSHPublicKey{
+							{
+								Path: to.StringPtr(
+									fmt.Sprintf("/home/%s/.ssh/authorized_keys",
+										username)),
+								KeyData: to.StringPtr(sshKeyData),
 							},
 						},
 					},
 				},
-				NetworkProfile: &compute.NetworkProfile{
-					NetworkInterfaces: &[]compute.NetworkInterfaceReference{
-						{
-							ID: nic.ID,
-							NetworkInterfaceReferenceProperties: &compute.NetworkInterfaceReferenceProperties{
-								Primary: to.BoolPtr(true),
-							},
+			},
+			NetworkProfile: &compute.NetworkProfile{
+				NetworkInterfaces: &[]compute.NetworkInterfaceReference{
+					{
+						ID: nic.ID,
+						NetworkInterfaceReferenceProperties: &compute.NetworkInterfaceReferenceProperties{
+							Primary: to.BoolPtr(true),
 						},
 					},
 				},
 			},
 		},
-	)
-	if err != nil {
-		fmt.Printf("cannot create vm: %v\n", err.Error())
-		os.Exit(1)
 	}
 
-	err = future.WaitForCompletionRef(nctx, vmClient.Client)
-	if err != nil {
-		fmt.Printf("cannot get the vm create or update future response: %v\n", err.Error())
-		os.Exit(1)
+	// virtual machines that can't be allocated in the location are retried
+	// in the availability zones the size is offered in, if the location has
+	// any, a failed one being deleted to free its name
+	var vm compute.VirtualMachine
+	otherZones := func() ([]string, error) {
+		// the virtual machines of a proximity placement group share a
+		// datacenter
+		if placementGroup != nil {
+			return nil, nil
+		}
+
+		sizeZones, err := a.vmSizeZones(location, flavor)
+		if err != nil {
+			return nil, err
+		}
+
+		var zones []string
+		for _, zone := range sizeZones {
+			zones = append(zones, location+" zone "+zone)
+		}
+		return zones, nil
 	}
 
-	vm, err := future.Result(*vmClient)
+	_, err = retryInZones(ctx, location, otherZones, azureCapacityExhausted, func(zone string) error {
+		vmParams.Zones = nil
+		if zone != location {
+			vmParams.Zones = &[]string{strings.TrimPrefix(zone, location+" zone ")}
+		}
+
+		future, err := vmClient.CreateOrUpdate(nctx, a.groupName, vmName, vmParams)
+		if err == nil {
+			err = future.WaitForCompletionRef(nctx, vmClient.Client)
+		}
+		if err != nil {
+			if azureCapacityExhausted(err) {
+				a.deleteFailedVM(ctx, vmClient, vmName)
+			}
+			return err
+		}
+
+		vm, err = future.Result(*vmClient)
+		return err
+	})
 	if err != nil {
-		fmt.Println(err)
+		return fmt.Errorf("cannot create vm: %v", err)
 	}
 
-	fmt.Printf("%+v\n", vm)
+	ctx.logger.Log("Instance creation succeeded %s.", vmName)
+	ctx.logger.Debug("%+v", vm)
+
+	if ctx.config.RunConfig.Wait {
+		err = WaitInstancesReady(ctx, a, []string{vmName})
+		if err != nil {
+			return err
+		}
+	}
 
-	if ctx.config.RunConfig.DomainName != "" {
+	if hasDomainNames(ctx.config) {
 		err = CreateDNSRecord(ctx.config, *ip.IPAddress, a)
 		if err != nil {
 			return err
@@ -588,8 +736,19 @@ func (a *Azure) CreateInstance(ctx *Context) error {
 	return nil
 }
 
-// GetInstanceByID returns the instance with the id passed by argument if it exists
-func (a *Azure) GetInstanceByID(ctx *Context, id string) (vm *CloudInstance, err error) {
+// GetInstanceByID returns the instance with the id passed by argument if it
+// exists. The id is a virtual machine resource id or, as instances are
+// identified by name in the resource group, an instance name
+func (a *Azure) GetInstanceByID(ctx *Context, id string) (*CloudInstance, error) {
+	if i := strings.LastIndex(id, "/virtualMachines/"); i != -1 {
+		id = id[i+len("/virtualMachines/"):]
+	}
+
+	return a.GetInstanceByName(ctx, id)
+}
+
+// GetInstanceByName returns the instance with the name passed by argument if it exists
+func (a *Azure) GetInstanceByName(ctx *Context, name string) (vm *CloudInstance, err error) {
 	vmClient, err := a.getVMClient()
 	if err != nil {
 		return
@@ -603,7 +762,7 @@ func (a *Azure) GetInstanceByID(ctx *Context, id string) (vm *CloudInstance, err
 		return
 	}
 
-	result, err := vmClient.Get(context.TODO(), a.groupName, id, compute.InstanceView)
+	result, err := vmClient.Get(context.TODO(), a.groupName, name, compute.InstanceView)
 	if err != nil {
 		return nil, err
 	}
@@ -642,7 +801,7 @@ func (a *Azure) GetInstances(ctx *Context) (cinstances []CloudInstance, err erro
 		cinstances = append(cinstances, *cinstance)
 	}
 
-	return
+	return FilterInstances(cinstances, ctx.listFilters())
 }
 
 func (a *Azure) convertToCloudInstance(instance *compute.VirtualMachine, nicClient *network.InterfacesClient, ipClient *network.PublicIPAddressesClient) (*CloudInstance, error) {
@@ -673,7 +832,7 @@ func (a *Azure) convertToCloudInstance(instance *compute.VirtualMachine, nicClie
 
 	pubip, err := ipClient.Get(context.TODO(), a.groupName, cinstance.Name, "")
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 	publicIP = *(*pubip.PublicIPAddressPropertiesFormat).IPAddress
 
@@ -791,7 +950,7 @@ func (a *Azure) StartInstance(ctx *Context, instancename string) error {
 		return err
 	}
 
-	fmt.Printf("Starting instance %s", instancename)
+	ctx.logger.Log("Starting instance %s", instancename)
 	_, err = vmClient.Start(context.TODO(), a.groupName, instancename)
 	if err != nil {
 		ctx.logger.Error(err.Error())
@@ -810,88 +969,68 @@ func (a *Azure) StopInstance(ctx *Context, instancename string) error {
 	}
 	// skipShutdown parameter is optional, we are taking its default
 	// value here
-	fmt.Printf("Stopping instance %s", instancename)
+	ctx.logger.Log("Stopping instance %s", instancename)
 	_, err = vmClient.PowerOff(context.TODO(), a.groupName, instancename, nil)
 	if err != nil {
-		fmt.Printf("cannot power off vm: %v\n", err.Error())
-		return err
+		return fmt.Errorf("cannot power off vm: %v", err)
 	}
 
 	return nil
 }
 
-// PrintInstanceLogs writes instance logs to console
+// RebootInstance restarts instance from Azure
+func (a *Azure) RebootInstance(ctx *Context, instancename string) error {
+	ctx.logger.Log("Restarting instance %s", instancename)
+	_, err := a.RestartVM(context.TODO(), instancename)
+	return err
+}
+
+// PrintInstanceLogs writes the serial log of the instance to the console,
+// polling it for new output if watch is set
 func (a *Azure) PrintInstanceLogs(ctx *Context, instancename string, watch bool) error {
-	l, err := a.GetInstanceLogs(ctx, instancename)
+	uri, err := a.bootLogURI(instancename)
 	if err != nil {
 		return err
 	}
-	fmt.Printf(l)
-	return nil
-}
-
-// GetInstanceLogs gets instance related logs
-func (a *Azure) GetInstanceLogs(ctx *Context, instancename string) (string, error) {
-	// this is basically 2 calls
-	// 1) grab the log location
-	// 2) grab it from storage
 
-	accountName, accountKey := os.Getenv("AZURE_STORAGE_ACCOUNT"), os.Getenv("AZURE_STORAGE_ACCESS_KEY")
-	if len(accountName) == 0 || len(accountKey) == 0 {
-		fmt.Println("Either the AZURE_STORAGE_ACCOUNT or AZURE_STORAGE_ACCESS_KEY environment variable is not set")
-	}
-
-	credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+	next, err := tailBootLog(os.Stdout, uri, 0)
 	if err != nil {
-		fmt.Printf("Invalid credentials with error: %s\n", err.Error())
+		return err
 	}
-	p := azblob.NewPipeline(credential, azblob.PipelineOptions{})
 
-	URL, _ := url.Parse(
-		fmt.Sprintf("https://%s.blob.core.windows.net/", accountName))
+	for watch {
+		time.Sleep(serialPortPollInterval)
 
-	containerURL := azblob.NewContainerURL(*URL, p)
+		next, err = tailBootLog(os.Stdout, uri, next)
+		if err == errBootLogURIExpired {
+			uri, err = a.bootLogURI(instancename)
+			if err == nil {
+				next, err = tailBootLog(os.Stdout, uri, next)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-	vmName := instancename
+	return nil
+}
 
-	vmClient, err := a.getVMClient()
+// GetInstanceLogs returns the serial log of the instance kept by its boot
+// diagnostics
+func (a *Azure) GetInstanceLogs(ctx *Context, instancename string) (string, error) {
+	uri, err := a.bootLogURI(instancename)
 	if err != nil {
 		return "", err
 	}
 
-	vm, err := vmClient.Get(context.TODO(), a.groupName, vmName, compute.InstanceView)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	// this is unique per vm || per boot?
-	vmid := to.String(vm.VMID)
-
-	// this has a unique expected format apparently
-	// the first part of the name in the uri is capped at 10 chars but
-	// not the 2nd part?
-	firstName := strings.ReplaceAll(vmName, "-", "")
-	if len(firstName) > 10 {
-		firstName = firstName[0:9]
-	}
-
-	fname := "bootdiagnostics" + "-" + firstName + "-" + vmid + "/" + vmName + "." + vmid +
-		".serialconsole.log"
-
-	blobURL := containerURL.NewBlockBlobURL(fname)
-
-	get, err := blobURL.Download(context.TODO(), 0, 0, azblob.BlobAccessConditions{}, false)
+	var buf bytes.Buffer
+	_, err = tailBootLog(&buf, uri, 0)
 	if err != nil {
 		return "", err
 	}
 
-	downloadedData := &bytes.Buffer{}
-	reader := get.Body(azblob.RetryReaderOptions{})
-	downloadedData.ReadFrom(reader)
-	reader.Close()
-
-	return downloadedData.String(), nil
+	return buf.String(), nil
 }
 
 // ResizeImage is not supported on azure.
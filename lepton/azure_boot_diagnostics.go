@@ -0,0 +1,96 @@
+package lepton
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2020-06-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// azureBootLogURIExpiration is the lifetime in minutes of the uris the serial
+// logs of virtual machines are read from
+const azureBootLogURIExpiration = 60
+
+// errBootLogURIExpired is returned reading a serial log from an expired uri
+var errBootLogURIExpired = errors.New("serial log uri expired")
+
+// azureBootDiagnostics returns the boot diagnostics of virtual machines,
+// their serial log stored in the storage account if there is one or in
+// storage managed by azure
+func azureBootDiagnostics(storageAccount string) *compute.DiagnosticsProfile {
+	diagnostics := &compute.BootDiagnostics{Enabled: to.BoolPtr(true)}
+	if storageAccount != "" {
+		diagnostics.StorageURI = to.StringPtr("https://" + storageAccount + ".blob.core.windows.net/")
+	}
+	return &compute.DiagnosticsProfile{BootDiagnostics: diagnostics}
+}
+
+// bootLogURI returns a uri the serial log of the virtual machine can be read
+// from for azureBootLogURIExpiration minutes
+func (a *Azure) bootLogURI(vmName string) (string, error) {
+	vmClient, err := a.getVMClient()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := vmClient.RetrieveBootDiagnosticsData(context.TODO(), a.groupName, vmName, to.Int32Ptr(azureBootLogURIExpiration))
+	if err != nil {
+		return "", fmt.Errorf("retrieve boot diagnostics of %s: %v", vmName, err)
+	}
+
+	uri := to.String(result.SerialConsoleLogBlobURI)
+	if uri == "" {
+		return "", fmt.Errorf("%s has no serial log, boot diagnostics aren't enabled", vmName)
+	}
+	return uri, nil
+}
+
+// tailBootLog writes the serial log read from uri from the position start
+// and returns the position the next read continues from. A log that doesn't
+// exist yet is empty
+func tailBootLog(w io.Writer, uri string, start int64) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return start, err
+	}
+	if start > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return start, fmt.Errorf("read serial log: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable:
+		return start, nil
+	case http.StatusForbidden:
+		return start, errBootLogURIExpired
+	default:
+		return start, fmt.Errorf("read serial log: status %d", resp.StatusCode)
+	}
+
+	// servers ignoring the range return the whole log
+	body := io.Reader(resp.Body)
+	if resp.StatusCode == http.StatusOK && start > 0 {
+		_, err = io.CopyN(ioutil.Discard, body, start)
+		if err == io.EOF {
+			return start, nil
+		}
+		if err != nil {
+			return start, fmt.Errorf("read serial log: %v", err)
+		}
+	}
+
+	n, err := io.Copy(w, body)
+	return start + n, err
+}
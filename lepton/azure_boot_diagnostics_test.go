@@ -0,0 +1,58 @@
+package lepton
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTailBootLog(t *testing.T) {
+	log := "booting\nready\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/expired":
+			w.WriteHeader(http.StatusForbidden)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			http.ServeContent(w, r, "serialconsole.log", time.Time{}, strings.NewReader(log))
+		}
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	next, err := tailBootLog(&out, server.URL+"/log", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != log || next != int64(len(log)) {
+		t.Errorf("unexpected log %q up to %d", out.String(), next)
+	}
+
+	// only the new output is read
+	log += "listening\n"
+	out.Reset()
+	next, err = tailBootLog(&out, server.URL+"/log", next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "listening\n" || next != int64(len(log)) {
+		t.Errorf("unexpected log %q up to %d", out.String(), next)
+	}
+
+	out.Reset()
+	if next, err = tailBootLog(&out, server.URL+"/log", next); err != nil || out.Len() != 0 || next != int64(len(log)) {
+		t.Errorf("expected no new output, got %q up to %d, %v", out.String(), next, err)
+	}
+
+	if next, err := tailBootLog(&out, server.URL+"/missing", 0); err != nil || next != 0 {
+		t.Errorf("expected a log not written yet to be empty, got %d, %v", next, err)
+	}
+
+	if _, err := tailBootLog(&out, server.URL+"/expired", 0); err != errBootLogURIExpired {
+		t.Errorf("expected an expired uri, got %v", err)
+	}
+}
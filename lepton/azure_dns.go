@@ -36,6 +36,24 @@ func (a *Azure) FindOrCreateZoneIDByName(config *Config, dnsName string) (string
 	return dnsName, nil
 }
 
+// FindZoneIDByName returns the name of the DNS zone of the resource group
+// with the name passed by argument, empty if there is none
+func (a *Azure) FindZoneIDByName(config *Config, dnsName string) (string, error) {
+	service := dns.NewZonesClient(a.subID)
+	authr, _ := a.GetResourceManagementAuthorizer()
+	service.Authorizer = authr
+
+	zone, err := service.Get(context.TODO(), a.groupName, dnsName)
+	if err != nil {
+		if azureNotFound(zone.Response) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return dnsName, nil
+}
+
 // DeleteZoneRecordIfExists deletes a record from a DNS zone if it exists
 func (a *Azure) DeleteZoneRecordIfExists(config *Config, zoneID string, recordName string) error {
 	return nil
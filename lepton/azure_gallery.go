@@ -0,0 +1,250 @@
+package lepton
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2020-06-01/compute"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// azureGalleryReplicaCount is the number of replicas of an image version in
+// each region it's replicated to
+const azureGalleryReplicaCount = 1
+
+// azureNotFound returns true if the response reports a missing resource
+func azureNotFound(response autorest.Response) bool {
+	return response.Response != nil && response.StatusCode == http.StatusNotFound
+}
+
+// azureGalleryImageVersion returns the version of a gallery image published
+// at t, versions being major.minor.patch numbers increasing with time: the
+// date and the time of the day
+func azureGalleryImageVersion(t time.Time) string {
+	t = t.UTC()
+	return fmt.Sprintf("0.%s.%d", t.Format("20060102"), t.Hour()*10000+t.Minute()*100+t.Second())
+}
+
+// azureTargetRegions returns the regions an image version is replicated to,
+// the location of the image followed by the replication regions of the
+// config without duplicates
+func azureTargetRegions(location string, regions []string) []compute.TargetRegion {
+	var targets []compute.TargetRegion
+	seen := map[string]bool{}
+	for _, region := range append([]string{location}, regions...) {
+		if region == "" || seen[region] {
+			continue
+		}
+		seen[region] = true
+
+		targets = append(targets, compute.TargetRegion{
+			Name:                 to.StringPtr(region),
+			RegionalReplicaCount: to.Int32Ptr(azureGalleryReplicaCount),
+			StorageAccountType:   compute.StorageAccountTypeStandardLRS,
+		})
+	}
+	return targets
+}
+
+// galleryImageID returns the id of the definition of the image in the
+// gallery of the config, instances launched from it use its latest version
+func (a *Azure) galleryImageID(config *Config, imageName string) string {
+	return "/subscriptions/" + a.subID + "/resourceGroups/" + a.groupName + "/providers/Microsoft.Compute/galleries/" +
+		config.CloudConfig.ImageGallery + "/images/" + imageName
+}
+
+// authorizeClient sets the authorizer and user agent of a compute client
+func (a *Azure) authorizeClient(client *autorest.Client) error {
+	authr, err := a.GetResourceManagementAuthorizer()
+	if err != nil {
+		return err
+	}
+	client.Authorizer = authr
+	client.AddToUserAgent(userAgent)
+	return nil
+}
+
+// ensureGallery creates the gallery of the config in the location if it
+// doesn't exist
+func (a *Azure) ensureGallery(ctx *Context, location string) error {
+	c := ctx.config
+	galleriesClient := compute.NewGalleriesClient(a.subID)
+	if err := a.authorizeClient(&galleriesClient.Client); err != nil {
+		return err
+	}
+
+	gallery, err := galleriesClient.Get(context.TODO(), a.groupName, c.CloudConfig.ImageGallery)
+	if err == nil {
+		return nil
+	}
+	if !azureNotFound(gallery.Response) {
+		return err
+	}
+
+	ctx.logger.Info("creating image gallery %s", c.CloudConfig.ImageGallery)
+	future, err := galleriesClient.CreateOrUpdate(context.TODO(), a.groupName, c.CloudConfig.ImageGallery, compute.Gallery{
+		Location: to.StringPtr(location),
+		Tags:     azureDefaultTags(c, nil),
+		GalleryProperties: &compute.GalleryProperties{
+			Description: to.StringPtr("nanos images published by ops"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return future.WaitForCompletionRef(context.TODO(), galleriesClient.Client)
+}
+
+// ensureGalleryImage creates the definition of the image in the gallery of
+// the config if it doesn't exist
+func (a *Azure) ensureGalleryImage(ctx *Context, location string, imageName string) error {
+	c := ctx.config
+	imagesClient := compute.NewGalleryImagesClient(a.subID)
+	if err := a.authorizeClient(&imagesClient.Client); err != nil {
+		return err
+	}
+
+	image, err := imagesClient.Get(context.TODO(), a.groupName, c.CloudConfig.ImageGallery, imageName)
+	if err == nil {
+		return nil
+	}
+	if !azureNotFound(image.Response) {
+		return err
+	}
+
+	ctx.logger.Info("creating image definition %s in gallery %s", imageName, c.CloudConfig.ImageGallery)
+	future, err := imagesClient.CreateOrUpdate(context.TODO(), a.groupName, c.CloudConfig.ImageGallery, imageName, compute.GalleryImage{
+		Location: to.StringPtr(location),
+		Tags:     azureDefaultTags(c, nil),
+		GalleryImageProperties: &compute.GalleryImageProperties{
+			Description:      to.StringPtr(imageDescription(c)),
+			OsType:           compute.Linux,
+			OsState:          compute.Generalized,
+			HyperVGeneration: compute.V1,
+			Identifier: &compute.GalleryImageIdentifier{
+				Publisher: to.StringPtr("ops"),
+				Offer:     to.StringPtr(imageName),
+				Sku:       to.StringPtr("nanos"),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return future.WaitForCompletionRef(context.TODO(), imagesClient.Client)
+}
+
+// publishGalleryImage publishes the managed image with the image name as a
+// new version of its definition in the gallery of the config, replicated to
+// the replication regions of the config
+func (a *Azure) publishGalleryImage(ctx *Context, location string, managedImageID string) error {
+	c := ctx.config
+	imageName := c.CloudConfig.ImageName
+
+	err := a.ensureGallery(ctx, location)
+	if err != nil {
+		return fmt.Errorf("create image gallery %s: %v", c.CloudConfig.ImageGallery, err)
+	}
+
+	err = a.ensureGalleryImage(ctx, location, imageName)
+	if err != nil {
+		return fmt.Errorf("create image definition %s: %v", imageName, err)
+	}
+
+	versionsClient := compute.NewGalleryImageVersionsClient(a.subID)
+	if err := a.authorizeClient(&versionsClient.Client); err != nil {
+		return err
+	}
+
+	tags := map[string]*string{}
+	for _, tag := range imageMetadata(c) {
+		tags[tag.Key] = to.StringPtr(tag.Value)
+	}
+
+	version := azureGalleryImageVersion(time.Now())
+	targets := azureTargetRegions(location, c.CloudConfig.ReplicationRegions)
+
+	ctx.logger.Log("Publishing %s version %s to gallery %s in %d regions, this can take a while", imageName, version, c.CloudConfig.ImageGallery, len(targets))
+	future, err := versionsClient.CreateOrUpdate(context.TODO(), a.groupName, c.CloudConfig.ImageGallery, imageName, version, compute.GalleryImageVersion{
+		Location: to.StringPtr(location),
+		Tags:     azureDefaultTags(c, tags),
+		GalleryImageVersionProperties: &compute.GalleryImageVersionProperties{
+			PublishingProfile: &compute.GalleryImageVersionPublishingProfile{
+				TargetRegions: &targets,
+			},
+			StorageProfile: &compute.GalleryImageVersionStorageProfile{
+				Source: &compute.GalleryArtifactVersionSource{ID: to.StringPtr(managedImageID)},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = future.WaitForCompletionRef(context.TODO(), versionsClient.Client)
+	if err != nil {
+		return fmt.Errorf("publish %s version %s: %v", imageName, version, err)
+	}
+
+	ctx.logger.Log("Published %s version %s", imageName, version)
+	return nil
+}
+
+// deleteGalleryImage deletes the versions of the image in the gallery of the
+// config and its definition
+func (a *Azure) deleteGalleryImage(ctx *Context, imageName string) error {
+	c := ctx.config
+
+	versionsClient := compute.NewGalleryImageVersionsClient(a.subID)
+	if err := a.authorizeClient(&versionsClient.Client); err != nil {
+		return err
+	}
+
+	page, err := versionsClient.ListByGalleryImage(context.TODO(), a.groupName, c.CloudConfig.ImageGallery, imageName)
+	if err != nil {
+		if azureNotFound(page.Response().Response) {
+			return nil
+		}
+		return err
+	}
+
+	var versions []string
+	for page.NotDone() {
+		for _, version := range page.Values() {
+			versions = append(versions, to.String(version.Name))
+		}
+
+		err = page.NextWithContext(context.TODO())
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, version := range versions {
+		ctx.logger.Info("deleting %s version %s", imageName, version)
+		future, err := versionsClient.Delete(context.TODO(), a.groupName, c.CloudConfig.ImageGallery, imageName, version)
+		if err == nil {
+			err = future.WaitForCompletionRef(context.TODO(), versionsClient.Client)
+		}
+		if err != nil {
+			return fmt.Errorf("delete %s version %s: %v", imageName, version, err)
+		}
+	}
+
+	imagesClient := compute.NewGalleryImagesClient(a.subID)
+	if err := a.authorizeClient(&imagesClient.Client); err != nil {
+		return err
+	}
+
+	future, err := imagesClient.Delete(context.TODO(), a.groupName, c.CloudConfig.ImageGallery, imageName)
+	if err != nil {
+		return err
+	}
+
+	return future.WaitForCompletionRef(context.TODO(), imagesClient.Client)
+}
@@ -0,0 +1,37 @@
+package lepton
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestAzureGalleryImageVersion(t *testing.T) {
+	published := time.Date(2026, 10, 16, 9, 5, 30, 0, time.UTC)
+
+	// the parts of a version are numbers, without leading zeros
+	if version := azureGalleryImageVersion(published); version != "0.20261016.90530" {
+		t.Errorf("unexpected version %s", version)
+	}
+
+	if version := azureGalleryImageVersion(published.Add(time.Hour)); version != "0.20261016.100530" {
+		t.Errorf("unexpected version %s", version)
+	}
+}
+
+func TestAzureTargetRegions(t *testing.T) {
+	targets := azureTargetRegions("westus2", []string{"eastus", "westus2", "", "northeurope"})
+
+	var names []string
+	for _, target := range targets {
+		names = append(names, to.String(target.Name))
+		if to.Int32(target.RegionalReplicaCount) != azureGalleryReplicaCount {
+			t.Errorf("unexpected replica count in %s", to.String(target.Name))
+		}
+	}
+
+	if len(names) != 3 || names[0] != "westus2" || names[1] != "eastus" || names[2] != "northeurope" {
+		t.Errorf("unexpected target regions %v", names)
+	}
+}
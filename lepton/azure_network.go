@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"strconv"
 	"strings"
 
@@ -19,6 +18,11 @@ func getAzureDefaultTags() map[string]*string {
 	}
 }
 
+// hasAzureOpsTags returns true if the tags mark a resource created by ops
+func hasAzureOpsTags(tags map[string]*string) bool {
+	return to.String(tags["CreatedBy"]) == "ops"
+}
+
 func getAzureResourceNameFromID(id string) string {
 	idParts := strings.Split(id, "/")
 	return idParts[len(idParts)-1]
@@ -35,14 +39,10 @@ func (a *Azure) getNicClient() (*network.InterfacesClient, error) {
 	return &nicClient, nil
 }
 
-// CreateNIC creates a new network interface. The Network Security Group
-// is not a required parameter
-func (a *Azure) CreateNIC(ctx context.Context, location string, vnetName, subnetName, nsgName, ipName, nicName string) (nic network.Interface, err error) {
-	subnet, err := a.GetVirtualNetworkSubnet(ctx, vnetName, subnetName)
-	if err != nil {
-		log.Fatalf("failed to get subnet: %v", err)
-	}
-
+// CreateNIC creates a new network interface in the subnet, which may be in
+// another resource group. The Network Security Group is not a required
+// parameter
+func (a *Azure) CreateNIC(ctx context.Context, location string, subnet *network.Subnet, nsgName, ipName, nicName string, c *Config) (nic network.Interface, err error) {
 	ip, err := a.GetPublicIP(ctx, ipName)
 	if err != nil {
 		log.Fatalf("failed to get ip address: %v", err)
@@ -63,7 +63,7 @@ func (a *Azure) CreateNIC(ctx context.Context, location string, vnetName, subnet
 				},
 			},
 		},
-		Tags: getAzureDefaultTags(),
+		Tags: azureDefaultTags(c, getAzureDefaultTags()),
 	}
 
 	if nsgName != "" {
@@ -173,6 +173,13 @@ func (a *Azure) DeleteNetworkSecurityGroup(ctx *Context, securityGroupID string)
 		return errors.New("error getting network security group")
 	}
 
+	// security groups of the config are shared, only those of instances are
+	// deleted with them
+	if !hasAzureOpsTags(securityGroup.Tags) {
+		logger.Info("keeping security group %s not created by ops", securityGroupName)
+		return nil
+	}
+
 	if securityGroup.Subnets != nil {
 		for _, subnet := range *securityGroup.Subnets {
 			if subnet.ID != nil {
@@ -234,7 +241,7 @@ func (a *Azure) getIPClient() (*network.PublicIPAddressesClient, error) {
 }
 
 // CreatePublicIP creates a new public IP
-func (a *Azure) CreatePublicIP(ctx context.Context, location string, ipName string) (ip network.PublicIPAddress, err error) {
+func (a *Azure) CreatePublicIP(ctx context.Context, location string, ipName string, c *Config) (ip network.PublicIPAddress, err error) {
 	ipClient, err := a.getIPClient()
 	if err != nil {
 		return
@@ -250,7 +257,7 @@ func (a *Azure) CreatePublicIP(ctx context.Context, location string, ipName stri
 				PublicIPAddressVersion:   network.IPv4,
 				PublicIPAllocationMethod: network.Static,
 			},
-			Tags: getAzureDefaultTags(),
+			Tags: azureDefaultTags(c, getAzureDefaultTags()),
 		},
 	)
 
@@ -302,7 +309,7 @@ func (a *Azure) GetVPC(vnetName string) (vnet *network.VirtualNetwork, err error
 }
 
 // CreateVirtualNetwork creates a virtual network
-func (a *Azure) CreateVirtualNetwork(ctx context.Context, location string, vnetName string) (vnet *network.VirtualNetwork, err error) {
+func (a *Azure) CreateVirtualNetwork(ctx context.Context, location string, vnetName string, c *Config) (vnet *network.VirtualNetwork, err error) {
 	vnetClient, err := a.getVnetClient()
 	if err != nil {
 		return nil, err
@@ -318,7 +325,7 @@ func (a *Azure) CreateVirtualNetwork(ctx context.Context, location string, vnetN
 					AddressPrefixes: &[]string{"10.0.0.0/8"},
 				},
 			},
-			Tags: getAzureDefaultTags(),
+			Tags: azureDefaultTags(c, getAzureDefaultTags()),
 		})
 
 	if err != nil {
@@ -490,41 +497,103 @@ func (a *Azure) getNsgClient() (*network.SecurityGroupsClient, error) {
 	return &nsgClient, nil
 }
 
-func (a Azure) buildFirewallRule(protocol network.SecurityRuleProtocol, port int) network.SecurityRule {
-	portStr := strconv.Itoa(port)
-	return network.SecurityRule{
-		Name: to.StringPtr("allow_" + portStr),
+// azureFirewallPriority is the priority of the first ingress rule of the
+// security groups of instances, the following rules taking the next ones
+const azureFirewallPriority = 100
+
+// azureSecurityRules returns the ingress rules of the ports, port ranges and
+// udp ports of the config, allowing the allowed ips of the config or any
+// address
+func azureSecurityRules(c *Config) ([]network.SecurityRule, error) {
+	var rules []network.SecurityRule
+
+	sources := allowedSources(c)
+	if len(c.RunConfig.AllowedIPs) == 0 {
+		sources = []string{"*"}
+	}
+
+	add := func(protocol network.SecurityRuleProtocol, ports string) {
+		priority := int32(azureFirewallPriority + len(rules))
+		rules = append(rules, buildAzureFirewallRules(protocol, ports, sources, priority)...)
+	}
+
+	for _, port := range c.RunConfig.Ports {
+		add(network.SecurityRuleProtocolTCP, strconv.Itoa(port))
+	}
+
+	for _, portRange := range c.RunConfig.PortRanges {
+		from, end, err := ParsePortRange(portRange)
+		if err != nil {
+			return nil, err
+		}
+		add(network.SecurityRuleProtocolTCP, fmt.Sprintf("%d-%d", from, end))
+	}
+
+	for _, port := range c.RunConfig.UDPPorts {
+		add(network.SecurityRuleProtocolUDP, strconv.Itoa(port))
+	}
+
+	return rules, nil
+}
+
+// buildAzureFirewallRules returns the rules allowing the sources to connect to
+// the ports, a port or a from-to range, over the protocol. Azure rejects rules
+// mixing ipv4 and ipv6 prefixes, the ipv6 sources get a rule of their own
+// with the next priority
+func buildAzureFirewallRules(protocol network.SecurityRuleProtocol, ports string, sources []string, priority int32) []network.SecurityRule {
+	name := "allow_" + strings.ToLower(string(protocol)) + "_" + ports
+	if len(sources) == 1 && sources[0] == "*" {
+		return []network.SecurityRule{buildAzureFirewallRule(name, protocol, ports, sources, priority)}
+	}
+
+	ipv4, ipv6 := sourcesByFamily(sources)
+
+	var rules []network.SecurityRule
+	if len(ipv4) > 0 {
+		rules = append(rules, buildAzureFirewallRule(name, protocol, ports, ipv4, priority))
+	}
+	if len(ipv6) > 0 {
+		rules = append(rules, buildAzureFirewallRule(name+"_ipv6", protocol, ports, ipv6, priority+int32(len(rules))))
+	}
+	return rules
+}
+
+// buildAzureFirewallRule returns the rule named name allowing the sources to
+// connect to the ports over the protocol
+func buildAzureFirewallRule(name string, protocol network.SecurityRuleProtocol, ports string, sources []string, priority int32) network.SecurityRule {
+	rule := network.SecurityRule{
+		Name: to.StringPtr(name),
 		SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
 			Protocol:                 protocol,
-			SourceAddressPrefix:      to.StringPtr("0.0.0.0/0"),
-			SourcePortRange:          to.StringPtr("1-65535"),
-			DestinationAddressPrefix: to.StringPtr("0.0.0.0/0"),
-			DestinationPortRange:     to.StringPtr(portStr),
+			SourcePortRange:          to.StringPtr("*"),
+			DestinationAddressPrefix: to.StringPtr("*"),
+			DestinationPortRange:     to.StringPtr(ports),
 			Access:                   network.SecurityRuleAccessAllow,
 			Direction:                network.SecurityRuleDirectionInbound,
-			Priority:                 to.Int32Ptr(rand.Int31n(200-100) + 100), //Generating number between 100 - 200
+			Priority:                 to.Int32Ptr(priority),
 		},
 	}
+
+	if len(sources) == 1 {
+		rule.SourceAddressPrefix = to.StringPtr(sources[0])
+	} else {
+		rule.SourceAddressPrefixes = &sources
+	}
+
+	return rule
 }
 
 // CreateNetworkSecurityGroup creates a new network security group with
-// rules set for allowing SSH and HTTPS use
+// ingress rules for the ports of the config
 func (a *Azure) CreateNetworkSecurityGroup(ctx context.Context, location string, nsgName string, c *Config) (nsg *network.SecurityGroup, err error) {
 	nsgClient, err := a.getNsgClient()
 	if err != nil {
 		return
 	}
 
-	var securityRules []network.SecurityRule
-
-	for _, port := range c.RunConfig.Ports {
-		var rule = a.buildFirewallRule(network.SecurityRuleProtocolTCP, port)
-		securityRules = append(securityRules, rule)
-	}
-
-	for _, port := range c.RunConfig.UDPPorts {
-		var rule = a.buildFirewallRule(network.SecurityRuleProtocolUDP, port)
-		securityRules = append(securityRules, rule)
+	securityRules, err := azureSecurityRules(c)
+	if err != nil {
+		return
 	}
 
 	future, err := nsgClient.CreateOrUpdate(
@@ -536,7 +605,7 @@ func (a *Azure) CreateNetworkSecurityGroup(ctx context.Context, location string,
 			SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
 				SecurityRules: &securityRules,
 			},
-			Tags: getAzureDefaultTags(),
+			Tags: azureDefaultTags(c, getAzureDefaultTags()),
 		},
 	)
 
@@ -0,0 +1,95 @@
+package lepton
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-05-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestAzureSecurityRules(t *testing.T) {
+	c := NewConfig()
+	c.RunConfig.Ports = []int{80, 443}
+	c.RunConfig.PortRanges = []string{"8000-8100"}
+	c.RunConfig.UDPPorts = []int{80}
+
+	rules, err := azureSecurityRules(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		name     string
+		protocol network.SecurityRuleProtocol
+		ports    string
+	}{
+		{"allow_tcp_80", network.SecurityRuleProtocolTCP, "80"},
+		{"allow_tcp_443", network.SecurityRuleProtocolTCP, "443"},
+		{"allow_tcp_8000-8100", network.SecurityRuleProtocolTCP, "8000-8100"},
+		{"allow_udp_80", network.SecurityRuleProtocolUDP, "80"},
+	}
+
+	if len(rules) != len(expected) {
+		t.Fatalf("expected %d rules, got %d", len(expected), len(rules))
+	}
+
+	for i, rule := range rules {
+		if to.String(rule.Name) != expected[i].name || rule.Protocol != expected[i].protocol || to.String(rule.DestinationPortRange) != expected[i].ports {
+			t.Errorf("unexpected rule %s %s %s", to.String(rule.Name), rule.Protocol, to.String(rule.DestinationPortRange))
+		}
+
+		// priorities are unique in a security group
+		if to.Int32(rule.Priority) != int32(azureFirewallPriority+i) {
+			t.Errorf("unexpected priority %d of %s", to.Int32(rule.Priority), to.String(rule.Name))
+		}
+
+		if to.String(rule.SourceAddressPrefix) != "*" {
+			t.Errorf("expected %s to allow any source, got %s", to.String(rule.Name), to.String(rule.SourceAddressPrefix))
+		}
+	}
+
+	c.RunConfig.AllowedIPs = []string{"10.0.0.0/8", "192.168.1.4/32"}
+	rules, err = azureSecurityRules(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules[0].SourceAddressPrefixes == nil || len(*rules[0].SourceAddressPrefixes) != 2 || rules[0].SourceAddressPrefix != nil {
+		t.Errorf("expected the allowed ips as sources, got %v", rules[0].SourceAddressPrefixes)
+	}
+
+	// ipv4 and ipv6 sources can't be mixed in a rule
+	c.RunConfig.AllowedIPs = []string{"10.0.0.0/8", "2001:db8::/32"}
+	c.RunConfig.Ports = []int{80}
+	c.RunConfig.PortRanges = nil
+	c.RunConfig.UDPPorts = []int{53}
+	rules, err = azureSecurityRules(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byFamily := []struct {
+		name   string
+		source string
+	}{
+		{"allow_tcp_80", "10.0.0.0/8"},
+		{"allow_tcp_80_ipv6", "2001:db8::/32"},
+		{"allow_udp_53", "10.0.0.0/8"},
+		{"allow_udp_53_ipv6", "2001:db8::/32"},
+	}
+	if len(rules) != len(byFamily) {
+		t.Fatalf("expected %d rules, got %d", len(byFamily), len(rules))
+	}
+	for i, rule := range rules {
+		if to.String(rule.Name) != byFamily[i].name || to.String(rule.SourceAddressPrefix) != byFamily[i].source {
+			t.Errorf("unexpected rule %s from %s", to.String(rule.Name), to.String(rule.SourceAddressPrefix))
+		}
+		if to.Int32(rule.Priority) != int32(azureFirewallPriority+i) {
+			t.Errorf("unexpected priority %d of %s", to.Int32(rule.Priority), to.String(rule.Name))
+		}
+	}
+
+	c.RunConfig.PortRanges = []string{"9000-80"}
+	if _, err := azureSecurityRules(c); err == nil {
+		t.Error("expected invalid port range error")
+	}
+}
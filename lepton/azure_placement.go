@@ -0,0 +1,85 @@
+package lepton
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2020-06-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// azureSpotMaxPrice is the max price of spot virtual machines paying up to
+// the on-demand price, evicted for capacity only
+const azureSpotMaxPrice = -1
+
+// azureSpotProperties sets the priority, eviction policy and billing profile
+// of spot virtual machines on properties, checking the spot settings of the
+// run config are only given for spot virtual machines
+func azureSpotProperties(rc *RunConfig, properties *compute.VirtualMachineProperties) error {
+	if !rc.Spot {
+		if rc.EvictionPolicy != "" || rc.MaxPrice != 0 {
+			return fmt.Errorf("eviction policy and max price only apply to spot instances")
+		}
+		return nil
+	}
+
+	policy := compute.Deallocate
+	switch strings.ToLower(rc.EvictionPolicy) {
+	case "", "deallocate":
+	case "delete":
+		policy = compute.Delete
+	default:
+		return fmt.Errorf("invalid eviction policy %q, expected deallocate or delete", rc.EvictionPolicy)
+	}
+
+	maxPrice := rc.MaxPrice
+	if maxPrice == 0 {
+		maxPrice = azureSpotMaxPrice
+	}
+	if maxPrice < 0 && maxPrice != azureSpotMaxPrice {
+		return fmt.Errorf("invalid max price %v, expected a price in US dollars per hour or -1", rc.MaxPrice)
+	}
+
+	properties.Priority = compute.Spot
+	properties.EvictionPolicy = policy
+	properties.BillingProfile = &compute.BillingProfile{
+		MaxPrice: to.Float64Ptr(maxPrice),
+	}
+
+	return nil
+}
+
+// ensureProximityPlacementGroup creates the proximity placement group name in
+// the location if it doesn't exist and returns its id
+func (a *Azure) ensureProximityPlacementGroup(ctx *Context, location string, name string) (string, error) {
+	groupsClient := compute.NewProximityPlacementGroupsClient(a.subID)
+	if err := a.authorizeClient(&groupsClient.Client); err != nil {
+		return "", err
+	}
+
+	group, err := groupsClient.Get(context.TODO(), a.groupName, name, "")
+	if err == nil {
+		if !strings.EqualFold(strings.Replace(to.String(group.Location), " ", "", -1), location) {
+			return "", fmt.Errorf("proximity placement group %s is in %s, not %s", name, to.String(group.Location), location)
+		}
+		return to.String(group.ID), nil
+	}
+	if !azureNotFound(group.Response) {
+		return "", err
+	}
+
+	ctx.logger.Info("creating proximity placement group %s", name)
+	group, err = groupsClient.CreateOrUpdate(context.TODO(), a.groupName, name, compute.ProximityPlacementGroup{
+		Location: to.StringPtr(location),
+		Tags:     azureDefaultTags(ctx.config, nil),
+		ProximityPlacementGroupProperties: &compute.ProximityPlacementGroupProperties{
+			ProximityPlacementGroupType: compute.Standard,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("create proximity placement group %s: %v", name, err)
+	}
+
+	return to.String(group.ID), nil
+}
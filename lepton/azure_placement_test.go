@@ -0,0 +1,47 @@
+package lepton
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2020-06-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestAzureSpotProperties(t *testing.T) {
+	var properties compute.VirtualMachineProperties
+	if err := azureSpotProperties(&RunConfig{}, &properties); err != nil {
+		t.Fatal(err)
+	}
+	if properties.Priority != "" || properties.BillingProfile != nil {
+		t.Error("expected regular instances to keep the default priority")
+	}
+
+	if err := azureSpotProperties(&RunConfig{MaxPrice: 0.05}, &properties); err == nil {
+		t.Error("expected a max price without spot to be rejected")
+	}
+
+	properties = compute.VirtualMachineProperties{}
+	if err := azureSpotProperties(&RunConfig{Spot: true}, &properties); err != nil {
+		t.Fatal(err)
+	}
+	if properties.Priority != compute.Spot || properties.EvictionPolicy != compute.Deallocate {
+		t.Errorf("unexpected priority %s and eviction policy %s", properties.Priority, properties.EvictionPolicy)
+	}
+	if to.Float64(properties.BillingProfile.MaxPrice) != azureSpotMaxPrice {
+		t.Errorf("unexpected max price %v", to.Float64(properties.BillingProfile.MaxPrice))
+	}
+
+	properties = compute.VirtualMachineProperties{}
+	if err := azureSpotProperties(&RunConfig{Spot: true, EvictionPolicy: "Delete", MaxPrice: 0.05}, &properties); err != nil {
+		t.Fatal(err)
+	}
+	if properties.EvictionPolicy != compute.Delete || to.Float64(properties.BillingProfile.MaxPrice) != 0.05 {
+		t.Errorf("unexpected eviction policy %s and max price %v", properties.EvictionPolicy, to.Float64(properties.BillingProfile.MaxPrice))
+	}
+
+	for _, rc := range []RunConfig{{Spot: true, EvictionPolicy: "stop"}, {Spot: true, MaxPrice: -2}} {
+		if err := azureSpotProperties(&rc, &compute.VirtualMachineProperties{}); err == nil {
+			t.Errorf("expected %+v to be rejected", rc)
+		}
+	}
+}
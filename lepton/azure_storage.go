@@ -116,14 +116,20 @@ func (az *AzureStorage) CopyToBucket(config *Config, imgPath string) error {
 		fmt.Printf("resize sz: %d\n", rs)
 	}
 
-	newpath := "/tmp/" + base
+	// the resized image and the vhd are written to the temp dir
+	err := checkFreeSpace(tempDir(config), 2*int64(rs), "the azure vhd")
+	if err != nil {
+		return err
+	}
+
+	newpath := filepath.Join(tempDir(config), base)
 	newpath = strings.ReplaceAll(newpath, "-image", "")
 
 	// resize
 	az.resizeImage(imgPath, newpath, rs)
 
 	// convert
-	vhdPath := "/tmp/" + config.CloudConfig.ImageName + ".vhd"
+	vhdPath := filepath.Join(tempDir(config), config.CloudConfig.ImageName+".vhd")
 	vhdPath = strings.ReplaceAll(vhdPath, "-image", "")
 
 	// this is probably just for hyper-v not azure
@@ -134,7 +140,7 @@ func (az *AzureStorage) CopyToBucket(config *Config, imgPath string) error {
 	}
 
 	cmd := exec.Command("qemu-img", args...)
-	err := cmd.Run()
+	err = cmd.Run()
 	if err != nil {
 		fmt.Println(err)
 	}
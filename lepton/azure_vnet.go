@@ -0,0 +1,178 @@
+package lepton
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-05-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// azureNetwork is an existing virtual network and subnet instances are
+// launched in, instead of the network ops creates for each instance
+type azureNetwork struct {
+	ResourceGroup string // resource group of the instances if empty
+	VNet          string
+	Subnet        string // the only subnet of the virtual network if empty
+}
+
+// isAzureResourceID returns true if s is a resource id rather than a name
+func isAzureResourceID(s string) bool {
+	return strings.HasPrefix(s, "/subscriptions/")
+}
+
+// parseAzureNetworkID returns the resource group, virtual network and subnet
+// of a virtual network or subnet id, e.g.
+// /subscriptions/<id>/resourceGroups/net/providers/Microsoft.Network/virtualNetworks/prod/subnets/apps.
+// The subnet is empty for virtual network ids
+func parseAzureNetworkID(id string) (group, vnet, subnet string, err error) {
+	parts := strings.Split(strings.Trim(id, "/"), "/")
+
+	invalid := fmt.Errorf("invalid virtual network or subnet id %s", id)
+	if len(parts) != 8 && len(parts) != 10 {
+		return "", "", "", invalid
+	}
+
+	keys := map[int]string{0: "subscriptions", 2: "resourceGroups", 4: "providers", 5: "Microsoft.Network", 6: "virtualNetworks", 8: "subnets"}
+	for i, key := range keys {
+		if i < len(parts) && !strings.EqualFold(parts[i], key) {
+			return "", "", "", invalid
+		}
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return "", "", "", invalid
+		}
+	}
+
+	group, vnet = parts[3], parts[7]
+	if len(parts) == 10 {
+		subnet = parts[9]
+	}
+	return group, vnet, subnet, nil
+}
+
+// azureNetworkTarget returns the existing network set by the config for
+// instances to be launched in, nil if ops creates one. VPC and Subnet are
+// names or ids, a subnet id alone setting the virtual network too
+func azureNetworkTarget(c *Config) (*azureNetwork, error) {
+	vpc, subnet := c.RunConfig.VPC, c.RunConfig.Subnet
+	group := c.CloudConfig.NetworkResourceGroup
+
+	if vpc == "" && subnet == "" {
+		if group != "" {
+			return nil, fmt.Errorf("NetworkResourceGroup %s is set without a VPC or Subnet to use in it", group)
+		}
+		return nil, nil
+	}
+
+	target := &azureNetwork{VNet: vpc}
+	if isAzureResourceID(vpc) {
+		g, v, s, err := parseAzureNetworkID(vpc)
+		if err != nil {
+			return nil, err
+		}
+		if s != "" {
+			return nil, fmt.Errorf("VPC %s is a subnet id, set it as Subnet", vpc)
+		}
+		target.ResourceGroup, target.VNet = g, v
+	}
+
+	if isAzureResourceID(subnet) {
+		g, v, s, err := parseAzureNetworkID(subnet)
+		if err != nil {
+			return nil, err
+		}
+		if s == "" {
+			return nil, fmt.Errorf("subnet %s is a virtual network id, set it as VPC", subnet)
+		}
+		if target.VNet != "" && !strings.EqualFold(target.VNet, v) {
+			return nil, fmt.Errorf("subnet %s is not in the virtual network %s of VPC", subnet, target.VNet)
+		}
+		if target.ResourceGroup != "" && !strings.EqualFold(target.ResourceGroup, g) {
+			return nil, fmt.Errorf("subnet %s is not in the resource group %s of VPC", subnet, target.ResourceGroup)
+		}
+		target.ResourceGroup, target.VNet, target.Subnet = g, v, s
+	} else if subnet != "" {
+		if target.VNet == "" {
+			return nil, fmt.Errorf("subnet %s needs the VPC it is in, or to be set as a subnet id", subnet)
+		}
+		target.Subnet = subnet
+	}
+
+	if group != "" {
+		if target.ResourceGroup != "" && !strings.EqualFold(target.ResourceGroup, group) {
+			return nil, fmt.Errorf("NetworkResourceGroup %s doesn't match the resource group %s of the network id", group, target.ResourceGroup)
+		}
+		target.ResourceGroup = group
+	}
+
+	return target, nil
+}
+
+// sameAzureLocation returns true if the locations are the same, azure
+// accepting display names like West US 2 for westus2
+func sameAzureLocation(a, b string) bool {
+	normalize := func(location string) string {
+		return strings.ToLower(strings.Replace(location, " ", "", -1))
+	}
+	return normalize(a) == normalize(b)
+}
+
+// selectAzureSubnet returns the subnet of the virtual network with the name,
+// or its only subnet if name is empty
+func selectAzureSubnet(vnet *network.VirtualNetwork, name string) (*network.Subnet, error) {
+	var subnets []network.Subnet
+	if vnet.VirtualNetworkPropertiesFormat != nil && vnet.Subnets != nil {
+		subnets = *vnet.Subnets
+	}
+
+	if name == "" {
+		if len(subnets) == 1 {
+			return &subnets[0], nil
+		}
+		return nil, fmt.Errorf("virtual network %s has %d subnets, set the Subnet instances are launched in", to.String(vnet.Name), len(subnets))
+	}
+
+	for i := range subnets {
+		if strings.EqualFold(to.String(subnets[i].Name), name) {
+			return &subnets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("subnet %s not found in virtual network %s", name, to.String(vnet.Name))
+}
+
+// getExistingNetwork returns the virtual network and subnet of the target
+// after checking they can hold instances launched in location
+func (a *Azure) getExistingNetwork(ctx context.Context, target *azureNetwork, location string) (*network.VirtualNetwork, *network.Subnet, error) {
+	group := target.ResourceGroup
+	if group == "" {
+		group = a.groupName
+	}
+
+	vnetClient, err := a.getVnetClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vnet, err := vnetClient.Get(ctx, group, target.VNet, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("get virtual network %s of resource group %s: %v", target.VNet, group, err)
+	}
+
+	if !sameAzureLocation(to.String(vnet.Location), location) {
+		return nil, nil, fmt.Errorf("virtual network %s is in %s, instances are launched in %s", target.VNet, to.String(vnet.Location), location)
+	}
+
+	subnet, err := selectAzureSubnet(&vnet, target.Subnet)
+	if err != nil {
+		return nil, nil, err
+	}
+	if subnet.ID == nil {
+		return nil, nil, fmt.Errorf("subnet %s has no id", to.String(subnet.Name))
+	}
+
+	return &vnet, subnet, nil
+}
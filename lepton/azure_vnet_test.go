@@ -0,0 +1,99 @@
+package lepton
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2020-05-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+const testAzureVNetID = "/subscriptions/0000/resourceGroups/net/providers/Microsoft.Network/virtualNetworks/prod"
+
+func TestAzureNetworkTarget(t *testing.T) {
+	tests := []struct {
+		vpc, subnet, group string
+		expected           azureNetwork
+	}{
+		{"prod", "apps", "", azureNetwork{VNet: "prod", Subnet: "apps"}},
+		{"prod", "", "net", azureNetwork{ResourceGroup: "net", VNet: "prod"}},
+		{testAzureVNetID, "apps", "", azureNetwork{ResourceGroup: "net", VNet: "prod", Subnet: "apps"}},
+		{"", testAzureVNetID + "/subnets/apps", "NET", azureNetwork{ResourceGroup: "NET", VNet: "prod", Subnet: "apps"}},
+		{testAzureVNetID, testAzureVNetID + "/subnets/apps", "", azureNetwork{ResourceGroup: "net", VNet: "prod", Subnet: "apps"}},
+	}
+
+	for _, test := range tests {
+		c := NewConfig()
+		c.RunConfig.VPC = test.vpc
+		c.RunConfig.Subnet = test.subnet
+		c.CloudConfig.NetworkResourceGroup = test.group
+
+		target, err := azureNetworkTarget(c)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.vpc, test.subnet, err)
+			continue
+		}
+		if *target != test.expected {
+			t.Errorf("%s %s: expected %+v, got %+v", test.vpc, test.subnet, test.expected, *target)
+		}
+	}
+
+	if target, err := azureNetworkTarget(NewConfig()); target != nil || err != nil {
+		t.Errorf("expected no network to reuse, got %v %v", target, err)
+	}
+}
+
+func TestAzureNetworkTargetInvalid(t *testing.T) {
+	tests := []struct {
+		vpc, subnet, group string
+	}{
+		{"", "", "net"},
+		{"", "apps", ""},
+		{testAzureVNetID + "/subnets/apps", "", ""},
+		{"", testAzureVNetID, ""},
+		{"staging", testAzureVNetID + "/subnets/apps", ""},
+		{testAzureVNetID, "", "other"},
+		{"/subscriptions/0000/resourceGroups/net/providers/Microsoft.Compute/virtualMachines/vm", "", ""},
+	}
+
+	for _, test := range tests {
+		c := NewConfig()
+		c.RunConfig.VPC = test.vpc
+		c.RunConfig.Subnet = test.subnet
+		c.CloudConfig.NetworkResourceGroup = test.group
+
+		if _, err := azureNetworkTarget(c); err == nil {
+			t.Errorf("expected vpc %q subnet %q group %q to be invalid", test.vpc, test.subnet, test.group)
+		}
+	}
+}
+
+func TestSelectAzureSubnet(t *testing.T) {
+	vnet := &network.VirtualNetwork{
+		Name: to.StringPtr("prod"),
+		VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+			Subnets: &[]network.Subnet{
+				{Name: to.StringPtr("apps"), ID: to.StringPtr(testAzureVNetID + "/subnets/apps")},
+				{Name: to.StringPtr("data"), ID: to.StringPtr(testAzureVNetID + "/subnets/data")},
+			},
+		},
+	}
+
+	subnet, err := selectAzureSubnet(vnet, "Data")
+	if err != nil || to.String(subnet.Name) != "data" {
+		t.Errorf("expected subnet data, got %v %v", subnet, err)
+	}
+
+	if _, err := selectAzureSubnet(vnet, ""); err == nil {
+		t.Error("expected a subnet to be required with several subnets")
+	}
+
+	if _, err := selectAzureSubnet(vnet, "web"); err == nil {
+		t.Error("expected a missing subnet to fail")
+	}
+
+	*vnet.Subnets = (*vnet.Subnets)[:1]
+	subnet, err = selectAzureSubnet(vnet, "")
+	if err != nil || to.String(subnet.Name) != "apps" {
+		t.Errorf("expected the only subnet, got %v %v", subnet, err)
+	}
+}
@@ -19,7 +19,10 @@ func (a *Azure) CreateVolume(config *Config, name, data, size, provider string)
 		return vol, err
 	}
 
-	location := a.getLocation(config)
+	location, err := a.getLocation(config)
+	if err != nil {
+		return vol, err
+	}
 
 	sizeInt, err := strconv.Atoi(size)
 	if err != nil {
@@ -50,6 +53,7 @@ func (a *Azure) CreateVolume(config *Config, name, data, size, provider string)
 	diskParams := compute.Disk{
 		Location: to.StringPtr(location),
 		Name:     to.StringPtr(name),
+		Tags:     azureDefaultTags(config, nil),
 		DiskProperties: &compute.DiskProperties{
 			HyperVGeneration: compute.V1,
 			DiskSizeGB:       to.Int32Ptr(int32(sizeInt / 1000 / 1000)),
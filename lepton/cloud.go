@@ -6,15 +6,19 @@ type CloudImage struct {
 	Name    string
 	Status  string
 	Created string // TODO: prob. should be datetime w/helpers for human formatting
+	Path    string // file of local images
+	Size    int64  // bytes, 0 if unknown
 }
 
 // CloudInstance represents the instance that widely use in different
 // Cloud Providers.
 type CloudInstance struct {
-	ID         string
-	Name       string
-	Status     string
-	Created    string // TODO: prob. should be datetime w/helpers for human formatting
-	PrivateIps []string
-	PublicIps  []string
+	ID            string
+	Name          string
+	Status        string
+	Created       string // TODO: prob. should be datetime w/helpers for human formatting
+	Flavor        string // machine or instance type
+	PrivateIps    []string
+	PublicIps     []string
+	Ipv6Addresses []string
 }
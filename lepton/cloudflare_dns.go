@@ -0,0 +1,222 @@
+package lepton
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// cloudflareAPI is the base url of the cloudflare api
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// CloudflareDNS serves the domain names of instances with Cloudflare DNS,
+// whatever provider hosts them
+type CloudflareDNS struct {
+	token   string
+	baseURL string
+	client  *http.Client
+}
+
+// NewCloudflareDNS returns a cloudflare DNS provider authenticated with the
+// api token passed by argument
+func NewCloudflareDNS(token string) *CloudflareDNS {
+	return &CloudflareDNS{
+		token:   token,
+		baseURL: cloudflareAPI,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+	Proxied bool   `json:"proxied"`
+}
+
+// do sends a request to the cloudflare api and decodes its result in result
+func (cf *CloudflareDNS) do(method string, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, cf.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cf.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := cf.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response cloudflareResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return fmt.Errorf("cloudflare %s %s: %s", method, path, resp.Status)
+	}
+
+	if !response.Success {
+		var messages []string
+		for _, e := range response.Errors {
+			messages = append(messages, fmt.Sprintf("%d %s", e.Code, e.Message))
+		}
+		return fmt.Errorf("cloudflare %s %s: %s", method, path, strings.Join(messages, ", "))
+	}
+
+	if result != nil {
+		return json.Unmarshal(response.Result, result)
+	}
+
+	return nil
+}
+
+// FindOrCreateZoneIDByName returns the id of the cloudflare zone with the name
+// passed by argument. Zones are not created as they must be delegated to
+// cloudflare
+func (cf *CloudflareDNS) FindOrCreateZoneIDByName(config *Config, dnsName string) (string, error) {
+	zoneID, err := cf.FindZoneIDByName(config, dnsName)
+	if err != nil {
+		return "", err
+	}
+
+	if zoneID == "" {
+		return "", fmt.Errorf("cloudflare zone %s not found, add it to your cloudflare account", dnsName)
+	}
+
+	return zoneID, nil
+}
+
+// FindZoneIDByName returns the id of the cloudflare zone with the name passed
+// by argument, empty if there is none
+func (cf *CloudflareDNS) FindZoneIDByName(config *Config, dnsName string) (string, error) {
+	var zones []struct {
+		ID string `json:"id"`
+	}
+
+	err := cf.do("GET", "/zones?name="+url.QueryEscape(dnsName), nil, &zones)
+	if err != nil || len(zones) == 0 {
+		return "", err
+	}
+
+	return zones[0].ID, nil
+}
+
+// records returns the A, AAAA and CNAME records of the name in a cloudflare
+// zone
+func (cf *CloudflareDNS) records(zoneID string, recordName string) ([]cloudflareRecord, error) {
+	var records []cloudflareRecord
+
+	name := strings.TrimSuffix(recordName, ".")
+	err := cf.do("GET", "/zones/"+zoneID+"/dns_records?name="+url.QueryEscape(name), nil, &records)
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []cloudflareRecord
+	for _, record := range records {
+		switch record.Type {
+		case "A", "AAAA", "CNAME":
+			addresses = append(addresses, record)
+		}
+	}
+
+	return addresses, nil
+}
+
+// ZoneRecords returns the A, AAAA and CNAME records of the name in a
+// cloudflare zone
+func (cf *CloudflareDNS) ZoneRecords(config *Config, zoneID string, recordName string) ([]*DNSRecord, error) {
+	records, err := cf.records(zoneID, recordName)
+	if err != nil {
+		return nil, err
+	}
+
+	var zoneRecords []*DNSRecord
+	for _, record := range records {
+		zoneRecords = append(zoneRecords, &DNSRecord{
+			Name: recordName,
+			IP:   record.Content,
+			Type: record.Type,
+			TTL:  record.TTL,
+		})
+	}
+
+	return zoneRecords, nil
+}
+
+// DeleteZoneRecordIfExists deletes the A, AAAA and CNAME records of the name
+// from a cloudflare zone
+func (cf *CloudflareDNS) DeleteZoneRecordIfExists(config *Config, zoneID string, recordName string) error {
+	records, err := cf.records(zoneID, recordName)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		err = cf.do("DELETE", "/zones/"+zoneID+"/dns_records/"+record.ID, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateZoneRecord creates a record in a cloudflare zone
+func (cf *CloudflareDNS) CreateZoneRecord(config *Config, zoneID string, record *DNSRecord) error {
+	return cf.do("POST", "/zones/"+zoneID+"/dns_records", &cloudflareRecord{
+		Type:    record.Type,
+		Name:    strings.TrimSuffix(record.Name, "."),
+		Content: record.IP,
+		TTL:     record.TTL,
+	}, nil)
+}
+
+// UpsertZoneRecords replaces the records of the names with the records passed
+// by argument
+func (cf *CloudflareDNS) UpsertZoneRecords(config *Config, zoneID string, records []*DNSRecord) error {
+	replaced := map[string]bool{}
+
+	for _, record := range records {
+		if !replaced[record.Name] {
+			replaced[record.Name] = true
+
+			err := cf.DeleteZoneRecordIfExists(config, zoneID, record.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := cf.CreateZoneRecord(config, zoneID, record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
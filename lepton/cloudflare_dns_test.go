@@ -0,0 +1,233 @@
+package lepton
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCloudflareUpsertZoneRecords(t *testing.T) {
+	var created []cloudflareRecord
+	var deleted []string
+
+	cfMux := http.NewServeMux()
+	cfMux.HandleFunc("/zones", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		fmt.Fprint(w, `{"success": true, "result": [{"id": "zone1"}]}`)
+	})
+	cfMux.HandleFunc("/zones/zone1/dns_records", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `{"success": true, "result": [{"id": "old", "type": "A", "name": "api.example.com"}, {"id": "txt", "type": "TXT", "name": "api.example.com"}]}`)
+			return
+		}
+
+		var record cloudflareRecord
+		json.NewDecoder(r.Body).Decode(&record)
+		created = append(created, record)
+		fmt.Fprint(w, `{"success": true, "result": {}}`)
+	})
+	cfMux.HandleFunc("/zones/zone1/dns_records/", func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.URL.Path)
+		fmt.Fprint(w, `{"success": true, "result": {}}`)
+	})
+
+	cfServer := httptest.NewServer(cfMux)
+	defer cfServer.Close()
+
+	cf := NewCloudflareDNS("token")
+	cf.baseURL = cfServer.URL
+
+	config := NewConfig()
+
+	zoneID, err := cf.FindOrCreateZoneIDByName(config, "example.com")
+	if err != nil || zoneID != "zone1" {
+		t.Fatalf("got zone %q, %v", zoneID, err)
+	}
+
+	err = cf.UpsertZoneRecords(config, zoneID, []*DNSRecord{
+		{Name: "api.example.com.", IP: "10.0.0.1", Type: "A", TTL: 300},
+		{Name: "api.example.com.", IP: "10.0.0.2", Type: "A", TTL: 300},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != 1 || deleted[0] != "/zones/zone1/dns_records/old" {
+		t.Errorf("unexpected deletions %v", deleted)
+	}
+
+	if len(created) != 2 || created[1].Content != "10.0.0.2" || created[1].Name != "api.example.com" {
+		t.Errorf("unexpected records %+v", created)
+	}
+}
+
+func TestCloudflareErrors(t *testing.T) {
+	cfServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"success": false, "errors": [{"code": 10000, "message": "Authentication error"}]}`)
+	}))
+	defer cfServer.Close()
+
+	cf := NewCloudflareDNS("bad")
+	cf.baseURL = cfServer.URL
+
+	_, err := cf.FindOrCreateZoneIDByName(NewConfig(), "example.com")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDNSProviderFor(t *testing.T) {
+	config := NewConfig()
+	fallback := &AWS{}
+
+	provider, err := dnsProviderFor(config, fallback)
+	if err != nil || provider != fallback {
+		t.Errorf("expected the fallback provider, got %v, %v", provider, err)
+	}
+
+	config.RunConfig.DNSProvider = "route53"
+	provider, err = dnsProviderFor(config, fallback)
+	if err != nil || provider != fallback {
+		t.Errorf("expected the aws provider, got %v, %v", provider, err)
+	}
+
+	config.RunConfig.DNSProvider = "bind"
+	_, err = dnsProviderFor(config, fallback)
+	if err == nil {
+		t.Error("expected unsupported provider error")
+	}
+}
+
+// fakeDNS records the changes of a DNS provider failing in the fail.com zone,
+// serving the existing records and the zones passed
+type fakeDNS struct {
+	zones    []string
+	existing map[string][]*DNSRecord
+	created  []string
+	deleted  []string
+}
+
+func (f *fakeDNS) FindOrCreateZoneIDByName(config *Config, name string) (string, error) {
+	return name, nil
+}
+
+func (f *fakeDNS) FindZoneIDByName(config *Config, name string) (string, error) {
+	for _, zone := range f.zones {
+		if zone == name {
+			return zone, nil
+		}
+	}
+	return "", nil
+}
+
+func (f *fakeDNS) ZoneRecords(config *Config, zoneID string, recordName string) ([]*DNSRecord, error) {
+	return f.existing[recordName], nil
+}
+
+func (f *fakeDNS) DeleteZoneRecordIfExists(config *Config, zoneID string, recordName string) error {
+	if zoneID == "fail.com" {
+		return fmt.Errorf("zone %s unavailable", zoneID)
+	}
+	f.deleted = append(f.deleted, recordName)
+	return nil
+}
+
+func (f *fakeDNS) CreateZoneRecord(config *Config, zoneID string, record *DNSRecord) error {
+	if zoneID == "fail.com" {
+		return fmt.Errorf("zone %s unavailable", zoneID)
+	}
+	f.created = append(f.created, record.Name+" "+record.IP)
+	return nil
+}
+
+func TestCreateDNSRecordsOfDomainNames(t *testing.T) {
+	config := NewConfig()
+	config.RunConfig.PrivateDNS = true
+	config.RunConfig.DomainName = "api.example.com"
+	config.RunConfig.DomainNames = []string{"www.example.com", "api.example.com"}
+
+	names := domainNames(config)
+	if len(names) != 2 || names[0] != "api.example.com" || names[1] != "www.example.com" {
+		t.Fatalf("unexpected domain names %v", names)
+	}
+
+	dns := &fakeDNS{}
+	err := CreateDNSRecords(config, []string{"10.0.0.1"}, dns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(dns.created) != "[api.example.com. 10.0.0.1 www.example.com. 10.0.0.1]" {
+		t.Errorf("unexpected records %v", dns.created)
+	}
+
+	// the records of example.com are restored when fail.com fails, the
+	// replaced record of www is created again and the new one of api deleted
+	config.RunConfig.DomainNames = append(config.RunConfig.DomainNames, "api.fail.com")
+	dns = &fakeDNS{existing: map[string][]*DNSRecord{
+		"www.example.com.": {{Name: "www.example.com.", IP: "10.0.0.9", Type: "A", TTL: 60}},
+	}}
+	err = CreateDNSRecords(config, []string{"10.0.0.1"}, dns)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if fmt.Sprint(dns.created) != "[api.example.com. 10.0.0.1 www.example.com. 10.0.0.1 www.example.com. 10.0.0.9]" {
+		t.Errorf("unexpected records %v", dns.created)
+	}
+
+	if fmt.Sprint(dns.deleted) != "[api.example.com. www.example.com. api.example.com. www.example.com. www.example.com.]" {
+		t.Errorf("unexpected deletions %v", dns.deleted)
+	}
+
+	config.RunConfig.DNSRecordType = "CNAME"
+	config.RunConfig.DomainNames = []string{"example.com"}
+	err = CreateDNSRecords(config, []string{"host.aws.com"}, &fakeDNS{})
+	if err == nil {
+		t.Error("expected an error pointing a CNAME to the apex domain")
+	}
+}
+
+func TestDeleteDNSRecordsWithoutZone(t *testing.T) {
+	config := NewConfig()
+	config.RunConfig.DomainName = "api.example.com"
+	config.RunConfig.DomainNames = []string{"api.other.com"}
+
+	dns := &fakeDNS{zones: []string{"example.com"}}
+	err := DeleteDNSRecords(config, dns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// other.com has no zone, none is created to delete its records from
+	if fmt.Sprint(dns.deleted) != "[api.example.com.]" {
+		t.Errorf("unexpected deletions %v", dns.deleted)
+	}
+}
+
+func TestDomainRecord(t *testing.T) {
+	config := NewConfig()
+
+	dns := &fakeDNS{
+		zones: []string{"example.com"},
+		existing: map[string][]*DNSRecord{
+			"api.example.com.": {{Name: "api.example.com.", IP: "api.example.net", Type: "CNAME", TTL: 60}},
+		},
+	}
+
+	record, err := domainRecord(config, dns, "api.example.com")
+	if err != nil || record == nil || record.Type != "CNAME" || record.TTL != 60 {
+		t.Errorf("expected the CNAME record of api.example.com, got %v, %v", record, err)
+	}
+
+	// other.com has no zone
+	record, err = domainRecord(config, dns, "api.other.com")
+	if err != nil || record != nil {
+		t.Errorf("expected no record of api.other.com, got %v, %v", record, err)
+	}
+}
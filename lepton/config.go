@@ -23,9 +23,15 @@ type Config struct {
 	Force        bool
 	TargetRoot   string
 	BaseVolumeSz string // optional base volume sz
+	TempDir      string // build scratch directory, defaults to the system temp dir
 	ManifestName string // save manifest to
 	RebootOnExit bool   // Reboot on Failure Exit
 	Mounts       map[string]string
+	// DefaultTags are applied to every resource created on aws, gcp, azure
+	// and openstack, e.g. team, cost-center or environment. Other providers
+	// aren't tagged. Tags ops or the run config set on a resource take
+	// precedence
+	DefaultTags []Tag
 }
 
 // ProviderConfig give provider details
@@ -36,6 +42,87 @@ type ProviderConfig struct {
 	BucketName string `cloud:"bucketname"`
 	ImageName  string `cloud:"imagename"`
 	Flavor     string `cloud:"flavor"`
+	KMSKeyID   string `cloud:"kmskeyid"`   // AWS KMS key used to encrypt snapshots and volumes
+	EnaSupport bool   `cloud:"enasupport"` // register AWS images with ENA, required by gpu and most recent instance types
+	// description and key/value metadata of created images, tags on aws and
+	// azure, labels on gcp and properties on openstack
+	ImageDescription string            `cloud:"imagedescription"` // defaults to "nanos image <imagename>"
+	ImageMetadata    map[string]string `cloud:"imagemetadata"`
+	// AWS root volume settings
+	VolumeType       string `cloud:"volumetype"`       // gp2, gp3, io1, io2, ...
+	VolumeIops       int64  `cloud:"volumeiops"`       // provisioned IOPS for gp3, io1 and io2
+	VolumeThroughput int64  `cloud:"volumethroughput"` // throughput in MiB/s for gp3
+	// AWS data volumes created by volume create
+	DataVolumeType       string `cloud:"datavolumetype"`       // gp2, gp3, io1, io2, ... defaults to gp2
+	DataVolumeIops       int64  `cloud:"datavolumeiops"`       // provisioned IOPS for gp3, io1 and io2
+	DataVolumeThroughput int64  `cloud:"datavolumethroughput"` // throughput in MiB/s for gp3
+	// AWS data volume snapshots retention, applied after each volume snapshot
+	SnapshotKeepLast int `cloud:"snapshotkeeplast"` // newest snapshots kept per volume
+	SnapshotMaxAge   int `cloud:"snapshotmaxage"`   // days after which snapshots beyond snapshotkeeplast are deleted
+	// AWS edge locations
+	OutpostARN       string `cloud:"outpostarn"`       // outpost to launch instances in
+	AvailabilityZone string `cloud:"availabilityzone"` // availability or local zone to launch instances in, e.g. us-west-2-lax-1a
+	LockTable        string `cloud:"locktable"`        // dynamodb table holding deploy locks
+	// AWS availability zones where fast snapshot restore is enabled for new images, billed per zone hour
+	FastRestoreZones []string `cloud:"fastrestorezones"`
+	// AWS api retries, a negative MaxRetries disables them
+	MaxRetries    int `cloud:"maxretries"`
+	RetryMinDelay int `cloud:"retrymindelay"` // minimum backoff between retries in milliseconds
+	RetryMaxDelay int `cloud:"retrymaxdelay"` // maximum backoff between retries in milliseconds
+	APITimeout    int `cloud:"apitimeout"`    // timeout in seconds to connect and get the response headers of each api request
+	// AWS flow logs of the instance network interfaces
+	FlowLogDestination string `cloud:"flowlogdestination"` // cloudwatch log group or s3 bucket arn
+	FlowLogRole        string `cloud:"flowlogrole"`        // iam role arn allowed to publish to cloudwatch
+	FlowLogTraffic     string `cloud:"flowlogtraffic"`     // ALL, ACCEPT or REJECT, defaults to ALL
+	// AWS instance metadata service, e.g. "MetadataTokens": "required" enforces IMDSv2
+	MetadataTokens   string `cloud:"metadatatokens"`   // required or optional
+	MetadataHopLimit int64  `cloud:"metadatahoplimit"` // hops allowed to metadata responses, 1 to 64
+	MetadataEndpoint string `cloud:"metadataendpoint"` // enabled or disabled
+	// AWS Marketplace ami product the images are submitted to
+	MarketplaceProduct string `cloud:"marketplaceproduct"` // product id, e.g. prod-abcdefgh12345
+	MarketplaceRole    string `cloud:"marketplacerole"`    // iam role arn the marketplace assumes to ingest the ami
+	// AWS load balancing, created instances are registered with the target group
+	TargetGroupARN  string `cloud:"targetgrouparn"`  // existing alb or nlb target group
+	LoadBalancer    string `cloud:"loadbalancer"`    // network load balancer and target group created if targetgrouparn is empty
+	HealthCheckPath string `cloud:"healthcheckpath"` // http health check path of a created target group, tcp checks if empty
+	HealthCheckPort int    `cloud:"healthcheckport"` // health check port of a created target group, defaults to the traffic port
+	// AWS project tagged on created instances and images, and its soft caps.
+	// Creations exceeding a cap are refused unless RunConfig.ExceedProjectCaps
+	Project      string `cloud:"project"`
+	MaxInstances int    `cloud:"maxinstances"` // instances of the project not terminated, 0 is no cap
+	MaxImages    int    `cloud:"maximages"`    // images of the project, 0 is no cap
+	// hourly usd prices of instance types estimating the cost change of
+	// operations, e.g. e2-medium: 0.0335. Types missing fall back to the
+	// built-in us-east-1 on demand prices of common aws types
+	InstancePrices map[string]float64 `cloud:"instanceprices"`
+	// S3 bucket the deploy history rollbacks restore from is kept in, the
+	// ops home if empty
+	DeployHistoryBucket string `cloud:"deployhistorybucket"`
+	// zones or regions image create, instance create and the image and
+	// instance listings fan out to, concurrently, instead of Zone. {zone} in
+	// BucketName is replaced by each zone
+	Zones []string `cloud:"zones"`
+	// GCP guest os features of created images, e.g. UEFI_COMPATIBLE or GVNIC.
+	// Instances of an image can only use the features it declares
+	GuestOSFeatures []string `cloud:"guestosfeatures"`
+	// AWS services, s3 or dynamodb, routed through gateway endpoints of the
+	// vpc of created instances instead of a nat gateway
+	VPCEndpoints []string `cloud:"vpcendpoints"`
+	// GCP service account email created instances run as and its oauth
+	// scopes, full urls or short names like devstorage.read_only. Scopes
+	// default to cloud-platform, the iam roles of the account limiting it
+	ServiceAccount string   `cloud:"serviceaccount"`
+	Scopes         []string `cloud:"scopes"`
+	// Azure shared image gallery images are published to, as versions of an
+	// image definition named after the image, and the regions the versions
+	// are replicated to besides the zone. Instances launch from the latest
+	// version of the definition
+	ImageGallery       string   `cloud:"imagegallery"`
+	ReplicationRegions []string `cloud:"replicationregions"`
+	// Azure resource group of the existing virtual network and subnet set by
+	// RunConfig.VPC and RunConfig.Subnet, the resource group of the instances
+	// if empty
+	NetworkResourceGroup string `cloud:"networkresourcegroup"`
 }
 
 // Tag is used as property on creating instances
@@ -44,33 +131,112 @@ type Tag struct {
 	Value string `json:"value"`
 }
 
-// RunConfig provides runtime details
+// ServiceDiscovery registers created aws instances with a service registry
+// and deregisters them when they are deleted
+type ServiceDiscovery struct {
+	Registry    string // cloudmap or consul
+	Service     string // cloud map service id or name, or consul service name
+	Port        int    // port registered, defaults to the first port of the run config
+	HealthCheck string // http health check path of consul registrations, tcp checks of the port if empty
+	ConsulAddr  string // consul http api, defaults to CONSUL_HTTP_ADDR or http://127.0.0.1:8500, tagged on instances to deregister them
+}
+
+// RunConfig provides runtime details. Settings tagged instance:"-" only
+// affect how ops runs, they aren't recorded with the instances created
 type RunConfig struct {
-	Imagename      string // FIXME: fullpath? of image
-	BaseName       string // FIXME: basename of image only
-	Ports          []int
-	DomainName     string
-	GdbPort        int
-	CPUs           int // number of cpus
-	Verbose        bool
-	Memory         string
-	Bridged        bool
-	TapName        string
-	Accel          bool
-	UDP            bool // enable UDP
-	UDPPorts       []int
-	OnPrem         bool // true if in a multi-instance/tenant on-prem env
-	Mounts         []string
-	VolumeSizeInGb int //This option is only for openstack.
-	VPC            string
-	SecurityGroup  string
-	Subnet         string
-	Tags           []Tag
-	Debug          bool
-	ShowWarnings   bool
-	ShowErrors     bool
-	ShowDebug      bool
-	Klibs          []string
+	Imagename        string `instance:"-"` // FIXME: fullpath? of image
+	BaseName         string `instance:"-"` // FIXME: basename of image only
+	Ports            []int
+	DomainName       string
+	GdbPort          int  `instance:"-"`
+	CPUs             int  // number of cpus
+	Verbose          bool `instance:"-"`
+	Memory           string
+	Bridged          bool
+	TapName          string
+	Accel            bool
+	UDP              bool // enable UDP
+	UDPPorts         []int
+	OnPrem           bool // true if in a multi-instance/tenant on-prem env
+	Mounts           []string
+	VolumeSizeInGb   int    //This option is only for openstack and aws.
+	VPC              string // aws vpc id, azure virtual network name or id or gcp network, <project>/<network> for a gcp shared vpc
+	SecurityGroup    string
+	Subnet           string // subnet of the vpc, azure subnet id, <project>/<subnetwork> for a gcp shared vpc
+	Tags             []Tag
+	NetworkTags      []string // gcp network tags of created instances, firewall rules targeting them apply to the instances
+	Role             string   // deployment role of created aws instances, e.g. api, matched by the role rules of the vpc and project
+	RoleRules        []string // roles of the vpc and project allowed to reach ports of others, e.g. api->worker:9000 (aws)
+	Debug            bool     `instance:"-"`
+	ShowWarnings     bool     `instance:"-"`
+	ShowErrors       bool     `instance:"-"`
+	ShowDebug        bool     `instance:"-"`
+	Klibs            []string
+	UserData         string            // path to a file passed to cloud instances as user data
+	InstanceEnv      map[string]string // environment variables passed to cloud instances as user data
+	KernelArgs       []string          // kernel argument overrides baked in the image manifest, name or name=value, e.g. trace. Cloud images are named after them
+	KeepSG           bool              // keep the security group created for an instance when it is deleted
+	DeployID         string            `instance:"-"` // correlation id tagged on created resources, generated if empty
+	DNSTTL           int               // ttl of the domain name records in seconds, defaults to 300
+	DNSRecordType    string            // A, AAAA or CNAME (aws), defaults to A
+	PrivateDNS       bool              // create the records in a private zone of the instance vpc (aws) or network (gcp)
+	AutoSuffixName   bool              `instance:"-"` // suffix instance names taken by other instances instead of failing (aws)
+	DNSProvider      string            // aws, gcp or cloudflare serving DomainName, defaults to the compute provider
+	PortRanges       []string          // tcp port ranges opened on cloud firewalls, e.g. 8000-8100
+	AllowedIPs       []string          // source CIDRs allowed by cloud firewalls, defaults to 0.0.0.0/0
+	EnableIPv6       bool              // assign an ipv6 address to aws instances
+	Filters          []ListFilter      `instance:"-"` // filters applied when listing instances and images
+	ImageID          string            // ami launched instead of the newest image with the image name
+	ImageVersion     string            // build of the image to launch, the timestamp suffix of the ami name
+	LaunchTemplate   string            // aws launch template applied to instances in the form name:version
+	InstanceCount    int               `instance:"-"` // instances launched by aws instance create, defaults to 1
+	Async            bool              `instance:"-"` // return operation handles instead of waiting for aws imports and launches
+	PlacementGroup   string            // aws placement group or azure proximity placement group instances are launched in, created if missing
+	Tenancy          string            // default, dedicated or host tenancy of aws instances
+	CreateNetwork    bool              // create an ops managed vpc in aws regions without any
+	ReadyMarker      string            `instance:"-"` // console line the application prints once initialized, aws instance create waits for it
+	ReadyTimeout     int               `instance:"-"` // seconds to wait for ReadyMarker, defaults to 600
+	Wait             bool              `instance:"-"` // wait for created instances to run, and respond on WaitPort if set
+	WaitTimeout      int               `instance:"-"` // seconds to wait for instances with Wait, defaults to 300
+	WaitPort         int               `instance:"-"` // tcp port instances must accept connections on to be ready with Wait
+	CheckQuotas      bool              `instance:"-"` // check aws service quotas before creating instances
+	DryRun           bool              `instance:"-"` // print the aws resources commands would change instead of changing them
+	Quiet            bool              `instance:"-"` // only log errors, results like tables are still printed
+	LogFormat        string            `instance:"-"` // text (default) or json, json logs are written to stderr
+	TimeFormat       string            `instance:"-"` // utc (default), local or relative timestamps in listings
+	DomainNames      []string          // more domain names pointed to the instances along DomainName, e.g. the apex and www
+	WaitReachable    bool              `instance:"-"` // wait for DomainName to resolve to the instance and its first port to accept connections
+	ReachableTimeout int               `instance:"-"` // seconds to wait with WaitReachable, defaults to 300
+
+	// ExceedProjectCaps creates aws instances and images beyond the caps of
+	// the project
+	ExceedProjectCaps bool `instance:"-"`
+	// TerminationProtection prevents deleting aws instances until it's disabled.
+	// There's no stop protection yet, DisableApiStop is only in aws-sdk-go
+	// 1.44 and later
+	TerminationProtection bool
+	// ShutdownBehavior is what happens to aws instances when the unikernel
+	// shuts down, stop (default) or terminate for batch jobs cleaning up after
+	// themselves
+	ShutdownBehavior string
+	// Spot launches azure instances as spot virtual machines, evicted when
+	// azure needs the capacity back or the price exceeds MaxPrice.
+	// EvictionPolicy is deallocate (default) or delete, MaxPrice the hourly
+	// price in US dollars, -1 or 0 paying up to the on-demand price
+	Spot           bool
+	EvictionPolicy string
+	MaxPrice       float64
+	// ServiceDiscovery registers the created aws instances with a cloud map
+	// service or consul catalog, so other services find them without their
+	// addresses
+	ServiceDiscovery ServiceDiscovery
+	// SmokeTests check the new instances of a deploy before the domain names
+	// are pointed to them, the deploy is rolled back if one fails
+	SmokeTests []SmokeTest `instance:"-"`
+	// HoldLatestAlias leaves the latest alias of the image on the previous
+	// image when deploying to aws, for the caller to move it once the new image
+	// is rolled out
+	HoldLatestAlias bool `instance:"-"`
 }
 
 // RuntimeConfig constructs runtime config
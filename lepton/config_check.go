@@ -0,0 +1,171 @@
+package lepton
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// deprecatedConfigFields maps the config fields ops sets itself or no longer
+// reads to the fields replacing them
+var deprecatedConfigFields = map[string]string{
+	"RunConfig.Imagename": "CloudConfig.ImageName",
+	"RunConfig.BaseName":  "CloudConfig.ImageName",
+	"RunConfig.Mounts":    "Mounts",
+}
+
+// configCheck collects the issues of a config file
+type configCheck struct {
+	unknown    []string
+	deprecated []string
+}
+
+// CheckConfig checks the keys of the json config data against the fields of
+// Config. Keys matching no field, e.g. typos like Prots, are returned as an
+// error, with the closest field when there's one, and deprecated fields as
+// warnings naming their replacement
+func CheckConfig(data []byte) ([]string, error) {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, err
+	}
+
+	check := &configCheck{}
+	check.value("", value, reflect.TypeOf(Config{}))
+
+	sort.Strings(check.deprecated)
+	if len(check.unknown) > 0 {
+		sort.Strings(check.unknown)
+		return check.deprecated, errors.New(strings.Join(check.unknown, "; "))
+	}
+
+	return check.deprecated, nil
+}
+
+// value checks the keys of the value decoded to a field of type t at path
+func (check *configCheck) value(path string, value interface{}, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		for key, v := range object {
+			field, ok := configField(t, key)
+			if !ok {
+				check.unknown = append(check.unknown, unknownConfigKey(t, path, key))
+				continue
+			}
+
+			fieldPath := path + field.Name
+			if replacement, ok := deprecatedConfigFields[fieldPath]; ok {
+				check.deprecated = append(check.deprecated,
+					fmt.Sprintf("%s is deprecated, use %s", fieldPath, replacement))
+			}
+
+			check.value(fieldPath+".", v, field.Type)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+
+		for i, item := range items {
+			check.value(fmt.Sprintf("%s%d.", path, i), item, t.Elem())
+		}
+	}
+}
+
+// configFieldName returns the json key of the struct field
+func configFieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// configField returns the field of the struct type the json key decodes to,
+// matched without case like encoding/json
+func configField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		if strings.EqualFold(configFieldName(field), key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// unknownConfigKey describes the unknown key at path, suggesting the field
+// of the struct type with the closest name
+func unknownConfigKey(t reflect.Type, path string, key string) string {
+	description := "unknown key " + path + key
+
+	suggestion, best := "", 3
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || field.Tag.Get("json") == "-" {
+			continue
+		}
+
+		name := configFieldName(field)
+		if d := editDistance(strings.ToLower(name), strings.ToLower(key)); d < best {
+			suggestion, best = name, d
+		}
+	}
+
+	if suggestion != "" {
+		description += ", did you mean " + path + suggestion + "?"
+	}
+	return description
+}
+
+// editDistance returns the number of insertions, deletions, substitutions
+// and transpositions of adjacent characters turning a into b
+func editDistance(a string, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = d[i-1][j-1] + cost
+			if d[i-1][j]+1 < d[i][j] {
+				d[i][j] = d[i-1][j] + 1
+			}
+			if d[i][j-1]+1 < d[i][j] {
+				d[i][j] = d[i][j-1] + 1
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && d[i-2][j-2]+1 < d[i][j] {
+				d[i][j] = d[i-2][j-2] + 1
+			}
+		}
+	}
+
+	return d[len(a)][len(b)]
+}
@@ -0,0 +1,45 @@
+package lepton
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	data := []byte(`{
+		"Args": ["--listen"],
+		"env": {"ANY_KEY": "1"},
+		"RunConfig": {"Prots": [8080], "Imagename": "web", "Tags": [{"key": "team", "valeu": "api"}]},
+		"CloudConfig": {"ProjectID": "prod"},
+		"Mounts": {"data": "/data"},
+		"Colour": "blue"
+	}`)
+
+	warnings, err := CheckConfig(data)
+	if err == nil {
+		t.Fatal("expected unknown keys to fail the check")
+	}
+
+	for _, unknown := range []string{
+		"unknown key RunConfig.Prots, did you mean RunConfig.Ports?",
+		"unknown key RunConfig.Tags.0.valeu, did you mean RunConfig.Tags.0.value?",
+		"unknown key Colour",
+	} {
+		if !strings.Contains(err.Error(), unknown) {
+			t.Errorf("expected %q in %q", unknown, err.Error())
+		}
+	}
+
+	if strings.Contains(err.Error(), "ANY_KEY") || strings.Contains(err.Error(), "data") {
+		t.Errorf("keys of map fields aren't config fields, got %q", err.Error())
+	}
+
+	if len(warnings) != 1 || warnings[0] != "RunConfig.Imagename is deprecated, use CloudConfig.ImageName" {
+		t.Errorf("unexpected warnings %v", warnings)
+	}
+
+	warnings, err = CheckConfig([]byte(`{"runconfig": {"ports": [80]}, "CloudConfig": {"Zone": "us-west1-b"}}`))
+	if err != nil || len(warnings) != 0 {
+		t.Errorf("expected a valid config, got %v %v", warnings, err)
+	}
+}
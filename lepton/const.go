@@ -95,11 +95,20 @@ func GetOpsHome() string {
 	return opshome
 }
 
+// tempDir returns the directory holding build scratch directories and
+// converted cloud images, the system temp directory unless TempDir is set
+func tempDir(c *Config) string {
+	if c.TempDir != "" {
+		return c.TempDir
+	}
+	return os.TempDir()
+}
+
 func getImageTempDir(c *Config) string {
 	temp := filepath.Base(c.Program) + "_temp"
 
 	if c.BuildDir == "" {
-		dir, err := ioutil.TempDir("", temp)
+		dir, err := ioutil.TempDir(c.TempDir, temp)
 		if err != nil {
 			fmt.Println(err)
 		}
@@ -0,0 +1,159 @@
+package lepton
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// consulDefaultAddr is the http api of the local consul agent
+const consulDefaultAddr = "http://127.0.0.1:8500"
+
+// ConsulCatalog registers instances as external nodes of a consul catalog
+type ConsulCatalog struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// NewConsulCatalog returns a client of the consul http api at addr, or at
+// CONSUL_HTTP_ADDR if addr is empty, authenticated with CONSUL_HTTP_TOKEN
+func NewConsulCatalog(addr string) *ConsulCatalog {
+	if addr == "" {
+		addr = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if addr == "" {
+		addr = consulDefaultAddr
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	return &ConsulCatalog{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  os.Getenv("CONSUL_HTTP_TOKEN"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type consulService struct {
+	ID      string `json:"ID"`
+	Service string `json:"Service"`
+	Address string `json:"Address"`
+	Port    int    `json:"Port"`
+}
+
+type consulCheckDefinition struct {
+	HTTP     string `json:"HTTP,omitempty"`
+	TCP      string `json:"TCP,omitempty"`
+	Interval string `json:"Interval"`
+	Timeout  string `json:"Timeout"`
+}
+
+type consulCheck struct {
+	CheckID    string                `json:"CheckID"`
+	Name       string                `json:"Name"`
+	ServiceID  string                `json:"ServiceID"`
+	Status     string                `json:"Status"`
+	Definition consulCheckDefinition `json:"Definition"`
+}
+
+type consulRegistration struct {
+	Node     string            `json:"Node"`
+	Address  string            `json:"Address"`
+	NodeMeta map[string]string `json:"NodeMeta"`
+	Service  consulService     `json:"Service"`
+	Check    *consulCheck      `json:"Check,omitempty"`
+}
+
+// consulRegistrationFor returns the catalog registration of the service of
+// the instance id at address:port, health checked over http at healthCheck
+// or over tcp if it's empty
+func consulRegistrationFor(node string, id string, service string, address string, port int, healthCheck string) consulRegistration {
+	registration := consulRegistration{
+		Node:    node,
+		Address: address,
+		// consul-esm runs the checks of external nodes
+		NodeMeta: map[string]string{"external-node": "true", "external-probe": "true"},
+		Service: consulService{
+			ID:      id,
+			Service: service,
+			Address: address,
+			Port:    port,
+		},
+	}
+
+	if port == 0 {
+		return registration
+	}
+
+	definition := consulCheckDefinition{
+		TCP:      fmt.Sprintf("%s:%d", address, port),
+		Interval: "10s",
+		Timeout:  "5s",
+	}
+	if healthCheck != "" {
+		definition = consulCheckDefinition{
+			HTTP:     fmt.Sprintf("http://%s:%d/%s", address, port, strings.TrimPrefix(healthCheck, "/")),
+			Interval: "10s",
+			Timeout:  "5s",
+		}
+	}
+
+	registration.Check = &consulCheck{
+		CheckID:    "service:" + id,
+		Name:       service + " health",
+		ServiceID:  id,
+		Status:     "critical",
+		Definition: definition,
+	}
+
+	return registration
+}
+
+// put sends body to the consul catalog endpoint path
+func (cc *ConsulCatalog) put(path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", cc.addr+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cc.token != "" {
+		req.Header.Set("X-Consul-Token", cc.token)
+	}
+
+	resp, err := cc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("consul PUT %s: %s %s", path, resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// Register registers the service of the instance id at address:port on the
+// node, named after the instance
+func (cc *ConsulCatalog) Register(node string, id string, service string, address string, port int, healthCheck string) error {
+	return cc.put("/v1/catalog/register", consulRegistrationFor(node, id, service, address, port, healthCheck))
+}
+
+// Deregister removes the node of an instance and its services from the
+// catalog
+func (cc *ConsulCatalog) Deregister(node string) error {
+	return cc.put("/v1/catalog/deregister", map[string]string{"Node": node})
+}
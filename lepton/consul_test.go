@@ -0,0 +1,51 @@
+package lepton
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConsulCatalog(t *testing.T) {
+	var path, token string
+	var registration consulRegistration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		token = r.Header.Get("X-Consul-Token")
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &registration)
+		w.Write([]byte("true"))
+	}))
+	defer server.Close()
+
+	cc := NewConsulCatalog(server.URL)
+	cc.token = "secret"
+
+	err := cc.Register("i-0123456789abcdef0", "i-0123456789abcdef0", "api", "10.0.1.5", 8080, "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/catalog/register" || token != "secret" {
+		t.Errorf("unexpected request to %s with token %q", path, token)
+	}
+
+	if registration.Service.Service != "api" || registration.Service.Port != 8080 || registration.Address != "10.0.1.5" {
+		t.Errorf("unexpected registration %+v", registration)
+	}
+
+	if registration.Check == nil || registration.Check.Definition.HTTP != "http://10.0.1.5:8080/health" {
+		t.Errorf("expected an http health check, got %+v", registration.Check)
+	}
+
+	if tcp := consulRegistrationFor("n", "i", "api", "10.0.1.5", 8080, ""); tcp.Check.Definition.TCP != "10.0.1.5:8080" {
+		t.Errorf("expected a tcp health check, got %+v", tcp.Check)
+	}
+
+	err = cc.Deregister("i-0123456789abcdef0")
+	if err != nil || path != "/v1/catalog/deregister" {
+		t.Errorf("unexpected deregistration to %s: %v", path, err)
+	}
+}
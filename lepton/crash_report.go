@@ -0,0 +1,120 @@
+package lepton
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// CrashError replaces the panic of an operation, e.g. a lookup of the first
+// image of an empty result, so it's reported like any other error
+type CrashError struct {
+	Op     string
+	Value  interface{}
+	Report string // path of the crash report, empty if it couldn't be written
+}
+
+func (e *CrashError) Error() string {
+	msg := fmt.Sprintf("ops crashed during %s: %v", e.Op, e.Value)
+	if e.Report == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s\nA crash report was written to %s, please attach it to an issue at https://github.com/nanovms/ops/issues", msg, e.Report)
+}
+
+// crashReportDir returns the directory of the crash reports. It doesn't use
+// GetOpsHome as that panics without a home directory
+func crashReportDir() string {
+	home, err := HomeDir()
+	if err != nil {
+		return path.Join(os.TempDir(), "ops-crashes")
+	}
+	return path.Join(home, ".ops", "crashes")
+}
+
+// redactedArg replaces the values of the arguments in the crash reports
+const redactedArg = "<redacted>"
+
+// redactArgs returns the command line arguments with the values of the flags,
+// e.g. --envs KEY=secret or --password=secret, and the name=value arguments
+// redacted, keeping the command and the flag names
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	var flagValue bool
+	for i, arg := range args {
+		switch {
+		case i == 0:
+			redacted[i] = arg
+		case strings.HasPrefix(arg, "-"):
+			if eq := strings.Index(arg, "="); eq >= 0 {
+				redacted[i] = arg[:eq+1] + redactedArg
+				flagValue = false
+				continue
+			}
+			redacted[i] = arg
+			flagValue = true
+			continue
+		case flagValue, strings.Contains(arg, "="):
+			redacted[i] = redactedArg
+		default:
+			redacted[i] = arg
+		}
+		flagValue = false
+	}
+	return redacted
+}
+
+// crashReport returns the content of the crash report of the operation
+func crashReport(op string, value interface{}, stack []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "operation: %s\n", op)
+	fmt.Fprintf(&b, "error: %v\n", value)
+	fmt.Fprintf(&b, "time: %s\n", time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "ops version: %s\n", Version)
+	fmt.Fprintf(&b, "nanos version: %s\n", LocalReleaseVersion)
+	fmt.Fprintf(&b, "go version: %s\n", runtime.Version())
+	fmt.Fprintf(&b, "platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "command: %s\n\n", strings.Join(redactArgs(os.Args), " "))
+	b.Write(stack)
+	return b.String()
+}
+
+// crashError writes the crash report of the operation to dir and returns the
+// error replacing the panic
+func crashError(dir string, op string, value interface{}, stack []byte) *CrashError {
+	crash := &CrashError{Op: op, Value: value}
+
+	// reports hold the environment of the command, only the user reads them
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return crash
+	}
+
+	report := path.Join(dir, fmt.Sprintf("crash-%s.txt", time.Now().UTC().Format("20060102T150405.000Z")))
+	err = ioutil.WriteFile(report, []byte(crashReport(op, value, stack)), 0600)
+	if err != nil {
+		return crash
+	}
+
+	crash.Report = report
+	return crash
+}
+
+// RecoverPanic recovers from a panic of the operation and sets err to a
+// CrashError pointing to a crash report. Deferred by functions returning an
+// error:
+//
+//	defer RecoverPanic("image delete", &err)
+func RecoverPanic(op string, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	*err = crashError(crashReportDir(), op, r, debug.Stack())
+}
@@ -0,0 +1,63 @@
+package lepton
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCrashError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "crashes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	crash := crashError(dir, "image delete", "index out of range", []byte("goroutine 1 [running]:\n"))
+	if crash.Report == "" {
+		t.Fatal("expected a crash report")
+	}
+
+	report, err := ioutil.ReadFile(crash.Report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{"operation: image delete", "error: index out of range", "goroutine 1 [running]:"} {
+		if !strings.Contains(string(report), s) {
+			t.Errorf("crash report misses %q:\n%s", s, report)
+		}
+	}
+
+	info, err := os.Stat(crash.Report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the crash report to be readable by its owner only, got %v", info.Mode().Perm())
+	}
+
+	if !strings.Contains(crash.Error(), crash.Report) {
+		t.Errorf("error doesn't point to the crash report: %s", crash.Error())
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ops", "image", "list"}, "ops image list"},
+		{[]string{"ops", "instance", "create", "web", "--envs", "KEY=secret"}, "ops instance create web --envs <redacted>"},
+		{[]string{"ops", "instance", "create", "-e", "TOKEN=abc", "web"}, "ops instance create -e <redacted> web"},
+		{[]string{"ops", "deploy", "--password=secret", "web"}, "ops deploy --password=<redacted> web"},
+		{[]string{"ops", "run", "app", "KEY=secret"}, "ops run app <redacted>"},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(redactArgs(tt.args), " "); got != tt.want {
+			t.Errorf("redactArgs(%v) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package lepton
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
+	"path"
 	"strings"
 )
 
@@ -12,7 +14,18 @@ type Datastores struct{}
 // CopyToBucket converts the raw disk image to a monolithicFlat vmdk.
 func (s *Datastores) CopyToBucket(config *Config, archPath string) error {
 
-	vmdkPath := "/tmp/" + config.CloudConfig.ImageName + ".vmdk"
+	fi, err := os.Stat(archPath)
+	if err != nil {
+		return err
+	}
+
+	// the flat vmdk is as large as the raw image
+	err = checkFreeSpace(tempDir(config), fi.Size(), "the vmdk")
+	if err != nil {
+		return err
+	}
+
+	vmdkPath := path.Join(tempDir(config), config.CloudConfig.ImageName+".vmdk")
 
 	vmdkPath = strings.ReplaceAll(vmdkPath, "-image", "")
 
@@ -23,7 +36,7 @@ func (s *Datastores) CopyToBucket(config *Config, archPath string) error {
 	}
 
 	cmd := exec.Command("qemu-img", args...)
-	err := cmd.Run()
+	err = cmd.Run()
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -0,0 +1,114 @@
+package lepton
+
+import (
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// withDefaultTags returns the aws tags with the default tags of the config
+func withDefaultTags(c *Config, tags []*ec2.Tag) []*ec2.Tag {
+	result := append([]*ec2.Tag{}, tags...)
+
+	set := map[string]bool{}
+	for _, tag := range tags {
+		set[aws.StringValue(tag.Key)] = true
+	}
+
+	for _, tag := range c.DefaultTags {
+		if tag.Key == "" || set[tag.Key] {
+			continue
+		}
+		set[tag.Key] = true
+		result = append(result, &ec2.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
+	}
+
+	return result
+}
+
+// deployIDTag is the tag holding the deploy id of the operation that created
+// an azure or openstack resource
+const deployIDTag = "DeployID"
+
+// gcpDeployIDLabel is the label holding the deploy id of the operation that
+// created a gcp resource, labels keys being lowercase
+const gcpDeployIDLabel = "deploy-id"
+
+// gcpDefaultLabels returns the gcp labels with the default tags and the
+// deploy id of the config, nil if there are none
+func gcpDefaultLabels(c *Config, labels map[string]string) map[string]string {
+	if len(labels) == 0 && len(c.DefaultTags) == 0 && c.RunConfig.DeployID == "" {
+		return nil
+	}
+
+	result := map[string]string{}
+	for key, value := range labels {
+		result[key] = value
+	}
+
+	for _, tag := range c.DefaultTags {
+		key := gcpLabelValue(tag.Key)
+		if _, ok := result[key]; ok || key == "" {
+			continue
+		}
+		result[key] = gcpLabelValue(tag.Value)
+	}
+
+	if c.RunConfig.DeployID != "" {
+		result[gcpDeployIDLabel] = gcpLabelValue(c.RunConfig.DeployID)
+	}
+
+	return result
+}
+
+// azureDefaultTags returns the azure tags with the default tags and the deploy
+// id of the config
+func azureDefaultTags(c *Config, tags map[string]*string) map[string]*string {
+	if len(c.DefaultTags) == 0 && c.RunConfig.DeployID == "" {
+		return tags
+	}
+
+	result := map[string]*string{}
+	for key, value := range tags {
+		result[key] = value
+	}
+
+	for _, tag := range c.DefaultTags {
+		if _, ok := result[tag.Key]; ok || tag.Key == "" {
+			continue
+		}
+		result[tag.Key] = to.StringPtr(tag.Value)
+	}
+
+	if c.RunConfig.DeployID != "" {
+		result[deployIDTag] = to.StringPtr(c.RunConfig.DeployID)
+	}
+
+	return result
+}
+
+// openstackDefaultMetadata returns the openstack metadata or image properties
+// with the default tags and the deploy id of the config
+func openstackDefaultMetadata(c *Config, metadata map[string]string) map[string]string {
+	if len(c.DefaultTags) == 0 && c.RunConfig.DeployID == "" {
+		return metadata
+	}
+
+	result := map[string]string{}
+	for key, value := range metadata {
+		result[key] = value
+	}
+
+	for _, tag := range c.DefaultTags {
+		if _, ok := result[tag.Key]; ok || tag.Key == "" {
+			continue
+		}
+		result[tag.Key] = tag.Value
+	}
+
+	if c.RunConfig.DeployID != "" {
+		result[deployIDTag] = c.RunConfig.DeployID
+	}
+
+	return result
+}
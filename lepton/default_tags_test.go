@@ -0,0 +1,67 @@
+package lepton
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestDefaultTags(t *testing.T) {
+	c := NewConfig()
+	c.DefaultTags = []Tag{
+		{Key: "team", Value: "payments"},
+		{Key: "Name", Value: "ignored"},
+		{Key: "Cost-Center", Value: "CC 42"},
+	}
+
+	tags := withDefaultTags(c, []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web-1")}})
+	if awsTagsString(tags) != awsTagsString([]*ec2.Tag{
+		{Key: aws.String("Name"), Value: aws.String("web-1")},
+		{Key: aws.String("team"), Value: aws.String("payments")},
+		{Key: aws.String("Cost-Center"), Value: aws.String("CC 42")},
+	}) {
+		t.Errorf("expected the default tags after the resource tags, got %s", awsTagsString(tags))
+	}
+
+	labels := gcpDefaultLabels(c, map[string]string{"team": "search"})
+	if labels["team"] != "search" || labels["cost-center"] != "cc_42" || labels["name"] != "ignored" {
+		t.Errorf("unexpected gcp labels %v", labels)
+	}
+
+	if azureDefaultTags(c, nil)["Cost-Center"] == nil {
+		t.Error("expected default azure tags")
+	}
+
+	if metadata := openstackDefaultMetadata(c, map[string]string{"description": "nanos"}); metadata["team"] != "payments" || metadata["description"] != "nanos" {
+		t.Errorf("unexpected openstack metadata %v", metadata)
+	}
+
+	if labels := gcpDefaultLabels(NewConfig(), nil); labels != nil {
+		t.Errorf("expected no labels without default tags, got %v", labels)
+	}
+	deployed := NewConfig()
+	deployed.RunConfig.DeployID = "3fa2c1d0e9b8"
+	if labels := gcpDefaultLabels(deployed, nil); labels[gcpDeployIDLabel] != "3fa2c1d0e9b8" {
+		t.Errorf("expected the deploy id label, got %v", labels)
+	}
+
+	if tags := azureDefaultTags(deployed, nil); tags[deployIDTag] == nil || *tags[deployIDTag] != "3fa2c1d0e9b8" {
+		t.Error("expected the deploy id azure tag")
+	}
+
+	if metadata := openstackDefaultMetadata(deployed, nil); metadata[deployIDTag] != "3fa2c1d0e9b8" {
+		t.Errorf("expected the deploy id openstack metadata, got %v", metadata)
+	}
+
+	NewContext(deployed, nil)
+	if deployed.RunConfig.DeployID != "3fa2c1d0e9b8" {
+		t.Errorf("expected the deploy id of the config to be kept, got %s", deployed.RunConfig.DeployID)
+	}
+
+	generated := NewConfig()
+	ctx := NewContext(generated, nil)
+	if generated.RunConfig.DeployID == "" || generated.RunConfig.DeployID != ctx.DeployID() {
+		t.Errorf("expected the generated deploy id in the config, got %q", generated.RunConfig.DeployID)
+	}
+}
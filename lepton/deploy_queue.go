@@ -0,0 +1,402 @@
+package lepton
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"golang.org/x/oauth2/google"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+// deploy commands consumed by the deploy daemon
+const (
+	DeployActionScale    = "scale"    // resize an instance group
+	DeployActionRollout  = "rollout"  // replace instances with instances of an image
+	DeployActionRollback = "rollback" // roll an image back to its previous deploy
+)
+
+// queueRetryDelay is the pause after a failed receive before polling again
+const queueRetryDelay = 10 * time.Second
+
+// queueLease is how long a received message is hidden from other consumers.
+// The lease is extended every queueLease/3 while its command runs, so slow
+// rollouts aren't received again while they run
+const queueLease = 5 * time.Minute
+
+// maxDeployAttempts is how many times the command of a message runs before
+// the message is dropped, sqs queues with a redrive policy move failing
+// messages to their dead letter queue before
+const maxDeployAttempts = 5
+
+// DeployCommand is a message of a deploy queue, e.g.
+// {"action": "scale", "group": "api", "desired": 5}
+type DeployCommand struct {
+	Action  string   `json:"action"`
+	Group   string   `json:"group,omitempty"`   // instance group resized by scale
+	Desired *int64   `json:"desired,omitempty"` // instances of the group
+	Min     *int64   `json:"min,omitempty"`     // size of the group, unchanged if missing
+	Max     *int64   `json:"max,omitempty"`
+	Image   string   `json:"image,omitempty"`  // image rolled out or back, name or name:version
+	Count   int      `json:"count,omitempty"`  // instances launched by rollout, defaults to 1
+	Retire  []string `json:"retire,omitempty"` // filters of the instances a rollout replaces, e.g. Image=api
+}
+
+// ParseDeployCommand decodes and checks the deploy command of a queue message
+func ParseDeployCommand(body []byte) (*DeployCommand, error) {
+	command := &DeployCommand{}
+	err := json.Unmarshal(body, command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deploy command: %v", err)
+	}
+
+	switch command.Action {
+	case DeployActionScale:
+		if command.Group == "" {
+			return nil, errors.New("scale command without group")
+		}
+		if command.Desired == nil || *command.Desired < 0 {
+			return nil, errors.New("scale command without desired capacity")
+		}
+	case DeployActionRollout, DeployActionRollback:
+		if command.Image == "" {
+			return nil, fmt.Errorf("%s command without image", command.Action)
+		}
+		if _, err := ParseListFilters(command.Retire); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported deploy action %q, expected %s, %s or %s", command.Action, DeployActionScale, DeployActionRollout, DeployActionRollback)
+	}
+
+	return command, nil
+}
+
+// QueueMessage is a message received from a deploy queue
+type QueueMessage struct {
+	ID       string
+	Body     []byte
+	Attempts int    // times the message was received, 0 if the queue doesn't count them
+	receipt  string // handle acknowledging the message
+}
+
+// DeployQueue is a queue deploy commands are received from
+type DeployQueue interface {
+	// Receive waits for a message leased for queueLease, returning nil if
+	// there's none after a while
+	Receive() (*QueueMessage, error)
+	// Extend leases the message for queueLease from now on
+	Extend(message QueueMessage) error
+	// Ack removes the message from the queue, messages not acknowledged are
+	// received again once their lease expires
+	Ack(message QueueMessage) error
+}
+
+// NewDeployQueue returns the sqs queue with the url passed by argument, or
+// the pub/sub subscription named projects/<project>/subscriptions/<name>
+func NewDeployQueue(ctx *Context, queue string) (DeployQueue, error) {
+	switch {
+	case strings.HasPrefix(queue, "https://sqs."):
+		sess, err := newAWSSession(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone)
+		if err != nil {
+			return nil, err
+		}
+		return &sqsDeployQueue{svc: sqs.New(sess), url: queue}, nil
+	case strings.HasPrefix(queue, "projects/") && strings.Contains(queue, "/subscriptions/"):
+		client, err := google.DefaultClient(context.Background(), pubsub.PubsubScope)
+		if err != nil {
+			return nil, err
+		}
+		svc, err := pubsub.New(client)
+		if err != nil {
+			return nil, err
+		}
+		return &pubsubDeployQueue{svc: svc, subscription: queue}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported queue %q, expected an sqs queue url or a pub/sub subscription", queue)
+}
+
+// sqsDeployQueue receives deploy commands from an sqs queue. Messages failing
+// until their max receive count move to the dead letter queue of its redrive
+// policy
+type sqsDeployQueue struct {
+	svc *sqs.SQS
+	url string
+}
+
+func (q *sqsDeployQueue) Receive() (*QueueMessage, error) {
+	result, err := q.svc.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.url),
+		MaxNumberOfMessages: aws.Int64(1),
+		AttributeNames:      aws.StringSlice([]string{sqs.MessageSystemAttributeNameApproximateReceiveCount}),
+		VisibilityTimeout:   aws.Int64(int64(queueLease.Seconds())),
+		WaitTimeSeconds:     aws.Int64(20),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("receive from %s: %v", q.url, err)
+	}
+
+	if len(result.Messages) == 0 {
+		return nil, nil
+	}
+
+	message := result.Messages[0]
+	attempts, _ := strconv.Atoi(aws.StringValue(message.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+
+	return &QueueMessage{
+		ID:       aws.StringValue(message.MessageId),
+		Body:     []byte(aws.StringValue(message.Body)),
+		Attempts: attempts,
+		receipt:  aws.StringValue(message.ReceiptHandle),
+	}, nil
+}
+
+func (q *sqsDeployQueue) Extend(message QueueMessage) error {
+	_, err := q.svc.ChangeMessageVisibility(&sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(q.url),
+		ReceiptHandle:     aws.String(message.receipt),
+		VisibilityTimeout: aws.Int64(int64(queueLease.Seconds())),
+	})
+	return err
+}
+
+func (q *sqsDeployQueue) Ack(message QueueMessage) error {
+	_, err := q.svc.DeleteMessage(&sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.url),
+		ReceiptHandle: aws.String(message.receipt),
+	})
+	return err
+}
+
+// pubsubDeployQueue receives deploy commands from a pub/sub subscription
+type pubsubDeployQueue struct {
+	svc          *pubsub.Service
+	subscription string
+}
+
+func (q *pubsubDeployQueue) Receive() (*QueueMessage, error) {
+	result, err := q.svc.Projects.Subscriptions.Pull(q.subscription, &pubsub.PullRequest{MaxMessages: 1}).Do()
+	if err != nil {
+		return nil, fmt.Errorf("pull from %s: %v", q.subscription, err)
+	}
+
+	if len(result.ReceivedMessages) == 0 || result.ReceivedMessages[0].Message == nil {
+		return nil, nil
+	}
+	received := result.ReceivedMessages[0]
+
+	body, err := base64.StdEncoding.DecodeString(received.Message.Data)
+	if err != nil {
+		body = []byte(received.Message.Data)
+	}
+
+	message := &QueueMessage{
+		ID:      received.Message.MessageId,
+		Body:    body,
+		receipt: received.AckId,
+	}
+
+	// the ack deadline of the subscription may be shorter than the lease
+	err = q.Extend(*message)
+	if err != nil {
+		return nil, fmt.Errorf("extend the ack deadline of message %s: %v", message.ID, err)
+	}
+
+	return message, nil
+}
+
+func (q *pubsubDeployQueue) Extend(message QueueMessage) error {
+	_, err := q.svc.Projects.Subscriptions.ModifyAckDeadline(q.subscription, &pubsub.ModifyAckDeadlineRequest{
+		AckIds:             []string{message.receipt},
+		AckDeadlineSeconds: int64(queueLease.Seconds()),
+	}).Do()
+	return err
+}
+
+func (q *pubsubDeployQueue) Ack(message QueueMessage) error {
+	_, err := q.svc.Projects.Subscriptions.Acknowledge(q.subscription, &pubsub.AcknowledgeRequest{
+		AckIds: []string{message.receipt},
+	}).Do()
+	return err
+}
+
+// runLeased runs the command of the message, extending the lease of the
+// message until it returns. A panic of the command is returned as its error
+func runLeased(ctx *Context, queue DeployQueue, message QueueMessage, command *DeployCommand, run DeployCommandFunc) (err error) {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(queueLease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := queue.Extend(message); err != nil {
+					ctx.logger.Warn("extend the lease of message %s: %v", message.ID, err)
+				}
+			}
+		}
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return run(message, command)
+}
+
+// DeployCommandFunc runs the deploy command of a queue message
+type DeployCommandFunc func(message QueueMessage, command *DeployCommand) error
+
+// consumeDeployQueue runs the commands received from the queue one at a time
+// until stop is closed. Messages are acknowledged once their command
+// succeeds, invalid messages right away as they would never succeed, failed
+// commands are received again until they ran maxDeployAttempts times
+func consumeDeployQueue(ctx *Context, queue DeployQueue, stop <-chan struct{}, run DeployCommandFunc) {
+	// attempts of the messages of queues not counting them
+	failures := map[string]int{}
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		message, err := queue.Receive()
+		if err != nil {
+			ctx.logger.Warn("%v", err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(queueRetryDelay):
+			}
+			continue
+		}
+
+		if message == nil {
+			continue
+		}
+
+		attempts := message.Attempts
+		if attempts == 0 {
+			attempts = failures[message.ID] + 1
+		}
+
+		command, err := ParseDeployCommand(message.Body)
+		if err != nil {
+			ctx.logger.Error("dropping message %s: %v", message.ID, err)
+		} else if attempts > maxDeployAttempts {
+			ctx.logger.Error("dropping message %s, its %s command failed %d times", message.ID, command.Action, attempts-1)
+		} else {
+			ctx.logger.Log("Running %s command of message %s, attempt %d", command.Action, message.ID, attempts)
+			err = runLeased(ctx, queue, *message, command, run)
+			if err != nil {
+				ctx.logger.Error("%s command of message %s failed: %v", command.Action, message.ID, err)
+				failures[message.ID] = attempts
+				continue
+			}
+		}
+		delete(failures, message.ID)
+
+		err = queue.Ack(*message)
+		if err != nil {
+			ctx.logger.Warn("acknowledge message %s: %v", message.ID, err)
+		}
+	}
+}
+
+// ConsumeDeployCommands runs the scale, rollout and rollback commands
+// received from the queue with the config of the context until stop is
+// closed, letting external systems scale and deploy fleets without reaching
+// ops
+func (p *AWS) ConsumeDeployCommands(ctx *Context, queue DeployQueue, stop <-chan struct{}) {
+	consumeDeployQueue(ctx, queue, stop, func(message QueueMessage, command *DeployCommand) error {
+		return p.runDeployCommand(ctx, message, command)
+	})
+}
+
+// queueDeployID returns the deploy id of the command of a queue message, its
+// message id with the characters not allowed in gcp labels replaced, so the
+// resources of a command are found from the message that ran it
+func queueDeployID(messageID string) string {
+	id := []rune(strings.ToLower(messageID))
+	for i, r := range id {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			id[i] = '-'
+		}
+	}
+
+	if len(id) > 63 {
+		id = id[:63]
+	}
+	return string(id)
+}
+
+// runDeployCommand runs the command of the message with a copy of the config
+// of the context, in a context of its own whose deploy id is taken from the
+// message
+func (p *AWS) runDeployCommand(ctx *Context, message QueueMessage, command *DeployCommand) error {
+	c := *ctx.config
+	c.RunConfig.DeployID = queueDeployID(message.ID)
+
+	commandCtx := NewContext(&c, ctx.provider)
+	commandCtx.progressFuncs = ctx.progressFuncs
+	commandCtx.logger.Log("Deploy id %s", commandCtx.DeployID())
+
+	switch command.Action {
+	case DeployActionScale:
+		group := InstanceGroup{
+			Name:                   command.Group,
+			MinSize:                -1,
+			MaxSize:                -1,
+			DesiredCapacity:        *command.Desired,
+			HealthCheckGracePeriod: -1,
+			TargetCPU:              -1,
+		}
+		if command.Min != nil {
+			group.MinSize = *command.Min
+		}
+		if command.Max != nil {
+			group.MaxSize = *command.Max
+		}
+
+		// the image of the group is kept
+		c.CloudConfig.ImageName = ""
+		c.RunConfig.ImageID = ""
+		return p.UpdateInstanceGroup(commandCtx, group, false)
+	case DeployActionRollout:
+		retire, err := ParseListFilters(command.Retire)
+		if err != nil {
+			return err
+		}
+
+		c.CloudConfig.ImageName = command.Image
+		c.RunConfig.ImageID = ""
+		c.RunConfig.ImageVersion = ""
+		if command.Count > 0 {
+			c.RunConfig.InstanceCount = command.Count
+		}
+		_, err = p.RolloutInstances(commandCtx, retire)
+		return err
+	case DeployActionRollback:
+		_, err := p.RollbackDeploy(commandCtx, command.Image)
+		return err
+	}
+
+	return fmt.Errorf("unsupported deploy action %q", command.Action)
+}
@@ -0,0 +1,135 @@
+package lepton
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeDeployQueue delivers its messages once, one at a time, then stops the
+// consumer
+type fakeDeployQueue struct {
+	messages []QueueMessage
+	acked    []string
+	stop     chan struct{}
+}
+
+func (q *fakeDeployQueue) Receive() (*QueueMessage, error) {
+	if len(q.messages) == 0 {
+		close(q.stop)
+		return nil, nil
+	}
+
+	message := q.messages[0]
+	q.messages = q.messages[1:]
+	return &message, nil
+}
+
+func (q *fakeDeployQueue) Extend(message QueueMessage) error {
+	return nil
+}
+
+func (q *fakeDeployQueue) Ack(message QueueMessage) error {
+	q.acked = append(q.acked, message.ID)
+	return nil
+}
+
+func TestParseDeployCommand(t *testing.T) {
+	command, err := ParseDeployCommand([]byte(`{"action": "scale", "group": "api", "desired": 0}`))
+	if err != nil || command.Group != "api" || *command.Desired != 0 {
+		t.Errorf("unexpected command %+v, %v", command, err)
+	}
+
+	command, err = ParseDeployCommand([]byte(`{"action": "rollout", "image": "api:v2", "count": 2, "retire": ["Image=api"]}`))
+	if err != nil || command.Image != "api:v2" || command.Count != 2 {
+		t.Errorf("unexpected command %+v, %v", command, err)
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"action": "restart"}`,
+		`{"action": "scale", "group": "api"}`,
+		`{"action": "scale", "desired": 2}`,
+		`{"action": "rollback"}`,
+		`{"action": "rollout", "image": "api", "retire": ["Image"]}`,
+	}
+	for _, body := range invalid {
+		if _, err := ParseDeployCommand([]byte(body)); err == nil {
+			t.Errorf("expected %s to be refused", body)
+		}
+	}
+}
+
+func TestConsumeDeployQueue(t *testing.T) {
+	queue := &fakeDeployQueue{
+		messages: []QueueMessage{
+			{ID: "1", Body: []byte(`{"action": "rollback", "image": "api"}`)},
+			{ID: "2", Body: []byte(`{"action": "rollback", "image": "worker"}`)},
+			{ID: "3", Body: []byte(`{"action": "reboot"}`)},
+		},
+		stop: make(chan struct{}),
+	}
+
+	var ran []string
+	consumeDeployQueue(NewContext(NewConfig(), nil), queue, queue.stop, func(message QueueMessage, command *DeployCommand) error {
+		ran = append(ran, command.Image)
+		if command.Image == "worker" {
+			return errors.New("no previous deploy")
+		}
+		return nil
+	})
+
+	if !reflect.DeepEqual(ran, []string{"api", "worker"}) {
+		t.Errorf("unexpected commands run %v", ran)
+	}
+
+	// the failed command is received again, the invalid one never succeeds
+	if !reflect.DeepEqual(queue.acked, []string{"1", "3"}) {
+		t.Errorf("expected messages 1 and 3 to be acknowledged, got %v", queue.acked)
+	}
+}
+
+func TestConsumeDeployQueueAttempts(t *testing.T) {
+	queue := &fakeDeployQueue{
+		messages: []QueueMessage{
+			{ID: "1", Body: []byte(`{"action": "rollback", "image": "api"}`), Attempts: maxDeployAttempts + 1},
+			{ID: "2", Body: []byte(`{"action": "rollback", "image": "worker"}`)},
+		},
+		stop: make(chan struct{}),
+	}
+	for i := 0; i < maxDeployAttempts; i++ {
+		queue.messages = append(queue.messages, queue.messages[1])
+	}
+
+	runs := 0
+	consumeDeployQueue(NewContext(NewConfig(), nil), queue, queue.stop, func(message QueueMessage, command *DeployCommand) error {
+		runs++
+		if command.Image == "api" {
+			t.Error("expected the message received too many times to be dropped")
+		}
+		panic("nil pointer")
+	})
+
+	// the panics are failures counted until the message is dropped
+	if runs != maxDeployAttempts {
+		t.Errorf("expected the command to run %d times, ran %d times", maxDeployAttempts, runs)
+	}
+
+	if !reflect.DeepEqual(queue.acked, []string{"1", "2"}) {
+		t.Errorf("expected messages 1 and 2 to be dropped, got %v", queue.acked)
+	}
+}
+
+func TestQueueDeployID(t *testing.T) {
+	tests := map[string]string{
+		"5fea7756-0ea4-451a-a703-a558b933e274": "5fea7756-0ea4-451a-a703-a558b933e274",
+		"2070443601311540":                     "2070443601311540",
+		"ID/With.Dots":                         "id-with-dots",
+	}
+
+	for id, want := range tests {
+		if got := queueDeployID(id); got != want {
+			t.Errorf("%s: got %q, want %q", id, got, want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/digitalocean/godo"
@@ -41,7 +42,7 @@ func (do *DigitalOcean) BuildImageWithPackage(ctx *Context, pkgpath string) (str
 	return do.customizeImage(ctx)
 }
 
-func (do *DigitalOcean) createImage(key string, bucket string, region string) {
+func (do *DigitalOcean) createImage(ctx *Context, key string, bucket string, region string) error {
 	url := "https://api.digitalocean.com/v2/images"
 
 	objURL := do.Storage.getSignedURL(key, bucket, region)
@@ -52,23 +53,31 @@ func (do *DigitalOcean) createImage(key string, bucket string, region string) {
 		objURL + `", "distribution": "Unknown", "region": "nyc3", "description":
  "` + key + `", "tags":["` + key + `"]}`)
 
-	fmt.Println(string(jsonStr))
+	ctx.logger.Debug("%s", jsonStr)
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonStr))
+	if err != nil {
+		return err
+	}
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer resp.Body.Close()
 
-	fmt.Println("response Status:", resp.Status)
-	fmt.Println("response Headers:", resp.Header)
 	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println("response Body:", string(body))
+	ctx.logger.Debug("response Status: %s", resp.Status)
+	ctx.logger.Debug("response Headers: %v", resp.Header)
+	ctx.logger.Debug("response Body: %s", body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("cannot create image: %s", resp.Status)
+	}
+	return nil
 }
 
 // Initialize DigialOcean related things
@@ -86,17 +95,7 @@ func (do *DigitalOcean) Initialize() error {
 //
 // https://github.com/nanovms/ops/issues/468
 func (do *DigitalOcean) CreateImage(ctx *Context) error {
-	fmt.Println("Sorry - blocked on #468")
-	os.Exit(1)
-
-	c := ctx.config
-	bucket := c.CloudConfig.BucketName
-	key := c.CloudConfig.ImageName + ".img"
-	zone := c.CloudConfig.Zone
-
-	do.createImage(key, bucket, zone)
-
-	return nil
+	return errors.New("image creation is not supported on digital ocean yet, see https://github.com/nanovms/ops/issues/468")
 }
 
 // GetImages return all images on DigitalOcean
@@ -113,7 +112,7 @@ func (do *DigitalOcean) GetImages(ctx *Context) ([]CloudImage, error) {
 		images[i].Status = doImage.Status
 		images[i].Created = doImage.Created
 	}
-	return images, nil
+	return FilterImages(images, ctx.listFilters())
 }
 
 // ListImages lists images on Digital Ocean.
@@ -122,6 +121,7 @@ func (do *DigitalOcean) ListImages(ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	sortImagesByCreated(images)
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Name", "Status", "Created"})
 	table.SetRowLine(true)
@@ -129,7 +129,7 @@ func (do *DigitalOcean) ListImages(ctx *Context) error {
 		var row []string
 		row = append(row, image.Name)
 		row = append(row, image.Status)
-		row = append(row, image.Created)
+		row = append(row, FormatTimestamp(image.Created, ctx.config.RunConfig.TimeFormat))
 		table.Append(row)
 	}
 	table.Render()
@@ -143,8 +143,7 @@ func (do *DigitalOcean) DeleteImage(ctx *Context, imagename string) error {
 
 // SyncImage syncs image from provider to another provider
 func (do *DigitalOcean) SyncImage(config *Config, target Provider, image string) error {
-	fmt.Println("not yet implemented")
-	return nil
+	return errors.New("image sync is not yet implemented")
 }
 
 // ResizeImage is not supported on Digital Ocean.
@@ -162,6 +161,11 @@ func (do *DigitalOcean) GetInstanceByID(ctx *Context, id string) (*CloudInstance
 	return nil, errors.New("un-implemented")
 }
 
+// GetInstanceByName returns the instance with the name passed by argument if it exists
+func (do *DigitalOcean) GetInstanceByName(ctx *Context, name string) (*CloudInstance, error) {
+	return nil, errors.New("un-implemented")
+}
+
 // GetInstances return all instances on DigitalOcean
 // TODO
 func (do *DigitalOcean) GetInstances(ctx *Context) ([]CloudInstance, error) {
@@ -185,7 +189,7 @@ func (do *DigitalOcean) GetInstances(ctx *Context) ([]CloudInstance, error) {
 		}
 	}
 
-	return cinstances, nil
+	return FilterInstances(cinstances, ctx.listFilters())
 }
 
 // ListInstances lists instances on DO
@@ -194,6 +198,7 @@ func (do *DigitalOcean) ListInstances(ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	sortInstancesByCreated(instances)
 	// print list of images in table
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Name", "Id", "Status", "Created", "Private Ips", "Public Ips"})
@@ -210,7 +215,7 @@ func (do *DigitalOcean) ListInstances(ctx *Context) error {
 		rows = append(rows, instance.Name)
 		rows = append(rows, instance.ID)
 		rows = append(rows, instance.Status)
-		rows = append(rows, instance.Created)
+		rows = append(rows, FormatTimestamp(instance.Created, ctx.config.RunConfig.TimeFormat))
 		rows = append(rows, strings.Join(instance.PrivateIps, ","))
 		rows = append(rows, strings.Join(instance.PublicIps, ","))
 
@@ -236,13 +241,62 @@ func (do *DigitalOcean) StopInstance(ctx *Context, instancename string) error {
 	return nil
 }
 
+// dropletID returns the id of the droplet with the id or name passed by
+// argument
+func (do *DigitalOcean) dropletID(instance string) (int, error) {
+	if id, err := strconv.Atoi(instance); err == nil {
+		return id, nil
+	}
+
+	opt := &godo.ListOptions{}
+	for {
+		droplets, resp, err := do.Client.Droplets.List(context.TODO(), opt)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, droplet := range droplets {
+			if droplet.Name == instance {
+				return droplet.ID, nil
+			}
+		}
+
+		if resp.Links == nil || resp.Links.IsLastPage() {
+			break
+		}
+
+		page, err := resp.Links.CurrentPage()
+		if err != nil {
+			return 0, err
+		}
+		opt.Page = page + 1
+	}
+
+	return 0, ErrInstanceNotFound(instance)
+}
+
+// RebootInstance reboots the droplet with the id or name passed by argument
+func (do *DigitalOcean) RebootInstance(ctx *Context, instancename string) error {
+	id, err := do.dropletID(instancename)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = do.Client.DropletActions.Reboot(context.TODO(), id)
+	if err != nil {
+		return fmt.Errorf("reboot droplet %s: %v", instancename, err)
+	}
+
+	return nil
+}
+
 // PrintInstanceLogs writes instance logs to console
 func (do *DigitalOcean) PrintInstanceLogs(ctx *Context, instancename string, watch bool) error {
 	l, err := do.GetInstanceLogs(ctx, instancename)
 	if err != nil {
 		return err
 	}
-	fmt.Printf(l)
+	fmt.Print(l)
 	return nil
 }
 
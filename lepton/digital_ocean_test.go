@@ -62,6 +62,43 @@ func TestDoGetImages(t *testing.T) {
 	}
 }
 
+func TestDoRebootInstance(t *testing.T) {
+	setup()
+	defer teardown()
+	mux.HandleFunc("/v2/droplets", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"droplets": [
+				{"id": 1, "name": "web"},
+				{"id": 2, "name": "api"}
+			],
+			"meta": {
+				"total": 2
+			}
+		}`)
+	})
+
+	var rebooted string
+	mux.HandleFunc("/v2/droplets/2/actions", func(w http.ResponseWriter, r *http.Request) {
+		rebooted = r.URL.Path
+		fmt.Fprint(w, `{"action": {"id": 10, "type": "reboot", "status": "in-progress"}}`)
+	})
+
+	do := &DigitalOcean{
+		Client: client,
+	}
+	err := do.RebootInstance(&Context{}, "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebooted != "/v2/droplets/2/actions" {
+		t.Errorf("expected droplet 2 to be rebooted, got %q", rebooted)
+	}
+
+	if err := do.RebootInstance(&Context{}, "db"); err == nil {
+		t.Error("expected an error for a missing droplet")
+	}
+}
+
 func setup() {
 	mux = http.NewServeMux()
 	server = httptest.NewServer(mux)
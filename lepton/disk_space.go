@@ -0,0 +1,68 @@
+package lepton
+
+import (
+	"fmt"
+	"os"
+)
+
+// imageSpaceSlack is added to the size of the image files to account for the
+// filesystem metadata and log
+const imageSpaceSlack = 64 * 1024 * 1024
+
+// filesSize returns the total size of the host files of a manifest tree.
+// Files that can't be read are skipped, mkfs reports them
+func filesSize(targetRoot string, node map[string]interface{}) int64 {
+	var size int64
+	for _, v := range node {
+		switch value := v.(type) {
+		case string:
+			hostpath, err := lookupFile(targetRoot, value)
+			if err != nil {
+				continue
+			}
+			if fi, err := os.Stat(hostpath); err == nil {
+				size += fi.Size()
+			}
+		case map[string]interface{}:
+			size += filesSize(targetRoot, value)
+		}
+	}
+	return size
+}
+
+// imageSpaceRequired estimates the disk space needed to build the image of
+// the manifest, at least BaseVolumeSz when it is set
+func imageSpaceRequired(c *Config, m *Manifest) (int64, error) {
+	size := filesSize(m.targetRoot, m.children) + filesSize(m.targetRoot, m.boot) + imageSpaceSlack
+
+	if fi, err := os.Stat(c.Boot); err == nil {
+		size += fi.Size()
+	}
+
+	if c.BaseVolumeSz != "" {
+		base, err := ParseBytes(c.BaseVolumeSz)
+		if err != nil {
+			return 0, fmt.Errorf("invalid base volume size %s: %v", c.BaseVolumeSz, err)
+		}
+		if base > size {
+			size = base
+		}
+	}
+
+	return size, nil
+}
+
+// checkFreeSpace returns an error if dir has less than required bytes free
+// to write what. Platforms that can't tell the free space aren't checked
+func checkFreeSpace(dir string, required int64, what string) error {
+	free, err := sysFreeSpace(dir)
+	if err != nil {
+		return nil
+	}
+
+	if free < uint64(required) {
+		return fmt.Errorf("not enough space in %s for %s, %s free and %s required", dir, what, Bytes2Human(int64(free)), Bytes2Human(required))
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package lepton
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestImageSpaceRequired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "space")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	program := path.Join(dir, "program")
+	err = ioutil.WriteFile(program, make([]byte, 1000), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManifest("")
+	m.AddRelative("program", program)
+
+	c := &Config{}
+	size, err := imageSpaceRequired(c, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 1000+imageSpaceSlack {
+		t.Errorf("unexpected size %d", size)
+	}
+
+	c.BaseVolumeSz = "1g"
+	size, err = imageSpaceRequired(c, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 1000*1000*1000 {
+		t.Errorf("unexpected size %d with base volume size", size)
+	}
+
+	if err := checkFreeSpace(dir, 1<<62, "the image"); err == nil {
+		t.Error("expected an error for a huge image")
+	}
+}
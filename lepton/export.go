@@ -0,0 +1,226 @@
+package lepton
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Export formats of the image, instance and volume listings
+const (
+	ExportFormatCSV      = "csv"
+	ExportFormatMarkdown = "markdown" // github flavored markdown table
+	ExportFormatJSON     = "json"     // array of objects keyed by the header
+)
+
+// ValidExportFormat returns an error if format isn't an export format
+func ValidExportFormat(format string) error {
+	if format != ExportFormatCSV && format != ExportFormatMarkdown && format != ExportFormatJSON {
+		return fmt.Errorf("unknown export format %s, expected %s, %s or %s", format, ExportFormatCSV, ExportFormatMarkdown, ExportFormatJSON)
+	}
+	return nil
+}
+
+// ExportTable writes the header and rows to w in the export format
+func ExportTable(w io.Writer, format string, header []string, rows [][]string) error {
+	stream, err := NewExportStream(w, format, header)
+	if err != nil {
+		return err
+	}
+
+	err = stream.Write(rows)
+	if err != nil {
+		return err
+	}
+
+	return stream.Close()
+}
+
+// ExportStream writes a listing in an export format as its rows come, a page
+// at a time, without buffering the rows of large listings
+type ExportStream struct {
+	w      io.Writer
+	format string
+	header []string
+	csv    *csv.Writer
+	rows   int
+}
+
+// NewExportStream starts a listing with the header written to w in the
+// export format
+func NewExportStream(w io.Writer, format string, header []string) (*ExportStream, error) {
+	err := ValidExportFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ExportStream{w: w, format: format, header: header}
+
+	switch format {
+	case ExportFormatCSV:
+		s.csv = csv.NewWriter(w)
+		err = s.csv.Write(header)
+		if err == nil {
+			s.csv.Flush()
+			err = s.csv.Error()
+		}
+	case ExportFormatMarkdown:
+		separator := make([]string, len(header))
+		for i := range separator {
+			separator[i] = "---"
+		}
+		_, err = io.WriteString(w, markdownRow(header)+"\n"+markdownRow(separator)+"\n")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write writes rows of the listing
+func (s *ExportStream) Write(rows [][]string) error {
+	switch s.format {
+	case ExportFormatCSV:
+		return s.csv.WriteAll(rows)
+	case ExportFormatMarkdown:
+		for _, row := range rows {
+			_, err := io.WriteString(s.w, markdownRow(row)+"\n")
+			if err != nil {
+				return err
+			}
+		}
+	case ExportFormatJSON:
+		for _, row := range rows {
+			object := map[string]string{}
+			for j, cell := range row {
+				if j < len(s.header) {
+					object[s.header[j]] = cell
+				}
+			}
+
+			data, err := json.MarshalIndent(object, "  ", "  ")
+			if err != nil {
+				return err
+			}
+
+			separator := ",\n  "
+			if s.rows == 0 {
+				separator = "[\n  "
+			}
+			_, err = io.WriteString(s.w, separator+string(data))
+			if err != nil {
+				return err
+			}
+			s.rows++
+		}
+	}
+	return nil
+}
+
+// Close ends the listing, json arrays being closed
+func (s *ExportStream) Close() error {
+	if s.format != ExportFormatJSON {
+		return nil
+	}
+
+	end := "\n]\n"
+	if s.rows == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(s.w, end)
+	return err
+}
+
+// markdownRow returns the cells as a markdown table row, pipes being escaped
+// and line breaks replaced as they would end the table
+func markdownRow(cells []string) string {
+	escaped := make([]string, len(cells))
+	for i, cell := range cells {
+		cell = strings.Replace(cell, "|", "\\|", -1)
+		cell = strings.Replace(cell, "\r\n", "<br>", -1)
+		escaped[i] = strings.Replace(cell, "\n", "<br>", -1)
+	}
+	return "| " + strings.Join(escaped, " | ") + " |"
+}
+
+// InstancesHeader is the header of the instances listing
+var InstancesHeader = []string{"Name", "Id", "Status", "Created", "Type", "Private Ips", "Public Ips", "IPv6"}
+
+// InstancesTable returns the header and rows of the instances listing, newest
+// first with rfc3339 utc timestamps
+func InstancesTable(instances []CloudInstance) ([]string, [][]string) {
+	header := InstancesHeader
+
+	instances = append([]CloudInstance{}, instances...)
+	sortInstancesByCreated(instances)
+
+	return header, InstanceRows(instances)
+}
+
+// InstanceRows returns the rows of the instances listing in the order of the
+// instances, the rows of the pages of a streamed listing
+func InstanceRows(instances []CloudInstance) [][]string {
+	var rows [][]string
+	for _, instance := range instances {
+		rows = append(rows, []string{
+			instance.Name,
+			instance.ID,
+			instance.Status,
+			normalizeTimestamp(instance.Created),
+			instance.Flavor,
+			strings.Join(instance.PrivateIps, ","),
+			strings.Join(instance.PublicIps, ","),
+			strings.Join(instance.Ipv6Addresses, ","),
+		})
+	}
+	return rows
+}
+
+// ImagesTable returns the header and rows of the images listing, newest first
+// with rfc3339 utc timestamps
+func ImagesTable(images []CloudImage) ([]string, [][]string) {
+	header := []string{"Name", "Id", "Status", "Created"}
+
+	// local images have a path and a size instead of a status
+	var local bool
+	for _, image := range images {
+		local = local || image.Path != ""
+	}
+	if local {
+		header = []string{"Name", "Path", "Size (bytes)", "Created"}
+	}
+
+	images = append([]CloudImage{}, images...)
+	sortImagesByCreated(images)
+
+	var rows [][]string
+	for _, image := range images {
+		if local {
+			rows = append(rows, []string{image.Name, image.Path, strconv.FormatInt(image.Size, 10), normalizeTimestamp(image.Created)})
+			continue
+		}
+		rows = append(rows, []string{image.Name, image.ID, image.Status, normalizeTimestamp(image.Created)})
+	}
+
+	return header, rows
+}
+
+// VolumesTable returns the header and rows of the volumes listing, newest
+// first with rfc3339 utc timestamps
+func VolumesTable(volumes []NanosVolume) ([]string, [][]string) {
+	header := []string{"UUID", "Name", "Status", "Size (GB)", "Location", "Created", "Attached"}
+
+	volumes = append([]NanosVolume{}, volumes...)
+	sortVolumesByCreated(volumes)
+
+	var rows [][]string
+	for _, vol := range volumes {
+		rows = append(rows, []string{vol.ID, vol.Name, vol.Status, vol.Size, vol.Path, normalizeTimestamp(vol.CreatedAt), vol.AttachedTo})
+	}
+
+	return header, rows
+}
@@ -0,0 +1,100 @@
+package lepton
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExportTable(t *testing.T) {
+	header, rows := InstancesTable([]CloudInstance{
+		{Name: "web-1", ID: "i-0123", Status: "running", PrivateIps: []string{"10.0.0.4", "10.0.0.5"}},
+		{Name: "a|b", ID: "i-4567", Status: "stopped"},
+	})
+
+	var b bytes.Buffer
+	err := ExportTable(&b, ExportFormatCSV, header, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Name,Id,Status,Created,Type,Private Ips,Public Ips,IPv6\n" +
+		"web-1,i-0123,running,,,\"10.0.0.4,10.0.0.5\",,\n" +
+		"a|b,i-4567,stopped,,,,,\n"
+	if b.String() != expected {
+		t.Errorf("expected csv\n%s\ngot\n%s", expected, b.String())
+	}
+
+	b.Reset()
+	err = ExportTable(&b, ExportFormatMarkdown, []string{"Name", "Id"}, [][]string{{"a|b", "line\nbreak"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "| Name | Id |\n| --- | --- |\n| a\\|b | line<br>break |\n"
+	if b.String() != expected {
+		t.Errorf("expected markdown\n%s\ngot\n%s", expected, b.String())
+	}
+
+	b.Reset()
+	err = ExportTable(&b, ExportFormatJSON, []string{"Region", "Name"}, [][]string{{"eu-west-1", "web"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = "[\n  {\n    \"Name\": \"web\",\n    \"Region\": \"eu-west-1\"\n  }\n]\n"
+	if b.String() != expected {
+		t.Errorf("expected json\n%s\ngot\n%s", expected, b.String())
+	}
+
+	if err := ExportTable(&b, "xlsx", header, rows); err == nil {
+		t.Error("expected unknown format error")
+	}
+}
+
+func TestExportStream(t *testing.T) {
+	header := []string{"Name", "Id"}
+	rows := [][]string{{"web-1", "i-0123"}, {"web-2", "i-4567"}, {"a|b", "i-89ab"}}
+
+	for _, format := range []string{ExportFormatCSV, ExportFormatMarkdown, ExportFormatJSON} {
+		var table, streamed bytes.Buffer
+		err := ExportTable(&table, format, header, rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stream, err := NewExportStream(&streamed, format, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the rows come a page at a time
+		for _, page := range [][][]string{rows[:2], nil, rows[2:]} {
+			err = stream.Write(page)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = stream.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if streamed.String() != table.String() {
+			t.Errorf("expected streamed %s\n%s\ngot\n%s", format, table.String(), streamed.String())
+		}
+	}
+
+	var b bytes.Buffer
+	stream, err := NewExportStream(&b, ExportFormatJSON, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Close(); err != nil || b.String() != "[]\n" {
+		t.Errorf("expected an empty json array, got %q, %v", b.String(), err)
+	}
+
+	if _, err := NewExportStream(&b, "xlsx", header); err == nil {
+		t.Error("expected unknown format error")
+	}
+}
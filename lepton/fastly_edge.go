@@ -0,0 +1,284 @@
+package lepton
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// fastlyAPI is the base url of the fastly api
+const fastlyAPI = "https://api.fastly.com"
+
+// FastlyEdge deploys wasi modules to Fastly Compute services, which run them
+// on the fastly edge servers
+type FastlyEdge struct {
+	token   string
+	baseURL string
+	client  *http.Client
+}
+
+// NewFastlyEdge returns a fastly edge platform authenticated with the api
+// token passed by argument
+func NewFastlyEdge(token string) *FastlyEdge {
+	return &FastlyEdge{
+		token:   token,
+		baseURL: fastlyAPI,
+		client:  &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+type fastlyVersion struct {
+	Number int  `json:"number"`
+	Active bool `json:"active"`
+	Locked bool `json:"locked"`
+}
+
+type fastlyService struct {
+	ID       string          `json:"id"`
+	Versions []fastlyVersion `json:"versions"`
+}
+
+// errFastlyNotFound is returned by the api calls of missing resources
+var errFastlyNotFound = errors.New("not found")
+
+// do sends a request to the fastly api and decodes its response in result
+func (f *FastlyEdge) do(method string, path string, contentType string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequest(method, f.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Fastly-Key", f.token)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errFastlyNotFound
+	}
+
+	if resp.StatusCode >= 300 {
+		var response struct {
+			Msg    string `json:"msg"`
+			Detail string `json:"detail"`
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(data, &response) != nil || response.Msg == "" {
+			return fmt.Errorf("fastly %s %s: %s", method, path, resp.Status)
+		}
+		return fmt.Errorf("fastly %s %s: %s %s", method, path, response.Msg, response.Detail)
+	}
+
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+
+	return nil
+}
+
+// form sends the form values to the fastly api
+func (f *FastlyEdge) form(method string, path string, values url.Values, result interface{}) error {
+	return f.do(method, path, "application/x-www-form-urlencoded", strings.NewReader(values.Encode()), result)
+}
+
+// service returns the wasm service with the name, created if missing
+func (f *FastlyEdge) service(name string) (*fastlyService, error) {
+	service := &fastlyService{}
+	err := f.do("GET", "/service/search?name="+url.QueryEscape(name), "", nil, service)
+	if err == nil {
+		return service, nil
+	}
+	if err != errFastlyNotFound {
+		return nil, err
+	}
+
+	err = f.form("POST", "/service", url.Values{"name": {name}, "type": {"wasm"}}, service)
+	if err != nil {
+		return nil, fmt.Errorf("create service %s: %v", name, err)
+	}
+	return service, nil
+}
+
+// editableVersion returns the latest version of the service if it was never
+// activated, otherwise a clone of it to deploy to
+func (f *FastlyEdge) editableVersion(service *fastlyService) (int, error) {
+	var latest *fastlyVersion
+	for i := range service.Versions {
+		if latest == nil || service.Versions[i].Number > latest.Number {
+			latest = &service.Versions[i]
+		}
+	}
+	if latest == nil {
+		return 0, fmt.Errorf("service %s has no version", service.ID)
+	}
+
+	if !latest.Active && !latest.Locked {
+		return latest.Number, nil
+	}
+
+	var clone fastlyVersion
+	err := f.do("PUT", fmt.Sprintf("/service/%s/version/%d/clone", service.ID, latest.Number), "", nil, &clone)
+	if err != nil {
+		return 0, fmt.Errorf("clone version %d of service %s: %v", latest.Number, service.ID, err)
+	}
+	return clone.Number, nil
+}
+
+// ensureDomains adds the domain names missing from the version
+func (f *FastlyEdge) ensureDomains(serviceID string, version int, names []string) error {
+	versionPath := fmt.Sprintf("/service/%s/version/%d/domain", serviceID, version)
+
+	var domains []struct {
+		Name string `json:"name"`
+	}
+	err := f.do("GET", versionPath, "", nil, &domains)
+	if err != nil {
+		return err
+	}
+
+	existing := map[string]bool{}
+	for _, domain := range domains {
+		existing[domain.Name] = true
+	}
+
+	for _, name := range names {
+		if existing[name] {
+			continue
+		}
+
+		err = f.form("POST", versionPath, url.Values{"name": {name}}, nil)
+		if err != nil {
+			return fmt.Errorf("add domain %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// writeEdgePackage writes the compute package of the module, the gzip'd tar
+// of its manifest and the module as bin/main.wasm
+func writeEdgePackage(w io.Writer, name string, module []byte) error {
+	manifest := fmt.Sprintf("manifest_version = 2\nname = %q\nlanguage = \"other\"\n", name)
+
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{name + "/fastly.toml", []byte(manifest)},
+		{name + "/bin/main.wasm", module},
+	} {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    file.name,
+			Mode:    0644,
+			Size:    int64(len(file.data)),
+			ModTime: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+// uploadPackage uploads the compute package of the module to the version
+func (f *FastlyEdge) uploadPackage(serviceID string, version int, name string, module []byte) error {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	part, err := mw.CreateFormFile("package", name+".tar.gz")
+	if err != nil {
+		return err
+	}
+	if err := writeEdgePackage(part, name, module); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	return f.do("PUT", fmt.Sprintf("/service/%s/version/%d/package", serviceID, version), mw.FormDataContentType(), &body, nil)
+}
+
+// DeployModule deploys the wasi module to the compute service of the config
+// image name, created if missing, serving the domain names of the config or
+// its edgecompute.app domain if none is configured. The module is uploaded to
+// a new version of the service, which is activated once it's complete. The
+// environment and arguments of the config can't be passed to edge modules
+func (f *FastlyEdge) DeployModule(ctx *Context, modulePath string) error {
+	c := ctx.config
+
+	name := c.CloudConfig.ImageName
+	if name == "" {
+		return errors.New("no image name to name the edge service")
+	}
+
+	if len(c.Env) > 0 || len(c.Args) > 0 {
+		ctx.logger.Warn("the env and args of the config are not passed to edge modules")
+	}
+
+	module, err := ioutil.ReadFile(modulePath)
+	if err != nil {
+		return err
+	}
+
+	names := domainNames(c)
+	if len(names) == 0 {
+		names = []string{name + ".edgecompute.app"}
+	}
+
+	service, err := f.service(name)
+	if err != nil {
+		return err
+	}
+
+	version, err := f.editableVersion(service)
+	if err != nil {
+		return err
+	}
+
+	err = f.ensureDomains(service.ID, version, names)
+	if err != nil {
+		return err
+	}
+
+	ctx.logger.Info("uploading %s to version %d of service %s", modulePath, version, name)
+	err = f.uploadPackage(service.ID, version, name, module)
+	if err != nil {
+		return fmt.Errorf("upload package of %s: %v", modulePath, err)
+	}
+	ctx.recordUpload(int64(len(module)))
+
+	err = f.do("PUT", fmt.Sprintf("/service/%s/version/%d/activate", service.ID, version), "", nil, nil)
+	if err != nil {
+		return fmt.Errorf("activate version %d of service %s: %v", version, name, err)
+	}
+
+	ctx.logger.Info("service %s version %d is serving %s", name, version, strings.Join(names, ", "))
+	return nil
+}
@@ -0,0 +1,170 @@
+package lepton
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFastlyDeployModule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "edge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	module := append([]byte{0, 'a', 's', 'm', 1, 0, 0, 0}, []byte("module")...)
+	modulePath := filepath.Join(dir, "api.wasm")
+	if err := ioutil.WriteFile(modulePath, module, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	var packaged map[string]string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/service/search", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"msg": "Record not found"}`)
+	})
+	mux.HandleFunc("/service", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Fastly-Key") != "token" {
+			t.Errorf("unexpected token %q", r.Header.Get("Fastly-Key"))
+		}
+		r.ParseForm()
+		calls = append(calls, "create "+r.Form.Get("name")+" "+r.Form.Get("type"))
+		fmt.Fprint(w, `{"id": "svc1", "versions": [{"number": 1}]}`)
+	})
+	mux.HandleFunc("/service/svc1/version/1/domain", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		r.ParseForm()
+		calls = append(calls, "domain "+r.Form.Get("name"))
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/service/svc1/version/1/package", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "package")
+
+		file, _, err := r.FormFile("package")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gzr, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gzr)
+
+		packaged = map[string]string{}
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				break
+			}
+			data, _ := ioutil.ReadAll(tr)
+			packaged[hdr.Name] = string(data)
+		}
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/service/svc1/version/1/activate", func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, "activate")
+		fmt.Fprint(w, `{}`)
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	edge := NewFastlyEdge("token")
+	edge.baseURL = server.URL
+
+	config := NewConfig()
+	config.CloudConfig.ImageName = "api"
+
+	err = edge.DeployModule(NewContext(config, nil), modulePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(calls) != "[create api wasm domain api.edgecompute.app package activate]" {
+		t.Errorf("unexpected calls %v", calls)
+	}
+
+	if packaged["api/bin/main.wasm"] != string(module) {
+		t.Error("expected the module in the package")
+	}
+	if packaged["api/fastly.toml"] == "" {
+		t.Error("expected the manifest in the package")
+	}
+}
+
+func TestFastlyEditableVersion(t *testing.T) {
+	var cloned string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cloned = r.URL.Path
+		fmt.Fprint(w, `{"number": 4}`)
+	}))
+	defer server.Close()
+
+	edge := NewFastlyEdge("token")
+	edge.baseURL = server.URL
+
+	// the active version is cloned
+	version, err := edge.editableVersion(&fastlyService{ID: "svc1", Versions: []fastlyVersion{
+		{Number: 2, Locked: true}, {Number: 3, Active: true, Locked: true}, {Number: 1, Locked: true},
+	}})
+	if err != nil || version != 4 || cloned != "/service/svc1/version/3/clone" {
+		t.Errorf("got version %d cloned from %q, %v", version, cloned, err)
+	}
+
+	// a draft version is deployed to
+	cloned = ""
+	version, err = edge.editableVersion(&fastlyService{ID: "svc1", Versions: []fastlyVersion{
+		{Number: 1, Active: true, Locked: true}, {Number: 2},
+	}})
+	if err != nil || version != 2 || cloned != "" {
+		t.Errorf("got version %d cloned from %q, %v", version, cloned, err)
+	}
+}
+
+func TestBuildWasmModule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	modulePath := filepath.Join(dir, "api.wasm")
+	if err := ioutil.WriteFile(modulePath, []byte{0, 'a', 's', 'm', 1, 0, 0, 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	elfPath := filepath.Join(dir, "api")
+	if err := ioutil.WriteFile(elfPath, []byte{0x7f, 'E', 'L', 'F'}, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	config := NewConfig()
+	config.Program = modulePath
+	module, err := BuildWasmModule(config)
+	if err != nil || module != modulePath {
+		t.Errorf("expected the module itself, got %q, %v", module, err)
+	}
+
+	config.Program = elfPath
+	if _, err := BuildWasmModule(config); err == nil {
+		t.Error("expected an ELF program to be rejected")
+	}
+
+	// a directory without a Go or Rust program
+	config.Program = dir
+	if _, err := BuildWasmModule(config); err == nil {
+		t.Error("expected a directory without sources to be rejected")
+	}
+}
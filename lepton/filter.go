@@ -0,0 +1,100 @@
+package lepton
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ListFilter selects instances or images by the value of a tag, the value
+// may contain shell wildcards like api-*. The status key selects by state
+type ListFilter struct {
+	Key   string
+	Value string
+}
+
+// ParseListFilters parses filters in the form key=value
+func ParseListFilters(filters []string) ([]ListFilter, error) {
+	var parsed []ListFilter
+
+	for _, filter := range filters {
+		kv := strings.SplitN(filter, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid filter %q, expected key=value", filter)
+		}
+
+		_, err := path.Match(kv[1], "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter %q: %v", filter, err)
+		}
+
+		parsed = append(parsed, ListFilter{Key: kv[0], Value: kv[1]})
+	}
+
+	return parsed, nil
+}
+
+// matchFilters returns true if name and status match all filters. Only the
+// Name and status keys are supported as they are known for every provider
+func matchFilters(name string, status string, filters []ListFilter) (bool, error) {
+	for _, filter := range filters {
+		var value string
+		switch filter.Key {
+		case "Name":
+			value = name
+		case "status":
+			value = strings.ToLower(status)
+		default:
+			return false, fmt.Errorf("filter by %s not supported, only Name and status filters are supported", filter.Key)
+		}
+
+		ok, _ := path.Match(filter.Value, value)
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// FilterInstances returns the instances matching all filters
+func FilterInstances(instances []CloudInstance, filters []ListFilter) ([]CloudInstance, error) {
+	if len(filters) == 0 {
+		return instances, nil
+	}
+
+	var matched []CloudInstance
+	for _, instance := range instances {
+		ok, err := matchFilters(instance.Name, instance.Status, filters)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			matched = append(matched, instance)
+		}
+	}
+
+	return matched, nil
+}
+
+// FilterImages returns the images matching all filters
+func FilterImages(images []CloudImage, filters []ListFilter) ([]CloudImage, error) {
+	if len(filters) == 0 {
+		return images, nil
+	}
+
+	var matched []CloudImage
+	for _, image := range images {
+		ok, err := matchFilters(image.Name, image.Status, filters)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			matched = append(matched, image)
+		}
+	}
+
+	return matched, nil
+}
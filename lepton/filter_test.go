@@ -0,0 +1,42 @@
+package lepton
+
+import "testing"
+
+func TestFilterInstances(t *testing.T) {
+	instances := []CloudInstance{
+		{ID: "1", Name: "api-1", Status: "running"},
+		{ID: "2", Name: "api-2", Status: "stopped"},
+		{ID: "3", Name: "worker-1", Status: "running"},
+	}
+
+	filters, err := ParseListFilters([]string{"Name=api-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matched, err := FilterInstances(instances, filters)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matched) != 2 || matched[0].ID != "1" || matched[1].ID != "2" {
+		t.Errorf("got %v, want instances 1 and 2", matched)
+	}
+
+	_, err = ParseListFilters([]string{"Name"})
+	if err == nil {
+		t.Error("expected error parsing filter without value")
+	}
+
+	filters, _ = ParseListFilters([]string{"Name=api-*", "status=running"})
+	matched, _ = FilterInstances(instances, filters)
+	if len(matched) != 1 || matched[0].ID != "1" {
+		t.Errorf("got %v, want instance 1", matched)
+	}
+
+	filters, _ = ParseListFilters([]string{"env=prod"})
+	_, err = FilterInstances(instances, filters)
+	if err == nil {
+		t.Error("expected error filtering by unsupported key")
+	}
+}
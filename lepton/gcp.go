@@ -2,13 +2,16 @@ package lepton
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -139,34 +142,19 @@ func (p *GCloud) pollOperation(ctx context.Context, projectID string, service *c
 	return nil
 }
 
+// customizeImage returns the raw disk image, which is archived while it is
+// streamed to the bucket
 func (p *GCloud) customizeImage(ctx *Context) (string, error) {
-	imagePath := ctx.config.RunConfig.Imagename
-	symlink := filepath.Join(filepath.Dir(imagePath), "disk.raw")
-
-	if _, err := os.Lstat(symlink); err == nil {
-		if err := os.Remove(symlink); err != nil {
-			return "", fmt.Errorf("failed to unlink: %+v", err)
-		}
-	}
-
-	err := os.Link(imagePath, symlink)
-	if err != nil {
-		return "", err
-	}
-
-	archPath := filepath.Join(filepath.Dir(imagePath), p.getArchiveName(ctx))
-	files := []string{symlink}
-
-	err = createArchive(archPath, files)
-	if err != nil {
-		return "", err
-	}
-	return archPath, nil
+	return ctx.config.RunConfig.Imagename, nil
 }
 
 // BuildImage to be upload on GCP
 func (p *GCloud) BuildImage(ctx *Context) (string, error) {
 	c := ctx.config
+	if _, err := gcpGuestOSFeatures(c.CloudConfig.GuestOSFeatures); err != nil {
+		return "", err
+	}
+
 	err := BuildImage(*c)
 	if err != nil {
 		return "", err
@@ -178,6 +166,10 @@ func (p *GCloud) BuildImage(ctx *Context) (string, error) {
 // BuildImageWithPackage to upload on GCP
 func (p *GCloud) BuildImageWithPackage(ctx *Context, pkgpath string) (string, error) {
 	c := ctx.config
+	if _, err := gcpGuestOSFeatures(c.CloudConfig.GuestOSFeatures); err != nil {
+		return "", err
+	}
+
 	err := BuildImageFromPackage(pkgpath, *c)
 	if err != nil {
 		return "", err
@@ -222,8 +214,16 @@ func (p *GCloud) CreateImage(ctx *Context) error {
 	sourceURL := fmt.Sprintf(GCPStorageURL,
 		c.CloudConfig.BucketName, p.getArchiveName(ctx))
 
+	features, err := gcpGuestOSFeatures(c.CloudConfig.GuestOSFeatures)
+	if err != nil {
+		return err
+	}
+
 	rb := &compute.Image{
-		Name: c.CloudConfig.ImageName,
+		Name:            c.CloudConfig.ImageName,
+		Description:     imageDescription(c),
+		Labels:          gcpDefaultLabels(c, gcpImageLabels(c)),
+		GuestOsFeatures: features,
 		RawDisk: &compute.ImageRawDisk{
 			Source: sourceURL,
 		},
@@ -233,12 +233,13 @@ func (p *GCloud) CreateImage(ctx *Context) error {
 	if err != nil {
 		return fmt.Errorf("error:%+v", err)
 	}
-	fmt.Printf("Image creation started. Monitoring operation %s.\n", op.Name)
+	ctx.logger.Log("Image creation started. Monitoring operation %s.", op.Name)
 	err = p.pollOperation(context, c.CloudConfig.ProjectID, p.Service, *op)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Image creation succeeded %s.\n", c.CloudConfig.ImageName)
+	ctx.logger.Log("Image creation succeeded %s.", c.CloudConfig.ImageName)
+	ctx.recordCreated("image", c.CloudConfig.ImageName)
 	return nil
 }
 
@@ -274,7 +275,11 @@ func (p *GCloud) GetImages(ctx *Context) ([]CloudImage, error) {
 		return nil
 	})
 
-	return images, err
+	if err != nil {
+		return nil, err
+	}
+
+	return FilterImages(images, ctx.listFilters())
 
 }
 
@@ -284,6 +289,7 @@ func (p *GCloud) ListImages(ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	sortImagesByCreated(images)
 
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Name", "Status", "Created"})
@@ -297,7 +303,7 @@ func (p *GCloud) ListImages(ctx *Context) error {
 		var row []string
 		row = append(row, image.Name)
 		row = append(row, image.Status)
-		row = append(row, image.Created)
+		row = append(row, FormatTimestamp(image.Created, ctx.config.RunConfig.TimeFormat))
 		table.Append(row)
 	}
 
@@ -328,14 +334,14 @@ func (p *GCloud) DeleteImage(ctx *Context, imagename string) error {
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Image deletion succeeded %s.\n", imagename)
+	ctx.logger.Log("Image deletion succeeded %s.", imagename)
+	ctx.recordDeleted("image", imagename)
 	return nil
 }
 
 // SyncImage syncs image from provider to another provider
 func (p *GCloud) SyncImage(config *Config, target Provider, image string) error {
-	fmt.Println("not yet implemented")
-	return nil
+	return errors.New("image sync is not yet implemented")
 }
 
 // CreateInstance - Creates instance on Google Cloud Platform
@@ -352,7 +358,7 @@ func (p *GCloud) CreateInstance(ctx *Context) error {
 	}
 
 	if c.CloudConfig.ProjectID == "" {
-		fmt.Printf("ProjectId not provided in config.CloudConfig. Using %s from default credentials.", creds.ProjectID)
+		ctx.logger.Log("ProjectId not provided in config.CloudConfig. Using %s from default credentials.", creds.ProjectID)
 		c.CloudConfig.ProjectID = creds.ProjectID
 	}
 
@@ -370,7 +376,6 @@ func (p *GCloud) CreateInstance(ctx *Context) error {
 		return err
 	}
 
-	machineType := fmt.Sprintf("zones/%s/machineTypes/%s", c.CloudConfig.Zone, c.CloudConfig.Flavor)
 	instanceName := fmt.Sprintf("%v-%v",
 		filepath.Base(c.CloudConfig.ImageName),
 		strconv.FormatInt(time.Now().Unix(), 10),
@@ -380,11 +385,16 @@ func (p *GCloud) CreateInstance(ctx *Context) error {
 		c.CloudConfig.ProjectID,
 		c.CloudConfig.ImageName)
 
+	networkTags, err := gcpNetworkTags(c, instanceName)
+	if err != nil {
+		return err
+	}
+
 	serialTrue := "true"
 
 	rb := &compute.Instance{
-		Name:        instanceName,
-		MachineType: machineType,
+		Name:   instanceName,
+		Labels: gcpDefaultLabels(c, gcpInstanceLabels(c)),
 		Disks: []*compute.AttachedDisk{
 			{
 				AutoDelete: true,
@@ -392,12 +402,15 @@ func (p *GCloud) CreateInstance(ctx *Context) error {
 				Type:       "PERSISTENT",
 				InitializeParams: &compute.AttachedDiskInitializeParams{
 					SourceImage: imageName,
+					Labels:      gcpDefaultLabels(c, gcpInstanceLabels(c)),
 				},
 			},
 		},
 		NetworkInterfaces: []*compute.NetworkInterface{
 			{
-				Name: "eth0",
+				Name:       "eth0",
+				Network:    gcpNetwork(c),
+				Subnetwork: gcpSubnetwork(c),
 				AccessConfigs: []*compute.AccessConfig{
 					{
 						NetworkTier: "PREMIUM",
@@ -408,61 +421,112 @@ func (p *GCloud) CreateInstance(ctx *Context) error {
 			},
 		},
 		Metadata: &compute.Metadata{
-			Items: []*compute.MetadataItems{
+			Items: append([]*compute.MetadataItems{
 				{
 					Key:   "serial-port-enable",
 					Value: &serialTrue,
 				},
-			},
+			}, p.runConfigMetadata(ctx)...),
 		},
 		Tags: &compute.Tags{
-			Items: []string{instanceName},
+			Items: networkTags,
 		},
+		ServiceAccounts: gcpServiceAccounts(c),
 	}
-	op, err := computeService.Instances.Insert(c.CloudConfig.ProjectID, c.CloudConfig.Zone, rb).Context(context).Do()
-	if err != nil {
-		return err
+
+	// the subnetwork is regional, instances are launched in the other zones
+	// of the region if the zone has no resources left for the machine type
+	otherZones := func() ([]string, error) {
+		return p.regionZones(context, computeService, c.CloudConfig.ProjectID, gcpRegion(c.CloudConfig.Zone))
 	}
-	fmt.Printf("Instance creation started using image %s. Monitoring operation %s.\n", imageName, op.Name)
-	err = p.pollOperation(context, c.CloudConfig.ProjectID, computeService, *op)
+
+	zone, err := retryInZones(ctx, c.CloudConfig.Zone, otherZones, gcpCapacityExhausted, func(zone string) error {
+		rb.MachineType = fmt.Sprintf("zones/%s/machineTypes/%s", zone, c.CloudConfig.Flavor)
+
+		op, err := computeService.Instances.Insert(c.CloudConfig.ProjectID, zone, rb).Context(context).Do()
+		if err != nil {
+			return err
+		}
+		ctx.logger.Log("Instance creation started using image %s. Monitoring operation %s.", imageName, op.Name)
+		return p.pollOperation(context, c.CloudConfig.ProjectID, computeService, *op)
+	})
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Instance creation succeeded %s.\n", instanceName)
+	ctx.logger.Log("Instance creation succeeded %s.", instanceName)
+	ctx.recordCreated("instance", instanceName)
+	ctx.recordInstanceCost(c.CloudConfig.Flavor, 1)
+
+	// the instance is looked up in the zone it was launched in
+	c.CloudConfig.Zone = zone
+
+	if c.RunConfig.Wait {
+		err = WaitInstancesReady(ctx, p, []string{instanceName})
+		if err != nil {
+			return err
+		}
+	}
 
 	// create dns zones/records to associate DNS record to instance IP
-	if c.RunConfig.DomainName != "" {
+	if hasDomainNames(c) {
 		instance, err := computeService.Instances.Get(c.CloudConfig.ProjectID, c.CloudConfig.Zone, instanceName).Do()
 		if err != nil {
 			return err
 		}
 
-		cinstance := p.convertToCloudInstance(instance)
+		values, err := gcpDNSRecordValues(ctx.config, p.convertToCloudInstance(instance))
+		if err != nil {
+			return err
+		}
 
-		if len(cinstance.PublicIps) != 0 {
-			err := CreateDNSRecord(ctx.config, cinstance.PublicIps[0], p)
+		if len(values) != 0 {
+			err := CreateDNSRecords(ctx.config, values, p)
 			if err != nil {
 				return err
 			}
+		} else {
+			ctx.logger.Warn("instance %s has no address to create DNS records for", instanceName)
 		}
 	}
 
-	// create firewall rules to expose instance ports
-	if len(ctx.config.RunConfig.Ports) != 0 {
-		rule := p.buildFirewallRule("tcp", ctx.config.RunConfig.Ports, instanceName)
-
-		_, err = computeService.Firewalls.Insert(c.CloudConfig.ProjectID, rule).Context(context).Do()
+	// create firewall rules to expose instance ports, in the network of the
+	// instance and its project, the host project of a shared vpc
+	sources := allowedSources(ctx.config)
 
+	network := ""
+	firewallProject := c.CloudConfig.ProjectID
+	if c.RunConfig.VPC != "" || c.RunConfig.Subnet != "" {
+		instance, err := computeService.Instances.Get(c.CloudConfig.ProjectID, c.CloudConfig.Zone, instanceName).Do()
 		if err != nil {
-			ctx.logger.Error("%v", err)
-			return errors.New("Failed to add Firewall rule")
+			return err
+		}
+
+		if len(instance.NetworkInterfaces) > 0 {
+			network = instance.NetworkInterfaces[0].Network
+			firewallProject = gcpResourceProject(network, firewallProject)
 		}
 	}
 
+	tcpPorts := intsToStrings(ctx.config.RunConfig.Ports)
+	for _, portRange := range ctx.config.RunConfig.PortRanges {
+		if _, _, err := ParsePortRange(portRange); err != nil {
+			return err
+		}
+		tcpPorts = append(tcpPorts, portRange)
+	}
+
+	var rules []*compute.Firewall
+	if len(tcpPorts) != 0 {
+		rules = append(rules, p.buildFirewallRules("tcp", tcpPorts, instanceName, sources)...)
+	}
 	if len(ctx.config.RunConfig.UDPPorts) != 0 {
-		rule := p.buildFirewallRule("udp", ctx.config.RunConfig.UDPPorts, instanceName)
+		rules = append(rules, p.buildFirewallRules("udp", intsToStrings(ctx.config.RunConfig.UDPPorts), instanceName, sources)...)
+	}
 
-		_, err = computeService.Firewalls.Insert(c.CloudConfig.ProjectID, rule).Context(context).Do()
+	for _, rule := range rules {
+		rule.Network = network
+
+		_, err = computeService.Firewalls.Insert(firewallProject, rule).Context(context).Do()
 
 		if err != nil {
 			ctx.logger.Error("%v", err)
@@ -473,24 +537,62 @@ func (p *GCloud) CreateInstance(ctx *Context) error {
 	return nil
 }
 
-func (p *GCloud) buildFirewallRule(protocol string, ports []int, tag string) *compute.Firewall {
-	var portsStr []string
-	for _, i := range ports {
-		portsStr = append(portsStr, strconv.Itoa(i))
+// regionZones returns the names of the zones of the region that are up
+func (p *GCloud) regionZones(ctx context.Context, computeService *compute.Service, projectID string, region string) ([]string, error) {
+	var zones []string
+	err := computeService.Zones.List(projectID).Filter(fmt.Sprintf("region eq .*/regions/%s", region)).Pages(ctx, func(page *compute.ZoneList) error {
+		for _, zone := range page.Items {
+			if zone.Status == "UP" {
+				zones = append(zones, zone.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list zones of %s: %v", region, err)
 	}
 
-	return &compute.Firewall{
-		Name:        fmt.Sprintf("ops-%s-rule-%s", protocol, tag),
-		Description: fmt.Sprintf("Allow traffic to %v ports %s", arrayToString(ports, "[]"), tag),
-		Allowed: []*compute.FirewallAllowed{
-			{
-				IPProtocol: protocol,
-				Ports:      portsStr,
+	sort.Strings(zones)
+	return zones, nil
+}
+
+// gcpFirewallRuleNames returns the names of the firewall rules of the
+// protocol ops creates for the tag, the ipv4 and the ipv6 one
+func gcpFirewallRuleNames(protocol string, tag string) (string, string) {
+	name := fmt.Sprintf("ops-%s-rule-%s", protocol, tag)
+	return name, name + "-ipv6"
+}
+
+// buildFirewallRules returns the firewall rules allowing the sources to reach
+// the ports of the instances with the tag, one per address family as a rule
+// can't mix ipv4 and ipv6 source ranges
+func (p *GCloud) buildFirewallRules(protocol string, ports []string, tag string, sources []string) []*compute.Firewall {
+	ipv4Name, ipv6Name := gcpFirewallRuleNames(protocol, tag)
+	ipv4, ipv6 := sourcesByFamily(sources)
+
+	var rules []*compute.Firewall
+	for _, family := range []struct {
+		name    string
+		sources []string
+	}{{ipv4Name, ipv4}, {ipv6Name, ipv6}} {
+		if len(family.sources) == 0 {
+			continue
+		}
+
+		rules = append(rules, &compute.Firewall{
+			Name:        family.name,
+			Description: fmt.Sprintf("Allow traffic to %v ports %s", strings.Join(ports, ","), tag),
+			Allowed: []*compute.FirewallAllowed{
+				{
+					IPProtocol: protocol,
+					Ports:      ports,
+				},
 			},
-		},
-		TargetTags:   []string{tag},
-		SourceRanges: []string{"0.0.0.0/0"},
+			TargetTags:   []string{tag},
+			SourceRanges: family.sources,
+		})
 	}
+	return rules
 }
 
 // ListInstances lists instances on Gcloud
@@ -499,6 +601,7 @@ func (p *GCloud) ListInstances(ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	sortInstancesByCreated(instances)
 
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Name", "Status", "Created", "Private Ips", "Public Ips"})
@@ -514,7 +617,7 @@ func (p *GCloud) ListInstances(ctx *Context) error {
 		var rows []string
 		rows = append(rows, instance.Name)
 		rows = append(rows, instance.Status)
-		rows = append(rows, instance.Created)
+		rows = append(rows, FormatTimestamp(instance.Created, ctx.config.RunConfig.TimeFormat))
 		rows = append(rows, strings.Join(instance.PrivateIps, ","))
 		rows = append(rows, strings.Join(instance.PublicIps, ","))
 		table.Append(rows)
@@ -523,9 +626,29 @@ func (p *GCloud) ListInstances(ctx *Context) error {
 	return nil
 }
 
-// GetInstanceByID returns the instance with the id passed by argument if it exists
+// GetInstanceByID returns the instance with the numeric id passed by argument
+// if it exists. Ids that aren't numeric, or match no instance, are looked up
+// as instance names
 func (p *GCloud) GetInstanceByID(ctx *Context, id string) (*CloudInstance, error) {
-	req := p.Service.Instances.Get(ctx.config.CloudConfig.ProjectID, ctx.config.CloudConfig.Zone, id)
+	if _, err := strconv.ParseUint(id, 10, 64); err == nil {
+		req := p.Service.Instances.List(ctx.config.CloudConfig.ProjectID, ctx.config.CloudConfig.Zone).Filter("id = " + id)
+
+		result, err := req.Do()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(result.Items) != 0 {
+			return p.convertToCloudInstance(result.Items[0]), nil
+		}
+	}
+
+	return p.GetInstanceByName(ctx, id)
+}
+
+// GetInstanceByName returns the instance with the name passed by argument if it exists
+func (p *GCloud) GetInstanceByName(ctx *Context, name string) (*CloudInstance, error) {
+	req := p.Service.Instances.Get(ctx.config.CloudConfig.ProjectID, ctx.config.CloudConfig.Zone, name)
 
 	instance, err := req.Do()
 	if err != nil {
@@ -553,7 +676,27 @@ func (p *GCloud) GetInstances(ctx *Context) ([]CloudInstance, error) {
 		return nil, err
 	}
 
-	return cinstances, nil
+	return FilterInstances(cinstances, ctx.listFilters())
+}
+
+// EachInstancePage calls fn with the pages of the instances of the zone
+// matching the list filters of the config
+func (p *GCloud) EachInstancePage(ctx *Context, fn InstancePageFunc) error {
+	req := p.Service.Instances.List(ctx.config.CloudConfig.ProjectID, ctx.config.CloudConfig.Zone).MaxResults(instancePageSize)
+
+	return req.Pages(context.TODO(), func(list *compute.InstanceList) error {
+		var page []CloudInstance
+		for _, instance := range list.Items {
+			page = append(page, *p.convertToCloudInstance(instance))
+		}
+
+		page, err := FilterInstances(page, ctx.listFilters())
+		if err != nil || len(page) == 0 {
+			return err
+		}
+
+		return fn(page)
+	})
 }
 
 func (p *GCloud) convertToCloudInstance(instance *compute.Instance) *CloudInstance {
@@ -573,6 +716,7 @@ func (p *GCloud) convertToCloudInstance(instance *compute.Instance) *CloudInstan
 	}
 
 	return &CloudInstance{
+		ID:         strconv.FormatUint(instance.Id, 10),
 		Name:       instance.Name,
 		Status:     instance.Status,
 		Created:    instance.CreationTimestamp,
@@ -585,19 +729,34 @@ func (p *GCloud) convertToCloudInstance(instance *compute.Instance) *CloudInstan
 func (p *GCloud) DeleteInstance(ctx *Context, instancename string) error {
 	context := context.TODO()
 	cloudConfig := ctx.config.CloudConfig
+
+	// the machine type prices the instance in the operation summary
+	var machineType string
+	if instance, err := p.Service.Instances.Get(cloudConfig.ProjectID, cloudConfig.Zone, instancename).Context(context).Do(); err == nil {
+		machineType = path.Base(instance.MachineType)
+	}
+
 	op, err := p.Service.Instances.Delete(cloudConfig.ProjectID, cloudConfig.Zone, instancename).Context(context).Do()
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Instance deletion started. Monitoring operation %s.\n", op.Name)
+	ctx.logger.Log("Instance deletion started. Monitoring operation %s.", op.Name)
 	err = p.pollOperation(context, cloudConfig.ProjectID, p.Service, *op)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Instance deletion succeeded %s.\n", instancename)
+	ctx.logger.Log("Instance deletion succeeded %s.", instancename)
+	ctx.recordDeleted("instance", instancename)
+	ctx.recordInstanceCost(machineType, -1)
 	return nil
 }
 
+// RecordsResources returns true, the instances and images created and
+// deleted are recorded in the operation summary
+func (p *GCloud) RecordsResources() bool {
+	return true
+}
+
 // StartInstance starts an instance in GCloud
 func (p *GCloud) StartInstance(ctx *Context, instancename string) error {
 
@@ -609,13 +768,13 @@ func (p *GCloud) StartInstance(ctx *Context, instancename string) error {
 		return err
 	}
 
-	fmt.Printf("Instance started. Monitoring operation %s.\n", op.Name)
+	ctx.logger.Log("Instance started. Monitoring operation %s.", op.Name)
 	err = p.pollOperation(context, cloudConfig.ProjectID, p.Service, *op)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Instance started %s.\n", instancename)
+	ctx.logger.Log("Instance started %s.", instancename)
 	return nil
 
 }
@@ -630,13 +789,13 @@ func (p *GCloud) StopInstance(ctx *Context, instancename string) error {
 		return err
 	}
 
-	fmt.Printf("Instance stopping started. Monitoring operation %s.\n", op.Name)
+	ctx.logger.Log("Instance stopping started. Monitoring operation %s.", op.Name)
 	err = p.pollOperation(context, cloudConfig.ProjectID, p.Service, *op)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Instance stop succeeded %s.\n", instancename)
+	ctx.logger.Log("Instance stop succeeded %s.", instancename)
 	return nil
 }
 
@@ -650,45 +809,53 @@ func (p *GCloud) ResetInstance(ctx *Context, instancename string) error {
 		return err
 	}
 
-	fmt.Printf("Instance reseting started. Monitoring operation %s.\n", op.Name)
+	ctx.logger.Log("Instance reseting started. Monitoring operation %s.", op.Name)
 	err = p.pollOperation(context, cloudConfig.ProjectID, p.Service, *op)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Instance reseting succeeded %s.\n", instancename)
+	ctx.logger.Log("Instance reseting succeeded %s.", instancename)
 	return nil
 }
 
-// PrintInstanceLogs writes instance logs to console
+// RebootInstance reboots instance
+func (p *GCloud) RebootInstance(ctx *Context, instancename string) error {
+	return p.ResetInstance(ctx, instancename)
+}
+
+// PrintInstanceLogs writes instance logs to console, following the new
+// serial port output if watch is set
 func (p *GCloud) PrintInstanceLogs(ctx *Context, instancename string, watch bool) error {
-	l, err := p.GetInstanceLogs(ctx, instancename)
+	fetch := p.serialPortFetcher(ctx, instancename)
+
+	next, err := tailSerialPort(os.Stdout, 0, fetch)
 	if err != nil {
 		return err
 	}
-	fmt.Printf(l)
+
+	for watch {
+		time.Sleep(serialPortPollInterval)
+
+		next, err = tailSerialPort(os.Stdout, next, fetch)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // GetInstanceLogs gets instance related logs
 func (p *GCloud) GetInstanceLogs(ctx *Context, instancename string) (string, error) {
-	context := context.TODO()
+	var buf bytes.Buffer
 
-	cloudConfig := ctx.config.CloudConfig
-	lastPos := int64(0)
-
-	resp, err := p.Service.Instances.GetSerialPortOutput(cloudConfig.ProjectID, cloudConfig.Zone, instancename).Start(lastPos).Context(context).Do()
+	_, err := tailSerialPort(&buf, 0, p.serialPortFetcher(ctx, instancename))
 	if err != nil {
 		return "", err
 	}
-	if resp.Contents != "" {
-		return resp.Contents, nil
-	}
-
-	lastPos = resp.Next
-	time.Sleep(time.Second)
 
-	return "", nil
+	return buf.String(), nil
 }
 
 func createArchive(archive string, files []string) error {
@@ -2,51 +2,191 @@ package lepton
 
 import (
 	"context"
+	"errors"
 	"strings"
 
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/dns/v1"
 )
 
-// FindOrCreateZoneIDByName searches for a DNS zone with the name passed by argument and if it doesn't exist it creates one
+// gcpZoneVisibility returns the visibility of the managed zones serving the
+// records of the config, private with RunConfig.PrivateDNS
+func gcpZoneVisibility(config *Config) string {
+	if config.RunConfig.PrivateDNS {
+		return "private"
+	}
+	return "public"
+}
+
+// gcpZoneName returns the name of the managed zone created for a DNS name,
+// e.g. example-com for example.com
+func gcpZoneName(dnsName string) string {
+	return strings.Replace(strings.TrimSuffix(dnsName, "."), ".", "-", -1)
+}
+
+// gcpServingZone returns the zone with the longest DNS name among the zones
+// the domain name is in, nil if none
+func gcpServingZone(zones []*dns.ManagedZone, domainName string) *dns.ManagedZone {
+	domainName = strings.TrimSuffix(domainName, ".") + "."
+
+	var serving *dns.ManagedZone
+	for _, zone := range zones {
+		if domainName != zone.DnsName && !strings.HasSuffix(domainName, "."+zone.DnsName) {
+			continue
+		}
+
+		if serving == nil || len(zone.DnsName) > len(serving.DnsName) {
+			serving = zone
+		}
+	}
+	return serving
+}
+
+// managedZones returns the managed zones of the project with the visibility
+// of the config, of the DNS name if it's not empty
+func (p *GCloud) managedZones(config *Config, dnsName string) ([]*dns.ManagedZone, error) {
+	call := p.dnsService.ManagedZones.List(config.CloudConfig.ProjectID)
+	if dnsName != "" {
+		call = call.DnsName(dnsName + ".")
+	}
+
+	visibility := gcpZoneVisibility(config)
+
+	var zones []*dns.ManagedZone
+	err := call.Pages(context.TODO(), func(page *dns.ManagedZonesListResponse) error {
+		for _, zone := range page.ManagedZones {
+			// zones created before private zones have no visibility
+			if zone.Visibility == visibility || (zone.Visibility == "" && visibility == "public") {
+				zones = append(zones, zone)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return zones, nil
+}
+
+// FindZoneIDByDomain returns the name of the managed zone serving the domain
+// name, the one with the longest DNS name the domain name ends with, so
+// delegated subdomains and multi-label suffixes like co.uk are served by
+// their own zone. It's empty if no zone serves it
+func (p *GCloud) FindZoneIDByDomain(config *Config, domainName string) (string, error) {
+	zones, err := p.managedZones(config, "")
+	if err != nil {
+		return "", err
+	}
+
+	if zone := gcpServingZone(zones, domainName); zone != nil {
+		return zone.Name, nil
+	}
+	return "", nil
+}
+
+// FindOrCreateZoneIDByName searches for a DNS zone with the name passed by argument and if it doesn't exist it creates one.
+// With RunConfig.PrivateDNS the zone is a private zone visible from the network of the instances
 func (p *GCloud) FindOrCreateZoneIDByName(config *Config, dnsName string) (string, error) {
-	zoneName := strings.Split(dnsName, ".")[0]
-	zone, err := p.dnsService.ManagedZones.Get(config.CloudConfig.ProjectID, zoneName).Do()
-	if err != nil || zone == nil {
-		managedZone := &dns.ManagedZone{
-			Name:        zoneName,
-			Description: zoneName,
-			DnsName:     dnsName + ".",
+	zoneID, err := p.FindZoneIDByName(config, dnsName)
+	if err != nil || zoneID != "" {
+		return zoneID, err
+	}
+
+	managedZone := &dns.ManagedZone{
+		Name:        gcpZoneName(dnsName),
+		Description: "created by ops",
+		DnsName:     dnsName + ".",
+		Visibility:  gcpZoneVisibility(config),
+	}
+
+	if config.RunConfig.PrivateDNS {
+		network := gcpNetwork(config)
+		if network == "" {
+			network = "projects/" + config.CloudConfig.ProjectID + "/global/networks/default"
 		}
 
-		_, err = p.dnsService.ManagedZones.Create(config.CloudConfig.ProjectID, managedZone).Do()
-		if err != nil {
-			return "", err
+		managedZone.Name += "-private"
+		managedZone.PrivateVisibilityConfig = &dns.ManagedZonePrivateVisibilityConfig{
+			Networks: []*dns.ManagedZonePrivateVisibilityConfigNetwork{
+				{NetworkUrl: "https://www.googleapis.com/compute/v1/" + network},
+			},
 		}
 	}
 
-	return zoneName, nil
+	zone, err := p.dnsService.ManagedZones.Create(config.CloudConfig.ProjectID, managedZone).Do()
+	if err != nil {
+		return "", err
+	}
+
+	return zone.Name, nil
+}
+
+// FindZoneIDByName returns the name of the managed zone with the DNS name
+// passed by argument, private with RunConfig.PrivateDNS, empty if there is none
+func (p *GCloud) FindZoneIDByName(config *Config, dnsName string) (string, error) {
+	zones, err := p.managedZones(config, dnsName)
+	if err != nil || len(zones) == 0 {
+		return "", err
+	}
+
+	return zones[0].Name, nil
+}
+
+// recordSets returns the A, AAAA and CNAME record sets of the name in the
+// zone
+func (p *GCloud) recordSets(config *Config, zoneID string, recordName string) ([]*dns.ResourceRecordSet, error) {
+	var recordSets []*dns.ResourceRecordSet
+	err := p.dnsService.ResourceRecordSets.List(config.CloudConfig.ProjectID, zoneID).Name(recordName).
+		Pages(context.TODO(), func(page *dns.ResourceRecordSetsListResponse) error {
+			for _, recordSet := range page.Rrsets {
+				switch recordSet.Type {
+				case "A", "AAAA", "CNAME":
+					recordSets = append(recordSets, recordSet)
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return recordSets, nil
 }
 
 // DeleteZoneRecordIfExists deletes a record from a DNS zone if it exists
 func (p *GCloud) DeleteZoneRecordIfExists(config *Config, zoneID string, recordName string) error {
-	recordsResponse, err := p.dnsService.ResourceRecordSets.List(config.CloudConfig.ProjectID, zoneID).Do()
-	if err != nil {
+	recordSets, err := p.recordSets(config, zoneID, recordName)
+	if err != nil || len(recordSets) == 0 {
 		return err
 	}
 
-	for _, record := range recordsResponse.Rrsets {
-		if record.Name == recordName && record.Type == "A" {
-			_, err = p.dnsService.Changes.Create(config.CloudConfig.ProjectID, zoneID, &dns.Change{
-				Deletions: []*dns.ResourceRecordSet{record},
-			}).Do()
-			if err != nil {
-				return err
-			}
+	_, err = p.dnsService.Changes.Create(config.CloudConfig.ProjectID, zoneID, &dns.Change{
+		Deletions: recordSets,
+	}).Do()
+	return err
+}
+
+// ZoneRecords returns the A, AAAA and CNAME records of the name in the zone
+func (p *GCloud) ZoneRecords(config *Config, zoneID string, recordName string) ([]*DNSRecord, error) {
+	recordSets, err := p.recordSets(config, zoneID, recordName)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*DNSRecord
+	for _, recordSet := range recordSets {
+		for _, value := range recordSet.Rrdatas {
+			records = append(records, &DNSRecord{
+				Name: recordName,
+				IP:   value,
+				Type: recordSet.Type,
+				TTL:  int(recordSet.Ttl),
+			})
 		}
 	}
 
-	return nil
+	return records, nil
 }
 
 // CreateZoneRecord creates a record in a DNS zone
@@ -67,6 +207,79 @@ func (p *GCloud) CreateZoneRecord(config *Config, zoneID string, record *DNSReco
 	return nil
 }
 
+// UpsertZoneRecords creates or replaces the records in a single change. Records
+// sharing name and type are grouped in one record set
+func (p *GCloud) UpsertZoneRecords(config *Config, zoneID string, records []*DNSRecord) error {
+	change := &dns.Change{}
+	recordSets := map[string]*dns.ResourceRecordSet{}
+
+	for name, recordTypes := range recordTypesByName(records) {
+		existing, err := p.recordSets(config, zoneID, name)
+		if err != nil {
+			return err
+		}
+
+		// record sets of the same type are replaced as a whole
+		for _, recordSet := range existing {
+			for _, recordType := range recordTypes {
+				if recordSet.Type == recordType || recordTypesConflict(recordType, recordSet.Type) {
+					change.Deletions = append(change.Deletions, recordSet)
+					break
+				}
+			}
+		}
+	}
+
+	for _, record := range records {
+		key := record.Name + "/" + record.Type
+
+		recordSet, ok := recordSets[key]
+		if !ok {
+			recordSet = &dns.ResourceRecordSet{
+				Name: record.Name,
+				Type: record.Type,
+				Ttl:  int64(record.TTL),
+			}
+			recordSets[key] = recordSet
+			change.Additions = append(change.Additions, recordSet)
+		}
+
+		recordSet.Rrdatas = append(recordSet.Rrdatas, record.IP)
+	}
+
+	_, err := p.dnsService.Changes.Create(config.CloudConfig.ProjectID, zoneID, change).Do()
+	return err
+}
+
+// gcpDNSRecordValues returns the values of the records of the configured
+// type pointing to the instance, its private address with RunConfig.PrivateDNS.
+// No values are returned until the instance has the address
+func gcpDNSRecordValues(config *Config, instance *CloudInstance) ([]string, error) {
+	recordType, err := DNSRecordType(config)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case recordType == "CNAME":
+		return nil, errors.New("gcp instances have no host name to point a CNAME record to, use an A record")
+	case recordType == "AAAA":
+		return nil, errors.New("gcp instances have no ipv6 address to point an AAAA record to, use an A record")
+	case config.RunConfig.PrivateDNS:
+		return firstIP(instance.PrivateIps), nil
+	}
+
+	return firstIP(instance.PublicIps), nil
+}
+
+// firstIP returns the first of the ips, none if it's empty
+func firstIP(ips []string) []string {
+	if len(ips) == 0 {
+		return nil
+	}
+	return ips[:1]
+}
+
 func (p *GCloud) getDNSService() (*dns.Service, error) {
 	context := context.TODO()
 	_, err := google.FindDefaultCredentials(context)
@@ -0,0 +1,67 @@
+package lepton
+
+import (
+	"testing"
+
+	"google.golang.org/api/dns/v1"
+)
+
+func TestGCPServingZone(t *testing.T) {
+	zones := []*dns.ManagedZone{
+		{Name: "example-com", DnsName: "example.com."},
+		{Name: "dev-example-com", DnsName: "dev.example.com."},
+		{Name: "example-co-uk", DnsName: "example.co.uk."},
+	}
+
+	tests := map[string]string{
+		"example.com":         "example-com",
+		"api.example.com":     "example-com",
+		"api.dev.example.com": "dev-example-com",
+		"dev.example.com":     "dev-example-com",
+		"www.example.co.uk":   "example-co-uk",
+		"api.notexample.com":  "",
+		"example.org":         "",
+	}
+
+	for domainName, expected := range tests {
+		zone := gcpServingZone(zones, domainName)
+
+		name := ""
+		if zone != nil {
+			name = zone.Name
+		}
+		if name != expected {
+			t.Errorf("expected %s to be served by %q, got %q", domainName, expected, name)
+		}
+	}
+
+	if name := gcpZoneName("example.co.uk"); name != "example-co-uk" {
+		t.Errorf("unexpected zone name %s", name)
+	}
+}
+
+func TestGCPDNSRecordValues(t *testing.T) {
+	instance := &CloudInstance{PublicIps: []string{"34.1.2.3"}, PrivateIps: []string{"10.0.0.2"}}
+
+	c := NewConfig()
+	values, err := gcpDNSRecordValues(c, instance)
+	if err != nil || len(values) != 1 || values[0] != "34.1.2.3" {
+		t.Errorf("expected the public ip, got %v %v", values, err)
+	}
+
+	c.RunConfig.PrivateDNS = true
+	values, err = gcpDNSRecordValues(c, instance)
+	if err != nil || len(values) != 1 || values[0] != "10.0.0.2" {
+		t.Errorf("expected the private ip, got %v %v", values, err)
+	}
+
+	values, err = gcpDNSRecordValues(c, &CloudInstance{})
+	if err != nil || len(values) != 0 {
+		t.Errorf("expected no values without addresses, got %v %v", values, err)
+	}
+
+	c.RunConfig.DNSRecordType = "CNAME"
+	if _, err := gcpDNSRecordValues(c, instance); err == nil {
+		t.Error("expected CNAME records to be refused")
+	}
+}
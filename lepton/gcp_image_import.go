@@ -0,0 +1,119 @@
+package lepton
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// gcpDiskName is the name GCP expects the raw disk to have in an image archive
+const gcpDiskName = "disk.raw"
+
+// gcpGuestOSFeatureAliases maps short names accepted in the configuration to
+// GCP guest os feature types
+var gcpGuestOSFeatureAliases = map[string]string{
+	"uefi":       "UEFI_COMPATIBLE",
+	"gvnic":      "GVNIC",
+	"multiqueue": "VIRTIO_SCSI_MULTIQUEUE",
+	"sev":        "SEV_CAPABLE",
+	"secureboot": "SECURE_BOOT",
+}
+
+// gcpGuestOSFeatureTypes are the guest os features a nanos image may declare
+var gcpGuestOSFeatureTypes = map[string]bool{
+	"UEFI_COMPATIBLE":        true,
+	"GVNIC":                  true,
+	"VIRTIO_SCSI_MULTIQUEUE": true,
+	"SEV_CAPABLE":            true,
+	"SECURE_BOOT":            true,
+	"MULTI_IP_SUBNET":        true,
+}
+
+// gcpGuestOSFeatures converts feature names or aliases to GCP guest os
+// features, dropping duplicates
+func gcpGuestOSFeatures(names []string) ([]*compute.GuestOsFeature, error) {
+	var features []*compute.GuestOsFeature
+	seen := map[string]bool{}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		featureType, ok := gcpGuestOSFeatureAliases[strings.ToLower(name)]
+		if !ok {
+			featureType = strings.ToUpper(name)
+		}
+
+		if !gcpGuestOSFeatureTypes[featureType] {
+			return nil, fmt.Errorf("unknown guest os feature %q, expected one of %s", name, strings.Join(gcpGuestOSFeatureNames(), ", "))
+		}
+
+		if seen[featureType] {
+			continue
+		}
+		seen[featureType] = true
+
+		features = append(features, &compute.GuestOsFeature{Type: featureType})
+	}
+
+	return features, nil
+}
+
+func gcpGuestOSFeatureNames() []string {
+	var names []string
+	for name := range gcpGuestOSFeatureTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeDiskArchive writes the raw disk image as the single entry of a gzipped
+// tar, the format GCP imports raw disks from
+func writeDiskArchive(w io.Writer, imagePath string) error {
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fstat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:   gcpDiskName,
+		Mode:   int64(fstat.Mode()),
+		Size:   fstat.Size(),
+		Format: tar.FormatGNU,
+	}); err != nil {
+		return err
+	}
+
+	if _, err := io.CopyN(tw, f, fstat.Size()); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+// isArchive reports whether path is an archive ready to be imported, rather
+// than a raw disk image to be archived while uploading
+func isArchive(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz")
+}
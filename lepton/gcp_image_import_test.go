@@ -0,0 +1,83 @@
+package lepton
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGCPGuestOSFeatures(t *testing.T) {
+	features, err := gcpGuestOSFeatures([]string{"uefi", "GVNIC", "gvnic", " ", "virtio_scsi_multiqueue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for _, feature := range features {
+		types = append(types, feature.Type)
+	}
+
+	expected := []string{"UEFI_COMPATIBLE", "GVNIC", "VIRTIO_SCSI_MULTIQUEUE"}
+	if len(types) != len(expected) {
+		t.Fatalf("got features %v, want %v", types, expected)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Errorf("got features %v, want %v", types, expected)
+			break
+		}
+	}
+
+	if _, err := gcpGuestOSFeatures([]string{"WINDOWS"}); err == nil {
+		t.Error("expected an unknown feature to be rejected")
+	}
+}
+
+func TestWriteDiskArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gcp-image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	disk := bytes.Repeat([]byte("nanos"), 1000)
+	imagePath := filepath.Join(dir, "test.img")
+	if err := ioutil.WriteFile(imagePath, disk, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDiskArchive(&buf, imagePath); err != nil {
+		t.Fatal(err)
+	}
+
+	gzr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gzr)
+
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Name != gcpDiskName {
+		t.Errorf("got entry %q, want %q", hdr.Name, gcpDiskName)
+	}
+
+	content, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, disk) {
+		t.Error("archived disk doesn't match the image")
+	}
+
+	if _, err := tr.Next(); err == nil {
+		t.Error("expected a single entry in the archive")
+	}
+}
@@ -0,0 +1,103 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// gcpRunConfigKey is the instance metadata item holding the config the
+// instance was created with
+const gcpRunConfigKey = "ops-run-config"
+
+// gcpMetadataValueSize is the longest value of a gcp metadata item
+const gcpMetadataValueSize = 256 * 1024
+
+// runConfigMetadata returns the metadata items recording the config instances
+// are created with. The config isn't recorded if it doesn't fit in one item
+func (p *GCloud) runConfigMetadata(ctx *Context) []*compute.MetadataItems {
+	settings, err := instanceConfig(ctx.config)
+	if err != nil {
+		ctx.logger.Warn("unable to record instance config: %v", err)
+		return nil
+	}
+
+	chunks, err := encodeInstanceConfig(settings, gcpMetadataValueSize)
+	if err != nil {
+		ctx.logger.Warn("unable to record instance config: %v", err)
+		return nil
+	}
+
+	if len(chunks) > 1 {
+		ctx.logger.Warn("instance config too large to be recorded, its drift won't be detected")
+		return nil
+	}
+
+	return []*compute.MetadataItems{{Key: gcpRunConfigKey, Value: &chunks[0]}}
+}
+
+// recordedGCPRunConfig returns the config recorded in the instance metadata,
+// nil if the instance has none
+func recordedGCPRunConfig(instance *compute.Instance) (map[string]string, error) {
+	if instance.Metadata == nil {
+		return nil, nil
+	}
+
+	for _, item := range instance.Metadata.Items {
+		if item.Key != gcpRunConfigKey || item.Value == nil {
+			continue
+		}
+
+		settings, err := decodeInstanceConfig([]string{*item.Value})
+		if err != nil {
+			return nil, fmt.Errorf("decode config of instance %s: %v", instance.Name, err)
+		}
+		return settings, nil
+	}
+
+	return nil, nil
+}
+
+// DiffInstanceConfig compares the config the instance was created with to the
+// local config and returns the settings that drifted
+func (p *GCloud) DiffInstanceConfig(ctx *Context, instanceName string) ([]ConfigDrift, error) {
+	instance, err := p.Service.Instances.Get(ctx.config.CloudConfig.ProjectID, ctx.config.CloudConfig.Zone, instanceName).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	recorded, err := recordedGCPRunConfig(instance)
+	if err != nil {
+		return nil, err
+	}
+	if recorded == nil {
+		return nil, errors.New("instance " + instanceName + " has no recorded config, it was created by an older version of ops")
+	}
+
+	// instances are created with the default flavor
+	c := *ctx.config
+	if c.CloudConfig.Flavor == "" {
+		c.CloudConfig.Flavor = "g1-small"
+	}
+
+	current, err := instanceConfig(&c)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffInstanceConfig(recorded, current), nil
+}
+
+// PrintInstanceConfigDiff prints the settings of the local config that drifted
+// from the config the instance was created with
+func (p *GCloud) PrintInstanceConfigDiff(ctx *Context, instanceName string) error {
+	drift, err := p.DiffInstanceConfig(ctx, instanceName)
+	if err != nil {
+		return err
+	}
+
+	printConfigDrift(ctx, instanceName, drift)
+
+	return nil
+}
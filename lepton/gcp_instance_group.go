@@ -0,0 +1,480 @@
+package lepton
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// gcpNotFound returns true if err reports a missing resource
+func gcpNotFound(err error) bool {
+	if gerr, ok := err.(*googleapi.Error); ok {
+		return gerr.Code == http.StatusNotFound
+	}
+	return false
+}
+
+// gcpTemplateName returns the name of a new instance template of the group,
+// templates being immutable each image update creates one
+func gcpTemplateName(group string) string {
+	return group + "-" + strconv.FormatInt(time.Now().Unix(), 10)
+}
+
+// gcpAutoscaler returns the autoscaler keeping the average cpu utilization
+// of the instances of the group manager at the target of the group
+func gcpAutoscaler(group InstanceGroup, target string) *compute.Autoscaler {
+	policy := &compute.AutoscalingPolicy{
+		MinNumReplicas: group.MinSize,
+		MaxNumReplicas: group.MaxSize,
+		CpuUtilization: &compute.AutoscalingPolicyCpuUtilization{
+			UtilizationTarget: group.TargetCPU / 100,
+		},
+		// a minimum of zero replicas has to be sent explicitly
+		ForceSendFields: []string{"MinNumReplicas"},
+	}
+
+	if group.HealthCheckGracePeriod > 0 {
+		policy.CoolDownPeriodSec = group.HealthCheckGracePeriod
+	}
+
+	return &compute.Autoscaler{
+		Name:              group.Name,
+		Target:            target,
+		AutoscalingPolicy: policy,
+	}
+}
+
+// gcpUpdatePolicy returns how the instances of a group are moved to a new
+// template: replaced one at a time with a surge instance when refresh is set,
+// otherwise only the instances created afterwards use it
+func gcpUpdatePolicy(refresh bool) *compute.InstanceGroupManagerUpdatePolicy {
+	if !refresh {
+		return &compute.InstanceGroupManagerUpdatePolicy{Type: "OPPORTUNISTIC"}
+	}
+
+	return &compute.InstanceGroupManagerUpdatePolicy{
+		Type:           "PROACTIVE",
+		MinimalAction:  "REPLACE",
+		MaxSurge:       &compute.FixedOrPercent{Fixed: 1},
+		MaxUnavailable: &compute.FixedOrPercent{Fixed: 0, ForceSendFields: []string{"Fixed"}},
+	}
+}
+
+// instanceTemplateProperties returns the settings of the instances launched
+// from the image of the config by the group named name, tagged with the name
+// so the firewall rules of the group apply to them
+func (p *GCloud) instanceTemplateProperties(c *Config, name string) (*compute.InstanceProperties, error) {
+	networkTags, err := gcpNetworkTags(c, name)
+	if err != nil {
+		return nil, err
+	}
+
+	flavor := c.CloudConfig.Flavor
+	if flavor == "" {
+		flavor = "g1-small"
+	}
+
+	network := gcpNetwork(c)
+	if network == "" && c.RunConfig.Subnet == "" {
+		network = "global/networks/default"
+	}
+
+	serialTrue := "true"
+	labels := gcpDefaultLabels(c, gcpInstanceLabels(c))
+
+	return &compute.InstanceProperties{
+		MachineType: flavor,
+		Labels:      labels,
+		Disks: []*compute.AttachedDisk{
+			{
+				AutoDelete: true,
+				Boot:       true,
+				Type:       "PERSISTENT",
+				InitializeParams: &compute.AttachedDiskInitializeParams{
+					SourceImage: fmt.Sprintf("projects/%v/global/images/%v", c.CloudConfig.ProjectID, c.CloudConfig.ImageName),
+					Labels:      labels,
+				},
+			},
+		},
+		NetworkInterfaces: []*compute.NetworkInterface{
+			{
+				Network:    network,
+				Subnetwork: gcpSubnetwork(c),
+				AccessConfigs: []*compute.AccessConfig{
+					{
+						NetworkTier: "PREMIUM",
+						Type:        "ONE_TO_ONE_NAT",
+						Name:        "External NAT",
+					},
+				},
+			},
+		},
+		Metadata: &compute.Metadata{
+			Items: []*compute.MetadataItems{
+				{
+					Key:   "serial-port-enable",
+					Value: &serialTrue,
+				},
+			},
+		},
+		Tags: &compute.Tags{
+			Items: networkTags,
+		},
+		ServiceAccounts: gcpServiceAccounts(c),
+	}, nil
+}
+
+// createInstanceTemplate creates a template of the instances of the group
+// and returns its url
+func (p *GCloud) createInstanceTemplate(ctx *Context, group string) (string, error) {
+	c := ctx.config
+
+	properties, err := p.instanceTemplateProperties(c, group)
+	if err != nil {
+		return "", err
+	}
+
+	template := &compute.InstanceTemplate{
+		Name:        gcpTemplateName(group),
+		Description: "instances of group " + group,
+		Properties:  properties,
+	}
+
+	op, err := p.Service.InstanceTemplates.Insert(c.CloudConfig.ProjectID, template).Do()
+	if err != nil {
+		return "", fmt.Errorf("create instance template %s: %v", template.Name, err)
+	}
+
+	err = p.pollOperation(context.TODO(), c.CloudConfig.ProjectID, p.Service, *op)
+	if err != nil {
+		return "", fmt.Errorf("create instance template %s: %v", template.Name, err)
+	}
+
+	ctx.logger.Log("Created instance template %s of image %s", template.Name, c.CloudConfig.ImageName)
+
+	return op.TargetLink, nil
+}
+
+// groupFirewallNetwork returns the network of the instances of the config
+// and its project, empty for the default network
+func (p *GCloud) groupFirewallNetwork(c *Config) (string, string, error) {
+	project := c.CloudConfig.ProjectID
+
+	network := gcpNetwork(c)
+	if network == "" && c.RunConfig.Subnet != "" {
+		subnet := gcpSubnetwork(c)
+		subnetwork, err := p.Service.Subnetworks.Get(gcpResourceProject(subnet, project), gcpRegion(c.CloudConfig.Zone), path.Base(subnet)).Do()
+		if err != nil {
+			return "", "", fmt.Errorf("get subnetwork %s: %v", subnet, err)
+		}
+		network = subnetwork.Network
+	}
+
+	return network, gcpResourceProject(network, project), nil
+}
+
+// createGroupFirewallRules opens the ports of the config to the instances of
+// the group
+func (p *GCloud) createGroupFirewallRules(ctx *Context, group string) error {
+	c := ctx.config
+
+	network, project, err := p.groupFirewallNetwork(c)
+	if err != nil {
+		return err
+	}
+
+	tcpPorts := intsToStrings(c.RunConfig.Ports)
+	for _, portRange := range c.RunConfig.PortRanges {
+		if _, _, err := ParsePortRange(portRange); err != nil {
+			return err
+		}
+		tcpPorts = append(tcpPorts, portRange)
+	}
+
+	var rules []*compute.Firewall
+	if len(tcpPorts) != 0 {
+		rules = append(rules, p.buildFirewallRules("tcp", tcpPorts, group, allowedSources(c))...)
+	}
+	if len(c.RunConfig.UDPPorts) != 0 {
+		rules = append(rules, p.buildFirewallRules("udp", intsToStrings(c.RunConfig.UDPPorts), group, allowedSources(c))...)
+	}
+
+	for _, rule := range rules {
+		rule.Network = network
+		_, err = p.Service.Firewalls.Insert(project, rule).Do()
+		if err != nil {
+			return fmt.Errorf("create firewall rule %s: %v", rule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// CreateInstanceGroup creates an instance template with the instance
+// settings of the config and a managed instance group of instances launched
+// from it, scaled between the min and max sizes by an autoscaler if a target
+// cpu is set
+func (p *GCloud) CreateInstanceGroup(ctx *Context, group InstanceGroup) error {
+	err := group.validate()
+	if err != nil {
+		return err
+	}
+
+	c := ctx.config
+
+	template, err := p.createInstanceTemplate(ctx, group.Name)
+	if err != nil {
+		return err
+	}
+
+	desired := group.DesiredCapacity
+	if desired < 0 {
+		desired = group.MinSize
+	}
+
+	manager := &compute.InstanceGroupManager{
+		Name:             group.Name,
+		BaseInstanceName: group.Name,
+		InstanceTemplate: template,
+		TargetSize:       desired,
+		UpdatePolicy:     gcpUpdatePolicy(false),
+		ForceSendFields:  []string{"TargetSize"},
+	}
+
+	op, err := p.Service.InstanceGroupManagers.Insert(c.CloudConfig.ProjectID, c.CloudConfig.Zone, manager).Do()
+	if err != nil {
+		return fmt.Errorf("create managed instance group %s: %v", group.Name, err)
+	}
+
+	err = p.pollOperation(context.TODO(), c.CloudConfig.ProjectID, p.Service, *op)
+	if err != nil {
+		return fmt.Errorf("create managed instance group %s: %v", group.Name, err)
+	}
+
+	if group.TargetCPU > 0 {
+		managerLink := op.TargetLink
+		op, err = p.Service.Autoscalers.Insert(c.CloudConfig.ProjectID, c.CloudConfig.Zone, gcpAutoscaler(group, managerLink)).Do()
+		if err != nil {
+			return fmt.Errorf("create autoscaler of group %s: %v", group.Name, err)
+		}
+
+		err = p.pollOperation(context.TODO(), c.CloudConfig.ProjectID, p.Service, *op)
+		if err != nil {
+			return fmt.Errorf("create autoscaler of group %s: %v", group.Name, err)
+		}
+	}
+
+	err = p.createGroupFirewallRules(ctx, group.Name)
+	if err != nil {
+		return err
+	}
+
+	ctx.logger.Log("Created instance group %s with %d instances", group.Name, desired)
+
+	return nil
+}
+
+// UpdateInstanceGroup changes the size and scaling of the group. If an image
+// is configured a new instance template launching it is created, and refresh
+// replaces the running instances with instances of the new template in a
+// rolling update
+func (p *GCloud) UpdateInstanceGroup(ctx *Context, group InstanceGroup, refresh bool) error {
+	c := ctx.config
+	project, zone := c.CloudConfig.ProjectID, c.CloudConfig.Zone
+
+	manager, err := p.Service.InstanceGroupManagers.Get(project, zone, group.Name).Do()
+	if err != nil {
+		return fmt.Errorf("get managed instance group %s: %v", group.Name, err)
+	}
+
+	if c.CloudConfig.ImageName != "" {
+		template, err := p.createInstanceTemplate(ctx, group.Name)
+		if err != nil {
+			return err
+		}
+
+		op, err := p.Service.InstanceGroupManagers.Patch(project, zone, group.Name, &compute.InstanceGroupManager{
+			Versions:     []*compute.InstanceGroupManagerVersion{{InstanceTemplate: template}},
+			UpdatePolicy: gcpUpdatePolicy(refresh),
+		}).Do()
+		if err != nil {
+			return fmt.Errorf("update template of group %s: %v", group.Name, err)
+		}
+
+		err = p.pollOperation(context.TODO(), project, p.Service, *op)
+		if err != nil {
+			return fmt.Errorf("update template of group %s: %v", group.Name, err)
+		}
+
+		if refresh {
+			ctx.logger.Log("Started rolling update of group %s", group.Name)
+		}
+	} else if refresh {
+		return errors.New("rolling update requires an image to launch")
+	}
+
+	if group.DesiredCapacity >= 0 {
+		op, err := p.Service.InstanceGroupManagers.Resize(project, zone, group.Name, group.DesiredCapacity).Do()
+		if err != nil {
+			return fmt.Errorf("resize group %s: %v", group.Name, err)
+		}
+
+		err = p.pollOperation(context.TODO(), project, p.Service, *op)
+		if err != nil {
+			return fmt.Errorf("resize group %s: %v", group.Name, err)
+		}
+	}
+
+	err = p.updateGroupAutoscaler(ctx, group, manager.SelfLink)
+	if err != nil {
+		return err
+	}
+
+	ctx.logger.Log("Updated instance group %s", group.Name)
+
+	return nil
+}
+
+// updateGroupAutoscaler applies the sizes and target cpu of the group to its
+// autoscaler, creating it if the group has none and deleting it if the target
+// is zero
+func (p *GCloud) updateGroupAutoscaler(ctx *Context, group InstanceGroup, target string) error {
+	if group.MinSize < 0 && group.MaxSize < 0 && group.TargetCPU < 0 && group.HealthCheckGracePeriod < 0 {
+		return nil
+	}
+
+	project, zone := ctx.config.CloudConfig.ProjectID, ctx.config.CloudConfig.Zone
+
+	existing, err := p.Service.Autoscalers.Get(project, zone, group.Name).Do()
+	if err != nil && !gcpNotFound(err) {
+		return fmt.Errorf("get autoscaler of group %s: %v", group.Name, err)
+	}
+
+	var op *compute.Operation
+	switch {
+	case group.TargetCPU == 0:
+		if existing == nil {
+			return nil
+		}
+		op, err = p.Service.Autoscalers.Delete(project, zone, group.Name).Do()
+	case existing == nil:
+		if group.TargetCPU < 0 {
+			return fmt.Errorf("group %s isn't autoscaled, its sizes apply with a target cpu", group.Name)
+		}
+
+		merged := group
+		if merged.MinSize < 0 {
+			merged.MinSize = 1
+		}
+		if merged.MaxSize < 0 {
+			merged.MaxSize = merged.MinSize
+		}
+		err = merged.validate()
+		if err != nil {
+			return err
+		}
+		op, err = p.Service.Autoscalers.Insert(project, zone, gcpAutoscaler(merged, target)).Do()
+	default:
+		merged := group
+		if merged.MinSize < 0 {
+			merged.MinSize = existing.AutoscalingPolicy.MinNumReplicas
+		}
+		if merged.MaxSize < 0 {
+			merged.MaxSize = existing.AutoscalingPolicy.MaxNumReplicas
+		}
+		if merged.TargetCPU < 0 && existing.AutoscalingPolicy.CpuUtilization != nil {
+			merged.TargetCPU = existing.AutoscalingPolicy.CpuUtilization.UtilizationTarget * 100
+		}
+		if merged.HealthCheckGracePeriod < 0 {
+			merged.HealthCheckGracePeriod = existing.AutoscalingPolicy.CoolDownPeriodSec
+		}
+		merged.DesiredCapacity = -1
+		err = merged.validate()
+		if err != nil {
+			return err
+		}
+		op, err = p.Service.Autoscalers.Update(project, zone, gcpAutoscaler(merged, target)).Do()
+	}
+	if err != nil {
+		return fmt.Errorf("update autoscaler of group %s: %v", group.Name, err)
+	}
+
+	err = p.pollOperation(context.TODO(), project, p.Service, *op)
+	if err != nil {
+		return fmt.Errorf("update autoscaler of group %s: %v", group.Name, err)
+	}
+
+	return nil
+}
+
+// DeleteInstanceGroup deletes the group with its instances, its autoscaler,
+// the instance templates and the firewall rules ops created for it
+func (p *GCloud) DeleteInstanceGroup(ctx *Context, name string) error {
+	c := ctx.config
+	project, zone := c.CloudConfig.ProjectID, c.CloudConfig.Zone
+
+	op, err := p.Service.Autoscalers.Delete(project, zone, name).Do()
+	if err == nil {
+		err = p.pollOperation(context.TODO(), project, p.Service, *op)
+	}
+	if err != nil && !gcpNotFound(err) {
+		return fmt.Errorf("delete autoscaler of group %s: %v", name, err)
+	}
+
+	op, err = p.Service.InstanceGroupManagers.Delete(project, zone, name).Do()
+	if err != nil {
+		return fmt.Errorf("delete managed instance group %s: %v", name, err)
+	}
+
+	ctx.logger.Log("waiting for the group instances to be deleted")
+
+	err = p.pollOperation(context.TODO(), project, p.Service, *op)
+	if err != nil {
+		return fmt.Errorf("delete managed instance group %s: %v", name, err)
+	}
+
+	templates, err := p.Service.InstanceTemplates.List(project).Filter(fmt.Sprintf("name eq '%s-[0-9]+'", name)).Do()
+	if err != nil {
+		return fmt.Errorf("list instance templates of group %s: %v", name, err)
+	}
+
+	for _, template := range templates.Items {
+		op, err = p.Service.InstanceTemplates.Delete(project, template.Name).Do()
+		if err == nil {
+			err = p.pollOperation(context.TODO(), project, p.Service, *op)
+		}
+		if err != nil {
+			ctx.logger.Warn("instance template %s not deleted: %v", template.Name, err)
+			continue
+		}
+
+		ctx.logger.Log("Deleted instance template %s", template.Name)
+	}
+
+	_, firewallProject, err := p.groupFirewallNetwork(c)
+	if err != nil {
+		ctx.logger.Warn("%v", err)
+		firewallProject = project
+	}
+
+	for _, protocol := range []string{"tcp", "udp"} {
+		ipv4Rule, ipv6Rule := gcpFirewallRuleNames(protocol, name)
+		for _, rule := range []string{ipv4Rule, ipv6Rule} {
+			_, err = p.Service.Firewalls.Delete(firewallProject, rule).Do()
+			if err != nil && !gcpNotFound(err) {
+				ctx.logger.Warn("firewall rule %s not deleted: %v", rule, err)
+			}
+		}
+	}
+
+	ctx.logger.Log("Deleted instance group %s", name)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package lepton
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGCPAutoscaler(t *testing.T) {
+	group := InstanceGroup{Name: "web", MinSize: 0, MaxSize: 4, TargetCPU: 60, HealthCheckGracePeriod: 90}
+
+	autoscaler := gcpAutoscaler(group, "zones/us-west1-b/instanceGroupManagers/web")
+	policy := autoscaler.AutoscalingPolicy
+
+	if autoscaler.Name != "web" || autoscaler.Target != "zones/us-west1-b/instanceGroupManagers/web" {
+		t.Errorf("unexpected autoscaler %s of %s", autoscaler.Name, autoscaler.Target)
+	}
+
+	if policy.MinNumReplicas != 0 || policy.MaxNumReplicas != 4 {
+		t.Errorf("expected 0-4 replicas, got %d-%d", policy.MinNumReplicas, policy.MaxNumReplicas)
+	}
+
+	if len(policy.ForceSendFields) != 1 || policy.ForceSendFields[0] != "MinNumReplicas" {
+		t.Errorf("expected a minimum of zero replicas to be sent, got %v", policy.ForceSendFields)
+	}
+
+	if policy.CpuUtilization.UtilizationTarget != 0.6 {
+		t.Errorf("expected a cpu utilization target of 0.6, got %v", policy.CpuUtilization.UtilizationTarget)
+	}
+
+	if policy.CoolDownPeriodSec != 90 {
+		t.Errorf("expected a cool down period of 90s, got %d", policy.CoolDownPeriodSec)
+	}
+}
+
+func TestGCPUpdatePolicy(t *testing.T) {
+	if policy := gcpUpdatePolicy(false); policy.Type != "OPPORTUNISTIC" || policy.MaxSurge != nil {
+		t.Errorf("expected an opportunistic update without refresh, got %+v", policy)
+	}
+
+	policy := gcpUpdatePolicy(true)
+	if policy.Type != "PROACTIVE" || policy.MinimalAction != "REPLACE" {
+		t.Errorf("expected instances to be replaced on refresh, got %+v", policy)
+	}
+
+	if policy.MaxSurge.Fixed != 1 || policy.MaxUnavailable.Fixed != 0 {
+		t.Errorf("expected a surge of 1 without unavailable instances, got %d and %d",
+			policy.MaxSurge.Fixed, policy.MaxUnavailable.Fixed)
+	}
+}
+
+func TestGCPTemplateName(t *testing.T) {
+	name := gcpTemplateName("web")
+	if !strings.HasPrefix(name, "web-") || len(name) <= len("web-") {
+		t.Errorf("unexpected template name %s", name)
+	}
+}
+
+func TestGCPFirewallRulesByFamily(t *testing.T) {
+	rules := (&GCloud{}).buildFirewallRules("tcp", []string{"80", "8000-8100"}, "web", []string{"10.0.0.0/8", "::/0", "192.168.0.0/16"})
+	if len(rules) != 2 {
+		t.Fatalf("expected an ipv4 and an ipv6 rule, got %d", len(rules))
+	}
+
+	if rules[0].Name != "ops-tcp-rule-web" || strings.Join(rules[0].SourceRanges, ",") != "10.0.0.0/8,192.168.0.0/16" {
+		t.Errorf("unexpected ipv4 rule %s from %v", rules[0].Name, rules[0].SourceRanges)
+	}
+	if rules[1].Name != "ops-tcp-rule-web-ipv6" || strings.Join(rules[1].SourceRanges, ",") != "::/0" {
+		t.Errorf("unexpected ipv6 rule %s from %v", rules[1].Name, rules[1].SourceRanges)
+	}
+
+	if rules := (&GCloud{}).buildFirewallRules("udp", []string{"53"}, "web", []string{"0.0.0.0/0"}); len(rules) != 1 {
+		t.Errorf("expected a single ipv4 rule, got %d", len(rules))
+	}
+}
@@ -0,0 +1,49 @@
+package lepton
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// gcpNetworkTagPattern matches the network tags gcp accepts
+var gcpNetworkTagPattern = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// gcpInstanceLabels returns the tags of the run config as gcp labels of
+// created instances and their disks
+func gcpInstanceLabels(c *Config) map[string]string {
+	if len(c.RunConfig.Tags) == 0 {
+		return nil
+	}
+
+	labels := map[string]string{}
+	for _, tag := range c.RunConfig.Tags {
+		key := gcpLabelValue(tag.Key)
+		if key == "" {
+			continue
+		}
+		labels[key] = gcpLabelValue(tag.Value)
+	}
+
+	return labels
+}
+
+// gcpNetworkTags returns the network tags of the instance name, its own tag
+// the ops firewall rules target followed by the network tags of the run
+// config, so that firewall rules targeting them apply to it
+func gcpNetworkTags(c *Config, instanceName string) ([]string, error) {
+	tags := []string{instanceName}
+	seen := map[string]bool{instanceName: true}
+
+	for _, tag := range c.RunConfig.NetworkTags {
+		if !gcpNetworkTagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("invalid network tag %q, expected lowercase letters, digits and dashes starting with a letter", tag)
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,43 @@
+package lepton
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGCPInstanceLabels(t *testing.T) {
+	c := NewConfig()
+	c.RunConfig.Tags = []Tag{{Key: "Team", Value: "Payments"}, {Key: "cost center", Value: "42"}}
+
+	labels := gcpInstanceLabels(c)
+	expected := map[string]string{"team": "payments", "cost_center": "42"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, labels)
+	}
+
+	if labels := gcpInstanceLabels(NewConfig()); labels != nil {
+		t.Errorf("expected no labels, got %v", labels)
+	}
+}
+
+func TestGCPNetworkTags(t *testing.T) {
+	c := NewConfig()
+	c.RunConfig.NetworkTags = []string{"http-server", "allow-health-checks", "http-server"}
+
+	tags, err := gcpNetworkTags(c, "web-1600000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"web-1600000000", "http-server", "allow-health-checks"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected network tags %v, got %v", expected, tags)
+	}
+
+	for _, tag := range []string{"Http", "1web", "web-", ""} {
+		c.RunConfig.NetworkTags = []string{tag}
+		if _, err := gcpNetworkTags(c, "web-1600000000"); err == nil {
+			t.Errorf("expected network tag %q to be refused", tag)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package lepton
+
+import (
+	"strings"
+)
+
+// gcpRegion returns the region of the gcp zone, e.g. us-west1 of us-west1-a
+func gcpRegion(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
+
+// gcpQualifiedResource returns the resource path of name, given as name,
+// <project>/<name> for resources of another project like a shared vpc host
+// project, or a path or url kept as is. path formats the path of the
+// resource in a project
+func gcpQualifiedResource(name string, project string, path func(project string, name string) string) string {
+	if strings.HasPrefix(name, "projects/") || strings.Contains(name, "://") {
+		return name
+	}
+
+	if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+		return path(parts[0], parts[1])
+	}
+
+	return path(project, name)
+}
+
+// gcpNetwork returns the path of the network of the run config vpc, empty if
+// instances are placed in the default network
+func gcpNetwork(c *Config) string {
+	if c.RunConfig.VPC == "" {
+		return ""
+	}
+
+	return gcpQualifiedResource(c.RunConfig.VPC, c.CloudConfig.ProjectID, func(project string, name string) string {
+		return "projects/" + project + "/global/networks/" + name
+	})
+}
+
+// gcpSubnetwork returns the path of the subnetwork of the run config subnet
+// in the region of the zone, empty if it's the one of the network in the
+// region
+func gcpSubnetwork(c *Config) string {
+	if c.RunConfig.Subnet == "" {
+		return ""
+	}
+
+	region := gcpRegion(c.CloudConfig.Zone)
+	return gcpQualifiedResource(c.RunConfig.Subnet, c.CloudConfig.ProjectID, func(project string, name string) string {
+		return "projects/" + project + "/regions/" + region + "/subnetworks/" + name
+	})
+}
+
+// gcpResourceProject returns the project of a resource path or url, fallback
+// if it has none
+func gcpResourceProject(resource string, fallback string) string {
+	parts := strings.Split(resource, "/")
+	for i := 0; i < len(parts)-1; i++ {
+		if parts[i] == "projects" {
+			return parts[i+1]
+		}
+	}
+	return fallback
+}
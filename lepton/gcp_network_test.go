@@ -0,0 +1,40 @@
+package lepton
+
+import "testing"
+
+func TestGCPNetwork(t *testing.T) {
+	c := NewConfig()
+	c.CloudConfig.ProjectID = "app"
+	c.CloudConfig.Zone = "us-west1-a"
+
+	if network, subnetwork := gcpNetwork(c), gcpSubnetwork(c); network != "" || subnetwork != "" {
+		t.Errorf("expected the default network, got %q %q", network, subnetwork)
+	}
+
+	tests := []struct {
+		vpc, subnet         string
+		network, subnetwork string
+	}{
+		{"corp", "apps", "projects/app/global/networks/corp", "projects/app/regions/us-west1/subnetworks/apps"},
+		{"host/shared", "host/apps", "projects/host/global/networks/shared", "projects/host/regions/us-west1/subnetworks/apps"},
+		{"projects/host/global/networks/shared", "projects/host/regions/us-west1/subnetworks/apps", "projects/host/global/networks/shared", "projects/host/regions/us-west1/subnetworks/apps"},
+	}
+
+	for _, tt := range tests {
+		c.RunConfig.VPC = tt.vpc
+		c.RunConfig.Subnet = tt.subnet
+		if network := gcpNetwork(c); network != tt.network {
+			t.Errorf("%s: expected network %s, got %s", tt.vpc, tt.network, network)
+		}
+		if subnetwork := gcpSubnetwork(c); subnetwork != tt.subnetwork {
+			t.Errorf("%s: expected subnetwork %s, got %s", tt.subnet, tt.subnetwork, subnetwork)
+		}
+	}
+
+	if project := gcpResourceProject("https://www.googleapis.com/compute/v1/projects/host/global/networks/shared", "app"); project != "host" {
+		t.Errorf("expected the host project, got %s", project)
+	}
+	if project := gcpResourceProject("default", "app"); project != "app" {
+		t.Errorf("expected the fallback project, got %s", project)
+	}
+}
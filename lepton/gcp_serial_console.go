@@ -0,0 +1,59 @@
+package lepton
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// serialPortPollInterval is the pause between reads of the serial port of a
+// watched instance
+const serialPortPollInterval = 2 * time.Second
+
+// tailSerialPort writes the serial port output read through fetch from the
+// position start until there's no more, and returns the position the next
+// read continues from. gcp only keeps the last 1MB of the serial port, output
+// rotated out before it's read is reported as dropped
+func tailSerialPort(w io.Writer, start int64, fetch func(start int64) (*compute.SerialPortOutput, error)) (int64, error) {
+	for {
+		output, err := fetch(start)
+		if err != nil {
+			return start, err
+		}
+
+		if output.Start > start {
+			fmt.Fprintf(w, "\n[%d bytes of console output dropped]\n", output.Start-start)
+		}
+
+		_, err = io.WriteString(w, output.Contents)
+		if err != nil {
+			return start, err
+		}
+
+		if output.Contents == "" || output.Next <= start {
+			if output.Next > start {
+				return output.Next, nil
+			}
+			return start, nil
+		}
+
+		start = output.Next
+	}
+}
+
+// serialPortFetcher returns a function reading the serial port output of the
+// instance from a position
+func (p *GCloud) serialPortFetcher(ctx *Context, instancename string) func(start int64) (*compute.SerialPortOutput, error) {
+	cloudConfig := ctx.config.CloudConfig
+
+	return func(start int64) (*compute.SerialPortOutput, error) {
+		output, err := p.Service.Instances.GetSerialPortOutput(cloudConfig.ProjectID, cloudConfig.Zone, instancename).Start(start).Context(context.TODO()).Do()
+		if err != nil {
+			return nil, fmt.Errorf("get serial port output of %s: %v", instancename, err)
+		}
+		return output, nil
+	}
+}
@@ -0,0 +1,56 @@
+package lepton
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestTailSerialPort(t *testing.T) {
+	// the port kept the output from 10, the first 10 bytes were rotated out
+	port := "0123456789booting\nready\n"
+	kept := int64(10)
+	pageSize := int64(8)
+
+	fetch := func(start int64) (*compute.SerialPortOutput, error) {
+		if start < kept {
+			start = kept
+		}
+		end := start + pageSize
+		if end > int64(len(port)) {
+			end = int64(len(port))
+		}
+		return &compute.SerialPortOutput{Start: start, Contents: port[start:end], Next: end}, nil
+	}
+
+	var out bytes.Buffer
+	next, err := tailSerialPort(&out, 0, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != int64(len(port)) {
+		t.Errorf("expected to continue from %d, got %d", len(port), next)
+	}
+	if s := out.String(); s != "\n[10 bytes of console output dropped]\nbooting\nready\n" {
+		t.Errorf("unexpected output %q", s)
+	}
+
+	port += "listening\n"
+	out.Reset()
+	next, err = tailSerialPort(&out, next, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "listening\n" || next != int64(len(port)) {
+		t.Errorf("unexpected output %q up to %d", out.String(), next)
+	}
+
+	_, err = tailSerialPort(&out, next, func(start int64) (*compute.SerialPortOutput, error) {
+		return nil, errors.New("not found")
+	})
+	if err == nil {
+		t.Error("expected the fetch error")
+	}
+}
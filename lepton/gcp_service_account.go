@@ -0,0 +1,51 @@
+package lepton
+
+import (
+	"strings"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+// gcpScopePrefix is the prefix of the oauth scopes given by their short name,
+// e.g. devstorage.read_only
+const gcpScopePrefix = "https://www.googleapis.com/auth/"
+
+// gcpDefaultScope lets the service account of an instance use every api its
+// iam roles allow
+const gcpDefaultScope = gcpScopePrefix + "cloud-platform"
+
+// gcpScopes returns the oauth scopes of the config as urls, cloud-platform
+// if none is set
+func gcpScopes(c *Config) []string {
+	if len(c.CloudConfig.Scopes) == 0 {
+		return []string{gcpDefaultScope}
+	}
+
+	var scopes []string
+	for _, scope := range c.CloudConfig.Scopes {
+		if !strings.Contains(scope, "://") {
+			scope = gcpScopePrefix + scope
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes
+}
+
+// gcpServiceAccounts returns the service account instances of the config run
+// as, with its scopes. Instances run without service account unless the
+// config sets one or scopes, the default compute service account being used
+// for scopes alone
+func gcpServiceAccounts(c *Config) []*compute.ServiceAccount {
+	if c.CloudConfig.ServiceAccount == "" && len(c.CloudConfig.Scopes) == 0 {
+		return nil
+	}
+
+	email := c.CloudConfig.ServiceAccount
+	if email == "" {
+		email = "default"
+	}
+
+	return []*compute.ServiceAccount{
+		{Email: email, Scopes: gcpScopes(c)},
+	}
+}
@@ -0,0 +1,27 @@
+package lepton
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGCPServiceAccounts(t *testing.T) {
+	c := NewConfig()
+	if accounts := gcpServiceAccounts(c); accounts != nil {
+		t.Errorf("expected no service account, got %v", accounts)
+	}
+
+	c.CloudConfig.ServiceAccount = "worker@project.iam.gserviceaccount.com"
+	accounts := gcpServiceAccounts(c)
+	if len(accounts) != 1 || accounts[0].Email != c.CloudConfig.ServiceAccount || !reflect.DeepEqual(accounts[0].Scopes, []string{gcpDefaultScope}) {
+		t.Errorf("unexpected service accounts %+v", accounts[0])
+	}
+
+	c.CloudConfig.ServiceAccount = ""
+	c.CloudConfig.Scopes = []string{"devstorage.read_only", "https://www.googleapis.com/auth/pubsub"}
+	accounts = gcpServiceAccounts(c)
+	expected := []string{"https://www.googleapis.com/auth/devstorage.read_only", "https://www.googleapis.com/auth/pubsub"}
+	if len(accounts) != 1 || accounts[0].Email != "default" || !reflect.DeepEqual(accounts[0].Scopes, expected) {
+		t.Errorf("unexpected service accounts %+v", accounts[0])
+	}
+}
@@ -44,7 +44,8 @@ func (g *GCloud) CreateVolume(config *Config, name, data, size, provider string)
 	}
 
 	img := &compute.Image{
-		Name: name,
+		Name:   name,
+		Labels: gcpDefaultLabels(config, nil),
 		RawDisk: &compute.ImageRawDisk{
 			Source: fmt.Sprintf(GCPStorageURL, config.CloudConfig.BucketName, arch),
 		},
@@ -62,6 +63,7 @@ func (g *GCloud) CreateVolume(config *Config, name, data, size, provider string)
 		Name:        name,
 		SourceImage: "global/images/" + name,
 		Type:        fmt.Sprintf("projects/%s/zones/%s/diskTypes/pd-standard", config.CloudConfig.ProjectID, config.CloudConfig.Zone),
+		Labels:      gcpDefaultLabels(config, nil),
 	}
 
 	_, err = g.Service.Disks.Insert(config.CloudConfig.ProjectID, config.CloudConfig.Zone, disk).Context(ctx).Do()
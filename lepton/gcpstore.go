@@ -13,7 +13,8 @@ import (
 // GCPStorage provides GCP storage related operations
 type GCPStorage struct{}
 
-// CopyToBucket copies archive to bucket
+// CopyToBucket copies archive to bucket. A raw disk image is archived as
+// it is streamed to the bucket, without writing the archive locally
 func (s *GCPStorage) CopyToBucket(config *Config, archPath string) error {
 
 	ctx := context.Background()
@@ -38,6 +39,19 @@ func (s *GCPStorage) CopyToBucket(config *Config, archPath string) error {
 		fmt.Println("bucket found:", config.CloudConfig.BucketName)
 	}
 
+	if !isArchive(archPath) {
+		// cancelling the upload keeps a partial archive from being stored
+		uploadCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		wr := bucket.Object(config.CloudConfig.ImageName + ".tar.gz").NewWriter(uploadCtx)
+		if err = writeDiskArchive(wr, archPath); err != nil {
+			cancel()
+			return err
+		}
+		return wr.Close()
+	}
+
 	wr := bucket.Object(filepath.Base(archPath)).NewWriter(ctx)
 	f, err := os.Open(archPath)
 	if err != nil {
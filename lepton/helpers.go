@@ -175,7 +175,8 @@ func CustomRelTime(a, b time.Time, albl, blbl string, magnitudes []RelTimeMagnit
 	return fmt.Sprintf(mag.Format, args...)
 }
 
-func bytes2Human(b int64) string {
+// Bytes2Human returns the size in a human readable form, e.g. 1.2 GB
+func Bytes2Human(b int64) string {
 	const unit = 1000
 	if b < unit {
 		return fmt.Sprintf("%d B", b)
@@ -189,7 +190,8 @@ func bytes2Human(b int64) string {
 		float64(b)/float64(div), "kMGTPE"[exp])
 }
 
-func parseBytes(s string) (int64, error) {
+// ParseBytes returns the bytes of a human readable size, e.g. 10GB or 512mi
+func ParseBytes(s string) (int64, error) {
 	lastDigit := 0
 	hasComma := false
 	for _, r := range s {
@@ -258,6 +258,14 @@ func addFromConfig(m *Manifest, c *Config) error {
 		m.AddDebugFlag(dbg, 't')
 	}
 
+	kernelArgs, err := ParseKernelArgs(c.RunConfig.KernelArgs)
+	if err != nil {
+		return err
+	}
+	for k, v := range kernelArgs {
+		m.AddKernelArg(k, v)
+	}
+
 	for _, syscallName := range c.NoTrace {
 		m.AddNoTrace(syscallName)
 	}
@@ -337,6 +345,27 @@ func buildImage(c *Config, m *Manifest) error {
 		}
 	}
 
+	// unchanged files and config produce the same image, unless the
+	// fingerprint can't be computed, e.g. a file is missing and mkfs reports it
+	fingerprint, fingerprintErr := manifestFingerprint(c, m)
+	if fingerprintErr == nil && imageUpToDate(c.RunConfig.Imagename, fingerprint) {
+		NewConfigLogger(c).Info("%s is up to date, build skipped", c.RunConfig.Imagename)
+		return nil
+	}
+
+	// a failed build leaves no fingerprint behind
+	os.Remove(imageFingerprintPath(c.RunConfig.Imagename))
+
+	required, err := imageSpaceRequired(c, m)
+	if err != nil {
+		return errors.Wrap(err, 1)
+	}
+
+	err = checkFreeSpace(filepath.Dir(c.RunConfig.Imagename), required, "the image")
+	if err != nil {
+		return errors.Wrap(err, 1)
+	}
+
 	// produce final image, boot + kernel + elf
 	fd, err := createFile(c.RunConfig.Imagename)
 	defer func() {
@@ -378,6 +407,10 @@ func buildImage(c *Config, m *Manifest) error {
 		return errors.Wrap(err, 1)
 	}
 
+	if fingerprintErr == nil {
+		fingerprint.save(c.RunConfig.Imagename)
+	}
+
 	return nil
 }
 
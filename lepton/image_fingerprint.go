@@ -0,0 +1,189 @@
+package lepton
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImageFingerprint identifies the inputs of a local image build, an image is
+// only rebuilt when they change or the image itself was written to, e.g. by
+// an instance running it
+type ImageFingerprint struct {
+	Content  string    `json:"content"`  // sha256 of the files, kernel, boot and mkfs of the image
+	Config   string    `json:"config"`   // sha256 of the program, arguments, environment and mounts
+	Modified time.Time `json:"modified"` // of the image once built
+}
+
+// imageFingerprintPath returns the file recording the fingerprint of the
+// image at imagePath
+func imageFingerprintPath(imagePath string) string {
+	return imagePath + ".fingerprint"
+}
+
+// hashFile adds the name and the content of the host file to h
+func hashFile(h hash.Hash, name string, hostpath string) error {
+	fmt.Fprintf(h, "%s\x00", name)
+	if hostpath == "" {
+		return nil
+	}
+
+	f, err := os.Open(hostpath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(h, f)
+	return err
+}
+
+// hashTree adds the files and links of a manifest tree to h in path order
+func hashTree(h hash.Hash, prefix string, tree map[string]interface{}) error {
+	var names []string
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := prefix + "/" + name
+		switch v := tree[name].(type) {
+		case link:
+			fmt.Fprintf(h, "%s->%s\x00", p, v.path)
+		case string:
+			err := hashFile(h, p, v)
+			if err != nil {
+				return err
+			}
+		case map[string]interface{}:
+			fmt.Fprintf(h, "%s/\x00", p)
+			err := hashTree(h, p, v)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// sortedPairs returns the keys and values of m as sorted k=v pairs
+func sortedPairs(m map[string]string) []string {
+	var pairs []string
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// manifestFingerprint returns the fingerprint of the image built from the
+// manifest with the config, hashing the content of every file it contains
+func manifestFingerprint(c *Config, m *Manifest) (ImageFingerprint, error) {
+	content := sha256.New()
+
+	fmt.Fprintf(content, "root=%s size=%s\x00", c.TargetRoot, c.BaseVolumeSz)
+	for _, f := range []struct{ name, path string }{{"mkfs", c.Mkfs}, {"boot", c.Boot}} {
+		err := hashFile(content, f.name, f.path)
+		if err != nil {
+			return ImageFingerprint{}, err
+		}
+	}
+
+	err := hashTree(content, "boot:", m.boot)
+	if err != nil {
+		return ImageFingerprint{}, err
+	}
+
+	for _, klib := range m.klibs {
+		klibPath := GetOpsHome() + "/klib/" + klib
+		if _, err := os.Stat(klibPath); os.IsNotExist(err) {
+			klibPath = ""
+		}
+
+		err = hashFile(content, "klib:"+klib, klibPath)
+		if err != nil {
+			return ImageFingerprint{}, err
+		}
+	}
+
+	err = hashTree(content, "", m.children)
+	if err != nil {
+		return ImageFingerprint{}, err
+	}
+
+	debugFlags := map[string]string{}
+	for k, v := range m.debugFlags {
+		debugFlags[k] = string(v)
+	}
+
+	config, err := json.Marshal(map[string]interface{}{
+		"program":     m.program,
+		"arguments":   m.args,
+		"environment": sortedPairs(m.environment),
+		"debug":       sortedPairs(debugFlags),
+		"notrace":     m.noTrace,
+		"mounts":      sortedPairs(m.mounts),
+		"klibs":       strings.Join(m.klibs, ","),
+	})
+	if err != nil {
+		return ImageFingerprint{}, err
+	}
+
+	return ImageFingerprint{
+		Content: hex.EncodeToString(content.Sum(nil)),
+		Config:  fmt.Sprintf("%x", sha256.Sum256(config)),
+	}, nil
+}
+
+// loadImageFingerprint returns the fingerprint recorded by the last build of
+// the image at imagePath, nil if there's none
+func loadImageFingerprint(imagePath string) *ImageFingerprint {
+	data, err := ioutil.ReadFile(imageFingerprintPath(imagePath))
+	if err != nil {
+		return nil
+	}
+
+	fingerprint := &ImageFingerprint{}
+	if json.Unmarshal(data, fingerprint) != nil {
+		return nil
+	}
+	return fingerprint
+}
+
+// save records the fingerprint of the image at imagePath, just built
+func (f ImageFingerprint) save(imagePath string) error {
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		return err
+	}
+	f.Modified = info.ModTime()
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(imageFingerprintPath(imagePath), data, 0644)
+}
+
+// imageUpToDate returns true if the image at imagePath was built from inputs
+// with the fingerprint passed by argument and left untouched since
+func imageUpToDate(imagePath string, fingerprint ImageFingerprint) bool {
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		return false
+	}
+
+	recorded := loadImageFingerprint(imagePath)
+	return recorded != nil && recorded.Content == fingerprint.Content && recorded.Config == fingerprint.Config &&
+		recorded.Modified.Equal(info.ModTime())
+}
@@ -0,0 +1,87 @@
+package lepton
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestImageFingerprint(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "test-ops-fingerprint-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	program := path.Join(tmp, "app")
+	err = ioutil.WriteFile(program, []byte("v1"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewConfig()
+	manifest := func(env string) *Manifest {
+		m := NewManifest("")
+		m.AddFile("/app", program)
+		m.AddEnvironmentVariable("MODE", env)
+		return m
+	}
+
+	built, err := manifestFingerprint(c, manifest("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reconfigured, err := manifestFingerprint(c, manifest("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reconfigured.Content != built.Content || reconfigured.Config == built.Config {
+		t.Errorf("expected only the config to change, got %+v and %+v", built, reconfigured)
+	}
+
+	err = ioutil.WriteFile(program, []byte("v2"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := manifestFingerprint(c, manifest("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Content == built.Content || rebuilt.Config != built.Config {
+		t.Errorf("expected only the content to change, got %+v and %+v", built, rebuilt)
+	}
+
+	image := path.Join(tmp, "app.img")
+	if imageUpToDate(image, built) {
+		t.Error("expected a missing image to be built")
+	}
+
+	err = ioutil.WriteFile(image, []byte("image"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = built.save(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !imageUpToDate(image, built) {
+		t.Error("expected the image to be up to date")
+	}
+	if imageUpToDate(image, reconfigured) {
+		t.Error("expected a config change to rebuild the image")
+	}
+
+	// an instance ran the image and wrote to its filesystem
+	later := time.Now().Add(time.Minute)
+	err = os.Chtimes(image, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imageUpToDate(image, built) {
+		t.Error("expected a modified image to be rebuilt")
+	}
+}
@@ -0,0 +1,65 @@
+package lepton
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// imageDescription returns the description of images created with the config
+func imageDescription(c *Config) string {
+	if c.CloudConfig.ImageDescription != "" {
+		return c.CloudConfig.ImageDescription
+	}
+	return fmt.Sprintf("nanos image %s", c.CloudConfig.ImageName)
+}
+
+// imageMetadata returns the metadata of images created with the config
+// sorted by key
+func imageMetadata(c *Config) []Tag {
+	var metadata []Tag
+	for key, value := range c.CloudConfig.ImageMetadata {
+		metadata = append(metadata, Tag{Key: key, Value: value})
+	}
+
+	sort.Slice(metadata, func(i, j int) bool {
+		return metadata[i].Key < metadata[j].Key
+	})
+
+	return metadata
+}
+
+// gcpLabelValue converts s to a gcp label key or value: lowercase letters,
+// digits, underscores and dashes, at most 63 characters
+func gcpLabelValue(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, s)
+
+	if len(s) > 63 {
+		s = s[:63]
+	}
+
+	return s
+}
+
+// gcpImageLabels returns the metadata of images created with the config as
+// gcp labels
+func gcpImageLabels(c *Config) map[string]string {
+	if len(c.CloudConfig.ImageMetadata) == 0 {
+		return nil
+	}
+
+	labels := map[string]string{}
+	for _, tag := range imageMetadata(c) {
+		labels[gcpLabelValue(tag.Key)] = gcpLabelValue(tag.Value)
+	}
+
+	return labels
+}
@@ -0,0 +1,35 @@
+package lepton
+
+import "testing"
+
+func TestImageDescription(t *testing.T) {
+	c := NewConfig()
+	c.CloudConfig.ImageName = "api"
+
+	if got := imageDescription(c); got != "nanos image api" {
+		t.Errorf("got description %q", got)
+	}
+
+	c.CloudConfig.ImageDescription = "api server v1.2"
+	if got := imageDescription(c); got != "api server v1.2" {
+		t.Errorf("got description %q", got)
+	}
+}
+
+func TestGCPImageLabels(t *testing.T) {
+	c := NewConfig()
+
+	if labels := gcpImageLabels(c); labels != nil {
+		t.Errorf("expected no labels, got %v", labels)
+	}
+
+	c.CloudConfig.ImageMetadata = map[string]string{
+		"Team":   "Payments",
+		"commit": "v1.2/abc",
+	}
+
+	labels := gcpImageLabels(c)
+	if labels["team"] != "payments" || labels["commit"] != "v1_2_abc" || len(labels) != 2 {
+		t.Errorf("unexpected labels %v", labels)
+	}
+}
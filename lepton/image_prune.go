@@ -0,0 +1,68 @@
+package lepton
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// PruneOptions are the retention rules applied when pruning images
+type PruneOptions struct {
+	KeepLast  int           // newest images kept per name, 0 doesn't keep any
+	OlderThan time.Duration // only images older are deleted, 0 deletes regardless of age
+	MaxSize   int64         // bytes the local images are pruned down to, oldest first, 0 for no limit (onprem)
+	DryRun    bool          // report the images without deleting them
+}
+
+// ImagePruner is implemented by providers able to delete images according
+// to retention rules
+type ImagePruner interface {
+	PruneImages(ctx *Context, opts PruneOptions) ([]CloudImage, error)
+}
+
+// pruneCandidate is an image considered for deletion
+type pruneCandidate struct {
+	ID      string
+	Name    string // images with the same name are counted together by KeepLast
+	Created time.Time
+}
+
+// validate checks at least one retention rule is set so a prune never
+// deletes every image
+func (o PruneOptions) validate() error {
+	if o.KeepLast < 0 || o.OlderThan < 0 || o.MaxSize < 0 {
+		return errors.New("retention rules can't be negative")
+	}
+
+	if o.KeepLast == 0 && o.OlderThan == 0 && o.MaxSize == 0 {
+		return errors.New("no retention rule, set the images to keep, their maximum age or size")
+	}
+
+	return nil
+}
+
+// selectPruned returns the images not among the newest KeepLast of their
+// name that are older than OlderThan
+func (o PruneOptions) selectPruned(images []pruneCandidate, now time.Time) []pruneCandidate {
+	sorted := append([]pruneCandidate{}, images...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Created.After(sorted[j].Created)
+	})
+
+	var pruned []pruneCandidate
+	seen := map[string]int{}
+	for _, image := range sorted {
+		seen[image.Name]++
+		if seen[image.Name] <= o.KeepLast {
+			continue
+		}
+
+		if o.OlderThan > 0 && now.Sub(image.Created) <= o.OlderThan {
+			continue
+		}
+
+		pruned = append(pruned, image)
+	}
+
+	return pruned
+}
@@ -0,0 +1,53 @@
+package lepton
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPruneOptionsSelectPruned(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	images := []pruneCandidate{
+		{ID: "a1", Name: "a", Created: now.Add(-1 * day)},
+		{ID: "a2", Name: "a", Created: now.Add(-10 * day)},
+		{ID: "a3", Name: "a", Created: now.Add(-40 * day)},
+		{ID: "b1", Name: "b", Created: now.Add(-50 * day)},
+	}
+
+	var tests = []struct {
+		opts PruneOptions
+		want []string
+	}{
+		{PruneOptions{KeepLast: 1}, []string{"a2", "a3"}},
+		{PruneOptions{OlderThan: 30 * day}, []string{"a3", "b1"}},
+		{PruneOptions{KeepLast: 1, OlderThan: 30 * day}, []string{"a3"}},
+		{PruneOptions{KeepLast: 3}, nil},
+	}
+
+	for _, tt := range tests {
+		pruned := tt.opts.selectPruned(images, now)
+
+		var got []string
+		for _, image := range pruned {
+			got = append(got, image.ID)
+		}
+
+		if len(got) != len(tt.want) {
+			t.Errorf("selectPruned(%+v) = %v, want %v", tt.opts, got, tt.want)
+			continue
+		}
+
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("selectPruned(%+v) = %v, want %v", tt.opts, got, tt.want)
+				break
+			}
+		}
+	}
+
+	if (PruneOptions{}).validate() == nil {
+		t.Error("expected error validating options without retention rules")
+	}
+}
@@ -0,0 +1,144 @@
+package lepton
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LocalImage is an image built on the host
+type LocalImage struct {
+	Name    string
+	Path    string
+	Size    int64
+	Created time.Time
+}
+
+// ImageStore manages images built on the host
+type ImageStore interface {
+	List() ([]LocalImage, error)
+	Delete(name string) error
+	Prune(olderThan time.Duration, maxSize int64) ([]LocalImage, error)
+	Usage() (int64, error)
+}
+
+// DirImageStore implements ImageStore keeping images in a directory
+type DirImageStore struct {
+	path string
+}
+
+// NewLocalImageStore returns the store of images built in the ops home
+func NewLocalImageStore() *DirImageStore {
+	return &DirImageStore{path: localImageDir}
+}
+
+// List returns the images in the store sorted from newest to oldest
+func (s *DirImageStore) List() ([]LocalImage, error) {
+	var images []LocalImage
+
+	files, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return images, nil
+		}
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".img") {
+			continue
+		}
+
+		images = append(images, LocalImage{
+			Name:    f.Name(),
+			Path:    path.Join(s.path, f.Name()),
+			Size:    f.Size(),
+			Created: f.ModTime(),
+		})
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Created.After(images[j].Created)
+	})
+
+	return images, nil
+}
+
+// Delete removes the image with name from the store
+func (s *DirImageStore) Delete(name string) error {
+	if name != path.Base(name) {
+		return fmt.Errorf("invalid image name %s", name)
+	}
+
+	imagePath := path.Join(s.path, name)
+	os.Remove(imageFingerprintPath(imagePath))
+
+	return os.Remove(imagePath)
+}
+
+// Prune deletes images older than olderThan and then the oldest images until
+// the store uses at most maxSize bytes. Zero values disable each rule
+func (s *DirImageStore) Prune(olderThan time.Duration, maxSize int64) ([]LocalImage, error) {
+	var pruned []LocalImage
+
+	images, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, image := range selectLocalPruned(images, olderThan, maxSize, time.Now()) {
+		err = s.Delete(image.Name)
+		if err != nil {
+			return pruned, err
+		}
+
+		pruned = append(pruned, image)
+	}
+
+	return pruned, nil
+}
+
+// selectLocalPruned returns the images, sorted from newest to oldest, older
+// than olderThan and then the oldest ones until the rest uses at most maxSize
+// bytes. Zero values disable each rule
+func selectLocalPruned(images []LocalImage, olderThan time.Duration, maxSize int64, now time.Time) []LocalImage {
+	var total int64
+	for _, image := range images {
+		total += image.Size
+	}
+
+	var pruned []LocalImage
+	for i := len(images) - 1; i >= 0; i-- {
+		image := images[i]
+
+		expired := olderThan > 0 && now.Sub(image.Created) > olderThan
+		oversized := maxSize > 0 && total > maxSize
+		if !expired && !oversized {
+			continue
+		}
+
+		total -= image.Size
+		pruned = append(pruned, image)
+	}
+
+	return pruned
+}
+
+// Usage returns the bytes used by the images in the store
+func (s *DirImageStore) Usage() (int64, error) {
+	images, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, image := range images {
+		total += image.Size
+	}
+
+	return total, nil
+}
@@ -0,0 +1,147 @@
+package lepton
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDirImageStorePrune(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "test-ops-images-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	now := time.Now()
+	files := []struct {
+		name string
+		age  time.Duration
+	}{
+		{"new.img", time.Hour},
+		{"mid.img", 2 * Day},
+		{"old.img", 10 * Day},
+	}
+	for _, f := range files {
+		p := path.Join(tmp, f.name)
+		err = ioutil.WriteFile(p, make([]byte, 100), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(p, now.Add(-f.age), now.Add(-f.age))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := &DirImageStore{path: tmp}
+
+	images, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 3 || images[0].Name != "new.img" {
+		t.Fatalf("expected 3 images sorted by creation, got %+v", images)
+	}
+
+	pruned, err := store.Prune(5*Day, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].Name != "old.img" {
+		t.Errorf("expected old.img to be pruned by age, got %+v", pruned)
+	}
+
+	pruned, err = store.Prune(0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].Name != "mid.img" {
+		t.Errorf("expected mid.img to be pruned by size, got %+v", pruned)
+	}
+
+	usage, err := store.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != 100 {
+		t.Errorf("expected usage of 100 bytes, got %d", usage)
+	}
+}
+
+func TestOnPremPruneImages(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "test-ops-images-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	imageDir := localImageDir
+	localImageDir = tmp
+	defer func() { localImageDir = imageDir }()
+
+	now := time.Now()
+	for _, f := range []struct {
+		name string
+		age  time.Duration
+	}{
+		{"new.img", time.Hour},
+		{"mid.img", 2 * Day},
+		{"old.img", 10 * Day},
+	} {
+		p := path.Join(tmp, f.name)
+		err = ioutil.WriteFile(p, make([]byte, 100), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(p, now.Add(-f.age), now.Add(-f.age))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := &OnPrem{}
+	ctx := NewContext(NewConfig(), nil)
+
+	images, err := p.GetImages(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 3 || images[0].ID != "new.img" || images[0].Path != path.Join(tmp, "new.img") || images[0].Size != 100 || images[0].Status != "" {
+		t.Fatalf("expected the local images with their path and size, got %+v", images)
+	}
+
+	names := func(images []CloudImage) []string {
+		var names []string
+		for _, image := range images {
+			names = append(names, image.Name)
+		}
+		return names
+	}
+
+	pruned, err := p.PruneImages(ctx, PruneOptions{MaxSize: 150, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(pruned); len(got) != 2 || got[0] != "old.img" || got[1] != "mid.img" {
+		t.Errorf("expected the oldest images over the size to be pruned, got %v", got)
+	}
+
+	pruned, err = p.PruneImages(ctx, PruneOptions{OlderThan: 5 * Day, MaxSize: 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(pruned); len(got) != 2 || got[0] != "old.img" || got[1] != "mid.img" {
+		t.Errorf("expected old.img to be pruned by age and mid.img by size, got %v", got)
+	}
+
+	usage, err := NewLocalImageStore().Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != 100 {
+		t.Errorf("expected usage of 100 bytes after the prune, got %d", usage)
+	}
+}
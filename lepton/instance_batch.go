@@ -0,0 +1,99 @@
+package lepton
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// instanceBatchConcurrency is the number of instances a batch acts on at
+// once, keeping providers from throttling large environments
+const instanceBatchConcurrency = 8
+
+// InstanceAction acts on an instance by name or id
+type InstanceAction func(ctx *Context, instance string) error
+
+// InstanceBatchResult is the outcome of an action on an instance of a batch
+type InstanceBatchResult struct {
+	Instance string
+	Err      error
+	Duration time.Duration
+}
+
+// RunInstanceBatch runs action on the instances concurrently and returns
+// their results in the order of instances. An instance failing doesn't stop
+// the others
+func RunInstanceBatch(ctx *Context, instances []string, action InstanceAction) []InstanceBatchResult {
+	results := make([]InstanceBatchResult, len(instances))
+	slots := make(chan struct{}, instanceBatchConcurrency)
+
+	var wg sync.WaitGroup
+	for i, instance := range instances {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(i int, instance string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			start := time.Now()
+			err := action(ctx, instance)
+			results[i] = InstanceBatchResult{Instance: instance, Err: err, Duration: time.Since(start)}
+		}(i, instance)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// StartInstances starts the instances of the provider concurrently
+func StartInstances(ctx *Context, p Provider, instances []string) []InstanceBatchResult {
+	return RunInstanceBatch(ctx, instances, p.StartInstance)
+}
+
+// StopInstances stops the instances of the provider concurrently
+func StopInstances(ctx *Context, p Provider, instances []string) []InstanceBatchResult {
+	return RunInstanceBatch(ctx, instances, p.StopInstance)
+}
+
+// InstanceBatchError returns an error naming the instances of the results
+// the action failed on, nil if it succeeded on all of them
+func InstanceBatchError(action string, results []InstanceBatchResult) error {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("failed to %s %d of %d instances", action, failed, len(results))
+}
+
+// WriteInstanceBatchSummary writes the results of a batch as a table
+func WriteInstanceBatchSummary(w io.Writer, results []InstanceBatchResult) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Instance", "Result", "Time"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
+	table.SetRowLine(true)
+
+	for _, result := range results {
+		outcome := "ok"
+		if result.Err != nil {
+			outcome = result.Err.Error()
+		}
+		table.Append([]string{result.Instance, outcome, result.Duration.Round(time.Millisecond).String()})
+	}
+
+	table.Render()
+}
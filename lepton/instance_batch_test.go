@@ -0,0 +1,60 @@
+package lepton
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunInstanceBatch(t *testing.T) {
+	var running, peak int32
+	action := func(ctx *Context, instance string) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+
+		if instance == "db" {
+			return errors.New("instance is protected")
+		}
+		return nil
+	}
+
+	instances := []string{"api", "db", "web", "worker-1", "worker-2", "worker-3", "worker-4", "worker-5", "worker-6", "worker-7"}
+	results := RunInstanceBatch(nil, instances, action)
+
+	if len(results) != len(instances) {
+		t.Fatalf("expected %d results, got %d", len(instances), len(results))
+	}
+	for i, result := range results {
+		if result.Instance != instances[i] {
+			t.Errorf("expected result %d for %s, got %s", i, instances[i], result.Instance)
+		}
+		if (result.Err != nil) != (result.Instance == "db") {
+			t.Errorf("unexpected result for %s: %v", result.Instance, result.Err)
+		}
+	}
+
+	if peak > instanceBatchConcurrency {
+		t.Errorf("expected at most %d concurrent actions, got %d", instanceBatchConcurrency, peak)
+	}
+
+	err := InstanceBatchError("stop", results)
+	if err == nil || err.Error() != "failed to stop 1 of 10 instances" {
+		t.Errorf("unexpected batch error %v", err)
+	}
+
+	var buf bytes.Buffer
+	WriteInstanceBatchSummary(&buf, results)
+	if !strings.Contains(buf.String(), "instance is protected") {
+		t.Errorf("expected the summary to show the failure, got\n%s", buf.String())
+	}
+}
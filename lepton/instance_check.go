@@ -0,0 +1,119 @@
+package lepton
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InstanceSpec declares the instances expected for a deployment
+type InstanceSpec struct {
+	Name  string // instance name, may contain wildcards like api-*
+	Count int    // instances expected to be running
+}
+
+// CheckResult summarizes how the instances of a deployment deviate from its spec
+type CheckResult struct {
+	Spec       InstanceSpec
+	Running    []CloudInstance
+	NotRunning []CloudInstance
+}
+
+// Check exit codes returned by CheckResult.ExitCode
+const (
+	CheckOK            = 0
+	CheckCountMismatch = 2
+	CheckNotRunning    = 3
+)
+
+// OK returns true if the deployment matches its spec
+func (r *CheckResult) OK() bool {
+	return r.ExitCode() == CheckOK
+}
+
+// ExitCode returns the process exit code reporting the deviation from the spec
+func (r *CheckResult) ExitCode() int {
+	if len(r.Running) != r.Spec.Count {
+		return CheckCountMismatch
+	}
+
+	if len(r.NotRunning) > 0 {
+		return CheckNotRunning
+	}
+
+	return CheckOK
+}
+
+// String returns a summary of the check
+func (r *CheckResult) String() string {
+	summary := fmt.Sprintf("%s: %d/%d instances running", r.Spec.Name, len(r.Running), r.Spec.Count)
+
+	if len(r.NotRunning) > 0 {
+		var states []string
+		for _, instance := range r.NotRunning {
+			states = append(states, fmt.Sprintf("%s (%s)", instance.Name, instance.Status))
+		}
+		summary += ", not running: " + strings.Join(states, ", ")
+	}
+
+	return summary
+}
+
+// isInstanceRunning returns true if status is the running state of any provider
+func isInstanceRunning(status string) bool {
+	switch strings.ToLower(status) {
+	case "running", "active", "ok":
+		return true
+	}
+	return false
+}
+
+// isInstanceGone returns true if status is the state of an aws instance being
+// or having been deleted, which is listed for about an hour. The gcp
+// TERMINATED state is a stopped instance, the states are matched exactly
+func isInstanceGone(status string) bool {
+	switch status {
+	case "terminated", "shutting-down":
+		return true
+	}
+	return false
+}
+
+// CheckInstances compares the instances of the provider matching the spec name
+// with the spec
+func CheckInstances(ctx *Context, p Provider, spec InstanceSpec) (*CheckResult, error) {
+	filters, err := ParseListFilters([]string{"Name=" + spec.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := p.GetInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := FilterInstances(instances, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkResult(spec, matched), nil
+}
+
+// checkResult sorts the instances matching the spec into running and not
+// running ones, deleted instances are left out
+func checkResult(spec InstanceSpec, matched []CloudInstance) *CheckResult {
+	result := &CheckResult{Spec: spec}
+	for _, instance := range matched {
+		if isInstanceGone(instance.Status) {
+			continue
+		}
+
+		if isInstanceRunning(instance.Status) {
+			result.Running = append(result.Running, instance)
+		} else {
+			result.NotRunning = append(result.NotRunning, instance)
+		}
+	}
+
+	return result
+}
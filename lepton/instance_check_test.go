@@ -0,0 +1,35 @@
+package lepton
+
+import "testing"
+
+func TestCheckResult(t *testing.T) {
+	spec := InstanceSpec{Name: "api-*", Count: 2}
+
+	result := checkResult(spec, []CloudInstance{
+		{Name: "api-1", Status: "running"},
+		{Name: "api-2", Status: "running"},
+		{Name: "api-0", Status: "terminated"},
+		{Name: "api-3", Status: "shutting-down"},
+	})
+	if !result.OK() {
+		t.Errorf("expected deleted instances to be left out, got %s", result)
+	}
+
+	result = checkResult(spec, []CloudInstance{
+		{Name: "api-1", Status: "running"},
+		{Name: "api-2", Status: "stopped"},
+		{Name: "api-3", Status: "TERMINATED"},
+	})
+	if result.ExitCode() != CheckCountMismatch || len(result.NotRunning) != 2 {
+		t.Errorf("expected stopped instances not running, got %s", result)
+	}
+
+	result = checkResult(spec, []CloudInstance{
+		{Name: "api-1", Status: "running"},
+		{Name: "api-2", Status: "RUNNING"},
+		{Name: "api-3", Status: "stopping"},
+	})
+	if result.ExitCode() != CheckNotRunning {
+		t.Errorf("expected a not running instance, got %s", result)
+	}
+}
@@ -0,0 +1,301 @@
+package lepton
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// ConfigDrift is a setting whose value in the local config differs from the
+// one an instance was created with
+type ConfigDrift struct {
+	Setting  string
+	Recorded string // empty if the setting wasn't set at creation
+	Current  string // empty if the setting isn't set in the local config
+}
+
+// InstanceConfigDiffer is implemented by providers recording the config
+// instances are created with, so the local config can be compared to it
+type InstanceConfigDiffer interface {
+	DiffInstanceConfig(ctx *Context, instanceName string) ([]ConfigDrift, error)
+	PrintInstanceConfigDiff(ctx *Context, instanceName string) error
+}
+
+// instanceConfig returns the settings of the config an instance is created
+// with, keyed by name, e.g. Flavor, Ports or InstanceEnv.PORT. Settings that
+// only affect how ops runs, like logging, aren't part of it and secrets like
+// environment values are replaced by their checksum. Providers recording it
+// implement InstanceConfigDiffer
+func instanceConfig(c *Config) (map[string]string, error) {
+	rc := c.RunConfig
+
+	key, err := checksumKey(c)
+	if err != nil {
+		return nil, err
+	}
+
+	clearRunSettings(&rc)
+
+	// instance names are generated or given on the command line
+	var tags []Tag
+	for _, tag := range rc.Tags {
+		if tag.Key != "Name" {
+			tags = append(tags, tag)
+		}
+	}
+	rc.Tags = tags
+
+	rc.InstanceEnv = checksumValues(key, rc.InstanceEnv)
+
+	if rc.UserData != "" {
+		data, err := ioutil.ReadFile(rc.UserData)
+		if err != nil {
+			return nil, fmt.Errorf("read user data %s: %v", rc.UserData, err)
+		}
+		rc.UserData = valueChecksum(key, data)
+	}
+
+	settings := map[string]interface{}{
+		"ImageName": c.CloudConfig.ImageName,
+		"Flavor":    c.CloudConfig.Flavor,
+	}
+
+	data, err := json.Marshal(rc)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &settings)
+	if err != nil {
+		return nil, err
+	}
+
+	flat := make(map[string]string)
+	flattenSettings(flat, "", settings)
+
+	return flat, nil
+}
+
+// clearRunSettings zeroes the settings of the run config tagged instance:"-",
+// which only affect how ops runs
+func clearRunSettings(rc *RunConfig) {
+	v := reflect.ValueOf(rc).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("instance") == "-" {
+			v.Field(i).Set(reflect.Zero(t.Field(i).Type))
+		}
+	}
+}
+
+// checksumKeyPath returns the file holding the key of the checksums of the
+// secret values of the project
+func checksumKeyPath(project string) string {
+	if project == "" {
+		project = "default"
+	}
+	return path.Join(GetOpsHome(), "keys", project+".key")
+}
+
+// checksumKey returns the key the checksums of the secret values of the
+// project of the config are computed with, generated on first use. The
+// checksums recorded from another machine only match with its key copied to
+// the ops home
+func checksumKey(c *Config) ([]byte, error) {
+	keyPath := checksumKeyPath(c.CloudConfig.Project)
+
+	key, err := ioutil.ReadFile(keyPath)
+	if err == nil {
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(path.Dir(keyPath), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(keyPath, key, 0600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// valueChecksum returns the checksum recorded in place of a secret value, a
+// keyed hash so values can't be guessed from the recorded checksum
+func valueChecksum(key []byte, data []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return fmt.Sprintf("hmac:%x", mac.Sum(nil))[:len("hmac:")+16]
+}
+
+// checksumValues returns the values replaced by their checksum, nil if there
+// are none
+func checksumValues(key []byte, values map[string]string) map[string]string {
+	if len(values) == 0 {
+		return nil
+	}
+
+	checksums := make(map[string]string)
+	for k, v := range values {
+		checksums[k] = valueChecksum(key, []byte(v))
+	}
+	return checksums
+}
+
+// flattenSettings adds the settings to flat keyed by their path, nested
+// objects being joined with dots. Unset settings are left out
+func flattenSettings(flat map[string]string, prefix string, settings map[string]interface{}) {
+	for k, v := range settings {
+		key := prefix + k
+
+		switch v := v.(type) {
+		case nil:
+		case bool:
+			if v {
+				flat[key] = "true"
+			}
+		case string:
+			if v != "" {
+				flat[key] = v
+			}
+		case float64:
+			if v != 0 {
+				flat[key] = fmt.Sprint(v)
+			}
+		case map[string]interface{}:
+			flattenSettings(flat, key+".", v)
+		default:
+			data, _ := json.Marshal(v)
+			if s := string(data); s != "[]" {
+				flat[key] = s
+			}
+		}
+	}
+}
+
+// diffInstanceConfig returns the settings whose current value differs from
+// the recorded one, sorted by name
+func diffInstanceConfig(recorded map[string]string, current map[string]string) []ConfigDrift {
+	var drift []ConfigDrift
+
+	for k, v := range recorded {
+		if current[k] != v {
+			drift = append(drift, ConfigDrift{Setting: k, Recorded: v, Current: current[k]})
+		}
+	}
+
+	for k, v := range current {
+		if _, ok := recorded[k]; !ok {
+			drift = append(drift, ConfigDrift{Setting: k, Current: v})
+		}
+	}
+
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].Setting < drift[j].Setting
+	})
+
+	return drift
+}
+
+// printConfigDrift prints the settings of the local config that drifted from
+// the config the instance was created with
+func printConfigDrift(ctx *Context, instanceName string, drift []ConfigDrift) {
+	if len(drift) == 0 {
+		ctx.logger.Log("No drift from the config instance %s was created with", instanceName)
+		return
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Setting", "Recorded", "Current"})
+	table.SetHeaderColor(
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
+		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
+	table.SetRowLine(true)
+
+	for _, d := range drift {
+		table.Append([]string{d.Setting, d.Recorded, d.Current})
+	}
+
+	table.Render()
+}
+
+// encodeInstanceConfig compresses the settings and splits them in chunks of
+// at most size characters, to be stored in tags or labels
+func encodeInstanceConfig(settings map[string]string, size int) ([]string, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	_, err = w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(b.Bytes())
+
+	var chunks []string
+	for len(encoded) > size {
+		chunks = append(chunks, encoded[:size])
+		encoded = encoded[size:]
+	}
+
+	return append(chunks, encoded), nil
+}
+
+// decodeInstanceConfig returns the settings encoded in the chunks
+func decodeInstanceConfig(chunks []string) (map[string]string, error) {
+	var encoded string
+	for _, chunk := range chunks {
+		encoded += chunk
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := make(map[string]string)
+	err = json.Unmarshal(data, &settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
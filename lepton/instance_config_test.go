@@ -0,0 +1,149 @@
+package lepton
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+func TestDiffInstanceConfig(t *testing.T) {
+	c := NewConfig()
+	c.CloudConfig.ImageName = "web"
+	c.CloudConfig.Flavor = "t3.small"
+	c.RunConfig.Ports = []int{80, 443}
+	c.RunConfig.InstanceEnv = map[string]string{"TOKEN": "secret"}
+	c.RunConfig.Tags = []Tag{{Key: "Name", Value: "web-1"}}
+	c.RunConfig.Verbose = true
+	c.RunConfig.WaitReachable = true
+	c.RunConfig.ReachableTimeout = 60
+	c.RunConfig.SmokeTests = []SmokeTest{{Type: "http", Port: 80}}
+
+	recorded, err := instanceConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if recorded["Ports"] != "[80,443]" || recorded["Flavor"] != "t3.small" {
+		t.Errorf("unexpected settings %v", recorded)
+	}
+
+	if env := recorded["InstanceEnv.TOKEN"]; env == "" || env == "secret" {
+		t.Errorf("expected the checksum of the environment value, got %q", env)
+	}
+
+	if _, ok := recorded["Verbose"]; ok {
+		t.Error("logging settings aren't instance settings")
+	}
+
+	for _, setting := range []string{"WaitReachable", "ReachableTimeout", "SmokeTests"} {
+		if _, ok := recorded[setting]; ok {
+			t.Errorf("%s only affects the deploy, it isn't an instance setting", setting)
+		}
+	}
+
+	if _, ok := recorded["Tags"]; ok {
+		t.Error("the instance name isn't an instance setting")
+	}
+
+	chunks, err := encodeInstanceConfig(recorded, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := decodeInstanceConfig(chunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(decoded, recorded) {
+		t.Errorf("expected %v, got %v", recorded, decoded)
+	}
+
+	c.CloudConfig.Flavor = "t3.large"
+	c.RunConfig.Ports = []int{80, 443}
+	c.RunConfig.InstanceEnv["TOKEN"] = "rotated"
+	c.RunConfig.EnableIPv6 = true
+	c.RunConfig.Verbose = false
+
+	current, err := instanceConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drift := diffInstanceConfig(recorded, current)
+
+	var settings []string
+	for _, d := range drift {
+		settings = append(settings, d.Setting)
+	}
+
+	expected := []string{"EnableIPv6", "Flavor", "InstanceEnv.TOKEN"}
+	if !reflect.DeepEqual(settings, expected) {
+		t.Errorf("expected drift of %v, got %v", expected, drift)
+	}
+
+	if drift[0].Recorded != "" || drift[0].Current != "true" {
+		t.Errorf("unexpected drift %v", drift[0])
+	}
+}
+
+func TestValueChecksumKey(t *testing.T) {
+	c := NewConfig()
+	c.CloudConfig.Project = "checksum-test"
+	defer os.Remove(checksumKeyPath(c.CloudConfig.Project))
+
+	key, err := checksumKey(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := checksumKey(c)
+	if err != nil || !bytes.Equal(key, again) {
+		t.Fatalf("expected the key of the project to be kept, %v", err)
+	}
+
+	checksum := valueChecksum(key, []byte("secret"))
+	if checksum != valueChecksum(again, []byte("secret")) {
+		t.Error("expected the same checksum with the same key")
+	}
+
+	// an unsalted hash of a guessed value doesn't match the checksum
+	if checksum == valueChecksum(nil, []byte("secret")) || checksum == valueChecksum([]byte("other"), []byte("secret")) {
+		t.Error("expected checksums to depend on the key")
+	}
+}
+
+func TestGCPRunConfigMetadata(t *testing.T) {
+	c := NewConfig()
+	c.CloudConfig.ImageName = "web"
+	c.CloudConfig.Flavor = "g1-small"
+	c.RunConfig.Ports = []int{8080}
+
+	p := &GCloud{}
+	items := p.runConfigMetadata(NewContext(c, nil))
+	if len(items) != 1 || items[0].Key != gcpRunConfigKey {
+		t.Fatalf("expected the config metadata item, got %v", items)
+	}
+
+	instance := &compute.Instance{Name: "web-1", Metadata: &compute.Metadata{Items: items}}
+	recorded, err := recordedGCPRunConfig(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := instanceConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if drift := diffInstanceConfig(recorded, current); len(drift) != 0 {
+		t.Errorf("expected no drift, got %v", drift)
+	}
+
+	if recorded, err := recordedGCPRunConfig(&compute.Instance{}); recorded != nil || err != nil {
+		t.Errorf("expected no config for an instance without metadata, got %v, %v", recorded, err)
+	}
+}
@@ -0,0 +1,47 @@
+package lepton
+
+import (
+	"errors"
+	"fmt"
+)
+
+// InstanceGroupService is implemented by providers able to run groups of
+// instances of an image scaled by their cpu utilization
+type InstanceGroupService interface {
+	CreateInstanceGroup(ctx *Context, group InstanceGroup) error
+	UpdateInstanceGroup(ctx *Context, group InstanceGroup, refresh bool) error
+	DeleteInstanceGroup(ctx *Context, name string) error
+}
+
+// InstanceGroup describes a group of instances launched from the image of
+// the cloud config, an auto scaling group on aws and a managed instance group
+// on gcp. On update negative values leave the current setting unchanged
+type InstanceGroup struct {
+	Name                   string
+	MinSize                int64
+	MaxSize                int64
+	DesiredCapacity        int64   // instances launched initially, defaults to MinSize
+	HealthCheckGracePeriod int64   // seconds before health checks of new instances count
+	TargetCPU              float64 // average cpu utilization percent kept by scaling, 0 disables it
+}
+
+// validate checks the sizes of a new group are consistent
+func (g *InstanceGroup) validate() error {
+	if g.Name == "" {
+		return errors.New("instance group name missing")
+	}
+
+	if g.MinSize < 0 || g.MaxSize < 1 || g.MinSize > g.MaxSize {
+		return fmt.Errorf("invalid group size %d-%d, expected 0 <= min <= max and max >= 1", g.MinSize, g.MaxSize)
+	}
+
+	if g.DesiredCapacity >= 0 && (g.DesiredCapacity < g.MinSize || g.DesiredCapacity > g.MaxSize) {
+		return fmt.Errorf("desired capacity %d outside of the group size %d-%d", g.DesiredCapacity, g.MinSize, g.MaxSize)
+	}
+
+	if g.TargetCPU < 0 || g.TargetCPU > 100 {
+		return fmt.Errorf("invalid target cpu %v, expected a percent", g.TargetCPU)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package lepton
+
+// instancePageSize is the number of instances providers list per page
+const instancePageSize = 500
+
+// InstancePageFunc receives the instances of a listing a page at a time, an
+// error stops the listing and is returned by it
+type InstancePageFunc func(page []CloudInstance) error
+
+// InstancePager is implemented by providers that list their instances a page
+// at a time, the instances of large fleets not being buffered
+type InstancePager interface {
+	EachInstancePage(ctx *Context, fn InstancePageFunc) error
+}
+
+// EachInstancePage calls fn with the pages of the instances of the provider
+// matching the filters of the config, in the order the provider lists them.
+// Providers that don't page their listing return their instances in a single
+// page
+func EachInstancePage(ctx *Context, p Provider, fn InstancePageFunc) error {
+	if pager, ok := p.(InstancePager); ok {
+		return pager.EachInstancePage(ctx, fn)
+	}
+
+	instances, err := p.GetInstances(ctx)
+	if err != nil || len(instances) == 0 {
+		return err
+	}
+
+	return fn(instances)
+}
@@ -0,0 +1,146 @@
+package lepton
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultWaitTimeout is the time in seconds instance create waits for the
+// instances to be ready if the run config doesn't set one
+const defaultWaitTimeout = 300
+
+// waitPollInterval is the delay between readiness checks
+const waitPollInterval = 2 * time.Second
+
+// dnsAddressTimeout is the time instance create waits for the address of an
+// instance to point its domain names to
+const dnsAddressTimeout = 2 * time.Minute
+
+// portDialTimeout is the time a connection to the port of an instance has to
+// be accepted in
+const portDialTimeout = 3 * time.Second
+
+// runningStatuses are the statuses of running instances, lowercased, across
+// providers
+var runningStatuses = []string{"running", "active", "poweredon"}
+
+// waitUntil calls check every interval until it reports the condition holds
+// or returns an error. Fails if the condition doesn't hold after timeout
+func waitUntil(timeout time.Duration, interval time.Duration, check func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		ok, err := check()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// instanceRunning returns true if the instance status is a running status.
+// Providers that don't report a status only return instances once created
+func instanceRunning(instance *CloudInstance) bool {
+	if instance.Status == "" {
+		return true
+	}
+
+	status := strings.ToLower(instance.Status)
+	for _, running := range runningStatuses {
+		if status == running {
+			return true
+		}
+	}
+
+	return false
+}
+
+// instanceAddress returns the address the port of the instance is checked on,
+// its first public ip or its first private ip if it has none
+func instanceAddress(instance *CloudInstance) string {
+	if len(instance.PublicIps) != 0 && instance.PublicIps[0] != "" {
+		return instance.PublicIps[0]
+	}
+	if len(instance.PrivateIps) != 0 {
+		return instance.PrivateIps[0]
+	}
+	return ""
+}
+
+// portResponds returns true if the port at address accepts tcp connections
+func portResponds(address string, port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(address, strconv.Itoa(port)), portDialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// WaitInstancesReady waits until the instances of the provider with the ids,
+// or names, passed by argument are running and, if the run config sets a
+// wait port, accept connections on it. Fails if an instance isn't ready
+// within the wait timeout of the run config
+func WaitInstancesReady(ctx *Context, p Provider, ids []string) error {
+	timeout := ctx.config.RunConfig.WaitTimeout
+	if timeout <= 0 {
+		timeout = defaultWaitTimeout
+	}
+	deadline := time.Now().Add(time.Duration(timeout) * time.Second)
+
+	port := ctx.config.RunConfig.WaitPort
+
+	for _, id := range ids {
+		ctx.progress(ProgressInstanceWait, id, ProgressStarted, ProgressUnknown, "waiting for the instance to run")
+
+		var running bool
+		err := waitUntil(time.Until(deadline), waitPollInterval, func() (bool, error) {
+			instance, err := p.GetInstanceByID(ctx, id)
+			if err != nil {
+				ctx.logger.Debug("get instance %s: %v", id, err)
+				return false, nil
+			}
+
+			if !instanceRunning(instance) {
+				return false, nil
+			}
+
+			if !running {
+				running = true
+				ctx.logger.Log("Instance %s running", id)
+			}
+
+			if port == 0 {
+				return true, nil
+			}
+
+			address := instanceAddress(instance)
+			return address != "" && portResponds(address, port), nil
+		})
+		if err != nil {
+			ctx.progress(ProgressInstanceWait, id, ProgressFailed, ProgressUnknown, "not ready after %d seconds", timeout)
+			if running {
+				return fmt.Errorf("instance %s not responding on port %d after %d seconds", id, port, timeout)
+			}
+			return fmt.Errorf("instance %s not running after %d seconds", id, timeout)
+		}
+
+		ctx.progress(ProgressInstanceWait, id, ProgressDone, 100, "")
+		if port != 0 {
+			ctx.logger.Log("Instance %s responding on port %d", id, port)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package lepton
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitUntil(t *testing.T) {
+	checks := 0
+	err := waitUntil(time.Second, time.Millisecond, func() (bool, error) {
+		checks++
+		return checks == 3, nil
+	})
+	if err != nil || checks != 3 {
+		t.Errorf("expected the condition to hold after 3 checks, got %d checks and %v", checks, err)
+	}
+
+	err = waitUntil(10*time.Millisecond, time.Millisecond, func() (bool, error) {
+		return false, nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+
+	failed := errors.New("instance terminated")
+	err = waitUntil(time.Second, time.Millisecond, func() (bool, error) {
+		return false, failed
+	})
+	if err != failed {
+		t.Errorf("expected the error of the check, got %v", err)
+	}
+}
+
+func TestInstanceReadiness(t *testing.T) {
+	for status, running := range map[string]bool{"running": true, "RUNNING": true, "ACTIVE": true, "poweredOn": true, "pending": false, "STAGING": false} {
+		if instanceRunning(&CloudInstance{Status: status}) != running {
+			t.Errorf("unexpected readiness of an instance %s", status)
+		}
+	}
+
+	if address := instanceAddress(&CloudInstance{PrivateIps: []string{"10.0.0.4"}}); address != "10.0.0.4" {
+		t.Errorf("expected the private ip of an instance without public ip, got %q", address)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	if !portResponds("127.0.0.1", port) {
+		t.Error("expected the port to respond")
+	}
+
+	l.Close()
+
+	if portResponds("127.0.0.1", port) {
+		t.Error("expected the closed port not to respond")
+	}
+}
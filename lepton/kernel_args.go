@@ -0,0 +1,92 @@
+package lepton
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseKernelArgs returns the kernel argument overrides keyed by name, given
+// as name=value or as a name alone for flags, set to t like the debug flags
+// of image manifests
+func ParseKernelArgs(args []string) (map[string]string, error) {
+	overrides := map[string]string{}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+
+		name := strings.TrimSpace(parts[0])
+		if !validKernelArgName(name) {
+			return nil, fmt.Errorf("invalid kernel argument %q, expected name or name=value", arg)
+		}
+
+		value := "t"
+		if len(parts) == 2 {
+			value = strings.TrimSpace(parts[1])
+		}
+		overrides[name] = value
+	}
+	return overrides, nil
+}
+
+// validKernelArgName returns true if name is a manifest key, lowercase
+// letters, digits and underscores
+func validKernelArgName(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckKernelArgs returns an error if the run config has invalid kernel
+// argument overrides
+func CheckKernelArgs(c *Config) error {
+	_, err := ParseKernelArgs(c.RunConfig.KernelArgs)
+	return err
+}
+
+// KernelArgsImageName returns the name of the variant of the image with the
+// kernel argument overrides baked in its manifest, e.g. api-trace. Image
+// create names the variants it builds with it and instance create launches
+// them, the overrides being read by the kernel from the manifest root like
+// the debug flags
+func KernelArgsImageName(imageName string, args []string) (string, error) {
+	overrides, err := ParseKernelArgs(args)
+	if err != nil {
+		return "", err
+	}
+
+	var names []string
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	variant := imageName
+	for _, name := range names {
+		variant += "-" + kernelArgNamePart(name)
+		if value := overrides[name]; value != "t" {
+			variant += "-" + kernelArgNamePart(value)
+		}
+	}
+	return variant, nil
+}
+
+// kernelArgNamePart returns s usable in the image names of every provider,
+// lowercase letters, digits and hyphens
+func kernelArgNamePart(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, s)
+}
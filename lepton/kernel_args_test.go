@@ -0,0 +1,69 @@
+package lepton
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKernelArgs(t *testing.T) {
+	overrides, err := ParseKernelArgs([]string{"trace", "futex_trace", "syscall_summary=f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{"trace": "t", "futex_trace": "t", "syscall_summary": "f"}
+	if !reflect.DeepEqual(overrides, expected) {
+		t.Errorf("expected %v, got %v", expected, overrides)
+	}
+
+	for _, invalid := range []string{"", "=t", "Trace", "trace flag"} {
+		if _, err := ParseKernelArgs([]string{invalid}); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestKernelArgsManifest(t *testing.T) {
+	c := NewConfig()
+	c.RunConfig.KernelArgs = []string{"trace", "syscall_summary=f"}
+
+	m := NewManifest("")
+	err := addFromConfig(m, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the overrides are root entries of the manifest, like the debug flags
+	manifest := m.String()
+	for _, entry := range []string{"\ntrace:t\n", "\nsyscall_summary:f\n"} {
+		if !strings.Contains(manifest, entry) {
+			t.Errorf("expected %q in the manifest:\n%s", entry, manifest)
+		}
+	}
+
+	c.RunConfig.KernelArgs = []string{"Trace"}
+	if err := addFromConfig(NewManifest(""), c); err == nil {
+		t.Error("expected an invalid kernel argument to be refused")
+	}
+}
+
+func TestKernelArgsImageName(t *testing.T) {
+	name, err := KernelArgsImageName("api", []string{"trace", "futex_trace", "syscall_summary=f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "api-futex-trace-syscall-summary-f-trace" {
+		t.Errorf("unexpected image name %s", name)
+	}
+
+	// the same overrides in any order name the same image
+	other, _ := KernelArgsImageName("api", []string{"syscall_summary=f", "trace", "futex_trace"})
+	if other != name {
+		t.Errorf("expected %s, got %s", name, other)
+	}
+
+	if _, err := KernelArgsImageName("api", []string{"trace flag"}); err == nil {
+		t.Error("expected an invalid kernel argument to be refused")
+	}
+}
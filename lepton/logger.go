@@ -1,22 +1,49 @@
 package lepton
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	"time"
+)
+
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
 )
 
 // Logger filters and prints messages to a destination
 type Logger struct {
-	output io.Writer
-	info   bool
-	warn   bool
-	err    bool
-	debug  bool
+	output   io.Writer
+	info     bool
+	warn     bool
+	err      bool
+	debug    bool
+	quiet    bool
+	json     bool
+	prefix   string
+	deployID string
+}
+
+// logEntry is a message written by a logger in the json format
+type logEntry struct {
+	Time     string            `json:"time"`
+	Level    string            `json:"level"`
+	DeployID string            `json:"deploy_id,omitempty"`
+	Message  string            `json:"msg"`
+	Progress *ProgressEvent    `json:"progress,omitempty"`
+	Summary  *OperationSummary `json:"summary,omitempty"`
 }
 
 // NewLogger returns an instance of Logger
 func NewLogger(output io.Writer) *Logger {
-	return &Logger{output, false, false, false, false}
+	return &Logger{output: output}
+}
+
+// SetOutput sets the destination of the messages
+func (l *Logger) SetOutput(output io.Writer) {
+	l.output = output
 }
 
 // SetInfo activates/deactivates info level
@@ -39,35 +66,125 @@ func (l *Logger) SetDebug(value bool) {
 	l.debug = value
 }
 
-// Log writes a message to the specified output
+// SetQuiet only lets error messages through, overriding the other levels
+func (l *Logger) SetQuiet(value bool) {
+	l.quiet = value
+}
+
+// SetFormat sets the format of the messages, text or json
+func (l *Logger) SetFormat(format string) error {
+	switch format {
+	case "", LogFormatText:
+		l.json = false
+	case LogFormatJSON:
+		l.json = true
+	default:
+		return fmt.Errorf("unknown log format %s, use text or json", format)
+	}
+	return nil
+}
+
+// SetPrefix sets the text written before every message, e.g. the deploy id
+// of the operation
+func (l *Logger) SetPrefix(value string) {
+	l.prefix = value
+}
+
+// SetDeployID sets the deploy id of the operation, written before text
+// messages and as a field of json ones
+func (l *Logger) SetDeployID(value string) {
+	l.deployID = value
+	l.prefix = "[" + value + "] "
+}
+
+// Log writes a message to the specified output unless the logger is quiet.
+// It's meant for the progress and outcome of operations
 func (l *Logger) Log(message string, a ...interface{}) {
-	fmt.Fprintf(l.output, message+"\n", a...)
+	if l.quiet {
+		return
+	}
+	l.write("log", "", message, a...)
+}
+
+// Progress writes a progress event, as an info message in the text format
+// and as a progress entry in the json one so tools can follow operations
+func (l *Logger) Progress(event ProgressEvent) {
+	if l.quiet {
+		return
+	}
+
+	if l.json {
+		l.writeJSON(logEntry{Level: "progress", Message: event.String(), Progress: &event})
+		return
+	}
+
+	if l.info {
+		l.write("info", ConsoleColors.Blue(), "%s", event.String())
+	}
+}
+
+// Summary writes the summary of an operation, as a line in the text format
+// and as a summary entry in the json one so automation can record it
+func (l *Logger) Summary(summary OperationSummary) {
+	if l.quiet {
+		return
+	}
+
+	if l.json {
+		l.writeJSON(logEntry{Level: "summary", Message: summary.String(), Summary: &summary})
+		return
+	}
+
+	l.write("log", "", "Summary: %s", summary.String())
+}
+
+// writeJSON writes an entry in the json format
+func (l *Logger) writeJSON(entry logEntry) {
+	entry.Time = time.Now().UTC().Format(time.RFC3339)
+	entry.DeployID = l.deployID
+
+	if b, err := json.Marshal(entry); err == nil {
+		fmt.Fprintf(l.output, "%s\n", b)
+	}
+}
+
+// write writes a message of the level, text messages in the color
+func (l *Logger) write(level string, color string, message string, a ...interface{}) {
+	if l.json {
+		l.writeJSON(logEntry{Level: level, Message: fmt.Sprintf(message, a...)})
+		return
+	}
+
+	if l.prefix != "" {
+		fmt.Fprint(l.output, l.prefix)
+	}
+	fmt.Fprintf(l.output, color+message+"\n", a...)
 }
 
 // Info checks info level is activated to write the message
 func (l *Logger) Info(message string, a ...interface{}) {
-	if l.info == true {
-		l.Log(ConsoleColors.Blue()+message, a...)
+	if l.info && !l.quiet {
+		l.write("info", ConsoleColors.Blue(), message, a...)
 	}
 }
 
 // Warn checks warn level is activated to write the message
 func (l *Logger) Warn(message string, a ...interface{}) {
-	if l.warn == true {
-		l.Log(ConsoleColors.Yellow()+message, a...)
+	if l.warn && !l.quiet {
+		l.write("warn", ConsoleColors.Yellow(), message, a...)
 	}
 }
 
 // Error checks error level is activated to write the message
 func (l *Logger) Error(message string, a ...interface{}) {
-	if l.err == true {
-		l.Log(ConsoleColors.Red()+message, a...)
+	if l.err {
+		l.write("error", ConsoleColors.Red(), message, a...)
 	}
 }
 
 // Debug checks debug level is activated to write the message
 func (l *Logger) Debug(message string, a ...interface{}) {
-	if l.debug == true {
-		l.Log(ConsoleColors.Cyan()+message, a...)
+	if l.debug && !l.quiet {
+		l.write("debug", ConsoleColors.Cyan(), message, a...)
 	}
 }
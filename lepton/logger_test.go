@@ -2,6 +2,7 @@ package lepton_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"testing"
 
 	"github.com/nanovms/ops/lepton"
@@ -142,4 +143,69 @@ func TestLogger(t *testing.T) {
 			t.Errorf("got %v want %v", got, want)
 		}
 	})
+
+	t.Run("Log should print the prefix", func(t *testing.T) {
+		var b bytes.Buffer
+		logger := lepton.NewLogger(&b)
+
+		logger.SetPrefix("[abc] ")
+		logger.Log("test %d%%", 1)
+
+		got := b.String()
+		want := "[abc] test 1%" + newline
+
+		if got != want {
+			t.Errorf("got %v want %v", got, want)
+		}
+	})
+
+	t.Run("Quiet should only print errors", func(t *testing.T) {
+		var b bytes.Buffer
+		logger := lepton.NewLogger(&b)
+
+		logger.SetInfo(true)
+		logger.SetError(true)
+		logger.SetQuiet(true)
+		logger.Log("test")
+		logger.Info("test")
+		logger.Error("failed")
+
+		got := b.String()
+		want := lepton.ConsoleColors.Red() + "failed" + newline
+
+		if got != want {
+			t.Errorf("got %v want %v", got, want)
+		}
+	})
+
+	t.Run("JSON format should print an object per message", func(t *testing.T) {
+		var b bytes.Buffer
+		logger := lepton.NewLogger(&b)
+
+		err := logger.SetFormat(lepton.LogFormatJSON)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logger.SetDeployID("abc")
+		logger.SetWarn(true)
+		logger.Warn("test %d", 1)
+
+		var entry map[string]string
+		err = json.Unmarshal(b.Bytes(), &entry)
+		if err != nil {
+			t.Fatalf("invalid json %q: %v", b.String(), err)
+		}
+
+		if entry["level"] != "warn" || entry["msg"] != "test 1" || entry["deploy_id"] != "abc" || entry["time"] == "" {
+			t.Errorf("unexpected entry %v", entry)
+		}
+	})
+
+	t.Run("SetFormat should reject unknown formats", func(t *testing.T) {
+		logger := lepton.NewLogger(nil)
+
+		if err := logger.SetFormat("xml"); err == nil {
+			t.Error("expected an error")
+		}
+	})
 }
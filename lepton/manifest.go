@@ -24,6 +24,7 @@ type Manifest struct {
 	program     string
 	args        []string
 	debugFlags  map[string]rune
+	kernelArgs  map[string]string
 	noTrace     []string
 	environment map[string]string
 	targetRoot  string
@@ -37,6 +38,7 @@ func NewManifest(targetRoot string) *Manifest {
 		boot:        make(map[string]interface{}),
 		children:    make(map[string]interface{}),
 		debugFlags:  make(map[string]rune),
+		kernelArgs:  make(map[string]string),
 		environment: make(map[string]string),
 		targetRoot:  targetRoot,
 		mounts:      make(map[string]string),
@@ -45,11 +47,7 @@ func NewManifest(targetRoot string) *Manifest {
 
 // AddUserProgram adds user program
 func (m *Manifest) AddUserProgram(imgpath string) {
-	parts := strings.Split(imgpath, "/")
-	if parts[0] == "." {
-		parts = parts[1:]
-	}
-	m.program = path.Join("/", path.Join(parts...))
+	m.program = path.Join("/", toVMPath(imgpath))
 	err := m.AddFile(m.program, imgpath)
 	if err != nil {
 		panic(err)
@@ -79,6 +77,12 @@ func (m *Manifest) AddDebugFlag(name string, value rune) {
 	m.debugFlags[name] = value
 }
 
+// AddKernelArg sets a kernel argument in the manifest root, read by the
+// kernel on boot like the debug flags
+func (m *Manifest) AddKernelArg(name string, value string) {
+	m.kernelArgs[name] = value
+}
+
 // AddNoTrace enables debug flags
 func (m *Manifest) AddNoTrace(name string) {
 	m.noTrace = append(m.noTrace, name)
@@ -104,11 +108,9 @@ func (m *Manifest) AddDirectory(dir string) error {
 		}
 
 		// if the path is relative then root it to image path
-		var vmpath string
-		if hostpath[0] != '/' {
-			vmpath = "/" + hostpath
-		} else {
-			vmpath = hostpath
+		vmpath := toVMPath(hostpath)
+		if vmpath[0] != '/' {
+			vmpath = "/" + vmpath
 		}
 
 		if (info.Mode() & os.ModeSymlink) != 0 {
@@ -161,7 +163,7 @@ func (m *Manifest) AddRelativeDirectory(src string) error {
 			return err
 		}
 
-		vmpath := "/" + strings.TrimPrefix(hostpath, src)
+		vmpath := "/" + toVMPath(strings.TrimPrefix(hostpath, src))
 
 		if (info.Mode() & os.ModeSymlink) != 0 {
 			info, err = os.Stat(hostpath)
@@ -224,6 +226,7 @@ func (m *Manifest) FileExists(filepath string) bool {
 
 // AddLink to add a file to manifest
 func (m *Manifest) AddLink(filepath string, hostpath string) error {
+	filepath = toVMPath(filepath)
 	parts := strings.FieldsFunc(filepath, func(c rune) bool { return c == '/' })
 	node := m.children
 
@@ -266,6 +269,7 @@ func (m *Manifest) AddLink(filepath string, hostpath string) error {
 
 // AddFile to add a file to manifest
 func (m *Manifest) AddFile(filepath string, hostpath string) error {
+	filepath = toVMPath(filepath)
 	parts := strings.FieldsFunc(filepath, func(c rune) bool { return c == '/' })
 	node := m.children
 
@@ -286,6 +290,7 @@ func (m *Manifest) AddFile(filepath string, hostpath string) error {
 	if pathtest != nil && reflect.TypeOf(pathtest).Kind() == reflect.String && pathtest != hostpath {
 		fmt.Printf("warning: overwriting existing file %s hostpath old: %s new: %s\n", filepath, pathtest, hostpath)
 	}
+	warnCaseCollision(node, parts[len(parts)-1], filepath)
 
 	_, err := lookupFile(m.targetRoot, hostpath)
 	if err != nil {
@@ -295,6 +300,7 @@ func (m *Manifest) AddFile(filepath string, hostpath string) error {
 		}
 		return err
 	}
+	warnCRLFScript(hostpath)
 
 	node[parts[len(parts)-1]] = hostpath
 	return nil
@@ -400,6 +406,14 @@ func (m *Manifest) String() string {
 		sb.WriteRune('\n')
 	}
 
+	// kernel arguments
+	for k, v := range m.kernelArgs {
+		sb.WriteString(k)
+		sb.WriteRune(':')
+		sb.WriteString(escapeValue(v))
+		sb.WriteRune('\n')
+	}
+
 	// notrace
 	if len(m.noTrace) > 0 {
 		sb.WriteString("notrace:[")
@@ -7,9 +7,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/olekukonko/tablewriter"
 )
@@ -46,7 +46,7 @@ func (p *OnPrem) ResizeImage(ctx *Context, imagename string, hbytes string) erro
 	opshome := GetOpsHome()
 	imgpath := path.Join(opshome, "images", imagename)
 
-	bytes, err := parseBytes(hbytes)
+	bytes, err := ParseBytes(hbytes)
 	if err != nil {
 		return err
 	}
@@ -56,18 +56,40 @@ func (p *OnPrem) ResizeImage(ctx *Context, imagename string, hbytes string) erro
 
 // GetImages return all images on prem
 func (p *OnPrem) GetImages(ctx *Context) ([]CloudImage, error) {
-	return nil, errors.New("un-implemented")
+	images, err := NewLocalImageStore().List()
+	if err != nil {
+		return nil, err
+	}
+
+	var cimages []CloudImage
+	for _, image := range images {
+		cimages = append(cimages, CloudImage{
+			ID:      image.Name,
+			Name:    image.Name,
+			Created: image.Created.Format(time.RFC3339),
+			Path:    image.Path,
+			Size:    image.Size,
+		})
+	}
+
+	return FilterImages(cimages, ctx.listFilters())
 }
 
 // ListImages on premise
 func (p *OnPrem) ListImages(ctx *Context) error {
-	opshome := GetOpsHome()
-	imgpath := path.Join(opshome, "images")
+	store := NewLocalImageStore()
 
-	if _, err := os.Stat(imgpath); os.IsNotExist(err) {
+	images, err := store.List()
+	if err != nil {
 		return err
 	}
 
+	// local images are listed relative to now unless a format is set
+	timeFormat := ctx.config.RunConfig.TimeFormat
+	if timeFormat == "" {
+		timeFormat = TimeFormatRelative
+	}
+
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Name", "Path", "Size", "CreatedAt"})
 	table.SetHeaderColor(
@@ -76,41 +98,111 @@ func (p *OnPrem) ListImages(ctx *Context) error {
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor},
 		tablewriter.Colors{tablewriter.Bold, tablewriter.FgCyanColor})
 	table.SetRowLine(true)
-	err := filepath.Walk(imgpath, func(hostpath string, info os.FileInfo, err error) error {
+
+	var count int
+	var total int64
+	for _, image := range images {
+		match, err := matchFilters(image.Name, "", ctx.listFilters())
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
-			return nil
-		}
-		name := info.Name()
-
-		if len(name) > 4 && strings.LastIndex(info.Name(), ".img") == len(name)-4 {
-			var row []string
-			row = append(row, info.Name())
-			row = append(row, hostpath)
-			row = append(row, bytes2Human(info.Size()))
-			row = append(row, time2Human(info.ModTime()))
-			table.Append(row)
+		if !match {
+			continue
 		}
-		return nil
-	})
-	if err != nil {
-		return err
+
+		var row []string
+		row = append(row, image.Name)
+		row = append(row, image.Path)
+		row = append(row, Bytes2Human(image.Size))
+		row = append(row, formatTime(image.Created, timeFormat))
+		table.Append(row)
+		count++
+		total += image.Size
 	}
+
 	table.Render()
+
+	fmt.Printf("%d images using %s\n", count, Bytes2Human(total))
+
 	return nil
 }
 
 // DeleteImage on premise
 func (p *OnPrem) DeleteImage(ctx *Context, imagename string) error {
-	opshome := GetOpsHome()
-	imgpath := path.Join(opshome, "images", imagename)
-	err := os.Remove(imgpath)
+	return NewLocalImageStore().Delete(imagename)
+}
+
+// PruneImages deletes the local images according to the retention rules.
+// Local images are overwritten when rebuilt so KeepLast counts all images.
+// MaxSize applies to the images the other rules keep
+func (p *OnPrem) PruneImages(ctx *Context, opts PruneOptions) ([]CloudImage, error) {
+	err := opts.validate()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+
+	store := NewLocalImageStore()
+
+	images, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	prunedImage := func(image LocalImage) CloudImage {
+		return CloudImage{
+			ID:      image.Name,
+			Name:    image.Name,
+			Created: time2Human(image.Created),
+			Path:    image.Path,
+			Size:    image.Size,
+		}
+	}
+
+	var pruned []CloudImage
+	remaining := images
+	if opts.KeepLast > 0 || opts.OlderThan > 0 {
+		byName := map[string]LocalImage{}
+		var candidates []pruneCandidate
+		for _, image := range images {
+			byName[image.Name] = image
+			candidates = append(candidates, pruneCandidate{ID: image.Name, Created: image.Created})
+		}
+
+		for _, candidate := range opts.selectPruned(candidates, now) {
+			if !opts.DryRun {
+				err = store.Delete(candidate.ID)
+				if err != nil {
+					return pruned, err
+				}
+			}
+
+			pruned = append(pruned, prunedImage(byName[candidate.ID]))
+			delete(byName, candidate.ID)
+		}
+
+		remaining = nil
+		for _, image := range images {
+			if _, ok := byName[image.Name]; ok {
+				remaining = append(remaining, image)
+			}
+		}
+	}
+
+	if opts.MaxSize > 0 {
+		var oversized []LocalImage
+		if opts.DryRun {
+			oversized = selectLocalPruned(remaining, 0, opts.MaxSize, now)
+		} else {
+			oversized, err = store.Prune(0, opts.MaxSize)
+		}
+
+		for _, image := range oversized {
+			pruned = append(pruned, prunedImage(image))
+		}
+	}
+
+	return pruned, err
 }
 
 // SyncImage syncs image from onprem to target provider provided in Context
@@ -145,14 +237,12 @@ func (p *OnPrem) CreateInstance(ctx *Context) error {
 
 	hypervisor := HypervisorInstance()
 	if hypervisor == nil {
-		fmt.Println("No hypervisor found on $PATH")
-		fmt.Println("Please install OPS using curl https://ops.city/get.sh -sSfL | sh")
-		os.Exit(1)
+		return errors.New("no hypervisor found on $PATH, please install OPS using curl https://ops.city/get.sh -sSfL | sh")
 	}
 
 	instancename := c.CloudConfig.ImageName
 
-	fmt.Printf("booting %s ...\n", instancename)
+	ctx.logger.Log("booting %s ...", instancename)
 
 	opshome := GetOpsHome()
 	imgpath := path.Join(opshome, "images", instancename)
@@ -171,6 +261,11 @@ func (p *OnPrem) GetInstanceByID(ctx *Context, id string) (*CloudInstance, error
 	return nil, errors.New("un-implemented")
 }
 
+// GetInstanceByName returns the instance with the name passed by argument if it exists
+func (p *OnPrem) GetInstanceByName(ctx *Context, name string) (*CloudInstance, error) {
+	return nil, errors.New("un-implemented")
+}
+
 // GetInstances return all instances on prem
 // TODO
 func (p *OnPrem) GetInstances(ctx *Context) ([]CloudInstance, error) {
@@ -196,8 +291,8 @@ func (p *OnPrem) ListInstances(ctx *Context) error {
 	instances := path.Join(opshome, "instances")
 
 	files, err := ioutil.ReadDir(instances)
-	if err != nil {
-		fmt.Println(err)
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
 
 	for _, f := range files {
@@ -206,7 +301,7 @@ func (p *OnPrem) ListInstances(ctx *Context) error {
 		fullpath := path.Join(instances, f.Name())
 		body, err := ioutil.ReadFile(fullpath)
 		if err != nil {
-			fmt.Println(err)
+			return err
 		}
 
 		var i instance
@@ -242,18 +337,23 @@ func (p *OnPrem) StopInstance(ctx *Context, instancename string) error {
 	return fmt.Errorf("Operation not supported")
 }
 
+// RebootInstance from on premise
+func (p *OnPrem) RebootInstance(ctx *Context, instancename string) error {
+	return fmt.Errorf("Operation not supported")
+}
+
 // DeleteInstance from on premise
 func (p *OnPrem) DeleteInstance(ctx *Context, instancename string) error {
 
 	pid, err := strconv.Atoi(instancename)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
 	// yolo
 	err = sysKill(pid)
 	if err != nil {
-		fmt.Println(err)
+		ctx.logger.Warn("cannot kill instance %s: %v", instancename, err)
 	}
 
 	opshome := GetOpsHome()
@@ -272,7 +372,7 @@ func (p *OnPrem) PrintInstanceLogs(ctx *Context, instancename string, watch bool
 	if err != nil {
 		return err
 	}
-	fmt.Printf(l)
+	fmt.Print(l)
 	return nil
 }
 
@@ -281,8 +381,7 @@ func (p *OnPrem) GetInstanceLogs(ctx *Context, instancename string) (string, err
 
 	body, err := ioutil.ReadFile("/tmp/" + instancename + ".log")
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		return "", err
 	}
 
 	return string(body), nil
@@ -31,7 +31,7 @@ func getOpenStackInstances(provider *gophercloud.ProviderClient, opts servers.Li
 		Region: os.Getenv("OS_REGION_NAME"),
 	})
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 
 	pager := servers.List(client, opts)
@@ -39,7 +39,6 @@ func getOpenStackInstances(provider *gophercloud.ProviderClient, opts servers.Li
 	err = pager.EachPage(func(page pagination.Page) (bool, error) {
 		serverList, err := servers.ExtractServers(page)
 		if err != nil {
-			fmt.Println(err)
 			return false, err
 		}
 
@@ -62,7 +61,7 @@ func getOpenStackInstances(provider *gophercloud.ProviderClient, opts servers.Li
 				ID:      s.ID,
 				Name:    s.Name,
 				Status:  s.Status,
-				Created: s.Created.Format("2006-01-02 15:04:05"),
+				Created: s.Created.Format(time.RFC3339),
 			}
 
 			if ipv4 != "" {
@@ -74,6 +73,9 @@ func getOpenStackInstances(provider *gophercloud.ProviderClient, opts servers.Li
 
 		return true, nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return cinstances, nil
 }
@@ -114,17 +116,12 @@ func (o *OpenStack) BuildImageWithPackage(ctx *Context, pkgpath string) (string,
 func (o *OpenStack) Initialize() error {
 
 	opts, err := openstack.AuthOptionsFromEnv()
-
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
 	o.provider, err = openstack.AuthenticatedClient(opts)
-	if err != nil {
-		fmt.Println(err)
-	}
-
-	return nil
+	return err
 }
 
 func (o *OpenStack) findImage(name string) (id string, err error) {
@@ -133,7 +130,7 @@ func (o *OpenStack) findImage(name string) (id string, err error) {
 		Region: os.Getenv("OS_REGION_NAME"),
 	})
 	if err != nil {
-		fmt.Println(err)
+		return "", err
 	}
 
 	listOpts := images.ListOpts{
@@ -142,12 +139,12 @@ func (o *OpenStack) findImage(name string) (id string, err error) {
 
 	allPages, err := images.List(imageClient, listOpts).AllPages()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	allImages, err := images.ExtractImages(allPages)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	// yolo
@@ -167,7 +164,7 @@ func (o *OpenStack) getImagesClient() (*gophercloud.ServiceClient, error) {
 	})
 }
 
-func (o *OpenStack) createImage(imagesClient *gophercloud.ServiceClient, imgName string) (*images.Image, error) {
+func (o *OpenStack) createImage(imagesClient *gophercloud.ServiceClient, imgName string, properties map[string]string) (*images.Image, error) {
 	visibility := images.ImageVisibilityPrivate
 
 	createOpts := images.CreateOpts{
@@ -175,6 +172,7 @@ func (o *OpenStack) createImage(imagesClient *gophercloud.ServiceClient, imgName
 		DiskFormat:      "raw",
 		ContainerFormat: "bare",
 		Visibility:      &visibility,
+		Properties:      properties,
 	}
 
 	return images.Create(imagesClient, createOpts).Extract()
@@ -197,16 +195,21 @@ func (o *OpenStack) CreateImage(ctx *Context) error {
 
 	imgName = strings.ReplaceAll(imgName, "-image", "")
 
-	fmt.Println("creating image:\t" + imgName)
+	ctx.logger.Log("creating image: %s", imgName)
 
 	imagesClient, err := o.getImagesClient()
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
-	image, err := o.createImage(imagesClient, imgName)
+	properties := map[string]string{"description": imageDescription(c)}
+	for _, tag := range imageMetadata(c) {
+		properties[tag.Key] = tag.Value
+	}
+
+	image, err := o.createImage(imagesClient, imgName, openstackDefaultMetadata(c, properties))
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
 	imagePath := localImageDir + "/" + imgName
@@ -226,19 +229,19 @@ func (o *OpenStack) GetImages(ctx *Context) ([]CloudImage, error) {
 		Region: os.Getenv("OS_REGION_NAME"),
 	})
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 
 	listOpts := images.ListOpts{}
 
 	allPages, err := images.List(imageClient, listOpts).AllPages()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	allImages, err := images.ExtractImages(allPages)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 
 	for _, image := range allImages {
@@ -246,13 +249,13 @@ func (o *OpenStack) GetImages(ctx *Context) ([]CloudImage, error) {
 		cimage := CloudImage{
 			Name:    image.Name,
 			Status:  string(image.Status),
-			Created: time2Human(image.CreatedAt),
+			Created: image.CreatedAt.Format(time.RFC3339),
 		}
 
 		cimages = append(cimages, cimage)
 	}
 
-	return cimages, nil
+	return FilterImages(cimages, ctx.listFilters())
 }
 
 // ListImages lists images on a datastore.
@@ -262,6 +265,7 @@ func (o *OpenStack) ListImages(ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	sortImagesByCreated(cimages)
 
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Name", "Status", "Created"})
@@ -276,7 +280,7 @@ func (o *OpenStack) ListImages(ctx *Context) error {
 
 		row = append(row, image.Name)
 		row = append(row, image.Status)
-		row = append(row, image.Created)
+		row = append(row, FormatTimestamp(image.Created, ctx.config.RunConfig.TimeFormat))
 
 		table.Append(row)
 	}
@@ -294,18 +298,16 @@ func (o *OpenStack) deleteImage(imagesClient *gophercloud.ServiceClient, imageID
 func (o *OpenStack) DeleteImage(ctx *Context, imagename string) error {
 	imageID, err := o.findImage(imagename)
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
 
 	imageClient, err := o.getImagesClient()
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
 	err = images.Delete(imageClient, imageID).ExtractErr()
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
 
@@ -314,14 +316,13 @@ func (o *OpenStack) DeleteImage(ctx *Context, imagename string) error {
 
 // SyncImage syncs image from provider to another provider
 func (o *OpenStack) SyncImage(config *Config, target Provider, image string) error {
-	fmt.Println("not yet implemented")
-	return nil
+	return errors.New("image sync is not yet implemented")
 }
 
 func (o *OpenStack) findFlavorByName(name string) (id string, err error) {
 	client, err := o.getComputeClient()
 	if err != nil {
-		fmt.Println(err)
+		return "", err
 	}
 
 	listOpts := flavors.ListOpts{
@@ -330,12 +331,16 @@ func (o *OpenStack) findFlavorByName(name string) (id string, err error) {
 
 	allPages, err := flavors.ListDetail(client, listOpts).AllPages()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	allFlavors, err := flavors.ExtractFlavors(allPages)
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+
+	if len(allFlavors) == 0 {
+		return "", errors.New("no flavors found")
 	}
 
 	if name == "" {
@@ -362,26 +367,24 @@ func (o *OpenStack) getComputeClient() (*gophercloud.ServiceClient, error) {
 func (o *OpenStack) CreateInstance(ctx *Context) error {
 	client, err := o.getComputeClient()
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
 	imageName := ctx.config.CloudConfig.ImageName
 
 	imageID, err := o.findImage(imageName)
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
 
-	fmt.Printf("deploying imageID %s", imageID)
+	ctx.logger.Log("deploying imageID %s", imageID)
 
 	flavorID, err := o.findFlavorByName(ctx.config.CloudConfig.Flavor)
-
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
-	fmt.Printf("\nDeploying flavorID %s", flavorID)
+	ctx.logger.Log("deploying flavorID %s", flavorID)
 
 	instanceName := imageName + "-" + strconv.FormatInt(time.Now().Unix(), 10)
 
@@ -391,6 +394,7 @@ func (o *OpenStack) CreateInstance(ctx *Context) error {
 		ImageRef:  imageID,
 		FlavorRef: flavorID,
 		AdminPass: "TODO",
+		Metadata:  openstackDefaultMetadata(ctx.config, nil),
 	}
 
 	var volumeSize int
@@ -407,27 +411,33 @@ func (o *OpenStack) CreateInstance(ctx *Context) error {
 		exitWithError(err.Error())
 	}
 
-	fmt.Printf("\nInstance Created Successfully. ID ---> %s | Name ---> %s\n", server.ID, instanceName)
+	ctx.logger.Log("Instance Created Successfully. ID ---> %s | Name ---> %s", server.ID, instanceName)
 
-	if ctx.config.RunConfig.DomainName != "" {
-		pollCount := 60
-		for pollCount > 0 {
-			fmt.Printf(".")
-			time.Sleep(2 * time.Second)
+	if ctx.config.RunConfig.Wait {
+		err = WaitInstancesReady(ctx, o, []string{server.ID})
+		if err != nil {
+			return err
+		}
+	}
 
-			instance, err := o.GetInstanceByID(ctx, server.Name)
-			if err != nil || len(instance.PublicIps) == 0 {
-				pollCount--
-				continue
+	if hasDomainNames(ctx.config) {
+		var instance *CloudInstance
+		err = waitUntil(dnsAddressTimeout, waitPollInterval, func() (bool, error) {
+			found, err := o.GetInstanceByID(ctx, server.ID)
+			if err != nil || len(found.PublicIps) == 0 {
+				return false, nil
 			}
 
-			if len(instance.PublicIps) != 0 {
-				err := CreateDNSRecord(ctx.config, instance.PublicIps[0], o)
-				if err != nil {
-					return err
-				}
-			}
-			return nil
+			instance = found
+			return true, nil
+		})
+		if err != nil {
+			return fmt.Errorf("address of instance %s: %v", server.ID, err)
+		}
+
+		err = CreateDNSRecord(ctx.config, instance.PublicIps[0], o)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -456,10 +466,27 @@ func (o *OpenStack) addBootFromVolumeParams(
 	}
 }
 
-// GetInstanceByID returns the instance with the id passed by argument if it exists
+// GetInstanceByID returns the instance with the server id passed by argument
+// if it exists. Ids matching no server are looked up as instance names
 func (o *OpenStack) GetInstanceByID(ctx *Context, id string) (*CloudInstance, error) {
+	instances, err := getOpenStackInstances(o.provider, servers.ListOpts{})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range instances {
+		if instances[i].ID == id {
+			return &instances[i], nil
+		}
+	}
+
+	return o.GetInstanceByName(ctx, id)
+}
+
+// GetInstanceByName returns the instance with the name passed by argument if it exists
+func (o *OpenStack) GetInstanceByName(ctx *Context, name string) (*CloudInstance, error) {
 	opts := servers.ListOpts{
-		Name: id,
+		Name: name,
 	}
 
 	instances, err := getOpenStackInstances(o.provider, opts)
@@ -468,7 +495,7 @@ func (o *OpenStack) GetInstanceByID(ctx *Context, id string) (*CloudInstance, er
 	}
 
 	if len(instances) == 0 {
-		return nil, ErrInstanceNotFound(id)
+		return nil, ErrInstanceNotFound(name)
 	}
 
 	return &instances[0], nil
@@ -476,7 +503,12 @@ func (o *OpenStack) GetInstanceByID(ctx *Context, id string) (*CloudInstance, er
 
 // GetInstances return all instances on OpenStack
 func (o *OpenStack) GetInstances(ctx *Context) ([]CloudInstance, error) {
-	return getOpenStackInstances(o.provider, servers.ListOpts{})
+	cinstances, err := getOpenStackInstances(o.provider, servers.ListOpts{})
+	if err != nil {
+		return nil, err
+	}
+
+	return FilterInstances(cinstances, ctx.listFilters())
 }
 
 // ListInstances lists instances on OpenStack.
@@ -486,6 +518,7 @@ func (o *OpenStack) ListInstances(ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	sortInstancesByCreated(cinstances)
 
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"ID", "Name", "IP", "Status", "Created"})
@@ -504,7 +537,7 @@ func (o *OpenStack) ListInstances(ctx *Context) error {
 		row = append(row, instance.Name)
 		row = append(row, strings.Join(instance.PublicIps, ","))
 		row = append(row, instance.Status)
-		row = append(row, instance.Created)
+		row = append(row, FormatTimestamp(instance.Created, ctx.config.RunConfig.TimeFormat))
 
 		table.Append(row)
 	}
@@ -536,7 +569,7 @@ func (o *OpenStack) DeleteInstance(ctx *Context, instancename string) error {
 			result := servers.Delete(client, instance.ID).ExtractErr()
 
 			if result == nil {
-				fmt.Printf("Deleted instance with ID %s and name %s", instance.ID, instancename)
+				ctx.logger.Log("Deleted instance with ID %s and name %s", instance.ID, instancename)
 			} else {
 				exitWithError(result.Error())
 			}
@@ -551,40 +584,45 @@ func (o *OpenStack) DeleteInstance(ctx *Context, instancename string) error {
 func (o *OpenStack) StartInstance(ctx *Context, instancename string) error {
 	client, err := o.getComputeClient()
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
 	server, err := o.findInstance(instancename)
 	if err != nil {
-		fmt.Println(err)
-	}
-
-	err = startstop.Start(client, server.ID).ExtractErr()
-	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
-	return nil
+	return startstop.Start(client, server.ID).ExtractErr()
 }
 
 // StopInstance stops an instance from OpenStack
 func (o *OpenStack) StopInstance(ctx *Context, instancename string) error {
 	client, err := o.getComputeClient()
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
 	server, err := o.findInstance(instancename)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
-	err = startstop.Stop(client, server.ID).ExtractErr()
+	return startstop.Stop(client, server.ID).ExtractErr()
+}
+
+// RebootInstance reboots an instance from OpenStack
+func (o *OpenStack) RebootInstance(ctx *Context, instancename string) error {
+	client, err := o.getComputeClient()
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
-	return nil
+	server, err := o.findInstance(instancename)
+	if err != nil {
+		return err
+	}
+
+	return servers.Reboot(client, server.ID, servers.RebootOpts{Type: servers.SoftReboot}).ExtractErr()
 }
 
 func (o *OpenStack) findInstance(name string) (volume *servers.Server, err error) {
@@ -592,7 +630,7 @@ func (o *OpenStack) findInstance(name string) (volume *servers.Server, err error
 
 	client, err := o.getComputeClient()
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 
 	opts := servers.ListOpts{}
@@ -602,7 +640,6 @@ func (o *OpenStack) findInstance(name string) (volume *servers.Server, err error
 	err = pager.EachPage(func(page pagination.Page) (bool, error) {
 		serverList, err := servers.ExtractServers(page)
 		if err != nil {
-			fmt.Println(err)
 			return false, err
 		}
 
@@ -615,6 +652,9 @@ func (o *OpenStack) findInstance(name string) (volume *servers.Server, err error
 
 		return true, nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	if server != nil {
 		return server, nil
@@ -629,7 +669,7 @@ func (o *OpenStack) PrintInstanceLogs(ctx *Context, instancename string, watch b
 	if err != nil {
 		return err
 	}
-	fmt.Printf(l)
+	fmt.Print(l)
 	return nil
 }
 
@@ -11,12 +11,35 @@ import (
 
 // FindOrCreateZoneIDByName searches for a DNS zone with the name passed by argument and if it doesn't exist it creates one
 func (o *OpenStack) FindOrCreateZoneIDByName(config *Config, dnsName string) (string, error) {
+	zoneID, err := o.FindZoneIDByName(config, dnsName)
+	if err != nil || zoneID != "" {
+		return zoneID, err
+	}
+
 	dnsClient, err := o.getDNSClient()
 	if err != nil {
 		return "", err
 	}
 
-	var zoneID string
+	createOpts := zones.CreateOpts{
+		Name:  dnsName + ".",
+		Email: "admin@" + dnsName,
+	}
+	zone, err := zones.Create(dnsClient, createOpts).Extract()
+	if err != nil {
+		return "", err
+	}
+
+	return zone.ID, nil
+}
+
+// FindZoneIDByName returns the id of the DNS zone with the name passed by
+// argument, empty if there is none
+func (o *OpenStack) FindZoneIDByName(config *Config, dnsName string) (string, error) {
+	dnsClient, err := o.getDNSClient()
+	if err != nil {
+		return "", err
+	}
 
 	opts := zones.ListOpts{
 		Name: dnsName + ".",
@@ -27,26 +50,11 @@ func (o *OpenStack) FindOrCreateZoneIDByName(config *Config, dnsName string) (st
 	}
 
 	allZones, err := zones.ExtractZones(allPages)
-	if err != nil {
+	if err != nil || len(allZones) == 0 {
 		return "", err
 	}
 
-	if len(allZones) == 0 {
-		createOpts := zones.CreateOpts{
-			Name:  dnsName + ".",
-			Email: "admin@" + dnsName,
-		}
-		zone, err := zones.Create(dnsClient, createOpts).Extract()
-		if err != nil {
-			return "", err
-		}
-
-		zoneID = zone.ID
-	} else {
-		zoneID = allZones[0].ID
-	}
-
-	return zoneID, nil
+	return allZones[0].ID, nil
 }
 
 // DeleteZoneRecordIfExists deletes a record from a DNS zone if it exists
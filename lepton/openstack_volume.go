@@ -31,7 +31,7 @@ func (o *OpenStack) CreateVolume(config *Config, name, data, size, provider stri
 		return vol, err
 	}
 
-	image, err := o.createImage(imagesClient, name)
+	image, err := o.createImage(imagesClient, name, openstackDefaultMetadata(config, nil))
 	if err != nil {
 		return vol, err
 	}
@@ -62,9 +62,10 @@ func (o *OpenStack) CreateVolume(config *Config, name, data, size, provider stri
 	}
 
 	createOpts := volumes.CreateOpts{
-		Name:    name,
-		Size:    int(math.Round(sizeNum)),
-		ImageID: image.ID,
+		Name:     name,
+		Size:     int(math.Round(sizeNum)),
+		ImageID:  image.ID,
+		Metadata: openstackDefaultMetadata(config, nil),
 	}
 
 	response := volumes.Create(volumesClient, createOpts)
@@ -0,0 +1,115 @@
+package lepton
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// appPortEnv is the environment variable conventionally holding the port
+// the application listens on
+const appPortEnv = "PORT"
+
+// portRange is an inclusive range of ports
+type portRange struct {
+	from, to int
+	source   string
+}
+
+func (r portRange) contains(port int) bool {
+	return port >= r.from && port <= r.to
+}
+
+// appPort returns the port the application declares it listens on in the
+// environment of the image or of the instance, 0 if none is declared
+func appPort(c *Config) (int, string) {
+	for _, env := range []map[string]string{c.RunConfig.InstanceEnv, c.Env} {
+		if value, ok := env[appPortEnv]; ok {
+			port, err := strconv.Atoi(value)
+			if err == nil {
+				return port, value
+			}
+		}
+	}
+	return 0, ""
+}
+
+// checkPortList returns an error if a port is invalid or listed twice
+func checkPortList(protocol string, ports []int) error {
+	seen := map[int]bool{}
+	for _, port := range ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid %s port %d", protocol, port)
+		}
+		if seen[port] {
+			return fmt.Errorf("%s port %d listed twice", protocol, port)
+		}
+		seen[port] = true
+	}
+	return nil
+}
+
+// CheckPorts runs pre-flight checks on the ports opened by the run config.
+// Invalid or duplicated ports are returned as an error, likely mistakes like
+// overlapping ranges or the application port of the image not being opened
+// as warnings
+func CheckPorts(c *Config) ([]string, error) {
+	rc := &c.RunConfig
+	var warnings []string
+
+	err := checkPortList("tcp", rc.Ports)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkPortList("udp", rc.UDPPorts)
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges []portRange
+	for _, s := range rc.PortRanges {
+		from, to, err := ParsePortRange(s)
+		if err != nil {
+			return nil, err
+		}
+
+		r := portRange{from: from, to: to, source: s}
+		for _, other := range ranges {
+			if r.from <= other.to && other.from <= r.to {
+				warnings = append(warnings, fmt.Sprintf("port ranges %s and %s overlap", other.source, s))
+			}
+		}
+		ranges = append(ranges, r)
+	}
+
+	for _, port := range rc.Ports {
+		for _, r := range ranges {
+			if r.contains(port) {
+				warnings = append(warnings, fmt.Sprintf("port %d is already opened by range %s", port, r.source))
+			}
+		}
+	}
+
+	port, value := appPort(c)
+	if value == "" {
+		return warnings, nil
+	}
+
+	if port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid application port %s=%s", appPortEnv, value)
+	}
+
+	opened := false
+	for _, p := range rc.Ports {
+		opened = opened || p == port
+	}
+	for _, r := range ranges {
+		opened = opened || r.contains(port)
+	}
+
+	if !opened {
+		warnings = append(warnings, fmt.Sprintf("the application listens on port %d (%s) which is not opened, add it with --port", port, appPortEnv))
+	}
+
+	return warnings, nil
+}
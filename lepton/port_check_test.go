@@ -0,0 +1,43 @@
+package lepton
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPorts(t *testing.T) {
+	c := NewConfig()
+	c.RunConfig.Ports = []int{80, 8080, 80}
+
+	if _, err := CheckPorts(c); err == nil || !strings.Contains(err.Error(), "listed twice") {
+		t.Errorf("expected duplicate port error, got %v", err)
+	}
+
+	c.RunConfig.Ports = []int{70000}
+	if _, err := CheckPorts(c); err == nil {
+		t.Error("expected invalid port error")
+	}
+
+	c.RunConfig.Ports = []int{8050, 443}
+	c.RunConfig.PortRanges = []string{"8000-8100", "8090-8200"}
+	c.Env = map[string]string{"PORT": "3000"}
+
+	warnings, err := CheckPorts(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warnings) != 3 {
+		t.Fatalf("expected overlap, covered port and application port warnings, got %v", warnings)
+	}
+
+	if !strings.Contains(warnings[2], "3000") {
+		t.Errorf("expected application port warning, got %s", warnings[2])
+	}
+
+	c.RunConfig.InstanceEnv = map[string]string{"PORT": "8150"}
+	warnings, err = CheckPorts(c)
+	if err != nil || len(warnings) != 2 {
+		t.Errorf("expected the instance env port to be opened by a range, got %v, %v", warnings, err)
+	}
+}
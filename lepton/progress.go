@@ -0,0 +1,93 @@
+package lepton
+
+import (
+	"fmt"
+	"time"
+)
+
+// Long operations reporting progress events
+const (
+	ProgressUpload         = "upload"
+	ProgressSnapshotImport = "snapshot-import"
+	ProgressDNS            = "dns"
+	ProgressInstanceWait   = "instance-wait"
+	ProgressSmokeTest      = "smoke-test"
+)
+
+// Progress event statuses
+const (
+	ProgressStarted = "started"
+	ProgressRunning = "running"
+	ProgressDone    = "done"
+	ProgressFailed  = "failed"
+)
+
+// ProgressUnknown is the percent of events whose progress isn't known
+const ProgressUnknown = -1
+
+// ProgressEvent reports the progress of a long operation
+type ProgressEvent struct {
+	Operation string    `json:"operation"`
+	Resource  string    `json:"resource"` // what the operation acts on, e.g. an image or instance id
+	Status    string    `json:"status"`
+	Percent   int       `json:"percent"` // -1 if unknown
+	Message   string    `json:"message,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// String describes the event for text logs
+func (e ProgressEvent) String() string {
+	s := fmt.Sprintf("%s %s %s", e.Operation, e.Resource, e.Status)
+	if e.Percent >= 0 {
+		s += fmt.Sprintf(" %d%%", e.Percent)
+	}
+	if e.Message != "" {
+		s += ": " + e.Message
+	}
+	return s
+}
+
+// ProgressFunc receives the progress events of the operations of a context
+type ProgressFunc func(ProgressEvent)
+
+// OnProgress subscribes f to the progress events of the context operations.
+// Events are also logged, as info messages or json entries
+func (c *Context) OnProgress(f ProgressFunc) {
+	c.progressFuncs = append(c.progressFuncs, f)
+}
+
+// progress emits a progress event of the operation on the resource. percent
+// is -1 when unknown
+func (c *Context) progress(operation string, resource string, status string, percent int, format string, a ...interface{}) {
+	event := ProgressEvent{
+		Operation: operation,
+		Resource:  resource,
+		Status:    status,
+		Percent:   percent,
+		Message:   fmt.Sprintf(format, a...),
+		Time:      time.Now().UTC(),
+	}
+
+	if c.logger != nil {
+		c.logger.Progress(event)
+	}
+
+	if c.summary != nil {
+		c.summary.progress(event)
+	}
+
+	for _, f := range c.progressFuncs {
+		f(event)
+	}
+}
+
+// percentOf returns done as a percentage of total, -1 if total is unknown
+func percentOf(done int64, total int64) int {
+	if total <= 0 {
+		return ProgressUnknown
+	}
+	if done >= total {
+		return 100
+	}
+	return int(done * 100 / total)
+}
@@ -0,0 +1,35 @@
+package lepton
+
+import (
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	c := NewConfig()
+	c.RunConfig.Quiet = true
+	ctx := NewContext(c, nil)
+
+	var events []ProgressEvent
+	ctx.OnProgress(func(event ProgressEvent) {
+		events = append(events, event)
+	})
+
+	ctx.progress(ProgressUpload, "image", ProgressRunning, percentOf(50, 200), "")
+	ctx.progress(ProgressUpload, "image", ProgressFailed, ProgressUnknown, "%s", "timeout")
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %v", events)
+	}
+
+	if s := events[0].String(); s != "upload image running 25%" {
+		t.Errorf("unexpected event %q", s)
+	}
+
+	if s := events[1].String(); s != "upload image failed: timeout" {
+		t.Errorf("unexpected event %q", s)
+	}
+
+	if percentOf(10, 0) != ProgressUnknown || percentOf(300, 200) != 100 {
+		t.Error("unexpected percent")
+	}
+}
@@ -1,9 +1,14 @@
 package lepton
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -34,9 +39,11 @@ type Provider interface {
 	ListInstances(ctx *Context) error
 	GetInstances(ctx *Context) ([]CloudInstance, error)
 	GetInstanceByID(ctx *Context, id string) (*CloudInstance, error)
+	GetInstanceByName(ctx *Context, name string) (*CloudInstance, error)
 	DeleteInstance(ctx *Context, instancename string) error
 	StopInstance(ctx *Context, instancename string) error
 	StartInstance(ctx *Context, instancename string) error
+	RebootInstance(ctx *Context, instancename string) error
 	GetInstanceLogs(ctx *Context, instancename string) (string, error)
 	PrintInstanceLogs(ctx *Context, instancename string, watch bool) error
 
@@ -45,6 +52,18 @@ type Provider interface {
 	GetStorage() Storage
 }
 
+// DryRunner is implemented by providers previewing the changes of instance,
+// image and deploy commands run with RunConfig.DryRun instead of making them
+type DryRunner interface {
+	SupportsDryRun() bool
+}
+
+// ResourceRecorder is implemented by providers recording the resources their
+// instance and image operations create and delete in the operation summary
+type ResourceRecorder interface {
+	RecordsResources() bool
+}
+
 // Storage is an interface that provider's storage must implement
 type Storage interface {
 	CopyToBucket(config *Config, source string) error
@@ -67,63 +86,428 @@ type DNSRecord struct {
 	TTL  int
 }
 
-// DNSService is an interface for DNS related operations
-type DNSService interface {
+// DNSProvider is an interface for DNS related operations. The domain names of
+// instances are served by the DNS service of their compute provider unless
+// RunConfig.DNSProvider selects another one
+type DNSProvider interface {
 	FindOrCreateZoneIDByName(config *Config, name string) (string, error)
+	// FindZoneIDByName returns the id of the zone with the name, empty if
+	// there is none
+	FindZoneIDByName(config *Config, name string) (string, error)
 	DeleteZoneRecordIfExists(config *Config, zoneID string, recordName string) error
 	CreateZoneRecord(config *Config, zoneID string, record *DNSRecord) error
 }
 
-// CreateDNSRecord does the necessary operations to create a DNS record without issues in an cloud provider
-func CreateDNSRecord(config *Config, aRecordIP string, dnsService DNSService) error {
-	domainName := config.RunConfig.DomainName
-	if err := isDomainValid(domainName); err != nil {
-		return err
+// DNSBatchProvider is implemented by DNS providers able to create the records
+// of several instances in a single change
+type DNSBatchProvider interface {
+	UpsertZoneRecords(config *Config, zoneID string, records []*DNSRecord) error
+}
+
+// DNSZoneFinder is implemented by DNS providers looking up the zone serving a
+// domain name by its suffix, instead of the zone of its last two labels
+type DNSZoneFinder interface {
+	// FindZoneIDByDomain returns the id of the zone serving the domain name,
+	// empty if no zone serves it
+	FindZoneIDByDomain(config *Config, domainName string) (string, error)
+}
+
+// DNSRecordReader is implemented by DNS providers able to read the records
+// of a name, so the records replaced by a failed change can be restored
+type DNSRecordReader interface {
+	// ZoneRecords returns the A, AAAA and CNAME records of the name in the
+	// zone, one per value
+	ZoneRecords(config *Config, zoneID string, recordName string) ([]*DNSRecord, error)
+}
+
+// domainZoneID returns the id of the zone the records of the domain name are
+// created in, the zone found by suffix if the DNS service looks zones up,
+// otherwise the zone of its last two labels, created if missing
+func domainZoneID(config *Config, dnsService DNSProvider, domainName string) (string, error) {
+	if finder, ok := dnsService.(DNSZoneFinder); ok {
+		zoneID, err := finder.FindZoneIDByDomain(config, domainName)
+		if err != nil || zoneID != "" {
+			return zoneID, err
+		}
 	}
 
-	domainParts := strings.Split(domainName, ".")
+	return dnsService.FindOrCreateZoneIDByName(config, zoneDNSName(domainName))
+}
+
+// findDomainZoneID returns the id of the zone serving the records of the
+// domain name like domainZoneID, empty instead of creating a missing zone
+func findDomainZoneID(config *Config, dnsService DNSProvider, domainName string) (string, error) {
+	if finder, ok := dnsService.(DNSZoneFinder); ok {
+		zoneID, err := finder.FindZoneIDByDomain(config, domainName)
+		if err != nil || zoneID != "" {
+			return zoneID, err
+		}
+	}
+
+	return dnsService.FindZoneIDByName(config, zoneDNSName(domainName))
+}
+
+// domainRecord returns the first record of the domain name, nil if it has
+// none or the DNS service can't read records
+func domainRecord(config *Config, dnsService DNSProvider, domainName string) (*DNSRecord, error) {
+	dnsService, err := dnsProviderFor(config, dnsService)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, ok := dnsService.(DNSRecordReader)
+	if !ok {
+		return nil, nil
+	}
+
+	zoneID, err := findDomainZoneID(config, dnsService, domainName)
+	if err != nil || zoneID == "" {
+		return nil, err
+	}
+
+	records, err := reader.ZoneRecords(config, zoneID, domainName+".")
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// dnsProviderFor returns the DNS provider selected by RunConfig.DNSProvider,
+// or fallback, the DNS service of the compute provider, if none is selected
+func dnsProviderFor(config *Config, fallback DNSProvider) (DNSProvider, error) {
+	switch strings.ToLower(config.RunConfig.DNSProvider) {
+	case "":
+		return fallback, nil
+	case "aws", "route53":
+		if _, ok := fallback.(*AWS); ok {
+			return fallback, nil
+		}
+		return &AWS{}, nil
+	case "gcp":
+		if _, ok := fallback.(*GCloud); ok {
+			return fallback, nil
+		}
+		p := NewGCloud()
+		dnsService, err := p.getDNSService()
+		if err != nil {
+			return nil, fmt.Errorf("google cloud dns: %v", err)
+		}
+		p.dnsService = dnsService
+		return p, nil
+	case "cloudflare":
+		token := os.Getenv("CLOUDFLARE_API_TOKEN")
+		if token == "" {
+			return nil, errors.New("set CLOUDFLARE_API_TOKEN to use cloudflare dns")
+		}
+		return NewCloudflareDNS(token), nil
+	}
 
+	return nil, fmt.Errorf("unsupported DNS provider %q, expected aws, gcp or cloudflare", config.RunConfig.DNSProvider)
+}
+
+// CreateDNSRecord does the necessary operations to create a DNS record without issues in an cloud provider
+func CreateDNSRecord(config *Config, aRecordIP string, dnsService DNSProvider) error {
+	return CreateDNSRecords(config, []string{aRecordIP}, dnsService)
+}
+
+// zoneDNSName returns the name of the DNS zone of a valid domain name, its
+// last two labels
+func zoneDNSName(domainName string) string {
 	// example:
 	// domainParts := []string{"test","example","com"}
-	zoneName := domainParts[len(domainParts)-2]                 // example
-	dnsName := zoneName + "." + domainParts[len(domainParts)-1] // example.com
-	aRecordName := domainName + "."                             // test.example.com
+	domainParts := strings.Split(domainName, ".")
+	zoneName := domainParts[len(domainParts)-2]             // example
+	return zoneName + "." + domainParts[len(domainParts)-1] // example.com
+}
+
+// DNSRecordType returns the type of the records pointing the configured
+// domain name to instances, A if none is configured
+func DNSRecordType(config *Config) (string, error) {
+	switch recordType := strings.ToUpper(config.RunConfig.DNSRecordType); recordType {
+	case "":
+		return "A", nil
+	case "A", "AAAA", "CNAME":
+		return recordType, nil
+	}
+
+	return "", fmt.Errorf("unsupported DNS record type %q, expected A, AAAA or CNAME", config.RunConfig.DNSRecordType)
+}
+
+// domainNames returns the domain names pointed to the instances of the run
+// config, DomainName followed by DomainNames without duplicates
+func domainNames(config *Config) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range append([]string{config.RunConfig.DomainName}, config.RunConfig.DomainNames...) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// hasDomainNames returns true if the run config points domain names to the
+// instances
+func hasDomainNames(config *Config) bool {
+	return len(domainNames(config)) > 0
+}
+
+// zoneRecords are the records of a name of a DNS zone before a change,
+// unknown if the DNS service can't read them
+type zoneRecords struct {
+	zoneID   string
+	name     string
+	previous []*DNSRecord
+	known    bool
+}
+
+// CreateDNSRecords points the configured domain names to every ip, or host
+// name for CNAME records, passed by argument. The records of a zone are
+// created in a single change when the DNS service supports it, and the
+// records already changed are restored if those of another domain name fail
+func CreateDNSRecords(config *Config, aRecordIPs []string, dnsService DNSProvider) error {
+	if len(aRecordIPs) == 0 {
+		return errors.New("no ips to create DNS records for")
+	}
 
-	zoneID, err := dnsService.FindOrCreateZoneIDByName(config, dnsName)
+	recordType, err := DNSRecordType(config)
 	if err != nil {
 		return err
 	}
 
-	err = dnsService.DeleteZoneRecordIfExists(config, zoneID, aRecordName)
+	dnsService, err = dnsProviderFor(config, dnsService)
 	if err != nil {
 		return err
 	}
 
-	record := &DNSRecord{
-		Name: aRecordName,
-		IP:   aRecordIP,
-		Type: "A",
-		TTL:  TTLDefault,
+	if recordType == "CNAME" && len(aRecordIPs) > 1 {
+		return errors.New("a CNAME record points to a single instance")
+	}
+
+	ttl := config.RunConfig.DNSTTL
+	if ttl <= 0 {
+		ttl = TTLDefault
+	}
+
+	names := domainNames(config)
+	if len(names) == 0 {
+		return errors.New("no domain name to create DNS records for")
+	}
+
+	for _, domainName := range names {
+		if err := isDomainValid(domainName); err != nil {
+			return err
+		}
+
+		if recordType == "CNAME" && domainName == zoneDNSName(domainName) {
+			return fmt.Errorf("a CNAME record can't point the apex domain %s, use an A record", domainName)
+		}
+	}
+
+	// the records of a zone are grouped in a change, zones keep their order
+	var zones []string
+	byZone := map[string][]*DNSRecord{}
+	for _, domainName := range names {
+		zoneID, err := domainZoneID(config, dnsService, domainName)
+		if err != nil {
+			return fmt.Errorf("find DNS zone of %s: %v", domainName, err)
+		}
+
+		if _, ok := byZone[zoneID]; !ok {
+			zones = append(zones, zoneID)
+		}
+		for _, ip := range aRecordIPs {
+			byZone[zoneID] = append(byZone[zoneID], &DNSRecord{
+				Name: domainName + ".", // test.example.com.
+				IP:   ip,
+				Type: recordType,
+				TTL:  ttl,
+			})
+		}
+	}
+
+	var changed []zoneRecords
+	for _, zoneID := range zones {
+		previous := readZoneRecords(config, dnsService, zoneID, byZone[zoneID])
+
+		// a batch change fails as a whole, the other ones may fail halfway
+		if _, ok := dnsService.(DNSBatchProvider); !ok {
+			changed = append(changed, previous...)
+		}
+
+		err := createZoneRecords(config, dnsService, zoneID, byZone[zoneID])
+		if err != nil {
+			restoreZoneRecords(config, dnsService, changed)
+			return fmt.Errorf("create DNS records in zone %s: %v", zoneID, err)
+		}
+
+		if _, ok := dnsService.(DNSBatchProvider); ok {
+			changed = append(changed, previous...)
+		}
+	}
+
+	// private records and host names can't be checked from here
+	if !config.RunConfig.WaitReachable || config.RunConfig.PrivateDNS || recordType == "CNAME" {
+		return nil
+	}
+
+	checked := *config
+	checked.RunConfig.DomainName = names[0]
+	err = CheckServiceReachable(&checked, aRecordIPs[0])
+	if err != nil {
+		NewConfigLogger(config).Warn("service is not reachable yet: %v", err)
+	}
+
+	return nil
+}
+
+// createZoneRecords creates the records of the zone, replacing the existing
+// records of their names
+func createZoneRecords(config *Config, dnsService DNSProvider, zoneID string, records []*DNSRecord) error {
+	if batchService, ok := dnsService.(DNSBatchProvider); ok {
+		return batchService.UpsertZoneRecords(config, zoneID, records)
+	}
+
+	// one record per name, the first ip of each
+	first := map[string]*DNSRecord{}
+	warned := map[string]bool{}
+	for _, record := range records {
+		if first[record.Name] != nil {
+			if !warned[record.Name] {
+				warned[record.Name] = true
+				NewConfigLogger(config).Warn("DNS service does not support multiple records, pointing %s to %s only", strings.TrimSuffix(record.Name, "."), first[record.Name].IP)
+			}
+			continue
+		}
+		first[record.Name] = record
+
+		err := dnsService.DeleteZoneRecordIfExists(config, zoneID, record.Name)
+		if err != nil {
+			return err
+		}
+
+		err = dnsService.CreateZoneRecord(config, zoneID, record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readZoneRecords returns the records of the names of the records of the
+// zone before they are replaced
+func readZoneRecords(config *Config, dnsService DNSProvider, zoneID string, records []*DNSRecord) []zoneRecords {
+	reader, canRead := dnsService.(DNSRecordReader)
+
+	var previous []zoneRecords
+	read := map[string]bool{}
+	for _, record := range records {
+		if read[record.Name] {
+			continue
+		}
+		read[record.Name] = true
+
+		names := zoneRecords{zoneID: zoneID, name: record.Name}
+		if canRead {
+			existing, err := reader.ZoneRecords(config, zoneID, record.Name)
+			if err != nil {
+				NewConfigLogger(config).Warn("unable to read DNS records of %s: %v", strings.TrimSuffix(record.Name, "."), err)
+			} else {
+				names.previous = existing
+				names.known = true
+			}
+		}
+		previous = append(previous, names)
+	}
+
+	return previous
+}
+
+// restoreZoneRecords restores the records of the names as they were before
+// the change, deleting the records of names which had none. The failures are
+// reported as warnings as they are cleanups of another failure
+func restoreZoneRecords(config *Config, dnsService DNSProvider, changed []zoneRecords) {
+	for _, names := range changed {
+		name := strings.TrimSuffix(names.name, ".")
+		if !names.known {
+			NewConfigLogger(config).Warn("unable to restore the previous DNS records of %s", name)
+			continue
+		}
+
+		err := dnsService.DeleteZoneRecordIfExists(config, names.zoneID, names.name)
+		if err == nil && len(names.previous) > 0 {
+			err = createZoneRecords(config, dnsService, names.zoneID, names.previous)
+		}
+		if err != nil {
+			NewConfigLogger(config).Warn("unable to restore DNS records of %s: %v", name, err)
+		}
 	}
-	err = dnsService.CreateZoneRecord(config, zoneID, record)
+}
+
+// DeleteDNSRecords deletes the records of the configured domain names
+func DeleteDNSRecords(config *Config, dnsService DNSProvider) error {
+	dnsService, err := dnsProviderFor(config, dnsService)
 	if err != nil {
 		return err
 	}
 
+	for _, domainName := range domainNames(config) {
+		zoneID, err := findDomainZoneID(config, dnsService, domainName)
+		if err != nil {
+			return err
+		}
+
+		// no zone serves the domain name, it has no records
+		if zoneID == "" {
+			continue
+		}
+
+		err = dnsService.DeleteZoneRecordIfExists(config, zoneID, domainName+".")
+		if err != nil {
+			return fmt.Errorf("delete records of %s: %v", domainName, err)
+		}
+	}
+
 	return nil
 }
 
 // Context captures required info for provider operation
 type Context struct {
-	config   *Config
-	provider *Provider
-	logger   *Logger
+	config        *Config
+	provider      *Provider
+	logger        *Logger
+	deployID      string
+	progressFuncs []ProgressFunc
+	summary       *summaryRecorder
 }
 
-// NewContext Create a new context for the given provider
-// valid providers are "gcp", "aws" and "onprem"
-func NewContext(c *Config, provider *Provider) *Context {
+// DeployID returns the correlation id of the operation, resources created by
+// it are tagged with the id
+func (c *Context) DeployID() string {
+	return c.deployID
+}
+
+// newDeployID returns a random deploy id
+func newDeployID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// listFilters returns the filters applied when listing instances and images
+func (c *Context) listFilters() []ListFilter {
+	if c.config == nil {
+		return nil
+	}
+	return c.config.RunConfig.Filters
+}
 
+// NewConfigLogger returns a logger with the levels and format of the config
+func NewConfigLogger(c *Config) *Logger {
 	logger := NewLogger(os.Stdout)
 
 	if c.RunConfig.ShowDebug {
@@ -145,9 +529,41 @@ func NewContext(c *Config, provider *Provider) *Context {
 		logger.SetInfo(true)
 	}
 
+	logger.SetQuiet(c.RunConfig.Quiet)
+
+	// json logs leave stdout to the tables and other results
+	if c.RunConfig.LogFormat == LogFormatJSON {
+		logger.SetFormat(LogFormatJSON)
+		logger.SetOutput(os.Stderr)
+	}
+
+	return logger
+}
+
+// NewContext Create a new context for the given provider
+// valid providers are "gcp", "aws" and "onprem"
+func NewContext(c *Config, provider *Provider) *Context {
+	logger := NewConfigLogger(c)
+
+	// the config keeps the generated id so resources created from it alone,
+	// like the azure networks or the gcp disks, are tagged with it too
+	if c.RunConfig.DeployID == "" {
+		c.RunConfig.DeployID = newDeployID()
+	}
+	deployID := c.RunConfig.DeployID
+	logger.SetDeployID(deployID)
+
+	summary := newSummaryRecorder(deployID, logger)
+	if provider != nil && *provider != nil {
+		recorder, ok := (*provider).(ResourceRecorder)
+		summary.summary.Unrecorded = !ok || !recorder.RecordsResources()
+	}
+
 	return &Context{
 		config:   c,
 		provider: provider,
 		logger:   logger,
+		deployID: deployID,
+		summary:  summary,
 	}
 }
@@ -0,0 +1,117 @@
+package lepton
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ReachabilityInterval is the time waited between checks
+var ReachabilityInterval = 10 * time.Second
+
+// reachableTimeout returns the time to wait for the service of the config to
+// be reachable, RunConfig.ReachableTimeout or 300 seconds
+func reachableTimeout(config *Config) time.Duration {
+	if config.RunConfig.ReachableTimeout > 0 {
+		return time.Duration(config.RunConfig.ReachableTimeout) * time.Second
+	}
+	return 300 * time.Second
+}
+
+// CheckServiceReachable verifies the domain name resolves to the instance ip
+// and the first configured port accepts connections, waiting at most
+// RunConfig.ReachableTimeout for both. The outcome is reported to the user,
+// an error is returned with the step that failed.
+func CheckServiceReachable(config *Config, ip string) error {
+	domainName := config.RunConfig.DomainName
+	deadline := time.Now().Add(reachableTimeout(config))
+
+	fmt.Printf("waiting for %s to resolve to %s\n", domainName, ip)
+
+	err := waitForResolution(domainName, ip, deadline)
+	if err != nil {
+		return err
+	}
+
+	url := serviceURL(domainName, config.RunConfig.Ports)
+
+	if len(config.RunConfig.Ports) != 0 {
+		port := config.RunConfig.Ports[0]
+
+		fmt.Printf("waiting for port %d to accept connections\n", port)
+
+		err = waitForPort(ip, port, deadline)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("your service is live at %s\n", url)
+
+	return nil
+}
+
+func waitForResolution(domainName string, ip string, deadline time.Time) error {
+	var addrs []string
+	var err error
+
+	for {
+		addrs, err = net.LookupHost(domainName)
+		if err == nil {
+			for _, addr := range addrs {
+				if addr == ip {
+					return nil
+				}
+			}
+		}
+
+		if time.Now().Add(ReachabilityInterval).After(deadline) {
+			break
+		}
+		time.Sleep(ReachabilityInterval)
+	}
+
+	if err != nil {
+		return fmt.Errorf("dns record %s not resolvable: %v", domainName, err)
+	}
+
+	return fmt.Errorf("dns record %s resolves to %v instead of %s", domainName, addrs, ip)
+}
+
+func waitForPort(ip string, port int, deadline time.Time) error {
+	address := net.JoinHostPort(ip, strconv.Itoa(port))
+
+	var err error
+	for {
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", address, ReachabilityInterval)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		if time.Now().Add(ReachabilityInterval).After(deadline) {
+			break
+		}
+		time.Sleep(ReachabilityInterval)
+	}
+
+	return fmt.Errorf("port %d not answering on %s: %v", port, ip, err)
+}
+
+// serviceURL returns the url users reach the service at
+func serviceURL(domainName string, ports []int) string {
+	if len(ports) == 0 {
+		return domainName
+	}
+
+	switch ports[0] {
+	case 443:
+		return "https://" + domainName
+	case 80:
+		return "http://" + domainName
+	default:
+		return fmt.Sprintf("http://%s:%d", domainName, ports[0])
+	}
+}
@@ -0,0 +1,64 @@
+package lepton
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCheckServiceReachable(t *testing.T) {
+	defer func(interval time.Duration) { ReachabilityInterval = interval }(ReachabilityInterval)
+	ReachabilityInterval = 10 * time.Millisecond
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	config := NewConfig()
+	config.RunConfig.DomainName = "localhost"
+	config.RunConfig.Ports = []int{port}
+	config.RunConfig.ReachableTimeout = 1
+
+	err = CheckServiceReachable(config, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the port is closed, the check gives up after the timeout
+	listener.Close()
+
+	start := time.Now()
+	err = CheckServiceReachable(config, "127.0.0.1")
+	if err == nil {
+		t.Fatal("expected an error for a closed port")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the check to give up after a second, took %s", elapsed)
+	}
+
+	if err := waitForResolution("localhost", "192.0.2.1", time.Now()); err == nil {
+		t.Error("expected an error for a domain name resolving to another ip")
+	}
+}
+
+func TestCreateDNSRecordsDoesNotWaitByDefault(t *testing.T) {
+	config := NewConfig()
+	config.RunConfig.DomainName = "api.example.com"
+
+	// api.example.com doesn't resolve to the ip, a check would wait 300s
+	done := make(chan error, 1)
+	go func() {
+		done <- CreateDNSRecords(config, []string{"192.0.2.1"}, &fakeDNS{})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the records to be created without waiting for the service")
+	}
+}
@@ -0,0 +1,126 @@
+package lepton
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// RebuildState holds the nanos release each project was last rebuilt
+// against, kept in the ops home between rebuilds
+type RebuildState struct {
+	Versions map[string]string // nanos release by project config
+	Updated  time.Time
+}
+
+// RebuildResult is the outcome of the rebuild of a project against a nanos
+// release
+type RebuildResult struct {
+	Project   string   // config of the project
+	Version   string   // nanos release the image was built with
+	Image     string   // image name
+	Canary    string   // instance the smoke tests ran on, deleted once they ran
+	RolledOut []string // instances replacing the fleet once the canary passed
+	Error     string   // why the rebuild failed, empty if it succeeded
+	Started   time.Time
+	Finished  time.Time
+}
+
+// Failed returns true if the rebuild didn't complete
+func (r RebuildResult) Failed() bool {
+	return r.Error != ""
+}
+
+// rebuildStatePath returns the file holding the rebuild state
+func rebuildStatePath() string {
+	return path.Join(GetOpsHome(), "rebuilds", "state.json")
+}
+
+// LoadRebuildState returns the state of the previous rebuilds, empty if
+// there were none
+func LoadRebuildState() (*RebuildState, error) {
+	state := &RebuildState{Versions: map[string]string{}}
+
+	data, err := ioutil.ReadFile(rebuildStatePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("read rebuild state %s: %v", rebuildStatePath(), err)
+	}
+
+	if state.Versions == nil {
+		state.Versions = map[string]string{}
+	}
+	return state, nil
+}
+
+// Save writes the state to the ops home
+func (s *RebuildState) Save() error {
+	statePath := rebuildStatePath()
+
+	err := os.MkdirAll(path.Dir(statePath), 0755)
+	if err != nil {
+		return err
+	}
+
+	s.Updated = time.Now()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(statePath, data, 0644)
+}
+
+// Stale returns the projects not rebuilt against the version yet
+func (s *RebuildState) Stale(projects []string, version string) []string {
+	var stale []string
+	for _, project := range projects {
+		if s.Versions[project] != version {
+			stale = append(stale, project)
+		}
+	}
+	return stale
+}
+
+// FetchLatestReleaseVersion looks up the latest nanos release. Unlike
+// LatestReleaseVersion, read once when ops starts, it's looked up on every
+// call for long running processes
+func FetchLatestReleaseVersion() (string, error) {
+	resp, err := http.Get(releaseBaseURL + "latest.txt")
+	if err != nil {
+		return "", fmt.Errorf("look up the latest nanos release: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("look up the latest nanos release: status %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("look up the latest nanos release: %v", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// WriteRebuildReport writes the results of a rebuild as json to w
+func WriteRebuildReport(w io.Writer, results []RebuildResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
@@ -0,0 +1,48 @@
+package lepton
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRebuildStateStale(t *testing.T) {
+	state := &RebuildState{Versions: map[string]string{
+		"api.json":    "0.1.30",
+		"worker.json": "0.1.29",
+	}}
+
+	stale := state.Stale([]string{"api.json", "worker.json", "web.json"}, "0.1.30")
+	expected := []string{"worker.json", "web.json"}
+	if !reflect.DeepEqual(stale, expected) {
+		t.Errorf("expected %v, got %v", expected, stale)
+	}
+
+	if stale := state.Stale([]string{"api.json"}, "0.1.30"); len(stale) != 0 {
+		t.Errorf("expected nothing stale, got %v", stale)
+	}
+}
+
+func TestWriteRebuildReport(t *testing.T) {
+	results := []RebuildResult{
+		{Project: "api.json", Version: "0.1.30", Canary: "i-1", RolledOut: []string{"i-2"}},
+		{Project: "worker.json", Version: "0.1.30", Error: "canary i-3 failed"},
+	}
+
+	var buf bytes.Buffer
+	err := WriteRebuildReport(&buf, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var read []RebuildResult
+	err = json.Unmarshal(buf.Bytes(), &read)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(read) != 2 || read[0].Failed() || !read[1].Failed() || read[0].RolledOut[0] != "i-2" {
+		t.Errorf("unexpected report %s", buf.String())
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
 )
 
@@ -199,9 +198,7 @@ func findBucketInPolicy(svc *iam.IAM, bucket string) (string, error) {
 // VerifyRole ensures we have a role and attached policy for the vmie service to hit our
 // bucket.
 func VerifyRole(ctx *Context, bucket string) {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(ctx.config.CloudConfig.Zone)},
-	)
+	sess, err := newAWSSession(&ctx.config.CloudConfig, ctx.config.CloudConfig.Zone)
 
 	svc := iam.New(sess)
 
@@ -2,11 +2,13 @@ package lepton
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"sort"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 )
@@ -14,21 +16,101 @@ import (
 // S3 provides AWS storage related operations
 type S3 struct{}
 
+// progressFile counts the bytes of the file read by the s3 uploader, which
+// reads parts concurrently with ReadAt. Parts are read again to be signed
+// and on retries, so the ranges read are tracked and each byte counts once
+type progressFile struct {
+	*os.File
+	mu     sync.Mutex
+	ranges [][2]int64
+	report func(read int64)
+}
+
+func (f *progressFile) Read(p []byte) (int, error) {
+	off, seekErr := f.File.Seek(0, io.SeekCurrent)
+	n, err := f.File.Read(p)
+	if seekErr == nil {
+		f.add(off, n)
+	}
+	return n, err
+}
+
+func (f *progressFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	f.add(off, n)
+	return n, err
+}
+
+func (f *progressFile) add(off int64, n int) {
+	if n <= 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var read int64
+	f.ranges, read = addRange(f.ranges, off, off+int64(n))
+	if f.report != nil {
+		f.report(read)
+	}
+}
+
+// addRange adds the range from start to end to the disjoint ranges, sorted
+// by start, and returns them merged with the number of bytes they cover
+func addRange(ranges [][2]int64, start int64, end int64) ([][2]int64, int64) {
+	ranges = append(ranges, [2]int64{start, end})
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] > last[1] {
+			merged = append(merged, r)
+			continue
+		}
+		if r[1] > last[1] {
+			last[1] = r[1]
+		}
+	}
+
+	var covered int64
+	for _, r := range merged {
+		covered += r[1] - r[0]
+	}
+	return merged, covered
+}
+
 // CopyToBucket copies archive to bucket
 func (s *S3) CopyToBucket(config *Config, archPath string) error {
+	return s.copyToBucket(config, archPath, nil)
+}
+
+// copyToBucket copies archive to bucket, calling report with the bytes read
+// out of the file size as the upload goes
+func (s *S3) copyToBucket(config *Config, archPath string, report func(read int64, size int64)) error {
 
 	bucket := config.CloudConfig.BucketName
 	zone := config.CloudConfig.Zone
 
-	file, err := os.Open(archPath)
+	f, err := os.Open(archPath)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer f.Close()
+
+	file := &progressFile{File: f}
+	if report != nil {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		file.report = func(read int64) {
+			report(read, fi.Size())
+		}
+	}
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(zone)},
-	)
+	sess, err := newAWSSession(&config.CloudConfig, zone)
 	if err != nil {
 		return err
 	}
@@ -53,9 +135,7 @@ func (s *S3) DeleteFromBucket(config *Config, key string) error {
 	bucket := config.CloudConfig.BucketName
 	zone := config.CloudConfig.Zone
 
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(zone)},
-	)
+	sess, err := newAWSSession(&config.CloudConfig, zone)
 	if err != nil {
 		return err
 	}
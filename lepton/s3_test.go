@@ -0,0 +1,61 @@
+package lepton
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestAddRange(t *testing.T) {
+	var ranges [][2]int64
+	var read int64
+
+	ranges, read = addRange(ranges, 100, 200)
+	ranges, read = addRange(ranges, 0, 50)
+	if read != 150 || len(ranges) != 2 {
+		t.Errorf("expected 150 bytes in 2 ranges, got %d in %v", read, ranges)
+	}
+
+	// a part read again counts once
+	ranges, read = addRange(ranges, 100, 200)
+	if read != 150 {
+		t.Errorf("expected 150 bytes, got %d", read)
+	}
+
+	ranges, read = addRange(ranges, 50, 100)
+	if read != 200 || len(ranges) != 1 {
+		t.Errorf("expected 200 bytes in a range, got %d in %v", read, ranges)
+	}
+}
+
+func TestProgressFileCountsBytesOnce(t *testing.T) {
+	f, err := ioutil.TempFile("", "progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, 0)
+
+	var reported int64
+	file := &progressFile{File: f, report: func(read int64) { reported = read }}
+
+	buf := make([]byte, 400)
+	file.ReadAt(buf, 600)
+	file.ReadAt(buf, 600)
+	if reported != 400 {
+		t.Errorf("expected a part read twice to count once, got %d", reported)
+	}
+
+	// the file is read again after seeking back
+	file.Read(buf)
+	file.Seek(0, 0)
+	file.Read(buf)
+	if reported != 800 {
+		t.Errorf("expected 800 bytes, got %d", reported)
+	}
+}
@@ -0,0 +1,223 @@
+package lepton
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSmokeTestTimeout is the time in seconds a smoke test has to pass in
+// if it doesn't set one
+const defaultSmokeTestTimeout = 60
+
+// SmokeTest is a check of the new instances of a deploy, run once they are
+// ready and before the domain names are pointed to them. A failing check
+// rolls the deploy back
+type SmokeTest struct {
+	Name    string // reported name, defaults to the type and target of the check
+	Type    string // http, tcp or command
+	Port    int    // port of http and tcp checks
+	Path    string // path of http checks, defaults to /
+	Status  int    // status expected from http checks, defaults to 200
+	Command string // shell command run on the deploying host, the address of the instance in OPS_INSTANCE_ADDRESS
+	Timeout int    // seconds the check is retried for until it passes, defaults to 60
+}
+
+// SmokeTestRunner runs a type of smoke test against the address of an
+// instance, returning why it failed
+type SmokeTestRunner func(test SmokeTest, address string) error
+
+// smokeTestRunners are the runners of the smoke test types
+var smokeTestRunners = map[string]SmokeTestRunner{
+	"http":    httpSmokeTest,
+	"tcp":     tcpSmokeTest,
+	"command": commandSmokeTest,
+}
+
+// RegisterSmokeTestRunner adds a type of smoke test the config can declare
+func RegisterSmokeTestRunner(testType string, runner SmokeTestRunner) {
+	smokeTestRunners[strings.ToLower(testType)] = runner
+}
+
+// String names the smoke test in logs
+func (t SmokeTest) String() string {
+	if t.Name != "" {
+		return t.Name
+	}
+
+	switch strings.ToLower(t.Type) {
+	case "http":
+		return fmt.Sprintf("http %d%s", t.Port, t.path())
+	case "tcp":
+		return fmt.Sprintf("tcp %d", t.Port)
+	case "command":
+		return "command " + t.Command
+	}
+	return t.Type
+}
+
+// timeout returns how long the check is retried for until it passes
+func (t SmokeTest) timeout() time.Duration {
+	if t.Timeout <= 0 {
+		return defaultSmokeTestTimeout * time.Second
+	}
+	return time.Duration(t.Timeout) * time.Second
+}
+
+// path returns the path of an http check
+func (t SmokeTest) path() string {
+	if t.Path == "" {
+		return "/"
+	}
+	return "/" + strings.TrimPrefix(t.Path, "/")
+}
+
+// validate checks the smoke test can run
+func (t SmokeTest) validate() error {
+	testType := strings.ToLower(t.Type)
+	if _, ok := smokeTestRunners[testType]; !ok {
+		return fmt.Errorf("smoke test %s: unknown type %q, expected http, tcp or command", t, t.Type)
+	}
+
+	switch {
+	case (testType == "http" || testType == "tcp") && (t.Port <= 0 || t.Port > 65535):
+		return fmt.Errorf("smoke test %s: invalid port %d", t, t.Port)
+	case testType == "command" && t.Command == "":
+		return fmt.Errorf("smoke test %s: no command to run", t)
+	}
+	return nil
+}
+
+// validateSmokeTests checks the smoke tests can run
+func validateSmokeTests(tests []SmokeTest) error {
+	for _, test := range tests {
+		if err := test.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// httpSmokeTest checks a GET of the path of the instance returns the
+// expected status
+func httpSmokeTest(test SmokeTest, address string) error {
+	expected := test.Status
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get("http://" + net.JoinHostPort(address, strconv.Itoa(test.Port)) + test.path())
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != expected {
+		return fmt.Errorf("status %d, expected %d", resp.StatusCode, expected)
+	}
+	return nil
+}
+
+// tcpSmokeTest checks the port of the instance accepts connections
+func tcpSmokeTest(test SmokeTest, address string) error {
+	if !portResponds(address, test.Port) {
+		return fmt.Errorf("port %d not accepting connections", test.Port)
+	}
+	return nil
+}
+
+// commandSmokeTest runs the command of the test, which fails if it exits
+// with an error. Unikernels have no shell to run commands in, it runs on the
+// deploying host against the instance. The command is killed once the
+// timeout of the test expires
+func commandSmokeTest(test SmokeTest, address string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), test.timeout())
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", test.Command)
+	cmd.Env = append(os.Environ(), "OPS_INSTANCE_ADDRESS="+address)
+
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("killed after %v: %s", test.timeout(), consoleTail(string(out), 10))
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, consoleTail(string(out), 10))
+	}
+	return nil
+}
+
+// RunSmokeTests runs the smoke tests of the run config against every
+// instance with the ids passed by argument, each test being retried until it
+// passes or its timeout expires. Failures are returned with the console
+// output of the instance
+func RunSmokeTests(ctx *Context, p Provider, ids []string) error {
+	tests := ctx.config.RunConfig.SmokeTests
+	if len(tests) == 0 {
+		return nil
+	}
+
+	err := validateSmokeTests(tests)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		instance, err := p.GetInstanceByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		address := instanceAddress(instance)
+		if address == "" {
+			return fmt.Errorf("instance %s has no address to run smoke tests against", id)
+		}
+
+		ctx.progress(ProgressSmokeTest, id, ProgressStarted, 0, "running %d smoke tests", len(tests))
+
+		for i, test := range tests {
+			err = runSmokeTest(test, address)
+			if err != nil {
+				ctx.progress(ProgressSmokeTest, id, ProgressFailed, i*100/len(tests), "%s: %v", test, err)
+
+				output, logsErr := p.GetInstanceLogs(ctx, id)
+				if logsErr != nil {
+					output = "unavailable: " + logsErr.Error()
+				}
+				return fmt.Errorf("smoke test %s failed on instance %s: %v, console of %s:\n%s", test, id, err, id, consoleTail(output, 20))
+			}
+
+			ctx.logger.Log("Smoke test %s passed on instance %s", test, id)
+			ctx.progress(ProgressSmokeTest, id, ProgressRunning, (i+1)*100/len(tests), "")
+		}
+
+		ctx.progress(ProgressSmokeTest, id, ProgressDone, 100, "")
+	}
+
+	return nil
+}
+
+// runSmokeTest runs the test against the address until it passes or its
+// timeout expires, returning the last failure
+func runSmokeTest(test SmokeTest, address string) error {
+	timeout := test.timeout()
+
+	runner := smokeTestRunners[strings.ToLower(test.Type)]
+
+	var failure error
+	err := waitUntil(timeout, waitPollInterval, func() (bool, error) {
+		failure = runner(test, address)
+		return failure == nil, nil
+	})
+	if err != nil && failure != nil {
+		return fmt.Errorf("%v after %d seconds", failure, int(timeout.Seconds()))
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package lepton
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSmokeTests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	host, _, _ := net.SplitHostPort(server.Listener.Addr().String())
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	if err := httpSmokeTest(SmokeTest{Type: "http", Port: port, Path: "health"}, host); err != nil {
+		t.Errorf("expected the health check to pass, got %v", err)
+	}
+
+	err := httpSmokeTest(SmokeTest{Type: "http", Port: port, Path: "/missing"}, host)
+	if err == nil || !strings.Contains(err.Error(), "status 404, expected 200") {
+		t.Errorf("expected an unexpected status, got %v", err)
+	}
+
+	if err := tcpSmokeTest(SmokeTest{Type: "tcp", Port: port}, host); err != nil {
+		t.Errorf("expected the port to accept connections, got %v", err)
+	}
+
+	command := SmokeTest{Type: "command", Command: `test "$OPS_INSTANCE_ADDRESS" = ` + host}
+	if err := commandSmokeTest(command, host); err != nil {
+		t.Errorf("expected the command to get the instance address, got %v", err)
+	}
+
+	command.Command = "echo unhealthy; exit 1"
+	err = commandSmokeTest(command, host)
+	if err == nil || !strings.Contains(err.Error(), "unhealthy") {
+		t.Errorf("expected the command failure with its output, got %v", err)
+	}
+
+	// a hanging command is killed once the timeout of the test expires
+	started := time.Now()
+	err = commandSmokeTest(SmokeTest{Type: "command", Command: "exec sleep 30", Timeout: 1}, host)
+	if err == nil || !strings.Contains(err.Error(), "killed after 1s") || time.Since(started) > 10*time.Second {
+		t.Errorf("expected the command to be killed after its timeout, got %v after %v", err, time.Since(started))
+	}
+
+	err = runSmokeTest(SmokeTest{Type: "http", Port: port, Path: "/missing", Timeout: 1}, host)
+	if err == nil || !strings.Contains(err.Error(), "after 1 seconds") {
+		t.Errorf("expected the check to fail once its timeout expired, got %v", err)
+	}
+
+	if name := (SmokeTest{Type: "http", Port: 8080}).String(); name != "http 8080/" {
+		t.Errorf("unexpected name %s", name)
+	}
+
+	for _, invalid := range []SmokeTest{{Type: "grpc", Port: 9000}, {Type: "tcp"}, {Type: "command"}} {
+		if validateSmokeTests([]SmokeTest{invalid}) == nil {
+			t.Errorf("expected smoke test %+v to be invalid", invalid)
+		}
+	}
+
+	RegisterSmokeTestRunner("grpc", func(test SmokeTest, address string) error { return nil })
+	defer delete(smokeTestRunners, "grpc")
+
+	if err := runSmokeTest(SmokeTest{Type: "GRPC", Port: 9000}, host); err != nil {
+		t.Errorf("expected the registered runner to run, got %v", err)
+	}
+}
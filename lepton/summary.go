@@ -0,0 +1,305 @@
+package lepton
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// awsHourlyPrices are the us-east-1 on demand prices in usd of common
+// instance types, estimating the cost change of operations when the instance
+// prices of the config miss the type
+var awsHourlyPrices = map[string]float64{
+	"t2.nano":   0.0058,
+	"t2.micro":  0.0116,
+	"t2.small":  0.023,
+	"t2.medium": 0.0464,
+	"t2.large":  0.0928,
+	"t3.nano":   0.0052,
+	"t3.micro":  0.0104,
+	"t3.small":  0.0208,
+	"t3.medium": 0.0416,
+	"t3.large":  0.0832,
+	"m5.large":  0.096,
+	"m5.xlarge": 0.192,
+	"c5.large":  0.085,
+	"c5.xlarge": 0.17,
+}
+
+// SummaryResource is a resource created or deleted by an operation
+type SummaryResource struct {
+	Kind string `json:"kind"` // e.g. instance, image, volume
+	ID   string `json:"id"`
+}
+
+// OperationSummary is what an operation changed: the resources it created
+// and deleted, the time spent in its phases, the bytes it uploaded and the
+// estimated change of the hourly cost of the instances. Unrecorded is set
+// when the provider doesn't record the resources it creates and deletes
+type OperationSummary struct {
+	DeployID      string             `json:"deploy_id,omitempty"`
+	Status        string             `json:"status,omitempty"` // done or failed
+	Created       []SummaryResource  `json:"created,omitempty"`
+	Deleted       []SummaryResource  `json:"deleted,omitempty"`
+	Phases        map[string]float64 `json:"phases,omitempty"` // seconds spent in the progress operations, e.g. upload
+	BytesUploaded int64              `json:"bytes_uploaded"`
+	CostDelta     float64            `json:"hourly_cost_delta"`            // estimated usd per hour
+	Unpriced      int                `json:"unpriced_instances,omitempty"` // instances of types the estimate misses
+	Unrecorded    bool               `json:"resources_not_supported,omitempty"`
+	Duration      float64            `json:"duration"` // seconds
+}
+
+// empty returns true if the operation changed nothing worth summarizing
+func (s *OperationSummary) empty() bool {
+	return len(s.Created) == 0 && len(s.Deleted) == 0 && len(s.Phases) == 0 && s.BytesUploaded == 0
+}
+
+// String describes the summary in a line
+func (s OperationSummary) String() string {
+	var parts []string
+
+	resources := func(list []SummaryResource) string {
+		var names []string
+		for _, r := range list {
+			names = append(names, r.Kind+" "+r.ID)
+		}
+		return strings.Join(names, ", ")
+	}
+
+	if len(s.Created) > 0 {
+		parts = append(parts, "created "+resources(s.Created))
+	}
+	if len(s.Deleted) > 0 {
+		parts = append(parts, "deleted "+resources(s.Deleted))
+	}
+	if s.Unrecorded {
+		parts = append(parts, "created and deleted resources not supported by the provider")
+	}
+
+	if len(s.Phases) > 0 {
+		var phases []string
+		for phase := range s.Phases {
+			phases = append(phases, phase)
+		}
+		sort.Strings(phases)
+
+		for i, phase := range phases {
+			phases[i] = phase + " " + secondsDuration(s.Phases[phase]).String()
+		}
+		parts = append(parts, strings.Join(phases, ", "))
+	}
+
+	if s.BytesUploaded > 0 {
+		parts = append(parts, "uploaded "+Bytes2Human(s.BytesUploaded))
+	}
+
+	if s.CostDelta != 0 {
+		parts = append(parts, fmt.Sprintf("hourly cost %+.4f usd", s.CostDelta))
+	}
+	if s.Unpriced > 0 {
+		parts = append(parts, fmt.Sprintf("%d instances not priced", s.Unpriced))
+	}
+
+	parts = append(parts, "took "+secondsDuration(s.Duration).String())
+
+	status := s.Status
+	if status == "" {
+		status = ProgressDone
+	}
+
+	return status + ": " + strings.Join(parts, "; ")
+}
+
+// secondsDuration returns the duration of seconds rounded to tenths
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds*10) * time.Second / 10
+}
+
+// summaryRecorder accumulates the summary of the operations of a context,
+// shared by its copies
+type summaryRecorder struct {
+	mu          sync.Mutex
+	start       time.Time
+	summary     OperationSummary
+	phaseStarts map[string]time.Time
+	logger      *Logger
+}
+
+// recorders are the summaries of the contexts of the process, merged in the
+// summary of a cli run
+var recorders struct {
+	sync.Mutex
+	list []*summaryRecorder
+}
+
+func newSummaryRecorder(deployID string, logger *Logger) *summaryRecorder {
+	r := &summaryRecorder{
+		start:       time.Now(),
+		summary:     OperationSummary{DeployID: deployID},
+		phaseStarts: map[string]time.Time{},
+		logger:      logger,
+	}
+
+	recorders.Lock()
+	recorders.list = append(recorders.list, r)
+	recorders.Unlock()
+
+	return r
+}
+
+// progress times the phases of the progress events
+func (r *summaryRecorder) progress(event ProgressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := event.Operation + " " + event.Resource
+	switch event.Status {
+	case ProgressStarted:
+		r.phaseStarts[key] = event.Time
+	case ProgressDone, ProgressFailed:
+		start, ok := r.phaseStarts[key]
+		if !ok {
+			return
+		}
+		delete(r.phaseStarts, key)
+
+		if r.summary.Phases == nil {
+			r.summary.Phases = map[string]float64{}
+		}
+		r.summary.Phases[event.Operation] += event.Time.Sub(start).Seconds()
+	}
+}
+
+// snapshot returns a copy of the summary
+func (r *summaryRecorder) snapshot() OperationSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.summary
+	s.Created = append([]SummaryResource{}, r.summary.Created...)
+	s.Deleted = append([]SummaryResource{}, r.summary.Deleted...)
+	s.Phases = map[string]float64{}
+	for phase, seconds := range r.summary.Phases {
+		s.Phases[phase] = seconds
+	}
+	s.Duration = time.Since(r.start).Seconds()
+	return s
+}
+
+// Summary returns the summary of the operations of the context so far
+func (c *Context) Summary() OperationSummary {
+	if c.summary == nil {
+		return OperationSummary{DeployID: c.deployID}
+	}
+	return c.summary.snapshot()
+}
+
+// recordCreated adds the resource to the ones the operation created
+func (c *Context) recordCreated(kind string, id string) {
+	if c.summary == nil {
+		return
+	}
+
+	c.summary.mu.Lock()
+	defer c.summary.mu.Unlock()
+	c.summary.summary.Created = append(c.summary.summary.Created, SummaryResource{Kind: kind, ID: id})
+}
+
+// recordDeleted adds the resource to the ones the operation deleted
+func (c *Context) recordDeleted(kind string, id string) {
+	if c.summary == nil {
+		return
+	}
+
+	c.summary.mu.Lock()
+	defer c.summary.mu.Unlock()
+	c.summary.summary.Deleted = append(c.summary.summary.Deleted, SummaryResource{Kind: kind, ID: id})
+}
+
+// recordUpload adds bytes to the bytes the operation uploaded
+func (c *Context) recordUpload(bytes int64) {
+	if c.summary == nil {
+		return
+	}
+
+	c.summary.mu.Lock()
+	defer c.summary.mu.Unlock()
+	c.summary.summary.BytesUploaded += bytes
+}
+
+// recordInstanceCost adds the hourly price of count instances of the
+// instance type to the cost delta of the operation, count being negative for
+// deleted instances
+func (c *Context) recordInstanceCost(instanceType string, count int) {
+	if c.summary == nil {
+		return
+	}
+
+	c.summary.mu.Lock()
+	defer c.summary.mu.Unlock()
+
+	price, ok := c.config.CloudConfig.InstancePrices[instanceType]
+	if !ok {
+		price, ok = awsHourlyPrices[instanceType]
+	}
+	if !ok {
+		if count < 0 {
+			count = -count
+		}
+		c.summary.summary.Unpriced += count
+		return
+	}
+	c.summary.summary.CostDelta += price * float64(count)
+}
+
+// mergeSummaries returns the summary of the operations of the summaries, the
+// operations of a fan out sharing their deploy id
+func mergeSummaries(summaries []OperationSummary) OperationSummary {
+	var merged OperationSummary
+	for _, s := range summaries {
+		if merged.DeployID == "" {
+			merged.DeployID = s.DeployID
+		}
+		merged.Created = append(merged.Created, s.Created...)
+		merged.Deleted = append(merged.Deleted, s.Deleted...)
+		for phase, seconds := range s.Phases {
+			if merged.Phases == nil {
+				merged.Phases = map[string]float64{}
+			}
+			merged.Phases[phase] += seconds
+		}
+		merged.BytesUploaded += s.BytesUploaded
+		merged.CostDelta += s.CostDelta
+		merged.Unpriced += s.Unpriced
+		merged.Unrecorded = merged.Unrecorded || s.Unrecorded
+		if s.Duration > merged.Duration {
+			merged.Duration = s.Duration
+		}
+	}
+	return merged
+}
+
+// RunSummary returns the summary of the operations of every context of the
+// process with the status passed by argument, and logs it with the logger of
+// the first context unless they changed nothing. It's meant to end cli runs
+func RunSummary(status string) OperationSummary {
+	recorders.Lock()
+	list := append([]*summaryRecorder{}, recorders.list...)
+	recorders.Unlock()
+
+	var summaries []OperationSummary
+	for _, r := range list {
+		summaries = append(summaries, r.snapshot())
+	}
+
+	summary := mergeSummaries(summaries)
+	summary.Status = status
+
+	if len(list) > 0 && !summary.empty() {
+		list[0].logger.Summary(summary)
+	}
+
+	return summary
+}
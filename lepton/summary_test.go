@@ -0,0 +1,77 @@
+package lepton
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestOperationSummary(t *testing.T) {
+	c := NewConfig()
+	c.RunConfig.DeployID = "d1"
+	c.RunConfig.Quiet = true
+	ctx := NewContext(c, nil)
+
+	ctx.progress(ProgressUpload, "image", ProgressStarted, 0, "")
+	ctx.progress(ProgressUpload, "image", ProgressDone, 100, "")
+	ctx.recordUpload(3000000)
+	ctx.recordCreated("instance", "i-1")
+	ctx.recordInstanceCost("t2.micro", 1)
+	ctx.recordInstanceCost("x9.huge", 1)
+	ctx.recordDeleted("instance", "i-0")
+	ctx.recordInstanceCost("t2.micro", -1)
+
+	summary := ctx.Summary()
+	if summary.DeployID != "d1" || len(summary.Created) != 1 || len(summary.Deleted) != 1 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+	if _, ok := summary.Phases[ProgressUpload]; !ok {
+		t.Errorf("upload phase not timed: %v", summary.Phases)
+	}
+	if summary.BytesUploaded != 3000000 || summary.CostDelta != 0 || summary.Unpriced != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	summary.Status = ProgressFailed
+	s := summary.String()
+	for _, part := range []string{"failed: ", "created instance i-1", "deleted instance i-0", "uploaded 3.0 MB", "1 instances not priced"} {
+		if !strings.Contains(s, part) {
+			t.Errorf("expected %q in %q", part, s)
+		}
+	}
+
+	// prices of the config take precedence over the built-in ones
+	c.CloudConfig.InstancePrices = map[string]float64{"e2-medium": 0.0335, "t2.micro": 0.5}
+	ctx = NewContext(c, nil)
+	ctx.recordInstanceCost("e2-medium", 2)
+	ctx.recordInstanceCost("t2.micro", 1)
+	if cost := ctx.Summary().CostDelta; cost != 0.567 {
+		t.Errorf("expected the config prices, got %v", cost)
+	}
+
+	// providers that don't record their resources are reported
+	var p Provider = &DigitalOcean{}
+	if summary := NewContext(c, &p).Summary(); !summary.Unrecorded || !strings.Contains(summary.String(), "not supported") {
+		t.Errorf("expected the resources of digitalocean not to be supported, got %q", summary.String())
+	}
+	p = &GCloud{}
+	if NewContext(c, &p).Summary().Unrecorded {
+		t.Error("expected gcp to record its resources")
+	}
+
+	merged := mergeSummaries([]OperationSummary{
+		{DeployID: "d1", Created: []SummaryResource{{Kind: "image", ID: "ami-1"}}, CostDelta: 0.5, Duration: 2},
+		{DeployID: "d1", Deleted: []SummaryResource{{Kind: "image", ID: "ami-0"}}, CostDelta: -0.25, Duration: 3},
+	})
+	if len(merged.Created) != 1 || len(merged.Deleted) != 1 || merged.CostDelta != 0.25 || merged.Duration != 3 {
+		t.Errorf("unexpected merged summary %+v", merged)
+	}
+
+	var out bytes.Buffer
+	logger := NewLogger(&out)
+	logger.SetFormat(LogFormatJSON)
+	logger.Summary(merged)
+	if !strings.Contains(out.String(), `"level":"summary"`) || !strings.Contains(out.String(), `"hourly_cost_delta":0.25`) {
+		t.Errorf("unexpected summary entry %s", out.String())
+	}
+}
@@ -8,3 +8,13 @@ import (
 func sysKill(pid int) error {
 	return syscall.Kill(pid, 9)
 }
+
+// sysFreeSpace returns the bytes available to unprivileged users on the
+// filesystem of dir
+func sysFreeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -8,3 +8,8 @@ import (
 func sysKill(pid int) error {
 	return errors.New("not supported")
 }
+
+// sysFreeSpace returns the bytes available on the filesystem of dir
+func sysFreeSpace(dir string) (uint64, error) {
+	return 0, errors.New("not supported")
+}
@@ -0,0 +1,111 @@
+package lepton
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Formats of the timestamps of the image, instance and volume listings
+const (
+	TimeFormatUTC      = "utc"      // 2006-01-02 15:04:05 UTC
+	TimeFormatLocal    = "local"    // in the time zone of the machine
+	TimeFormatRelative = "relative" // e.g. 3 days ago
+)
+
+// timestampLayout is the layout of the utc and local timestamps
+const timestampLayout = "2006-01-02 15:04:05 MST"
+
+// timestampLayouts are the layouts of the timestamps returned by the
+// providers: rfc3339 by aws, gcp and digital ocean, go time strings by the
+// sdks returning times and zoneless utc times by vultr and openstack
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// ValidTimeFormat returns an error if format isn't a timestamp format
+func ValidTimeFormat(format string) error {
+	if format != "" && format != TimeFormatUTC && format != TimeFormatLocal && format != TimeFormatRelative {
+		return fmt.Errorf("unknown time format %s, expected %s, %s or %s", format, TimeFormatUTC, TimeFormatLocal, TimeFormatRelative)
+	}
+	return nil
+}
+
+// ParseTimestamp parses a timestamp returned by a provider, false if it isn't
+// one. Timestamps without zone are utc
+func ParseTimestamp(s string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// formatTime returns the time in the timestamp format
+func formatTime(t time.Time, format string) string {
+	switch format {
+	case TimeFormatLocal:
+		return t.Local().Format(timestampLayout)
+	case TimeFormatRelative:
+		return time2Human(t)
+	default:
+		return t.UTC().Format(timestampLayout)
+	}
+}
+
+// FormatTimestamp returns the timestamp of a provider in the format, as is if
+// it can't be parsed
+func FormatTimestamp(s string, format string) string {
+	t, ok := ParseTimestamp(s)
+	if !ok {
+		return s
+	}
+	return formatTime(t, format)
+}
+
+// normalizeTimestamp returns the timestamp of a provider as rfc3339 utc, the
+// exports being read by other tools
+func normalizeTimestamp(s string) string {
+	t, ok := ParseTimestamp(s)
+	if !ok {
+		return s
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// newestFirst returns true if timestamp a is more recent than b, timestamps
+// that can't be parsed being the oldest
+func newestFirst(a string, b string) bool {
+	ta, okA := ParseTimestamp(a)
+	tb, okB := ParseTimestamp(b)
+	if okA != okB {
+		return okA
+	}
+	return ta.After(tb)
+}
+
+// sortImagesByCreated sorts the images newest first
+func sortImagesByCreated(images []CloudImage) {
+	sort.SliceStable(images, func(i, j int) bool {
+		return newestFirst(images[i].Created, images[j].Created)
+	})
+}
+
+// sortInstancesByCreated sorts the instances newest first
+func sortInstancesByCreated(instances []CloudInstance) {
+	sort.SliceStable(instances, func(i, j int) bool {
+		return newestFirst(instances[i].Created, instances[j].Created)
+	})
+}
+
+// sortVolumesByCreated sorts the volumes newest first
+func sortVolumesByCreated(volumes []NanosVolume) {
+	sort.SliceStable(volumes, func(i, j int) bool {
+		return newestFirst(volumes[i].CreatedAt, volumes[j].CreatedAt)
+	})
+}
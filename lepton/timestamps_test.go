@@ -0,0 +1,75 @@
+package lepton
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	expected := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	for _, timestamp := range []string{
+		"2021-03-04T05:06:07.000Z",                // aws images
+		"2021-03-03T21:06:07.000-08:00",           // gcp
+		"2021-03-04T05:06:07Z",                    // digital ocean
+		"2021-03-04 05:06:07 +0000 UTC",           // go times
+		"2021-03-04 06:06:07.000000001 +0100 CET", // go times with nanoseconds
+		"2021-03-04 05:06:07",                     // vultr
+	} {
+		parsed, ok := ParseTimestamp(timestamp)
+		if !ok {
+			t.Errorf("unable to parse %s", timestamp)
+			continue
+		}
+		if !parsed.Truncate(time.Second).Equal(expected) {
+			t.Errorf("expected %s to be %s, got %s", timestamp, expected, parsed)
+		}
+	}
+
+	if _, ok := ParseTimestamp("3 days ago"); ok {
+		t.Error("expected a relative time not to parse")
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	if formatted := FormatTimestamp("2021-03-03T21:06:07.000-08:00", TimeFormatUTC); formatted != "2021-03-04 05:06:07 UTC" {
+		t.Errorf("unexpected utc timestamp %s", formatted)
+	}
+
+	if formatted := FormatTimestamp("2021-03-04T05:06:07Z", ""); formatted != "2021-03-04 05:06:07 UTC" {
+		t.Errorf("expected utc timestamps by default, got %s", formatted)
+	}
+
+	recent := time.Now().Add(-3 * Day).UTC().Format(time.RFC3339)
+	if formatted := FormatTimestamp(recent, TimeFormatRelative); !strings.HasSuffix(formatted, "ago") {
+		t.Errorf("expected a relative timestamp, got %s", formatted)
+	}
+
+	if formatted := FormatTimestamp("n/a", TimeFormatLocal); formatted != "n/a" {
+		t.Errorf("expected unparseable timestamps as is, got %s", formatted)
+	}
+
+	if err := ValidTimeFormat("iso"); err == nil {
+		t.Error("expected unknown time format error")
+	}
+}
+
+func TestSortImagesByCreated(t *testing.T) {
+	images := []CloudImage{
+		{Name: "unknown", Created: ""},
+		{Name: "old", Created: "2021-03-04 05:06:07 +0000 UTC"},
+		{Name: "new", Created: "2021-03-04T06:00:00.000+01:00"},
+		{Name: "newest", Created: "2021-03-05T00:00:00Z"},
+	}
+
+	sortImagesByCreated(images)
+
+	var names []string
+	for _, image := range images {
+		names = append(names, image.Name)
+	}
+	if strings.Join(names, ",") != "newest,old,new,unknown" {
+		t.Errorf("unexpected order %v", names)
+	}
+}
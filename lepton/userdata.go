@@ -0,0 +1,53 @@
+package lepton
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// awsUserDataMaxSize is the maximum size of the user data allowed by AWS
+const awsUserDataMaxSize = 16 * 1024
+
+// buildUserData builds the user data document read by the nanos cloud_init
+// klib on boot. The instance environment variables are merged into the "Env"
+// key of the configured user data file, which must hold a JSON object.
+func buildUserData(c *Config) (string, error) {
+	if c.RunConfig.UserData == "" && len(c.RunConfig.InstanceEnv) == 0 {
+		return "", nil
+	}
+
+	document := map[string]interface{}{}
+
+	if c.RunConfig.UserData != "" {
+		data, err := ioutil.ReadFile(c.RunConfig.UserData)
+		if err != nil {
+			return "", fmt.Errorf("read user data: %v", err)
+		}
+
+		if len(c.RunConfig.InstanceEnv) == 0 {
+			return string(data), nil
+		}
+
+		err = json.Unmarshal(data, &document)
+		if err != nil {
+			return "", fmt.Errorf("user data %s must be a JSON object to add environment variables: %v", c.RunConfig.UserData, err)
+		}
+	}
+
+	env := map[string]interface{}{}
+	if existing, ok := document["Env"].(map[string]interface{}); ok {
+		env = existing
+	}
+	for k, v := range c.RunConfig.InstanceEnv {
+		env[k] = v
+	}
+	document["Env"] = env
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
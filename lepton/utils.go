@@ -1,7 +1,10 @@
 package lepton
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -72,6 +75,15 @@ func isDomainValid(name string) error {
 	return nil
 }
 
+// intsToStrings converts slice of integers to a slice of strings
+func intsToStrings(si []int) []string {
+	sa := make([]string, 0, len(si))
+	for _, i := range si {
+		sa = append(sa, strconv.Itoa(i))
+	}
+	return sa
+}
+
 // SliceAtoi converts slice of strings to a slice of integers
 func SliceAtoi(sa []string) ([]int, error) {
 	si := make([]int, 0, len(sa))
@@ -84,3 +96,63 @@ func SliceAtoi(sa []string) ([]int, error) {
 	}
 	return si, nil
 }
+
+// fileSHA256 returns the hex encoded sha256 checksum of a file
+func fileSHA256(filepath string) (string, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ParsePortRange parses a port or a port range like 8000-8100 returning its bounds
+func ParsePortRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, "-", 2)
+
+	from, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid port range %s", s)
+	}
+
+	to := from
+	if len(parts) == 2 {
+		to, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid port range %s", s)
+		}
+	}
+
+	if from < 1 || to > 65535 || from > to {
+		return 0, 0, fmt.Errorf("invalid port range %s", s)
+	}
+
+	return from, to, nil
+}
+
+// allowedSources returns the source CIDRs allowed to reach the instance ports
+func allowedSources(c *Config) []string {
+	if len(c.RunConfig.AllowedIPs) != 0 {
+		return c.RunConfig.AllowedIPs
+	}
+	return []string{"0.0.0.0/0"}
+}
+
+// sourcesByFamily splits the source CIDRs in the ipv4 and the ipv6 ones
+func sourcesByFamily(sources []string) (ipv4 []string, ipv6 []string) {
+	for _, source := range sources {
+		if strings.Contains(source, ":") {
+			ipv6 = append(ipv6, source)
+		} else {
+			ipv4 = append(ipv4, source)
+		}
+	}
+	return ipv4, ipv6
+}
@@ -0,0 +1,47 @@
+package lepton
+
+import "testing"
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		s    string
+		from int
+		to   int
+		err  bool
+	}{
+		{"80", 80, 80, false},
+		{"1", 1, 1, false},
+		{"65535", 65535, 65535, false},
+		{"8000-8100", 8000, 8100, false},
+		{"8000-8000", 8000, 8000, false},
+		{" 8000 - 8100 ", 8000, 8100, false},
+		{"8100-8000", 0, 0, true},
+		{"0", 0, 0, true},
+		{"65536", 0, 0, true},
+		{"0-80", 0, 0, true},
+		{"80-65536", 0, 0, true},
+		{"", 0, 0, true},
+		{"http", 0, 0, true},
+		{"-80", 0, 0, true},
+		{"80-", 0, 0, true},
+		{"80-90-100", 0, 0, true},
+		{"80,90", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		from, to, err := ParsePortRange(tt.s)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParsePortRange(%q): expected an error, got %d-%d", tt.s, from, to)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePortRange(%q): %v", tt.s, err)
+			continue
+		}
+		if from != tt.from || to != tt.to {
+			t.Errorf("ParsePortRange(%q): got %d-%d, want %d-%d", tt.s, from, to, tt.from, tt.to)
+		}
+	}
+}
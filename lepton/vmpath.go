@@ -0,0 +1,87 @@
+package lepton
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// toVMPath converts a host path into the path used inside the image
+func toVMPath(hostpath string) string {
+	return vmPath(hostpath, runtime.GOOS == "windows")
+}
+
+// vmPath converts a host path into a slash separated image path. On windows
+// hosts drive letters and UNC volume names are dropped and backslashes are
+// treated as separators.
+func vmPath(hostpath string, windows bool) string {
+	p := hostpath
+	if windows {
+		p = strings.Replace(p, "\\", "/", -1)
+		if len(p) >= 2 && p[1] == ':' && isDriveLetter(p[0]) {
+			p = p[2:]
+		} else if strings.HasPrefix(p, "//") {
+			// \\server\share\dir -> /dir
+			parts := strings.SplitN(strings.TrimPrefix(p, "//"), "/", 3)
+			if len(parts) == 3 {
+				p = "/" + parts[2]
+			} else {
+				p = "/"
+			}
+		}
+	}
+
+	if p == "" {
+		return ""
+	}
+
+	rooted := strings.HasPrefix(p, "/")
+	p = path.Clean(p)
+	if !rooted {
+		p = strings.TrimPrefix(p, "./")
+	}
+	return p
+}
+
+func isDriveLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// warnCaseCollision warns when name differs only in case from an existing
+// entry of node, as both can't coexist on case-insensitive host filesystems
+func warnCaseCollision(node map[string]interface{}, name string, vmpath string) {
+	if _, ok := node[name]; ok {
+		return
+	}
+	for k := range node {
+		if strings.EqualFold(k, name) {
+			fmt.Printf("warning: %s differs only in case from existing entry %s, paths are case sensitive in the image\n", vmpath, k)
+			return
+		}
+	}
+}
+
+// warnCRLFScript warns when hostpath is a script with windows line endings,
+// since the interpreter line would include a trailing carriage return
+func warnCRLFScript(hostpath string) {
+	f, err := os.Open(hostpath)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	buf := make([]byte, 256)
+	n, _ := f.Read(buf)
+	buf = buf[:n]
+
+	if !bytes.HasPrefix(buf, []byte("#!")) {
+		return
+	}
+
+	if bytes.Contains(buf, []byte("\r\n")) {
+		fmt.Printf("warning: script %s has CRLF line endings, convert it to LF to run it in the image\n", hostpath)
+	}
+}
@@ -0,0 +1,27 @@
+package lepton
+
+import "testing"
+
+func TestVMPath(t *testing.T) {
+	var tests = []struct {
+		hostpath string
+		windows  bool
+		want     string
+	}{
+		{"/bin/ls", false, "/bin/ls"},
+		{"./examples/hw", false, "examples/hw"},
+		{"static//index.html", false, "static/index.html"},
+		{`C:\Users\ops\app.exe`, true, "/Users/ops/app.exe"},
+		{`d:/data/static`, true, "/data/static"},
+		{`static\css\main.css`, true, "static/css/main.css"},
+		{`.\hw`, true, "hw"},
+		{`\\server\share\data\file`, true, "/data/file"},
+	}
+
+	for _, tt := range tests {
+		got := vmPath(tt.hostpath, tt.windows)
+		if got != tt.want {
+			t.Errorf("vmPath(%q, %v) = %q, want %q", tt.hostpath, tt.windows, got, tt.want)
+		}
+	}
+}
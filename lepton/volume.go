@@ -18,6 +18,7 @@ type NanosVolume struct {
 	Data       string `json:"data"`
 	Size       string `json:"size"`
 	Path       string `json:"path"`
+	Zone       string `json:"zone,omitempty"`
 	AttachedTo string `json:"attached_to"`
 	CreatedAt  string `json:"created_at"`
 	Status     string `json:"status"`
@@ -88,8 +89,11 @@ func CreateLocalVolume(config *Config, name, data, size, provider string) (Nanos
 	return vol, nil
 }
 
-// PrintVolumesList writes into console a table with volumes details
-func PrintVolumesList(volumes *[]NanosVolume) {
+// PrintVolumesList writes into console a table with volumes details, newest
+// first with timestamps in the time format
+func PrintVolumesList(volumes *[]NanosVolume, timeFormat string) {
+	sortVolumesByCreated(*volumes)
+
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"UUID", "Name", "Status", "Size (GB)", "Location", "Created", "Attached"})
 	table.SetHeaderColor(
@@ -109,8 +113,12 @@ func PrintVolumesList(volumes *[]NanosVolume) {
 		row = append(row, vol.Name)
 		row = append(row, vol.Status)
 		row = append(row, vol.Size)
-		row = append(row, vol.Path)
-		row = append(row, vol.CreatedAt)
+		if vol.Zone != "" {
+			row = append(row, vol.Zone)
+		} else {
+			row = append(row, vol.Path)
+		}
+		row = append(row, FormatTimestamp(vol.CreatedAt, timeFormat))
 		row = append(row, vol.AttachedTo)
 		table.Append(row)
 	}
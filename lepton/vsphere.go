@@ -3,6 +3,7 @@ package lepton
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -133,8 +134,8 @@ func (v *Vsphere) CreateImage(ctx *Context) error {
 	flat := vmdkBase + "-flat.vmdk"
 	base := vmdkBase + ".vmdk"
 
-	flatPath := "/tmp/" + flat
-	imgPath := "/tmp/" + base
+	flatPath := path.Join(tempDir(ctx.config), flat)
+	imgPath := path.Join(tempDir(ctx.config), base)
 
 	f := find.NewFinder(v.client, true)
 	ds, err := f.DatastoreOrDefault(context.TODO(), v.datastore)
@@ -209,7 +210,7 @@ func (v *Vsphere) GetImages(ctx *Context) ([]CloudImage, error) {
 		fmt.Println("un-implemented")
 	}
 
-	return cimages, nil
+	return FilterImages(cimages, ctx.listFilters())
 }
 
 // ListImages lists images on a datastore.
@@ -251,8 +252,7 @@ func (v *Vsphere) DeleteImage(ctx *Context, imagename string) error {
 
 // SyncImage syncs image from provider to another provider
 func (v *Vsphere) SyncImage(config *Config, target Provider, image string) error {
-	fmt.Println("not yet implemented")
-	return nil
+	return errors.New("image sync is not yet implemented")
 }
 
 // CreateInstance - Creates instance on VSphere.
@@ -419,8 +419,14 @@ func (v *Vsphere) CreateInstance(ctx *Context) error {
 	return nil
 }
 
-// GetInstanceByID returns the instance with the id passed by argument if it exists
+// GetInstanceByID returns the instance with the id passed by argument if it
+// exists. Virtual machines are identified by name
 func (v *Vsphere) GetInstanceByID(ctx *Context, id string) (*CloudInstance, error) {
+	return v.GetInstanceByName(ctx, id)
+}
+
+// GetInstanceByName returns the instance with the name passed by argument if it exists
+func (v *Vsphere) GetInstanceByName(ctx *Context, name string) (*CloudInstance, error) {
 	m := view.NewManager(v.client)
 
 	cv, err := m.CreateContainerView(context.TODO(), v.client.ServiceContent.RootFolder, []string{"VirtualMachine"}, true)
@@ -431,13 +437,13 @@ func (v *Vsphere) GetInstanceByID(ctx *Context, id string) (*CloudInstance, erro
 	defer cv.Destroy(context.TODO())
 
 	var vms []mo.VirtualMachine
-	err = cv.RetrieveWithFilter(context.TODO(), []string{"VirtualMachine"}, []string{"summary"}, &vms, property.Filter{"name": id})
+	err = cv.RetrieveWithFilter(context.TODO(), []string{"VirtualMachine"}, []string{"summary"}, &vms, property.Filter{"name": name})
 	if err != nil {
 		return nil, err
 	}
 
 	if len(vms) == 0 {
-		return nil, ErrInstanceNotFound(id)
+		return nil, ErrInstanceNotFound(name)
 	}
 
 	return v.convertToCloudInstance(&vms[0]), nil
@@ -468,7 +474,7 @@ func (v *Vsphere) GetInstances(ctx *Context) ([]CloudInstance, error) {
 		cinstances = append(cinstances, *cInstance)
 	}
 
-	return cinstances, nil
+	return FilterInstances(cinstances, ctx.listFilters())
 }
 
 func (v *Vsphere) convertToCloudInstance(vm *mo.VirtualMachine) *CloudInstance {
@@ -498,6 +504,7 @@ func (v *Vsphere) ListInstances(ctx *Context) error {
 	if err != nil {
 		return err
 	}
+	sortInstancesByCreated(cInstances)
 
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Name", "IP", "Status", "Created"})
@@ -516,7 +523,7 @@ func (v *Vsphere) ListInstances(ctx *Context) error {
 		row = append(row, strings.Join(instance.PublicIps, ","))
 
 		row = append(row, instance.Status)
-		row = append(row, instance.Created)
+		row = append(row, FormatTimestamp(instance.Created, ctx.config.RunConfig.TimeFormat))
 		table.Append(row)
 	}
 
@@ -777,6 +784,31 @@ func (v *Vsphere) StopInstance(ctx *Context, instancename string) error {
 	return err
 }
 
+// RebootInstance resets an instance from VSphere
+func (v *Vsphere) RebootInstance(ctx *Context, instancename string) error {
+	f := find.NewFinder(v.client, true)
+
+	dc, err := f.DatacenterOrDefault(context.TODO(), v.datacenter)
+	if err != nil {
+		return err
+	}
+
+	f.SetDatacenter(dc)
+
+	vms, err := f.VirtualMachineList(context.TODO(), instancename)
+	if err != nil {
+		return err
+	}
+
+	task, err := vms[0].Reset(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	_, err = task.WaitForResult(context.TODO(), nil)
+	return err
+}
+
 // PrintInstanceLogs writes instance logs to console
 func (v *Vsphere) PrintInstanceLogs(ctx *Context, instancename string, watch bool) error {
 	l, err := v.GetInstanceLogs(ctx, instancename)
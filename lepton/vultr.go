@@ -39,52 +39,55 @@ func (v *Vultr) BuildImageWithPackage(ctx *Context, pkgpath string) (string, err
 	return v.customizeImage(ctx)
 }
 
-func (v *Vultr) createImage(key string, bucket string, region string) {
-	createURL := "https://api.vultr.com/v1/snapshot/create_from_url"
-
-	objURL := v.Storage.getSignedURL(key, bucket, region)
-
-	token := os.Getenv("TOKEN")
-
-	urlData := url.Values{}
-	urlData.Set("url", objURL)
-
-	req, err := http.NewRequest("POST", createURL, strings.NewReader(urlData.Encode()))
-	req.Header.Set("API-Key", token)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// post sends the form to the Vultr API endpoint
+func (v *Vultr) post(ctx *Context, endpoint string, urlData url.Values) error {
+	req, err := http.NewRequest("POST", "https://api.vultr.com/v1/"+endpoint, strings.NewReader(urlData.Encode()))
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer resp.Body.Close()
+	req.Header.Set("API-Key", os.Getenv("TOKEN"))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println("response Body:", string(body))
+	_, err = v.do(ctx, req)
+	return err
 }
 
-func (v *Vultr) destroyImage(snapshotid string) {
-	destroyURL := "https://api.vultr.com/v1/snapshot/destroy"
-
-	token := os.Getenv("TOKEN")
-
-	urlData := url.Values{}
-	urlData.Set("SNAPSHOTID", snapshotid)
+// get reads the Vultr API endpoint into the value
+func (v *Vultr) get(ctx *Context, endpoint string, value interface{}) error {
+	req, err := http.NewRequest("GET", "https://api.vultr.com/v1/"+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("API-Key", os.Getenv("TOKEN"))
+	req.Header.Set("Content-Type", "application/json")
 
-	req, err := http.NewRequest("POST", destroyURL, strings.NewReader(urlData.Encode()))
-	req.Header.Set("API-Key", token)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	body, err := v.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, value)
+}
 
+// do sends the request and returns the response body, which is logged
+// for debugging
+func (v *Vultr) do(ctx *Context, req *http.Request) ([]byte, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println("response Body:", string(body))
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	ctx.logger.Debug("response Body: %s", body)
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return body, nil
 }
 
 // Initialize GCP related things
@@ -100,9 +103,10 @@ func (v *Vultr) CreateImage(ctx *Context) error {
 	key := c.CloudConfig.ImageName + ".img"
 	zone := c.CloudConfig.Zone
 
-	v.createImage(key, bucket, zone)
+	urlData := url.Values{}
+	urlData.Set("url", v.Storage.getSignedURL(key, bucket, zone))
 
-	return nil
+	return v.post(ctx, "snapshot/create_from_url", urlData)
 }
 
 type vultrSnap struct {
@@ -122,35 +126,10 @@ func (v *Vultr) GetImages(ctx *Context) ([]CloudImage, error) {
 
 // ListImages lists images on Digital Ocean
 func (v *Vultr) ListImages(ctx *Context) error {
-
-	client := http.Client{}
-	req, err := http.NewRequest("GET", "https://api.vultr.com/v1/snapshot/list", nil)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	token := os.Getenv("TOKEN")
-
-	req.Header.Set("API-Key", token)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
 	var data map[string]vultrSnap
-
-	err = json.Unmarshal(body, &data)
+	err := v.get(ctx, "snapshot/list", &data)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
 	table := tablewriter.NewWriter(os.Stdout)
@@ -178,15 +157,15 @@ func (v *Vultr) ListImages(ctx *Context) error {
 
 // DeleteImage deletes image from v
 func (v *Vultr) DeleteImage(ctx *Context, snapshotID string) error {
-	v.destroyImage(snapshotID)
+	urlData := url.Values{}
+	urlData.Set("SNAPSHOTID", snapshotID)
 
-	return nil
+	return v.post(ctx, "snapshot/destroy", urlData)
 }
 
 // SyncImage syncs image from provider to another provider
 func (v *Vultr) SyncImage(config *Config, target Provider, image string) error {
-	fmt.Println("not yet implemented")
-	return nil
+	return errors.New("image sync is not yet implemented")
 }
 
 // ResizeImage is not supported on Vultr.
@@ -200,10 +179,6 @@ func (v *Vultr) CreateInstance(ctx *Context) error {
 
 	// you may poll /v1/server/list?SUBID=<SUBID> and check that the "status" field is set to "active"
 
-	createURL := "https://api.vultr.com/v1/server/create"
-
-	token := os.Getenv("TOKEN")
-
 	urlData := url.Values{}
 	urlData.Set("DCID", "1")
 
@@ -215,21 +190,7 @@ func (v *Vultr) CreateInstance(ctx *Context) error {
 	urlData.Set("OSID", "164")
 	urlData.Set("SNAPSHOTID", c.CloudConfig.ImageName)
 
-	req, err := http.NewRequest("POST", createURL, strings.NewReader(urlData.Encode()))
-	req.Header.Set("API-Key", token)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		panic(err)
-	}
-	defer resp.Body.Close()
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println("response Body:", string(body))
-
-	return nil
+	return v.post(ctx, "server/create", urlData)
 }
 
 type vultrServer struct {
@@ -246,6 +207,11 @@ func (v *Vultr) GetInstanceByID(ctx *Context, id string) (*CloudInstance, error)
 	return nil, errors.New("un-implemented")
 }
 
+// GetInstanceByName returns the instance with the name passed by argument if it exists
+func (v *Vultr) GetInstanceByName(ctx *Context, name string) (*CloudInstance, error) {
+	return nil, errors.New("un-implemented")
+}
+
 // GetInstances return all instances on Vultr
 // TODO
 func (v *Vultr) GetInstances(ctx *Context) ([]CloudInstance, error) {
@@ -254,35 +220,10 @@ func (v *Vultr) GetInstances(ctx *Context) ([]CloudInstance, error) {
 
 // ListInstances lists instances on v
 func (v *Vultr) ListInstances(ctx *Context) error {
-
-	client := http.Client{}
-	req, err := http.NewRequest("GET", "https://api.vultr.com/v1/server/list", nil)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-	token := os.Getenv("TOKEN")
-
-	req.Header.Set("API-Key", token)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-
 	var data map[string]vultrServer
-
-	err = json.Unmarshal(body, &data)
+	err := v.get(ctx, "server/list", &data)
 	if err != nil {
-		fmt.Println(err)
+		return err
 	}
 
 	table := tablewriter.NewWriter(os.Stdout)
@@ -312,77 +253,34 @@ func (v *Vultr) ListInstances(ctx *Context) error {
 
 // DeleteInstance deletes instance from v
 func (v *Vultr) DeleteInstance(ctx *Context, instanceID string) error {
-	destroyInstanceURL := "https://api.vultr.com/v1/server/destroy"
-
-	token := os.Getenv("TOKEN")
-
 	urlData := url.Values{}
 	urlData.Set("SUBID", instanceID)
 
-	req, err := http.NewRequest("POST", destroyInstanceURL, strings.NewReader(urlData.Encode()))
-	req.Header.Set("API-Key", token)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		panic(err)
-	}
-	defer resp.Body.Close()
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println("response Body:", string(body))
-	return nil
+	return v.post(ctx, "server/destroy", urlData)
 }
 
 // StartInstance starts an instance in v
 func (v *Vultr) StartInstance(ctx *Context, instanceID string) error {
-	startInstanceURL := "https://api.vultr.com/v1/server/start"
-
-	token := os.Getenv("TOKEN")
-
 	urlData := url.Values{}
 	urlData.Set("SUBID", instanceID)
 
-	req, err := http.NewRequest("POST", startInstanceURL, strings.NewReader(urlData.Encode()))
-	req.Header.Set("API-Key", token)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		panic(err)
-	}
-	defer resp.Body.Close()
-
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println("response Body:", string(body))
-	return nil
+	return v.post(ctx, "server/start", urlData)
 }
 
 // StopInstance halts instance from v
 func (v *Vultr) StopInstance(ctx *Context, instanceID string) error {
-	haltInstanceURL := "https://api.vultr.com/v1/server/halt"
-
-	token := os.Getenv("TOKEN")
-
 	urlData := url.Values{}
 	urlData.Set("SUBID", instanceID)
 
-	req, err := http.NewRequest("POST", haltInstanceURL, strings.NewReader(urlData.Encode()))
-	req.Header.Set("API-Key", token)
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return v.post(ctx, "server/halt", urlData)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		panic(err)
-	}
-	defer resp.Body.Close()
+// RebootInstance reboots instance from v
+func (v *Vultr) RebootInstance(ctx *Context, instanceID string) error {
+	urlData := url.Values{}
+	urlData.Set("SUBID", instanceID)
 
-	body, _ := ioutil.ReadAll(resp.Body)
-	fmt.Println("response Body:", string(body))
-	return nil
+	return v.post(ctx, "server/reboot", urlData)
 }
 
 // PrintInstanceLogs writes instance logs to console
@@ -391,7 +289,7 @@ func (v *Vultr) PrintInstanceLogs(ctx *Context, instancename string, watch bool)
 	if err != nil {
 		return err
 	}
-	fmt.Printf(l)
+	fmt.Print(l)
 	return nil
 }
 
@@ -0,0 +1,113 @@
+package lepton
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// wasmMagic starts the binary format of wasm modules
+var wasmMagic = []byte{0, 'a', 's', 'm'}
+
+// isWasmModule returns true if the file at path is a wasm module
+func isWasmModule(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(wasmMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, wasmMagic)
+}
+
+// wasmBuildCommand returns the command compiling the program in the source
+// directory to a wasi module at output, nil if no toolchain builds it
+func wasmBuildCommand(dir string, output string) *exec.Cmd {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	switch {
+	case exists("go.mod"):
+		cmd := exec.Command("tinygo", "build", "-target=wasi", "-o", output, ".")
+		cmd.Dir = dir
+		return cmd
+	case exists("Cargo.toml"):
+		cmd := exec.Command("cargo", "build", "--release", "--target", "wasm32-wasi")
+		cmd.Dir = dir
+		return cmd
+	}
+	return nil
+}
+
+// cargoWasmModule returns the module built by cargo in the source directory,
+// the only one of its release target
+func cargoWasmModule(dir string) (string, error) {
+	modules, err := filepath.Glob(filepath.Join(dir, "target", "wasm32-wasi", "release", "*.wasm"))
+	if err != nil {
+		return "", err
+	}
+	if len(modules) != 1 {
+		return "", fmt.Errorf("expected a single wasm module in the release target of %s, found %d", dir, len(modules))
+	}
+	return modules[0], nil
+}
+
+// BuildWasmModule returns the wasi module of the program of the config: the
+// program itself if it's a wasm module, otherwise the module compiled from
+// the source directory of a Go program with tinygo or of a Rust program with
+// cargo. Nanos ELF binaries can't be run by edge platforms
+func BuildWasmModule(c *Config) (string, error) {
+	if c.Program == "" {
+		return "", errors.New("no program to build a wasm module of")
+	}
+
+	info, err := os.Stat(c.Program)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.IsDir() {
+		if isWasmModule(c.Program) {
+			return c.Program, nil
+		}
+		return "", fmt.Errorf("%s is not a wasm module, pass a wasm module or the source directory of a Go or Rust program", c.Program)
+	}
+
+	name := c.CloudConfig.ImageName
+	if name == "" {
+		name = filepath.Base(filepath.Clean(c.Program))
+	}
+	output := path.Join(GetOpsHome(), "wasm", name+".wasm")
+
+	cmd := wasmBuildCommand(c.Program, output)
+	if cmd == nil {
+		return "", fmt.Errorf("%s has no go.mod or Cargo.toml to build a wasm module from", c.Program)
+	}
+
+	if err := os.MkdirAll(path.Dir(output), 0755); err != nil {
+		return "", err
+	}
+
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %v", strings.Join(cmd.Args, " "), err)
+	}
+
+	if cmd.Args[0] == "cargo" {
+		return cargoWasmModule(c.Program)
+	}
+	return output, nil
+}
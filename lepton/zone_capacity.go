@@ -0,0 +1,72 @@
+package lepton
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// retryInZones launches in zone then, while the launches fail for lack of
+// capacity, in the other zones of the region returned by others, and returns
+// the zone the launch succeeded in. others is nil when the config pins the
+// zone, the launch isn't moved then
+func retryInZones(ctx *Context, zone string, others func() ([]string, error), exhausted func(error) bool, launch func(zone string) error) (string, error) {
+	err := launch(zone)
+	if err == nil || others == nil || !exhausted(err) {
+		return zone, err
+	}
+
+	zones, listErr := others()
+	if listErr != nil {
+		ctx.logger.Warn("unable to list the zones to retry in: %v", listErr)
+		return zone, err
+	}
+
+	tried := []string{zone}
+	for _, other := range zones {
+		if other == zone {
+			continue
+		}
+
+		ctx.logger.Warn("no capacity in %s, retrying in %s", tried[len(tried)-1], other)
+
+		err = launch(other)
+		if err == nil {
+			ctx.logger.Log("Found capacity in %s, %s had none", other, strings.Join(tried, ", "))
+			return other, nil
+		}
+		if !exhausted(err) {
+			return other, err
+		}
+
+		tried = append(tried, other)
+	}
+
+	return zone, fmt.Errorf("no capacity in %s: %v", strings.Join(tried, ", "), err)
+}
+
+// awsCapacityExhausted returns true if the launch failed because the
+// availability zone has no capacity for the instance type
+func awsCapacityExhausted(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == "InsufficientInstanceCapacity"
+}
+
+// gcpCapacityExhausted returns true if the launch failed because the zone
+// has no resources left for the machine type, with or without details
+func gcpCapacityExhausted(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "ZONE_RESOURCE_POOL_EXHAUSTED")
+}
+
+// azureCapacityExhausted returns true if the virtual machine couldn't be
+// allocated in the location or zone
+func azureCapacityExhausted(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "AllocationFailed") || strings.Contains(msg, "OverconstrainedAllocationRequest") ||
+		strings.Contains(msg, "OverconstrainedZonalAllocationRequest")
+}
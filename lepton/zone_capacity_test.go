@@ -0,0 +1,122 @@
+package lepton
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2020-06-01/compute"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestRetryInZones(t *testing.T) {
+	ctx := NewContext(NewConfig(), nil)
+	exhausted := errors.New("ZONE_RESOURCE_POOL_EXHAUSTED - no resources")
+	others := func() ([]string, error) { return []string{"us-west1-a", "us-west1-b", "us-west1-c"}, nil }
+
+	var launched []string
+	zone, err := retryInZones(ctx, "us-west1-a", others, gcpCapacityExhausted, func(zone string) error {
+		launched = append(launched, zone)
+		if zone != "us-west1-c" {
+			return exhausted
+		}
+		return nil
+	})
+	if err != nil || zone != "us-west1-c" {
+		t.Errorf("expected capacity in us-west1-c, got %s, %v", zone, err)
+	}
+	if !reflect.DeepEqual(launched, []string{"us-west1-a", "us-west1-b", "us-west1-c"}) {
+		t.Errorf("unexpected launches %v", launched)
+	}
+
+	// a pinned zone isn't moved
+	launched = nil
+	_, err = retryInZones(ctx, "us-west1-a", nil, gcpCapacityExhausted, func(zone string) error {
+		launched = append(launched, zone)
+		return exhausted
+	})
+	if err != exhausted || len(launched) != 1 {
+		t.Errorf("expected a single launch in the pinned zone, got %v, %v", launched, err)
+	}
+
+	// other failures aren't retried
+	launched = nil
+	_, err = retryInZones(ctx, "us-west1-a", others, gcpCapacityExhausted, func(zone string) error {
+		launched = append(launched, zone)
+		return errors.New("QUOTA_EXCEEDED")
+	})
+	if err == nil || len(launched) != 1 {
+		t.Errorf("expected a single launch, got %v, %v", launched, err)
+	}
+
+	_, err = retryInZones(ctx, "us-west1-a", others, gcpCapacityExhausted, func(zone string) error {
+		return exhausted
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "no capacity in us-west1-a, us-west1-b, us-west1-c:") {
+		t.Errorf("expected the zones tried in the error, got %v", err)
+	}
+}
+
+func TestCapacityExhausted(t *testing.T) {
+	if !awsCapacityExhausted(awserr.New("InsufficientInstanceCapacity", "no capacity", nil)) {
+		t.Error("expected aws insufficient capacity")
+	}
+	if awsCapacityExhausted(awserr.New("InstanceLimitExceeded", "limit", nil)) {
+		t.Error("expected instance limits not to be capacity failures")
+	}
+
+	if !gcpCapacityExhausted(errors.New("ZONE_RESOURCE_POOL_EXHAUSTED_WITH_DETAILS - no resources")) {
+		t.Error("expected gcp resource pool exhausted")
+	}
+
+	if !azureCapacityExhausted(errors.New(`Code="ZonalAllocationFailed" Message="Allocation failed"`)) {
+		t.Error("expected azure allocation failure")
+	}
+	if azureCapacityExhausted(errors.New(`Code="InvalidParameter"`)) {
+		t.Error("expected invalid parameters not to be capacity failures")
+	}
+}
+
+func TestZoneMovable(t *testing.T) {
+	c := NewConfig()
+	if !zoneMovable(c) {
+		t.Error("expected instances without placement constraints to be movable")
+	}
+
+	c.RunConfig.Tenancy = ec2.TenancyHost
+	if zoneMovable(c) {
+		t.Error("expected instances on dedicated hosts to stay in their zone")
+	}
+
+	ipv6 := &ec2.Subnet{Ipv6CidrBlockAssociationSet: []*ec2.SubnetIpv6CidrBlockAssociation{
+		{Ipv6CidrBlockState: &ec2.SubnetCidrBlockState{State: aws.String(ec2.SubnetCidrBlockStateCodeAssociated)}},
+	}}
+	disassociated := &ec2.Subnet{Ipv6CidrBlockAssociationSet: []*ec2.SubnetIpv6CidrBlockAssociation{
+		{Ipv6CidrBlockState: &ec2.SubnetCidrBlockState{State: aws.String(ec2.SubnetCidrBlockStateCodeDisassociated)}},
+	}}
+	if !subnetHasIPv6(ipv6) || subnetHasIPv6(disassociated) || subnetHasIPv6(&ec2.Subnet{}) {
+		t.Error("expected only the subnet with an associated ipv6 block to have ipv6")
+	}
+}
+
+func TestAzureSkuZones(t *testing.T) {
+	sku := compute.ResourceSku{
+		LocationInfo: &[]compute.ResourceSkuLocationInfo{
+			{Location: to.StringPtr("EastUS"), Zones: &[]string{"3", "1"}},
+			{Location: to.StringPtr("westus"), Zones: &[]string{"2"}},
+		},
+	}
+
+	if zones := azureSkuZones(sku, "eastus"); !reflect.DeepEqual(zones, []string{"1", "3"}) {
+		t.Errorf("unexpected zones %v", zones)
+	}
+
+	// locations without zones aren't retried in
+	if zones := azureSkuZones(sku, "northcentralus"); len(zones) != 0 {
+		t.Errorf("expected no zones, got %v", zones)
+	}
+}
@@ -0,0 +1,86 @@
+package lepton
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// maxZoneWorkers is the number of zones an operation runs in at once
+const maxZoneWorkers = 8
+
+// ZoneError is the failure of an operation in one of the zones it fanned out
+// to
+type ZoneError struct {
+	Zone string
+	Err  error
+}
+
+func (e *ZoneError) Error() string {
+	return e.Zone + ": " + e.Err.Error()
+}
+
+// ConfigForZone returns a copy of the config targeting zone. The copy shares
+// no slice or map with the config, the zones of a fan out run concurrently.
+// {zone} in the bucket name is replaced by the zone, aws images being
+// imported from a bucket of their region
+func ConfigForZone(c *Config, zone string) (*Config, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	zc := &Config{}
+	err = json.Unmarshal(data, zc)
+	if err != nil {
+		return nil, err
+	}
+
+	zc.CloudConfig.Zone = zone
+	zc.CloudConfig.Zones = nil
+	zc.CloudConfig.BucketName = strings.Replace(zc.CloudConfig.BucketName, "{zone}", zone, -1)
+
+	return zc, nil
+}
+
+// FanOutZones runs op in each zone concurrently and returns the errors of the
+// zones it failed in, in the order of the zones
+func FanOutZones(zones []string, op func(zone string) error) []*ZoneError {
+	errs := make([]error, len(zones))
+
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, maxZoneWorkers)
+	for i, zone := range zones {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, zone string) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			errs[i] = op(zone)
+		}(i, zone)
+	}
+	wg.Wait()
+
+	var failed []*ZoneError
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, &ZoneError{Zone: zones[i], Err: err})
+		}
+	}
+
+	return failed
+}
+
+// WithRegionColumn returns the header and rows of a listing in zone with the
+// zone as first column, the listings of a fan out merging in one table
+func WithRegionColumn(zone string, header []string, rows [][]string) ([]string, [][]string) {
+	regionHeader := append([]string{"Region"}, header...)
+
+	regionRows := make([][]string, len(rows))
+	for i, row := range rows {
+		regionRows[i] = append([]string{zone}, row...)
+	}
+
+	return regionHeader, regionRows
+}
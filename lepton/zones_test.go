@@ -0,0 +1,61 @@
+package lepton
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFanOutZones(t *testing.T) {
+	var calls int32
+	failed := FanOutZones([]string{"us-east-1", "eu-west-1", "ap-south-1"}, func(zone string) error {
+		atomic.AddInt32(&calls, 1)
+		if zone != "eu-west-1" {
+			return errors.New("quota exceeded")
+		}
+		return nil
+	})
+
+	if calls != 3 {
+		t.Errorf("expected the operation to run in 3 zones, ran in %d", calls)
+	}
+
+	if len(failed) != 2 || failed[0].Zone != "us-east-1" || failed[1].Zone != "ap-south-1" {
+		t.Fatalf("expected us-east-1 and ap-south-1 to fail in order, got %v", failed)
+	}
+
+	if failed[0].Error() != "us-east-1: quota exceeded" {
+		t.Errorf("unexpected zone error %s", failed[0].Error())
+	}
+}
+
+func TestConfigForZone(t *testing.T) {
+	c := NewConfig()
+	c.CloudConfig.Zone = "us-east-1"
+	c.CloudConfig.Zones = []string{"us-east-1", "eu-west-1"}
+	c.CloudConfig.BucketName = "images-{zone}"
+	c.RunConfig.Ports = []int{80}
+
+	zc, err := ConfigForZone(c, "eu-west-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if zc.CloudConfig.Zone != "eu-west-1" || len(zc.CloudConfig.Zones) != 0 || zc.CloudConfig.BucketName != "images-eu-west-1" {
+		t.Errorf("unexpected zone config %+v", zc.CloudConfig)
+	}
+
+	zc.RunConfig.Ports[0] = 8080
+	if c.RunConfig.Ports[0] != 80 {
+		t.Error("expected the zone config not to share the ports of the config")
+	}
+}
+
+func TestWithRegionColumn(t *testing.T) {
+	header, rows := WithRegionColumn("eu-west-1", []string{"Name", "Id"}, [][]string{{"web", "i-1"}})
+
+	if !reflect.DeepEqual(header, []string{"Region", "Name", "Id"}) || !reflect.DeepEqual(rows, [][]string{{"eu-west-1", "web", "i-1"}}) {
+		t.Errorf("unexpected listing %v %v", header, rows)
+	}
+}